@@ -2,28 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // timezone names must resolve in minimal containers
 
 	"tspages/config"
 	"tspages/internal/admin"
 	"tspages/internal/analytics"
+	"tspages/internal/anomaly"
 	"tspages/internal/auth"
 	"tspages/internal/cli"
 	"tspages/internal/deploy"
+	"tspages/internal/deployindex"
+	"tspages/internal/digest"
+	"tspages/internal/events"
+	"tspages/internal/fieldcrypt"
 	"tspages/internal/httplog"
 	"tspages/internal/metrics"
 	"tspages/internal/multihost"
+	"tspages/internal/replica"
+	"tspages/internal/serve"
+	"tspages/internal/sitehealth"
+	"tspages/internal/status"
 	"tspages/internal/storage"
+	"tspages/internal/tamper"
+	"tspages/internal/transfer"
 	"tspages/internal/tsadapter"
+	"tspages/internal/verify"
 	"tspages/internal/webhook"
 
 	"tailscale.com/tsnet"
@@ -35,16 +52,36 @@ func main() {
 	// Subcommand dispatch — must happen before flag.Parse().
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
+		case "bench":
+			if err := cli.Bench(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		case "deploy":
 			if err := cli.Deploy(os.Args[2:]); err != nil {
 				log.Fatal(err)
 			}
 			return
+		case "export":
+			if err := cli.Export(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "import":
+			if err := cli.Import(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		case "init":
 			if err := cli.Init(os.Args[2:]); err != nil {
 				log.Fatal(err)
 			}
 			return
+		case "reconcile":
+			if err := cli.Reconcile(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		case "version":
 			fmt.Println(version)
 			return
@@ -70,92 +107,265 @@ func main() {
 	if err := logLevel.UnmarshalText([]byte(cfg.Server.LogLevel)); err != nil {
 		log.Fatalf("invalid log level %q: %v", cfg.Server.LogLevel, err)
 	}
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	slog.SetDefault(slog.New(httplog.NewHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))))
 
 	store := storage.New(cfg.Server.DataDir)
+	if report, err := store.CheckIntegrity(); err != nil {
+		slog.Error("checking storage integrity", "err", err)
+	} else {
+		for _, issue := range report.Issues {
+			slog.Warn("repaired deployment", "site", issue.Site, "id", issue.DeploymentID,
+				"action", issue.Action, "reason", issue.Reason, "rolled_back_to", issue.RolledBackTo)
+		}
+		for _, e := range report.Errors {
+			slog.Error("could not repair deployment", "err", e)
+		}
+	}
 	store.CleanupOrphans()
 
-	recorder, err := analytics.NewRecorder(filepath.Join(cfg.Server.DataDir, "analytics.db"))
+	sqlitePath := filepath.Join(cfg.Server.DataDir, "analytics.db")
+	analyticsDSN := sqlitePath
+	if cfg.Analytics.Driver == config.AnalyticsDriverPostgres {
+		analyticsDSN = cfg.Analytics.DSN
+	}
+	fieldCipher, err := fieldcrypt.New(cfg.Server.EncryptionKey) // validated by config.Load
+	if err != nil {
+		log.Fatalf("encryption key: %v", err)
+	}
+	recorder, err := analytics.NewRecorderWithConfig(analyticsDSN, analytics.RecorderConfig{
+		BufferSize:   cfg.Server.AnalyticsBufferSize,
+		BlockTimeout: time.Duration(cfg.Server.AnalyticsBlockMS) * time.Millisecond,
+		Driver:       cfg.Analytics.Driver,
+		Visitors:     cfg.Analytics.Visitors,
+		Cipher:       fieldCipher,
+	})
 	if err != nil {
 		log.Fatalf("opening analytics db: %v", err)
 	}
 	defer recorder.Close() //nolint:errcheck // best-effort cleanup on shutdown
 
-	notifier, err := webhook.NewNotifier(recorder.DB())
+	// Webhook deliveries and the deployment index are always kept in the
+	// local SQLite database, shared with analytics unless those live in
+	// PostgreSQL.
+	localDB := recorder.DB()
+	if recorder.Driver() != analytics.DriverSQLite {
+		localDB, err = analytics.OpenSQLite(sqlitePath)
+		if err != nil {
+			log.Fatalf("opening local db: %v", err) //nolint:gocritic // exitAfterDefer is intentional — process is dying
+		}
+		defer localDB.Close() //nolint:errcheck // best-effort cleanup on shutdown
+	}
+	notifier, err := webhook.NewNotifier(localDB)
 	if err != nil {
 		log.Fatalf("creating webhook notifier: %v", err) //nolint:gocritic // exitAfterDefer is intentional — process is dying
 	}
+	notifier.SetCipher(fieldCipher)
+	deploymentIndex, err := deployindex.New(localDB, store)
+	if err != nil {
+		log.Fatalf("opening deployment index: %v", err) //nolint:gocritic // exitAfterDefer is intentional — process is dying
+	}
+
+	// Subsystems publish deploy, site, and health events to the bus instead
+	// of calling their consumers directly.
+	bus := events.New()
+	notifier.Subscribe(bus)
+	deploymentIndex.Subscribe(bus)
+	events.RecordActivity(bus, store)
+	bus.Subscribe("*", func(e events.Event) {
+		metrics.CountEvent(e.Type)
+		slog.Info("event", "type", e.Type, "site", e.Site, "data", e.Data)
+	})
 
 	admin.SetHideFooter(cfg.Server.HideFooter)
+	serverLocation, _ := time.LoadLocation(cfg.Server.Timezone) // validated by config.Load
 
-	// Control plane tsnet server — start it and listen before creating
+	// The control plane is served through its own tsnet server, unless
+	// identity comes from a reverse proxy. Start listening before creating
 	// handlers so we can resolve the DNS suffix first.
-	srv := &tsnet.Server{
-		Hostname: cfg.Tailscale.Hostname,
-		Dir:      cfg.Tailscale.StateDir,
-		AuthKey:  cfg.Tailscale.AuthKey,
-	}
-	defer srv.Close() //nolint:errcheck // best-effort cleanup on shutdown
+	var (
+		srv         *tsnet.Server
+		ln          net.Listener
+		dnsSuffix   string
+		whoIsClient *tsadapter.Adapter
+	)
+	if cfg.Auth.Mode == config.AuthModeHeader {
+		ln, err = net.Listen("tcp", cfg.Auth.Listen)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		defer ln.Close()
+		dnsSuffix = cfg.Auth.DNSSuffix
+		if dnsSuffix == "" {
+			slog.Warn("auth.dns_suffix is not set; site URLs will be incomplete")
+		}
+	} else {
+		srv = &tsnet.Server{
+			Hostname: cfg.Tailscale.Hostname,
+			Dir:      cfg.Tailscale.StateDir,
+			AuthKey:  cfg.Tailscale.AuthKey,
+		}
+		defer srv.Close() //nolint:errcheck // best-effort cleanup on shutdown
 
-	lc, err := srv.LocalClient()
-	if err != nil {
-		log.Fatalf("getting local client: %v", err)
-	}
+		lc, err := srv.LocalClient()
+		if err != nil {
+			log.Fatalf("getting local client: %v", err)
+		}
 
-	ln, err := srv.ListenTLS("tcp", ":443")
-	if err != nil {
-		log.Fatalf("listen: %v", err)
+		ln, err = srv.ListenTLS("tcp", ":443")
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		defer ln.Close()
+
+		// Resolve DNS suffix now that the server is connected.
+		status, err := lc.StatusWithoutPeers(context.Background())
+		if err != nil {
+			log.Fatalf("getting tailnet status: %v", err)
+		}
+		if status.CurrentTailnet != nil {
+			dnsSuffix = status.CurrentTailnet.MagicDNSSuffix
+		}
+		whoIsClient = tsadapter.New(lc)
 	}
-	defer ln.Close()
 
-	// Resolve DNS suffix now that the server is connected.
-	var dnsSuffix string
-	status, err := lc.StatusWithoutPeers(context.Background())
-	if err != nil {
-		log.Fatalf("getting tailnet status: %v", err)
+	mgrCfg := multihost.ManagerConfig{
+		Store:              store,
+		StateDir:           cfg.Tailscale.StateDir,
+		AuthKey:            cfg.Tailscale.AuthKey,
+		Capability:         cfg.Tailscale.Capability,
+		MaxSites:           cfg.Server.MaxSites,
+		Recorder:           recorder,
+		DNSSuffix:          dnsSuffix,
+		Defaults:           cfg.Defaults,
+		Events:             bus,
+		StartupConcurrency: cfg.Server.StartupConcurrency,
 	}
-	if status.CurrentTailnet != nil {
-		dnsSuffix = status.CurrentTailnet.MagicDNSSuffix
+	for _, d := range cfg.Domains {
+		mgrCfg.Domains = append(mgrCfg.Domains, multihost.Domain{
+			Site:     d.Site,
+			Hostname: d.Hostname,
+			CertFile: d.CertFile,
+			KeyFile:  d.KeyFile,
+		})
 	}
-
-	mgr := multihost.New(multihost.ManagerConfig{
-		Store:      store,
-		StateDir:   cfg.Tailscale.StateDir,
-		AuthKey:    cfg.Tailscale.AuthKey,
-		Capability: cfg.Tailscale.Capability,
-		MaxSites:   cfg.Server.MaxSites,
-		Recorder:   recorder,
-		DNSSuffix:  dnsSuffix,
-		Defaults:   cfg.Defaults,
+	replicaOf := cfg.Server.ReplicaOf
+	if replicaOf != "" {
+		mgrCfg.HostnameSuffix = cfg.Server.ReplicaHostnameSuffix
+	}
+	serve.SetCompression(serve.CompressionConfig{
+		GzipLevel:   cfg.Server.GzipLevel,
+		BrotliLevel: cfg.Server.BrotliLevel,
+		MaxBytes:    int64(cfg.Server.CompressMaxMB) << 20,
+		Workers:     cfg.Server.CompressWorkers,
 	})
+	mgrCfg.Limits = multihost.ServerLimits{
+		ReadHeaderTimeout:     time.Duration(cfg.Server.SiteReadHeaderTimeout) * time.Second,
+		IdleTimeout:           time.Duration(cfg.Server.SiteIdleTimeout) * time.Second,
+		MaxHeaderBytes:        cfg.Server.SiteMaxHeaderKB << 10,
+		MaxConnectionsPerNode: cfg.Server.SiteMaxConnectionsPerNode,
+	}
+	mgr := multihost.New(mgrCfg)
 	defer mgr.Close()
 
-	whoIsClient := tsadapter.New(lc)
-	withAuth := auth.Middleware(whoIsClient, cfg.Tailscale.Capability)
+	var (
+		withIdentity func(http.Handler) http.Handler
+		withViewAs   func(http.Handler) http.Handler
+		resolver     auth.UserResolver
+	)
+	if cfg.Auth.Mode == config.AuthModeHeader {
+		headerCfg, err := cfg.Auth.HeaderConfig()
+		if err != nil {
+			log.Fatalf("auth: %v", err)
+		}
+		withIdentity = auth.MiddlewareFor(auth.NewHeaderAuthenticator(headerCfg, cfg.Tailscale.Capability), cfg.Tailscale.Capability)
+		// Other users cannot be looked up without a request from them, so
+		// there is no "view as" preview.
+		withViewAs = func(next http.Handler) http.Handler { return next }
+		admin.DisableViewAs()
+	} else {
+		withIdentity = auth.Middleware(whoIsClient, cfg.Tailscale.Capability)
+		withViewAs = auth.ViewAs(whoIsClient, cfg.Tailscale.Capability)
+		resolver = whoIsClient
+	}
+	readOnly := admin.NewReadOnlyMode(cfg.Server.ReadOnly, cfg.Server.ReadOnlyMessage)
+	healthScorer := sitehealth.NewScorer(store, recorder, mgr, notifier)
+	h := admin.NewHandlers(store, recorder, dnsSuffix, mgr, mgr, cfg.Defaults, notifier, bus, admin.Options{
+		DeploymentIndex: deploymentIndex,
+		HealthScorer:    healthScorer,
+		Preferences:     store,
+		ReadOnly:        readOnly,
+		Timezone:        serverLocation,
+	})
+	withAuth := func(next http.Handler) http.Handler {
+		return withIdentity(readOnly.Middleware(withViewAs(h.Middleware(next))))
+	}
+	if replicaOf != "" {
+		// Replicas mirror the primary; all changes must be made there.
+		withAuth = func(next http.Handler) http.Handler {
+			return withIdentity(replica.ReadOnly(withViewAs(h.Middleware(next))))
+		}
+	}
 
 	deployHandler := deploy.NewHandler(deploy.HandlerConfig{
-		Store:          store,
-		Manager:        mgr,
-		MaxUploadMB:    cfg.Server.MaxUploadMB,
-		MaxDeployments: cfg.Server.MaxDeployments,
-		DNSSuffix:      dnsSuffix,
-		Notifier:       notifier,
-		Defaults:       cfg.Defaults,
+		Store:            store,
+		Manager:          mgr,
+		MaxUploadMB:      cfg.Server.MaxUploadMB,
+		MaxDeployments:   cfg.Server.MaxDeployments,
+		PrecompressLevel: cfg.Server.PrecompressLevel,
+		Symlinks:         cfg.Server.Symlinks,
+		DNSSuffix:        dnsSuffix,
+		Events:           bus,
+		Defaults:         cfg.Defaults,
 	})
-	deleteHandler := deploy.NewDeleteHandler(store, mgr, notifier, cfg.Defaults)
+	fetchHandler := deploy.NewFetchHandler(deployHandler, cfg.Server.FetchAllowedHosts)
+	bundleHandler := deploy.NewBundleHandler(deployHandler)
+	deleteHandler := deploy.NewDeleteHandler(store, mgr, bus, cfg.Defaults)
 	listHandler := deploy.NewListDeploymentsHandler(store)
-	deleteDeploymentHandler := deploy.NewDeleteDeploymentHandler(store)
-	cleanupDeploymentsHandler := deploy.NewCleanupDeploymentsHandler(store)
-	activateHandler := deploy.NewActivateHandler(store, mgr)
-	h := admin.NewHandlers(store, recorder, dnsSuffix, mgr, mgr, cfg.Defaults, notifier)
-	healthHandler := admin.NewHealthHandler(store, recorder)
+	deleteDeploymentHandler := deploy.NewDeleteDeploymentHandler(store, bus)
+	cleanupDeploymentsHandler := deploy.NewCleanupDeploymentsHandler(store, bus)
+	activateHandler := deploy.NewActivateHandler(store, mgr, bus, cfg.Defaults)
+	canaryHandler := deploy.NewCanaryHandler(store, mgr, bus)
+	stopCanaryHandler := deploy.NewStopCanaryHandler(store, mgr, bus)
+	pinHandler := deploy.NewPinHandler(store, bus)
+	deployLogHandler := deploy.NewDeploymentLogHandler(store)
+	compareHandler := deploy.NewCompareHandler(deployHandler)
+	purgeCacheHandler := deploy.NewPurgeCacheHandler(store, mgr, bus)
+	deploy.PurgeCacheOnActivation(bus, mgr)
+	notifier.PurgeOnActivation(bus, store, cfg.Defaults)
+	healthHandler := admin.NewHealthHandler(store, recorder, bus, mgr)
+	readyHandler := admin.NewReadyHandler(mgr)
 
 	mux := http.NewServeMux()
-	registerRoutes(mux, withAuth, h, healthHandler,
-		deployHandler, listHandler, deleteHandler,
-		deleteDeploymentHandler, cleanupDeploymentsHandler, activateHandler)
+	viewAsHandler := admin.NewViewAsHandler(resolver)
+	siteStateDir := filepath.Join(cfg.Tailscale.StateDir, "sites")
+	registerRoutes(mux, withAuth, withIdentity, h, routeHandlers{
+		health:             healthHandler,
+		ready:              readyHandler,
+		viewAs:             viewAsHandler,
+		deploy:             deployHandler,
+		fetch:              fetchHandler,
+		bundle:             bundleHandler,
+		list:               listHandler,
+		delete:             deleteHandler,
+		deleteDeployment:   deleteDeploymentHandler,
+		cleanupDeployments: cleanupDeploymentsHandler,
+		activate:           activateHandler,
+		canary:             canaryHandler,
+		stopCanary:         stopCanaryHandler,
+		pin:                pinHandler,
+		deployLog:          deployLogHandler,
+		compare:            compareHandler,
+		purgeCache:         purgeCacheHandler,
+		replicaSnapshot:    replica.NewSnapshotHandler(store),
+		replicaArchive:     replica.NewArchiveHandler(store),
+		replicaCachePolicy: replica.NewCachePolicyHandler(store, cfg.Defaults),
+		replicaAnalytics:   replica.NewAnalyticsHandler(store, recorder),
+		gc:                 admin.NewGCHandler(store, siteStateDir),
+		readOnly:           admin.NewReadOnlyHandler(readOnly),
+		eraseUser:          admin.NewEraseUserHandler(store, recorder, deploymentIndex, fieldCipher, bus),
+	})
 
-	listenErr := make(chan error, 3)
+	listenErr := make(chan error, 4)
 
 	var devWSProxy http.Handler
 	if *dev {
@@ -191,7 +401,7 @@ func main() {
 			return
 		}
 		if r.URL.Path == "/" {
-			http.Redirect(w, r, "/sites", http.StatusFound)
+			withAuth(h.Landing).ServeHTTP(w, r)
 			return
 		}
 		admin.RenderError(w, r, http.StatusNotFound, "")
@@ -201,6 +411,7 @@ func main() {
 	if addr := cfg.Server.HealthAddr; addr != "" {
 		healthMux := http.NewServeMux()
 		healthMux.Handle("GET /healthz", healthHandler)
+		healthMux.Handle("GET /readyz", readyHandler)
 		go func() {
 			slog.Info("health check listening", "addr", addr)
 			if err := http.ListenAndServe(addr, healthMux); err != nil {
@@ -209,14 +420,78 @@ func main() {
 		}()
 	}
 
-	// Start servers for all sites with active deployments
-	if err := mgr.StartExistingSites(); err != nil {
-		slog.Warn("starting existing sites", "err", err)
-	}
-
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
+	// Start servers for all sites in the background; /readyz reports when
+	// every site was tried.
+	go func() {
+		if err := mgr.StartExistingSites(ctx); err != nil {
+			slog.Warn("starting existing sites", "err", err)
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadAuthKey(ctx, hup, *configPath, mgr)
+
+	go housekeeping(ctx, store, notifier, deploymentIndex, siteStateDir,
+		time.Duration(cfg.Server.TrashRetentionDays)*24*time.Hour,
+		time.Duration(cfg.Server.WebhookRetentionDays)*24*time.Hour)
+	go transfer.NewMonitor(store, recorder, bus, cfg.Defaults).Run(ctx)
+	go anomaly.NewDetector(store, recorder, bus, cfg.Defaults, primaryURL(cfg.Tailscale.Hostname, dnsSuffix)).Run(ctx)
+	go healthScorer.Run(ctx)
+	if minutes := cfg.Server.TamperCheckMinutes; minutes > 0 {
+		go tamper.NewWatcher(store, bus, cfg.Defaults, cfg.Server.TamperCheckFiles).Run(ctx, time.Duration(minutes)*time.Minute)
+	}
+
+	// Replicas leave digests and verification to their primary so they are
+	// not sent twice.
+	if dc := cfg.Digest; (dc.Schedule != "" || dc.VerifySchedule != "") && replicaOf == "" {
+		var senders []digest.Sender
+		if dc.SlackWebhookURL != "" {
+			senders = append(senders, digest.NewSlack(dc.SlackWebhookURL))
+		}
+		if len(dc.EmailTo) > 0 {
+			senders = append(senders, digest.NewEmail(dc.SMTPHost, dc.SMTPPort, dc.SMTPUsername, dc.SMTPPassword, dc.EmailFrom, dc.EmailTo))
+		}
+		if dc.Schedule != "" {
+			schedule, _ := digest.ParseSchedule(dc.Schedule) // validated by config.Load
+			compiler := digest.NewCompiler(store, recorder, notifier, dc.Sites)
+			go digest.NewScheduler(schedule, compiler, senders...).Run(ctx)
+		}
+		if dc.VerifySchedule != "" {
+			schedule, _ := digest.ParseSchedule(dc.VerifySchedule) // validated by config.Load
+			go verify.NewVerifier(store, mgr, notifier, cfg.Defaults, dc.VerifySampleFiles, senders...).Run(ctx, schedule)
+		}
+	}
+
+	// Replicas leave the status page to their primary, whose hostname it
+	// would clash with.
+	if sp := cfg.StatusPage; sp.Enabled && replicaOf == "" {
+		if sites, _ := store.ListSites(); slices.ContainsFunc(sites, func(s storage.SiteInfo) bool { return s.Name == sp.Hostname }) {
+			slog.Warn("status page hostname is also a site's; one of them will be renamed by Tailscale", "hostname", sp.Hostname)
+		}
+		monitor := status.NewMonitor(store, mgr, sp.Sites)
+		go monitor.Run(ctx, time.Duration(sp.CheckInterval)*time.Second)
+		statusSrv, err := serveStatusPage(cfg, status.NewHandler(monitor, sp.Title), listenErr)
+		if err != nil {
+			log.Fatalf("status page: %v", err) //nolint:gocritic // exitAfterDefer is intentional — process is dying
+		}
+		defer statusSrv.Close() //nolint:errcheck // best-effort cleanup on shutdown
+	}
+
+	if replicaOf != "" {
+		primary := primaryURL(replicaOf, dnsSuffix)
+		syncer := replica.NewSyncer(store, srv.HTTPClient(), primary, mgr)
+		slog.Info("running as replica", "primary", primary)
+		go syncer.Run(ctx, time.Duration(cfg.Server.ReplicaSyncInterval)*time.Second)
+		if cfg.Server.ReplicaForwardAnalytics {
+			forwarder := replica.NewForwarder(recorder, srv.HTTPClient(), primary, cfg.Tailscale.Hostname)
+			go forwarder.Run(ctx, time.Duration(cfg.Server.ReplicaSyncInterval)*time.Second)
+		}
+	}
+
 	httpSrv := &http.Server{Handler: httplog.Wrap(mux)}
 	go func() {
 		if err := httpSrv.Serve(ln); err != http.ErrServerClosed {
@@ -224,7 +499,11 @@ func main() {
 		}
 	}()
 
-	slog.Info("tspages control plane listening", "hostname", cfg.Tailscale.Hostname)
+	if srv != nil {
+		slog.Info("tspages control plane listening", "hostname", cfg.Tailscale.Hostname)
+	} else {
+		slog.Info("tspages control plane listening", "addr", ln.Addr().String(), "auth", cfg.Auth.Mode)
+	}
 	select {
 	case <-ctx.Done():
 	case err := <-listenErr:
@@ -239,60 +518,255 @@ func main() {
 	}
 }
 
-func registerRoutes(
-	mux *http.ServeMux,
-	withAuth func(http.Handler) http.Handler,
-	h *admin.Handlers,
-	healthHandler http.Handler,
-	deployHandler http.Handler,
-	listHandler http.Handler,
-	deleteHandler http.Handler,
-	deleteDeploymentHandler http.Handler,
-	cleanupDeploymentsHandler http.Handler,
-	activateHandler http.Handler,
-) {
+// primaryURL turns a replica_of setting into the primary's base URL. Bare
+// hostnames are qualified with the tailnet's MagicDNS suffix so the TLS
+// certificate matches.
+func primaryURL(replicaOf, dnsSuffix string) string {
+	if strings.Contains(replicaOf, "://") {
+		return strings.TrimRight(replicaOf, "/")
+	}
+	host := replicaOf
+	if !strings.Contains(host, ".") && dnsSuffix != "" {
+		host += "." + dnsSuffix
+	}
+	return "https://" + host
+}
+
+// serveStatusPage serves the status page through its own tsnet server, to
+// everyone on the tailnet who can reach its hostname.
+func serveStatusPage(cfg *config.Config, h http.Handler, listenErr chan<- error) (*tsnet.Server, error) {
+	hostname := cfg.StatusPage.Hostname
+	srv := &tsnet.Server{
+		Hostname: hostname,
+		Dir:      filepath.Join(cfg.Tailscale.StateDir, "status"),
+		AuthKey:  cfg.Tailscale.AuthKey,
+	}
+	ln, err := srv.ListenTLS("tcp", ":443")
+	if err != nil {
+		srv.Close() //nolint:errcheck // cleanup on error path
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	go func() {
+		slog.Info("status page listening", "hostname", hostname)
+		if err := http.Serve(ln, httplog.Wrap(h, slog.String("site", hostname))); err != nil && !errors.Is(err, net.ErrClosed) {
+			listenErr <- fmt.Errorf("status page: %w", err)
+		}
+	}()
+	return srv, nil
+}
+
+// reloadAuthKey reads the Tailscale auth key from the config file again on
+// every signal from hup, and hands it to mgr, which restarts the sites that
+// could not log in with the previous one. It runs until ctx ends.
+func reloadAuthKey(ctx context.Context, hup <-chan os.Signal, configPath string, mgr *multihost.Manager) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			slog.Error("reloading auth key", "err", err)
+			continue
+		}
+		slog.Info("reloaded auth key", "failed_sites", len(mgr.LoginFailures()))
+		if err := mgr.SetAuthKey(cfg.Tailscale.AuthKey); err != nil {
+			slog.Error("restarting sites with the reloaded auth key", "err", err)
+		}
+	}
+}
+
+// housekeeping permanently removes trashed sites and deployments once they
+// are older than retention, prunes webhook deliveries older than
+// webhookRetention (unless it is zero), then collects garbage left by
+// interrupted uploads and deleted sites and reconciles the deployment index
+// with storage. It runs at startup and then hourly until ctx ends.
+func housekeeping(ctx context.Context, store *storage.Store, notifier *webhook.Notifier, index *deployindex.Index, siteStateDir string, retention, webhookRetention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := store.PurgeTrash(time.Now().Add(-retention)); err != nil {
+			slog.Error("purging trash", "err", err)
+		} else if n > 0 {
+			slog.Info("purged trash", "entries", n)
+		}
+		if webhookRetention > 0 {
+			if n, err := notifier.Prune(time.Now().Add(-webhookRetention)); err != nil {
+				slog.Error("pruning webhook deliveries", "err", err)
+			} else if n > 0 {
+				slog.Info("pruned webhook deliveries", "attempts", n)
+			}
+		}
+		report, err := store.CollectGarbage(storage.GCOptions{MinAge: storage.OrphanMinAge, StateDir: siteStateDir})
+		if err != nil {
+			slog.Error("collecting garbage", "err", err)
+		} else if !report.Empty() {
+			slog.Info("collected garbage", "bytes", report.ReclaimedBytes,
+				"deployments", len(report.OrphanedDeployments),
+				"state_dirs", len(report.DanglingStateDirs),
+				"files", len(report.UnreferencedFiles))
+		}
+		for _, e := range report.Errors {
+			slog.Warn("collecting garbage", "err", e)
+		}
+		if sites, deployments, err := index.Reconcile(); err != nil {
+			slog.Error("reconciling deployment index", "err", err)
+		} else {
+			slog.Debug("reconciled deployment index", "sites", sites, "deployments", deployments)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// routeRegistrar is the part of *http.ServeMux that registerRoutes uses,
+// so tests can list the registered routes.
+type routeRegistrar interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// routeHandlers are the handlers of the control plane's routes that are not
+// methods of *admin.Handlers.
+type routeHandlers struct {
+	health, ready, viewAs http.Handler
+	// Deploy API
+	deploy, fetch, bundle, list, delete                    http.Handler
+	deleteDeployment, cleanupDeployments, activate, canary http.Handler
+	stopCanary, pin, deployLog, compare, purgeCache        http.Handler
+	// Replication API
+	replicaSnapshot, replicaArchive, replicaCachePolicy, replicaAnalytics http.Handler
+	// Administration
+	gc, readOnly, eraseUser http.Handler
+}
+
+// registerRoutes registers the control plane's routes. Every route outside
+// the admin UI's own pages and assets is documented in openapi.yaml, which
+// TestOpenAPI_DocumentsRoutes checks.
+func registerRoutes(mux routeRegistrar, withAuth, withIdentity func(http.Handler) http.Handler, h *admin.Handlers, rh routeHandlers) {
+	// versioned registers an API route under admin.APIPrefix and, as a
+	// deprecated alias, at its original path. Routes with a .json suffix
+	// exist only for the alias; versioned routes always respond with JSON.
+	versioned := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, admin.DeprecatedAPI(handler))
+		if method, path, _ := strings.Cut(pattern, " "); !strings.HasSuffix(path, ".json") {
+			mux.Handle(method+" "+admin.APIPrefix+path, admin.VersionedAPI(handler))
+		}
+	}
+
 	// Health checks
-	mux.Handle("GET /healthz", healthHandler)
-	mux.Handle("GET /sites/{site}/healthz", withAuth(h.SiteHealth))
+	mux.Handle("GET /healthz", rh.health)
+	mux.Handle("GET /readyz", rh.ready)
+	versioned("GET /sites/{site}/healthz", withAuth(h.SiteHealth))
+	versioned("POST /sites/{site}/server/restart", withAuth(h.RestartServer))
 	// Deploy API (JSON only)
-	mux.Handle("POST /deploy/{site}", withAuth(deployHandler))
-	mux.Handle("POST /deploy/{site}/{filename}", withAuth(deployHandler))
-	mux.Handle("PUT /deploy/{site}", withAuth(deployHandler))
-	mux.Handle("PUT /deploy/{site}/{filename}", withAuth(deployHandler))
-	mux.Handle("GET /deploy/{site}", withAuth(listHandler))
-	mux.Handle("DELETE /deploy/{site}", withAuth(deleteHandler))
-	mux.Handle("DELETE /deploy/{site}/deployments", withAuth(cleanupDeploymentsHandler))
-	mux.Handle("DELETE /deploy/{site}/{id}", withAuth(deleteDeploymentHandler))
-	mux.Handle("POST /deploy/{site}/{id}/activate", withAuth(activateHandler))
+	versioned("POST /deploy", withAuth(rh.bundle))
+	versioned("POST /deploy/{site}", withAuth(rh.deploy))
+	versioned("POST /deploy/{site}/{filename}", withAuth(rh.deploy))
+	versioned("POST /deploy/{site}/fetch", withAuth(rh.fetch))
+	versioned("PUT /deploy/{site}", withAuth(rh.deploy))
+	versioned("PUT /deploy/{site}/{filename}", withAuth(rh.deploy))
+	versioned("GET /deploy/{site}", withAuth(rh.list))
+	versioned("DELETE /deploy/{site}", withAuth(rh.delete))
+	versioned("DELETE /deploy/{site}/deployments", withAuth(rh.cleanupDeployments))
+	versioned("DELETE /deploy/{site}/{id}", withAuth(rh.deleteDeployment))
+	versioned("DELETE /deploy/{site}/canary", withAuth(rh.stopCanary))
+	versioned("POST /deploy/{site}/{id}/activate", withAuth(rh.activate))
+	versioned("POST /deploy/{site}/{id}/canary", withAuth(rh.canary))
+	versioned("POST /deploy/{site}/{id}/pin", withAuth(rh.pin))
+	versioned("DELETE /deploy/{site}/{id}/pin", withAuth(rh.pin))
+	versioned("GET /deploy/{site}/{id}/log", withAuth(rh.deployLog))
+	versioned("POST /deploy/{site}/{id}/compare", withAuth(rh.compare))
 	// Browse routes (HTML + JSON via Accept header or .json suffix)
-	mux.Handle("POST /sites", withAuth(h.CreateSite))
-	mux.Handle("GET /sites", withAuth(h.Sites))
-	mux.Handle("GET /sites.json", withAuth(h.Sites))
-	mux.Handle("GET /sites/{site}", withAuth(h.Site))
-	mux.Handle("GET /sites/{site}/deployments", withAuth(h.SiteDeployments))
-	mux.Handle("GET /sites/{site}/deployments.json", withAuth(h.SiteDeployments))
-	mux.Handle("GET /sites/{site}/deployments/{id}", withAuth(h.Deployment))
-	mux.Handle("GET /sites/{site}/analytics", withAuth(h.Analytics))
-	mux.Handle("GET /sites/{site}/analytics.json", withAuth(h.Analytics))
-	mux.Handle("POST /sites/{site}/analytics/purge", withAuth(h.PurgeAnalytics))
-	mux.Handle("GET /sites/{site}/webhooks", withAuth(h.SiteWebhooks))
-	mux.Handle("GET /sites/{site}/webhooks.json", withAuth(h.SiteWebhooks))
-	mux.Handle("GET /deployments", withAuth(h.Deployments))
-	mux.Handle("GET /deployments.json", withAuth(h.Deployments))
-	mux.Handle("GET /webhooks", withAuth(h.Webhooks))
-	mux.Handle("GET /webhooks.json", withAuth(h.Webhooks))
-	mux.Handle("GET /webhooks/{id}", withAuth(h.WebhookDetail))
-	mux.Handle("POST /webhooks/{id}/retry", withAuth(h.WebhookRetry))
-	mux.Handle("GET /analytics", withAuth(h.AllAnalytics))
-	mux.Handle("GET /analytics.json", withAuth(h.AllAnalytics))
+	versioned("POST /sites", withAuth(h.CreateSite))
+	versioned("GET /sites", withAuth(h.Sites))
+	versioned("GET /sites.json", withAuth(h.Sites))
+	versioned("GET /sites/{site}", withAuth(h.Site))
+	versioned("GET /sites/{site}/deployments", withAuth(h.SiteDeployments))
+	versioned("GET /sites/{site}/deployments.json", withAuth(h.SiteDeployments))
+	versioned("GET /sites/{site}/activity", withAuth(h.SiteActivity))
+	versioned("GET /sites/{site}/activity.json", withAuth(h.SiteActivity))
+	versioned("GET /sites/{site}/live", withAuth(h.SiteLive))
+	versioned("GET /sites/{site}/files", withAuth(h.SiteFiles))
+	versioned("GET /sites/{site}/files.json", withAuth(h.SiteFiles))
+	versioned("GET /sites/{site}/files/{path...}", withAuth(h.SiteFile))
+	versioned("POST /sites/{site}/config/test", withAuth(h.ConfigTest))
+	versioned("GET /sites/{site}/deployments/verify", withAuth(h.VerifyChain))
+	versioned("GET /sites/{site}/deployments/{id}", withAuth(h.Deployment))
+	versioned("GET /sites/{site}/deployments/{id}/config", withAuth(h.ConfigSnapshot))
+	versioned("GET /sites/{site}/export", withAuth(h.ExportSite))
+	versioned("POST /sites/{site}/import", withAuth(h.ImportSite))
+	versioned("POST /sites/{site}/restore", withAuth(h.RestoreSite))
+	versioned("POST /sites/{site}/archive", withAuth(h.ArchiveSite))
+	versioned("POST /sites/{site}/unarchive", withAuth(h.UnarchiveSite))
+	versioned("GET /sites/{site}/shares", withAuth(h.Shares))
+	versioned("POST /sites/{site}/shares", withAuth(h.CreateShare))
+	versioned("POST /sites/{site}/shares/{id}/revoke", withAuth(h.RevokeShare))
+	versioned("POST /sites/{site}/deployments/{id}/restore", withAuth(h.RestoreDeployment))
+	versioned("GET /trash", withAuth(h.Trash))
+	versioned("GET /trash.json", withAuth(h.Trash))
+	versioned("GET /integrity", withAuth(h.Integrity))
+	versioned("GET /integrity.json", withAuth(h.Integrity))
+	versioned("GET /verification", withAuth(h.Verification))
+	versioned("GET /verification.json", withAuth(h.Verification))
+	versioned("GET /sites/{site}/analytics", withAuth(h.Analytics))
+	versioned("GET /sites/{site}/analytics.json", withAuth(h.Analytics))
+	versioned("POST /sites/{site}/analytics/purge", withAuth(h.PurgeAnalytics))
+	versioned("POST /sites/{site}/cache/purge", withAuth(rh.purgeCache))
+	versioned("GET /sites/{site}/webhooks", withAuth(h.SiteWebhooks))
+	versioned("GET /sites/{site}/webhooks.json", withAuth(h.SiteWebhooks))
+	versioned("GET /deployments", withAuth(h.Deployments))
+	versioned("GET /deployments.json", withAuth(h.Deployments))
+	versioned("GET /deployments/filters", withAuth(h.SavedFilters))
+	versioned("POST /deployments/filters", withAuth(h.SaveFilter))
+	versioned("POST /deployments/filters/{id}/delete", withAuth(h.DeleteSavedFilter))
+	versioned("GET /users/{login}", withAuth(h.UserActivity))
+	versioned("GET /webhooks", withAuth(h.Webhooks))
+	versioned("GET /webhooks.json", withAuth(h.Webhooks))
+	versioned("GET /webhooks/export", withAuth(h.WebhookExport))
+	versioned("GET /webhooks/{id}", withAuth(h.WebhookDetail))
+	versioned("POST /webhooks/{id}/retry", withAuth(h.WebhookRetry))
+	versioned("GET /analytics", withAuth(h.AllAnalytics))
+	versioned("GET /analytics.json", withAuth(h.AllAnalytics))
+	// Grafana JSON datasource, with /analytics as the datasource URL
+	versioned("GET /analytics/{$}", withAuth(h.AnalyticsMetrics))
+	versioned("POST /analytics/metrics", withAuth(h.AnalyticsMetrics))
+	versioned("POST /analytics/query", withAuth(h.AnalyticsQuery))
+	versioned("GET /events", withAuth(h.Events))
 	mux.Handle("GET /feed.atom", withAuth(h.Feed))
 	mux.Handle("GET /sites/{site}/feed.atom", withAuth(h.SiteFeed))
+	// Replication API, pulled by replicas
+	versioned("GET /replication/snapshot", withAuth(rh.replicaSnapshot))
+	versioned("GET /replication/sites/{site}/deployments/{id}", withAuth(rh.replicaArchive))
+	versioned("GET /replication/sites/{site}/deployments/{id}/cache-policy", withAuth(rh.replicaCachePolicy))
+	versioned("POST /replication/analytics", withAuth(rh.replicaAnalytics))
+	// Garbage collection, also run hourly by housekeeping
+	versioned("POST /admin/gc", withAuth(rh.gc))
+	// Erasure of a user's data, for requests to be forgotten
+	versioned("POST /admin/users/{login}/erase", withAuth(rh.eraseUser))
+	// Read-only mode; switching it bypasses the read-only middleware so it
+	// can be disabled again.
+	versioned("GET /read-only", withAuth(rh.readOnly))
+	versioned("PUT /read-only", withIdentity(rh.readOnly))
+	// View-as previews bypass the view-as middleware so they can be
+	// started and ended with POST while a preview is active.
+	mux.Handle("POST /view-as", withIdentity(rh.viewAs))
+	mux.Handle("POST /view-as/exit", withIdentity(&admin.ExitViewAsHandler{}))
+	versioned("GET /whoami", withAuth(h.WhoAmI))
+	versioned("GET /whoami.json", withAuth(h.WhoAmI))
+	versioned("GET /preferences", withAuth(h.Preferences))
+	versioned("PUT /preferences", withAuth(h.Preferences))
+	versioned("GET /search", withAuth(h.Search))
 	mux.Handle("GET /help", withAuth(h.Help))
 	mux.Handle("GET /help/{page...}", withAuth(h.Help))
 	mux.Handle("GET /assets/dist/{file...}", admin.AssetHandler())
 	mux.Handle("GET /api", withAuth(h.API))
 	mux.Handle("GET /openapi.yaml", admin.OpenAPIHandler())
 	mux.Handle("GET /openapi", admin.SwaggerUIHandler())
+	mux.Handle("GET /schema/siteconfig.json", admin.SiteConfigSchemaHandler())
 	mux.Handle("GET /metrics", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !auth.CanScrapeMetrics(auth.CapsFromContext(r.Context())) {
 			http.Error(w, "forbidden", http.StatusForbidden)
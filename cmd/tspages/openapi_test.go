@@ -0,0 +1,298 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v2"
+
+	"tspages/internal/admin"
+	"tspages/internal/analytics"
+	"tspages/internal/deploy"
+	"tspages/internal/multihost"
+	"tspages/internal/problem"
+	"tspages/internal/replica"
+	"tspages/internal/serve"
+	"tspages/internal/sitehealth"
+	"tspages/internal/storage"
+	"tspages/internal/webhook"
+)
+
+// undocumentedRoutes are served by the control plane but belong to the
+// admin UI itself rather than its API, so openapi.yaml leaves them out.
+var undocumentedRoutes = []string{
+	"GET /help",
+	"GET /help/{page}",
+	"GET /assets/dist/{file}",
+	"GET /api",
+	"GET /openapi",
+	"GET /openapi.yaml",
+}
+
+// openAPISpec is the subset of openapi.yaml the tests compare with code.
+type openAPISpec struct {
+	Paths      map[string]map[string]any `yaml:"paths"`
+	Components struct {
+		Schemas map[string]openAPISchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type openAPISchema struct {
+	Properties map[string]any `yaml:"properties"`
+	AllOf      []struct {
+		Ref        string         `yaml:"$ref"`
+		Properties map[string]any `yaml:"properties"`
+	} `yaml:"allOf"`
+}
+
+// properties returns the properties of the named schema, including those
+// it composes with allOf.
+func (s openAPISpec) properties(name string) map[string]any {
+	schema := s.Components.Schemas[name]
+	props := make(map[string]any)
+	for k, v := range schema.Properties {
+		props[k] = v
+	}
+	for _, part := range schema.AllOf {
+		if ref, ok := strings.CutPrefix(part.Ref, "#/components/schemas/"); ok {
+			for k, v := range s.properties(ref) {
+				props[k] = v
+			}
+		}
+		for k, v := range part.Properties {
+			props[k] = v
+		}
+	}
+	return props
+}
+
+func loadOpenAPISpec(t *testing.T) openAPISpec {
+	t.Helper()
+	data, err := os.ReadFile("../../internal/admin/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec openAPISpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("parsing openapi.yaml: %v", err)
+	}
+	return spec
+}
+
+type recordingMux struct{ patterns []string }
+
+func (m *recordingMux) Handle(pattern string, _ http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+}
+
+// registeredRoutes returns the "METHOD /path" of every route registerRoutes
+// registers. Routes served as both HTML and JSON are registered twice, the
+// second time with a .json suffix; the spec documents them once, without
+// it. Routes served as JSON only keep their suffix. The spec documents API routes only under admin.APIPrefix, so their
+// deprecated unversioned aliases are left out. Wildcards lose their "..."
+// so they match the spec's path templates.
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	mux := &recordingMux{}
+	passthrough := func(h http.Handler) http.Handler { return h }
+	registerRoutes(mux, passthrough, passthrough, &admin.Handlers{}, routeHandlers{})
+
+	seen := make(map[string]bool)
+	for _, p := range mux.patterns {
+		if html, ok := strings.CutSuffix(p, ".json"); ok && slices.Contains(mux.patterns, html) {
+			p = html
+		}
+		p = strings.ReplaceAll(p, "...}", "}")
+		p = strings.TrimSuffix(p, "{$}")
+		seen[p] = true
+	}
+	var routes []string
+	for p := range seen {
+		method, path, _ := strings.Cut(p, " ")
+		if seen[method+" "+admin.APIPrefix+path] {
+			continue
+		}
+		routes = append(routes, p)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func TestOpenAPI_DocumentsRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	documented := make(map[string]bool)
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range registeredRoutes(t) {
+		registered[route] = true
+		if slices.Contains(undocumentedRoutes, route) {
+			continue
+		}
+		if !documented[route] {
+			t.Errorf("%s is registered but missing from openapi.yaml", route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			t.Errorf("%s is in openapi.yaml but not registered", route)
+		}
+	}
+}
+
+// schemaTypes maps component schemas to the Go types encoded as them.
+var schemaTypes = map[string]any{
+	"DeployResponse":        deploy.DeployResponse{},
+	"ReadOnlyState":         admin.ReadOnlyState{},
+	"ReadOnlyRequest":       admin.ReadOnlyRequest{},
+	"EraseUserResponse":     admin.EraseUserResponse{},
+	"DeployDiff":            deploy.DeployDiff{},
+	"DeployTiming":          deploy.DeployTiming{},
+	"FetchRequest":          deploy.FetchRequest{},
+	"BundleResponse":        deploy.BundleResponse{},
+	"BundleResult":          deploy.BundleResult{},
+	"CanaryRequest":         deploy.CanaryRequest{},
+	"PinRequest":            deploy.PinRequest{},
+	"CompareResponse":       deploy.CompareResponse{},
+	"PinState":              storage.PinState{},
+	"TrashEntry":            storage.TrashEntry{},
+	"TrashResponse":         admin.TrashResponse{},
+	"GCItem":                storage.GCItem{},
+	"GCReport":              storage.GCReport{},
+	"IntegrityIssue":        storage.IntegrityIssue{},
+	"IntegrityReport":       storage.IntegrityReport{},
+	"VerificationCheck":     storage.VerificationCheck{},
+	"SiteVerification":      storage.SiteVerification{},
+	"VerificationReport":    storage.VerificationReport{},
+	"ReplicationSnapshot":   replica.Snapshot{},
+	"WhoAmIResponse":        admin.WhoAmIResponse{},
+	"Preferences":           storage.Preferences{},
+	"DeploymentInfo":        storage.DeploymentInfo{},
+	"ConfigSnapshot":        storage.ConfigSnapshot{},
+	"ChainProblem":          storage.ChainProblem{},
+	"ChainReport":           storage.ChainReport{},
+	"BuildInfo":             storage.BuildInfo{},
+	"CommitRange":           storage.CommitRange{},
+	"DeployLogEntry":        storage.DeployLogEntry{},
+	"SiteStatus":            admin.SiteStatus{},
+	"ArchiveState":          storage.ArchiveState{},
+	"Share":                 admin.ShareResponse{},
+	"DeploymentFilter":      storage.DeploymentFilter{},
+	"SavedFilter":           admin.SavedFilterResponse{},
+	"UserInfo":              admin.UserInfo{},
+	"SitesResponse":         admin.SitesResponse{},
+	"SiteDetailResponse":    admin.SiteDetailResponse{},
+	"DeploymentEntry":       admin.DeploymentEntry{},
+	"DeploymentsResponse":   admin.DeploymentsResponse{},
+	"TimeBucket":            analytics.TimeBucket{},
+	"StatusTimeBucket":      analytics.StatusTimeBucket{},
+	"PathCount":             analytics.PathCount{},
+	"VisitorCount":          analytics.VisitorCount{},
+	"StatusCount":           analytics.StatusCount{},
+	"OSCount":               analytics.OSCount{},
+	"NodeCount":             analytics.NodeCount{},
+	"DeploymentCount":       analytics.DeploymentCount{},
+	"TagCount":              analytics.TagCount{},
+	"SiteCount":             analytics.SiteCount{},
+	"DeliverySummary":       webhook.DeliverySummary{},
+	"DeliveryAttempt":       webhook.DeliveryAttempt{},
+	"DeliveryRecord":        webhook.DeliveryRecord{},
+	"DeliveryTimeBucket":    webhook.DeliveryTimeBucket{},
+	"EventCount":            webhook.EventCount{},
+	"LatencyTimeBucket":     webhook.LatencyTimeBucket{},
+	"LatencyStats":          webhook.LatencyStats{},
+	"WebhookTableStats":     webhook.TableStats{},
+	"SearchResponse":        admin.SearchResponse{},
+	"SiteActivityResponse":  admin.SiteActivityResponse{},
+	"PurgeCacheResponse":    deploy.PurgeCacheResponse{},
+	"RestartServerResponse": admin.RestartServerResponse{},
+	"CanaryState":           storage.CanaryState{},
+	"AnalyticsMetric":       admin.AnalyticsMetric{},
+	"AnalyticsQueryRequest": admin.AnalyticsQueryRequest{},
+	"AnalyticsSeries":       admin.AnalyticsSeries{},
+	"HealthScore":           sitehealth.Score{},
+	"ActivityItem":          admin.ActivityItem{},
+	"UserActivityItem":      admin.UserActivityItem{},
+	"UserActivityResponse":  admin.UserActivityResponse{},
+	"Visit":                 analytics.Visit{},
+	"AnalyticsEvent":        analytics.Event{},
+	"SiteFilesResponse":     admin.SiteFilesResponse{},
+	"FileEntry":             admin.FileEntry{},
+	"ConfigTestRequest":     admin.ConfigTestRequest{},
+	"ConfigTestResponse":    admin.ConfigTestResponse{},
+	"PathTrace":             serve.PathTrace{},
+	"RedirectRule":          storage.RedirectRule{},
+	"FileInfo":              storage.FileInfo{},
+	"FileVariant":           storage.FileVariant{},
+	"CachePolicy":           storage.CachePolicy{},
+	"SearchResult":          admin.SearchResult{},
+	"Problem":               problem.Details{},
+	"UploadRejectedProblem": deploy.UploadRejectedResponse{},
+	"BundleFailedProblem":   deploy.BundleFailedResponse{},
+	"Violation":             storage.Violation{},
+	"ReadinessResponse":     multihost.Startup{},
+	"StartupFailure":        multihost.StartupFailure{},
+	"SiteResources":         multihost.Resources{},
+}
+
+// jsonFields returns the names encoding/json uses for t's fields,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFields(f.Type)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestOpenAPI_SchemasMatchTypes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	for name, v := range schemaTypes {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing from openapi.yaml", name)
+			continue
+		}
+		props := spec.properties(name)
+		typ := reflect.TypeOf(v)
+		fields := jsonFields(typ)
+		for _, f := range fields {
+			if _, ok := props[f]; !ok {
+				t.Errorf("schema %s lacks %s.%s field %q", name, typ.PkgPath(), typ.Name(), f)
+			}
+		}
+		var stale []string
+		for p := range props {
+			if !slices.Contains(fields, p) {
+				stale = append(stale, p)
+			}
+		}
+		sort.Strings(stale)
+		for _, p := range stale {
+			t.Errorf("schema %s has property %q that %s does not encode", name, p, typ.Name())
+		}
+	}
+}
@@ -3,18 +3,38 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"tspages/internal/auth"
+	"tspages/internal/digest"
+	"tspages/internal/fieldcrypt"
 	"tspages/internal/storage"
 )
 
 type Config struct {
-	Tailscale TailscaleConfig    `toml:"tailscale"`
-	Server    ServerConfig       `toml:"server"`
-	Defaults  storage.SiteConfig `toml:"defaults"`
+	Tailscale  TailscaleConfig    `toml:"tailscale"`
+	Server     ServerConfig       `toml:"server"`
+	Auth       AuthConfig         `toml:"auth"`
+	Analytics  AnalyticsConfig    `toml:"analytics"`
+	Digest     DigestConfig       `toml:"digest"`
+	StatusPage StatusPageConfig   `toml:"status_page"`
+	Domains    []DomainConfig     `toml:"domains"`
+	Defaults   storage.SiteConfig `toml:"defaults"`
+}
+
+// DomainConfig binds a site to a hostname outside MagicDNS, served with the
+// certificate in CertFile and KeyFile.
+type DomainConfig struct {
+	Site     string `toml:"site"`
+	Hostname string `toml:"hostname"`
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
 }
 
 type TailscaleConfig struct {
@@ -25,13 +45,196 @@ type TailscaleConfig struct {
 }
 
 type ServerConfig struct {
-	DataDir        string `toml:"data_dir"`
-	MaxUploadMB    int    `toml:"max_upload_mb"`
-	MaxSites       int    `toml:"max_sites"`
-	MaxDeployments int    `toml:"max_deployments"`
-	LogLevel       string `toml:"log_level"`
-	HealthAddr     string `toml:"health_addr"`
-	HideFooter     bool   `toml:"hide_footer"`
+	DataDir            string `toml:"data_dir"`
+	MaxUploadMB        int    `toml:"max_upload_mb"`
+	MaxSites           int    `toml:"max_sites"`
+	MaxDeployments     int    `toml:"max_deployments"`
+	StartupConcurrency int    `toml:"startup_concurrency"`
+	LogLevel           string `toml:"log_level"`
+	HealthAddr         string `toml:"health_addr"`
+	HideFooter         bool   `toml:"hide_footer"`
+	TrashRetentionDays int    `toml:"trash_retention_days"`
+
+	// Timezone is the IANA timezone analytics charts are bucketed in and
+	// timestamps are shown in, for users who have not chosen their own.
+	Timezone string `toml:"timezone"`
+
+	// WebhookRetentionDays is how long webhook deliveries are kept in the
+	// delivery log. 0 keeps them forever.
+	WebhookRetentionDays int `toml:"webhook_retention_days"`
+
+	// TamperCheckMinutes is how often the files of each site's active
+	// deployment are compared with what was deployed; 0 disables it.
+	// TamperCheckFiles is how many files per site are also checked against
+	// their hashes each time.
+	TamperCheckMinutes int `toml:"tamper_check_minutes"`
+	TamperCheckFiles   int `toml:"tamper_check_files"`
+
+	// AnalyticsBufferSize is the number of analytics events queued for
+	// writing. AnalyticsBlockMS is how long a request waits for room in a
+	// full queue before its event is dropped; 0 drops immediately.
+	AnalyticsBufferSize int `toml:"analytics_buffer_size"`
+	AnalyticsBlockMS    int `toml:"analytics_block_ms"`
+
+	// EncryptionKey, a base64 encoded 32-byte key, encrypts the identities
+	// of visitors in the analytics database and the payloads in the webhook
+	// delivery log. Empty stores them in plain text.
+	EncryptionKey string `toml:"encryption_key"`
+
+	// PrecompressLevel enables writing .br and .gz variants of compressible
+	// files at deploy time, at this compression level (1-11). 0 disables it.
+	PrecompressLevel int `toml:"precompress_level"`
+
+	// GzipLevel (1-9) and BrotliLevel (0-11) are the levels responses are
+	// compressed at on the fly. CompressMaxMB is the size of the largest file
+	// compressed on the fly; 0 has no limit. CompressWorkers is how many
+	// responses are compressed at the same time; 0 uses half the CPUs.
+	GzipLevel       int `toml:"gzip_level"`
+	BrotliLevel     int `toml:"brotli_level"`
+	CompressMaxMB   int `toml:"compress_max_mb"`
+	CompressWorkers int `toml:"compress_workers"`
+
+	// SiteReadHeaderTimeout is how many seconds a client may take to send
+	// the headers of a request to a site, and SiteIdleTimeout how long a
+	// keep-alive connection to a site may wait for its next request.
+	// SiteMaxHeaderKB caps the size of request headers.
+	// SiteMaxConnectionsPerNode caps the connections a site keeps open to a
+	// single node; 0 has no cap.
+	SiteReadHeaderTimeout     int `toml:"site_read_header_timeout"`
+	SiteIdleTimeout           int `toml:"site_idle_timeout"`
+	SiteMaxHeaderKB           int `toml:"site_max_header_kb"`
+	SiteMaxConnectionsPerNode int `toml:"site_max_connections_per_node"`
+
+	// Symlinks is the policy for symlinks in uploads: "deny" rejects them,
+	// "intra" allows those resolving inside the deployment's content.
+	Symlinks string `toml:"symlinks"`
+
+	// FetchAllowedHosts lists the hosts POST /deploy/{site}/fetch may
+	// download artifacts from. "*.example.com" allows every subdomain of
+	// example.com. Empty disables fetching.
+	FetchAllowedHosts []string `toml:"fetch_allowed_hosts"`
+
+	// ReadOnly starts the control plane in read-only mode, which rejects
+	// every change with 503 and ReadOnlyMessage until an admin disables it.
+	ReadOnly        bool   `toml:"read_only"`
+	ReadOnlyMessage string `toml:"read_only_message"`
+
+	// ReplicaOf makes this instance a read-only replica of the named
+	// primary: a control plane hostname or https:// URL.
+	ReplicaOf             string `toml:"replica_of"`
+	ReplicaSyncInterval   int    `toml:"replica_sync_interval"`
+	ReplicaHostnameSuffix string `toml:"replica_hostname_suffix"`
+	// ReplicaForwardAnalytics makes a replica forward the analytics events
+	// it records to its primary, so the primary's dashboards show the
+	// traffic of both.
+	ReplicaForwardAnalytics bool `toml:"replica_forward_analytics"`
+}
+
+// Analytics database drivers.
+const (
+	AnalyticsDriverSQLite   = "sqlite"
+	AnalyticsDriverPostgres = "postgres"
+)
+
+// Visitor identities for unique visitor counts.
+const (
+	AnalyticsVisitorsLogin     = "login"
+	AnalyticsVisitorsNode      = "node"
+	AnalyticsVisitorsLoginNode = "login+node"
+)
+
+// AnalyticsConfig selects where request analytics are stored. The default
+// is a SQLite file in the data directory; large tailnets can point DSN at a
+// PostgreSQL database instead. Visitors selects what tells visitors apart
+// in unique visitor counts: their login, their node, or both.
+type AnalyticsConfig struct {
+	Driver   string `toml:"driver"`
+	DSN      string `toml:"dsn"`
+	Visitors string `toml:"visitors"`
+}
+
+// DigestConfig schedules a periodic activity digest. Schedule is a
+// five-field cron expression in the server's local time zone; an empty
+// schedule disables digests. At least one destination is required.
+type DigestConfig struct {
+	Schedule        string   `toml:"schedule"`
+	Sites           []string `toml:"sites"`
+	SlackWebhookURL string   `toml:"slack_webhook_url"`
+
+	// VerifySchedule schedules a verification of every site, whose report
+	// is sent to the same destinations; empty disables it.
+	// VerifySampleFiles is how many files of each site are checked against
+	// their hashes. It defaults to 20.
+	VerifySchedule    string `toml:"verify_schedule"`
+	VerifySampleFiles int    `toml:"verify_sample_files"`
+
+	// Email destination. SMTPPort defaults to 587.
+	EmailTo      []string `toml:"email_to"`
+	EmailFrom    string   `toml:"email_from"`
+	SMTPHost     string   `toml:"smtp_host"`
+	SMTPPort     int      `toml:"smtp_port"`
+	SMTPUsername string   `toml:"smtp_username"`
+	SMTPPassword string   `toml:"smtp_password"`
+}
+
+// StatusPageConfig enables a status page that tspages renders from its own
+// checks of the site servers, served on its own tailnet Hostname. Sites
+// limits the page to sites matching these patterns; empty includes every
+// site. CheckInterval is the number of seconds between checks.
+type StatusPageConfig struct {
+	Enabled       bool     `toml:"enabled"`
+	Hostname      string   `toml:"hostname"`
+	Title         string   `toml:"title"`
+	Sites         []string `toml:"sites"`
+	CheckInterval int      `toml:"check_interval"`
+}
+
+// Auth modes for the control plane.
+const (
+	AuthModeTailscale = "tailscale"
+	AuthModeHeader    = "header"
+)
+
+// AuthConfig selects how the control plane identifies callers. In header
+// mode, tspages trusts identity headers from a reverse proxy and serves the
+// control plane over plain HTTP on Listen instead of through tsnet.
+type AuthConfig struct {
+	Mode           string   `toml:"mode"`
+	Listen         string   `toml:"listen"`
+	DNSSuffix      string   `toml:"dns_suffix"`
+	UserHeader     string   `toml:"user_header"`
+	NameHeader     string   `toml:"name_header"`
+	GroupsHeader   string   `toml:"groups_header"`
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	// Groups maps proxy-reported groups to the caps their members receive.
+	// The "*" group applies to every authenticated user.
+	Groups map[string][]auth.Cap `toml:"groups"`
+}
+
+// HeaderConfig converts the header mode settings for auth.HeaderAuthenticator.
+// Trusted proxies may be given as CIDR prefixes or single addresses.
+func (c AuthConfig) HeaderConfig() (auth.HeaderConfig, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, s := range c.TrustedProxies {
+		s = strings.TrimSpace(s)
+		if p, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return auth.HeaderConfig{}, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return auth.HeaderConfig{
+		UserHeader:     c.UserHeader,
+		NameHeader:     c.NameHeader,
+		GroupsHeader:   c.GroupsHeader,
+		TrustedProxies: prefixes,
+		Groups:         c.Groups,
+	}, nil
 }
 
 func Load(path string) (*Config, error) {
@@ -58,6 +261,34 @@ func Load(path string) (*Config, error) {
 	strDefault(&cfg.Server.DataDir, "TSPAGES_DATA_DIR", "./data")
 	strDefault(&cfg.Server.LogLevel, "TSPAGES_LOG_LEVEL", "warn")
 	strDefault(&cfg.Server.HealthAddr, "TSPAGES_HEALTH_ADDR", "")
+	strDefault(&cfg.Server.Timezone, "TSPAGES_TIMEZONE", "UTC")
+	strDefault(&cfg.Server.Symlinks, "TSPAGES_SYMLINKS", storage.SymlinksDeny)
+	strDefault(&cfg.Server.ReadOnlyMessage, "TSPAGES_READ_ONLY_MESSAGE", "")
+	strDefault(&cfg.Server.EncryptionKey, "TSPAGES_ENCRYPTION_KEY", "")
+	strDefault(&cfg.Server.ReplicaOf, "TSPAGES_REPLICA_OF", "")
+	strDefault(&cfg.Server.ReplicaHostnameSuffix, "TSPAGES_REPLICA_HOSTNAME_SUFFIX", "-replica")
+	strDefault(&cfg.Analytics.Driver, "TSPAGES_ANALYTICS_DRIVER", AnalyticsDriverSQLite)
+	strDefault(&cfg.Analytics.DSN, "TSPAGES_ANALYTICS_DSN", "")
+	strDefault(&cfg.Analytics.Visitors, "TSPAGES_ANALYTICS_VISITORS", AnalyticsVisitorsLogin)
+	strDefault(&cfg.Digest.SMTPPassword, "TSPAGES_DIGEST_SMTP_PASSWORD", "")
+	strDefault(&cfg.StatusPage.Hostname, "TSPAGES_STATUS_PAGE_HOSTNAME", "status")
+	strDefault(&cfg.StatusPage.Title, "TSPAGES_STATUS_PAGE_TITLE", "Status")
+	strDefault(&cfg.Auth.Mode, "TSPAGES_AUTH_MODE", AuthModeTailscale)
+	strDefault(&cfg.Auth.Listen, "TSPAGES_AUTH_LISTEN", "127.0.0.1:8080")
+	strDefault(&cfg.Auth.DNSSuffix, "TSPAGES_AUTH_DNS_SUFFIX", "")
+	strDefault(&cfg.Auth.UserHeader, "TSPAGES_AUTH_USER_HEADER", "X-Forwarded-User")
+	strDefault(&cfg.Auth.NameHeader, "TSPAGES_AUTH_NAME_HEADER", "X-Forwarded-Preferred-Username")
+	strDefault(&cfg.Auth.GroupsHeader, "TSPAGES_AUTH_GROUPS_HEADER", "X-Forwarded-Groups")
+	if !md.IsDefined("auth", "trusted_proxies") {
+		proxies := os.Getenv("TSPAGES_AUTH_TRUSTED_PROXIES")
+		if proxies == "" {
+			proxies = "127.0.0.1/32,::1/128"
+		}
+		cfg.Auth.TrustedProxies = strings.Split(proxies, ",")
+	}
+	if hosts := os.Getenv("TSPAGES_FETCH_ALLOWED_HOSTS"); hosts != "" && !md.IsDefined("server", "fetch_allowed_hosts") {
+		cfg.Server.FetchAllowedHosts = strings.Split(hosts, ",")
+	}
 
 	if err := intDefault(md, &cfg.Server.MaxUploadMB, "TSPAGES_MAX_UPLOAD_MB", 500, "server", "max_upload_mb"); err != nil {
 		return nil, err
@@ -68,8 +299,79 @@ func Load(path string) (*Config, error) {
 	if err := intDefault(md, &cfg.Server.MaxDeployments, "TSPAGES_MAX_DEPLOYMENTS", 10, "server", "max_deployments"); err != nil {
 		return nil, err
 	}
+	if err := intDefault(md, &cfg.Server.StartupConcurrency, "TSPAGES_STARTUP_CONCURRENCY", 8, "server", "startup_concurrency"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.TrashRetentionDays, "TSPAGES_TRASH_RETENTION_DAYS", 7, "server", "trash_retention_days"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.WebhookRetentionDays, "TSPAGES_WEBHOOK_RETENTION_DAYS", 90, "server", "webhook_retention_days"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.TamperCheckMinutes, "TSPAGES_TAMPER_CHECK_MINUTES", 0, "server", "tamper_check_minutes"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.TamperCheckFiles, "TSPAGES_TAMPER_CHECK_FILES", 20, "server", "tamper_check_files"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.AnalyticsBufferSize, "TSPAGES_ANALYTICS_BUFFER_SIZE", 1024, "server", "analytics_buffer_size"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.AnalyticsBlockMS, "TSPAGES_ANALYTICS_BLOCK_MS", 0, "server", "analytics_block_ms"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.PrecompressLevel, "TSPAGES_PRECOMPRESS_LEVEL", 0, "server", "precompress_level"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.GzipLevel, "TSPAGES_GZIP_LEVEL", 6, "server", "gzip_level"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.BrotliLevel, "TSPAGES_BROTLI_LEVEL", 4, "server", "brotli_level"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.CompressMaxMB, "TSPAGES_COMPRESS_MAX_MB", 0, "server", "compress_max_mb"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.CompressWorkers, "TSPAGES_COMPRESS_WORKERS", 0, "server", "compress_workers"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.SiteReadHeaderTimeout, "TSPAGES_SITE_READ_HEADER_TIMEOUT", 10, "server", "site_read_header_timeout"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.SiteIdleTimeout, "TSPAGES_SITE_IDLE_TIMEOUT", 120, "server", "site_idle_timeout"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.SiteMaxHeaderKB, "TSPAGES_SITE_MAX_HEADER_KB", 64, "server", "site_max_header_kb"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Server.SiteMaxConnectionsPerNode, "TSPAGES_SITE_MAX_CONNECTIONS_PER_NODE", 0, "server", "site_max_connections_per_node"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Server.ReplicaSyncInterval, "TSPAGES_REPLICA_SYNC_INTERVAL", 60, "server", "replica_sync_interval"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.Digest.SMTPPort, "TSPAGES_DIGEST_SMTP_PORT", 587, "digest", "smtp_port"); err != nil {
+		return nil, err
+	}
+	if err := intDefault(md, &cfg.Digest.VerifySampleFiles, "TSPAGES_DIGEST_VERIFY_SAMPLE_FILES", 20, "digest", "verify_sample_files"); err != nil {
+		return nil, err
+	}
+
+	if err := intDefault(md, &cfg.StatusPage.CheckInterval, "TSPAGES_STATUS_PAGE_CHECK_INTERVAL", 60, "status_page", "check_interval"); err != nil {
+		return nil, err
+	}
 
+	boolDefault(md, &cfg.StatusPage.Enabled, "TSPAGES_STATUS_PAGE_ENABLED", false, "status_page", "enabled")
 	boolDefault(md, &cfg.Server.HideFooter, "TSPAGES_HIDE_FOOTER", false, "server", "hide_footer")
+	boolDefault(md, &cfg.Server.ReadOnly, "TSPAGES_READ_ONLY", false, "server", "read_only")
+	boolDefault(md, &cfg.Server.ReplicaForwardAnalytics, "TSPAGES_REPLICA_FORWARD_ANALYTICS", false, "server", "replica_forward_analytics")
 
 	if cfg.Server.MaxUploadMB < 0 {
 		return nil, fmt.Errorf("max_upload_mb must be non-negative, got %d", cfg.Server.MaxUploadMB)
@@ -80,10 +382,207 @@ func Load(path string) (*Config, error) {
 	if cfg.Server.MaxDeployments < 0 {
 		return nil, fmt.Errorf("max_deployments must be non-negative, got %d", cfg.Server.MaxDeployments)
 	}
+	if cfg.Server.StartupConcurrency < 1 {
+		return nil, fmt.Errorf("startup_concurrency must be at least 1, got %d", cfg.Server.StartupConcurrency)
+	}
+	if cfg.Server.TrashRetentionDays < 0 {
+		return nil, fmt.Errorf("trash_retention_days must be non-negative, got %d", cfg.Server.TrashRetentionDays)
+	}
+	if cfg.Server.WebhookRetentionDays < 0 {
+		return nil, fmt.Errorf("webhook_retention_days must be non-negative, got %d", cfg.Server.WebhookRetentionDays)
+	}
+	if cfg.Server.TamperCheckMinutes < 0 {
+		return nil, fmt.Errorf("tamper_check_minutes must be non-negative, got %d", cfg.Server.TamperCheckMinutes)
+	}
+	if cfg.Server.TamperCheckFiles < 0 {
+		return nil, fmt.Errorf("tamper_check_files must be non-negative, got %d", cfg.Server.TamperCheckFiles)
+	}
+
+	if cfg.Server.AnalyticsBufferSize < 1 {
+		return nil, fmt.Errorf("analytics_buffer_size must be at least 1, got %d", cfg.Server.AnalyticsBufferSize)
+	}
+	if cfg.Server.AnalyticsBlockMS < 0 {
+		return nil, fmt.Errorf("analytics_block_ms must be non-negative, got %d", cfg.Server.AnalyticsBlockMS)
+	}
+	if cfg.Server.EncryptionKey != "" {
+		if _, err := fieldcrypt.ParseKey(cfg.Server.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Server.PrecompressLevel < 0 || cfg.Server.PrecompressLevel > 11 {
+		return nil, fmt.Errorf("precompress_level must be between 0 and 11, got %d", cfg.Server.PrecompressLevel)
+	}
+	if cfg.Server.GzipLevel < 1 || cfg.Server.GzipLevel > 9 {
+		return nil, fmt.Errorf("gzip_level must be between 1 and 9, got %d", cfg.Server.GzipLevel)
+	}
+	if cfg.Server.BrotliLevel < 0 || cfg.Server.BrotliLevel > 11 {
+		return nil, fmt.Errorf("brotli_level must be between 0 and 11, got %d", cfg.Server.BrotliLevel)
+	}
+	if cfg.Server.CompressMaxMB < 0 {
+		return nil, fmt.Errorf("compress_max_mb must be non-negative, got %d", cfg.Server.CompressMaxMB)
+	}
+	if cfg.Server.CompressWorkers < 0 {
+		return nil, fmt.Errorf("compress_workers must be non-negative, got %d", cfg.Server.CompressWorkers)
+	}
+	if cfg.Server.SiteReadHeaderTimeout < 1 {
+		return nil, fmt.Errorf("site_read_header_timeout must be at least 1, got %d", cfg.Server.SiteReadHeaderTimeout)
+	}
+	if cfg.Server.SiteIdleTimeout < 1 {
+		return nil, fmt.Errorf("site_idle_timeout must be at least 1, got %d", cfg.Server.SiteIdleTimeout)
+	}
+	if cfg.Server.SiteMaxHeaderKB < 1 {
+		return nil, fmt.Errorf("site_max_header_kb must be at least 1, got %d", cfg.Server.SiteMaxHeaderKB)
+	}
+	if cfg.Server.SiteMaxConnectionsPerNode < 0 {
+		return nil, fmt.Errorf("site_max_connections_per_node must be non-negative, got %d", cfg.Server.SiteMaxConnectionsPerNode)
+	}
+
+	if _, err := time.LoadLocation(cfg.Server.Timezone); err != nil {
+		return nil, fmt.Errorf("timezone %q is not an IANA timezone name", cfg.Server.Timezone)
+	}
+
+	if cfg.Server.Symlinks != storage.SymlinksDeny && cfg.Server.Symlinks != storage.SymlinksIntra {
+		return nil, fmt.Errorf("symlinks must be %q or %q, got %q", storage.SymlinksDeny, storage.SymlinksIntra, cfg.Server.Symlinks)
+	}
+
+	for i, host := range cfg.Server.FetchAllowedHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || strings.ContainsAny(strings.TrimPrefix(host, "*."), "*:/ ") {
+			return nil, fmt.Errorf("fetch_allowed_hosts[%d]: invalid host %q", i, cfg.Server.FetchAllowedHosts[i])
+		}
+		cfg.Server.FetchAllowedHosts[i] = host
+	}
+
+	if cfg.Server.ReplicaSyncInterval < 1 {
+		return nil, fmt.Errorf("replica_sync_interval must be at least 1 second, got %d", cfg.Server.ReplicaSyncInterval)
+	}
+	if cfg.Server.ReplicaForwardAnalytics && cfg.Server.ReplicaOf == "" {
+		return nil, fmt.Errorf("replica_forward_analytics requires replica_of")
+	}
+
+	hostnames := make(map[string]bool, len(cfg.Domains))
+	for i, d := range cfg.Domains {
+		if !storage.ValidSiteName(d.Site) {
+			return nil, fmt.Errorf("domains[%d]: invalid site name %q", i, d.Site)
+		}
+		host := strings.ToLower(d.Hostname)
+		if host == "" || strings.ContainsAny(host, ":/ ") {
+			return nil, fmt.Errorf("domains[%d]: invalid hostname %q", i, d.Hostname)
+		}
+		if hostnames[host] {
+			return nil, fmt.Errorf("domains[%d]: hostname %q is configured twice", i, d.Hostname)
+		}
+		hostnames[host] = true
+		if d.CertFile == "" || d.KeyFile == "" {
+			return nil, fmt.Errorf("domains[%d]: cert_file and key_file are required", i)
+		}
+	}
+
+	switch cfg.Analytics.Driver {
+	case AnalyticsDriverSQLite:
+	case AnalyticsDriverPostgres:
+		if cfg.Analytics.DSN == "" {
+			return nil, fmt.Errorf("analytics driver %q requires a dsn", AnalyticsDriverPostgres)
+		}
+	default:
+		return nil, fmt.Errorf("analytics driver must be %q or %q, got %q", AnalyticsDriverSQLite, AnalyticsDriverPostgres, cfg.Analytics.Driver)
+	}
+	switch cfg.Analytics.Visitors {
+	case AnalyticsVisitorsLogin, AnalyticsVisitorsNode, AnalyticsVisitorsLoginNode:
+	default:
+		return nil, fmt.Errorf("analytics visitors must be %q, %q, or %q, got %q",
+			AnalyticsVisitorsLogin, AnalyticsVisitorsNode, AnalyticsVisitorsLoginNode, cfg.Analytics.Visitors)
+	}
+
+	if err := cfg.Defaults.Validate(); err != nil {
+		return nil, fmt.Errorf("defaults: %w", err)
+	}
+
+	if err := cfg.Digest.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.StatusPage.validate(cfg.Tailscale.Hostname); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Auth.Mode {
+	case AuthModeTailscale:
+	case AuthModeHeader:
+		if _, err := cfg.Auth.HeaderConfig(); err != nil {
+			return nil, err
+		}
+		if cfg.Server.ReplicaOf != "" {
+			return nil, fmt.Errorf("replica_of requires auth mode %q", AuthModeTailscale)
+		}
+	default:
+		return nil, fmt.Errorf("auth mode must be %q or %q, got %q", AuthModeTailscale, AuthModeHeader, cfg.Auth.Mode)
+	}
 
 	return &cfg, nil
 }
 
+// validate checks a configured digest's or verification's schedule and
+// destinations.
+func (c DigestConfig) validate() error {
+	if c.Schedule == "" && c.VerifySchedule == "" {
+		return nil
+	}
+	if c.Schedule != "" {
+		if _, err := digest.ParseSchedule(c.Schedule); err != nil {
+			return fmt.Errorf("digest: %w", err)
+		}
+	}
+	if c.VerifySchedule != "" {
+		if _, err := digest.ParseSchedule(c.VerifySchedule); err != nil {
+			return fmt.Errorf("digest: verify_schedule: %w", err)
+		}
+	}
+	if c.VerifySampleFiles < 1 {
+		return fmt.Errorf("digest: verify_sample_files must be at least 1, got %d", c.VerifySampleFiles)
+	}
+	for _, site := range c.Sites {
+		if !storage.ValidSiteName(site) {
+			return fmt.Errorf("digest: invalid site name %q", site)
+		}
+	}
+	if c.SlackWebhookURL == "" && len(c.EmailTo) == 0 {
+		return fmt.Errorf("digest: schedule requires slack_webhook_url or email_to")
+	}
+	if c.SlackWebhookURL != "" && !strings.HasPrefix(c.SlackWebhookURL, "https://") {
+		return fmt.Errorf("digest: slack_webhook_url must be an https:// URL")
+	}
+	if len(c.EmailTo) > 0 && (c.EmailFrom == "" || c.SMTPHost == "") {
+		return fmt.Errorf("digest: email_to requires email_from and smtp_host")
+	}
+	if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+		return fmt.Errorf("digest: smtp_port must be between 1 and 65535, got %d", c.SMTPPort)
+	}
+	return nil
+}
+
+// validate checks the status page's hostname, site patterns, and check
+// interval. The hostname must differ from the control plane's.
+func (c StatusPageConfig) validate(controlPlane string) error {
+	if !c.Enabled {
+		return nil
+	}
+	if !storage.ValidSiteName(c.Hostname) {
+		return fmt.Errorf("status_page: invalid hostname %q", c.Hostname)
+	}
+	if c.Hostname == controlPlane {
+		return fmt.Errorf("status_page: hostname %q is the control plane's", c.Hostname)
+	}
+	for _, pattern := range c.Sites {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("status_page: invalid site pattern %q", pattern)
+		}
+	}
+	if c.CheckInterval < 10 {
+		return fmt.Errorf("status_page: check_interval must be at least 10 seconds, got %d", c.CheckInterval)
+	}
+	return nil
+}
+
 // strDefault fills *dst from envKey if *dst is empty (not set in TOML),
 // then falls back to def.
 func strDefault(dst *string, envKey, def string) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -91,6 +92,57 @@ capability = "example.com/cap/pages"
 	if cfg.Server.MaxDeployments != 10 {
 		t.Errorf("max_deployments = %d, want %d", cfg.Server.MaxDeployments, 10)
 	}
+	if cfg.Server.StartupConcurrency != 8 {
+		t.Errorf("startup_concurrency = %d, want %d", cfg.Server.StartupConcurrency, 8)
+	}
+	if cfg.Server.TrashRetentionDays != 7 {
+		t.Errorf("trash_retention_days = %d, want %d", cfg.Server.TrashRetentionDays, 7)
+	}
+	if cfg.Server.WebhookRetentionDays != 90 {
+		t.Errorf("webhook_retention_days = %d, want %d", cfg.Server.WebhookRetentionDays, 90)
+	}
+	if cfg.Server.TamperCheckMinutes != 0 || cfg.Server.TamperCheckFiles != 20 {
+		t.Errorf("tamper_check_minutes/files = %d/%d, want 0/20", cfg.Server.TamperCheckMinutes, cfg.Server.TamperCheckFiles)
+	}
+	if cfg.Server.PrecompressLevel != 0 {
+		t.Errorf("precompress_level = %d, want 0", cfg.Server.PrecompressLevel)
+	}
+	if cfg.Server.GzipLevel != 6 || cfg.Server.BrotliLevel != 4 {
+		t.Errorf("gzip/brotli level = %d/%d, want 6/4", cfg.Server.GzipLevel, cfg.Server.BrotliLevel)
+	}
+	if cfg.Server.CompressMaxMB != 0 || cfg.Server.CompressWorkers != 0 {
+		t.Errorf("compress max/workers = %d/%d, want 0/0", cfg.Server.CompressMaxMB, cfg.Server.CompressWorkers)
+	}
+	if cfg.Server.SiteReadHeaderTimeout != 10 || cfg.Server.SiteIdleTimeout != 120 || cfg.Server.SiteMaxHeaderKB != 64 || cfg.Server.SiteMaxConnectionsPerNode != 0 {
+		t.Errorf("site limits = %d/%d/%d/%d, want 10/120/64/0", cfg.Server.SiteReadHeaderTimeout, cfg.Server.SiteIdleTimeout, cfg.Server.SiteMaxHeaderKB, cfg.Server.SiteMaxConnectionsPerNode)
+	}
+	if cfg.Server.AnalyticsBufferSize != 1024 || cfg.Server.AnalyticsBlockMS != 0 {
+		t.Errorf("analytics buffer/block = %d/%d, want 1024/0", cfg.Server.AnalyticsBufferSize, cfg.Server.AnalyticsBlockMS)
+	}
+	if cfg.Analytics.Driver != AnalyticsDriverSQLite || cfg.Analytics.DSN != "" {
+		t.Errorf("analytics driver/dsn = %q/%q, want %q/empty", cfg.Analytics.Driver, cfg.Analytics.DSN, AnalyticsDriverSQLite)
+	}
+	if cfg.Analytics.Visitors != AnalyticsVisitorsLogin {
+		t.Errorf("analytics visitors = %q, want %q", cfg.Analytics.Visitors, AnalyticsVisitorsLogin)
+	}
+	if cfg.Server.ReplicaOf != "" {
+		t.Errorf("replica_of = %q, want empty", cfg.Server.ReplicaOf)
+	}
+	if cfg.Server.ReplicaSyncInterval != 60 {
+		t.Errorf("replica_sync_interval = %d, want %d", cfg.Server.ReplicaSyncInterval, 60)
+	}
+	if cfg.Server.ReplicaHostnameSuffix != "-replica" {
+		t.Errorf("replica_hostname_suffix = %q, want %q", cfg.Server.ReplicaHostnameSuffix, "-replica")
+	}
+	if cfg.Server.ReplicaForwardAnalytics {
+		t.Error("replica_forward_analytics should default to false")
+	}
+	if cfg.Server.Timezone != "UTC" {
+		t.Errorf("timezone = %q, want %q", cfg.Server.Timezone, "UTC")
+	}
+	if cfg.Server.Symlinks != "deny" {
+		t.Errorf("symlinks = %q, want %q", cfg.Server.Symlinks, "deny")
+	}
 }
 
 func TestLoad_CapabilityDefault(t *testing.T) {
@@ -266,6 +318,127 @@ max_upload_mb = -1
 	}
 }
 
+func TestLoad_TamperCheckNegative(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+tamper_check_minutes = -5
+`), 0644)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for negative tamper_check_minutes")
+	}
+}
+
+func TestLoad_AnalyticsBufferSizeZero(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+analytics_buffer_size = 0
+`), 0644)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for zero analytics_buffer_size")
+	}
+}
+
+func TestLoad_StartupConcurrencyZero(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+startup_concurrency = 0
+`), 0644)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for zero startup_concurrency")
+	}
+}
+
+func TestLoad_PrecompressLevelOutOfRange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+precompress_level = 12
+`), 0644)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for precompress_level above 11")
+	}
+}
+
+func TestLoad_CompressionOutOfRange(t *testing.T) {
+	for _, line := range []string{"gzip_level = 0", "gzip_level = 10", "brotli_level = 12", "compress_max_mb = -1", "compress_workers = -1"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "tspages.toml")
+		os.WriteFile(path, []byte("[server]\n"+line+"\n"), 0644)
+
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected error for %s", line)
+		}
+	}
+}
+
+func TestLoad_SiteLimitsOutOfRange(t *testing.T) {
+	for _, line := range []string{"site_read_header_timeout = 0", "site_idle_timeout = 0", "site_max_header_kb = 0", "site_max_connections_per_node = -1"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "tspages.toml")
+		os.WriteFile(path, []byte("[server]\n"+line+"\n"), 0644)
+
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected error for %s", line)
+		}
+	}
+}
+
+func TestLoad_ReplicaSyncIntervalTooSmall(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+replica_of = "pages"
+replica_sync_interval = 0
+`), 0644)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for zero replica_sync_interval")
+	}
+}
+
+func TestLoad_ReplicaForwardAnalyticsRequiresReplicaOf(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+replica_forward_analytics = true
+`), 0644)
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for replica_forward_analytics without replica_of")
+	}
+
+	os.WriteFile(path, []byte(`
+[server]
+replica_of = "pages"
+replica_forward_analytics = true
+`), 0644)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Server.ReplicaForwardAnalytics {
+		t.Error("replica_forward_analytics not set")
+	}
+}
+
 func TestLoad_HealthAddrFromEnv(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "tspages.toml")
@@ -353,6 +526,23 @@ capability = "example.com/cap/pages"
 	}
 }
 
+func TestLoad_ReadOnlyFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	if err := os.WriteFile(path, []byte("[server]\nread_only_message = \"Migrating storage\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TSPAGES_READ_ONLY", "true")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Server.ReadOnly || cfg.Server.ReadOnlyMessage != "Migrating storage" {
+		t.Errorf("read_only = %v, message = %q", cfg.Server.ReadOnly, cfg.Server.ReadOnlyMessage)
+	}
+}
+
 func TestLoad_AuthKeyFromEnv(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "tspages.toml")
@@ -525,3 +715,352 @@ func TestLoad_InvalidIntEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad_AuthDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(""), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.Mode != AuthModeTailscale {
+		t.Errorf("mode = %q, want tailscale", cfg.Auth.Mode)
+	}
+	if cfg.Auth.UserHeader != "X-Forwarded-User" || cfg.Auth.GroupsHeader != "X-Forwarded-Groups" {
+		t.Errorf("headers = %q, %q", cfg.Auth.UserHeader, cfg.Auth.GroupsHeader)
+	}
+	if len(cfg.Auth.TrustedProxies) != 2 {
+		t.Errorf("trusted_proxies = %v, want loopback defaults", cfg.Auth.TrustedProxies)
+	}
+}
+
+func TestLoad_HeaderAuth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[auth]
+mode = "header"
+listen = ":9000"
+dns_suffix = "example.ts.net"
+trusted_proxies = ["10.0.0.0/8", "192.168.1.10"]
+
+[auth.groups]
+"*" = [{ access = "view" }]
+admins = [{ access = "admin" }]
+docs-team = [{ access = "deploy", sites = ["docs", "docs-*"] }]
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.Listen != ":9000" || cfg.Auth.DNSSuffix != "example.ts.net" {
+		t.Errorf("auth = %+v", cfg.Auth)
+	}
+	docs := cfg.Auth.Groups["docs-team"]
+	if len(docs) != 1 || docs[0].Access != "deploy" || len(docs[0].Sites) != 2 {
+		t.Errorf("docs-team = %+v", docs)
+	}
+
+	hc, err := cfg.Auth.HeaderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hc.TrustedProxies) != 2 || hc.TrustedProxies[1].String() != "192.168.1.10/32" {
+		t.Errorf("trusted proxies = %v", hc.TrustedProxies)
+	}
+}
+
+func TestLoad_HeaderAuthInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"mode":    "[auth]\nmode = \"oidc\"\n",
+		"proxies": "[auth]\nmode = \"header\"\ntrusted_proxies = [\"not-an-ip\"]\n",
+		"replica": "[server]\nreplica_of = \"pages\"\n\n[auth]\nmode = \"header\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tspages.toml")
+			os.WriteFile(path, []byte(body), 0644)
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad_TrustedProxiesFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte(""), 0644)
+	t.Setenv("TSPAGES_AUTH_TRUSTED_PROXIES", "10.0.0.1,10.0.0.2")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Auth.TrustedProxies) != 2 || cfg.Auth.TrustedProxies[1] != "10.0.0.2" {
+		t.Errorf("trusted_proxies = %v", cfg.Auth.TrustedProxies)
+	}
+}
+
+func TestLoad_Domains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte(`
+[[domains]]
+site = "docs"
+hostname = "docs.corp.example"
+cert_file = "/etc/tspages/docs.crt"
+key_file = "/etc/tspages/docs.key"
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Domains) != 1 || cfg.Domains[0].Hostname != "docs.corp.example" || cfg.Domains[0].KeyFile != "/etc/tspages/docs.key" {
+		t.Errorf("domains = %+v", cfg.Domains)
+	}
+}
+
+func TestLoad_DomainsInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"site":      "[[domains]]\nsite = \"Bad_Site\"\nhostname = \"a.example\"\ncert_file = \"c\"\nkey_file = \"k\"\n",
+		"hostname":  "[[domains]]\nsite = \"docs\"\nhostname = \"https://a.example\"\ncert_file = \"c\"\nkey_file = \"k\"\n",
+		"cert":      "[[domains]]\nsite = \"docs\"\nhostname = \"a.example\"\n",
+		"duplicate": "[[domains]]\nsite = \"docs\"\nhostname = \"a.example\"\ncert_file = \"c\"\nkey_file = \"k\"\n\n[[domains]]\nsite = \"wiki\"\nhostname = \"A.example\"\ncert_file = \"c\"\nkey_file = \"k\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tspages.toml")
+			os.WriteFile(path, []byte(body), 0644)
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad_AnalyticsPostgres(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte(`
+[analytics]
+driver = "postgres"
+`), 0644)
+	t.Setenv("TSPAGES_ANALYTICS_DSN", "postgres://tspages@db/analytics")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Analytics.Driver != AnalyticsDriverPostgres || cfg.Analytics.DSN != "postgres://tspages@db/analytics" {
+		t.Errorf("analytics = %+v", cfg.Analytics)
+	}
+}
+
+func TestLoad_AnalyticsVisitors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte("[analytics]\nvisitors = \"node\"\n"), 0644)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Analytics.Visitors != AnalyticsVisitorsNode {
+		t.Errorf("visitors = %q, want %q", cfg.Analytics.Visitors, AnalyticsVisitorsNode)
+	}
+
+	t.Setenv("TSPAGES_ANALYTICS_VISITORS", AnalyticsVisitorsLoginNode)
+	os.WriteFile(path, nil, 0644)
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Analytics.Visitors != AnalyticsVisitorsLoginNode {
+		t.Errorf("visitors = %q, want %q from the environment", cfg.Analytics.Visitors, AnalyticsVisitorsLoginNode)
+	}
+}
+
+func TestLoad_AnalyticsInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"driver":   "[analytics]\ndriver = \"mysql\"\n",
+		"no dsn":   "[analytics]\ndriver = \"postgres\"\n",
+		"visitors": "[analytics]\nvisitors = \"device\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tspages.toml")
+			os.WriteFile(path, []byte(body), 0644)
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad_Digest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte(`
+[digest]
+schedule = "0 9 * * 1"
+sites = ["docs"]
+email_to = ["team@example.com"]
+email_from = "tspages@example.com"
+smtp_host = "smtp.example.com"
+`), 0644)
+	t.Setenv("TSPAGES_DIGEST_SMTP_PASSWORD", "hunter2")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Digest.SMTPPort != 587 || cfg.Digest.SMTPPassword != "hunter2" || len(cfg.Digest.EmailTo) != 1 || cfg.Digest.VerifySampleFiles != 20 {
+		t.Errorf("digest = %+v", cfg.Digest)
+	}
+}
+
+func TestLoad_DigestInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"schedule":       "[digest]\nschedule = \"every monday\"\nslack_webhook_url = \"https://hooks.slack.com/x\"\n",
+		"no destination": "[digest]\nschedule = \"0 9 * * 1\"\n",
+		"plain http":     "[digest]\nschedule = \"0 9 * * 1\"\nslack_webhook_url = \"http://hooks.slack.com/x\"\n",
+		"no smtp host":   "[digest]\nschedule = \"0 9 * * 1\"\nemail_to = [\"a@example.com\"]\nemail_from = \"b@example.com\"\n",
+		"site":           "[digest]\nschedule = \"0 9 * * 1\"\nslack_webhook_url = \"https://hooks.slack.com/x\"\nsites = [\"Bad_Site\"]\n",
+		"verify cron":    "[digest]\nverify_schedule = \"nightly\"\nslack_webhook_url = \"https://hooks.slack.com/x\"\n",
+		"verify dests":   "[digest]\nverify_schedule = \"0 3 * * *\"\n",
+		"verify sample":  "[digest]\nverify_schedule = \"0 3 * * *\"\nslack_webhook_url = \"https://hooks.slack.com/x\"\nverify_sample_files = 0\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tspages.toml")
+			os.WriteFile(path, []byte(body), 0644)
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad_StatusPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tspages.toml")
+	os.WriteFile(path, []byte(`
+[status_page]
+enabled = true
+sites = ["docs", "team-*"]
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := cfg.StatusPage
+	if !sp.Enabled || sp.Hostname != "status" || sp.Title != "Status" || sp.CheckInterval != 60 || len(sp.Sites) != 2 {
+		t.Errorf("status page = %+v", sp)
+	}
+}
+
+func TestLoad_StatusPageInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"hostname":      "[status_page]\nenabled = true\nhostname = \"Status Page\"\n",
+		"control plane": "[status_page]\nenabled = true\nhostname = \"pages\"\n",
+		"pattern":       "[status_page]\nenabled = true\nsites = [\"[docs\"]\n",
+		"interval":      "[status_page]\nenabled = true\ncheck_interval = 5\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tspages.toml")
+			os.WriteFile(path, []byte(body), 0644)
+			if _, err := Load(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad_Timezone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+timezone = "Europe/Berlin"
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Timezone != "Europe/Berlin" {
+		t.Errorf("timezone = %q, want %q", cfg.Server.Timezone, "Europe/Berlin")
+	}
+}
+
+func TestLoad_TimezoneInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+timezone = "Mars/Olympus_Mons"
+`), 0644)
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown timezone")
+	}
+}
+
+func TestLoad_FetchAllowedHosts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+fetch_allowed_hosts = ["Artifacts.example.com", "*.ci.example.com"]
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"artifacts.example.com", "*.ci.example.com"}
+	if !slices.Equal(cfg.Server.FetchAllowedHosts, want) {
+		t.Errorf("fetch_allowed_hosts = %v, want %v", cfg.Server.FetchAllowedHosts, want)
+	}
+}
+
+func TestLoad_FetchAllowedHostsInvalid(t *testing.T) {
+	for _, host := range []string{"https://artifacts.example.com", "artifacts.example.com/builds", "*", "a.*.example.com", ""} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "tspages.toml")
+		os.WriteFile(path, []byte(fmt.Sprintf("[server]\nfetch_allowed_hosts = [%q]\n", host)), 0644)
+
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected error for fetch_allowed_hosts entry %q", host)
+		}
+	}
+}
+
+func TestLoad_SymlinksInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte(`
+[server]
+symlinks = "follow"
+`), 0644)
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown symlink policy")
+	}
+}
+
+func TestLoad_EncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tspages.toml")
+	os.WriteFile(path, []byte("[server]\n"), 0644)
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	t.Setenv("TSPAGES_ENCRYPTION_KEY", key)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.EncryptionKey != key {
+		t.Errorf("encryption_key = %q", cfg.Server.EncryptionKey)
+	}
+
+	t.Setenv("TSPAGES_ENCRYPTION_KEY", "c2hvcnQ=")
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for a key of the wrong size")
+	}
+}
@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+	"tspages/internal/webhook"
+)
+
+const (
+	// activityPageSize is the number of timeline entries per page.
+	activityPageSize = 50
+	// activityWebhookLimit caps the failed webhook deliveries merged into a
+	// site's timeline.
+	activityWebhookLimit = 200
+	// webhookFailed is the timeline type of a webhook delivery that failed
+	// all its attempts. It is not an event on the bus; failures are read
+	// from the delivery log.
+	webhookFailed = "webhook.failed"
+)
+
+// ActivityItem is a single entry in a site's activity timeline.
+type ActivityItem struct {
+	storage.ActivityEntry
+	// URL links to the entry's subject, such as a deployment or a webhook
+	// delivery, if it has one.
+	URL string `json:"url,omitempty"`
+}
+
+// SiteActivityResponse is the JSON response for GET /sites/{site}/activity.
+type SiteActivityResponse struct {
+	Site       string         `json:"site"`
+	Activity   []ActivityItem `json:"activity"`
+	Page       int            `json:"page"`
+	TotalPages int            `json:"total_pages"`
+}
+
+// --- GET /sites/{site}/activity ---
+
+// SiteActivityHandler shows everything that happened to a site, newest
+// first: deploys, activations, deletions, config changes, failed webhook
+// deliveries, and control plane health transitions.
+type SiteActivityHandler struct {
+	handlerDeps
+	notifier *webhook.Notifier
+}
+
+func (h *SiteActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := trimSuffix(r.PathValue("site"))
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+	if !auth.CanDeploy(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	entries, err := h.store.ListActivity(siteName)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing activity")
+		return
+	}
+	items := make([]ActivityItem, 0, len(entries))
+	for _, e := range entries {
+		item := ActivityItem{ActivityEntry: e}
+		if e.DeploymentID != "" && e.Type != events.DeploymentDeleted {
+			item.URL = "/sites/" + siteName + "/deployments/" + e.DeploymentID
+		}
+		items = append(items, item)
+	}
+	items = append(items, h.healthActivity(r)...)
+	items = append(items, h.webhookActivity(r, siteName)...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.After(items[j].Time)
+	})
+
+	// Pagination.
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	totalPages := max((len(items)+activityPageSize-1)/activityPageSize, 1)
+	page = min(page, totalPages)
+	start := (page - 1) * activityPageSize
+	end := min(start+activityPageSize, len(items))
+
+	resp := SiteActivityResponse{
+		Site:       siteName,
+		Activity:   items[start:end],
+		Page:       page,
+		TotalPages: totalPages,
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, resp)
+		return
+	}
+
+	renderPage(w, r, siteActivityTmpl, "sites", struct {
+		SiteActivityResponse
+		User UserInfo
+	}{resp, userInfo(identity, caps)})
+}
+
+// healthActivity returns the control plane health transitions from the
+// server-wide activity log, which affect every site.
+func (h *SiteActivityHandler) healthActivity(r *http.Request) []ActivityItem {
+	entries, err := h.store.ListActivity("")
+	if err != nil {
+		slog.WarnContext(r.Context(), "listing server activity failed", "err", err)
+		return nil
+	}
+	var items []ActivityItem
+	for _, e := range entries {
+		if e.Type == events.HealthDegraded || e.Type == events.HealthRecovered {
+			items = append(items, ActivityItem{ActivityEntry: e})
+		}
+	}
+	return items
+}
+
+// webhookActivity returns the site's failed webhook deliveries.
+func (h *SiteActivityHandler) webhookActivity(r *http.Request, site string) []ActivityItem {
+	if h.notifier == nil {
+		return nil
+	}
+	deliveries, _, err := h.notifier.ListDeliveries(site, "", "failed", activityWebhookLimit, 0)
+	if err != nil {
+		slog.WarnContext(r.Context(), "listing failed webhook deliveries failed", "site", site, "err", err)
+		return nil
+	}
+	items := make([]ActivityItem, 0, len(deliveries))
+	for _, d := range deliveries {
+		t, err := time.Parse(time.RFC3339, d.LastAttempt)
+		if err != nil {
+			continue
+		}
+		items = append(items, ActivityItem{
+			ActivityEntry: storage.ActivityEntry{
+				Time:   t,
+				Type:   webhookFailed,
+				Detail: fmt.Sprintf("%s delivery failed after %d attempts", d.Event, d.Attempts),
+			},
+			URL: "/webhooks/" + d.WebhookID,
+		})
+	}
+	return items
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func siteActivity(t *testing.T, h *SiteActivityHandler, site string, caps []auth.Cap) *httptest.ResponseRecorder {
+	t.Helper()
+	req := reqWithAuth("GET", "/sites/"+site+"/activity", caps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", site)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSiteActivityHandler_MergesTimeline(t *testing.T) {
+	hs, store, _, db := setupHandlersWithNotifier(t)
+	webhookID := insertDelivery(t, db, "docs", 500)
+
+	base := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	for _, e := range []storage.ActivityEntry{
+		{Time: base, Type: "deploy.success", Actor: "alice", DeploymentID: "aaa11111"},
+		{Time: base.Add(2 * time.Hour), Type: "deployment.activated", Actor: "bob", DeploymentID: "bbb22222"},
+	} {
+		if err := store.AppendActivity("docs", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.AppendActivity("", storage.ActivityEntry{Time: base.Add(time.Hour / 2), Type: "health.degraded"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendActivity("demo", storage.ActivityEntry{Time: base, Type: "deploy.success"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := siteActivity(t, hs.SiteActivity, "docs", adminCaps)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp SiteActivityResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, item := range resp.Activity {
+		types = append(types, item.Type)
+	}
+	// The failed delivery was at 10:00, between the other entries.
+	want := "deployment.activated,webhook.failed,health.degraded,deploy.success"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("types = %s, want %s", got, want)
+	}
+	if got := resp.Activity[0].URL; got != "/sites/docs/deployments/bbb22222" {
+		t.Errorf("activation URL = %q", got)
+	}
+	if got := resp.Activity[1].URL; got != "/webhooks/"+webhookID {
+		t.Errorf("webhook URL = %q", got)
+	}
+	if resp.Page != 1 || resp.TotalPages != 1 {
+		t.Errorf("page = %d of %d, want 1 of 1", resp.Page, resp.TotalPages)
+	}
+}
+
+func TestSiteActivityHandler_HTML(t *testing.T) {
+	hs, store := setupHandlers(t)
+	if err := store.AppendActivity("docs", storage.ActivityEntry{Type: "config.changed", Detail: "changed headers"}); err != nil {
+		t.Fatal(err)
+	}
+	req := reqWithAuth("GET", "/sites/docs/activity", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.SiteActivity.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "changed headers") {
+		t.Error("page does not show the entry's detail")
+	}
+}
+
+func TestSiteActivityHandler_Forbidden(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	if rec := siteActivity(t, hs.SiteActivity, "docs", viewerCaps); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer status = %d, want 403", rec.Code)
+	}
+}
+
+func TestSiteActivityHandler_NotFound(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	if rec := siteActivity(t, hs.SiteActivity, "missing", adminCaps); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if rec := siteActivity(t, hs.SiteActivity, "BAD..", adminCaps); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid name status = %d, want 400", rec.Code)
+	}
+}
@@ -8,7 +8,9 @@ import (
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
+	"tspages/internal/transfer"
 )
 
 // --- analytics shared data ---
@@ -18,9 +20,12 @@ import (
 type AnalyticsData struct {
 	User      UserInfo
 	Admin     bool
+	CanDeploy bool   // per-site only; false for analytics-only access
 	SiteName  string // empty = all-sites view
 	Range     string
+	Bots      bool // visitor counts include bots
 	Total     int64
+	Estimated int64 // requests of Total estimated from sampled asset requests
 	Visitors  int64
 	Pages     int64 // per-site only
 	SiteCount int   // all-sites only
@@ -30,12 +35,36 @@ type AnalyticsData struct {
 	CountOK          int64
 	Count4xx         int64
 	Count5xx         int64
-	TopPages         []analytics.PathCount // per-site only
+	TopPages         []analytics.PathCount       // per-site only
+	TopDownloads     []analytics.PathCount       // per-site only
+	Deployments      []analytics.DeploymentCount // per-site only
+	Tags             []analytics.TagCount        // per-site only
 	TopVisitors      []analytics.VisitorCount
 	StatusCodes      []analytics.StatusCount
 	OS               []analytics.OSCount
 	Nodes            []analytics.NodeCount
 	Sites            []analytics.SiteCount // all-sites only
+
+	Transfer       int64 // bytes served in the range
+	TransferSeries []analytics.TransferBucket
+	MonthTransfer  int64 // per-site only: bytes served this month
+	TransferCap    int64 // per-site only: monthly cap in bytes, 0 if none
+
+	// VisitorsBy is what tells visitors apart: analytics.VisitorsLogin,
+	// VisitorsNode, or VisitorsLoginNode.
+	VisitorsBy string
+}
+
+// VisitorsHint explains what the visitor counts count.
+func (d AnalyticsData) VisitorsHint() string {
+	switch d.VisitorsBy {
+	case analytics.VisitorsNode:
+		return "Distinct nodes: users sharing a device count once, a user with two devices counts twice"
+	case analytics.VisitorsLoginNode:
+		return "Distinct users on each node: a user with two devices counts twice, users sharing a device count separately"
+	default:
+		return "Distinct logins: a user's devices count once, and all tagged nodes count as one visitor"
+	}
 }
 
 func statusTotals(codes []analytics.StatusCount) (ok, clientErr, serverErr int64) {
@@ -68,6 +97,24 @@ func parseRange(r *http.Request) (rangeParam string, from, to time.Time) {
 	return
 }
 
+// includeBots reports whether visitor counts should include requests from
+// bots, the tagged nodes of CI runners and monitoring, which they leave out
+// by default.
+func includeBots(r *http.Request) bool {
+	return r.URL.Query().Get("bots") == "include"
+}
+
+// analyticsLocation returns the timezone charts are bucketed in: the tz
+// query parameter if given, else the caller's preferred timezone. It
+// reports false for an unknown tz.
+func analyticsLocation(r *http.Request) (*time.Location, bool) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		return loc, err == nil
+	}
+	return requestLocation(r), true
+}
+
 // subtractISO8601 parses an ISO 8601 duration string (e.g. "P7D", "PT24H",
 // "P1M") and returns now minus that duration. Returns false for invalid or
 // zero-length durations.
@@ -129,7 +176,7 @@ type AnalyticsHandler struct{ handlerDeps }
 func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 	if h.recorder == nil {
@@ -141,7 +188,7 @@ func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	identity := auth.IdentityFromContext(r.Context())
 	admin := auth.IsAdmin(caps, siteName)
 
-	if !auth.CanDeploy(caps, siteName) {
+	if !auth.CanViewAnalytics(caps, siteName) {
 		RenderError(w, r, http.StatusForbidden, "forbidden")
 		return
 	}
@@ -152,47 +199,84 @@ func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rangeParam, from, now := parseRange(r)
+	loc, ok := analyticsLocation(r)
+	if !ok {
+		RenderError(w, r, http.StatusBadRequest, "tz must be an IANA timezone name")
+		return
+	}
+	sites := []string{siteName}
+	bots := includeBots(r)
 
 	total, err := h.recorder.TotalRequests(siteName, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "total_requests", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_requests", "site", siteName, "err", err)
 	}
-	visitors, err := h.recorder.UniqueVisitors(siteName, from, now)
+	estimated, err := h.recorder.EstimatedRequestsMulti(sites, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "unique_visitors", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "estimated_requests", "site", siteName, "err", err)
+	}
+	visitors, err := h.recorder.UniqueVisitorsMulti(sites, from, now, bots)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "unique_visitors", "site", siteName, "err", err)
 	}
 	pages, err := h.recorder.UniquePages(siteName, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "unique_pages", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "unique_pages", "site", siteName, "err", err)
 	}
-	timeSeries, err := h.recorder.RequestsOverTime(siteName, from, now)
+	timeSeries, err := h.recorder.RequestsOverTimeIn(sites, from, now, loc)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "requests_over_time", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_over_time", "site", siteName, "err", err)
 	}
-	statusTS, err := h.recorder.RequestsOverTimeByStatus(siteName, from, now)
+	statusTS, err := h.recorder.RequestsOverTimeByStatusIn(sites, from, now, loc)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "requests_by_status", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_by_status", "site", siteName, "err", err)
 	}
 	topPages, err := h.recorder.TopPages(siteName, from, now, 20)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "top_pages", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "top_pages", "site", siteName, "err", err)
+	}
+	topDownloads, err := h.recorder.TopDownloads(siteName, from, now, 20)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "top_downloads", "site", siteName, "err", err)
 	}
-	topVisitors, err := h.recorder.TopVisitors(siteName, from, now, 20)
+	topVisitors, err := h.recorder.TopVisitorsMulti(sites, from, now, 20, bots)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "top_visitors", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "top_visitors", "site", siteName, "err", err)
 	}
 	statusCodes, err := h.recorder.StatusBreakdown(siteName, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "status_breakdown", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "status_breakdown", "site", siteName, "err", err)
 	}
 	osBreakdown, err := h.recorder.OSBreakdown(siteName, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "os_breakdown", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "os_breakdown", "site", siteName, "err", err)
 	}
 	nodes, err := h.recorder.NodeBreakdown(siteName, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "node_breakdown", "site", siteName, "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "node_breakdown", "site", siteName, "err", err)
+	}
+	deployments, err := h.recorder.DeploymentBreakdown(siteName, from, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "deployment_breakdown", "site", siteName, "err", err)
+	}
+	tags, err := h.recorder.TagBreakdown(siteName, from, now, 20)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "tag_breakdown", "site", siteName, "err", err)
+	}
+	transferred, err := h.recorder.TotalTransfer(siteName, from, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_transfer", "site", siteName, "err", err)
+	}
+	transferTS, err := h.recorder.TransferOverTime(siteName, from, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "transfer_over_time", "site", siteName, "err", err)
+	}
+	monthTransfer, err := h.recorder.TotalTransfer(siteName, transfer.MonthStart(now), now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "month_transfer", "site", siteName, "err", err)
 	}
+	cfg, _ := h.store.ReadCurrentSiteConfig(siteName)
+	transferCap := transfer.CapBytes(cfg.Merge(h.defaults).TransferCapMB)
 	countOK, count4xx, count5xx := statusTotals(statusCodes)
 
 	if wantsJSON(r) {
@@ -200,26 +284,48 @@ func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			{"/sites/" + siteName + "/analytics", "text/html"},
 		})
 		writeJSON(w, map[string]any{
-			"site": siteName, "range": rangeParam,
-			"total": total, "unique_visitors": visitors, "unique_pages": pages,
+			"site": siteName, "range": rangeParam, "timezone": loc.String(), "include_bots": bots,
+			"total": total, "estimated_requests": estimated, "unique_visitors": visitors, "unique_pages": pages,
+			"visitors_by": h.recorder.Visitors(),
 			"time_series": timeSeries, "status_time_series": statusTS,
-			"top_pages": topPages, "top_visitors": topVisitors,
+			"top_pages": topPages, "top_downloads": topDownloads, "top_visitors": topVisitors,
 			"status_codes": statusCodes, "os": osBreakdown, "nodes": nodes,
+			"deployments": deployments, "tags": tags, "transfer_bytes": transferred,
+			"transfer_time_series": transferTS,
+			"month_transfer_bytes": monthTransfer, "transfer_cap_bytes": transferCap,
 		})
 		return
 	}
 
 	data := AnalyticsData{
-		User: userInfo(identity, caps), Admin: admin, SiteName: siteName,
-		Range: rangeParam, Total: total, Visitors: visitors, Pages: pages,
-		TimeSeries: timeSeries, StatusTimeSeries: statusTS, TopPages: topPages,
+		User: userInfo(identity, caps), Admin: admin, CanDeploy: auth.CanDeploy(caps, siteName), SiteName: siteName,
+		Range: rangeParam, Bots: bots, Total: total, Estimated: estimated, Visitors: visitors, VisitorsBy: h.recorder.Visitors(), Pages: pages,
+		TimeSeries: timeSeries, StatusTimeSeries: statusTS, TopPages: topPages, TopDownloads: topDownloads,
 		TopVisitors: topVisitors, StatusCodes: statusCodes,
 		CountOK: countOK, Count4xx: count4xx, Count5xx: count5xx,
-		OS: osBreakdown, Nodes: nodes,
+		OS: osBreakdown, Nodes: nodes, Deployments: deployments, Tags: tags,
+		Transfer: transferred, TransferSeries: transferTS,
+		MonthTransfer: monthTransfer, TransferCap: transferCap,
 	}
 	renderPage(w, r, analyticsTmpl, "sites", data)
 }
 
+// viewableAnalytics returns the sites the caller with caps can view
+// analytics for.
+func (d *handlerDeps) viewableAnalytics(caps []auth.Cap) ([]string, error) {
+	sites, err := d.store.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var viewable []string
+	for _, s := range sites {
+		if auth.CanViewAnalytics(caps, s.Name) && d.analyticsEnabled(s.Name) {
+			viewable = append(viewable, s.Name)
+		}
+	}
+	return viewable, nil
+}
+
 // --- GET /analytics ---
 
 type AllAnalyticsHandler struct{ handlerDeps }
@@ -234,60 +340,72 @@ func (h *AllAnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	identity := auth.IdentityFromContext(r.Context())
 	admin := auth.HasAdminCap(caps)
 
-	if !auth.HasDeployCap(caps) {
+	if !auth.HasAnalyticsCap(caps) {
 		RenderError(w, r, http.StatusForbidden, "forbidden")
 		return
 	}
 
-	sites, err := h.store.ListSites()
+	viewable, err := h.viewableAnalytics(caps)
 	if err != nil {
 		RenderError(w, r, http.StatusInternalServerError, "listing sites")
 		return
 	}
-	var viewable []string
-	for _, s := range sites {
-		if auth.CanDeploy(caps, s.Name) && h.analyticsEnabled(s.Name) {
-			viewable = append(viewable, s.Name)
-		}
-	}
 
 	rangeParam, from, now := parseRange(r)
+	loc, ok := analyticsLocation(r)
+	if !ok {
+		RenderError(w, r, http.StatusBadRequest, "tz must be an IANA timezone name")
+		return
+	}
+	bots := includeBots(r)
 
 	total, err := h.recorder.TotalRequestsMulti(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "total_requests_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_requests_multi", "err", err)
 	}
-	visitors, err := h.recorder.UniqueVisitorsMulti(viewable, from, now)
+	estimated, err := h.recorder.EstimatedRequestsMulti(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "unique_visitors_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "estimated_requests_multi", "err", err)
 	}
-	timeSeries, err := h.recorder.RequestsOverTimeMulti(viewable, from, now)
+	visitors, err := h.recorder.UniqueVisitorsMulti(viewable, from, now, bots)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "requests_over_time_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "unique_visitors_multi", "err", err)
 	}
-	statusTS, err := h.recorder.RequestsOverTimeByStatusMulti(viewable, from, now)
+	timeSeries, err := h.recorder.RequestsOverTimeIn(viewable, from, now, loc)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "requests_by_status_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_over_time_multi", "err", err)
+	}
+	statusTS, err := h.recorder.RequestsOverTimeByStatusIn(viewable, from, now, loc)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_by_status_multi", "err", err)
 	}
 	siteBreakdown, err := h.recorder.SiteBreakdown(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "site_breakdown", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "site_breakdown", "err", err)
 	}
-	topVisitors, err := h.recorder.TopVisitorsMulti(viewable, from, now, 20)
+	topVisitors, err := h.recorder.TopVisitorsMulti(viewable, from, now, 20, bots)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "top_visitors_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "top_visitors_multi", "err", err)
 	}
 	statusCodes, err := h.recorder.StatusBreakdownMulti(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "status_breakdown_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "status_breakdown_multi", "err", err)
 	}
 	osBreakdown, err := h.recorder.OSBreakdownMulti(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "os_breakdown_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "os_breakdown_multi", "err", err)
 	}
 	nodes, err := h.recorder.NodeBreakdownMulti(viewable, from, now)
 	if err != nil {
-		slog.Error("analytics query failed", "query", "node_breakdown_multi", "err", err)
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "node_breakdown_multi", "err", err)
+	}
+	transferred, err := h.recorder.TotalTransferMulti(viewable, from, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_transfer_multi", "err", err)
+	}
+	transferTS, err := h.recorder.TransferOverTimeMulti(viewable, from, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "transfer_over_time_multi", "err", err)
 	}
 	countOK, count4xx, count5xx := statusTotals(statusCodes)
 
@@ -296,22 +414,25 @@ func (h *AllAnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			{"/analytics", "text/html"},
 		})
 		writeJSON(w, map[string]any{
-			"range": rangeParam,
-			"total": total, "unique_visitors": visitors,
+			"range": rangeParam, "timezone": loc.String(), "include_bots": bots,
+			"total": total, "estimated_requests": estimated, "unique_visitors": visitors,
+			"visitors_by": h.recorder.Visitors(),
 			"time_series": timeSeries, "status_time_series": statusTS,
 			"sites": siteBreakdown, "top_visitors": topVisitors,
 			"status_codes": statusCodes, "os": osBreakdown, "nodes": nodes,
+			"transfer_bytes": transferred, "transfer_time_series": transferTS,
 		})
 		return
 	}
 
 	data := AnalyticsData{
 		User: userInfo(identity, caps), Admin: admin,
-		Range: rangeParam, Total: total, Visitors: visitors, SiteCount: len(viewable),
+		Range: rangeParam, Bots: bots, Total: total, Estimated: estimated, Visitors: visitors, VisitorsBy: h.recorder.Visitors(), SiteCount: len(viewable),
 		TimeSeries: timeSeries, StatusTimeSeries: statusTS, Sites: siteBreakdown,
 		TopVisitors: topVisitors, StatusCodes: statusCodes,
 		CountOK: countOK, Count4xx: count4xx, Count5xx: count5xx,
 		OS: osBreakdown, Nodes: nodes,
+		Transfer: transferred, TransferSeries: transferTS,
 	}
 	renderPage(w, r, analyticsTmpl, "analytics", data)
 }
@@ -323,7 +444,7 @@ type PurgeAnalyticsHandler struct{ handlerDeps }
 func (h *PurgeAnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 	if h.recorder == nil {
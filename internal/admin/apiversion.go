@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path prefix of the versioned JSON API. Every API route
+// is also served at its original, unversioned path until APISunset.
+const APIPrefix = "/api/v1"
+
+var (
+	// APIDeprecated is when the unversioned API paths were deprecated.
+	APIDeprecated = time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)
+	// APISunset is when the unversioned API paths may be removed.
+	APISunset = time.Date(2027, time.October, 15, 0, 0, 0, 0, time.UTC)
+)
+
+// VersionedAPI serves next under APIPrefix. Versioned routes always respond
+// with JSON, so clients need neither an Accept header nor a .json suffix.
+func VersionedAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DeprecatedAPI serves next at an unversioned path. Responses to API
+// clients carry Deprecation (RFC 9745) and Sunset (RFC 8594) headers and
+// link to the versioned route; pages the admin UI renders do not.
+func DeprecatedAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsHTML(r) {
+			successor := APIPrefix + strings.TrimSuffix(r.URL.Path, ".json")
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(APIDeprecated.Unix(), 10))
+			w.Header().Set("Sunset", APISunset.Format(http.TimeFormat))
+			w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wantsHTML reports whether r comes from a browser expecting a page rather
+// than from an API client.
+func wantsHTML(r *http.Request) bool {
+	return !wantsJSON(r) && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
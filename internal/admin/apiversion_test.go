@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionedAPI_ForcesJSON(t *testing.T) {
+	var got bool
+	h := VersionedAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = wantsJSON(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/sites", nil)
+	req.Header.Set("Accept", "text/html")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !got {
+		t.Error("versioned request should want JSON")
+	}
+	if req.Header.Get("Accept") != "text/html" {
+		t.Error("original request was modified")
+	}
+}
+
+func TestDeprecatedAPI_Headers(t *testing.T) {
+	h := DeprecatedAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path   string
+		accept string
+		want   string
+	}{
+		{"/deploy/docs", "*/*", "</api/v1/deploy/docs>; rel=\"successor-version\""},
+		{"/sites.json", "text/html", "</api/v1/sites>; rel=\"successor-version\""},
+		{"/sites", "application/json", "</api/v1/sites>; rel=\"successor-version\""},
+		{"/sites", "text/html,application/xhtml+xml", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Link"); got != tt.want {
+			t.Errorf("%s (Accept %s): Link = %q, want %q", tt.path, tt.accept, got, tt.want)
+		}
+		if tt.want == "" {
+			if rec.Header().Get("Deprecation") != "" {
+				t.Errorf("%s: HTML page should not be marked deprecated", tt.path)
+			}
+			continue
+		}
+		if got := rec.Header().Get("Deprecation"); got != "@1792022400" {
+			t.Errorf("%s: Deprecation = %q", tt.path, got)
+		}
+		if got := rec.Header().Get("Sunset"); got != "Fri, 15 Oct 2027 00:00:00 GMT" {
+			t.Errorf("%s: Sunset = %q", tt.path, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// maxBannerMessage caps the length of a custom archive banner message.
+const maxBannerMessage = 500
+
+// --- POST /sites/{site}/archive ---
+
+// ArchiveSiteHandler archives a site. The form values banner (bool) and
+// message control the notice injected into the site's HTML pages.
+type ArchiveSiteHandler struct {
+	handlerDeps
+	ensurer SiteEnsurer
+}
+
+func (h *ArchiveSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanArchiveSite(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	banner, _ := strconv.ParseBool(r.FormValue("banner"))
+	message := strings.TrimSpace(r.FormValue("message"))
+	if len(message) > maxBannerMessage {
+		RenderError(w, r, http.StatusBadRequest, "banner message is too long")
+		return
+	}
+
+	identity := auth.IdentityFromContext(r.Context())
+	archivedBy := identity.DisplayName
+	if archivedBy == "" {
+		archivedBy = identity.LoginName
+	}
+	state := storage.ArchiveState{ArchivedBy: archivedBy, Banner: banner, Message: message}
+	if err := h.store.ArchiveSite(siteName, state); err != nil {
+		if os.IsNotExist(err) {
+			RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+			return
+		}
+		RenderError(w, r, http.StatusInternalServerError, "archiving site")
+		return
+	}
+	if err := h.ensurer.EnsureServer(siteName); err != nil {
+		slog.WarnContext(r.Context(), "archive state changed but server failed to refresh", "site", siteName, "err", err)
+	}
+
+	if wantsJSON(r) {
+		state, _ := h.store.ReadArchiveState(siteName)
+		writeJSON(w, state)
+		return
+	}
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
+
+// --- POST /sites/{site}/unarchive ---
+
+// UnarchiveSiteHandler lifts a site's archive state, allowing deploys and
+// deletion again.
+type UnarchiveSiteHandler struct {
+	handlerDeps
+	ensurer SiteEnsurer
+}
+
+func (h *UnarchiveSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanArchiveSite(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+	if err := h.store.UnarchiveSite(siteName); err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "unarchiving site")
+		return
+	}
+	if err := h.ensurer.EnsureServer(siteName); err != nil {
+		slog.WarnContext(r.Context(), "archive state changed but server failed to refresh", "site", siteName, "err", err)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, map[string]string{"name": siteName})
+		return
+	}
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
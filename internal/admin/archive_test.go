@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestArchiveSiteHandler(t *testing.T) {
+	store := setupStore(t)
+	ensurer := &mockEnsurer{}
+	hs := NewHandlers(store, nil, "test.ts.net", ensurer, ensurer, storage.SiteConfig{}, nil, nil, Options{})
+
+	req := formReqWithAuth("/sites/docs/archive", "banner=true&message=Moved+to+wiki", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.ArchiveSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303, body = %s", rec.Code, rec.Body.String())
+	}
+	state, ok := store.ReadArchiveState("docs")
+	if !ok || !state.Banner || state.Message != "Moved to wiki" || state.ArchivedBy != "Admin" {
+		t.Errorf("state = %+v, archived = %v", state, ok)
+	}
+	if len(ensurer.ensured) != 1 || ensurer.ensured[0] != "docs" {
+		t.Errorf("ensured = %v, want [docs]", ensurer.ensured)
+	}
+
+	// The site detail reports the archive state.
+	req = reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	var resp SiteDetailResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Site.Archived == nil || resp.Site.Archived.Message != "Moved to wiki" {
+		t.Errorf("archived = %+v", resp.Site.Archived)
+	}
+
+	req = reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "/sites/docs/unarchive") || strings.Contains(body, `data-action="delete-site"`) {
+		t.Errorf("site page status = %d, missing unarchive or showing delete", rec.Code)
+	}
+
+	req = formReqWithAuth("/sites/docs/unarchive", "", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.UnarchiveSite.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("unarchive status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if store.SiteArchived("docs") {
+		t.Error("site still archived")
+	}
+}
+
+func TestArchiveSiteHandler_NotFound(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for name, h := range map[string]http.Handler{"archive": hs.ArchiveSite, "unarchive": hs.UnarchiveSite} {
+		req := formReqWithAuth("/sites/gone/"+name, "", adminCaps, adminID)
+		req.SetPathValue("site", "gone")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", name, rec.Code)
+		}
+	}
+}
+
+func TestArchiveSiteHandler_RequiresAdmin(t *testing.T) {
+	hs, store := setupHandlers(t)
+	deployer := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+	for name, h := range map[string]http.Handler{"archive": hs.ArchiveSite, "unarchive": hs.UnarchiveSite} {
+		req := formReqWithAuth("/sites/docs/"+name, "", deployer, viewerID)
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", name, rec.Code)
+		}
+	}
+	if store.SiteArchived("docs") {
+		t.Error("site archived without permission")
+	}
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/serve"
+	"tspages/internal/storage"
+)
+
+// maxConfigTestPaths caps the paths traced in one config test.
+const maxConfigTestPaths = 100
+
+// ConfigTestRequest is the JSON request body for POST /sites/{site}/config/test.
+type ConfigTestRequest struct {
+	Paths []string `json:"paths"`
+	// Redirects and Headers hold the contents of a _redirects or _headers
+	// file, which replace the deployment's redirects or headers, to try
+	// changes to them before deploying.
+	Redirects *string `json:"redirects,omitempty"`
+	Headers   *string `json:"headers,omitempty"`
+}
+
+// ConfigTestResponse is the JSON response for POST /sites/{site}/config/test.
+type ConfigTestResponse struct {
+	Site         string            `json:"site"`
+	DeploymentID string            `json:"deployment_id"`
+	Results      []serve.PathTrace `json:"results"`
+}
+
+// --- POST /sites/{site}/config/test ---
+
+// ConfigTestHandler traces request paths through the redirects, headers,
+// and file lookup of a site's active deployment, to debug its config
+// without deploying it again and again.
+type ConfigTestHandler struct{ handlerDeps }
+
+func (h *ConfigTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !auth.CanDeploy(auth.CapsFromContext(r.Context()), siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	var req ConfigTestRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		RenderError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Paths) == 0 || len(req.Paths) > maxConfigTestPaths {
+		RenderError(w, r, http.StatusBadRequest, fmt.Sprintf("paths must list 1 to %d paths", maxConfigTestPaths))
+		return
+	}
+
+	id, err := h.store.CurrentDeployment(siteName)
+	if err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.DeploymentNotFound, "site has no active deployment")
+		return
+	}
+	raw, err := h.store.ReadSiteConfig(siteName, id)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "reading site config")
+		return
+	}
+	if req.Redirects != nil {
+		if raw.Redirects, err = storage.ParseRedirectsFile([]byte(*req.Redirects)); err != nil {
+			RenderProblem(w, r, http.StatusBadRequest, problem.InvalidConfig, err.Error())
+			return
+		}
+	}
+	if req.Headers != nil {
+		if raw.Headers, err = storage.ParseHeadersFile([]byte(*req.Headers)); err != nil {
+			RenderProblem(w, r, http.StatusBadRequest, problem.InvalidConfig, err.Error())
+			return
+		}
+	}
+	if err := raw.Validate(); err != nil {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidConfig, err.Error())
+		return
+	}
+	files, err := h.store.ListDeploymentFiles(siteName, id)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing files")
+		return
+	}
+
+	writeJSON(w, ConfigTestResponse{
+		Site:         siteName,
+		DeploymentID: id,
+		Results:      serve.TracePaths(files, raw.Merge(h.defaults), req.Paths),
+	})
+}
@@ -1,15 +1,120 @@
 package admin
 
 import (
+	"context"
+	"errors"
+	"html/template"
 	"log/slog"
 	"net/http"
+	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 
 	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 )
 
+// statusFailed is the status query parameter that limits deployment lists
+// to failed deployments.
+const statusFailed = "failed"
+
+// deploymentStatus returns the status deployment lists are filtered by in
+// r, or "" for all deployments.
+func deploymentStatus(r *http.Request) string {
+	if r.URL.Query().Get("status") == statusFailed {
+		return statusFailed
+	}
+	return ""
+}
+
+// reindexSite updates index, if any, for site after a change that publishes
+// no event, such as restoring it from the trash.
+func reindexSite(ctx context.Context, index *deployindex.Index, site string) {
+	if index == nil {
+		return
+	}
+	if err := index.SyncSite(site); err != nil {
+		slog.WarnContext(ctx, "updating deployment index failed", "site", site, "err", err)
+	}
+}
+
+// listDeployments lists the deployments selected by q, newest first, with
+// their commit ranges linked to each site's compare_url. It returns how many
+// there are in total regardless of q.Limit and q.Offset.
+func (d *handlerDeps) listDeployments(q deployindex.Query) ([]DeploymentEntry, int, error) {
+	var (
+		entries []DeploymentEntry
+		total   int
+		err     error
+	)
+	if d.index != nil {
+		entries, total, err = d.index.List(q)
+	} else {
+		entries, total, err = deployindex.Scan(d.store, q)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	compareURLs := make(map[string]string)
+	for i, e := range entries {
+		if e.CommitRange == nil {
+			continue
+		}
+		compareURL, ok := compareURLs[e.Site]
+		if !ok {
+			cfg, _ := d.store.ReadCurrentSiteConfig(e.Site)
+			compareURL = cfg.Merge(d.defaults).CompareURL
+			compareURLs[e.Site] = compareURL
+		}
+		entries[i].CommitRange = storage.NewCommitRange(&storage.BuildInfo{Commit: e.CommitRange.From},
+			&storage.BuildInfo{Commit: e.CommitRange.To}, compareURL)
+	}
+	return entries, total, nil
+}
+
+// deploymentsPage lists the page of the deployments selected by q that the
+// page query parameter of r asks for, clamped to the pages there are.
+func (d *handlerDeps) deploymentsPage(r *http.Request, q deployindex.Query) (entries []DeploymentEntry, page, totalPages int, err error) {
+	page = 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	q.Limit = deploymentsPageSize
+	q.Offset = (page - 1) * deploymentsPageSize
+	entries, total, err := d.listDeployments(q)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	totalPages = max((total+deploymentsPageSize-1)/deploymentsPageSize, 1)
+	if page > totalPages {
+		page = totalPages
+		q.Offset = (page - 1) * deploymentsPageSize
+		if entries, _, err = d.listDeployments(q); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return entries, page, totalPages, nil
+}
+
+// sortedDeployments lists the deployments of site newest first, each with
+// its commit range to the one before it.
+func (d *handlerDeps) sortedDeployments(site string) ([]storage.DeploymentInfo, error) {
+	deployments, err := d.store.ListDeployments(site)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
+	})
+	cfg, _ := d.store.ReadCurrentSiteConfig(site)
+	storage.SetCommitRanges(deployments, cfg.Merge(d.defaults).CompareURL)
+	return deployments, nil
+}
+
 // --- GET /sites/{site}/deployments/{id} ---
 
 type DeploymentHandler struct{ handlerDeps }
@@ -18,7 +123,7 @@ func (h *DeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	depID := trimSuffix(r.PathValue("id"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
@@ -31,31 +136,28 @@ func (h *DeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deployments, err := h.store.ListDeployments(siteName)
+	// Sorted newest first, so that the previous deployment follows.
+	deployments, err := h.sortedDeployments(siteName)
 	if err != nil {
 		RenderError(w, r, http.StatusInternalServerError, "listing deployments")
 		return
 	}
 
-	// Sort by CreatedAt descending before scanning so that pointer into
-	// the slice remains valid and we can find the previous deployment.
-	sort.Slice(deployments, func(i, j int) bool {
-		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
-	})
-
 	var dep *storage.DeploymentInfo
 	var prevID string
+	var history []storage.DeploymentInfo
 	for i := range deployments {
 		if deployments[i].ID == depID {
 			dep = &deployments[i]
 			if i+1 < len(deployments) {
 				prevID = deployments[i+1].ID
 			}
+			history = sizeHistory(deployments[i:])
 			break
 		}
 	}
 	if dep == nil {
-		RenderError(w, r, http.StatusNotFound, "deployment not found")
+		RenderProblem(w, r, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found")
 		return
 	}
 
@@ -71,9 +173,23 @@ func (h *DeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	const maxFiles = 250
 	allFiles, err := h.store.ListDeploymentFiles(siteName, depID)
 	if err != nil {
-		slog.Warn("listing deployment files failed", "site", siteName, "deployment", depID, "err", err)
+		slog.WarnContext(r.Context(), "listing deployment files failed", "site", siteName, "deployment", depID, "err", err)
 	}
 	fileCount := len(allFiles)
+	var minifiedSaved int64
+	for _, f := range allFiles {
+		if f.OriginalSize > f.Size {
+			minifiedSaved += f.OriginalSize - f.Size
+		}
+	}
+	composition := storage.Compose(allFiles, largestFiles)
+	var maxKindBytes, maxHistoryBytes int64
+	if len(composition.Kinds) > 0 {
+		maxKindBytes = composition.Kinds[0].Bytes
+	}
+	for _, d := range history {
+		maxHistoryBytes = max(maxHistoryBytes, d.SizeBytes)
+	}
 	files := allFiles
 	if len(files) > maxFiles {
 		files = files[:maxFiles]
@@ -84,9 +200,9 @@ func (h *DeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if prevID != "" {
 		prevFiles, err := h.store.ListDeploymentFiles(siteName, prevID)
 		if err != nil {
-			slog.Warn("listing deployment files failed", "site", siteName, "deployment", prevID, "err", err)
+			slog.WarnContext(r.Context(), "listing deployment files failed", "site", siteName, "deployment", prevID, "err", err)
 		}
-		added, removed, changed = diffFiles(allFiles, prevFiles)
+		added, removed, changed = storage.DiffFiles(allFiles, prevFiles)
 		// Cap diff output to avoid huge tables.
 		if len(added) > maxFiles {
 			added = added[:maxFiles]
@@ -99,34 +215,138 @@ func (h *DeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	deployLog, err := h.store.ReadDeployLog(siteName, depID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.WarnContext(r.Context(), "reading deploy log failed", "site", siteName, "deployment", depID, "err", err)
+	}
+
 	renderPage(w, r, deploymentTmpl, "sites", struct {
 		User       UserInfo
 		Admin      bool
 		CanDeploy  bool
 		DNSSuffix  string
 		SiteName   string
+		Hostname   string
 		Deployment storage.DeploymentInfo
 		Files      []storage.FileInfo
 		FileCount  int
+		Minified   int64
 		PrevID     string
 		Added      []string
 		Removed    []string
 		Changed    []string
+		Log        []storage.DeployLogEntry
+
+		Composition     storage.Composition
+		MaxKindBytes    int64
+		History         []storage.DeploymentInfo // oldest first, ending with Deployment
+		MaxHistoryBytes int64
 	}{
 		userInfo(identity, caps), admin, auth.CanDeploy(caps, siteName),
-		h.dnsSuffix, siteName, *dep,
-		files, fileCount, prevID,
-		added, removed, changed,
+		h.dnsSuffix, siteName, h.siteHostname(siteName), *dep,
+		files, fileCount, minifiedSaved, prevID,
+		added, removed, changed, deployLog,
+		composition, maxKindBytes, history, maxHistoryBytes,
 	})
 }
 
+// largestFiles is how many of a deployment's largest files its page lists.
+const largestFiles = 10
+
+// sizeHistoryLength is how many deployments the size trend on a
+// deployment's page covers, including its own.
+const sizeHistoryLength = 10
+
+// sizeHistory returns the deployment deployments starts with and the
+// completed deployments before it, up to sizeHistoryLength, oldest first.
+// deployments must be sorted newest first.
+func sizeHistory(deployments []storage.DeploymentInfo) []storage.DeploymentInfo {
+	history := []storage.DeploymentInfo{deployments[0]}
+	for _, d := range deployments[1:] {
+		if len(history) == sizeHistoryLength {
+			break
+		}
+		if !d.Failed {
+			history = append(history, d)
+		}
+	}
+	slices.Reverse(history)
+	return history
+}
+
+// --- GET /sites/{site}/deployments/{id}/config ---
+
+// ConfigSnapshotHandler returns the config a deployment was last activated
+// with, merged with the server defaults of the time, to tell which config
+// was in effect when something happened. It only serves JSON.
+type ConfigSnapshotHandler struct{ handlerDeps }
+
+func (h *ConfigSnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	depID := r.PathValue("id")
+	if !storage.ValidSiteName(siteName) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !auth.CanDeploy(auth.CapsFromContext(r.Context()), siteName) {
+		problem.Write(w, http.StatusForbidden, problem.Forbidden, "forbidden")
+		return
+	}
+
+	snapshot, err := h.store.ReadConfigSnapshot(siteName, depID)
+	if os.IsNotExist(err) {
+		if _, merr := h.store.ReadManifest(siteName, depID); merr != nil {
+			err = storage.ErrDeploymentNotFound
+		}
+	}
+	switch {
+	case errors.Is(err, storage.ErrDeploymentNotFound):
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found")
+	case os.IsNotExist(err):
+		problem.Write(w, http.StatusNotFound, problem.NotFound, "deployment has no config snapshot; it was not activated since they are recorded")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "reading config snapshot", "site", siteName, "deployment", depID, "err", err)
+		problem.Write(w, http.StatusInternalServerError, problem.Internal, "reading config snapshot")
+	default:
+		writeJSON(w, snapshot)
+	}
+}
+
+// --- GET /sites/{site}/deployments/verify ---
+
+// VerifyChainHandler verifies a site's deployment chain, to prove to an
+// audit that its deployment history was not rewritten. It only serves
+// JSON, and responds with 200 whether or not the chain is valid.
+type VerifyChainHandler struct{ handlerDeps }
+
+func (h *VerifyChainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !auth.CanView(auth.CapsFromContext(r.Context()), siteName) {
+		problem.Write(w, http.StatusForbidden, problem.Forbidden, "forbidden")
+		return
+	}
+	if _, err := h.store.GetSite(siteName); err != nil {
+		problem.Write(w, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	report, err := h.store.VerifyChain(siteName)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "verifying deployment chain", "site", siteName, "err", err)
+		problem.Write(w, http.StatusInternalServerError, problem.Internal, "verifying deployment chain")
+		return
+	}
+	writeJSON(w, report)
+}
+
 // --- GET /deployments ---
 
 // DeploymentEntry is a deployment with its site name, for the global feed.
-type DeploymentEntry struct {
-	storage.DeploymentInfo
-	Site string `json:"site"`
-}
+type DeploymentEntry = deployindex.Entry
 
 // DeploymentsResponse is the JSON response for GET /deployments.
 type DeploymentsResponse struct {
@@ -154,43 +374,17 @@ func (h *DeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Collect deployments from all sites the user can deploy to.
-	all := make([]DeploymentEntry, 0)
-	for _, s := range sites {
-		if !auth.CanDeploy(caps, s.Name) {
-			continue
-		}
-		deps, err := h.store.ListDeployments(s.Name)
-		if err != nil {
-			continue
-		}
-		for _, d := range deps {
-			all = append(all, DeploymentEntry{DeploymentInfo: d, Site: s.Name})
-		}
-	}
-
-	sort.Slice(all, func(i, j int) bool {
-		return all[i].CreatedAt.After(all[j].CreatedAt)
-	})
-
-	// Pagination.
-	page := 1
-	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
-		page = p
-	}
-	totalPages := (len(all) + deploymentsPageSize - 1) / deploymentsPageSize
-	if totalPages == 0 {
-		totalPages = 1
-	}
-	if page > totalPages {
-		page = totalPages
+	// List deployments of all sites the user can deploy to.
+	filter, err := deploymentFilter(r.URL.Query())
+	if err != nil {
+		RenderError(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
-	start := (page - 1) * deploymentsPageSize
-	end := start + deploymentsPageSize
-	if end > len(all) {
-		end = len(all)
+	pageItems, page, totalPages, err := h.deploymentsPage(r, filteredQuery(caps, sites, filter))
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing deployments")
+		return
 	}
-	pageItems := all[start:end]
 
 	resp := DeploymentsResponse{
 		Deployments: pageItems,
@@ -207,10 +401,25 @@ func (h *DeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	savedFilters, err := h.savedFilters(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "reading saved filters failed", "err", err)
+	}
+	// The query is already encoded; as a plain string, html/template would
+	// escape it again in the links it is appended to.
+	query := template.URL(filterQuery(filter))
 	renderPage(w, r, deploymentsTmpl, "deployments", struct {
 		DeploymentsResponse
-		User UserInfo
-	}{resp, userInfo(identity, caps)})
+		Filter       storage.DeploymentFilter
+		FilterSites  string
+		FilterQuery  template.URL
+		SavedFilters []SavedFilterResponse
+		CanSave      bool
+		User         UserInfo
+	}{
+		resp, filter, strings.Join(filter.Sites, ", "), query,
+		savedFilters, identity.LoginName != "", userInfo(identity, caps),
+	})
 }
 
 // --- GET /sites/{site}/deployments ---
@@ -220,7 +429,7 @@ type SiteDeploymentsHandler struct{ handlerDeps }
 func (h *SiteDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
@@ -233,36 +442,18 @@ func (h *SiteDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	deployments, err := h.store.ListDeployments(siteName)
+	status := deploymentStatus(r)
+	entries, page, totalPages, err := h.deploymentsPage(r, deployindex.Query{Sites: []string{siteName}, Failed: status == statusFailed})
 	if err != nil {
 		RenderError(w, r, http.StatusInternalServerError, "listing deployments")
 		return
 	}
-	if deployments == nil {
-		deployments = []storage.DeploymentInfo{}
+	pageItems := make([]storage.DeploymentInfo, len(entries))
+	for i, e := range entries {
+		pageItems[i] = e.DeploymentInfo
+		// The index does not track tampering, which the store records.
+		pageItems[i].Tampered, _ = h.store.Tampered(siteName, e.ID)
 	}
-	sort.Slice(deployments, func(i, j int) bool {
-		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
-	})
-
-	// Pagination.
-	page := 1
-	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
-		page = p
-	}
-	totalPages := (len(deployments) + deploymentsPageSize - 1) / deploymentsPageSize
-	if totalPages == 0 {
-		totalPages = 1
-	}
-	if page > totalPages {
-		page = totalPages
-	}
-	start := (page - 1) * deploymentsPageSize
-	end := start + deploymentsPageSize
-	if end > len(deployments) {
-		end = len(deployments)
-	}
-	pageItems := deployments[start:end]
 
 	if wantsJSON(r) {
 		writeJSON(w, map[string]any{
@@ -273,12 +464,10 @@ func (h *SiteDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	hasInactive := false
-	for _, d := range deployments {
-		if !d.Active {
-			hasInactive = true
-			break
-		}
+	_, inactive, err := h.listDeployments(deployindex.Query{Sites: []string{siteName}, Inactive: true, Limit: 1})
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing deployments")
+		return
 	}
 
 	renderPage(w, r, siteDeploymentsTmpl, "sites", struct {
@@ -289,32 +478,7 @@ func (h *SiteDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		Admin       bool
 		CanDeploy   bool
 		HasInactive bool
+		Status      string
 		User        UserInfo
-	}{pageItems, page, totalPages, siteName, admin, auth.CanDeploy(caps, siteName), hasInactive, userInfo(identity, caps)})
-}
-
-// diffFiles compares two file lists and returns added, removed, and changed paths.
-// A file is considered "changed" if its content hash differs.
-func diffFiles(current, previous []storage.FileInfo) (added, removed, changed []string) {
-	prevMap := make(map[string]string, len(previous))
-	for _, f := range previous {
-		prevMap[f.Path] = f.Hash
-	}
-	currMap := make(map[string]struct{}, len(current))
-	for _, f := range current {
-		currMap[f.Path] = struct{}{}
-		if prevHash, ok := prevMap[f.Path]; ok {
-			if f.Hash != prevHash {
-				changed = append(changed, f.Path)
-			}
-		} else {
-			added = append(added, f.Path)
-		}
-	}
-	for _, f := range previous {
-		if _, ok := currMap[f.Path]; !ok {
-			removed = append(removed, f.Path)
-		}
-	}
-	return
+	}{pageItems, page, totalPages, siteName, admin, auth.CanDeploy(caps, siteName), inactive > 0, status, userInfo(identity, caps)})
 }
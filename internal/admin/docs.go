@@ -97,3 +97,48 @@ func RenderDoc(slug string) (template.HTML, error) {
 
 	return result, nil
 }
+
+// docSection is the text of a documentation page under one heading.
+type docSection struct {
+	Page    DocPage
+	Heading string
+	Text    string
+}
+
+// docSections splits every documentation page at its headings, for
+// searching the help pages. The introduction below a page's title has an
+// empty Heading.
+var docSections = sync.OnceValue(func() []docSection {
+	var sections []docSection
+	for _, p := range docPageOrder {
+		data, err := docsFS.ReadFile("docs/" + p.Slug + ".md")
+		if err != nil {
+			continue
+		}
+		current := docSection{Page: p}
+		var text strings.Builder
+		flush := func() {
+			if current.Text = text.String(); current.Heading != "" || strings.TrimSpace(current.Text) != "" {
+				sections = append(sections, current)
+			}
+			text.Reset()
+		}
+		inCode := false
+		for line := range strings.Lines(string(data)) {
+			if strings.HasPrefix(line, "```") {
+				inCode = !inCode
+			}
+			if heading, ok := strings.CutPrefix(line, "#"); ok && !inCode {
+				flush()
+				current = docSection{Page: p}
+				if h := strings.TrimSpace(strings.TrimLeft(heading, "#")); h != p.Title {
+					current.Heading = h
+				}
+				continue
+			}
+			text.WriteString(line)
+		}
+		flush()
+	}
+	return sections
+})
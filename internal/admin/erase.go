@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/events"
+	"tspages/internal/fieldcrypt"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// erasedPrefix starts the token an erased user's identity is replaced with.
+const erasedPrefix = "erased-"
+
+// EraseUserResponse is the JSON response for POST /admin/users/{login}/erase,
+// counting what was erased.
+type EraseUserResponse struct {
+	// Token replaces the user's login and names, and is the same each time
+	// the user is erased.
+	Token             string `json:"token"`
+	AnalyticsRequests int64  `json:"analytics_requests"`
+	storage.Erasure
+}
+
+// --- POST /admin/users/{login}/erase ---
+
+// EraseUserHandler erases a user's identity, for requests to be forgotten.
+// Their login and display names are replaced with a stable token in
+// analytics, activity logs, manifests, and shares, and their saved filters
+// and preferences are deleted. The erasure is published as user.erased,
+// which records it in the server-wide activity log under the token.
+type EraseUserHandler struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	index    *deployindex.Index
+	cipher   *fieldcrypt.Cipher
+	events   *events.Bus
+}
+
+// NewEraseUserHandler returns a handler erasing users from store and
+// recorder, which may be nil if analytics are disabled, and updating index,
+// which may be nil too. Tokens are derived with cipher, so they cannot be
+// traced back to a login without the encryption key; with a nil cipher
+// they are plain hashes.
+func NewEraseUserHandler(store *storage.Store, recorder *analytics.Recorder, index *deployindex.Index, cipher *fieldcrypt.Cipher, bus *events.Bus) *EraseUserHandler {
+	return &EraseUserHandler{store: store, recorder: recorder, index: index, cipher: cipher, events: bus}
+}
+
+func (h *EraseUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanEraseUsers(auth.CapsFromContext(r.Context())) {
+		problem.Write(w, http.StatusForbidden, problem.Forbidden, "forbidden")
+		return
+	}
+	login := r.PathValue("login")
+	if !validLogin(login) || strings.HasPrefix(login, erasedPrefix) {
+		problem.Write(w, http.StatusBadRequest, problem.BadRequest, "invalid login name")
+		return
+	}
+
+	resp := EraseUserResponse{Token: erasedPrefix + h.cipher.Pseudonym(login)}
+	var names []string
+	if h.recorder != nil {
+		n, recorded, err := h.recorder.EraseUser(login, resp.Token)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "erasing user from analytics failed", "err", err)
+			problem.Write(w, http.StatusInternalServerError, problem.Internal, "erasing analytics")
+			return
+		}
+		resp.AnalyticsRequests, names = n, recorded
+	}
+	// Activity logs and manifests record deployers by display name, which
+	// analytics know for users who visited a site.
+	erasure, err := h.store.EraseUser(login, names, resp.Token)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "erasing user failed", "err", err)
+		problem.Write(w, http.StatusInternalServerError, problem.Internal, "erasing user data")
+		return
+	}
+	resp.Erasure = erasure
+	for _, site := range erasure.Sites {
+		reindexSite(r.Context(), h.index, site)
+	}
+
+	// The login is not logged, since that would keep it around.
+	identity := auth.IdentityFromContext(r.Context())
+	erasedBy := identity.DisplayName
+	if erasedBy == "" {
+		erasedBy = identity.LoginName
+	}
+	slog.InfoContext(r.Context(), "erased user", "token", resp.Token, "erased_by", erasedBy,
+		"analytics_requests", resp.AnalyticsRequests, "manifests", erasure.Manifests,
+		"activity_entries", erasure.ActivityEntries)
+	if h.events != nil {
+		h.events.Publish(events.Event{
+			Type:      events.UserErased,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"token":              resp.Token,
+				"erased_by":          erasedBy,
+				"analytics_requests": resp.AnalyticsRequests,
+				"manifests":          erasure.Manifests,
+				"activity_entries":   erasure.ActivityEntries,
+			},
+		})
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/events"
+)
+
+func TestEraseUserHandler(t *testing.T) {
+	store := setupStore(t)
+	recorder := setupRecorder(t)
+	alice := analytics.Event{Timestamp: time.Now(), Site: "docs", Path: "/", Status: 200,
+		UserLogin: "alice@example.com", UserName: "Alice"}
+	if err := recorder.Import([]analytics.Event{alice, alice}); err != nil {
+		t.Fatal(err)
+	}
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	h := NewEraseUserHandler(store, recorder, nil, nil, bus)
+
+	req := reqWithAuth("POST", "/admin/users/alice@example.com/erase", adminCaps, adminID)
+	req.SetPathValue("login", "alice@example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp EraseUserResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Token, erasedPrefix) || resp.AnalyticsRequests != 2 || resp.Manifests != 1 {
+		t.Errorf("response = %+v", resp)
+	}
+	// Alice deployed docs under her display name, known from analytics.
+	if m, _ := store.ReadManifest("docs", "aaa11111"); m.CreatedBy != resp.Token || m.CreatedByAvatar != "" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if m, _ := store.ReadManifest("demo", "bbb22222"); m.CreatedBy != "Bob" {
+		t.Errorf("other deployer erased: %+v", m)
+	}
+	if len(got) != 1 || got[0].Type != events.UserErased || got[0].Data["token"] != resp.Token || got[0].Data["erased_by"] != "Admin" {
+		t.Errorf("events = %+v, want an erasure by Admin", got)
+	}
+
+	// The token is stable.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var again EraseUserResponse
+	json.NewDecoder(rec.Body).Decode(&again)
+	if again.Token != resp.Token || again.AnalyticsRequests != 0 || again.Manifests != 0 {
+		t.Errorf("second erasure = %+v", again)
+	}
+}
+
+func TestEraseUserHandler_Rejects(t *testing.T) {
+	h := NewEraseUserHandler(setupStore(t), nil, nil, nil, nil)
+	tests := []struct {
+		name  string
+		login string
+		caps  []auth.Cap
+		want  int
+	}{
+		{"scoped admin", "alice@example.com", []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}, http.StatusForbidden},
+		{"viewer", "alice@example.com", viewerCaps, http.StatusForbidden},
+		{"erased token", "erased-0123456789abcdef", adminCaps, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := reqWithAuth("POST", "/admin/users/x/erase", tt.caps, adminID)
+			req.SetPathValue("login", tt.login)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tspages/internal/problem"
+)
+
+// errorDescription returns msg, or a sentence explaining status if msg
+// only repeats the status text, as the bare "forbidden" many handlers send
+// does.
+func errorDescription(status int, msg string) string {
+	if msg != "" && !strings.EqualFold(msg, http.StatusText(status)) {
+		return msg
+	}
+	switch status {
+	case http.StatusForbidden:
+		return "Your tspages capabilities don't allow this."
+	case http.StatusNotFound:
+		return "There is nothing at this address."
+	case http.StatusServiceUnavailable:
+		return "The server can't handle this request right now."
+	}
+	if status >= 500 {
+		return "Something went wrong on the server."
+	}
+	return msg
+}
+
+// errorActions suggests what the user who got an error page can do about
+// it. w carries the headers set for the error response so far.
+func errorActions(w http.ResponseWriter, r *http.Request, status int, code problem.Code) []string {
+	switch code {
+	case problem.ReadOnly:
+		return []string{"Wait until an admin turns read-only mode off, then try again."}
+	case problem.InvalidSiteName:
+		return []string{"Use a site name of lowercase letters, digits, and hyphens."}
+	case problem.SiteNotFound:
+		return []string{"Check the site name in the address.", "Find the site on the sites page."}
+	case problem.DeploymentNotFound:
+		return []string{"Pick a deployment from the site's deployments page."}
+	case problem.InvalidConfig:
+		return []string{"Fix the site config and try again."}
+	case problem.SiteExists, problem.DeploymentExists:
+		return []string{"Reload the page to see the current state, and pick another name."}
+	}
+
+	switch {
+	case status == http.StatusForbidden:
+		ask := "Ask a tailnet admin to grant you a tspages capability that allows this."
+		if site := r.PathValue("site"); site != "" {
+			ask = fmt.Sprintf("Ask a tailnet admin to grant you a tspages capability for the site %s.", site)
+		}
+		return []string{ask, "See what your capabilities allow on your identity page."}
+	case status == http.StatusNotFound:
+		return []string{"Check the address for typos.", "Find what you are looking for on the sites page."}
+	case status == http.StatusConflict:
+		return []string{"Reload the page to see the current state, then try again."}
+	case problem.Retryable(status):
+		if s, err := strconv.Atoi(w.Header().Get("Retry-After")); err == nil && s > 0 {
+			return []string{fmt.Sprintf("Try again in %d seconds.", s)}
+		}
+		return []string{"Try again in a moment."}
+	case status >= 500:
+		return []string{"Try again.", "If the error persists, give an admin the request ID below, which finds the error in the server log."}
+	case status >= 400:
+		return []string{"Correct the request and send it again."}
+	}
+	return nil
+}
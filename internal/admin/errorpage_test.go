@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+)
+
+func TestRenderProblem_JSON(t *testing.T) {
+	req := reqWithAuth("GET", "/sites/docs.json", nil, auth.Identity{})
+	req.SetPathValue("site", "docs")
+	req = req.WithContext(httplog.WithRequestID(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+	RenderError(rec, req, http.StatusForbidden, "forbidden")
+
+	var got problem.Details
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != problem.Forbidden || got.RequestID != "req-1" || got.Retryable {
+		t.Errorf("problem = %+v", got)
+	}
+	if !slices.ContainsFunc(got.Actions, func(a string) bool { return strings.Contains(a, "capability for the site docs") }) {
+		t.Errorf("actions = %q, want one naming the site", got.Actions)
+	}
+}
+
+func TestRenderProblem_HTML(t *testing.T) {
+	req := reqWithAuth("GET", "/sites", nil, auth.Identity{})
+	req = req.WithContext(httplog.WithRequestID(req.Context(), "req-2"))
+	rec := httptest.NewRecorder()
+	RenderError(rec, req, http.StatusInternalServerError, "listing sites")
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`aria-labelledby="error-title"`,
+		`role="alert"`,
+		"listing sites",
+		"What you can do",
+		`href="/sites"`,
+		"Try again",
+		"<code>req-2</code>",
+		"<code>internal_error</code>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("error page lacks %q", want)
+		}
+	}
+}
+
+func TestErrorDescription(t *testing.T) {
+	if got := errorDescription(http.StatusForbidden, "forbidden"); got != "Your tspages capabilities don't allow this." {
+		t.Errorf("bare status text was not replaced: %q", got)
+	}
+	if got := errorDescription(http.StatusBadRequest, "query is too long"); got != "query is too long" {
+		t.Errorf("specific message was replaced: %q", got)
+	}
+}
+
+func TestErrorActions_RetryAfter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Retry-After", "30")
+	got := errorActions(rec, httptest.NewRequest("GET", "/", nil), http.StatusServiceUnavailable, problem.Unavailable)
+	if len(got) != 1 || got[0] != "Try again in 30 seconds." {
+		t.Errorf("actions = %q", got)
+	}
+}
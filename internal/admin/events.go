@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+)
+
+// --- GET /events ---
+
+// eventStreamBuffer is the number of events queued per client. A client that
+// falls further behind misses events rather than slowing down publishers.
+const eventStreamBuffer = 64
+
+// eventStreamKeepalive is how often an idle stream sends a comment so
+// proxies do not close the connection.
+const eventStreamKeepalive = 30 * time.Second
+
+// EventsHandler streams platform events as server-sent events. Callers
+// receive events for sites they can view; platform events without a site,
+// such as health changes, are sent to admins only.
+type EventsHandler struct {
+	events *events.Bus
+}
+
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		RenderError(w, r, http.StatusNotFound, "event stream not available")
+		return
+	}
+	pattern := r.URL.Query().Get("type")
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		RenderError(w, r, http.StatusBadRequest, "invalid type pattern")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	ch := make(chan events.Event, eventStreamBuffer)
+	unsubscribe := h.events.Subscribe(pattern, func(e events.Event) {
+		if !canSeeEvent(caps, e) {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventStreamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func canSeeEvent(caps []auth.Cap, e events.Event) bool {
+	if e.Site == "" {
+		return auth.HasAdminCap(caps)
+	}
+	return auth.CanView(caps, e.Site)
+}
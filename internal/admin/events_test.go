@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// readEvent reads one server-sent event from sc, skipping comments.
+func readEvent(t *testing.T, sc *bufio.Scanner) (string, events.Event) {
+	t.Helper()
+	var typ string
+	var e events.Event
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && typ != "":
+			return typ, e
+		}
+	}
+	t.Fatalf("stream ended: %v", sc.Err())
+	return "", e
+}
+
+func TestEventsHandler_StreamsVisibleEvents(t *testing.T) {
+	bus := events.New()
+	h := &EventsHandler{events: bus}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.ContextWithCaps(r.Context(), viewerCaps)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	// The viewer can see docs only; platform events are for admins.
+	bus.Publish(events.Event{Type: events.SiteCreated, Site: "other"})
+	bus.Publish(events.Event{Type: events.HealthDegraded})
+	bus.Publish(events.Event{
+		Type:   events.DeploySuccess,
+		Site:   "docs",
+		Data:   map[string]any{"deployment_id": "abc12345"},
+		Config: storage.SiteConfig{WebhookSecret: "whsec_hidden"},
+	})
+
+	sc := bufio.NewScanner(resp.Body)
+	typ, e := readEvent(t, sc)
+	if typ != events.DeploySuccess || e.Site != "docs" || e.Data["deployment_id"] != "abc12345" {
+		t.Errorf("got %s %+v", typ, e)
+	}
+	if e.Config.WebhookSecret != "" {
+		t.Error("site config leaked into the stream")
+	}
+}
+
+func TestEventsHandler_TypeFilter(t *testing.T) {
+	bus := events.New()
+	h := &EventsHandler{events: bus}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.ContextWithCaps(r.Context(), adminCaps)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events?type=health.*", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	bus.Publish(events.Event{Type: events.DeploySuccess, Site: "docs"})
+	bus.Publish(events.Event{Type: events.HealthRecovered})
+
+	typ, _ := readEvent(t, bufio.NewScanner(resp.Body))
+	if typ != events.HealthRecovered {
+		t.Errorf("type = %q, want %q", typ, events.HealthRecovered)
+	}
+}
+
+func TestEventsHandler_InvalidPattern(t *testing.T) {
+	h := &EventsHandler{events: events.New()}
+	req := reqWithAuth("GET", "/events?type=[", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCreateSiteHandler_PublishesEvent(t *testing.T) {
+	store := setupStore(t)
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("site.*", func(e events.Event) { got = append(got, e) })
+	hs := NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, bus, Options{})
+
+	rec := httptest.NewRecorder()
+	hs.CreateSite.ServeHTTP(rec, formReqWithAuth("/sites", "name=newsite", adminCaps, adminID))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if len(got) != 1 || got[0].Type != events.SiteCreated || got[0].Site != "newsite" || got[0].Data["created_by"] != "Admin" {
+		t.Errorf("events = %+v", got)
+	}
+}
+
+func TestHealthHandler_PublishesTransitions(t *testing.T) {
+	store := setupStore(t)
+	recorder, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.New()
+	var got []string
+	bus.Subscribe("health.*", func(e events.Event) { got = append(got, e.Type) })
+	h := NewHealthHandler(store, recorder, bus, nil)
+
+	check := func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	}
+	check()
+	if len(got) != 0 {
+		t.Fatalf("healthy start published %v", got)
+	}
+
+	// A closed database fails its ping.
+	recorder.Close()
+	check()
+	check()
+	h.recorder = nil
+	check()
+
+	want := []string{events.HealthDegraded, events.HealthRecovered}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
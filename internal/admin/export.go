@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// analyticsArchiveEntry holds a site's analytics events in a site archive,
+// one JSON object per line.
+const analyticsArchiveEntry = "analytics.jsonl"
+
+// analyticsImportBatch is the number of events written per transaction when
+// importing analytics.
+const analyticsImportBatch = 500
+
+// --- GET /sites/{site}/export ---
+
+type ExportSiteHandler struct{ handlerDeps }
+
+func (h *ExportSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.IsAdmin(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	withAnalytics, _ := strconv.ParseBool(r.URL.Query().Get("analytics"))
+	if withAnalytics && h.recorder == nil {
+		RenderError(w, r, http.StatusServiceUnavailable, "analytics not configured")
+		return
+	}
+
+	filename := siteName + "-" + time.Now().UTC().Format("20060102") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if err := h.writeArchive(w, siteName, withAnalytics); err != nil {
+		// Headers are already sent; the client sees a truncated archive,
+		// which the import rejects.
+		slog.ErrorContext(r.Context(), "exporting site failed", "site", siteName, "err", err)
+	}
+}
+
+func (h *ExportSiteHandler) writeArchive(w io.Writer, site string, withAnalytics bool) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := h.store.WriteSiteArchive(tw, site); err != nil {
+		return err
+	}
+	if withAnalytics {
+		if err := writeAnalyticsEntry(tw, h.recorder, site); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeAnalyticsEntry adds the site's analytics to tw. The events are
+// buffered first, since tar headers need the entry size up front.
+func writeAnalyticsEntry(tw *tar.Writer, recorder *analytics.Recorder, site string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := recorder.ExportSite(site, func(e analytics.Event) error {
+		return enc.Encode(e)
+	}); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     analyticsArchiveEntry,
+		Mode:     0644,
+		Size:     int64(buf.Len()),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, &buf)
+	return err
+}
+
+// --- POST /sites/{site}/import ---
+
+type ImportSiteHandler struct {
+	handlerDeps
+	ensurer SiteEnsurer
+}
+
+func (h *ImportSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteNameForSuffix(siteName, h.dnsSuffix) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanCreateSite(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	// Analytics are imported only once the site itself was restored, so a
+	// failed import leaves no stray events behind.
+	var events []analytics.Event
+	info, err := h.store.ImportSiteArchive(r.Body, siteName, func(name string, body io.Reader) error {
+		if name != analyticsArchiveEntry || h.recorder == nil {
+			return nil
+		}
+		sc := bufio.NewScanner(body)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var e analytics.Event
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				return err
+			}
+			e.Site = siteName
+			events = append(events, e)
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrSiteExists) {
+			RenderProblem(w, r, http.StatusConflict, problem.SiteExists, "site already exists")
+			return
+		}
+		slog.WarnContext(r.Context(), "importing site failed", "site", siteName, "err", err)
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidUpload, "invalid site archive")
+		return
+	}
+	reindexSite(r.Context(), h.index, siteName)
+
+	for start := 0; start < len(events); start += analyticsImportBatch {
+		end := min(start+analyticsImportBatch, len(events))
+		if err := h.recorder.Import(events[start:end]); err != nil {
+			slog.WarnContext(r.Context(), "site imported but analytics failed", "site", siteName, "err", err)
+			break
+		}
+	}
+
+	if err := h.ensurer.EnsureServer(siteName); err != nil {
+		slog.WarnContext(r.Context(), "site imported but server failed to start", "site", siteName, "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "site imported", "site", siteName, "from", info.Name, "events", len(events))
+
+	if wantsJSON(r) {
+		writeJSON(w, map[string]any{
+			"name":                 siteName,
+			"active_deployment_id": info.ActiveDeploymentID,
+			"analytics_events":     len(events),
+		})
+		return
+	}
+
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"sort"
 	"time"
 
 	"tspages/internal/auth"
+	"tspages/internal/bytesize"
+	"tspages/internal/deployindex"
 	"tspages/internal/storage"
 )
 
@@ -50,12 +51,6 @@ type atomXMLContent struct {
 	Body string `xml:",chardata"`
 }
 
-// deploymentWithSite pairs a deployment with its site name for sorting.
-type deploymentWithSite struct {
-	storage.DeploymentInfo
-	Site string
-}
-
 // --- GET /feed.atom ---
 
 type FeedHandler struct{ handlerDeps }
@@ -74,25 +69,17 @@ func (h *FeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var all []deploymentWithSite
-	for _, s := range sites {
-		if !auth.CanDeploy(caps, s.Name) {
-			continue
-		}
-		deps, err := h.store.ListDeployments(s.Name)
-		if err != nil {
-			continue
-		}
-		for _, d := range deps {
-			all = append(all, deploymentWithSite{DeploymentInfo: d, Site: s.Name})
-		}
+	filter, err := deploymentFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	sort.Slice(all, func(i, j int) bool {
-		return all[i].CreatedAt.After(all[j].CreatedAt)
-	})
-	if len(all) > feedMaxEntries {
-		all = all[:feedMaxEntries]
+	q := filteredQuery(caps, sites, filter)
+	q.Limit = feedMaxEntries
+	all, _, err := h.listDeployments(q)
+	if err != nil {
+		http.Error(w, "listing deployments", http.StatusInternalServerError)
+		return
 	}
 
 	entries := make([]atomXMLEntry, len(all))
@@ -107,14 +94,20 @@ func (h *FeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		updated = time.Now().UTC().Format(time.RFC3339)
 	}
 
+	// Each filter is a feed of its own, with its own ID.
+	title, query := "tspages deployments", ""
+	if !filter.IsZero() {
+		title += ": " + describeFilter(filter)
+		query = "?" + filterQuery(filter)
+	}
 	feed := atomXMLFeed{
 		XMLNS:   "http://www.w3.org/2005/Atom",
-		Title:   "tspages deployments",
-		ID:      fmt.Sprintf("https://%s/feed.atom", r.Host),
+		Title:   title,
+		ID:      fmt.Sprintf("https://%s/feed.atom%s", r.Host, query),
 		Updated: updated,
 		Links: []atomXMLLink{
-			{Href: fmt.Sprintf("https://%s/feed.atom", r.Host), Rel: "self", Type: "application/atom+xml"},
-			{Href: fmt.Sprintf("https://%s/deployments", r.Host), Rel: "alternate", Type: "text/html"},
+			{Href: fmt.Sprintf("https://%s/feed.atom%s", r.Host, query), Rel: "self", Type: "application/atom+xml"},
+			{Href: fmt.Sprintf("https://%s/deployments%s", r.Host, query), Rel: "alternate", Type: "text/html"},
 		},
 		Entries: entries,
 	}
@@ -139,22 +132,15 @@ func (h *SiteFeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deps, err := h.store.ListDeployments(siteName)
+	deps, _, err := h.listDeployments(deployindex.Query{Sites: []string{siteName}, Limit: feedMaxEntries})
 	if err != nil {
 		http.Error(w, "listing deployments", http.StatusInternalServerError)
 		return
 	}
 
-	sort.Slice(deps, func(i, j int) bool {
-		return deps[i].CreatedAt.After(deps[j].CreatedAt)
-	})
-	if len(deps) > feedMaxEntries {
-		deps = deps[:feedMaxEntries]
-	}
-
 	entries := make([]atomXMLEntry, len(deps))
 	for i, d := range deps {
-		entries[i] = deploymentToEntry(siteName, d, h.dnsSuffix, r.Host)
+		entries[i] = deploymentToEntry(siteName, d.DeploymentInfo, h.dnsSuffix, r.Host)
 	}
 
 	var updated string
@@ -186,17 +172,31 @@ func deploymentToEntry(site string, d storage.DeploymentInfo, dnsSuffix, host st
 		author = "unknown"
 	}
 
+	links := []atomXMLLink{
+		{Href: fmt.Sprintf("https://%s/sites/%s/deployments/%s", host, site, d.ID), Rel: "alternate", Type: "text/html"},
+	}
+	body := fmt.Sprintf("Deployed to %s.%s by %s (%s)", site, dnsSuffix, author, bytesize.Format(d.SizeBytes))
+	if b := d.Build; b != nil {
+		if b.Commit != "" {
+			body += " from commit " + b.ShortCommit()
+		}
+		if b.Branch != "" {
+			body += " on " + b.Branch
+		}
+		if b.BuildURL != "" {
+			links = append(links, atomXMLLink{Href: b.BuildURL, Rel: "related", Type: "text/html"})
+		}
+	}
+
 	return atomXMLEntry{
 		Title:   fmt.Sprintf("Deployed %s (%s)", site, d.ID),
 		ID:      fmt.Sprintf("https://%s/sites/%s/deployments/%s", host, site, d.ID),
 		Updated: updated,
 		Author:  atomXMLAuthor{Name: author},
-		Links: []atomXMLLink{
-			{Href: fmt.Sprintf("https://%s/sites/%s/deployments/%s", host, site, d.ID), Rel: "alternate", Type: "text/html"},
-		},
+		Links:   links,
 		Content: atomXMLContent{
 			Type: "text",
-			Body: fmt.Sprintf("Deployed to %s.%s by %s (%s)", site, dnsSuffix, author, formatBytes(d.SizeBytes)),
+			Body: body,
 		},
 	}
 }
@@ -194,7 +194,7 @@ func TestFeedHandler_EmptyStore(t *testing.T) {
 	store := storage.New(t.TempDir())
 	recorder := setupRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/feed.atom", adminCaps, adminID)
 	rec := httptest.NewRecorder()
@@ -226,7 +226,7 @@ func TestSiteFeedHandler_SiteWithNoDeployments(t *testing.T) {
 
 	recorder := setupRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/sites/empty/feed.atom", adminCaps, adminID)
 	req.SetPathValue("site", "empty")
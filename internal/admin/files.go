@@ -0,0 +1,256 @@
+package admin
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// filePreviewLimit caps the bytes of a text file shown on the files page.
+const filePreviewLimit = 256 << 10
+
+// fileContentPolicy is sent with file contents, so that served HTML and SVG
+// cannot run scripts with the admin panel's origin.
+const fileContentPolicy = "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'; sandbox"
+
+// FileEntry is a file or directory in a listing of a deployment's files.
+type FileEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+	// Size is the size of a file, or the total size of a directory's files.
+	Size int64 `json:"size"`
+	// Files is the number of files in a directory, at any depth.
+	Files int `json:"files,omitempty"`
+}
+
+// SiteFilesResponse is the JSON response for GET /sites/{site}/files.
+type SiteFilesResponse struct {
+	Site         string `json:"site"`
+	DeploymentID string `json:"deployment_id"`
+	// Path is the directory listed, or the file shown, relative to the
+	// content root. The root itself is "".
+	Path    string            `json:"path"`
+	Entries []FileEntry       `json:"entries,omitempty"`
+	File    *storage.FileInfo `json:"file,omitempty"`
+}
+
+// --- GET /sites/{site}/files ---
+
+// SiteFilesHandler browses the files of a site's active deployment. The
+// path query parameter names a directory to list or a file to show; text
+// files are shown inline and images are previewed.
+type SiteFilesHandler struct{ handlerDeps }
+
+func (h *SiteFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := trimSuffix(r.PathValue("site"))
+	id, ok := h.activeDeployment(w, r, siteName)
+	if !ok {
+		return
+	}
+
+	files, err := h.store.ListDeploymentFiles(siteName, id)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing files")
+		return
+	}
+	dir := strings.Trim(path.Clean("/"+r.URL.Query().Get("path")), "/")
+	resp := SiteFilesResponse{Site: siteName, DeploymentID: id, Path: dir}
+	if i := slices.IndexFunc(files, func(f storage.FileInfo) bool { return f.Path == dir }); i >= 0 {
+		resp.File = &files[i]
+	} else {
+		resp.Entries = listDir(files, dir)
+		if dir != "" && len(resp.Entries) == 0 {
+			RenderError(w, r, http.StatusNotFound, "no such file or directory")
+			return
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, resp)
+		return
+	}
+
+	var preview, text string
+	var truncated bool
+	if resp.File != nil {
+		preview, text, truncated = h.preview(siteName, id, resp.File.Path)
+	}
+	caps := auth.CapsFromContext(r.Context())
+	renderPage(w, r, siteFilesTmpl, "sites", struct {
+		SiteFilesResponse
+		User      UserInfo
+		Crumbs    []FileEntry
+		Preview   string
+		Text      string
+		Truncated bool
+	}{resp, userInfo(auth.IdentityFromContext(r.Context()), caps), crumbs(dir), preview, text, truncated})
+}
+
+// preview returns how the file at name can be previewed: "text" with its
+// leading content, "image", or "" if it cannot be.
+func (h *SiteFilesHandler) preview(site, id, name string) (kind, text string, truncated bool) {
+	if strings.HasPrefix(mime.TypeByExtension(path.Ext(name)), "image/") {
+		return "image", "", false
+	}
+	f, err := h.store.OpenDeploymentFile(site, id, name)
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, filePreviewLimit+1))
+	if err != nil || !isText(data) {
+		return "", "", false
+	}
+	if len(data) > filePreviewLimit {
+		return "text", string(data[:filePreviewLimit]), true
+	}
+	return "text", string(data), false
+}
+
+// --- GET /sites/{site}/files/{path...} ---
+
+// SiteFileHandler serves a file of a site's active deployment, for the
+// files page to preview and download. Text is served as plain text, and a
+// restrictive content security policy keeps HTML and SVG from running
+// scripts.
+type SiteFileHandler struct{ handlerDeps }
+
+func (h *SiteFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	id, ok := h.activeDeployment(w, r, siteName)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("path")
+	f, err := h.store.OpenDeploymentFile(siteName, id, name)
+	if err != nil {
+		RenderError(w, r, http.StatusNotFound, "file not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		RenderError(w, r, http.StatusNotFound, "file not found")
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if !strings.HasPrefix(contentType, "image/") {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			RenderError(w, r, http.StatusInternalServerError, "reading file")
+			return
+		}
+		contentType = "application/octet-stream"
+		if isText(head[:n]) {
+			contentType = "text/plain; charset=utf-8"
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", fileContentPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	}
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// activeDeployment checks that the caller may browse the site's files and
+// returns its active deployment, or responds with an error.
+func (d *handlerDeps) activeDeployment(w http.ResponseWriter, r *http.Request, site string) (string, bool) {
+	if !storage.ValidSiteName(site) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return "", false
+	}
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.IsAdmin(caps, site) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return "", false
+	}
+	id, err := d.store.CurrentDeployment(site)
+	if err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.DeploymentNotFound, "site has no active deployment")
+		return "", false
+	}
+	return id, true
+}
+
+// listDir returns the entries of dir among files, directories first.
+func listDir(files []storage.FileInfo, dir string) []FileEntry {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	var entries []FileEntry
+	dirs := make(map[string]int)
+	for _, f := range files {
+		rest, ok := strings.CutPrefix(f.Path, prefix)
+		if !ok {
+			continue
+		}
+		name, _, nested := strings.Cut(rest, "/")
+		if !nested {
+			entries = append(entries, FileEntry{Name: name, Path: f.Path, Size: f.Size})
+			continue
+		}
+		i, seen := dirs[name]
+		if !seen {
+			i = len(entries)
+			dirs[name] = i
+			entries = append(entries, FileEntry{Name: name, Path: prefix + name, Dir: true})
+		}
+		entries[i].Size += f.Size
+		entries[i].Files++
+	}
+	slices.SortStableFunc(entries, func(a, b FileEntry) int {
+		if a.Dir != b.Dir {
+			if a.Dir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return entries
+}
+
+// crumbs returns the directories leading to p, for breadcrumb navigation.
+func crumbs(p string) []FileEntry {
+	if p == "" {
+		return nil
+	}
+	var out []FileEntry
+	parts := strings.Split(p, "/")
+	for i, name := range parts {
+		out = append(out, FileEntry{Name: name, Path: strings.Join(parts[:i+1], "/"), Dir: i < len(parts)-1})
+	}
+	return out
+}
+
+// isText reports whether data looks like text: valid UTF-8 without NUL
+// bytes. A truncated trailing rune is allowed.
+func isText(data []byte) bool {
+	if slices.Contains(data, 0) {
+		return false
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return len(data) < utf8.UTFMax && !utf8.FullRune(data)
+		}
+		data = data[size:]
+	}
+	return true
+}
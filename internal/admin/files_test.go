@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func setupFiles(t *testing.T) *Handlers {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	dir, _ := store.CreateDeployment("docs", "aaa11111")
+	contentDir := filepath.Join(dir, "content")
+	os.MkdirAll(filepath.Join(contentDir, "assets", "img"), 0755)
+	os.WriteFile(filepath.Join(contentDir, "index.html"), []byte("<script>alert(1)</script>"), 0644)
+	os.WriteFile(filepath.Join(contentDir, "assets", "style.css"), []byte("body{}"), 0644)
+	os.WriteFile(filepath.Join(contentDir, "assets", "img", "logo.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+	os.WriteFile(filepath.Join(contentDir, "font.woff2"), []byte("wOF2\x00\x01"), 0644)
+	store.MarkComplete("docs", "aaa11111")
+	store.ActivateDeployment("docs", "aaa11111")
+	return NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
+}
+
+func filesRequest(target string, caps []auth.Cap) *http.Request {
+	req := reqWithAuth("GET", target, caps, adminID)
+	req.SetPathValue("site", "docs")
+	return req
+}
+
+func TestSiteFilesHandler_ListsDirectories(t *testing.T) {
+	hs := setupFiles(t)
+	req := filesRequest("/sites/docs/files?path=assets", adminCaps)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.SiteFiles.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp SiteFilesResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	want := []FileEntry{
+		{Name: "img", Path: "assets/img", Dir: true, Size: 8, Files: 1},
+		{Name: "style.css", Path: "assets/style.css", Size: 6},
+	}
+	if resp.DeploymentID != "aaa11111" || len(resp.Entries) != len(want) {
+		t.Fatalf("resp = %+v", resp)
+	}
+	for i := range want {
+		if resp.Entries[i] != want[i] {
+			t.Errorf("entries[%d] = %+v, want %+v", i, resp.Entries[i], want[i])
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	hs.SiteFiles.ServeHTTP(rec, filesRequest("/sites/docs/files?path=missing", adminCaps))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing path status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSiteFilesHandler_PreviewsText(t *testing.T) {
+	hs := setupFiles(t)
+	rec := httptest.NewRecorder()
+	hs.SiteFiles.ServeHTTP(rec, filesRequest("/sites/docs/files?path=index.html", adminCaps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Error("page does not show the escaped file content")
+	}
+
+	rec = httptest.NewRecorder()
+	hs.SiteFiles.ServeHTTP(rec, filesRequest("/sites/docs/files?path=font.woff2", adminCaps))
+	if !strings.Contains(rec.Body.String(), "No preview") {
+		t.Error("binary file has a preview")
+	}
+}
+
+func TestSiteFileHandler_ServesContent(t *testing.T) {
+	hs := setupFiles(t)
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"index.html", "text/plain; charset=utf-8"},
+		{"assets/img/logo.png", "image/png"},
+		{"font.woff2", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		req := filesRequest("/sites/docs/files/"+tt.path, adminCaps)
+		req.SetPathValue("path", tt.path)
+		rec := httptest.NewRecorder()
+		hs.SiteFile.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d", tt.path, rec.Code)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: content-type = %q, want %q", tt.path, ct, tt.contentType)
+		}
+		if !strings.Contains(rec.Header().Get("Content-Security-Policy"), "sandbox") {
+			t.Errorf("%s: no sandboxing content security policy", tt.path)
+		}
+	}
+
+	for _, name := range []string{"../manifest.json", "assets", "missing.txt"} {
+		req := filesRequest("/sites/docs/files/"+name, adminCaps)
+		req.SetPathValue("path", name)
+		rec := httptest.NewRecorder()
+		hs.SiteFile.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", name, rec.Code)
+		}
+	}
+}
+
+func TestSiteFilesHandler_AdminOnly(t *testing.T) {
+	hs := setupFiles(t)
+	deployer := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+	rec := httptest.NewRecorder()
+	hs.SiteFiles.ServeHTTP(rec, filesRequest("/sites/docs/files", deployer))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("files status = %d, want 403", rec.Code)
+	}
+	req := filesRequest("/sites/docs/files/index.html", deployer)
+	req.SetPathValue("path", "index.html")
+	rec = httptest.NewRecorder()
+	hs.SiteFile.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("file status = %d, want 403", rec.Code)
+	}
+}
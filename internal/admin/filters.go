@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/storage"
+)
+
+// deploymentFilter reads the filter of the deployments page and Atom feed
+// from query parameters: site names or patterns, repeated or separated by
+// commas, a deployer, and a type. status=failed is short for
+// type=deploy.failed.
+func deploymentFilter(q url.Values) (storage.DeploymentFilter, error) {
+	var f storage.DeploymentFilter
+	for _, v := range q["site"] {
+		for s := range strings.SplitSeq(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				f.Sites = append(f.Sites, s)
+			}
+		}
+	}
+	f.Deployer = strings.TrimSpace(q.Get("deployer"))
+	f.Type = q.Get("type")
+	if f.Type == "" && q.Get("status") == statusFailed {
+		f.Type = storage.FilterTypeFailed
+	}
+	return f, f.Validate()
+}
+
+// filterQuery encodes f as the query string deploymentFilter reads.
+func filterQuery(f storage.DeploymentFilter) string {
+	q := url.Values{}
+	if len(f.Sites) > 0 {
+		q.Set("site", strings.Join(f.Sites, ","))
+	}
+	if f.Deployer != "" {
+		q.Set("deployer", f.Deployer)
+	}
+	if f.Type != "" {
+		q.Set("type", f.Type)
+	}
+	return q.Encode()
+}
+
+// describeFilter summarizes f for feed titles, such as
+// "failed deployments of *-prod by Alice".
+func describeFilter(f storage.DeploymentFilter) string {
+	desc := "deployments"
+	switch f.Type {
+	case storage.FilterTypeSuccess:
+		desc = "successful deployments"
+	case storage.FilterTypeFailed:
+		desc = "failed deployments"
+	}
+	if len(f.Sites) > 0 {
+		desc += " of " + strings.Join(f.Sites, ", ")
+	}
+	if f.Deployer != "" {
+		desc += " by " + f.Deployer
+	}
+	return desc
+}
+
+// filteredQuery returns the index query for the deployments f selects
+// among sites the caller may deploy to.
+func filteredQuery(caps []auth.Cap, sites []storage.SiteInfo, f storage.DeploymentFilter) deployindex.Query {
+	q := deployindex.Query{
+		Sites:     make([]string, 0, len(sites)),
+		Failed:    f.Type == storage.FilterTypeFailed,
+		Succeeded: f.Type == storage.FilterTypeSuccess,
+		CreatedBy: f.Deployer,
+	}
+	for _, s := range sites {
+		if auth.CanDeploy(caps, s.Name) && f.MatchesSite(s.Name) {
+			q.Sites = append(q.Sites, s.Name)
+		}
+	}
+	return q
+}
+
+// SavedFilterResponse is a saved filter with the links it stands for.
+type SavedFilterResponse struct {
+	storage.SavedFilter
+	URL     string `json:"url"`
+	FeedURL string `json:"feed_url"`
+}
+
+func savedFilterResponse(f storage.SavedFilter) SavedFilterResponse {
+	query := filterQuery(f.DeploymentFilter)
+	if query != "" {
+		query = "?" + query
+	}
+	return SavedFilterResponse{SavedFilter: f, URL: "/deployments" + query, FeedURL: "/feed.atom" + query}
+}
+
+// savedFilters returns the filters the caller saved, or none if they have
+// no login name to save them under.
+func (d *handlerDeps) savedFilters(r *http.Request) ([]SavedFilterResponse, error) {
+	resp := []SavedFilterResponse{}
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if login == "" {
+		return resp, nil
+	}
+	filters, err := d.store.SavedFilters(login)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		resp = append(resp, savedFilterResponse(f))
+	}
+	return resp, nil
+}
+
+// --- GET /deployments/filters ---
+
+// SavedFiltersHandler lists the caller's saved deployment filters as JSON.
+type SavedFiltersHandler struct{ handlerDeps }
+
+func (h *SavedFiltersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.HasDeployCap(auth.CapsFromContext(r.Context())) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	filters, err := h.savedFilters(r)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "reading saved filters")
+		return
+	}
+	writeJSON(w, filters)
+}
+
+// --- POST /deployments/filters ---
+
+// SaveFilterHandler saves a deployment filter for the caller. The form
+// value name names it; the filter is read from the same fields as the
+// deployments page's query string.
+type SaveFilterHandler struct{ handlerDeps }
+
+func (h *SaveFilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.HasDeployCap(auth.CapsFromContext(r.Context())) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if login == "" {
+		RenderError(w, r, http.StatusForbidden, "saved filters require a login name")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		RenderError(w, r, http.StatusBadRequest, "invalid form")
+		return
+	}
+	f, err := deploymentFilter(r.PostForm)
+	if err != nil {
+		RenderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	saved, err := h.store.SaveFilter(login, storage.SavedFilter{Name: r.PostForm.Get("name"), DeploymentFilter: f})
+	if err != nil {
+		RenderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := savedFilterResponse(saved)
+	if wantsJSON(r) {
+		writeJSON(w, resp)
+		return
+	}
+	http.Redirect(w, r, resp.URL, http.StatusSeeOther)
+}
+
+// --- POST /deployments/filters/{id}/delete ---
+
+// DeleteSavedFilterHandler removes one of the caller's saved filters.
+type DeleteSavedFilterHandler struct{ handlerDeps }
+
+func (h *DeleteSavedFilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if login == "" {
+		RenderError(w, r, http.StatusForbidden, "saved filters require a login name")
+		return
+	}
+	id := r.PathValue("id")
+	if err := h.store.DeleteSavedFilter(login, id); err != nil {
+		if errors.Is(err, storage.ErrFilterNotFound) {
+			RenderError(w, r, http.StatusNotFound, "saved filter not found")
+			return
+		}
+		RenderError(w, r, http.StatusInternalServerError, "deleting saved filter")
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/deployments", http.StatusSeeOther)
+}
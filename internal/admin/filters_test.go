@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestDeploymentFilter(t *testing.T) {
+	f, err := deploymentFilter(url.Values{"site": {"docs, *-prod", "demo"}, "deployer": {" Alice "}, "status": {"failed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(f.Sites, []string{"docs", "*-prod", "demo"}) || f.Deployer != "Alice" || f.Type != storage.FilterTypeFailed {
+		t.Errorf("filter = %+v", f)
+	}
+	if got, want := filterQuery(f), "deployer=Alice&site=docs%2C%2A-prod%2Cdemo&type=deploy.failed"; got != want {
+		t.Errorf("filterQuery() = %q, want %q", got, want)
+	}
+	if _, err := deploymentFilter(url.Values{"type": {"site.created"}}); err == nil {
+		t.Error("accepted an unknown type")
+	}
+}
+
+func listDeploymentIDs(t *testing.T, hs *Handlers, target string) []string {
+	t.Helper()
+	req := reqWithAuth("GET", target, adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body = %s", target, rec.Code, rec.Body.String())
+	}
+	var resp DeploymentsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, d := range resp.Deployments {
+		ids = append(ids, d.Site+"/"+d.ID)
+	}
+	return ids
+}
+
+func TestDeploymentsHandler_Filter(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.CreateDeployment("docs", "ddd44444")
+	store.WriteManifest("docs", "ddd44444", storage.Manifest{
+		Site: "docs", ID: "ddd44444", CreatedBy: "Bob", CreatedAt: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC),
+	})
+	store.MarkFailed("docs", "ddd44444", "invalid tspages.toml")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"site=d*", []string{"docs/ddd44444", "demo/bbb22222", "docs/aaa11111"}},
+		{"site=staging,demo", []string{"demo/bbb22222", "staging/ccc33333"}},
+		{"deployer=bob", []string{"docs/ddd44444", "demo/bbb22222"}},
+		{"deployer=Bob&type=deploy.success", []string{"demo/bbb22222"}},
+		{"site=docs&type=deploy.failed", []string{"docs/ddd44444"}},
+		{"site=nothing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := listDeploymentIDs(t, hs, "/deployments?"+tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	req := reqWithAuth("GET", "/deployments?site=%5Bdocs", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid pattern: status = %d, want 400", rec.Code)
+	}
+
+	req = reqWithAuth("GET", "/deployments?site=nothing", adminCaps, adminID)
+	rec = httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "No deployments match this filter.") {
+		t.Error("empty filter result lacks notice")
+	}
+}
+
+func TestDeploymentsHandler_FilterRespectsAccess(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	caps := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+	req := reqWithAuth("GET", "/deployments?site=*", caps, viewerID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	var resp DeploymentsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Deployments) != 1 || resp.Deployments[0].Site != "docs" {
+		t.Errorf("deployments = %+v", resp.Deployments)
+	}
+}
+
+func TestFeedHandler_Filter(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/feed.atom?site=docs&deployer=alice", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.Feed.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if len(feed.Entries) != 1 || feed.Entries[0].Author.Name != "Alice" {
+		t.Errorf("entries = %+v", feed.Entries)
+	}
+	if feed.Title != "tspages deployments: deployments of docs by alice" {
+		t.Errorf("title = %q", feed.Title)
+	}
+	if !strings.HasSuffix(feed.ID, "/feed.atom?deployer=alice&site=docs") {
+		t.Errorf("id = %q, want the filter's own ID", feed.ID)
+	}
+
+	req = reqWithAuth("GET", "/feed.atom?type=nope", adminCaps, adminID)
+	rec = httptest.NewRecorder()
+	hs.Feed.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid type: status = %d, want 400", rec.Code)
+	}
+}
+
+// --- /deployments/filters ---
+
+func TestSavedFilters(t *testing.T) {
+	hs, _ := setupHandlers(t)
+
+	form := url.Values{"name": {"Production"}, "site": {"*-prod"}, "type": {"deploy.failed"}}
+	req := formReqWithAuth("/deployments/filters", form.Encode(), adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.SaveFilter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("save: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if loc := rec.Header().Get("Location"); loc != "/deployments?site=%2A-prod&type=deploy.failed" {
+		t.Errorf("save redirects to %q", loc)
+	}
+
+	req = reqWithAuth("GET", "/deployments/filters", adminCaps, adminID)
+	rec = httptest.NewRecorder()
+	hs.SavedFilters.ServeHTTP(rec, req)
+	var filters []SavedFilterResponse
+	if err := json.NewDecoder(rec.Body).Decode(&filters); err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 || filters[0].Name != "Production" || filters[0].FeedURL != "/feed.atom?site=%2A-prod&type=deploy.failed" {
+		t.Fatalf("filters = %+v", filters)
+	}
+
+	// Filters belong to the user who saved them.
+	req = reqWithAuth("GET", "/deployments/filters", []auth.Cap{{Access: "deploy"}}, viewerID)
+	rec = httptest.NewRecorder()
+	hs.SavedFilters.ServeHTTP(rec, req)
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("other user's filters = %s", body)
+	}
+
+	req = reqWithAuth("GET", "/deployments", adminCaps, adminID)
+	rec = httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "Production") {
+		t.Error("deployments page lacks saved filter")
+	}
+
+	req = reqWithAuth("POST", "/deployments/filters/"+filters[0].ID+"/delete", adminCaps, adminID)
+	req.SetPathValue("id", filters[0].ID)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	hs.DeleteSavedFilter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	hs.DeleteSavedFilter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleting twice: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestSaveFilterHandler_Invalid(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for name, form := range map[string]url.Values{
+		"no name":     {"site": {"docs"}},
+		"bad pattern": {"name": {"x"}, "site": {"[docs"}},
+	} {
+		req := formReqWithAuth("/deployments/filters", form.Encode(), adminCaps, adminID)
+		rec := httptest.NewRecorder()
+		hs.SaveFilter.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	req := formReqWithAuth("/deployments/filters", "name=x", viewerCaps, viewerID)
+	rec := httptest.NewRecorder()
+	hs.SaveFilter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("viewer: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// --- POST /admin/gc ---
+
+// GCHandler runs storage garbage collection on demand and returns the
+// report. With ?dry_run=true it only reports what would be reclaimed.
+type GCHandler struct {
+	store    *storage.Store
+	stateDir string
+}
+
+// NewGCHandler returns a handler that collects garbage in store. stateDir is
+// the directory of per-site tsnet state; empty skips state directories.
+func NewGCHandler(store *storage.Store, stateDir string) *GCHandler {
+	return &GCHandler{store: store, stateDir: stateDir}
+}
+
+func (h *GCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanCollectGarbage(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+	report, err := h.store.CollectGarbage(storage.GCOptions{
+		DryRun:   dryRun,
+		MinAge:   storage.OrphanMinAge,
+		StateDir: h.stateDir,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "collecting garbage", "err", err)
+		RenderError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !dryRun && !report.Empty() {
+		slog.InfoContext(r.Context(), "collected garbage", "bytes", report.ReclaimedBytes,
+			"deployments", len(report.OrphanedDeployments),
+			"state_dirs", len(report.DanglingStateDirs),
+			"files", len(report.UnreferencedFiles))
+	}
+	writeJSON(w, report)
+}
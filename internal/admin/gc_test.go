@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestGCHandler(t *testing.T) {
+	store := setupStore(t)
+	stateDir := t.TempDir()
+	os.MkdirAll(filepath.Join(stateDir, "removed"), 0755)
+	h := NewGCHandler(store, stateDir)
+
+	for _, tt := range []struct {
+		body    string
+		dryRun  bool
+		remains bool
+	}{
+		{"dry_run=true", true, true},
+		{"", false, false},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, formReqWithAuth("/admin/gc", tt.body, []auth.Cap{{Access: "admin"}}, adminID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var report storage.GCReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.DryRun != tt.dryRun || len(report.DanglingStateDirs) != 1 {
+			t.Errorf("report = %+v", report)
+		}
+		_, err := os.Stat(filepath.Join(stateDir, "removed"))
+		if remains := err == nil; remains != tt.remains {
+			t.Errorf("dry_run=%v: state dir remains = %v", tt.dryRun, remains)
+		}
+	}
+}
+
+func TestGCHandler_Forbidden(t *testing.T) {
+	h := NewGCHandler(setupStore(t), "")
+	scoped := []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}
+	for name, caps := range map[string][]auth.Cap{"viewer": viewerCaps, "scoped admin": scoped} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, formReqWithAuth("/admin/gc", "", caps, adminID))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+)
+
+// Series the analytics query API charts, as counts of requests per bucket.
+const (
+	seriesRequests     = "requests"
+	seriesOK           = "ok"
+	seriesClientErrors = "client_errors"
+	seriesServerErrors = "server_errors"
+)
+
+var seriesLabels = map[string]string{
+	seriesRequests:     "Requests",
+	seriesOK:           "Successful requests (1xx-3xx)",
+	seriesClientErrors: "Client errors (4xx)",
+	seriesServerErrors: "Server errors (5xx)",
+}
+
+var seriesNames = []string{seriesRequests, seriesOK, seriesClientErrors, seriesServerErrors}
+
+// maxSeriesPoints caps the buckets of a series, whatever maxDataPoints a
+// query asks for.
+const maxSeriesPoints = 10000
+
+// AnalyticsMetric describes a series of the analytics query API, in the
+// shape the Grafana JSON datasource plugin lists metrics in.
+type AnalyticsMetric struct {
+	Label    string                   `json:"label"`
+	Value    string                   `json:"value"`
+	Payloads []AnalyticsMetricPayload `json:"payloads"`
+}
+
+// AnalyticsMetricPayload is an option of a target, shown by Grafana as a
+// field of the query editor.
+type AnalyticsMetricPayload struct {
+	Label   string                 `json:"label"`
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Options []AnalyticsOptionValue `json:"options,omitempty"`
+}
+
+// AnalyticsOptionValue is a choice of a select payload.
+type AnalyticsOptionValue struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// AnalyticsQueryRequest is the JSON body of POST /analytics/query, as the
+// Grafana JSON datasource plugin sends it.
+type AnalyticsQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64             `json:"intervalMs"`
+	MaxDataPoints int               `json:"maxDataPoints"`
+	Targets       []AnalyticsTarget `json:"targets"`
+}
+
+// AnalyticsTarget asks for one series. Without a site, the series sums
+// every site the caller can view analytics for.
+type AnalyticsTarget struct {
+	Target  string `json:"target"`
+	RefID   string `json:"refId,omitempty"`
+	Hide    bool   `json:"hide,omitempty"`
+	Payload struct {
+		Site string `json:"site,omitempty"`
+	} `json:"payload"`
+}
+
+// AnalyticsSeries is a series in the response of POST /analytics/query.
+// Each datapoint is a count and the Unix time in milliseconds its bucket
+// starts at.
+type AnalyticsSeries struct {
+	Target     string     `json:"target"`
+	RefID      string     `json:"refId,omitempty"`
+	Datapoints [][2]int64 `json:"datapoints"`
+}
+
+// --- GET /analytics/, POST /analytics/metrics ---
+
+// AnalyticsMetricsHandler lists the series of the analytics query API.
+// Grafana's JSON datasource plugin tests a connection with a GET of the
+// datasource URL, so that returns the list too.
+type AnalyticsMetricsHandler struct{ handlerDeps }
+
+func (h *AnalyticsMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.recorder == nil {
+		problem.Write(w, http.StatusServiceUnavailable, problem.Unavailable, "analytics not configured")
+		return
+	}
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.HasAnalyticsCap(caps) {
+		problem.Write(w, http.StatusForbidden, problem.Forbidden, "forbidden")
+		return
+	}
+	viewable, err := h.viewableAnalytics(caps)
+	if err != nil {
+		problem.Write(w, http.StatusInternalServerError, problem.Internal, "listing sites")
+		return
+	}
+
+	site := AnalyticsMetricPayload{Label: "Site", Name: "site", Type: "select"}
+	for _, name := range viewable {
+		site.Options = append(site.Options, AnalyticsOptionValue{Label: name, Value: name})
+	}
+	metrics := make([]AnalyticsMetric, 0, len(seriesNames))
+	for _, name := range seriesNames {
+		metrics = append(metrics, AnalyticsMetric{
+			Label: seriesLabels[name], Value: name, Payloads: []AnalyticsMetricPayload{site},
+		})
+	}
+	writeJSON(w, metrics)
+}
+
+// --- POST /analytics/query ---
+
+// AnalyticsQueryHandler returns time series of requests for the targets
+// of a query, so Grafana can chart tspages traffic through its JSON
+// datasource plugin without access to the analytics database.
+type AnalyticsQueryHandler struct{ handlerDeps }
+
+func (h *AnalyticsQueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.recorder == nil {
+		problem.Write(w, http.StatusServiceUnavailable, problem.Unavailable, "analytics not configured")
+		return
+	}
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.HasAnalyticsCap(caps) {
+		problem.Write(w, http.StatusForbidden, problem.Forbidden, "forbidden")
+		return
+	}
+
+	var req AnalyticsQueryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.BadRequest, "invalid JSON body")
+		return
+	}
+	from, to := req.Range.From, req.Range.To
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		problem.Write(w, http.StatusBadRequest, problem.BadRequest, "range must have a from before its to")
+		return
+	}
+	viewable, err := h.viewableAnalytics(caps)
+	if err != nil {
+		problem.Write(w, http.StatusInternalServerError, problem.Internal, "listing sites")
+		return
+	}
+	for _, t := range req.Targets {
+		if _, ok := seriesLabels[t.Target]; !ok {
+			problem.Write(w, http.StatusBadRequest, problem.BadRequest,
+				fmt.Sprintf("unknown target %q; use one of %v", t.Target, seriesNames))
+			return
+		}
+		if t.Payload.Site != "" && !slices.Contains(viewable, t.Payload.Site) {
+			problem.Write(w, http.StatusForbidden, problem.Forbidden,
+				fmt.Sprintf("no analytics for site %q", t.Payload.Site))
+			return
+		}
+	}
+
+	maxPoints := req.MaxDataPoints
+	if maxPoints <= 0 || maxPoints > maxSeriesPoints {
+		maxPoints = maxSeriesPoints
+	}
+	step := analytics.SeriesStep(from, to, time.Duration(req.IntervalMs)*time.Millisecond, maxPoints)
+
+	// Targets of the same site share a query.
+	bySite := make(map[string][]analytics.StatusTimeBucket)
+	series := make([]AnalyticsSeries, 0, len(req.Targets))
+	for _, t := range req.Targets {
+		if t.Hide {
+			continue
+		}
+		buckets, ok := bySite[t.Payload.Site]
+		if !ok {
+			sites := viewable
+			if t.Payload.Site != "" {
+				sites = []string{t.Payload.Site}
+			}
+			buckets, err = h.recorder.RequestsOverTimeByStatusStep(sites, from, to, step)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_by_status_step", "err", err)
+				problem.Write(w, http.StatusInternalServerError, problem.Internal, "querying analytics")
+				return
+			}
+			bySite[t.Payload.Site] = buckets
+		}
+		s := AnalyticsSeries{Target: t.Target, RefID: t.RefID, Datapoints: make([][2]int64, 0, len(buckets))}
+		if t.Payload.Site != "" {
+			s.Target = fmt.Sprintf("%s{site=%q}", t.Target, t.Payload.Site)
+		}
+		for _, b := range buckets {
+			start, err := time.Parse(time.RFC3339, b.Time)
+			if err != nil {
+				continue
+			}
+			s.Datapoints = append(s.Datapoints, [2]int64{seriesValue(t.Target, b), start.UnixMilli()})
+		}
+		series = append(series, s)
+	}
+	writeJSON(w, series)
+}
+
+// seriesValue returns the count of the series named target in b.
+func seriesValue(target string, b analytics.StatusTimeBucket) int64 {
+	switch target {
+	case seriesOK:
+		return b.OK
+	case seriesClientErrors:
+		return b.ClientErr
+	case seriesServerErrors:
+		return b.ServerErr
+	}
+	return b.OK + b.ClientErr + b.ServerErr
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+)
+
+var docsAnalyticsCaps = []auth.Cap{{Access: "analytics", Sites: []string{"docs"}}}
+
+func analyticsQuery(t *testing.T, h *AnalyticsQueryHandler, body string, caps []auth.Cap) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/analytics/query", strings.NewReader(body))
+	req = req.WithContext(auth.ContextWithCaps(req.Context(), caps))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func queryBody(targets string) string {
+	now := time.Now().UTC()
+	return fmt.Sprintf(`{"range":{"from":%q,"to":%q},"intervalMs":60000,"maxDataPoints":500,"targets":[%s]}`,
+		now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Minute).Format(time.RFC3339), targets)
+}
+
+func TestAnalyticsQueryHandler(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	body := queryBody(`{"target":"requests","refId":"A","payload":{"site":"docs"}},` +
+		`{"target":"server_errors","refId":"B","payload":{}},` +
+		`{"target":"ok","refId":"C","hide":true,"payload":{}}`)
+	rec := analyticsQuery(t, hs.AnalyticsQuery, body, docsAnalyticsCaps)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var series []AnalyticsSeries
+	if err := json.NewDecoder(rec.Body).Decode(&series); err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("got %d series, want 2 without the hidden one", len(series))
+	}
+	if series[0].Target != `requests{site="docs"}` || series[0].RefID != "A" {
+		t.Errorf("series = %s (%s)", series[0].Target, series[0].RefID)
+	}
+	sum := func(s AnalyticsSeries) (n int64) {
+		for _, p := range s.Datapoints {
+			n += p[0]
+		}
+		return n
+	}
+	if n := sum(series[0]); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+	if n := sum(series[1]); n != 0 {
+		t.Errorf("server errors = %d, want 0", n)
+	}
+	// A minute apart, over an hour.
+	points := series[0].Datapoints
+	if len(points) < 60 || points[1][1]-points[0][1] != time.Minute.Milliseconds() {
+		t.Errorf("got %d points starting %v", len(points), points[:2])
+	}
+}
+
+func TestAnalyticsQueryHandler_Errors(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", "{", http.StatusBadRequest},
+		{"no range", `{"targets":[]}`, http.StatusBadRequest},
+		{"unknown target", queryBody(`{"target":"visitors","payload":{}}`), http.StatusBadRequest},
+		{"other site", queryBody(`{"target":"requests","payload":{"site":"demo"}}`), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := analyticsQuery(t, hs.AnalyticsQuery, tt.body, docsAnalyticsCaps)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	rec := analyticsQuery(t, hs.AnalyticsQuery, queryBody(""), []auth.Cap{{Access: "view"}})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status without analytics cap = %d, want 403", rec.Code)
+	}
+}
+
+func TestAnalyticsMetricsHandler(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/analytics/", docsAnalyticsCaps, viewerID)
+	rec := httptest.NewRecorder()
+	hs.AnalyticsMetrics.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var metrics []AnalyticsMetric
+	if err := json.NewDecoder(rec.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != len(seriesNames) || metrics[0].Value != seriesRequests {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	options := metrics[0].Payloads[0].Options
+	if len(options) != 1 || options[0].Value != "docs" {
+		t.Errorf("site options = %+v, want only docs", options)
+	}
+}
@@ -3,16 +3,24 @@ package admin
 import (
 	"html/template"
 	"net/http"
+	"time"
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/events"
+	"tspages/internal/multihost"
+	"tspages/internal/sitehealth"
 	"tspages/internal/storage"
 	"tspages/internal/webhook"
 )
 
 // SiteStatus is the per-site data returned by the sites list endpoint.
 type SiteStatus struct {
-	Name                 string `json:"name"`
+	Name string `json:"name"`
+	// Hostname is the site's tailnet hostname: its name, unless the site
+	// config sets hostname_prefix or hostname_suffix.
+	Hostname             string `json:"hostname"`
 	ActiveDeploymentID   string `json:"active_deployment_id,omitempty"`
 	Requests             int64  `json:"requests"`
 	Sparkline            string `json:"sparkline,omitempty"`
@@ -20,14 +28,27 @@ type SiteStatus struct {
 	LastDeployedByAvatar string `json:"last_deployed_by_avatar,omitempty"`
 	LastDeployedAt       string `json:"last_deployed_at,omitempty"`
 	CanDeploy            bool   `json:"can_deploy,omitempty"`
+	// LoginError is why the site's server could not log in to the tailnet,
+	// such as an expired auth key.
+	LoginError string `json:"login_error,omitempty"`
+
+	Archived *storage.ArchiveState `json:"archived,omitempty"`
+	Canary   *storage.CanaryState  `json:"canary,omitempty"`
+	// Health is the site's last health score, if it was scored.
+	Health *sitehealth.Score `json:"health,omitempty"`
+
+	// Group is the site's name prefix when the sites list is grouped.
+	Group string `json:"group,omitempty"`
 }
 
 // SitesResponse is the JSON response for GET /sites.
 type SitesResponse struct {
-	Admin     bool         `json:"admin"`
-	User      UserInfo     `json:"user"`
-	DNSSuffix string       `json:"dns_suffix"`
-	Sites     []SiteStatus `json:"sites"`
+	Admin      bool         `json:"admin"`
+	User       UserInfo     `json:"user"`
+	DNSSuffix  string       `json:"dns_suffix"`
+	Sites      []SiteStatus `json:"sites"`
+	Page       int          `json:"page"`
+	TotalPages int          `json:"total_pages"`
 }
 
 // SiteDetailResponse is the JSON response for GET /sites/{site}.
@@ -43,6 +64,8 @@ type handlerDeps struct {
 	recorder  *analytics.Recorder
 	dnsSuffix string
 	defaults  storage.SiteConfig
+	index     *deployindex.Index // nil reads deployment lists from disk
+	health    HealthScorer       // nil shows no health scores
 }
 
 // analyticsEnabled reports whether analytics are enabled for the given site
@@ -56,12 +79,22 @@ func (d *handlerDeps) analyticsEnabled(site string) bool {
 	return *merged.Analytics
 }
 
+// siteHostname returns the tailnet hostname of the given site per the
+// current deployment's config merged with server defaults.
+func (d *handlerDeps) siteHostname(site string) string {
+	cfg, _ := d.store.ReadCurrentSiteConfig(site)
+	return cfg.Merge(d.defaults).Hostname(site)
+}
+
 // UserInfo holds user display data for templates.
 type UserInfo struct {
 	Name          string `json:"name"`
 	ProfilePicURL string `json:"profile_pic_url,omitempty"`
 	Admin         bool   `json:"admin,omitempty"`
 	CanDeploy     bool   `json:"can_deploy,omitempty"`
+	// CanViewAnalytics is set for deployers and admins, and for callers
+	// granted only the analytics of some sites.
+	CanViewAnalytics bool `json:"can_view_analytics,omitempty"`
 }
 
 func userInfo(identity auth.Identity, caps []auth.Cap) UserInfo {
@@ -69,63 +102,169 @@ func userInfo(identity auth.Identity, caps []auth.Cap) UserInfo {
 	if name == "" {
 		name = identity.LoginName
 	}
-	return UserInfo{Name: name, ProfilePicURL: identity.ProfilePicURL, Admin: auth.HasAdminCap(caps), CanDeploy: auth.HasDeployCap(caps)}
+	return UserInfo{
+		Name: name, ProfilePicURL: identity.ProfilePicURL,
+		Admin: auth.HasAdminCap(caps), CanDeploy: auth.HasDeployCap(caps),
+		CanViewAnalytics: auth.HasAnalyticsCap(caps),
+	}
 }
 
-// SiteEnsurer is the subset of multihost.Manager needed to start a site server.
+// SiteEnsurer is the subset of multihost.Manager needed to start and restart
+// site servers.
 type SiteEnsurer interface {
 	EnsureServer(site string) error
+	// RestartServer stops the site's server, if running, and starts it anew.
+	RestartServer(site string) error
 }
 
 // SiteHealthChecker is the subset of multihost.Manager needed for health checks.
 type SiteHealthChecker interface {
 	IsRunning(site string) bool
+	// LoginError returns why the site's server could not log in to the
+	// tailnet, or "" if it did not fail.
+	LoginError(site string) string
+	// Listeners returns the URLs the site's server listens on.
+	Listeners(site string) []string
+	// Resources returns what the site's server uses and the caps it is
+	// held to, and false if it is not running.
+	Resources(site string) (multihost.Resources, bool)
 }
 
 // Handlers groups all admin HTTP handlers.
 type Handlers struct {
-	Sites           *SitesHandler
-	Site            *SiteHandler
-	Deployment      *DeploymentHandler
-	CreateSite      *CreateSiteHandler
-	Deployments     *DeploymentsHandler
-	Analytics       *AnalyticsHandler
-	PurgeAnalytics  *PurgeAnalyticsHandler
-	AllAnalytics    *AllAnalyticsHandler
-	Webhooks        *WebhooksHandler
-	WebhookDetail   *WebhookDetailHandler
-	WebhookRetry    *WebhookRetryHandler
-	SiteWebhooks    *SiteWebhooksHandler
-	SiteDeployments *SiteDeploymentsHandler
-	Help            *HelpHandler
-	API             *APIHandler
-	Feed            *FeedHandler
-	SiteFeed        *SiteFeedHandler
-	SiteHealth      *SiteHealthHandler
+	Sites             *SitesHandler
+	Site              *SiteHandler
+	Deployment        *DeploymentHandler
+	ConfigSnapshot    *ConfigSnapshotHandler
+	VerifyChain       *VerifyChainHandler
+	CreateSite        *CreateSiteHandler
+	Deployments       *DeploymentsHandler
+	SavedFilters      *SavedFiltersHandler
+	SaveFilter        *SaveFilterHandler
+	DeleteSavedFilter *DeleteSavedFilterHandler
+	Analytics         *AnalyticsHandler
+	PurgeAnalytics    *PurgeAnalyticsHandler
+	AllAnalytics      *AllAnalyticsHandler
+	AnalyticsMetrics  *AnalyticsMetricsHandler
+	AnalyticsQuery    *AnalyticsQueryHandler
+	Webhooks          *WebhooksHandler
+	WebhookDetail     *WebhookDetailHandler
+	WebhookRetry      *WebhookRetryHandler
+	WebhookExport     *WebhookExportHandler
+	SiteWebhooks      *SiteWebhooksHandler
+	SiteDeployments   *SiteDeploymentsHandler
+	SiteActivity      *SiteActivityHandler
+	UserActivity      *UserActivityHandler
+	SiteLive          *SiteLiveHandler
+	SiteFiles         *SiteFilesHandler
+	SiteFile          *SiteFileHandler
+	ConfigTest        *ConfigTestHandler
+	Help              *HelpHandler
+	API               *APIHandler
+	Feed              *FeedHandler
+	SiteFeed          *SiteFeedHandler
+	SiteHealth        *SiteHealthHandler
+	RestartServer     *RestartServerHandler
+	Trash             *TrashHandler
+	Integrity         *IntegrityHandler
+	Verification      *VerificationHandler
+	RestoreSite       *RestoreSiteHandler
+	RestoreDeployment *RestoreDeploymentHandler
+	WhoAmI            *WhoAmIHandler
+	ExportSite        *ExportSiteHandler
+	ImportSite        *ImportSiteHandler
+	Events            *EventsHandler
+	ArchiveSite       *ArchiveSiteHandler
+	UnarchiveSite     *UnarchiveSiteHandler
+	Shares            *SharesHandler
+	CreateShare       *CreateShareHandler
+	RevokeShare       *RevokeShareHandler
+	Preferences       *PreferencesHandler
+	Search            *SearchHandler
+	Landing           *LandingHandler
+
+	page pageSettings
 }
 
-func NewHandlers(store *storage.Store, recorder *analytics.Recorder, dnsSuffix string, ensurer SiteEnsurer, checker SiteHealthChecker, defaults storage.SiteConfig, notifier *webhook.Notifier) *Handlers {
-	d := handlerDeps{store: store, recorder: recorder, dnsSuffix: dnsSuffix, defaults: defaults}
+// Options are the optional dependencies of the handlers NewHandlers
+// returns. Each one left unset turns off what it backs.
+type Options struct {
+	// DeploymentIndex serves deployment lists and feeds instead of every
+	// deployment's manifest.
+	DeploymentIndex *deployindex.Index
+	// HealthScorer scores the sites in the sites list and per-site health.
+	HealthScorer HealthScorer
+	// Preferences makes pages follow the viewer's theme, table density,
+	// timezone, and landing page.
+	Preferences PreferenceStore
+	// ReadOnly makes pages show a banner and disable their forms while it
+	// is enabled.
+	ReadOnly *ReadOnlyMode
+	// Timezone is the timezone of users who have not chosen one; UTC if
+	// nil.
+	Timezone *time.Location
+}
+
+func NewHandlers(store *storage.Store, recorder *analytics.Recorder, dnsSuffix string, ensurer SiteEnsurer, checker SiteHealthChecker, defaults storage.SiteConfig, notifier *webhook.Notifier, bus *events.Bus, opts Options) *Handlers {
+	d := handlerDeps{store: store, recorder: recorder, dnsSuffix: dnsSuffix, defaults: defaults,
+		index: opts.DeploymentIndex, health: opts.HealthScorer}
+	page := pageSettings{prefs: opts.Preferences, readOnly: opts.ReadOnly, location: opts.Timezone}
+	if page.location == nil {
+		page.location = time.UTC
+	}
 	wh := &WebhooksHandler{handlerDeps: d, notifier: notifier}
 	return &Handlers{
-		Sites:           &SitesHandler{d},
-		Site:            &SiteHandler{handlerDeps: d, notifier: notifier},
-		Deployment:      &DeploymentHandler{d},
-		CreateSite:      &CreateSiteHandler{handlerDeps: d, ensurer: ensurer, notifier: notifier},
-		Deployments:     &DeploymentsHandler{d},
-		Analytics:       &AnalyticsHandler{d},
-		PurgeAnalytics:  &PurgeAnalyticsHandler{d},
-		AllAnalytics:    &AllAnalyticsHandler{d},
-		Webhooks:        wh,
-		WebhookDetail:   &WebhookDetailHandler{handlerDeps: d, notifier: notifier},
-		WebhookRetry:    &WebhookRetryHandler{handlerDeps: d, notifier: notifier},
-		SiteWebhooks:    &SiteWebhooksHandler{WebhooksHandler: wh},
-		SiteDeployments: &SiteDeploymentsHandler{d},
-		Help:            &HelpHandler{},
-		API:             &APIHandler{},
-		Feed:            &FeedHandler{d},
-		SiteFeed:        &SiteFeedHandler{d},
-		SiteHealth:      &SiteHealthHandler{handlerDeps: d, checker: checker},
+		Sites:             &SitesHandler{handlerDeps: d, checker: checker},
+		Site:              &SiteHandler{handlerDeps: d, notifier: notifier},
+		Deployment:        &DeploymentHandler{d},
+		ConfigSnapshot:    &ConfigSnapshotHandler{d},
+		VerifyChain:       &VerifyChainHandler{d},
+		CreateSite:        &CreateSiteHandler{handlerDeps: d, ensurer: ensurer, events: bus},
+		Deployments:       &DeploymentsHandler{d},
+		SavedFilters:      &SavedFiltersHandler{d},
+		SaveFilter:        &SaveFilterHandler{d},
+		DeleteSavedFilter: &DeleteSavedFilterHandler{d},
+		Analytics:         &AnalyticsHandler{d},
+		PurgeAnalytics:    &PurgeAnalyticsHandler{d},
+		AllAnalytics:      &AllAnalyticsHandler{d},
+		AnalyticsMetrics:  &AnalyticsMetricsHandler{d},
+		AnalyticsQuery:    &AnalyticsQueryHandler{d},
+		Webhooks:          wh,
+		WebhookDetail:     &WebhookDetailHandler{handlerDeps: d, notifier: notifier},
+		WebhookRetry:      &WebhookRetryHandler{handlerDeps: d, notifier: notifier},
+		WebhookExport:     &WebhookExportHandler{handlerDeps: d, notifier: notifier},
+		SiteWebhooks:      &SiteWebhooksHandler{WebhooksHandler: wh},
+		SiteDeployments:   &SiteDeploymentsHandler{d},
+		SiteActivity:      &SiteActivityHandler{handlerDeps: d, notifier: notifier},
+		UserActivity:      &UserActivityHandler{handlerDeps: d},
+		SiteLive:          &SiteLiveHandler{d},
+		SiteFiles:         &SiteFilesHandler{d},
+		SiteFile:          &SiteFileHandler{d},
+		ConfigTest:        &ConfigTestHandler{d},
+		Help:              &HelpHandler{},
+		API:               &APIHandler{},
+		Feed:              &FeedHandler{d},
+		SiteFeed:          &SiteFeedHandler{d},
+		SiteHealth:        &SiteHealthHandler{handlerDeps: d, checker: checker},
+		RestartServer:     &RestartServerHandler{handlerDeps: d, ensurer: ensurer, events: bus},
+		Trash:             &TrashHandler{d},
+		Integrity:         &IntegrityHandler{d},
+		Verification:      &VerificationHandler{d},
+		RestoreSite:       &RestoreSiteHandler{handlerDeps: d, ensurer: ensurer},
+		RestoreDeployment: &RestoreDeploymentHandler{d},
+		WhoAmI:            &WhoAmIHandler{d},
+		ExportSite:        &ExportSiteHandler{d},
+		ImportSite:        &ImportSiteHandler{handlerDeps: d, ensurer: ensurer},
+		Events:            &EventsHandler{events: bus},
+		ArchiveSite:       &ArchiveSiteHandler{handlerDeps: d, ensurer: ensurer},
+		UnarchiveSite:     &UnarchiveSiteHandler{handlerDeps: d, ensurer: ensurer},
+		Shares:            &SharesHandler{handlerDeps: d},
+		CreateShare:       &CreateShareHandler{handlerDeps: d},
+		RevokeShare:       &RevokeShareHandler{handlerDeps: d},
+		Preferences:       &PreferencesHandler{d},
+		Search:            &SearchHandler{handlerDeps: d, notifier: notifier},
+		Landing:           &LandingHandler{},
+		page:              page,
 	}
 }
 
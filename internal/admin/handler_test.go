@@ -1,18 +1,26 @@
 package admin
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/multihost"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 	"tspages/internal/webhook"
 
@@ -20,7 +28,8 @@ import (
 )
 
 type mockEnsurer struct {
-	ensured []string
+	ensured   []string
+	restarted []string
 }
 
 func (m *mockEnsurer) EnsureServer(site string) error {
@@ -28,8 +37,21 @@ func (m *mockEnsurer) EnsureServer(site string) error {
 	return nil
 }
 
+func (m *mockEnsurer) RestartServer(site string) error {
+	m.restarted = append(m.restarted, site)
+	return nil
+}
+
 func (m *mockEnsurer) IsRunning(site string) bool { return true }
 
+func (m *mockEnsurer) LoginError(site string) string { return "" }
+
+func (m *mockEnsurer) Listeners(site string) []string { return nil }
+
+func (m *mockEnsurer) Resources(site string) (multihost.Resources, bool) {
+	return multihost.Resources{}, true
+}
+
 func reqWithAuth(method, path string, caps []auth.Cap, id auth.Identity) *http.Request {
 	r := httptest.NewRequest(method, path, nil)
 	ctx := auth.ContextWithCaps(r.Context(), caps)
@@ -92,6 +114,7 @@ func setupRecorder(t *testing.T) *analytics.Recorder {
 			Status:    200,
 		})
 	}
+	r.RecordTransfer("docs", time.Now(), 2048)
 	// Close and reopen to flush events.
 	r.Close()
 	r, err = analytics.NewRecorder(dbPath)
@@ -107,7 +130,7 @@ func setupHandlers(t *testing.T) (*Handlers, *storage.Store) {
 	store := setupStore(t)
 	recorder := setupRecorder(t)
 	dnsSuffix := "test.ts.net"
-	return NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil), store
+	return NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{}), store
 }
 
 var (
@@ -240,6 +263,86 @@ func TestSitesHandler_NonAdminExclusion(t *testing.T) {
 	}
 }
 
+func TestSitesHandler_Query(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.CreateSite("docs-beta")
+	names := func(query string) []string {
+		t.Helper()
+		req := reqWithAuth("GET", "/sites?"+query, adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		hs.Sites.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", query, rec.Code, rec.Body.String())
+		}
+		var resp SitesResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		var out []string
+		for _, s := range resp.Sites {
+			out = append(out, s.Name+"/"+s.Group)
+		}
+		return out
+	}
+
+	for query, want := range map[string][]string{
+		"":                       {"demo/", "docs/", "docs-beta/", "staging/"},
+		"q=DOCS":                 {"docs/", "docs-beta/"},
+		"sort=deployed":          {"demo/", "docs/", "docs-beta/", "staging/"},
+		"sort=requests":          {"docs/", "demo/", "docs-beta/", "staging/"},
+		"group=prefix":           {"demo/demo", "docs/docs", "docs-beta/docs", "staging/staging"},
+		"group=prefix&sort=name": {"demo/demo", "docs/docs", "docs-beta/docs", "staging/staging"},
+	} {
+		if got := names(query); !slices.Equal(got, want) {
+			t.Errorf("%q: sites = %v, want %v", query, got, want)
+		}
+	}
+
+	req := reqWithAuth("GET", "/sites?q=nothing", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.Sites.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "No sites match this search.") {
+		t.Error("HTML should say that no sites match")
+	}
+
+	for _, query := range []string{"sort=size", "group=suffix"} {
+		req := reqWithAuth("GET", "/sites?"+query, adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		hs.Sites.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestSitesHandler_Pagination(t *testing.T) {
+	hs, store := setupHandlers(t)
+	for i := range sitesPageSize {
+		store.CreateSite(fmt.Sprintf("site-%03d", i))
+	}
+	page := func(n int) SitesResponse {
+		t.Helper()
+		req := reqWithAuth("GET", fmt.Sprintf("/sites?page=%d", n), adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		hs.Sites.ServeHTTP(rec, req)
+		var resp SitesResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	first, second := page(1), page(2)
+	if first.TotalPages != 2 || len(first.Sites) != sitesPageSize || len(second.Sites) != 3 {
+		t.Fatalf("pages = %d, sites = %d + %d; want 2 pages of %d + 3", first.TotalPages, len(first.Sites), len(second.Sites), sitesPageSize)
+	}
+	if first.Sites[0].Name != "demo" || second.Sites[2].Name != "staging" {
+		t.Errorf("first = %s, last = %s; want demo, staging", first.Sites[0].Name, second.Sites[2].Name)
+	}
+	if got := page(9); got.Page != 2 {
+		t.Errorf("page past the end = %d, want 2", got.Page)
+	}
+}
+
 // --- SiteHandler ---
 
 func TestSiteHandler_AdminJSON(t *testing.T) {
@@ -296,6 +399,55 @@ func TestSiteHandler_AdminHTML(t *testing.T) {
 	}
 }
 
+func TestSiteHandler_Canary(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.CreateDeployment("docs", "ddd44444")
+	store.MarkComplete("docs", "ddd44444")
+	if err := store.StartCanary("docs", storage.CanaryState{DeploymentID: "ddd44444", Percent: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "canary 20%") || !strings.Contains(body, "Stop canary") {
+		t.Error("HTML does not show the canary")
+	}
+
+	req = reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	var resp SiteDetailResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Site.Canary == nil || resp.Site.Canary.DeploymentID != "ddd44444" {
+		t.Errorf("canary = %+v, want ddd44444", resp.Site.Canary)
+	}
+}
+
+func TestSiteHandler_Tampered(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.MarkTampered("docs", "aaa11111", "index.html: missing")
+
+	req := reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "were changed outside tspages") || !strings.Contains(body, "index.html: missing") {
+		t.Error("HTML does not flag the tampered deployment")
+	}
+}
+
 func TestSiteHandler_JSONSuffix(t *testing.T) {
 	hs, _ := setupHandlers(t)
 	h := hs.Site
@@ -321,7 +473,7 @@ func TestSiteHandler_HidesAnalyticsWhenDisabled(t *testing.T) {
 	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{Analytics: &analytics})
 
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 	h := hs.Site
 	req := reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
 	req.SetPathValue("site", "docs")
@@ -351,6 +503,16 @@ func TestSiteHandler_NotFound(t *testing.T) {
 	if rec.Code != http.StatusNotFound {
 		t.Errorf("status = %d, want 404", rec.Code)
 	}
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var details problem.Details
+	if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+		t.Fatalf("decoding problem details: %v", err)
+	}
+	if details.Code != problem.SiteNotFound || details.Detail != "site not found" || details.Status != http.StatusNotFound {
+		t.Errorf("problem = %+v", details)
+	}
 }
 
 func TestSiteHandler_NonAdminForbidden(t *testing.T) {
@@ -419,6 +581,58 @@ func TestDeploymentHandler_AdminHTML(t *testing.T) {
 	}
 }
 
+func TestDeploymentHandler_BuildMetadata(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.WriteManifest("docs", "aaa11111", storage.Manifest{
+		Site: "docs", ID: "aaa11111",
+		CreatedBy: "Alice",
+		CreatedAt: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Build: &storage.BuildInfo{
+			Commit:   "4f2a9c1e8b7d6a5f4e3d2c1b0a9f8e7d6c5b4a39",
+			Branch:   "main",
+			BuildURL: "https://ci.example.com/builds/42",
+		},
+	})
+	req := reqWithAuth("GET", "/sites/docs/deployments/aaa11111", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "aaa11111")
+
+	rec := httptest.NewRecorder()
+	hs.Deployment.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	for _, want := range []string{"4f2a9c1", "main", `href="https://ci.example.com/builds/42"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("deployment page lacks %q", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	hs.Feed.ServeHTTP(rec, reqWithAuth("GET", "/feed.atom", adminCaps, adminID))
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	var entry atomEntry
+	for _, e := range feed.Entries {
+		if strings.Contains(e.Title, "aaa11111") {
+			entry = e
+		}
+	}
+	if !strings.Contains(entry.Content, "from commit 4f2a9c1 on main") {
+		t.Errorf("feed entry content = %q", entry.Content)
+	}
+	var hasBuildLink bool
+	for _, l := range entry.Links {
+		if l.Rel == "related" && l.Href == "https://ci.example.com/builds/42" {
+			hasBuildLink = true
+		}
+	}
+	if !hasBuildLink {
+		t.Errorf("feed entry links = %+v", entry.Links)
+	}
+}
+
 func TestDeploymentHandler_NotFound(t *testing.T) {
 	hs, _ := setupHandlers(t)
 	h := hs.Deployment
@@ -435,6 +649,30 @@ func TestDeploymentHandler_NotFound(t *testing.T) {
 	}
 }
 
+func TestDeploymentHandler_DeployLog(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.WriteDeployLog("docs", "aaa11111", []storage.DeployLogEntry{
+		{Time: time.Now(), Level: "INFO", Message: "extracted upload", Attrs: map[string]any{"bytes": 2048}},
+		{Time: time.Now(), Level: "WARN", Message: "precompressing deployment"},
+	})
+	req := reqWithAuth("GET", "/sites/docs/deployments/aaa11111", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "aaa11111")
+
+	rec := httptest.NewRecorder()
+	hs.Deployment.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Deploy log", "extracted upload", "bytes=2048", "precompressing deployment"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+}
+
 func TestDeploymentHandler_FileListing(t *testing.T) {
 	store := storage.New(t.TempDir())
 
@@ -461,7 +699,7 @@ func TestDeploymentHandler_FileListing(t *testing.T) {
 	store.ActivateDeployment("docs", "aaa11111")
 
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 	h := hs.Deployment
 
 	req := reqWithAuth("GET", "/sites/docs/deployments/aaa11111", adminCaps, adminID)
@@ -486,6 +724,54 @@ func TestDeploymentHandler_FileListing(t *testing.T) {
 	}
 }
 
+func TestDeploymentHandler_Composition(t *testing.T) {
+	store := storage.New(t.TempDir())
+	for i, id := range []string{"aaa11111", "bbb22222"} {
+		dir, err := store.CreateDeployment("docs", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "content"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		store.WriteManifest("docs", id, storage.Manifest{
+			Site: "docs", ID: id,
+			CreatedAt: time.Date(2025, 1, 15+i, 10, 0, 0, 0, time.UTC),
+			SizeBytes: int64(1000 * (i + 1)),
+		})
+		store.WriteFileIndex("docs", id, []storage.FileInfo{
+			{Path: "index.html", Size: 400, CompressedSize: 100},
+			{Path: "hero.png", Size: 1600 * int64(i)},
+		})
+		store.MarkComplete("docs", id)
+	}
+	store.ActivateDeployment("docs", "bbb22222")
+
+	hs := NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
+	req := reqWithAuth("GET", "/sites/docs/deployments/bbb22222", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "bbb22222")
+	rec := httptest.NewRecorder()
+	hs.Deployment.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"Composition",
+		"images",
+		"75% smaller compressed",
+		"Size trend",
+		`href="/sites/docs/deployments/aaa11111"`,
+		"width: 50%",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+}
+
 func TestDeploymentHandler_DiffAgainstPrevious(t *testing.T) {
 	store := storage.New(t.TempDir())
 
@@ -535,7 +821,7 @@ func TestDeploymentHandler_DiffAgainstPrevious(t *testing.T) {
 	store.ActivateDeployment("docs", "bbb22222")
 
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 	h := hs.Deployment
 
 	req := reqWithAuth("GET", "/sites/docs/deployments/bbb22222", adminCaps, adminID)
@@ -568,30 +854,79 @@ func TestDeploymentHandler_DiffAgainstPrevious(t *testing.T) {
 	}
 }
 
-func TestDiffFiles(t *testing.T) {
-	current := []storage.FileInfo{
-		{Path: "index.html", Size: 200, Hash: "aaa"},
-		{Path: "new.js", Size: 50, Hash: "bbb"},
-		{Path: "same.css", Size: 100, Hash: "ccc"},
-		{Path: "same-size-diff-content.txt", Size: 100, Hash: "ddd"},
+func TestConfigSnapshotHandler(t *testing.T) {
+	hs, store := setupHandlers(t)
+	get := func(caps []auth.Cap, id string) *httptest.ResponseRecorder {
+		req := reqWithAuth("GET", "/sites/docs/deployments/"+id+"/config", caps, adminID)
+		req.SetPathValue("site", "docs")
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		hs.ConfigSnapshot.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get(adminCaps, "aaa11111"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "no config snapshot") {
+		t.Errorf("without a snapshot: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := get(adminCaps, "fff99999"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "deployment_not_found") {
+		t.Errorf("unknown deployment: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	store.WriteConfigSnapshot("docs", "aaa11111", storage.SiteConfig{IndexPage: "home.html", WebhookSecret: "whsec_abc"})
+	rec := get(adminCaps, "aaa11111")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var snapshot storage.ConfigSnapshot
+	json.NewDecoder(rec.Body).Decode(&snapshot)
+	if snapshot.DeploymentID != "aaa11111" || snapshot.Config["index_page"] != "home.html" || snapshot.Config["webhook_secret"] == "whsec_abc" {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+
+	if rec := get(viewerCaps, "aaa11111"); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestVerifyChainHandler(t *testing.T) {
+	hs, store := setupHandlers(t)
+	get := func(caps []auth.Cap, site string) *httptest.ResponseRecorder {
+		req := reqWithAuth("GET", "/sites/"+site+"/deployments/verify", caps, viewerID)
+		req.SetPathValue("site", site)
+		rec := httptest.NewRecorder()
+		hs.VerifyChain.ServeHTTP(rec, req)
+		return rec
 	}
-	previous := []storage.FileInfo{
-		{Path: "index.html", Size: 100, Hash: "xxx"},
-		{Path: "old.txt", Size: 30, Hash: "yyy"},
-		{Path: "same.css", Size: 100, Hash: "ccc"},
-		{Path: "same-size-diff-content.txt", Size: 100, Hash: "zzz"},
+	verify := func() storage.ChainReport {
+		t.Helper()
+		rec := get(viewerCaps, "docs")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var report storage.ChainReport
+		json.NewDecoder(rec.Body).Decode(&report)
+		return report
 	}
 
-	added, removed, changed := diffFiles(current, previous)
+	if err := store.ChainDeployment("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+	if report := verify(); !report.Valid || report.Entries != 1 || report.Verified != 1 {
+		t.Errorf("report = %+v", report)
+	}
 
-	if len(added) != 1 || added[0] != "new.js" {
-		t.Errorf("added = %v, want [new.js]", added)
+	m, _ := store.ReadManifest("docs", "aaa11111")
+	m.CreatedBy = "mallory@example.com"
+	store.WriteManifest("docs", "aaa11111", m)
+	if report := verify(); report.Valid || len(report.Problems) != 1 || report.Problems[0].DeploymentID != "aaa11111" {
+		t.Errorf("after rewriting a manifest, report = %+v", report)
 	}
-	if len(removed) != 1 || removed[0] != "old.txt" {
-		t.Errorf("removed = %v, want [old.txt]", removed)
+
+	if rec := get(viewerCaps, "blog"); rec.Code != http.StatusForbidden {
+		t.Errorf("other site: status = %d, want 403", rec.Code)
 	}
-	if len(changed) != 2 {
-		t.Errorf("changed = %v, want [index.html same-size-diff-content.txt]", changed)
+	if rec := get(adminCaps, "nope"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown site: status = %d, want 404", rec.Code)
 	}
 }
 
@@ -706,6 +1041,86 @@ func TestDeploymentsHandler_Pagination(t *testing.T) {
 	}
 }
 
+func TestDeploymentsHandler_FailedFilter(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.CreateDeployment("docs", "ddd44444")
+	store.WriteManifest("docs", "ddd44444", storage.Manifest{
+		Site: "docs", ID: "ddd44444", CreatedAt: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC), FailedStage: "config",
+	})
+	store.MarkFailed("docs", "ddd44444", "invalid tspages.toml")
+
+	req := reqWithAuth("GET", "/deployments?status=failed", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.Deployments.ServeHTTP(rec, req)
+	var resp DeploymentsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Deployments) != 1 || resp.Deployments[0].ID != "ddd44444" || resp.Deployments[0].FailedStage != "config" {
+		t.Errorf("failed deployments = %+v", resp.Deployments)
+	}
+
+	req = reqWithAuth("GET", "/sites/demo/deployments?status=failed", adminCaps, adminID)
+	req.SetPathValue("site", "demo")
+	rec = httptest.NewRecorder()
+	hs.SiteDeployments.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "No failed deployments.") {
+		t.Errorf("site without failed deployments: body lacks empty notice")
+	}
+}
+
+func TestDeploymentsHandler_Index(t *testing.T) {
+	store := setupStore(t)
+	db, err := analytics.OpenSQLite(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	index, err := deployindex.New(db, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Reconcile()
+	hs := NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{DeploymentIndex: index})
+
+	list := func() []string {
+		t.Helper()
+		req := reqWithAuth("GET", "/deployments", adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		hs.Deployments.ServeHTTP(rec, req)
+		var resp DeploymentsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, d := range resp.Deployments {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	// Deployments are listed from the index, not from disk.
+	store.CreateDeployment("docs", "ddd44444")
+	store.WriteManifest("docs", "ddd44444", storage.Manifest{CreatedAt: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)})
+	store.MarkComplete("docs", "ddd44444")
+	if got, want := list(), []string{"bbb22222", "aaa11111", "ccc33333"}; !slices.Equal(got, want) {
+		t.Errorf("before sync = %v, want %v", got, want)
+	}
+
+	index.SyncSite("docs")
+	if got, want := list(), []string{"ddd44444", "bbb22222", "aaa11111", "ccc33333"}; !slices.Equal(got, want) {
+		t.Errorf("after sync = %v, want %v", got, want)
+	}
+
+	req := reqWithAuth("GET", "/sites/docs/feed.atom", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.SiteFeed.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "ddd44444") || !strings.Contains(body, "aaa11111") {
+		t.Errorf("site feed lacks indexed deployments: %s", body)
+	}
+}
+
 // --- CreateSiteHandler ---
 
 func TestCreateSiteHandler_Success(t *testing.T) {
@@ -832,7 +1247,7 @@ func TestCreateSiteHandler_CallsEnsureServer(t *testing.T) {
 	store := setupStore(t)
 	dnsSuffix := "test.ts.net"
 	mock := &mockEnsurer{}
-	hs := NewHandlers(store, nil, dnsSuffix, mock, mock, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, nil, dnsSuffix, mock, mock, storage.SiteConfig{}, nil, nil, Options{})
 	h := hs.CreateSite
 
 	req := formReqWithAuth("/sites", "name=newsite5", adminCaps, adminID)
@@ -868,6 +1283,9 @@ func TestAnalyticsHandler_HTML(t *testing.T) {
 	if !strings.Contains(body, "Requests") {
 		t.Error("HTML missing Requests metric")
 	}
+	if !strings.Contains(body, "transfer-chart") {
+		t.Error("HTML missing transfer chart")
+	}
 }
 
 func TestAnalyticsHandler_JSON(t *testing.T) {
@@ -892,6 +1310,108 @@ func TestAnalyticsHandler_JSON(t *testing.T) {
 	if resp["total"].(float64) != 3 {
 		t.Errorf("total = %v, want 3", resp["total"])
 	}
+	if resp["transfer_bytes"].(float64) != 2048 {
+		t.Errorf("transfer_bytes = %v, want 2048", resp["transfer_bytes"])
+	}
+	if resp["transfer_cap_bytes"].(float64) != 0 {
+		t.Errorf("transfer_cap_bytes = %v, want 0", resp["transfer_cap_bytes"])
+	}
+	if resp["timezone"] != "UTC" {
+		t.Errorf("timezone = %v, want UTC", resp["timezone"])
+	}
+	if resp["visitors_by"] != "login" {
+		t.Errorf("visitors_by = %v, want login", resp["visitors_by"])
+	}
+}
+
+func TestAnalyticsHandler_Sampled(t *testing.T) {
+	store := setupStore(t)
+	recorder := setupRecorder(t)
+	recorder.Import([]analytics.Event{{Timestamp: time.Now(), Site: "docs", Path: "/app.js", Status: 200, Weight: 10}})
+	hs := NewHandlers(store, recorder, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
+
+	req := reqWithAuth("GET", "/sites/docs/analytics?range=all", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.Analytics.ServeHTTP(rec, req)
+
+	var resp struct {
+		Total     int64 `json:"total"`
+		Estimated int64 `json:"estimated_requests"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Total != 13 || resp.Estimated != 10 {
+		t.Errorf("total = %d, estimated = %d; want 13, 10", resp.Total, resp.Estimated)
+	}
+
+	req = reqWithAuth("GET", "/sites/docs/analytics?range=all", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Analytics.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "Requests (sampled)") || !strings.Contains(body, "10 of these requests are estimated") {
+		t.Error("HTML does not label the estimated requests")
+	}
+}
+
+func TestAnalyticsHandler_IncludeBots(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for _, tc := range []struct {
+		query string
+		want  bool
+	}{
+		{"range=all", false},
+		{"range=all&bots=include", true},
+	} {
+		req := reqWithAuth("GET", "/sites/docs/analytics?"+tc.query, adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		hs.Analytics.ServeHTTP(rec, req)
+
+		var resp struct {
+			IncludeBots bool `json:"include_bots"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusOK || resp.IncludeBots != tc.want {
+			t.Errorf("%s: status = %d, include_bots = %v, want %v", tc.query, rec.Code, resp.IncludeBots, tc.want)
+		}
+	}
+}
+
+func TestAnalyticsHandler_Timezone(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for _, tc := range []struct {
+		tz   string
+		code int
+	}{
+		{"Europe/Berlin", http.StatusOK},
+		{"Mars/Olympus_Mons", http.StatusBadRequest},
+	} {
+		req := reqWithAuth("GET", "/sites/docs/analytics?range=P7D&tz="+tc.tz, adminCaps, adminID)
+		req.Header.Set("Accept", "application/json")
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		hs.Analytics.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code {
+			t.Fatalf("tz=%s: status = %d, want %d", tc.tz, rec.Code, tc.code)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Timezone   string                 `json:"timezone"`
+			TimeSeries []analytics.TimeBucket `json:"time_series"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.Timezone != tc.tz {
+			t.Errorf("timezone = %q, want %q", resp.Timezone, tc.tz)
+		}
+		if len(resp.TimeSeries) == 0 || !strings.HasSuffix(resp.TimeSeries[0].Time, "+01:00") && !strings.HasSuffix(resp.TimeSeries[0].Time, "+02:00") {
+			t.Errorf("time series not in %s: %v", tc.tz, resp.TimeSeries)
+		}
+	}
 }
 
 func TestAnalyticsHandler_Forbidden(t *testing.T) {
@@ -917,7 +1437,7 @@ func TestAnalyticsHandler_Disabled(t *testing.T) {
 	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{Analytics: &analytics})
 
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/sites/docs/analytics", adminCaps, adminID)
 	req.SetPathValue("site", "docs")
@@ -937,7 +1457,7 @@ func TestAnalyticsHandler_DisabledViaDefaults(t *testing.T) {
 	analytics := false
 	defaults := storage.SiteConfig{Analytics: &analytics}
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, defaults, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, defaults, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/sites/docs/analytics", adminCaps, adminID)
 	req.SetPathValue("site", "docs")
@@ -984,7 +1504,7 @@ func TestAllAnalyticsHandler_AdminJSON(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupMultiSiteRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/analytics?range=all", adminCaps, adminID)
 	req.Header.Set("Accept", "application/json")
@@ -1014,7 +1534,7 @@ func TestAllAnalyticsHandler_AdminHTML(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupMultiSiteRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/analytics?range=all", adminCaps, adminID)
 
@@ -1040,7 +1560,7 @@ func TestAllAnalyticsHandler_ViewOnlyForbidden(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupMultiSiteRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	// viewerCaps only grants view — analytics requires deploy
 	req := reqWithAuth("GET", "/analytics?range=all", viewerCaps, viewerID)
@@ -1058,7 +1578,7 @@ func TestAllAnalyticsHandler_FilteredByAccess(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupMultiSiteRecorder(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	// Deploy caps for "docs" only — should see docs data but not demo
 	deployCaps := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
@@ -1087,6 +1607,60 @@ func TestAllAnalyticsHandler_FilteredByAccess(t *testing.T) {
 	}
 }
 
+func TestAnalyticsOnlyCap_PermissionMatrix(t *testing.T) {
+	store := setupStore(t)
+	recorder := setupMultiSiteRecorder(t)
+	hs := NewHandlers(store, recorder, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
+	analyticsCaps := []auth.Cap{{Access: "analytics", Sites: []string{"docs"}}}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		site    string
+		want    int
+	}{
+		{"site analytics", hs.Analytics, "/sites/docs/analytics", "docs", http.StatusOK},
+		{"other site analytics", hs.Analytics, "/sites/demo/analytics", "demo", http.StatusForbidden},
+		{"all analytics", hs.AllAnalytics, "/analytics", "", http.StatusOK},
+		{"live view", hs.SiteLive, "/sites/docs/live", "docs", http.StatusOK},
+		{"purge analytics", hs.PurgeAnalytics, "/sites/docs/analytics/purge", "docs", http.StatusForbidden},
+		{"site", hs.Site, "/sites/docs", "docs", http.StatusForbidden},
+		{"site deployments", hs.SiteDeployments, "/sites/docs/deployments", "docs", http.StatusForbidden},
+		{"deployment", hs.Deployment, "/sites/docs/deployments/aaa11111", "docs", http.StatusForbidden},
+		{"deployments", hs.Deployments, "/deployments", "", http.StatusForbidden},
+		{"webhooks", hs.Webhooks, "/webhooks", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := "GET"
+			if strings.HasSuffix(tt.path, "/purge") {
+				method = "POST"
+			}
+			req := reqWithAuth(method, tt.path, analyticsCaps, viewerID)
+			req.SetPathValue("site", tt.site)
+			req.SetPathValue("id", "aaa11111")
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	req := reqWithAuth("GET", "/analytics?range=all", analyticsCaps, viewerID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.AllAnalytics.ServeHTTP(rec, req)
+	var resp struct {
+		Sites []analytics.SiteCount `json:"sites"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Sites) != 1 || resp.Sites[0].Site != "docs" {
+		t.Errorf("sites = %+v, want docs only", resp.Sites)
+	}
+}
+
 func TestAllAnalyticsHandler_ExcludesDisabledSites(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupMultiSiteRecorder(t)
@@ -1096,7 +1670,7 @@ func TestAllAnalyticsHandler_ExcludesDisabledSites(t *testing.T) {
 	store.WriteSiteConfig("demo", "bbb22222", storage.SiteConfig{Analytics: &analytics})
 
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/analytics?range=all", adminCaps, adminID)
 	req.Header.Set("Accept", "application/json")
@@ -1127,7 +1701,7 @@ func TestAllAnalyticsHandler_ExcludesDisabledSites(t *testing.T) {
 func TestAllAnalyticsHandler_NoRecorder(t *testing.T) {
 	store := setupStore(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("GET", "/analytics", adminCaps, adminID)
 
@@ -1165,7 +1739,7 @@ func TestPurgeAnalyticsHandler(t *testing.T) {
 func TestPurgeAnalyticsHandler_NoRecorder(t *testing.T) {
 	store := setupStore(t)
 	dnsSuffix := "test.ts.net"
-	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil)
+	hs := NewHandlers(store, nil, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
 
 	req := reqWithAuth("POST", "/sites/docs/analytics/purge", adminCaps, adminID)
 	req.SetPathValue("site", "docs")
@@ -1235,7 +1809,7 @@ func TestJSONResponses_LinkHeaders(t *testing.T) {
 func TestHealthHandler_OK(t *testing.T) {
 	store := setupStore(t)
 	recorder := setupRecorder(t)
-	h := NewHealthHandler(store, recorder)
+	h := NewHealthHandler(store, recorder, nil, nil)
 
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	rec := httptest.NewRecorder()
@@ -1256,11 +1830,14 @@ func TestHealthHandler_OK(t *testing.T) {
 	if checks["analytics"] != "ok" {
 		t.Errorf("analytics = %v, want ok", checks["analytics"])
 	}
+	if resp["analytics_dropped_events"] != float64(0) {
+		t.Errorf("analytics_dropped_events = %v, want 0", resp["analytics_dropped_events"])
+	}
 }
 
 func TestHealthHandler_NoAnalytics(t *testing.T) {
 	store := setupStore(t)
-	h := NewHealthHandler(store, nil)
+	h := NewHealthHandler(store, nil, nil, nil)
 
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	rec := httptest.NewRecorder()
@@ -1307,11 +1884,14 @@ func TestSiteHealthHandler_Running(t *testing.T) {
 	}
 }
 
-func TestSiteHealthHandler_Stopped(t *testing.T) {
+func TestSiteHealthHandler_Listeners(t *testing.T) {
 	store := setupStore(t)
-	dnsSuffix := "test.ts.net"
-	checker := &mockChecker{running: map[string]bool{}}
-	d := handlerDeps{store: store, dnsSuffix: dnsSuffix}
+	listeners := []string{"https://docs.test.ts.net", "https://docs.test.ts.net:8443", "http://docs.test.ts.net"}
+	checker := &mockChecker{
+		running:   map[string]bool{"docs": true},
+		listeners: map[string][]string{"docs": listeners},
+	}
+	d := handlerDeps{store: store, dnsSuffix: "test.ts.net", defaults: storage.SiteConfig{IPFamily: "ipv4"}}
 	h := &SiteHealthHandler{handlerDeps: d, checker: checker}
 
 	req := reqWithAuth("GET", "/sites/docs/healthz", adminCaps, adminID)
@@ -1319,27 +1899,75 @@ func TestSiteHealthHandler_Stopped(t *testing.T) {
 	rec := httptest.NewRecorder()
 	h.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusServiceUnavailable {
-		t.Fatalf("status = %d, want 503, body = %s", rec.Code, rec.Body.String())
+	var resp struct {
+		Listeners []string `json:"listeners"`
+		IPFamily  string   `json:"ip_family"`
 	}
-	var resp map[string]any
 	json.NewDecoder(rec.Body).Decode(&resp)
-	if resp["status"] != "error" {
-		t.Errorf("status = %v, want error", resp["status"])
+	if !slices.Equal(resp.Listeners, listeners) {
+		t.Errorf("listeners = %v, want %v", resp.Listeners, listeners)
 	}
-	if resp["server"] != "stopped" {
-		t.Errorf("server = %v, want stopped", resp["server"])
+	if resp.IPFamily != "ipv4" {
+		t.Errorf("ip_family = %q, want ipv4", resp.IPFamily)
 	}
 }
 
-func TestSiteHealthHandler_Forbidden(t *testing.T) {
+func TestSiteHealthHandler_Resources(t *testing.T) {
 	store := setupStore(t)
-	dnsSuffix := "test.ts.net"
-	checker := &mockChecker{}
-	d := handlerDeps{store: store, dnsSuffix: dnsSuffix}
-	h := &SiteHealthHandler{handlerDeps: d, checker: checker}
+	resources := multihost.Resources{Connections: 3, InFlight: 2, Goroutines: 5, Shed: 7, MaxConcurrentRequests: 2}
+	checker := &mockChecker{
+		running:   map[string]bool{"docs": true},
+		resources: map[string]multihost.Resources{"docs": resources},
+	}
+	h := &SiteHealthHandler{handlerDeps: handlerDeps{store: store}, checker: checker}
 
-	// viewerCaps only has view access to "docs", not "demo"
+	req := reqWithAuth("GET", "/sites/docs/healthz", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp struct {
+		Resources multihost.Resources `json:"resources"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Resources != resources {
+		t.Errorf("resources = %+v, want %+v", resp.Resources, resources)
+	}
+}
+
+func TestSiteHealthHandler_Stopped(t *testing.T) {
+	store := setupStore(t)
+	dnsSuffix := "test.ts.net"
+	checker := &mockChecker{running: map[string]bool{}}
+	d := handlerDeps{store: store, dnsSuffix: dnsSuffix}
+	h := &SiteHealthHandler{handlerDeps: d, checker: checker}
+
+	req := reqWithAuth("GET", "/sites/docs/healthz", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]any
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp["status"] != "error" {
+		t.Errorf("status = %v, want error", resp["status"])
+	}
+	if resp["server"] != "stopped" {
+		t.Errorf("server = %v, want stopped", resp["server"])
+	}
+}
+
+func TestSiteHealthHandler_Forbidden(t *testing.T) {
+	store := setupStore(t)
+	dnsSuffix := "test.ts.net"
+	checker := &mockChecker{}
+	d := handlerDeps{store: store, dnsSuffix: dnsSuffix}
+	h := &SiteHealthHandler{handlerDeps: d, checker: checker}
+
+	// viewerCaps only has view access to "docs", not "demo"
 	req := reqWithAuth("GET", "/sites/demo/healthz", viewerCaps, viewerID)
 	req.SetPathValue("site", "demo")
 	rec := httptest.NewRecorder()
@@ -1369,11 +1997,23 @@ func TestSiteHealthHandler_NotFound(t *testing.T) {
 
 // mockChecker implements SiteHealthChecker for testing.
 type mockChecker struct {
-	running map[string]bool
+	running     map[string]bool
+	loginErrors map[string]string
+	listeners   map[string][]string
+	resources   map[string]multihost.Resources
 }
 
 func (m *mockChecker) IsRunning(site string) bool { return m.running[site] }
 
+func (m *mockChecker) LoginError(site string) string { return m.loginErrors[site] }
+
+func (m *mockChecker) Listeners(site string) []string { return m.listeners[site] }
+
+func (m *mockChecker) Resources(site string) (multihost.Resources, bool) {
+	res, ok := m.resources[site]
+	return res, ok
+}
+
 func TestSubtractISO8601(t *testing.T) {
 	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
 	tests := []struct {
@@ -1450,7 +2090,7 @@ func setupHandlersWithNotifier(t *testing.T) (*Handlers, *storage.Store, *webhoo
 	recorder := setupRecorder(t)
 	notifier, db := testNotifierDB(t)
 	dnsSuffix := "test.ts.net"
-	return NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, notifier), store, notifier, db
+	return NewHandlers(store, recorder, dnsSuffix, &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, notifier, nil, Options{}), store, notifier, db
 }
 
 // --- SiteDeploymentsHandler ---
@@ -1498,6 +2138,55 @@ func TestSiteDeploymentsHandler_AdminHTML(t *testing.T) {
 	}
 }
 
+func TestSiteDeploymentsHandler_CommitRange(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.WriteManifest("docs", "aaa11111", storage.Manifest{
+		Site: "docs", ID: "aaa11111",
+		CreatedAt: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Build:     &storage.BuildInfo{Commit: "1111111aaaa"},
+	})
+	store.CreateDeployment("docs", "ddd44444")
+	store.WriteManifest("docs", "ddd44444", storage.Manifest{
+		Site: "docs", ID: "ddd44444",
+		CreatedAt: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC),
+		Build:     &storage.BuildInfo{Commit: "2222222bbbb"},
+	})
+	store.WriteSiteConfig("docs", "ddd44444", storage.SiteConfig{CompareURL: "https://git.example.com/compare/{from}...{to}"})
+	store.MarkComplete("docs", "ddd44444")
+	store.ActivateDeployment("docs", "ddd44444")
+
+	req := reqWithAuth("GET", "/sites/docs/deployments.json", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.SiteDeployments.ServeHTTP(rec, req)
+
+	var resp struct {
+		Deployments []storage.DeploymentInfo `json:"deployments"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Deployments) != 2 {
+		t.Fatalf("got %d deployments, want 2", len(resp.Deployments))
+	}
+	want := storage.CommitRange{From: "1111111aaaa", To: "2222222bbbb", CompareURL: "https://git.example.com/compare/1111111aaaa...2222222bbbb"}
+	if r := resp.Deployments[0].CommitRange; r == nil || *r != want {
+		t.Errorf("commit range = %+v, want %+v", r, want)
+	}
+	if r := resp.Deployments[1].CommitRange; r != nil {
+		t.Errorf("oldest deployment has commit range %+v", r)
+	}
+
+	req = reqWithAuth("GET", "/sites/docs/deployments", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.SiteDeployments.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `href="https://git.example.com/compare/1111111aaaa...2222222bbbb"`) {
+		t.Error("deployments page lacks the compare link")
+	}
+}
+
 func TestSiteDeploymentsHandler_Forbidden(t *testing.T) {
 	hs, _ := setupHandlers(t)
 	h := hs.SiteDeployments
@@ -1820,3 +2509,660 @@ func TestWebhookRetryHandler_ReachesResend(t *testing.T) {
 		t.Error("response missing 'status' field")
 	}
 }
+
+func TestWebhooksHandler_TableStats(t *testing.T) {
+	hs, _, _, db := setupHandlersWithNotifier(t)
+	insertDelivery(t, db, "docs", 200)
+
+	req := reqWithAuth("GET", "/webhooks", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	hs.Webhooks.ServeHTTP(rec, req)
+
+	var resp struct {
+		Table webhook.TableStats `json:"table"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Table.Attempts != 1 || resp.Table.Deliveries != 1 {
+		t.Errorf("table = %+v, want 1 attempt and 1 delivery", resp.Table)
+	}
+
+	req = reqWithAuth("GET", "/webhooks", adminCaps, adminID)
+	rec = httptest.NewRecorder()
+	hs.Webhooks.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "/webhooks/export") {
+		t.Error("HTML missing export link")
+	}
+}
+
+func TestWebhookExportHandler(t *testing.T) {
+	hs, _, _, db := setupHandlersWithNotifier(t)
+	insertDelivery(t, db, "docs", 200)
+	insertDelivery(t, db, "demo", 500)
+
+	export := func(caps []auth.Cap, query string) *httptest.ResponseRecorder {
+		req := reqWithAuth("GET", "/webhooks/export"+query, caps, viewerID)
+		rec := httptest.NewRecorder()
+		hs.WebhookExport.ServeHTTP(rec, req)
+		return rec
+	}
+	lines := func(rec *httptest.ResponseRecorder) []webhook.DeliveryRecord {
+		var out []webhook.DeliveryRecord
+		dec := json.NewDecoder(rec.Body)
+		for dec.More() {
+			var d webhook.DeliveryRecord
+			if err := dec.Decode(&d); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, d)
+		}
+		return out
+	}
+
+	rec := export(adminCaps, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content-type = %q", ct)
+	}
+	if got := lines(rec); len(got) != 2 {
+		t.Errorf("admin exported %d attempts, want 2", len(got))
+	}
+
+	// Deployers only get their own sites' deliveries.
+	got := lines(export([]auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, ""))
+	if len(got) != 1 || got[0].Site != "docs" {
+		t.Errorf("deployer export = %+v, want only docs", got)
+	}
+
+	if got := lines(export(adminCaps, "?site=demo")); len(got) != 1 || got[0].Site != "demo" {
+		t.Errorf("site filter = %+v, want only demo", got)
+	}
+	if got := lines(export(adminCaps, "?since=2999-01-01")); len(got) != 0 {
+		t.Errorf("future since exported %d attempts, want 0", len(got))
+	}
+	if rec := export(adminCaps, "?since=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad since status = %d, want 400", rec.Code)
+	}
+	if rec := export(viewerCaps, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer status = %d, want 403", rec.Code)
+	}
+}
+
+// --- Trash ---
+
+func TestTrashHandler_ListsRestorableEntries(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.TrashSite("demo")
+	store.TrashDeployment("staging", "ccc33333")
+
+	req := reqWithAuth("GET", "/trash.json", []auth.Cap{{Access: "deploy", Sites: []string{"staging", "demo"}}}, viewerID)
+	rec := httptest.NewRecorder()
+	hs.Trash.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp TrashResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	// Deploy access can restore deployments but not whole sites.
+	if len(resp.Entries) != 1 || resp.Entries[0].DeploymentID != "ccc33333" {
+		t.Errorf("entries = %+v, want only staging/ccc33333", resp.Entries)
+	}
+}
+
+func TestTrashHandler_Forbidden(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/trash", viewerCaps, viewerID)
+	rec := httptest.NewRecorder()
+	hs.Trash.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestTrashHandler_HTML(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.TrashSite("demo")
+
+	req := reqWithAuth("GET", "/trash", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.Trash.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `action="/sites/demo/restore"`) {
+		t.Error("page should contain a restore form for demo")
+	}
+}
+
+func TestRestoreSiteHandler_Success(t *testing.T) {
+	store := setupStore(t)
+	ensurer := &mockEnsurer{}
+	hs := NewHandlers(store, nil, "test.ts.net", ensurer, ensurer, storage.SiteConfig{}, nil, nil, Options{})
+	store.TrashSite("docs")
+
+	req := formReqWithAuth("/sites/docs/restore", "", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.RestoreSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, err := store.GetSite("docs"); err != nil {
+		t.Errorf("site not restored: %v", err)
+	}
+	if len(ensurer.ensured) != 1 || ensurer.ensured[0] != "docs" {
+		t.Errorf("ensured = %v, want [docs]", ensurer.ensured)
+	}
+}
+
+func TestRestoreSiteHandler_NotInTrash(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := formReqWithAuth("/sites/gone/restore", "", adminCaps, adminID)
+	req.SetPathValue("site", "gone")
+	rec := httptest.NewRecorder()
+	hs.RestoreSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRestoreSiteHandler_RequiresAdmin(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.TrashSite("docs")
+
+	req := formReqWithAuth("/sites/docs/restore", "", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, viewerID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.RestoreSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestRestoreDeploymentHandler_Success(t *testing.T) {
+	hs, store := setupHandlers(t)
+	store.TrashDeployment("staging", "ccc33333")
+
+	req := formReqWithAuth("/sites/staging/deployments/ccc33333/restore", "", []auth.Cap{{Access: "deploy", Sites: []string{"staging"}}}, viewerID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "staging")
+	req.SetPathValue("id", "ccc33333")
+	rec := httptest.NewRecorder()
+	hs.RestoreDeployment.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	deps, _ := store.ListDeployments("staging")
+	if len(deps) != 1 {
+		t.Errorf("got %d deployments, want 1", len(deps))
+	}
+}
+
+type mockResolver struct{ known map[string]bool }
+
+func (m *mockResolver) WhoIsLogin(_ context.Context, login string) (*auth.WhoIsResult, error) {
+	if !m.known[login] {
+		return nil, errors.New("no device found")
+	}
+	return &auth.WhoIsResult{LoginName: login}, nil
+}
+
+func TestViewAsHandler_SetsCookie(t *testing.T) {
+	h := NewViewAsHandler(&mockResolver{known: map[string]bool{"user@example.com": true}})
+	req := formReqWithAuth("/view-as", "login=user@example.com", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303, body = %s", rec.Code, rec.Body.String())
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.ViewAsCookie || cookies[0].Value != "user@example.com" {
+		t.Errorf("cookies = %v, want %s=user@example.com", cookies, auth.ViewAsCookie)
+	}
+}
+
+func TestViewAsHandler_UnknownUser(t *testing.T) {
+	h := NewViewAsHandler(&mockResolver{})
+	req := formReqWithAuth("/view-as", "login=nobody@example.com", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("no cookie should be set for an unknown user")
+	}
+}
+
+func TestViewAsHandler_RequiresUnscopedAdmin(t *testing.T) {
+	h := NewViewAsHandler(&mockResolver{known: map[string]bool{"user@example.com": true}})
+	scoped := []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}
+	req := formReqWithAuth("/view-as", "login=user@example.com", scoped, adminID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestViewAsHandler_Disabled(t *testing.T) {
+	h := NewViewAsHandler(nil)
+	req := formReqWithAuth("/view-as", "login=user@example.com", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestExitViewAsHandler_ClearsCookie(t *testing.T) {
+	req := formReqWithAuth("/view-as/exit", "", viewerCaps, viewerID)
+	rec := httptest.NewRecorder()
+	(&ExitViewAsHandler{}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != auth.ViewAsCookie || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want %s cleared", cookies, auth.ViewAsCookie)
+	}
+}
+
+func TestSitesHandler_ViewAsBanner(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/sites", viewerCaps, viewerID)
+	req = req.WithContext(auth.ContextWithViewer(req.Context(), adminID))
+	rec := httptest.NewRecorder()
+	hs.Sites.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "read-only preview") || !strings.Contains(body, `action="/view-as/exit"`) {
+		t.Error("page should show the view-as banner with an exit form")
+	}
+	if !strings.Contains(body, "data-read-only") {
+		t.Error("body should be marked read-only")
+	}
+	if strings.Contains(body, `action="/view-as"`) {
+		t.Error("the previewed user should not get the view-as form")
+	}
+}
+
+func TestSitesHandler_NoViewAsBannerByDefault(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/sites", adminCaps, adminID)
+	rec := httptest.NewRecorder()
+	hs.Sites.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "read-only preview") {
+		t.Error("banner should only appear while viewing as another user")
+	}
+	if !strings.Contains(body, `action="/view-as"`) {
+		t.Error("admins should get the view-as form")
+	}
+}
+
+func TestWhoAmIHandler_JSON(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	caps := []auth.Cap{{Access: "view"}, {Access: "deploy", Sites: []string{"docs"}}}
+	req := reqWithAuth("GET", "/whoami.json", caps, viewerID)
+	rec := httptest.NewRecorder()
+	hs.WhoAmI.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp WhoAmIResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.LoginName != viewerID.LoginName {
+		t.Errorf("login = %q, want %q", resp.LoginName, viewerID.LoginName)
+	}
+	if len(resp.Caps) != 2 {
+		t.Errorf("caps = %v, want both grants", resp.Caps)
+	}
+	perms := make(map[string]SitePermission)
+	for _, p := range resp.Sites {
+		perms[p.Name] = p
+	}
+	if p := perms["docs"]; !p.View || !p.Deploy || p.Admin {
+		t.Errorf("docs = %+v, want view+deploy", p)
+	}
+	if p := perms["staging"]; !p.View || p.Deploy {
+		t.Errorf("staging = %+v, want view only", p)
+	}
+}
+
+func TestWhoAmIHandler_HidesInvisibleSites(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/whoami.json", viewerCaps, viewerID)
+	rec := httptest.NewRecorder()
+	hs.WhoAmI.ServeHTTP(rec, req)
+
+	var resp WhoAmIResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Sites) != 1 || resp.Sites[0].Name != "docs" {
+		t.Errorf("sites = %+v, want only docs", resp.Sites)
+	}
+}
+
+func TestWhoAmIHandler_NoCaps(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/whoami", nil, viewerID)
+	rec := httptest.NewRecorder()
+	hs.WhoAmI.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "grants you no tspages capabilities") {
+		t.Error("page should explain that no capabilities were granted")
+	}
+}
+
+// --- ExportSiteHandler / ImportSiteHandler ---
+
+func TestExportImportSite_RoundTrip(t *testing.T) {
+	hs, _ := setupHandlers(t)
+
+	req := reqWithAuth("GET", "/sites/docs/export?analytics=true", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.ExportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d, want 200, body = %s", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "docs-") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	store := storage.New(t.TempDir())
+	recorder := setupRecorder(t)
+	ensurer := &mockEnsurer{}
+	dst := NewHandlers(store, recorder, "test.ts.net", ensurer, ensurer, storage.SiteConfig{}, nil, nil, Options{})
+
+	req = httptest.NewRequest("POST", "/sites/handbook/import", rec.Body)
+	req.Header.Set("Accept", "application/json")
+	req = req.WithContext(auth.ContextWithIdentity(auth.ContextWithCaps(req.Context(), adminCaps), adminID))
+	req.SetPathValue("site", "handbook")
+	rec = httptest.NewRecorder()
+	dst.ImportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status = %d, want 200, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]any
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp["name"] != "handbook" || resp["active_deployment_id"] != "aaa11111" {
+		t.Errorf("response = %v", resp)
+	}
+	if cur, _ := store.CurrentDeployment("handbook"); cur != "aaa11111" {
+		t.Errorf("current = %q, want aaa11111", cur)
+	}
+	if len(ensurer.ensured) != 1 || ensurer.ensured[0] != "handbook" {
+		t.Errorf("ensured = %v, want [handbook]", ensurer.ensured)
+	}
+	count, _ := recorder.TotalRequests("handbook", time.Time{}, time.Now().Add(time.Hour))
+	if count != 3 {
+		t.Errorf("imported analytics = %d, want 3", count)
+	}
+}
+
+func TestExportSiteHandler_RequiresAdmin(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/sites/docs/export", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, viewerID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.ExportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestImportSiteHandler_Exists(t *testing.T) {
+	hs, _ := setupHandlers(t)
+
+	req := reqWithAuth("GET", "/sites/docs/export", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.ExportSite.ServeHTTP(rec, req)
+
+	req = httptest.NewRequest("POST", "/sites/demo/import", rec.Body)
+	req = req.WithContext(auth.ContextWithIdentity(auth.ContextWithCaps(req.Context(), adminCaps), adminID))
+	req.SetPathValue("site", "demo")
+	rec = httptest.NewRecorder()
+	hs.ImportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+}
+
+func TestImportSiteHandler_InvalidArchive(t *testing.T) {
+	hs, store := setupHandlers(t)
+	req := httptest.NewRequest("POST", "/sites/fresh/import", strings.NewReader("not an archive"))
+	req = req.WithContext(auth.ContextWithIdentity(auth.ContextWithCaps(req.Context(), adminCaps), adminID))
+	req.SetPathValue("site", "fresh")
+	rec := httptest.NewRecorder()
+	hs.ImportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if _, err := store.GetSite("fresh"); err == nil {
+		t.Error("failed import should not leave a site behind")
+	}
+}
+
+func TestImportSiteHandler_Forbidden(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := httptest.NewRequest("POST", "/sites/fresh/import", strings.NewReader(""))
+	req = req.WithContext(auth.ContextWithIdentity(auth.ContextWithCaps(req.Context(), viewerCaps), viewerID))
+	req.SetPathValue("site", "fresh")
+	rec := httptest.NewRecorder()
+	hs.ImportSite.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestHealthHandler_LoginErrors(t *testing.T) {
+	store := setupStore(t)
+	checker := &mockChecker{loginErrors: map[string]string{"docs": "tailnet login failed: invalid key"}}
+	h := NewHealthHandler(store, nil, nil, checker)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	var resp map[string]any
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if checks := resp["checks"].(map[string]any); checks["tailnet"] != "error" {
+		t.Errorf("tailnet = %v, want error", checks["tailnet"])
+	}
+	if errs, _ := resp["login_errors"].(map[string]any); errs["docs"] == nil {
+		t.Errorf("login_errors = %v, want docs", resp["login_errors"])
+	}
+}
+
+func TestSitesHandler_LoginError(t *testing.T) {
+	store := setupStore(t)
+	checker := &mockChecker{loginErrors: map[string]string{"docs": "tailnet login failed: invalid key"}}
+	h := &SitesHandler{handlerDeps: handlerDeps{store: store}, checker: checker}
+
+	req := reqWithAuth("GET", "/sites", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp SitesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range resp.Sites {
+		want := ""
+		if s.Name == "docs" {
+			want = "tailnet login failed: invalid key"
+		}
+		if s.LoginError != want {
+			t.Errorf("%s login_error = %q, want %q", s.Name, s.LoginError, want)
+		}
+	}
+}
+
+func TestSitesHandler_Hostname(t *testing.T) {
+	store := setupStore(t)
+	defaults := storage.SiteConfig{HostnamePrefix: "pages-"}
+	h := &SitesHandler{handlerDeps: handlerDeps{store: store, dnsSuffix: "example.ts.net", defaults: defaults}, checker: &mockChecker{}}
+
+	req := reqWithAuth("GET", "/sites", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp SitesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sites) == 0 {
+		t.Fatal("no sites")
+	}
+	for _, s := range resp.Sites {
+		if s.Hostname != "pages-"+s.Name {
+			t.Errorf("%s hostname = %q, want pages-%s", s.Name, s.Hostname, s.Name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, reqWithAuth("GET", "/sites", adminCaps, adminID))
+	if !strings.Contains(rec.Body.String(), "https://pages-docs.example.ts.net") {
+		t.Error("sites page does not link to the prefixed hostname")
+	}
+}
+
+// --- ConfigTestHandler ---
+
+func setupConfigTest(t *testing.T) *ConfigTestHandler {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	dir, err := store.CreateDeployment("docs", "aaa11111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentDir := filepath.Join(dir, "content")
+	if err := os.MkdirAll(filepath.Join(contentDir, "guide"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "guide/index.html", "style.css"} {
+		if err := os.WriteFile(filepath.Join(contentDir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{
+		Redirects: []storage.RedirectRule{{From: "/docs", To: "/guide/"}},
+		Headers:   map[string]map[string]string{"/*.css": {"X-Test": "yes"}},
+	})
+	store.MarkComplete("docs", "aaa11111")
+	store.ActivateDeployment("docs", "aaa11111")
+
+	hs := NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{})
+	return hs.ConfigTest
+}
+
+func configTestReq(body string, caps []auth.Cap, id auth.Identity) *http.Request {
+	req := httptest.NewRequest("POST", "/sites/docs/config/test", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	ctx := auth.ContextWithCaps(req.Context(), caps)
+	req = req.WithContext(auth.ContextWithIdentity(ctx, id))
+	req.SetPathValue("site", "docs")
+	return req
+}
+
+func TestConfigTestHandler(t *testing.T) {
+	h := setupConfigTest(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, configTestReq(`{"paths":["/docs","/style.css"]}`, adminCaps, adminID))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ConfigTestResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.DeploymentID != "aaa11111" || len(resp.Results) != 2 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if r := resp.Results[0]; r.Status != 301 || r.Target != "/guide/" || r.File != "guide/index.html" {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := resp.Results[1]; r.Status != 200 || r.Headers["X-Test"] != "yes" {
+		t.Errorf("results[1] = %+v", r)
+	}
+}
+
+func TestConfigTestHandler_Overrides(t *testing.T) {
+	h := setupConfigTest(t)
+	body := `{"paths":["/docs","/style.css"],"redirects":"/docs /  302\n","headers":"/*.css\n  X-Draft: 1\n"}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, configTestReq(body, adminCaps, adminID))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp ConfigTestResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if r := resp.Results[0]; r.Status != 302 || r.Target != "/" || r.File != "index.html" {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := resp.Results[1]; r.Headers["X-Draft"] != "1" || r.Headers["X-Test"] != "" {
+		t.Errorf("results[1] = %+v", r)
+	}
+}
+
+func TestConfigTestHandler_InvalidOverride(t *testing.T) {
+	h := setupConfigTest(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, configTestReq(`{"paths":["/"],"redirects":"/a /b 200\n"}`, adminCaps, adminID))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestConfigTestHandler_NoPaths(t *testing.T) {
+	h := setupConfigTest(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, configTestReq(`{"paths":[]}`, adminCaps, adminID))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestConfigTestHandler_ViewerForbidden(t *testing.T) {
+	h := setupConfigTest(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, configTestReq(`{"paths":["/"]}`, viewerCaps, viewerID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
@@ -4,41 +4,72 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sync"
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/problem"
+	"tspages/internal/sitehealth"
 	"tspages/internal/storage"
 )
 
 // --- GET /healthz ---
 
-// HealthHandler returns platform health. It is unauthenticated.
+// HealthHandler returns platform health. It is unauthenticated. When the
+// status changes between checks, it publishes health.degraded or
+// health.recovered.
 type HealthHandler struct {
 	store    *storage.Store
 	recorder *analytics.Recorder
+	events   *events.Bus
+	checker  SiteHealthChecker
+
+	mu         sync.Mutex
+	lastStatus string
 }
 
-func NewHealthHandler(store *storage.Store, recorder *analytics.Recorder) *HealthHandler {
-	return &HealthHandler{store: store, recorder: recorder}
+// NewHealthHandler returns a HealthHandler. If checker is set, sites whose
+// servers could not log in to the tailnet degrade the status.
+func NewHealthHandler(store *storage.Store, recorder *analytics.Recorder, bus *events.Bus, checker SiteHealthChecker) *HealthHandler {
+	return &HealthHandler{store: store, recorder: recorder, events: bus, checker: checker, lastStatus: "ok"}
 }
 
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	type checkResult struct {
 		Storage   string `json:"storage"`
 		Analytics string `json:"analytics"`
+		Tailnet   string `json:"tailnet"`
 	}
 
 	status := "ok"
 	checks := checkResult{
 		Storage:   "ok",
 		Analytics: "disabled",
+		Tailnet:   "ok",
 	}
 
-	if _, err := h.store.ListSites(); err != nil {
+	sites, err := h.store.ListSites()
+	if err != nil {
 		checks.Storage = "error"
 		status = "degraded"
 	}
 
+	// Sites whose servers could not log in, usually after the auth key
+	// expired, are unreachable until the key is replaced.
+	loginErrors := map[string]string{}
+	if h.checker != nil {
+		for _, s := range sites {
+			if msg := h.checker.LoginError(s.Name); msg != "" {
+				loginErrors[s.Name] = msg
+			}
+		}
+	}
+	if len(loginErrors) > 0 {
+		checks.Tailnet = "error"
+		status = "degraded"
+	}
+
 	if h.recorder != nil {
 		checks.Analytics = "ok"
 		if err := h.recorder.Ping(); err != nil {
@@ -47,21 +78,74 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	h.publishTransition(status, map[string]any{
+		"storage":   checks.Storage,
+		"analytics": checks.Analytics,
+		"tailnet":   checks.Tailnet,
+	})
+
 	code := http.StatusOK
 	if status != "ok" {
 		code = http.StatusServiceUnavailable
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	if err := json.NewEncoder(w).Encode(map[string]any{
+	resp := map[string]any{
 		"status": status,
 		"checks": checks,
-	}); err != nil {
-		slog.Warn("encoding health response failed", "err", err)
+	}
+	if h.recorder != nil {
+		// Dropped events lose analytics but do not affect serving, so they
+		// are reported without degrading the status.
+		resp["analytics_dropped_events"] = h.recorder.Dropped()
+	}
+	if len(loginErrors) > 0 {
+		resp["login_errors"] = loginErrors
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.WarnContext(r.Context(), "encoding health response failed", "err", err)
 	}
 }
 
+// publishTransition publishes a health event if status differs from the
+// previous check.
+func (h *HealthHandler) publishTransition(status string, checks map[string]any) {
+	h.mu.Lock()
+	changed := status != h.lastStatus
+	h.lastStatus = status
+	h.mu.Unlock()
+	if !changed || h.events == nil {
+		return
+	}
+	typ := events.HealthDegraded
+	if status == "ok" {
+		typ = events.HealthRecovered
+	}
+	h.events.Publish(events.Event{
+		Type: typ,
+		Data: map[string]any{"status": status, "checks": checks},
+	})
+}
+
+// HealthScorer is the subset of sitehealth.Scorer needed to show health
+// scores.
+type HealthScorer interface {
+	Score(site string) (sitehealth.Score, bool)
+}
+
+// siteHealth returns the health score of site, or nil if it has none.
+func (d *handlerDeps) siteHealth(site string) *sitehealth.Score {
+	if d.health == nil {
+		return nil
+	}
+	score, ok := d.health.Score(site)
+	if !ok {
+		return nil
+	}
+	return &score
+}
+
 // --- GET /sites/{site}/healthz ---
 
 // SiteHealthHandler returns health for a single site. It requires auth.
@@ -73,7 +157,7 @@ type SiteHealthHandler struct {
 func (h *SiteHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
@@ -85,14 +169,15 @@ func (h *SiteHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	site, err := h.store.GetSite(siteName)
 	if err != nil {
-		RenderError(w, r, http.StatusNotFound, "site not found")
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
 		return
 	}
 
 	running := h.checker.IsRunning(siteName)
+	loginError := h.checker.LoginError(siteName)
 
 	status := "ok"
-	if !running {
+	if !running || loginError != "" {
 		status = "error"
 	}
 
@@ -103,12 +188,31 @@ func (h *SiteHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	if err := json.NewEncoder(w).Encode(map[string]any{
+	resp := map[string]any{
 		"status":            status,
 		"site":              siteName,
 		"server":            map[bool]string{true: "running", false: "stopped"}[running],
 		"active_deployment": site.ActiveDeploymentID,
-	}); err != nil {
-		slog.Warn("encoding health response failed", "site", siteName, "err", err)
+	}
+	if loginError != "" {
+		resp["login_error"] = loginError
+	}
+	if score := h.siteHealth(siteName); score != nil {
+		resp["health"] = score
+	}
+	if running {
+		cfg, _ := h.store.ReadCurrentSiteConfig(siteName)
+		ipFamily := cfg.Merge(h.defaults).IPFamily
+		if ipFamily == "" {
+			ipFamily = "any"
+		}
+		resp["listeners"] = h.checker.Listeners(siteName)
+		resp["ip_family"] = ipFamily
+		if res, ok := h.checker.Resources(siteName); ok {
+			resp["resources"] = res
+		}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.WarnContext(r.Context(), "encoding health response failed", "site", siteName, "err", err)
 	}
 }
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// --- GET /integrity ---
+
+// IntegrityHandler shows the report of the storage consistency check run
+// at startup: interrupted uploads that were completed or quarantined, and
+// sites rolled back from a broken active deployment.
+type IntegrityHandler struct{ handlerDeps }
+
+func (h *IntegrityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+
+	if !auth.CanViewIntegrity(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	report, err := h.store.LastIntegrityReport()
+	if err != nil && !os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "reading integrity report", "err", err)
+		RenderError(w, r, http.StatusInternalServerError, "reading integrity report")
+		return
+	}
+	if report.Issues == nil {
+		report.Issues = []storage.IntegrityIssue{}
+	}
+
+	if wantsJSON(r) {
+		setAlternateLinks(w, [][2]string{
+			{"/integrity", "text/html"},
+		})
+		writeJSON(w, report)
+		return
+	}
+
+	renderPage(w, r, integrityTmpl, "sites", struct {
+		storage.IntegrityReport
+		User UserInfo
+	}{report, userInfo(identity, caps)})
+}
+
+// integrityIssues returns the number of issues and errors in the last
+// integrity report, for the notice on the sites page.
+func (d *handlerDeps) integrityIssues() int {
+	report, err := d.store.LastIntegrityReport()
+	if err != nil {
+		return 0
+	}
+	return len(report.Issues) + len(report.Errors)
+}
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestIntegrityHandler(t *testing.T) {
+	h, store := setupHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.Integrity.ServeHTTP(rec, reqWithAuth("GET", "/integrity.json", adminCaps, adminID))
+	var report storage.IntegrityReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.CheckedAt.IsZero() || report.Issues == nil || len(report.Issues) != 0 {
+		t.Errorf("report before any check = %+v", report)
+	}
+
+	store.CreateDeployment("docs", "ddd44444")
+	if _, err := store.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Integrity.ServeHTTP(rec, reqWithAuth("GET", "/integrity.json", adminCaps, adminID))
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].DeploymentID != "ddd44444" ||
+		report.Issues[0].Action != storage.IntegrityQuarantined {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Integrity.ServeHTTP(rec, reqWithAuth("GET", "/integrity", adminCaps, adminID))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "ddd44444") || !strings.Contains(body, "Quarantined") {
+		t.Errorf("status = %d, body = %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Sites.ServeHTTP(rec, reqWithAuth("GET", "/sites", adminCaps, adminID))
+	if !strings.Contains(rec.Body.String(), `href="/integrity"`) {
+		t.Error("sites page lacks the integrity notice")
+	}
+}
+
+func TestIntegrityHandler_Forbidden(t *testing.T) {
+	h, store := setupHandlers(t)
+	store.CreateDeployment("docs", "ddd44444")
+	store.CheckIntegrity()
+
+	scoped := []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}
+	rec := httptest.NewRecorder()
+	h.Integrity.ServeHTTP(rec, reqWithAuth("GET", "/integrity.json", scoped, viewerID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Sites.ServeHTTP(rec, reqWithAuth("GET", "/sites", scoped, viewerID))
+	if strings.Contains(rec.Body.String(), `href="/integrity"`) {
+		t.Error("scoped admin sees the integrity notice")
+	}
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// --- GET /sites/{site}/live ---
+
+// SiteLiveHandler shows a site's requests as they are served. Browsers get
+// a page that streams them; requests accepting text/event-stream get the
+// stream itself, one "request" event per recorded request. Only requests
+// that analytics record are sent, so sites with analytics disabled and
+// visitors who opted out are left out.
+type SiteLiveHandler struct {
+	handlerDeps
+}
+
+func (h *SiteLiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if h.recorder == nil {
+		RenderError(w, r, http.StatusServiceUnavailable, "analytics not configured")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanViewAnalytics(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+	if !h.analyticsEnabled(siteName) {
+		RenderError(w, r, http.StatusNotFound, "analytics disabled for this site")
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		renderPage(w, r, siteLiveTmpl, "sites", struct {
+			Site      string
+			CanDeploy bool
+			User      UserInfo
+		}{siteName, auth.CanDeploy(caps, siteName), userInfo(auth.IdentityFromContext(r.Context()), caps)})
+		return
+	}
+
+	ch := make(chan analytics.Event, eventStreamBuffer)
+	unsubscribe := h.recorder.Subscribe(siteName, func(e analytics.Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventStreamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: request\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+)
+
+func TestSiteLiveHandler_StreamsRequests(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("site", "docs")
+		ctx := auth.ContextWithCaps(r.Context(), adminCaps)
+		hs.SiteLive.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/sites/docs/live", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	hs.SiteLive.recorder.Record(analytics.Event{Timestamp: time.Now(), Site: "demo", Path: "/other", Status: 200})
+	hs.SiteLive.recorder.Record(analytics.Event{Timestamp: time.Now(), Site: "docs", Path: "/guide", Status: 404, UserLogin: "alice@example.com"})
+
+	sc := bufio.NewScanner(resp.Body)
+	var typ string
+	var e analytics.Event
+	for sc.Scan() {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			typ = name
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+			json.Unmarshal([]byte(data), &e)
+			break
+		}
+	}
+	if typ != "request" || e.Path != "/guide" || e.Status != 404 || e.UserLogin != "alice@example.com" {
+		t.Errorf("got %s %+v, want the docs request to /guide", typ, e)
+	}
+}
+
+func TestSiteLiveHandler_Page(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := httptest.NewRequest("GET", "/sites/docs/live", nil)
+	req.SetPathValue("site", "docs")
+	req = req.WithContext(auth.ContextWithCaps(req.Context(), adminCaps))
+	rec := httptest.NewRecorder()
+	hs.SiteLive.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("status = %d, content-type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestSiteLiveHandler_Forbidden(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := httptest.NewRequest("GET", "/sites/docs/live", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.SetPathValue("site", "docs")
+	req = req.WithContext(auth.ContextWithCaps(req.Context(), viewerCaps))
+	rec := httptest.NewRecorder()
+	hs.SiteLive.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
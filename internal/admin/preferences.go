@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// PreferenceStore reads users' admin panel preferences. *storage.Store
+// implements it.
+type PreferenceStore interface {
+	Preferences(login string) (storage.Preferences, error)
+}
+
+// pageSettings are the options of NewHandlers that pages are rendered
+// with. Error pages are rendered outside of the handlers too, so they
+// travel in the request context; see Handlers.Middleware.
+type pageSettings struct {
+	prefs    PreferenceStore
+	readOnly *ReadOnlyMode
+	location *time.Location
+}
+
+type pageSettingsKey struct{}
+
+// Middleware makes pages rendered for requests passing through next follow
+// the options given to NewHandlers: the viewer's preferences, the read-only
+// banner, and the default timezone.
+func (h *Handlers) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pageSettingsKey{}, h.page)))
+	})
+}
+
+// requestPageSettings returns the page settings of r, or the defaults if
+// it did not pass through Handlers.Middleware.
+func requestPageSettings(r *http.Request) pageSettings {
+	if s, ok := r.Context().Value(pageSettingsKey{}).(pageSettings); ok {
+		return s
+	}
+	return pageSettings{location: time.UTC}
+}
+
+// requestPreferences returns the preferences of the user making r, or the
+// defaults if they have none or there is no preference store. Admins
+// previewing another user's access keep their own preferences.
+func requestPreferences(r *http.Request) storage.Preferences {
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if viewer, ok := auth.ViewerFromContext(r.Context()); ok {
+		login = viewer.LoginName
+	}
+	store := requestPageSettings(r).prefs
+	if store == nil || login == "" {
+		return storage.Preferences{}
+	}
+	prefs, err := store.Preferences(login)
+	if err != nil {
+		slog.WarnContext(r.Context(), "reading preferences failed", "err", err)
+		return storage.Preferences{}
+	}
+	return prefs
+}
+
+// requestLocation returns the timezone of the user making r, falling back
+// to the server's default.
+func requestLocation(r *http.Request) *time.Location {
+	return requestPreferences(r).Location(requestPageSettings(r).location)
+}
+
+// --- GET/PUT /preferences ---
+
+// PreferencesHandler reads and replaces the caller's admin panel
+// preferences. PUT takes the complete preferences as JSON; omitted fields
+// revert to their defaults.
+type PreferencesHandler struct{ handlerDeps }
+
+func (h *PreferencesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if login == "" {
+		RenderError(w, r, http.StatusForbidden, "preferences require a login name")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var prefs storage.Preferences
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&prefs); err != nil {
+			RenderError(w, r, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if err := prefs.Validate(); err != nil {
+			RenderError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := h.store.SetPreferences(login, prefs); err != nil {
+			RenderError(w, r, http.StatusInternalServerError, "saving preferences")
+			return
+		}
+		writeJSON(w, prefs)
+		return
+	}
+
+	prefs, err := h.store.Preferences(login)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "reading preferences")
+		return
+	}
+	writeJSON(w, prefs)
+}
+
+// --- GET / ---
+
+// LandingHandler redirects the control plane's root to the caller's
+// preferred landing page.
+type LandingHandler struct{}
+
+func (h *LandingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := requestPreferences(r).LandingPage
+	if !slices.Contains(storage.LandingPages, target) {
+		target = "/sites"
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestPreferencesHandler(t *testing.T) {
+	h, _ := setupHandlers(t)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := reqWithAuth("PUT", "/api/v1/preferences", viewerCaps, viewerID)
+		req.Body = io.NopCloser(strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.Preferences.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := put(`{"theme": "dark", "table_density": "compact"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := put(`{"theme": "sepia"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT invalid theme: status = %d, want 400", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Preferences.ServeHTTP(rec, reqWithAuth("GET", "/api/v1/preferences", viewerCaps, viewerID))
+	var got storage.Preferences
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (storage.Preferences{Theme: storage.ThemeDark, TableDensity: storage.DensityCompact}) {
+		t.Errorf("GET = %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Preferences.ServeHTTP(rec, reqWithAuth("GET", "/api/v1/preferences", viewerCaps, auth.Identity{}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET without login: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestRenderPage_AppliesPreferences(t *testing.T) {
+	store := setupStore(t)
+	h := NewHandlers(store, nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil, Options{Preferences: store})
+	store.SetPreferences(adminID.LoginName, storage.Preferences{
+		Theme: storage.ThemeDark, TableDensity: storage.DensityCompact, LandingPage: "/deployments",
+	})
+
+	rec := httptest.NewRecorder()
+	h.Middleware(h.Sites).ServeHTTP(rec, reqWithAuth("GET", "/sites", adminCaps, adminID))
+	body := rec.Body.String()
+	if !strings.Contains(body, `data-theme="dark"`) || !strings.Contains(body, `data-density="compact"`) {
+		t.Error("page does not carry the user's theme and density")
+	}
+
+	rec = httptest.NewRecorder()
+	h.Middleware(h.Landing).ServeHTTP(rec, reqWithAuth("GET", "/", adminCaps, adminID))
+	if loc := rec.Header().Get("Location"); loc != "/deployments" {
+		t.Errorf("landing redirect = %q, want /deployments", loc)
+	}
+	rec = httptest.NewRecorder()
+	h.Middleware(h.Landing).ServeHTTP(rec, reqWithAuth("GET", "/", viewerCaps, viewerID))
+	if loc := rec.Header().Get("Location"); loc != "/sites" {
+		t.Errorf("default landing redirect = %q, want /sites", loc)
+	}
+}
@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+)
+
+// readOnlyMessageLimit caps the length of a read-only mode message.
+const readOnlyMessageLimit = 500
+
+// ReadOnlyState describes the control plane's read-only mode.
+type ReadOnlyState struct {
+	Enabled bool `json:"enabled"`
+	// Message explains the read-only mode to callers, such as the reason
+	// for a maintenance window.
+	Message string `json:"message,omitempty"`
+	// Since and By record when and by whom the mode was last switched at
+	// runtime. They are empty if it was set by the config file.
+	Since *time.Time `json:"since,omitempty"`
+	By    string     `json:"by,omitempty"`
+}
+
+// ReadOnlyMode is a runtime switch that rejects changes to the control
+// plane while keeping its pages, the API's read endpoints, and the sites
+// themselves available.
+type ReadOnlyMode struct {
+	mu    sync.RWMutex
+	state ReadOnlyState
+}
+
+// NewReadOnlyMode returns a ReadOnlyMode that starts enabled or disabled,
+// as configured.
+func NewReadOnlyMode(enabled bool, message string) *ReadOnlyMode {
+	return &ReadOnlyMode{state: ReadOnlyState{Enabled: enabled, Message: message}}
+}
+
+// State returns the current read-only state.
+func (m *ReadOnlyMode) State() ReadOnlyState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Set replaces the read-only state.
+func (m *ReadOnlyMode) Set(state ReadOnlyState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+}
+
+// Middleware rejects every request other than GET and HEAD with 503 while
+// read-only mode is enabled.
+func (m *ReadOnlyMode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		state := m.State()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		detail := "the control plane is in read-only mode"
+		if state.Message != "" {
+			detail += ": " + state.Message
+		}
+		problem.Write(w, http.StatusServiceUnavailable, problem.ReadOnly, detail)
+	})
+}
+
+// ReadOnlyRequest is the body of PUT /read-only.
+type ReadOnlyRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// --- GET, PUT /read-only ---
+
+// ReadOnlyHandler reports and switches the control plane's read-only mode.
+// Anyone may read it; switching it requires an admin capability covering
+// all sites. It must be routed around ReadOnlyMode.Middleware, so that the
+// mode can be disabled again.
+type ReadOnlyHandler struct {
+	mode *ReadOnlyMode
+}
+
+func NewReadOnlyHandler(mode *ReadOnlyMode) *ReadOnlyHandler {
+	return &ReadOnlyHandler{mode: mode}
+}
+
+func (h *ReadOnlyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, h.mode.State())
+		return
+	}
+
+	if !auth.CanSetReadOnly(auth.CapsFromContext(r.Context())) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	var req ReadOnlyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		RenderError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(req.Message) > readOnlyMessageLimit {
+		RenderError(w, r, http.StatusBadRequest, "message is too long")
+		return
+	}
+	now := time.Now().UTC()
+	state := ReadOnlyState{
+		Enabled: req.Enabled,
+		Message: req.Message,
+		Since:   &now,
+		By:      auth.IdentityFromContext(r.Context()).LoginName,
+	}
+	h.mode.Set(state)
+	slog.InfoContext(r.Context(), "read-only mode switched", "enabled", state.Enabled, "message", state.Message, "by", state.By)
+	writeJSON(w, state)
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+func putReadOnly(body string, caps []auth.Cap) *http.Request {
+	r := httptest.NewRequest("PUT", "/read-only", strings.NewReader(body))
+	ctx := auth.ContextWithCaps(r.Context(), caps)
+	ctx = auth.ContextWithIdentity(ctx, adminID)
+	return r.WithContext(ctx)
+}
+
+func TestReadOnlyMode_Middleware(t *testing.T) {
+	mode := NewReadOnlyMode(true, "migrating storage")
+	h := mode.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, method := range []string{"GET", "HEAD"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/sites", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s status = %d, want reads to pass", method, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/deploy/docs", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST status = %d, want 503", rec.Code)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != problem.ReadOnly || !strings.Contains(p.Detail, "migrating storage") {
+		t.Errorf("problem = %+v", p)
+	}
+
+	mode.Set(ReadOnlyState{})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/deploy/docs", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status after disabling = %d, want it to pass", rec.Code)
+	}
+}
+
+func TestReadOnlyHandler(t *testing.T) {
+	mode := NewReadOnlyMode(false, "")
+	h := NewReadOnlyHandler(mode)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, putReadOnly(`{"enabled":true,"message":"back at noon"}`, adminCaps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	state := mode.State()
+	if !state.Enabled || state.Message != "back at noon" || state.By != adminID.LoginName || state.Since == nil {
+		t.Errorf("state = %+v", state)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, reqWithAuth("GET", "/read-only", viewerCaps, viewerID))
+	var got ReadOnlyState
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Enabled || got.Message != "back at noon" {
+		t.Errorf("GET state = %+v", got)
+	}
+}
+
+func TestReadOnlyHandler_Rejects(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		body string
+		caps []auth.Cap
+		want int
+	}{
+		{"scoped admin", `{"enabled":true}`, []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}, http.StatusForbidden},
+		{"deployer", `{"enabled":true}`, []auth.Cap{{Access: "deploy"}}, http.StatusForbidden},
+		{"invalid body", `enabled`, adminCaps, http.StatusBadRequest},
+		{"long message", `{"enabled":true,"message":"` + strings.Repeat("x", readOnlyMessageLimit+1) + `"}`, adminCaps, http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := NewReadOnlyMode(false, "")
+			rec := httptest.NewRecorder()
+			NewReadOnlyHandler(mode).ServeHTTP(rec, putReadOnly(tt.body, tt.caps))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if mode.State().Enabled {
+				t.Error("rejected request enabled read-only mode")
+			}
+		})
+	}
+}
+
+func TestLayout_ReadOnlyBanner(t *testing.T) {
+	h := NewHandlers(setupStore(t), nil, "test.ts.net", &mockEnsurer{}, &mockEnsurer{}, storage.SiteConfig{}, nil, nil,
+		Options{ReadOnly: NewReadOnlyMode(true, "Back at noon.")})
+
+	rec := httptest.NewRecorder()
+	h.Middleware(h.Sites).ServeHTTP(rec, reqWithAuth("GET", "/sites", adminCaps, adminID))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Read-only mode") || !strings.Contains(body, "Back at noon.") || !strings.Contains(body, "data-read-only") {
+		t.Errorf("page lacks the read-only banner: %s", body)
+	}
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"tspages/internal/multihost"
+)
+
+// --- GET /readyz ---
+
+// StartupReporter reports the progress of starting the site servers.
+type StartupReporter interface {
+	Startup() multihost.Startup
+}
+
+// ReadyHandler reports whether the servers of the existing sites have been
+// started, for orchestrator readiness probes. It is unauthenticated.
+type ReadyHandler struct {
+	reporter StartupReporter
+}
+
+func NewReadyHandler(reporter StartupReporter) *ReadyHandler {
+	return &ReadyHandler{reporter: reporter}
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	startup := h.reporter.Startup()
+
+	code := http.StatusOK
+	if startup.State != multihost.StartupReady {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(startup); err != nil {
+		slog.WarnContext(r.Context(), "encoding readiness response failed", "err", err)
+	}
+}
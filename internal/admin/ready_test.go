@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tspages/internal/multihost"
+)
+
+type mockReporter struct{ startup multihost.Startup }
+
+func (m *mockReporter) Startup() multihost.Startup { return m.startup }
+
+func TestReadyHandler(t *testing.T) {
+	tests := []struct {
+		state string
+		code  int
+	}{
+		{multihost.StartupPending, http.StatusServiceUnavailable},
+		{multihost.StartupStarting, http.StatusServiceUnavailable},
+		{multihost.StartupReady, http.StatusOK},
+		{multihost.StartupFailed, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		h := NewReadyHandler(&mockReporter{multihost.Startup{
+			State:   tt.state,
+			Total:   3,
+			Started: 2,
+			Failed:  []multihost.StartupFailure{{Site: "docs", Error: "listen: address in use", Attempts: 1}},
+		}})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.state, rec.Code, tt.code)
+		}
+		var resp multihost.Startup
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.State != tt.state || resp.Started != 2 || len(resp.Failed) != 1 || resp.Failed[0].Site != "docs" {
+			t.Errorf("%s: response = %+v", tt.state, resp)
+		}
+	}
+}
@@ -19,6 +19,9 @@ import (
 	"time"
 
 	"tspages/internal/auth"
+	"tspages/internal/bytesize"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 )
 
@@ -40,6 +43,20 @@ func OpenAPIHandler() http.Handler {
 	})
 }
 
+// SiteConfigSchemaHandler returns an http.Handler that serves the JSON
+// Schema of tspages.toml, for editors and tools to validate site configs.
+func SiteConfigSchemaHandler() http.Handler {
+	schema, err := json.MarshalIndent(storage.SiteConfigSchema(), "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("encoding site config schema: %v", err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		_, _ = w.Write(schema)
+	})
+}
+
 // SwaggerUIHandler returns an http.Handler that serves the Swagger UI,
 // pointed at the local OpenAPI spec, themed to match the admin panel.
 // It is served standalone at /openapi and embedded via iframe at /api.
@@ -203,6 +220,7 @@ var (
 	devModeFlag    atomic.Bool
 	devTmplDir     string // set once before server starts, read-only after
 	hideFooterFlag bool   // set once before server starts, read-only after
+	noViewAsFlag   bool   // set once before server starts, read-only after
 )
 
 // EnableDevMode activates development mode: templates are re-parsed from
@@ -217,6 +235,10 @@ func EnableDevMode(tmplDir string) {
 // Must be called before the HTTP server starts.
 func SetHideFooter(v bool) { hideFooterFlag = v }
 
+// DisableViewAs hides the "view as" form, for setups without a way to look
+// up other users. Must be called before the HTTP server starts.
+func DisableViewAs() { noViewAsFlag = true }
+
 // DevAssetProxy returns a reverse proxy that forwards requests to the
 // Vite dev server at localhost:5173.
 func DevAssetProxy() http.Handler {
@@ -343,7 +365,9 @@ func newTmpl(files ...string) *tmpl {
 
 var funcs = template.FuncMap{
 	"nav":        func() string { return "" }, // placeholder; overridden per-render
+	"viewer":     func() string { return "" }, // placeholder; overridden per-render
 	"hideFooter": func() bool { return hideFooterFlag },
+	"readOnly":   func() ReadOnlyState { return ReadOnlyState{} }, // placeholder; overridden per-render
 	"asset": func(key string) string {
 		if devModeFlag.Load() {
 			return "/web/admin/src/" + key
@@ -394,33 +418,15 @@ var funcs = template.FuncMap{
 			return fmt.Sprintf("%dy ago", int(d.Hours()/(24*365)))
 		}
 	},
-	"abstime": func(v any) string {
-		var t time.Time
-		switch x := v.(type) {
-		case time.Time:
-			t = x
-		case string:
-			if x == "" {
-				return ""
-			}
-			parsed, err := time.Parse(time.RFC3339, x)
-			if err != nil {
-				return x
-			}
-			t = parsed
-		default:
-			return ""
-		}
-		if t.IsZero() {
-			return ""
-		}
-		return t.Format("2006-01-02 15:04 MST")
-	},
+	"abstime":  func(v any) string { return abstime(v, time.UTC) },  // placeholder; overridden per-render
+	"timezone": func() string { return time.UTC.String() },          // placeholder; overridden per-render
+	"theme":    func() string { return storage.ThemeSystem },        // placeholder; overridden per-render
+	"density":  func() string { return storage.DensityComfortable }, // placeholder; overridden per-render
 	"bytes": func(n int64) string {
 		if n == 0 {
 			return "\u2014"
 		}
-		return formatBytes(n)
+		return bytesize.Format(n)
 	},
 	"pct": func(count, max int64) int {
 		if max == 0 {
@@ -499,11 +505,11 @@ var funcs = template.FuncMap{
 		}
 		return items[:n]
 	},
-	"siteurl": func(name, dnsSuffix string) string {
+	"siteurl": func(hostname, dnsSuffix string) string {
 		if dnsSuffix == "" {
 			return ""
 		}
-		return "https://" + name + "." + dnsSuffix
+		return "https://" + hostname + "." + dnsSuffix
 	},
 }
 
@@ -518,6 +524,14 @@ var (
 	webhooksTmpl        = newTmpl("templates/layout.gohtml", "templates/webhooks.gohtml")
 	webhookDetailTmpl   = newTmpl("templates/layout.gohtml", "templates/webhook.gohtml")
 	siteDeploymentsTmpl = newTmpl("templates/layout.gohtml", "templates/site-deployments.gohtml")
+	siteActivityTmpl    = newTmpl("templates/layout.gohtml", "templates/site-activity.gohtml")
+	siteLiveTmpl        = newTmpl("templates/layout.gohtml", "templates/site-live.gohtml")
+	siteFilesTmpl       = newTmpl("templates/layout.gohtml", "templates/site-files.gohtml")
+	trashTmpl           = newTmpl("templates/layout.gohtml", "templates/trash.gohtml")
+	integrityTmpl       = newTmpl("templates/layout.gohtml", "templates/integrity.gohtml")
+	verificationTmpl    = newTmpl("templates/layout.gohtml", "templates/verification.gohtml")
+	userActivityTmpl    = newTmpl("templates/layout.gohtml", "templates/user-activity.gohtml")
+	whoamiTmpl          = newTmpl("templates/layout.gohtml", "templates/whoami.gohtml")
 	errorTmpl           = newTmpl("templates/layout.gohtml", "templates/error.gohtml")
 )
 
@@ -563,7 +577,7 @@ func renderPage(w http.ResponseWriter, r *http.Request, t *tmpl, nav string, dat
 		}
 		parsed, err := template.New("").Funcs(funcs).ParseFiles(paths...)
 		if err != nil {
-			slog.Error("template parse failed", "nav", nav, "err", err)
+			slog.ErrorContext(r.Context(), "template parse failed", "nav", nav, "err", err)
 			RenderError(w, r, http.StatusInternalServerError, "template error")
 			return
 		}
@@ -571,14 +585,14 @@ func renderPage(w http.ResponseWriter, r *http.Request, t *tmpl, nav string, dat
 	}
 	tpl, err := tpl.Clone()
 	if err != nil {
-		slog.Error("template clone failed", "nav", nav, "err", err)
+		slog.ErrorContext(r.Context(), "template clone failed", "nav", nav, "err", err)
 		RenderError(w, r, http.StatusInternalServerError, "rendering page")
 		return
 	}
-	tpl.Funcs(template.FuncMap{"nav": func() string { return nav }})
+	tpl.Funcs(requestFuncs(r, nav))
 	var buf bytes.Buffer
 	if err := tpl.ExecuteTemplate(&buf, "layout", data); err != nil {
-		slog.Error("template execution failed", "nav", nav, "err", err)
+		slog.ErrorContext(r.Context(), "template execution failed", "nav", nav, "err", err)
 		RenderError(w, r, http.StatusInternalServerError, "rendering page")
 		return
 	}
@@ -586,16 +600,94 @@ func renderPage(w http.ResponseWriter, r *http.Request, t *tmpl, nav string, dat
 	_, _ = buf.WriteTo(w)
 }
 
-// RenderError sends an error response. For JSON requests it returns
-// {"error": msg}; for HTML requests it renders a styled error page
-// within the admin layout. The status code is set on the response.
+// requestFuncs returns the template funcs that depend on the request: the
+// current navigation entry, the view-as viewer, the user's preferences, and
+// read-only mode.
+func requestFuncs(r *http.Request, nav string) template.FuncMap {
+	settings := requestPageSettings(r)
+	prefs := requestPreferences(r)
+	loc := prefs.Location(settings.location)
+	var readOnly ReadOnlyState
+	if settings.readOnly != nil {
+		readOnly = settings.readOnly.State()
+	}
+	theme := prefs.Theme
+	if theme == "" {
+		theme = storage.ThemeSystem
+	}
+	density := prefs.TableDensity
+	if density == "" {
+		density = storage.DensityComfortable
+	}
+	return template.FuncMap{
+		"nav":      func() string { return nav },
+		"viewer":   viewerFunc(r),
+		"theme":    func() string { return theme },
+		"density":  func() string { return density },
+		"abstime":  func(v any) string { return abstime(v, loc) },
+		"timezone": func() string { return loc.String() },
+		"readOnly": func() ReadOnlyState { return readOnly },
+	}
+}
+
+// abstime formats a time.Time or RFC 3339 string in loc, returning "" for
+// zero and unparseable values.
+func abstime(v any, loc *time.Location) string {
+	var t time.Time
+	switch x := v.(type) {
+	case time.Time:
+		t = x
+	case string:
+		if x == "" {
+			return ""
+		}
+		parsed, err := time.Parse(time.RFC3339, x)
+		if err != nil {
+			return x
+		}
+		t = parsed
+	default:
+		return ""
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).Format("2006-01-02 15:04 MST")
+}
+
+// viewerFunc returns the "viewer" template func for a request: the name of
+// the admin previewing another user's access, or "" outside view-as mode.
+func viewerFunc(r *http.Request) func() string {
+	viewer, ok := auth.ViewerFromContext(r.Context())
+	if !ok {
+		return func() string { return "" }
+	}
+	name := viewer.DisplayName
+	if name == "" {
+		name = viewer.LoginName
+	}
+	if name == "" {
+		name = "admin"
+	}
+	return func() string { return name }
+}
+
+// RenderError sends an error response with the generic problem code for
+// the status. See RenderProblem.
 func RenderError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	RenderProblem(w, r, code, problem.CodeFor(code), msg)
+}
+
+// RenderProblem sends an error response. For JSON requests it returns
+// problem details carrying problemCode; for HTML requests it renders a
+// styled error page within the admin layout. Both include the request ID
+// and suggest what to do next. The status code is set on the response.
+func RenderProblem(w http.ResponseWriter, r *http.Request, code int, problemCode problem.Code, msg string) {
+	details := problem.New(code, problemCode, msg)
+	details.RequestID = httplog.RequestID(r.Context())
+	details.Actions = errorActions(w, r, code, problemCode)
 	if wantsJSON(r) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
-			slog.Warn("encoding JSON error response failed", "err", err)
-		}
+		problem.Send(w, code, details)
 		return
 	}
 
@@ -606,7 +698,13 @@ func RenderError(w http.ResponseWriter, r *http.Request, code int, msg string) {
 		Code       int
 		StatusText string
 		Message    string
-	}{userInfo(identity, caps), code, http.StatusText(code), msg}
+		Problem    problem.Details
+		// RetryURL reloads the page after a server error.
+		RetryURL string
+	}{User: userInfo(identity, caps), Code: code, StatusText: http.StatusText(code), Message: errorDescription(code, msg), Problem: details}
+	if code >= 500 && r.Method == http.MethodGet {
+		data.RetryURL = r.URL.RequestURI()
+	}
 
 	tpl := errorTmpl.cached
 	if devModeFlag.Load() {
@@ -623,7 +721,7 @@ func RenderError(w http.ResponseWriter, r *http.Request, code int, msg string) {
 		http.Error(w, msg, code)
 		return
 	}
-	tpl.Funcs(template.FuncMap{"nav": func() string { return "" }})
+	tpl.Funcs(requestFuncs(r, ""))
 	var buf bytes.Buffer
 	if err := tpl.ExecuteTemplate(&buf, "layout", data); err != nil {
 		http.Error(w, msg, code)
@@ -633,13 +731,3 @@ func RenderError(w http.ResponseWriter, r *http.Request, code int, msg string) {
 	w.WriteHeader(code)
 	_, _ = buf.WriteTo(w)
 }
-
-func formatBytes(n int64) string {
-	if n < 1024 {
-		return fmt.Sprintf("%d B", n)
-	}
-	if n < 1024*1024 {
-		return fmt.Sprintf("%.1f KB", float64(n)/1024)
-	}
-	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
-}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// --- POST /sites/{site}/server/restart ---
+
+// RestartServerResponse is the JSON response for POST
+// /sites/{site}/server/restart.
+type RestartServerResponse struct {
+	Site        string `json:"site"`
+	RestartedBy string `json:"restarted_by"`
+}
+
+// RestartServerHandler tears down a site's tsnet server and listeners and
+// starts them anew, for when a listener is wedged. Other sites' servers are
+// left alone. Each attempt is published as server.restarted, which records
+// it in the site's activity log.
+type RestartServerHandler struct {
+	handlerDeps
+	ensurer SiteEnsurer
+	events  *events.Bus
+}
+
+func (h *RestartServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.IsAdmin(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	identity := auth.IdentityFromContext(r.Context())
+	restartedBy := identity.DisplayName
+	if restartedBy == "" {
+		restartedBy = identity.LoginName
+	}
+	slog.InfoContext(r.Context(), "restarting site server", "site", siteName, "restarted_by", restartedBy)
+	err := h.ensurer.RestartServer(siteName)
+
+	if h.events != nil {
+		data := map[string]any{"site": siteName, "restarted_by": restartedBy}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		h.events.Publish(events.Event{
+			Type:      events.ServerRestarted,
+			Site:      siteName,
+			RequestID: httplog.RequestID(r.Context()),
+			Data:      data,
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "restarting site server failed", "site", siteName, "err", err)
+		RenderError(w, r, http.StatusInternalServerError, fmt.Sprintf("restarting server: %v", err))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, RestartServerResponse{Site: siteName, RestartedBy: restartedBy})
+		return
+	}
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+func TestRestartServerHandler(t *testing.T) {
+	store := setupStore(t)
+	ensurer := &mockEnsurer{}
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	hs := NewHandlers(store, nil, "test.ts.net", ensurer, ensurer, storage.SiteConfig{}, nil, bus, Options{})
+
+	req := reqWithAuth("POST", "/sites/docs/server/restart", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.RestartServer.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp RestartServerResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp != (RestartServerResponse{Site: "docs", RestartedBy: "Admin"}) {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(ensurer.restarted) != 1 || ensurer.restarted[0] != "docs" {
+		t.Errorf("restarted = %v, want [docs]", ensurer.restarted)
+	}
+	if len(got) != 1 || got[0].Type != events.ServerRestarted || got[0].Site != "docs" || got[0].Data["restarted_by"] != "Admin" {
+		t.Errorf("events = %+v, want a server restart by Admin", got)
+	}
+
+	// The site page offers the restart to admins, behind a confirmation.
+	req = reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, `action="/sites/docs/server/restart"`) || !strings.Contains(body, "confirm(") {
+		t.Error("site page lacks the restart form")
+	}
+}
+
+func TestRestartServerHandler_Rejects(t *testing.T) {
+	store := setupStore(t)
+	tests := []struct {
+		name string
+		site string
+		caps []auth.Cap
+		want int
+	}{
+		{"deployer", "docs", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, http.StatusForbidden},
+		{"admin of other site", "docs", []auth.Cap{{Access: "admin", Sites: []string{"demo"}}}, http.StatusForbidden},
+		{"missing site", "nope", adminCaps, http.StatusNotFound},
+		{"invalid site", "-bad", adminCaps, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ensurer := &mockEnsurer{}
+			hs := NewHandlers(store, nil, "test.ts.net", ensurer, ensurer, storage.SiteConfig{}, nil, nil, Options{})
+			req := reqWithAuth("POST", "/sites/"+tt.site+"/server/restart", tt.caps, viewerID)
+			req.SetPathValue("site", tt.site)
+			rec := httptest.NewRecorder()
+			hs.RestartServer.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if len(ensurer.restarted) != 0 {
+				t.Errorf("restarted = %v, want none", ensurer.restarted)
+			}
+		})
+	}
+}
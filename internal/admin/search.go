@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"tspages/internal/auth"
+	"tspages/internal/webhook"
+)
+
+// Result kinds returned by GET /search.
+const (
+	SearchSite       = "site"
+	SearchDeployment = "deployment"
+	SearchWebhook    = "webhook"
+	SearchHelp       = "help"
+)
+
+const (
+	// searchLimit caps the results of each kind.
+	searchLimit = 5
+	// maxSearchQuery caps the query length in characters.
+	maxSearchQuery = 100
+)
+
+// SearchResult is a single match for a search query.
+type SearchResult struct {
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+	URL    string `json:"url"`
+	Site   string `json:"site,omitempty"`
+}
+
+// SearchResponse is the JSON response for GET /search.
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+// --- GET /search ---
+
+// SearchHandler searches everything the caller can see: sites, deployments
+// by ID or deployer, webhook deliveries by ID, and the help pages. Results
+// are grouped by kind, best matches first within each group.
+type SearchHandler struct {
+	handlerDeps
+	notifier *webhook.Notifier
+}
+
+func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(query) > maxSearchQuery {
+		RenderError(w, r, http.StatusBadRequest, "query is too long")
+		return
+	}
+	resp := SearchResponse{Query: query, Results: []SearchResult{}}
+	if query == "" {
+		writeJSON(w, resp)
+		return
+	}
+
+	sites, err := h.store.ListSites()
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing sites")
+		return
+	}
+
+	var siteMatches, deployMatches []scoredResult
+	var deployments []DeploymentEntry
+	for _, s := range sites {
+		if !auth.CanView(caps, s.Name) {
+			continue
+		}
+		if score := matchScore(query, s.Name); score > 0 {
+			detail := h.siteHostname(s.Name) + "." + h.dnsSuffix
+			if s.ActiveDeploymentID == "" {
+				detail = "No active deployment"
+			}
+			siteMatches = append(siteMatches, scoredResult{score, SearchResult{
+				Kind: SearchSite, Title: s.Name, Detail: detail, URL: "/sites/" + s.Name, Site: s.Name,
+			}})
+		}
+		if !auth.CanDeploy(caps, s.Name) {
+			continue
+		}
+		deps, err := h.store.ListDeployments(s.Name)
+		if err != nil {
+			slog.WarnContext(r.Context(), "listing deployments failed", "site", s.Name, "err", err)
+			continue
+		}
+		for _, d := range deps {
+			deployments = append(deployments, DeploymentEntry{DeploymentInfo: d, Site: s.Name})
+		}
+	}
+
+	// Newest first, so that equally good matches favor recent deployments.
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
+	})
+	for _, d := range deployments {
+		score := max(matchScore(query, d.ID), matchScore(query, d.CreatedBy))
+		if score == 0 {
+			continue
+		}
+		detail := d.Site
+		if d.CreatedBy != "" {
+			detail += " · by " + d.CreatedBy
+		}
+		if !d.CreatedAt.IsZero() {
+			detail += " · " + d.CreatedAt.In(requestLocation(r)).Format("2006-01-02 15:04")
+		}
+		deployMatches = append(deployMatches, scoredResult{score, SearchResult{
+			Kind: SearchDeployment, Title: d.ID, Detail: detail, URL: "/sites/" + d.Site + "/deployments/" + d.ID, Site: d.Site,
+		}})
+	}
+
+	resp.Results = append(resp.Results, topResults(siteMatches)...)
+	resp.Results = append(resp.Results, topResults(deployMatches)...)
+	resp.Results = append(resp.Results, h.searchWebhooks(r, caps, query)...)
+	resp.Results = append(resp.Results, searchHelp(query)...)
+
+	writeJSON(w, resp)
+}
+
+// searchWebhooks returns the deliveries whose ID contains query, for sites
+// the caller can deploy to.
+func (h *SearchHandler) searchWebhooks(r *http.Request, caps []auth.Cap, query string) []SearchResult {
+	if h.notifier == nil || !auth.HasDeployCap(caps) {
+		return nil
+	}
+	// Fetch extra deliveries, since some may belong to sites the caller
+	// cannot see.
+	deliveries, err := h.notifier.FindDeliveries(query, searchLimit*4)
+	if err != nil {
+		slog.WarnContext(r.Context(), "searching webhook deliveries failed", "err", err)
+		return nil
+	}
+	var results []SearchResult
+	for _, d := range deliveries {
+		if !auth.CanDeploy(caps, d.Site) {
+			continue
+		}
+		status := "failed"
+		if d.Succeeded {
+			status = "delivered"
+		}
+		results = append(results, SearchResult{
+			Kind: SearchWebhook, Title: d.WebhookID, Detail: d.Event + " · " + d.Site + " · " + status,
+			URL: "/webhooks/" + d.WebhookID, Site: d.Site,
+		})
+		if len(results) == searchLimit {
+			break
+		}
+	}
+	return results
+}
+
+// searchHelp returns the help pages and sections mentioning query, ranking
+// matches in titles and headings above matches in the text.
+func searchHelp(query string) []SearchResult {
+	var matches []scoredResult
+	seen := make(map[string]bool)
+	for _, s := range docSections() {
+		score := max(matchScore(query, s.Page.Title), matchScore(query, s.Heading))
+		if score == 0 && strings.Contains(strings.ToLower(s.Text), strings.ToLower(query)) {
+			score = 1
+		}
+		if score == 0 {
+			continue
+		}
+		title := s.Page.Title
+		if s.Heading != "" {
+			title += " › " + s.Heading
+		}
+		if seen[title] {
+			continue
+		}
+		seen[title] = true
+		matches = append(matches, scoredResult{score, SearchResult{
+			Kind: SearchHelp, Title: title, URL: "/help/" + s.Page.Slug,
+		}})
+	}
+	return topResults(matches)
+}
+
+type scoredResult struct {
+	score  int
+	result SearchResult
+}
+
+// topResults returns the searchLimit highest scoring results, keeping the
+// order of equally scored ones.
+func topResults(matches []scoredResult) []SearchResult {
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	results := make([]SearchResult, 0, min(len(matches), searchLimit))
+	for _, m := range matches[:min(len(matches), searchLimit)] {
+		results = append(results, m.result)
+	}
+	return results
+}
+
+// matchScore rates how well s matches query, ignoring case: 4 for an exact
+// match, 3 for a prefix, 2 for a substring, and 0 for no match.
+func matchScore(query, s string) int {
+	q, v := strings.ToLower(query), strings.ToLower(s)
+	switch {
+	case v == "":
+		return 0
+	case v == q:
+		return 4
+	case strings.HasPrefix(v, q):
+		return 3
+	case strings.Contains(v, q):
+		return 2
+	}
+	return 0
+}
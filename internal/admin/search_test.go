@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+)
+
+func search(t *testing.T, h *SearchHandler, query string, caps []auth.Cap) SearchResponse {
+	t.Helper()
+	req := reqWithAuth("GET", "/search?q="+url.QueryEscape(query), caps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func resultsOfKind(resp SearchResponse, kind string) []string {
+	var titles []string
+	for _, r := range resp.Results {
+		if r.Kind == kind {
+			titles = append(titles, r.Title)
+		}
+	}
+	return titles
+}
+
+func TestSearchHandler_FindsEachKind(t *testing.T) {
+	h, _, _, db := setupHandlersWithNotifier(t)
+	webhookID := insertDelivery(t, db, "docs", 200)
+
+	if got := resultsOfKind(search(t, h.Search, "doc", adminCaps), SearchSite); len(got) != 1 || got[0] != "docs" {
+		t.Errorf("sites = %v, want [docs]", got)
+	}
+	if got := resultsOfKind(search(t, h.Search, "aaa1", adminCaps), SearchDeployment); len(got) != 1 || got[0] != "aaa11111" {
+		t.Errorf("deployments by ID = %v, want [aaa11111]", got)
+	}
+	if got := resultsOfKind(search(t, h.Search, "bob", adminCaps), SearchDeployment); len(got) != 1 || got[0] != "bbb22222" {
+		t.Errorf("deployments by deployer = %v, want [bbb22222]", got)
+	}
+	if got := resultsOfKind(search(t, h.Search, webhookID, adminCaps), SearchWebhook); len(got) != 1 || got[0] != webhookID {
+		t.Errorf("webhooks = %v, want [%s]", got, webhookID)
+	}
+
+	help := search(t, h.Search, "redirect rules", adminCaps)
+	if len(help.Results) == 0 || help.Results[0].Kind != SearchHelp || !strings.HasPrefix(help.Results[0].URL, "/help/") {
+		t.Errorf("help results = %+v", help.Results)
+	}
+}
+
+func TestSearchHandler_FilteredByAccess(t *testing.T) {
+	h, _, _, db := setupHandlersWithNotifier(t)
+	insertDelivery(t, db, "demo", 200)
+	caps := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+
+	resp := search(t, h.Search, "msg_test", caps)
+	if got := resultsOfKind(resp, SearchWebhook); len(got) != 0 {
+		t.Errorf("webhooks = %v, want none for demo", got)
+	}
+	resp = search(t, h.Search, "bbb", caps)
+	if got := resultsOfKind(resp, SearchDeployment); len(got) != 0 {
+		t.Errorf("deployments = %v, want none for demo", got)
+	}
+	resp = search(t, h.Search, "d", viewerCaps)
+	if got := resultsOfKind(resp, SearchSite); len(got) != 1 || got[0] != "docs" {
+		t.Errorf("sites = %v, want [docs]", got)
+	}
+	if got := resultsOfKind(resp, SearchDeployment); len(got) != 0 {
+		t.Errorf("viewer got deployments %v", got)
+	}
+}
+
+func TestSearchHandler_EmptyAndLongQueries(t *testing.T) {
+	h, _ := setupHandlers(t)
+	if resp := search(t, h.Search, "", adminCaps); resp.Results == nil || len(resp.Results) != 0 {
+		t.Errorf("empty query results = %#v, want an empty list", resp.Results)
+	}
+
+	req := reqWithAuth("GET", "/search?q="+strings.Repeat("a", maxSearchQuery+1), adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.Search.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	for _, tt := range []struct {
+		query, s string
+		want     int
+	}{
+		{"docs", "Docs", 4},
+		{"do", "docs", 3},
+		{"oc", "docs", 2},
+		{"x", "docs", 0},
+		{"x", "", 0},
+	} {
+		if got := matchScore(tt.query, tt.s); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %d, want %d", tt.query, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/serve"
+	"tspages/internal/storage"
+)
+
+const (
+	// defaultShareLifetime applies when a share request names no expiry.
+	defaultShareLifetime = 24 * time.Hour
+	// maxShareLifetime caps how long a share link stays valid.
+	maxShareLifetime = 30 * 24 * time.Hour
+)
+
+// ShareResponse is a share together with its link.
+type ShareResponse struct {
+	storage.Share
+	URL    string `json:"url"`
+	Active bool   `json:"active"`
+}
+
+func (h handlerDeps) shareResponse(site string, sh storage.Share) ShareResponse {
+	url := serve.SharePrefix + sh.Token + sh.Path
+	if h.dnsSuffix != "" {
+		url = "https://" + h.siteHostname(site) + "." + h.dnsSuffix + url
+	}
+	return ShareResponse{Share: sh, URL: url, Active: sh.Active(time.Now())}
+}
+
+// shareActor names the caller in a share's audit fields.
+func shareActor(r *http.Request) string {
+	identity := auth.IdentityFromContext(r.Context())
+	if identity.LoginName != "" {
+		return identity.LoginName
+	}
+	return identity.DisplayName
+}
+
+// --- GET /sites/{site}/shares ---
+
+// SharesHandler lists a site's share links, including expired and revoked
+// ones, as JSON.
+type SharesHandler struct {
+	handlerDeps
+}
+
+func (h *SharesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanShare(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if _, err := h.store.GetSite(siteName); err != nil {
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	shares, err := h.store.ListShares(siteName)
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing shares")
+		return
+	}
+	resp := make([]ShareResponse, len(shares))
+	for i, sh := range shares {
+		resp[i] = h.shareResponse(siteName, sh)
+	}
+	writeJSON(w, resp)
+}
+
+// --- POST /sites/{site}/shares ---
+
+// CreateShareHandler mints a share link. The form value path names a file,
+// or a directory when it ends in "/"; expires_in is a duration such as
+// "72h", defaulting to 24 hours and capped at 30 days.
+type CreateShareHandler struct {
+	handlerDeps
+}
+
+func (h *CreateShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanShare(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	sharePath := r.FormValue("path")
+	if !storage.ValidSharePath(sharePath) {
+		RenderError(w, r, http.StatusBadRequest, "path must be a clean absolute path, such as /report.html or /docs/")
+		return
+	}
+	lifetime := defaultShareLifetime
+	if v := r.FormValue("expires_in"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxShareLifetime {
+			RenderError(w, r, http.StatusBadRequest, "expires_in must be a duration of at most 720h")
+			return
+		}
+		lifetime = d
+	}
+
+	now := time.Now().UTC()
+	sh, err := h.store.CreateShare(siteName, storage.Share{
+		Path:      sharePath,
+		CreatedAt: now,
+		CreatedBy: shareActor(r),
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
+			return
+		}
+		RenderError(w, r, http.StatusInternalServerError, "creating share")
+		return
+	}
+	slog.InfoContext(r.Context(), "share created", "site", siteName, "share", sh.ID, "path", sh.Path,
+		"by", sh.CreatedBy, "expires", sh.ExpiresAt)
+
+	if wantsJSON(r) {
+		writeJSON(w, h.shareResponse(siteName, sh))
+		return
+	}
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
+
+// --- POST /sites/{site}/shares/{id}/revoke ---
+
+// RevokeShareHandler ends a share link before it expires.
+type RevokeShareHandler struct {
+	handlerDeps
+}
+
+func (h *RevokeShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanShare(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	sh, err := h.store.RevokeShare(siteName, r.PathValue("id"), shareActor(r))
+	if err != nil {
+		if errors.Is(err, storage.ErrShareNotFound) {
+			RenderError(w, r, http.StatusNotFound, "share not found")
+			return
+		}
+		RenderError(w, r, http.StatusInternalServerError, "revoking share")
+		return
+	}
+	slog.InfoContext(r.Context(), "share revoked", "site", siteName, "share", sh.ID, "path", sh.Path, "by", sh.RevokedBy)
+
+	if wantsJSON(r) {
+		writeJSON(w, h.shareResponse(siteName, sh))
+		return
+	}
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
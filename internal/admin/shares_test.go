@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+func TestShareHandlers(t *testing.T) {
+	hs, store := setupHandlers(t)
+
+	req := formReqWithAuth("/sites/docs/shares", "path=/report.html&expires_in=2h", adminCaps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	hs.CreateShare.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var created ShareResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.Path != "/report.html" || created.CreatedBy != "admin@example.com" || !created.Active {
+		t.Errorf("created = %+v", created)
+	}
+	if want := "/__share/" + created.Token + "/report.html"; !strings.HasSuffix(created.URL, want) {
+		t.Errorf("URL = %q, want suffix %q", created.URL, want)
+	}
+	if d := time.Until(created.ExpiresAt); d < time.Hour || d > 2*time.Hour {
+		t.Errorf("expires in %v, want about 2h", d)
+	}
+
+	// Active shares appear on the site page.
+	req = reqWithAuth("GET", "/sites/docs", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Site.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "/sites/docs/shares/"+created.ID+"/revoke") {
+		t.Error("site page does not list the share")
+	}
+
+	req = formReqWithAuth("/sites/docs/shares/"+created.ID+"/revoke", "", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", created.ID)
+	rec = httptest.NewRecorder()
+	hs.RevokeShare.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("revoke status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := store.LookupShare("docs", created.Token); ok {
+		t.Error("revoked share still active")
+	}
+
+	req = reqWithAuth("GET", "/sites/docs/shares", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	hs.Shares.ServeHTTP(rec, req)
+	var list []ShareResponse
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].Active || list[0].RevokedBy != "admin@example.com" {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestCreateShareHandler_Invalid(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for _, body := range []string{"path=report.html", "path=/a/../b", "path=/&expires_in=721h", "path=/&expires_in=soon"} {
+		req := formReqWithAuth("/sites/docs/shares", body, adminCaps, adminID)
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		hs.CreateShare.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestShareHandlers_RequireDeploy(t *testing.T) {
+	hs, store := setupHandlers(t)
+	sh, _ := store.CreateShare("docs", storage.Share{Path: "/", ExpiresAt: time.Now().Add(time.Hour)})
+
+	handlers := map[string]http.Handler{"list": hs.Shares, "create": hs.CreateShare, "revoke": hs.RevokeShare}
+	for name, h := range handlers {
+		req := formReqWithAuth("/sites/docs/shares", "path=/", viewerCaps, viewerID)
+		req.SetPathValue("site", "docs")
+		req.SetPathValue("id", sh.ID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", name, rec.Code)
+		}
+	}
+	if _, ok := store.LookupShare("docs", sh.Token); !ok {
+		t.Error("viewer revoked the share")
+	}
+}
+
+func TestRevokeShareHandler_NotFound(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := formReqWithAuth("/sites/docs/shares/nope/revoke", "", adminCaps, adminID)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "nope")
+	rec := httptest.NewRecorder()
+	hs.RevokeShare.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
@@ -1,9 +1,14 @@
 package admin
 
 import (
+	"cmp"
 	"errors"
+	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -11,25 +16,141 @@ import (
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 	"tspages/internal/webhook"
 )
 
 // --- GET /sites ---
 
-type SitesHandler struct{ handlerDeps }
+const sitesPageSize = 100
+
+// Orders of the sites list.
+const (
+	sitesSortName     = "name"
+	sitesSortDeployed = "deployed"
+	sitesSortRequests = "requests"
+)
+
+// sitesQuery is how the sites list is searched, sorted, and grouped.
+type sitesQuery struct {
+	// Search matches sites whose name or hostname contains it, ignoring
+	// case.
+	Search string
+	// Sort is sitesSortName, sitesSortDeployed (most recent first), or
+	// sitesSortRequests (most first).
+	Sort string
+	// Group groups sites by their name prefix, up to the first hyphen,
+	// before sorting them.
+	Group bool
+}
+
+// parseSitesQuery reads q=, sort=, and group=prefix.
+func parseSitesQuery(v url.Values) (sitesQuery, error) {
+	q := sitesQuery{Search: strings.TrimSpace(v.Get("q")), Sort: v.Get("sort")}
+	switch q.Sort {
+	case "":
+		q.Sort = sitesSortName
+	case sitesSortName, sitesSortDeployed, sitesSortRequests:
+	default:
+		return q, fmt.Errorf("sort must be %q, %q, or %q", sitesSortName, sitesSortDeployed, sitesSortRequests)
+	}
+	switch v.Get("group") {
+	case "":
+	case "prefix":
+		q.Group = true
+	default:
+		return q, errors.New(`group must be "prefix"`)
+	}
+	return q, nil
+}
+
+// Filtered reports whether q leaves out any sites.
+func (q sitesQuery) Filtered() bool {
+	return q.Search != ""
+}
+
+// URL returns the sites page showing page of q sorted by sort.
+func (q sitesQuery) URL(sort string, page int) template.URL {
+	v := url.Values{}
+	if q.Search != "" {
+		v.Set("q", q.Search)
+	}
+	if sort != sitesSortName {
+		v.Set("sort", sort)
+	}
+	if q.Group {
+		v.Set("group", "prefix")
+	}
+	if page > 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	if len(v) == 0 {
+		return "/sites"
+	}
+	return template.URL("/sites?" + v.Encode())
+}
+
+func (q sitesQuery) matches(s SiteStatus) bool {
+	search := strings.ToLower(q.Search)
+	return strings.Contains(s.Name, search) || strings.Contains(strings.ToLower(s.Hostname), search)
+}
+
+// sortSites orders sites by q. Ties are broken by name, so pages are stable
+// between requests.
+func (q sitesQuery) sortSites(sites []SiteStatus) {
+	slices.SortFunc(sites, func(a, b SiteStatus) int {
+		if c := cmp.Compare(a.Group, b.Group); c != 0 {
+			return c
+		}
+		var c int
+		switch q.Sort {
+		case sitesSortDeployed:
+			// RFC 3339 times in UTC sort as strings; sites never deployed
+			// have none and come last.
+			c = -cmp.Compare(a.LastDeployedAt, b.LastDeployedAt)
+		case sitesSortRequests:
+			c = -cmp.Compare(a.Requests, b.Requests)
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+// sitePrefix returns the part of name before its first hyphen.
+func sitePrefix(name string) string {
+	prefix, _, _ := strings.Cut(name, "-")
+	return prefix
+}
+
+type SitesHandler struct {
+	handlerDeps
+	checker SiteHealthChecker
+}
 
 func (h *SitesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	caps := auth.CapsFromContext(r.Context())
 	identity := auth.IdentityFromContext(r.Context())
 	admin := auth.HasAdminCap(caps)
 
+	query, err := parseSitesQuery(r.URL.Query())
+	if err != nil {
+		RenderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	sites, err := h.store.ListSites()
 	if err != nil {
 		RenderError(w, r, http.StatusInternalServerError, "listing sites")
 		return
 	}
 
+	// Sort keys are read for every matching site; the rest of each entry
+	// only for the page shown.
 	now := time.Now()
 	out := make([]SiteStatus, 0)
 	for _, s := range sites {
@@ -38,34 +159,67 @@ func (h *SitesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		ss := SiteStatus{
 			Name:               s.Name,
+			Hostname:           h.siteHostname(s.Name),
 			ActiveDeploymentID: s.ActiveDeploymentID,
 			CanDeploy:          auth.CanDeploy(caps, s.Name),
 		}
-		if auth.IsAdmin(caps, s.Name) && h.recorder != nil && h.analyticsEnabled(s.Name) {
-			var err error
-			ss.Requests, err = h.recorder.TotalRequests(s.Name, time.Time{}, now)
-			if err != nil {
-				slog.Error("analytics query failed", "query", "total_requests", "site", s.Name, "err", err)
-			}
-			ts, err := h.recorder.RequestsOverTime(s.Name, now.Add(-7*24*time.Hour), now)
-			if err != nil {
-				slog.Error("analytics query failed", "query", "requests_over_time", "site", s.Name, "err", err)
-			}
-			ss.Sparkline = countsJSON(ts)
+		if !query.matches(ss) {
+			continue
+		}
+		if query.Group {
+			ss.Group = sitePrefix(s.Name)
 		}
 		if s.ActiveDeploymentID != "" {
 			if m, err := h.store.ReadManifest(s.Name, s.ActiveDeploymentID); err == nil {
 				ss.LastDeployedBy = m.CreatedBy
 				ss.LastDeployedByAvatar = m.CreatedByAvatar
 				if !m.CreatedAt.IsZero() {
-					ss.LastDeployedAt = m.CreatedAt.Format(time.RFC3339)
+					ss.LastDeployedAt = m.CreatedAt.UTC().Format(time.RFC3339)
 				}
 			}
 		}
+		if query.Sort == sitesSortRequests {
+			ss.Requests = h.totalRequests(r, caps, s.Name, now)
+		}
 		out = append(out, ss)
 	}
+	query.sortSites(out)
+
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	totalPages := max((len(out)+sitesPageSize-1)/sitesPageSize, 1)
+	page = min(page, totalPages)
+	start := (page - 1) * sitesPageSize
+	out = out[start:min(start+sitesPageSize, len(out))]
+
+	for i := range out {
+		ss := &out[i]
+		ss.LoginError = h.checker.LoginError(ss.Name)
+		ss.Health = h.siteHealth(ss.Name)
+		if state, ok := h.store.ReadArchiveState(ss.Name); ok {
+			ss.Archived = &state
+		}
+		if state, ok := h.store.ReadCanary(ss.Name); ok {
+			ss.Canary = &state
+		}
+		if query.Sort != sitesSortRequests {
+			ss.Requests = h.totalRequests(r, caps, ss.Name, now)
+		}
+		if auth.IsAdmin(caps, ss.Name) && h.recorder != nil && h.analyticsEnabled(ss.Name) {
+			ts, err := h.recorder.RequestsOverTime(ss.Name, now.Add(-7*24*time.Hour), now)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_over_time", "site", ss.Name, "err", err)
+			}
+			ss.Sparkline = countsJSON(ts)
+		}
+	}
 
-	resp := SitesResponse{Admin: admin, User: userInfo(identity, caps), DNSSuffix: h.dnsSuffix, Sites: out}
+	resp := SitesResponse{
+		Admin: admin, User: userInfo(identity, caps), DNSSuffix: h.dnsSuffix, Sites: out,
+		Page: page, TotalPages: totalPages,
+	}
 
 	if wantsJSON(r) {
 		setAlternateLinks(w, [][2]string{
@@ -80,26 +234,48 @@ func (h *SitesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Server validates the specific name on POST.
 	canCreate := admin
 
+	var integrityIssues, unverified int
+	if auth.CanViewIntegrity(caps) {
+		integrityIssues = h.integrityIssues()
+		unverified = h.unverifiedSites()
+	}
+
 	renderPage(w, r, sitesTmpl, "sites", struct {
 		SitesResponse
-		CanCreate  bool
-		Host       string
-		MaxNameLen int
-	}{resp, canCreate, r.Host, storage.MaxSiteNameLen(h.dnsSuffix)})
+		Query           sitesQuery
+		CanCreate       bool
+		CanViewAs       bool
+		Host            string
+		MaxNameLen      int
+		IntegrityIssues int
+		Unverified      int
+	}{resp, query, canCreate, !noViewAsFlag && auth.CanViewAs(caps), r.Host, storage.MaxSiteNameLen(h.dnsSuffix), integrityIssues, unverified})
+}
+
+// totalRequests returns the requests a site served, for its admins, or 0.
+func (h *SitesHandler) totalRequests(r *http.Request, caps []auth.Cap, site string, now time.Time) int64 {
+	if !auth.IsAdmin(caps, site) || h.recorder == nil || !h.analyticsEnabled(site) {
+		return 0
+	}
+	n, err := h.recorder.TotalRequests(site, time.Time{}, now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_requests", "site", site, "err", err)
+	}
+	return n
 }
 
 // --- POST /sites ---
 
 type CreateSiteHandler struct {
 	handlerDeps
-	ensurer  SiteEnsurer
-	notifier *webhook.Notifier
+	ensurer SiteEnsurer
+	events  *events.Bus
 }
 
 func (h *CreateSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	name := r.FormValue("name")
 	if !storage.ValidSiteNameForSuffix(name, h.dnsSuffix) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
@@ -111,7 +287,7 @@ func (h *CreateSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.store.CreateSite(name); err != nil {
 		if errors.Is(err, storage.ErrSiteExists) {
-			RenderError(w, r, http.StatusConflict, "site already exists")
+			RenderProblem(w, r, http.StatusConflict, problem.SiteExists, "site already exists")
 			return
 		}
 		RenderError(w, r, http.StatusInternalServerError, "creating site")
@@ -119,15 +295,20 @@ func (h *CreateSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.ensurer.EnsureServer(name); err != nil {
-		slog.Warn("site created but server failed to start", "site", name, "err", err)
+		slog.WarnContext(r.Context(), "site created but server failed to start", "site", name, "err", err)
 	}
 
-	if h.notifier != nil {
+	if h.events != nil {
 		identity := auth.IdentityFromContext(r.Context())
-		resolvedCfg := storage.SiteConfig{}.Merge(h.defaults)
-		h.notifier.Fire("site.created", name, resolvedCfg, map[string]any{
-			"site":       name,
-			"created_by": identity.DisplayName,
+		h.events.Publish(events.Event{
+			Type:      events.SiteCreated,
+			Site:      name,
+			Config:    storage.SiteConfig{}.Merge(h.defaults),
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":       name,
+				"created_by": identity.DisplayName,
+			},
 		})
 	}
 
@@ -149,7 +330,7 @@ type SiteHandler struct {
 func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
@@ -164,14 +345,21 @@ func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	found, err := h.store.GetSite(siteName)
 	if err != nil {
-		RenderError(w, r, http.StatusNotFound, "site not found")
+		RenderProblem(w, r, http.StatusNotFound, problem.SiteNotFound, "site not found")
 		return
 	}
 
 	ss := SiteStatus{
 		Name:               found.Name,
+		Hostname:           h.siteHostname(found.Name),
 		ActiveDeploymentID: found.ActiveDeploymentID,
 	}
+	if state, ok := h.store.ReadArchiveState(siteName); ok {
+		ss.Archived = &state
+	}
+	if state, ok := h.store.ReadCanary(siteName); ok {
+		ss.Canary = &state
+	}
 	// Read the merged config for the active deployment.
 	var siteConfig storage.SiteConfig
 	if found.ActiveDeploymentID != "" {
@@ -186,11 +374,11 @@ func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var err error
 		ss.Requests, err = h.recorder.TotalRequests(siteName, time.Time{}, now)
 		if err != nil {
-			slog.Error("analytics query failed", "query", "total_requests", "site", siteName, "err", err)
+			slog.ErrorContext(r.Context(), "analytics query failed", "query", "total_requests", "site", siteName, "err", err)
 		}
 		ts, err := h.recorder.RequestsOverTime(siteName, now.Add(-7*24*time.Hour), now)
 		if err != nil {
-			slog.Error("analytics query failed", "query", "requests_over_time", "site", siteName, "err", err)
+			slog.ErrorContext(r.Context(), "analytics query failed", "query", "requests_over_time", "site", siteName, "err", err)
 		}
 		sparkline = countsJSON(ts)
 	}
@@ -221,7 +409,7 @@ func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var err error
 		recentDeliveries, _, err = h.notifier.ListDeliveries(siteName, "", "", 5, 0)
 		if err != nil {
-			slog.Error("listing webhook deliveries failed", "site", siteName, "err", err)
+			slog.ErrorContext(r.Context(), "listing webhook deliveries failed", "site", siteName, "err", err)
 		}
 	}
 
@@ -246,11 +434,27 @@ func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	totalDeployments := len(deployments)
 
+	canShare := auth.CanShare(caps, siteName)
+	var shares []ShareResponse
+	if canShare {
+		all, err := h.store.ListShares(siteName)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "listing shares failed", "site", siteName, "err", err)
+		}
+		now := time.Now()
+		for _, sh := range all {
+			if sh.Active(now) {
+				shares = append(shares, h.shareResponse(siteName, sh))
+			}
+		}
+	}
+
 	renderPage(w, r, siteTmpl, "sites", struct {
 		SiteDetailResponse
 		User             UserInfo
 		Admin            bool
 		CanDelete        bool
+		CanArchive       bool
 		CanDeploy        bool
 		HasInactive      bool
 		AnalyticsEnabled bool
@@ -260,7 +464,9 @@ func (h *SiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Sparkline        string
 		RecentDeliveries []webhook.DeliverySummary
 		TotalDeployments int
-	}{resp, userInfo(identity, caps), admin, auth.CanDeleteSite(caps, siteName), auth.CanDeploy(caps, siteName), hasInactive, analyticsOn, siteConfig, h.dnsSuffix, r.Host, sparkline, recentDeliveries, totalDeployments})
+		CanShare         bool
+		Shares           []ShareResponse
+	}{resp, userInfo(identity, caps), admin, auth.CanDeleteSite(caps, siteName), auth.CanArchiveSite(caps, siteName), auth.CanDeploy(caps, siteName), hasInactive, analyticsOn, siteConfig, h.dnsSuffix, r.Host, sparkline, recentDeliveries, totalDeployments, canShare, shares})
 }
 
 // countsJSON returns a JSON array of counts from the given time buckets,
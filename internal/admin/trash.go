@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// TrashResponse is the JSON response for GET /trash.
+type TrashResponse struct {
+	Entries []storage.TrashEntry `json:"entries"`
+}
+
+// --- GET /trash ---
+
+type TrashHandler struct{ handlerDeps }
+
+func (h *TrashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+
+	if !auth.HasDeployCap(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	all, err := h.store.ListTrash()
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing trash")
+		return
+	}
+
+	// Only show entries the user could restore: whole sites need the same
+	// access as deleting them, deployments need deploy access.
+	entries := make([]storage.TrashEntry, 0)
+	for _, e := range all {
+		if e.DeploymentID == "" && !auth.CanDeleteSite(caps, e.Site) {
+			continue
+		}
+		if e.DeploymentID != "" && !auth.CanDeploy(caps, e.Site) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	resp := TrashResponse{Entries: entries}
+
+	if wantsJSON(r) {
+		setAlternateLinks(w, [][2]string{
+			{"/trash", "text/html"},
+		})
+		writeJSON(w, resp)
+		return
+	}
+
+	renderPage(w, r, trashTmpl, "sites", struct {
+		TrashResponse
+		User UserInfo
+	}{resp, userInfo(identity, caps)})
+}
+
+// --- POST /sites/{site}/restore ---
+
+type RestoreSiteHandler struct {
+	handlerDeps
+	ensurer SiteEnsurer
+}
+
+func (h *RestoreSiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeleteSite(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if err := h.store.RestoreSite(siteName); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotInTrash):
+			RenderError(w, r, http.StatusNotFound, "site not in trash")
+		case errors.Is(err, storage.ErrSiteExists):
+			RenderProblem(w, r, http.StatusConflict, problem.SiteExists, "a site with this name already exists")
+		default:
+			RenderError(w, r, http.StatusInternalServerError, "restoring site")
+		}
+		return
+	}
+	reindexSite(r.Context(), h.index, siteName)
+
+	if err := h.ensurer.EnsureServer(siteName); err != nil {
+		slog.WarnContext(r.Context(), "site restored but server failed to start", "site", siteName, "err", err)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, map[string]string{"name": siteName})
+		return
+	}
+
+	http.Redirect(w, r, "/sites/"+siteName, http.StatusSeeOther)
+}
+
+// --- POST /sites/{site}/deployments/{id}/restore ---
+
+type RestoreDeploymentHandler struct{ handlerDeps }
+
+func (h *RestoreDeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	siteName := r.PathValue("site")
+	depID := r.PathValue("id")
+	if !storage.ValidSiteName(siteName) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !storage.ValidDeploymentID(depID) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeploy(caps, siteName) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if err := h.store.RestoreDeployment(siteName, depID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotInTrash):
+			RenderError(w, r, http.StatusNotFound, "deployment not in trash")
+		case errors.Is(err, storage.ErrDeploymentExists):
+			RenderProblem(w, r, http.StatusConflict, problem.DeploymentExists, "deployment already exists")
+		default:
+			RenderError(w, r, http.StatusInternalServerError, "restoring deployment")
+		}
+		return
+	}
+	reindexSite(r.Context(), h.index, siteName)
+
+	if wantsJSON(r) {
+		writeJSON(w, map[string]string{"site": siteName, "id": depID})
+		return
+	}
+
+	http.Redirect(w, r, "/sites/"+siteName+"/deployments/"+depID, http.StatusSeeOther)
+}
@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/deployindex"
+	"tspages/internal/events"
+)
+
+// userActivityLimit caps the deployments, actions, and visits a user's
+// page lists.
+const userActivityLimit = 50
+
+// validLogin reports whether login can name a user: a login name is at
+// most 255 characters, without control characters.
+func validLogin(login string) bool {
+	return login != "" && len(login) <= 255 && !strings.ContainsFunc(login, unicode.IsControl)
+}
+
+// UserActivityItem is an entry of a site's activity log, with its site.
+type UserActivityItem struct {
+	ActivityItem
+	Site string `json:"site"`
+}
+
+// UserActivityResponse is the JSON response for GET /users/{login}.
+type UserActivityResponse struct {
+	Login string `json:"login"`
+	// Names are the names the user is matched by: their login and the
+	// display names analytics recorded for them.
+	Names       []string           `json:"names"`
+	Deployments []DeploymentEntry  `json:"deployments"`
+	Activity    []UserActivityItem `json:"activity"`
+	// Visits and VisitCount are only set for admins, and cover the sites
+	// they are admins of.
+	Visits     []analytics.Visit `json:"visits,omitempty"`
+	VisitCount int64             `json:"visit_count,omitempty"`
+}
+
+// --- GET /users/{login} ---
+
+// UserActivityHandler shows what a user did across the sites the caller
+// can deploy to, for onboarding and offboarding reviews: the deployments
+// they made and their entries in activity logs, newest first. Admins also
+// see the user's visits to the sites they are admins of.
+type UserActivityHandler struct{ handlerDeps }
+
+func (h *UserActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+	if !auth.HasDeployCap(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	login := trimSuffix(r.PathValue("login"))
+	if !validLogin(login) {
+		RenderError(w, r, http.StatusBadRequest, "invalid login name")
+		return
+	}
+
+	sites, err := h.store.ListSites()
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing sites")
+		return
+	}
+	var deployable, administered []string
+	for _, s := range sites {
+		if auth.CanDeploy(caps, s.Name) {
+			deployable = append(deployable, s.Name)
+		}
+		if auth.IsAdmin(caps, s.Name) {
+			administered = append(administered, s.Name)
+		}
+	}
+
+	// Deployments and activity record display names more often than
+	// logins, so match those too.
+	names := []string{login}
+	if login == identity.LoginName && identity.DisplayName != "" {
+		names = append(names, identity.DisplayName)
+	}
+	if h.recorder != nil {
+		recorded, err := h.recorder.UserNames(login)
+		if err != nil {
+			slog.WarnContext(r.Context(), "listing user names failed", "err", err)
+		}
+		names = append(names, recorded...)
+	}
+	names = uniqueFold(names)
+
+	resp := UserActivityResponse{Login: login, Names: names, Activity: []UserActivityItem{}}
+	if resp.Deployments, err = h.userDeployments(deployable, names); err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing deployments")
+		return
+	}
+	resp.Activity = h.userActivity(r, deployable, names)
+	if h.recorder != nil && len(administered) > 0 {
+		resp.Visits, resp.VisitCount, err = h.recorder.UserVisits(login, administered, userActivityLimit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "analytics query failed", "query", "user_visits", "err", err)
+			RenderError(w, r, http.StatusInternalServerError, "querying analytics")
+			return
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, resp)
+		return
+	}
+
+	renderPage(w, r, userActivityTmpl, "deployments", struct {
+		UserActivityResponse
+		CanViewVisits bool
+		User          UserInfo
+	}{resp, h.recorder != nil && len(administered) > 0, userInfo(identity, caps)})
+}
+
+// userDeployments returns the newest deployments of sites created by any
+// of names.
+func (h *UserActivityHandler) userDeployments(sites, names []string) ([]DeploymentEntry, error) {
+	entries := []DeploymentEntry{}
+	if len(sites) == 0 {
+		return entries, nil
+	}
+	for _, name := range names {
+		found, _, err := h.listDeployments(deployindex.Query{Sites: sites, CreatedBy: name, Limit: userActivityLimit})
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range found {
+			if !slices.ContainsFunc(entries, func(o DeploymentEntry) bool { return o.Site == e.Site && o.ID == e.ID }) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	slices.SortFunc(entries, func(a, b DeploymentEntry) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(a.Site, b.Site))
+	})
+	return entries[:min(len(entries), userActivityLimit)], nil
+}
+
+// userActivity returns the newest entries of the activity logs of sites
+// whose actor is any of names.
+func (h *UserActivityHandler) userActivity(r *http.Request, sites, names []string) []UserActivityItem {
+	items := []UserActivityItem{}
+	for _, site := range sites {
+		entries, err := h.store.ListActivity(site)
+		if err != nil {
+			slog.WarnContext(r.Context(), "listing activity failed", "site", site, "err", err)
+			continue
+		}
+		for _, e := range entries {
+			if e.Actor == "" || !slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, e.Actor) }) {
+				continue
+			}
+			item := UserActivityItem{ActivityItem: ActivityItem{ActivityEntry: e}, Site: site}
+			if e.DeploymentID != "" && e.Type != events.DeploymentDeleted {
+				item.URL = "/sites/" + site + "/deployments/" + e.DeploymentID
+			}
+			items = append(items, item)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b UserActivityItem) int { return b.Time.Compare(a.Time) })
+	return items[:min(len(items), userActivityLimit)]
+}
+
+// uniqueFold returns names without those equal to an earlier one under
+// Unicode case folding.
+func uniqueFold(names []string) []string {
+	var unique []string
+	for _, n := range names {
+		if !slices.ContainsFunc(unique, func(u string) bool { return strings.EqualFold(u, n) }) {
+			unique = append(unique, n)
+		}
+	}
+	return unique
+}
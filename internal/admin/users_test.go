@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func userActivity(t *testing.T, h *UserActivityHandler, login string, caps []auth.Cap) UserActivityResponse {
+	t.Helper()
+	req := reqWithAuth("GET", "/users/"+login, caps, adminID)
+	req.Header.Set("Accept", "application/json")
+	req.SetPathValue("login", login)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp UserActivityResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestUserActivityHandler(t *testing.T) {
+	hs, store := setupHandlers(t)
+	// Alice deployed docs as "Alice", which analytics know her login by.
+	if err := hs.UserActivity.recorder.Import([]analytics.Event{{
+		Timestamp: time.Now(), Site: "docs", Path: "/guide", Status: 200,
+		UserLogin: "alice@example.com", UserName: "Alice",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	store.AppendActivity("docs", storage.ActivityEntry{Type: "deployment.activated", Actor: "Alice", DeploymentID: "aaa11111"})
+	store.AppendActivity("demo", storage.ActivityEntry{Type: "deployment.activated", Actor: "Alice", DeploymentID: "bbb22222"})
+	store.AppendActivity("docs", storage.ActivityEntry{Type: "deployment.activated", Actor: "Bob"})
+
+	resp := userActivity(t, hs.UserActivity, "alice@example.com", adminCaps)
+	if len(resp.Names) != 2 || resp.Names[1] != "Alice" {
+		t.Errorf("names = %v, want the login and Alice", resp.Names)
+	}
+	if len(resp.Deployments) != 1 || resp.Deployments[0].Site != "docs" || resp.Deployments[0].ID != "aaa11111" {
+		t.Errorf("deployments = %+v", resp.Deployments)
+	}
+	if len(resp.Activity) != 2 {
+		t.Errorf("activity = %+v, want both of Alice's entries", resp.Activity)
+	}
+	for _, a := range resp.Activity {
+		if a.URL != "/sites/"+a.Site+"/deployments/"+a.DeploymentID {
+			t.Errorf("activity entry %+v links to %q", a, a.URL)
+		}
+	}
+	if len(resp.Visits) != 1 || resp.Visits[0].Path != "/guide" || resp.VisitCount != 1 {
+		t.Errorf("visits = %+v (%d)", resp.Visits, resp.VisitCount)
+	}
+
+	// A deployer of demo sees neither docs nor visits.
+	resp = userActivity(t, hs.UserActivity, "alice@example.com", []auth.Cap{{Access: "deploy", Sites: []string{"demo"}}})
+	if len(resp.Deployments) != 0 || len(resp.Activity) != 1 || resp.Activity[0].Site != "demo" || resp.Visits != nil {
+		t.Errorf("deployer response = %+v", resp)
+	}
+}
+
+func TestUserActivityHandler_HTML(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	req := reqWithAuth("GET", "/users/alice@example.com", adminCaps, adminID)
+	req.SetPathValue("login", "alice@example.com")
+	rec := httptest.NewRecorder()
+	hs.UserActivity.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"alice@example.com", "Deployments", "Actions", "Visits"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+}
+
+func TestUserActivityHandler_Rejects(t *testing.T) {
+	hs, _ := setupHandlers(t)
+	for _, tt := range []struct {
+		name  string
+		login string
+		caps  []auth.Cap
+		want  int
+	}{
+		{"viewer", "alice@example.com", viewerCaps, http.StatusForbidden},
+		{"control character", "alice\n", adminCaps, http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := reqWithAuth("GET", "/users/x", tt.caps, adminID)
+			req.Header.Set("Accept", "application/json")
+			req.SetPathValue("login", tt.login)
+			rec := httptest.NewRecorder()
+			hs.UserActivity.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
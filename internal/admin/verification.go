@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// --- GET /verification ---
+
+// VerificationHandler shows the report of the last scheduled verification:
+// the checks each site failed or passed.
+type VerificationHandler struct{ handlerDeps }
+
+func (h *VerificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+
+	if !auth.CanViewIntegrity(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	report, err := h.store.LastVerificationReport()
+	if err != nil && !os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "reading verification report", "err", err)
+		RenderError(w, r, http.StatusInternalServerError, "reading verification report")
+		return
+	}
+	if report.Sites == nil {
+		report.Sites = []storage.SiteVerification{}
+	}
+
+	if wantsJSON(r) {
+		setAlternateLinks(w, [][2]string{
+			{"/verification", "text/html"},
+		})
+		writeJSON(w, report)
+		return
+	}
+
+	renderPage(w, r, verificationTmpl, "sites", struct {
+		storage.VerificationReport
+		Failed []storage.SiteVerification
+		User   UserInfo
+	}{report, report.Failed(), userInfo(identity, caps)})
+}
+
+// unverifiedSites returns the number of sites that failed the last
+// verification, for the notice on the sites page.
+func (d *handlerDeps) unverifiedSites() int {
+	report, err := d.store.LastVerificationReport()
+	if err != nil {
+		return 0
+	}
+	return len(report.Failed())
+}
@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestVerificationHandler(t *testing.T) {
+	h, store := setupHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.Verification.ServeHTTP(rec, reqWithAuth("GET", "/verification.json", adminCaps, adminID))
+	var report storage.VerificationReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.CheckedAt.IsZero() || report.Sites == nil || len(report.Sites) != 0 {
+		t.Errorf("report before any run = %+v", report)
+	}
+
+	store.WriteVerificationReport(storage.VerificationReport{
+		CheckedAt: time.Now().UTC(),
+		Sites: []storage.SiteVerification{
+			{Site: "docs", DeploymentID: "aaa11111", Checks: []storage.VerificationCheck{
+				{Name: "deployment", OK: true},
+				{Name: "serve", Detail: "GET / returned 404"},
+			}},
+			{Site: "blog", DeploymentID: "bbb22222", Checks: []storage.VerificationCheck{{Name: "deployment", OK: true}}},
+		},
+	})
+
+	rec = httptest.NewRecorder()
+	h.Verification.ServeHTTP(rec, reqWithAuth("GET", "/verification.json", adminCaps, adminID))
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sites) != 2 || report.Sites[0].Checks[1].Detail != "GET / returned 404" {
+		t.Errorf("sites = %+v", report.Sites)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Verification.ServeHTTP(rec, reqWithAuth("GET", "/verification", adminCaps, adminID))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "GET / returned 404") || strings.Contains(body, "bbb22222") {
+		t.Errorf("status = %d, body = %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Sites.ServeHTTP(rec, reqWithAuth("GET", "/sites", adminCaps, adminID))
+	if !strings.Contains(rec.Body.String(), `href="/verification"`) {
+		t.Error("sites page lacks the verification notice")
+	}
+}
+
+func TestVerificationHandler_Forbidden(t *testing.T) {
+	h, _ := setupHandlers(t)
+
+	scoped := []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}
+	rec := httptest.NewRecorder()
+	h.Verification.ServeHTTP(rec, reqWithAuth("GET", "/verification.json", scoped, viewerID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
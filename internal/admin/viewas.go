@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"tspages/internal/auth"
+)
+
+// --- POST /view-as ---
+
+// ViewAsHandler starts a read-only preview of the admin interface with
+// another user's permissions. The target login is stored in a cookie that
+// auth.ViewAs picks up on subsequent requests.
+type ViewAsHandler struct {
+	resolver auth.UserResolver
+}
+
+// NewViewAsHandler returns a handler that looks up users with resolver. A
+// nil resolver disables the preview.
+func NewViewAsHandler(resolver auth.UserResolver) *ViewAsHandler {
+	return &ViewAsHandler{resolver: resolver}
+}
+
+func (h *ViewAsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanViewAs(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if h.resolver == nil {
+		RenderError(w, r, http.StatusNotFound, "view as is not available")
+		return
+	}
+
+	login := strings.TrimSpace(r.FormValue("login"))
+	if login == "" {
+		RenderError(w, r, http.StatusBadRequest, "login is required")
+		return
+	}
+	result, err := h.resolver.WhoIsLogin(r.Context(), login)
+	if err != nil {
+		RenderError(w, r, http.StatusNotFound, "no device found for "+login)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.ViewAsCookie,
+		Value:    result.LoginName,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if wantsJSON(r) {
+		writeJSON(w, map[string]string{"login": result.LoginName})
+		return
+	}
+
+	http.Redirect(w, r, "/sites", http.StatusSeeOther)
+}
+
+// --- POST /view-as/exit ---
+
+// ExitViewAsHandler ends a view-as preview. It must be registered without
+// the auth.ViewAs middleware, which rejects POST requests during a preview.
+type ExitViewAsHandler struct{}
+
+func (h *ExitViewAsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.ViewAsCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Redirect(w, r, "/sites", http.StatusSeeOther)
+}
@@ -6,8 +6,10 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"tspages/internal/auth"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 	"tspages/internal/webhook"
 )
@@ -39,7 +41,7 @@ type SiteWebhooksHandler struct {
 func (h *SiteWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	siteName := trimSuffix(r.PathValue("site"))
 	if !storage.ValidSiteName(siteName) {
-		RenderError(w, r, http.StatusBadRequest, "invalid site name")
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 	caps := auth.CapsFromContext(r.Context())
@@ -69,7 +71,7 @@ func (h *WebhooksHandler) serveWebhooks(w http.ResponseWriter, r *http.Request,
 		var err error
 		deliveries, total, err = h.notifier.ListDeliveries(site, event, status, webhooksPageSize, offset)
 		if err != nil {
-			slog.Error("listing webhook deliveries failed", "err", err)
+			slog.ErrorContext(r.Context(), "listing webhook deliveries failed", "err", err)
 		}
 	}
 
@@ -92,28 +94,39 @@ func (h *WebhooksHandler) serveWebhooks(w http.ResponseWriter, r *http.Request,
 		var err error
 		statsTotal, statsSucceeded, statsFailed, err = h.notifier.DeliveryStats(site, from, now)
 		if err != nil {
-			slog.Error("webhook query failed", "query", "delivery_stats", "err", err)
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "delivery_stats", "err", err)
 		}
 		timeSeries, err = h.notifier.DeliveriesOverTime(site, from, now)
 		if err != nil {
-			slog.Error("webhook query failed", "query", "deliveries_over_time", "err", err)
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "deliveries_over_time", "err", err)
 		}
 		events, err = h.notifier.EventBreakdown(site, from, now)
 		if err != nil {
-			slog.Error("webhook query failed", "query", "event_breakdown", "err", err)
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "event_breakdown", "err", err)
 		}
 		latency, err = h.notifier.LatencyOverTime(site, from, now)
 		if err != nil {
-			slog.Error("webhook query failed", "query", "latency_over_time", "err", err)
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "latency_over_time", "err", err)
 		}
 		latencyStats, err = h.notifier.LatencyStats(site, from, now)
 		if err != nil {
-			slog.Error("webhook query failed", "query", "latency_stats", "err", err)
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "latency_stats", "err", err)
+		}
+	}
+
+	// The delivery log is shared by all sites, so only the global page
+	// describes it.
+	var table webhook.TableStats
+	if global && h.notifier != nil {
+		var err error
+		table, err = h.notifier.TableStats()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "webhook query failed", "query", "table_stats", "err", err)
 		}
 	}
 
 	if wantsJSON(r) {
-		writeJSON(w, map[string]any{
+		resp := map[string]any{
 			"deliveries":    deliveries,
 			"page":          page,
 			"total_pages":   totalPages,
@@ -125,7 +138,11 @@ func (h *WebhooksHandler) serveWebhooks(w http.ResponseWriter, r *http.Request,
 			"events":        events,
 			"latency":       latency,
 			"latency_stats": latencyStats,
-		})
+		}
+		if global {
+			resp["table"] = table
+		}
+		writeJSON(w, resp)
 		return
 	}
 
@@ -147,8 +164,67 @@ func (h *WebhooksHandler) serveWebhooks(w http.ResponseWriter, r *http.Request,
 		Events       []webhook.EventCount
 		Latency      []webhook.LatencyTimeBucket
 		LatencyStats webhook.LatencyStats
+		Table        webhook.TableStats
 	}{deliveries, page, totalPages, site, global, event, status, userInfo(identity, caps), basePath,
-		rangeParam, statsTotal, statsSucceeded, statsFailed, timeSeries, events, latency, latencyStats})
+		rangeParam, statsTotal, statsSucceeded, statsFailed, timeSeries, events, latency, latencyStats, table})
+}
+
+// --- GET /webhooks/export ---
+
+// WebhookExportHandler streams the delivery log as NDJSON, one attempt per
+// line, oldest first, for archival before deliveries are pruned. The since
+// parameter (RFC 3339 or YYYY-MM-DD) limits the export to newer attempts,
+// and site to one site. Only deliveries for sites the caller can deploy to
+// are included.
+type WebhookExportHandler struct {
+	handlerDeps
+	notifier *webhook.Notifier
+}
+
+func (h *WebhookExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.HasDeployCap(caps) {
+		RenderError(w, r, http.StatusForbidden, "forbidden")
+		return
+	}
+	if h.notifier == nil {
+		RenderError(w, r, http.StatusNotFound, "webhooks not configured")
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			if since, err = time.Parse(time.DateOnly, v); err != nil {
+				RenderError(w, r, http.StatusBadRequest, "since must be an RFC 3339 time or a YYYY-MM-DD date")
+				return
+			}
+		}
+	}
+	site := r.URL.Query().Get("site")
+	if site != "" && !storage.ValidSiteName(site) {
+		RenderProblem(w, r, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="webhook-deliveries.ndjson"`)
+	enc := json.NewEncoder(w)
+	n := 0
+	err := h.notifier.Export(since, func(d webhook.DeliveryRecord) error {
+		if (site != "" && d.Site != site) || !auth.CanDeploy(caps, d.Site) {
+			return nil
+		}
+		n++
+		return enc.Encode(d)
+	})
+	if err != nil {
+		// The status line is already sent; the archive ends short.
+		slog.ErrorContext(r.Context(), "exporting webhook deliveries failed", "err", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "exported webhook deliveries", "attempts", n, "since", since)
 }
 
 // --- GET /webhooks/{id} ---
@@ -191,7 +267,7 @@ func (h *WebhookDetailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 	attempts, err := h.notifier.GetDeliveryAttempts(webhookID)
 	if err != nil {
-		slog.Error("getting webhook delivery attempts failed", "webhook_id", webhookID, "err", err)
+		slog.ErrorContext(r.Context(), "getting webhook delivery attempts failed", "webhook_id", webhookID, "err", err)
 	}
 	for i, a := range attempts {
 		var buf bytes.Buffer
@@ -257,7 +333,7 @@ func (h *WebhookRetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 	status, err := h.notifier.Resend(webhookID, merged.WebhookSecret)
 	if err != nil {
-		slog.Error("webhook retry failed", "webhook_id", webhookID, "err", err)
+		slog.ErrorContext(r.Context(), "webhook retry failed", "webhook_id", webhookID, "err", err)
 		RenderError(w, r, http.StatusBadGateway, "retry failed")
 		return
 	}
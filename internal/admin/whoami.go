@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"net/http"
+
+	"tspages/internal/auth"
+)
+
+// WhoAmIResponse is the JSON response for GET /whoami.
+type WhoAmIResponse struct {
+	LoginName   string           `json:"login_name"`
+	DisplayName string           `json:"display_name,omitempty"`
+	Caps        []auth.Cap       `json:"caps"`
+	Metrics     bool             `json:"metrics"`
+	Sites       []SitePermission `json:"sites"`
+}
+
+// SitePermission is the caller's effective access to a single site, after
+// all matching capability grants have been combined.
+type SitePermission struct {
+	Name      string `json:"name"`
+	View      bool   `json:"view"`
+	Analytics bool   `json:"analytics"`
+	Deploy    bool   `json:"deploy"`
+	Admin     bool   `json:"admin"`
+}
+
+// --- GET /whoami ---
+
+type WhoAmIHandler struct{ handlerDeps }
+
+func (h *WhoAmIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caps := auth.CapsFromContext(r.Context())
+	identity := auth.IdentityFromContext(r.Context())
+
+	sites, err := h.store.ListSites()
+	if err != nil {
+		RenderError(w, r, http.StatusInternalServerError, "listing sites")
+		return
+	}
+
+	// Sites the caller has no access to are left out, as on the sites page.
+	perms := make([]SitePermission, 0, len(sites))
+	for _, s := range sites {
+		view, analytics := auth.CanView(caps, s.Name), auth.CanViewAnalytics(caps, s.Name)
+		if !view && !analytics {
+			continue
+		}
+		perms = append(perms, SitePermission{
+			Name:      s.Name,
+			View:      view,
+			Analytics: analytics,
+			Deploy:    auth.CanDeploy(caps, s.Name),
+			Admin:     auth.IsAdmin(caps, s.Name),
+		})
+	}
+
+	grants := caps
+	if grants == nil {
+		grants = []auth.Cap{}
+	}
+
+	resp := WhoAmIResponse{
+		LoginName:   identity.LoginName,
+		DisplayName: identity.DisplayName,
+		Caps:        grants,
+		Metrics:     auth.CanScrapeMetrics(caps),
+		Sites:       perms,
+	}
+
+	if wantsJSON(r) {
+		setAlternateLinks(w, [][2]string{
+			{"/whoami", "text/html"},
+		})
+		writeJSON(w, resp)
+		return
+	}
+
+	renderPage(w, r, whoamiTmpl, "", struct {
+		WhoAmIResponse
+		User UserInfo
+	}{resp, userInfo(identity, caps)})
+}
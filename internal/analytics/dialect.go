@@ -0,0 +1,366 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"tspages/internal/sqlmigrate"
+)
+
+// Supported analytics database drivers.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect captures the SQL differences between analytics backends. Queries
+// are written once with "?" placeholders and SQLite-compatible syntax; the
+// dialect rewrites placeholders and supplies the expressions that have no
+// portable spelling.
+type dialect interface {
+	// driver returns the Driver* constant for the dialect.
+	driver() string
+	// migrate brings the schema up to date.
+	migrate(db *sql.DB) error
+	// rebind rewrites "?" placeholders into the driver's syntax.
+	rebind(query string) string
+	// timeArg converts a timestamp into a query argument comparable to ts.
+	timeArg(t time.Time) any
+	// parseTime converts a scanned ts value back into a time.
+	parseTime(v any) time.Time
+	// bucketSQL truncates ts to a bucket boundary, formatted as RFC 3339.
+	// It takes two int parameters: the step size in seconds, passed twice.
+	bucketSQL() string
+	// hourSQL extracts the UTC hour of ts as an integer.
+	hourSQL() string
+}
+
+// openDB opens the analytics database for driver and returns it with its
+// dialect. For SQLite, dsn is a file path.
+func openDB(driver, dsn string) (*sql.DB, dialect, error) {
+	switch driver {
+	case "", DriverSQLite:
+		db, err := OpenSQLite(dsn)
+		return db, sqliteDialect{}, err
+	case DriverPostgres:
+		db, err := sql.Open("pgx", dsn)
+		return db, postgresDialect{}, err
+	default:
+		return nil, nil, fmt.Errorf("unknown analytics driver %q", driver)
+	}
+}
+
+// OpenSQLite opens the SQLite database at path with the settings tspages
+// uses for all of its SQLite files.
+func OpenSQLite(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driver() string { return DriverSQLite }
+
+func (sqliteDialect) migrate(db *sql.DB) error { return sqlmigrate.Apply(db, migrations) }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) timeArg(t time.Time) any { return t.UTC().Format(time.RFC3339) }
+
+func (sqliteDialect) parseTime(v any) time.Time {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	}
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func (sqliteDialect) bucketSQL() string {
+	return `strftime('%Y-%m-%dT%H:%M:%SZ', (CAST(strftime('%s', ts) AS INTEGER) / ?) * ?, 'unixepoch')`
+}
+
+func (sqliteDialect) hourSQL() string { return `CAST(strftime('%H', ts) AS INTEGER)` }
+
+var migrations = []func(*sql.Tx) error{
+	// 1: baseline schema with all current columns.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS requests (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				ts              TEXT NOT NULL,
+				site            TEXT NOT NULL,
+				path            TEXT NOT NULL,
+				status          INTEGER NOT NULL,
+				user_login      TEXT NOT NULL DEFAULT '',
+				user_name       TEXT NOT NULL DEFAULT '',
+				profile_pic_url TEXT NOT NULL DEFAULT '',
+				node_name       TEXT NOT NULL DEFAULT '',
+				node_ip         TEXT NOT NULL DEFAULT '',
+				os              TEXT NOT NULL DEFAULT '',
+				os_version      TEXT NOT NULL DEFAULT '',
+				device          TEXT NOT NULL DEFAULT '',
+				tags            TEXT NOT NULL DEFAULT ''
+			);
+		`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_requests_site_ts ON requests(site, ts)`); err != nil {
+			return err
+		}
+		// For pre-existing databases: add profile_pic_url if missing.
+		// Ignore "duplicate column" errors for DBs that already have it.
+		_, _ = tx.Exec(`ALTER TABLE requests ADD COLUMN profile_pic_url TEXT NOT NULL DEFAULT ''`)
+		return nil
+	},
+	// 2: visitors who opted out of access analytics.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS opt_outs (
+				user_login TEXT PRIMARY KEY,
+				ts         TEXT NOT NULL
+			)
+		`)
+		return err
+	},
+	// 3: bytes served per site and UTC day, and the months each site's
+	// transfer cap notice went out.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS transfer (
+				site  TEXT NOT NULL,
+				day   TEXT NOT NULL,
+				bytes INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (site, day)
+			)
+		`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS transfer_alerts (
+				site  TEXT NOT NULL,
+				month TEXT NOT NULL,
+				PRIMARY KEY (site, month)
+			)
+		`)
+		return err
+	},
+	// 4: the deployment that served each request, to compare a canary with
+	// the active deployment.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN deployment_id TEXT NOT NULL DEFAULT ''`)
+		return err
+	},
+	// 5: whether each request came from a tagged node, to leave CI runners
+	// and monitoring out of visitor counts.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE`)
+		return err
+	},
+	// 6: how many requests each row stands for, to record only a sample of
+	// asset requests.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN weight INTEGER NOT NULL DEFAULT 1`)
+		return err
+	},
+	// 7: whether each request was a completed download, to count the
+	// downloads of file shares apart from other requests.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN is_download BOOLEAN NOT NULL DEFAULT FALSE`)
+		return err
+	},
+	// 8: the ID of each event a replica forwarded, so a batch sent again
+	// is not counted twice, and how far each replica's events were
+	// forwarded to its primary.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`ALTER TABLE requests ADD COLUMN event_id TEXT`); err != nil {
+			return err
+		}
+		return forwardingSchema(tx, `last_id INTEGER NOT NULL`)
+	},
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) driver() string { return DriverPostgres }
+
+// migrate applies pgMigrations, tracking the version in a one-row
+// tspages_analytics_schema table since PostgreSQL has no PRAGMA user_version. An
+// advisory lock serializes concurrent instances migrating the same database.
+func (postgresDialect) migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("analytics migration: begin: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(7307756167)`); err != nil {
+		return fmt.Errorf("analytics migration: lock: %w", err)
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS tspages_analytics_schema (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("analytics migration: %w", err)
+	}
+	var current int
+	err = tx.QueryRow(`SELECT version FROM tspages_analytics_schema`).Scan(&current)
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec(`INSERT INTO tspages_analytics_schema (version) VALUES (0)`); err != nil {
+			return fmt.Errorf("analytics migration: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("analytics migration: reading schema version: %w", err)
+	}
+	for i, fn := range pgMigrations {
+		version := i + 1
+		if version <= current {
+			continue
+		}
+		if err := fn(tx); err != nil {
+			return fmt.Errorf("analytics migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`UPDATE tspages_analytics_schema SET version = $1`, version); err != nil {
+			return fmt.Errorf("analytics migration %d: setting version: %w", version, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (postgresDialect) timeArg(t time.Time) any { return t.UTC() }
+
+func (postgresDialect) parseTime(v any) time.Time {
+	t, _ := v.(time.Time)
+	return t.UTC()
+}
+
+func (postgresDialect) bucketSQL() string {
+	return `to_char(to_timestamp(floor(extract(epoch FROM ts) / ?::bigint) * ?::bigint) AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+}
+
+func (postgresDialect) hourSQL() string {
+	return `CAST(extract(hour FROM ts AT TIME ZONE 'UTC') AS INTEGER)`
+}
+
+var pgMigrations = []func(*sql.Tx) error{
+	// 1: baseline schema, matching the SQLite schema with a native
+	// timestamp column.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS requests (
+				id              BIGSERIAL PRIMARY KEY,
+				ts              TIMESTAMPTZ NOT NULL,
+				site            TEXT NOT NULL,
+				path            TEXT NOT NULL,
+				status          INTEGER NOT NULL,
+				user_login      TEXT NOT NULL DEFAULT '',
+				user_name       TEXT NOT NULL DEFAULT '',
+				profile_pic_url TEXT NOT NULL DEFAULT '',
+				node_name       TEXT NOT NULL DEFAULT '',
+				node_ip         TEXT NOT NULL DEFAULT '',
+				os              TEXT NOT NULL DEFAULT '',
+				os_version      TEXT NOT NULL DEFAULT '',
+				device          TEXT NOT NULL DEFAULT '',
+				tags            TEXT NOT NULL DEFAULT ''
+			)
+		`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_requests_site_ts ON requests(site, ts)`)
+		return err
+	},
+	// 2: visitors who opted out of access analytics.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS opt_outs (
+				user_login TEXT PRIMARY KEY,
+				ts         TIMESTAMPTZ NOT NULL
+			)
+		`)
+		return err
+	},
+	// 3: bytes served per site and UTC day, and the months each site's
+	// transfer cap notice went out.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS transfer (
+				site  TEXT NOT NULL,
+				day   TEXT NOT NULL,
+				bytes BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (site, day)
+			)
+		`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS transfer_alerts (
+				site  TEXT NOT NULL,
+				month TEXT NOT NULL,
+				PRIMARY KEY (site, month)
+			)
+		`)
+		return err
+	},
+	// 4: the deployment that served each request.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN IF NOT EXISTS deployment_id TEXT NOT NULL DEFAULT ''`)
+		return err
+	},
+	// 5: whether each request came from a tagged node.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE`)
+		return err
+	},
+	// 6: how many requests each row stands for.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 1`)
+		return err
+	},
+	// 7: whether each request was a completed download.
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`ALTER TABLE requests ADD COLUMN IF NOT EXISTS is_download BOOLEAN NOT NULL DEFAULT FALSE`)
+		return err
+	},
+	// 8: the IDs of forwarded events and the forwarding cursors.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`ALTER TABLE requests ADD COLUMN IF NOT EXISTS event_id TEXT`); err != nil {
+			return err
+		}
+		return forwardingSchema(tx, `last_id BIGINT NOT NULL`)
+	},
+}
+
+// forwardingSchema creates the unique index of forwarded event IDs and the
+// table of forwarding cursors, with lastID as the cursor column. Events
+// recorded locally have no ID, and are left out of the index.
+func forwardingSchema(tx *sql.Tx, lastID string) error {
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_requests_event_id ON requests(event_id) WHERE event_id IS NOT NULL`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS forward_cursors (
+			target TEXT PRIMARY KEY,
+			` + lastID + `
+		)
+	`)
+	return err
+}
@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPostgresDialect_Rebind(t *testing.T) {
+	got := postgresDialect{}.rebind(`SELECT path FROM requests WHERE site IN (?,?) AND ts >= ? LIMIT ?`)
+	want := `SELECT path FROM requests WHERE site IN ($1,$2) AND ts >= $3 LIMIT $4`
+	if got != want {
+		t.Errorf("rebind = %q, want %q", got, want)
+	}
+}
+
+func TestNewRecorderWithConfig_UnknownDriver(t *testing.T) {
+	if _, err := NewRecorderWithConfig("", RecorderConfig{Driver: "mysql"}); err == nil {
+		t.Fatal("expected error for unknown driver")
+	}
+}
+
+func TestRecorder_Driver(t *testing.T) {
+	r := setupTestRecorder(t)
+	if got := r.Driver(); got != DriverSQLite {
+		t.Errorf("Driver() = %q, want %q", got, DriverSQLite)
+	}
+}
+
+// TestRecorder_Postgres runs the aggregate queries against a real PostgreSQL
+// database. Set TSPAGES_TEST_POSTGRES_DSN to a scratch database to enable it;
+// the requests table is truncated first.
+func TestRecorder_Postgres(t *testing.T) {
+	dsn := os.Getenv("TSPAGES_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TSPAGES_TEST_POSTGRES_DSN not set")
+	}
+	r, err := NewRecorderWithConfig(dsn, RecorderConfig{Driver: DriverPostgres})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.DB().Exec(`TRUNCATE requests`); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	if err := r.Import([]Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com", OS: "darwin", NodeName: "alice-mac", Tags: []string{"tag:a", "tag:b"}},
+		{Timestamp: base.Add(time.Hour), Site: "docs", Path: "/about", Status: 404, UserLogin: "bob@example.com", OS: "linux", NodeName: "bob-box"},
+		{Timestamp: base.Add(2 * time.Hour), Site: "demo", Path: "/", Status: 500},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := base.Add(-time.Hour), base.Add(23*time.Hour)
+	sites := []string{"docs", "demo"}
+	if n, err := r.TotalRequestsMulti(sites, from, to); err != nil || n != 3 {
+		t.Errorf("TotalRequestsMulti = %d, %v; want 3", n, err)
+	}
+	if n, err := r.UniqueVisitorsMulti(sites, from, to, false); err != nil || n != 2 {
+		t.Errorf("UniqueVisitorsMulti = %d, %v; want 2", n, err)
+	}
+	if n, err := r.UniquePages("docs", from, to); err != nil || n != 2 {
+		t.Errorf("UniquePages = %d, %v; want 2", n, err)
+	}
+
+	buckets, err := r.RequestsOverTimeByStatusMulti(sites, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok, clientErr, serverErr int64
+	for _, b := range buckets {
+		ok += b.OK
+		clientErr += b.ClientErr
+		serverErr += b.ServerErr
+	}
+	if ok != 1 || clientErr != 1 || serverErr != 1 {
+		t.Errorf("status buckets = %d/%d/%d, want 1/1/1", ok, clientErr, serverErr)
+	}
+	series, err := r.RequestsOverTimeMulti(sites, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, b := range series {
+		total += b.Count
+	}
+	if total != 3 {
+		t.Errorf("RequestsOverTimeMulti total = %d, want 3", total)
+	}
+
+	hours, err := r.HourlyPatternMulti(sites, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 3 || hours[0].Hour != 10 {
+		t.Errorf("HourlyPatternMulti = %+v, want hours 10-12", hours)
+	}
+	statuses, err := r.StatusBreakdownMulti(sites, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || statuses[0].Status != "2xx" {
+		t.Errorf("StatusBreakdownMulti = %+v", statuses)
+	}
+	if bySite, err := r.SiteBreakdown(sites, from, to); err != nil || len(bySite) != 2 || bySite[0].Site != "docs" {
+		t.Errorf("SiteBreakdown = %+v, %v", bySite, err)
+	}
+	if visitors, err := r.TopVisitorsMulti(sites, from, to, 10, false); err != nil || len(visitors) != 2 {
+		t.Errorf("TopVisitorsMulti = %+v, %v", visitors, err)
+	}
+	if pages, err := r.TopPages("docs", from, to, 10); err != nil || len(pages) != 2 {
+		t.Errorf("TopPages = %+v, %v", pages, err)
+	}
+	if oses, err := r.OSBreakdownMulti(sites, from, to); err != nil || len(oses) != 2 {
+		t.Errorf("OSBreakdownMulti = %+v, %v", oses, err)
+	}
+	if nodes, err := r.NodeBreakdownMulti(sites, from, to); err != nil || len(nodes) != 2 {
+		t.Errorf("NodeBreakdownMulti = %+v, %v", nodes, err)
+	}
+
+	var exported []Event
+	if err := r.ExportSite("docs", func(e Event) error {
+		exported = append(exported, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || !exported[0].Timestamp.Equal(base) || len(exported[0].Tags) != 2 {
+		t.Errorf("ExportSite = %+v", exported)
+	}
+	if n, err := r.PurgeSite("docs"); err != nil || n != 2 {
+		t.Errorf("PurgeSite = %d, %v; want 2", n, err)
+	}
+}
@@ -0,0 +1,50 @@
+package analytics
+
+import "time"
+
+// TopDownloads lists the files of site downloaded most often, counting
+// completed downloads only.
+func (r *Recorder) TopDownloads(site string, from, to time.Time, limit int) ([]PathCount, error) {
+	timeCond, args := r.timeFilter(from, to)
+	args = append([]any{site, true}, args...)
+	args = append(args, limit)
+	rows, err := r.query(
+		`SELECT path, COUNT(*) AS c FROM requests WHERE site = ? AND is_download = ? AND `+timeCond+` GROUP BY path ORDER BY c DESC, path LIMIT ?`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []PathCount
+	for rows.Next() {
+		var p PathCount
+		if err := rows.Scan(&p.Path, &p.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// DownloadCounts returns how often each file of site under prefix was
+// downloaded, keyed by its path. Files never downloaded are left out.
+func (r *Recorder) DownloadCounts(site, prefix string) (map[string]int64, error) {
+	rows, err := r.query(
+		`SELECT path, COUNT(*) FROM requests WHERE site = ? AND is_download = ? AND substr(path, 1, ?) = ? GROUP BY path`,
+		site, true, len(prefix), prefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int64{}
+	for rows.Next() {
+		var path string
+		var n int64
+		if err := rows.Scan(&path, &n); err != nil {
+			return nil, err
+		}
+		counts[path] = n
+	}
+	return counts, rows.Err()
+}
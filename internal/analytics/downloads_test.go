@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Downloads(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	r.Import([]Event{
+		{Timestamp: base, Site: "files", Path: "/", Status: 200},
+		{Timestamp: base, Site: "files", Path: "/iso/a.iso", Status: 200, Download: true},
+		{Timestamp: base, Site: "files", Path: "/iso/a.iso", Status: 200, Download: true},
+		{Timestamp: base, Site: "files", Path: "/iso/b.iso", Status: 200, Download: true},
+		{Timestamp: base, Site: "files", Path: "/iso/b.iso", Status: 200},
+		{Timestamp: base, Site: "files", Path: "/notes.pdf", Status: 200, Download: true},
+		{Timestamp: base, Site: "other", Path: "/iso/a.iso", Status: 200, Download: true},
+	})
+	to := base.Add(time.Hour)
+
+	top, err := r.TopDownloads("files", time.Time{}, to, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PathCount{{Path: "/iso/a.iso", Count: 2}, {Path: "/iso/b.iso", Count: 1}}
+	if len(top) != len(want) || top[0] != want[0] || top[1] != want[1] {
+		t.Errorf("TopDownloads = %+v, want %+v", top, want)
+	}
+
+	counts, err := r.DownloadCounts("files", "/iso/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"/iso/a.iso": 2, "/iso/b.iso": 1}; !maps.Equal(counts, want) {
+		t.Errorf("DownloadCounts = %v, want %v", counts, want)
+	}
+
+	// Downloads survive an export.
+	var downloads int
+	r.ExportSite("files", func(e Event) error {
+		if e.Download {
+			downloads++
+		}
+		return nil
+	})
+	if downloads != 4 {
+		t.Errorf("exported %d downloads, want 4", downloads)
+	}
+}
@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"fmt"
+
+	"tspages/internal/fieldcrypt"
+)
+
+// identityColumns are the request columns encrypted when a cipher is set.
+var identityColumns = []string{"user_login", "user_name", "profile_pic_url", "node_name", "node_ip"}
+
+// encryptPlainIdentities encrypts identities written before the cipher was
+// set, so one visitor is counted once across the switch instead of once as
+// plain text and once encrypted. It runs at startup and finds nothing to do
+// once every row is encrypted. A nil cipher leaves the rows as they are.
+func (r *Recorder) encryptPlainIdentities() error {
+	if r.cipher == nil {
+		return nil
+	}
+	for _, col := range identityColumns {
+		plain, err := r.plainValues(`SELECT DISTINCT ` + col + ` FROM requests WHERE ` + col + ` != '' AND ` + col + ` NOT LIKE '` + fieldcrypt.Prefix + `%'`)
+		if err != nil {
+			return fmt.Errorf("encrypting analytics identities: %w", err)
+		}
+		for _, v := range plain {
+			if _, err := r.exec(`UPDATE requests SET `+col+` = ? WHERE `+col+` = ?`, r.cipher.EncryptDeterministic(v), v); err != nil {
+				return fmt.Errorf("encrypting analytics identities: %w", err)
+			}
+		}
+	}
+
+	plain, err := r.plainValues(`SELECT user_login FROM opt_outs WHERE user_login NOT LIKE '` + fieldcrypt.Prefix + `%'`)
+	if err != nil {
+		return fmt.Errorf("encrypting analytics opt-outs: %w", err)
+	}
+	for _, login := range plain {
+		if _, err := r.exec(`INSERT INTO opt_outs (user_login, ts) SELECT ?, ts FROM opt_outs WHERE user_login = ? ON CONFLICT(user_login) DO NOTHING`,
+			r.cipher.EncryptDeterministic(login), login); err != nil {
+			return fmt.Errorf("encrypting analytics opt-outs: %w", err)
+		}
+		if _, err := r.exec(`DELETE FROM opt_outs WHERE user_login = ?`, login); err != nil {
+			return fmt.Errorf("encrypting analytics opt-outs: %w", err)
+		}
+	}
+	return nil
+}
+
+// plainValues returns the single string column selected by query.
+func (r *Recorder) plainValues(query string) ([]string, error) {
+	rows, err := r.query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
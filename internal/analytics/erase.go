@@ -0,0 +1,28 @@
+package analytics
+
+// EraseUser replaces the identity of login in every recorded request with
+// token, and clears the profile picture, node name, and node IP recorded
+// with it. Requests keep counting as one visitor, under token. It returns
+// the number of requests changed and the display names login was recorded
+// with, so callers can erase those elsewhere too.
+//
+// An opt-out of login is kept, so the user stays excluded from analytics.
+func (r *Recorder) EraseUser(login, token string) (int64, []string, error) {
+	if login == "" {
+		return 0, nil, nil
+	}
+	names, err := r.UserNames(login)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	stored, plain := r.storedLogins(login)
+	pseudonym := r.cipher.EncryptDeterministic(token)
+	res, err := r.exec(`UPDATE requests SET user_login = ?, user_name = ?, profile_pic_url = '', node_name = '', node_ip = '' WHERE user_login IN (?, ?)`,
+		pseudonym, pseudonym, stored, plain)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := res.RowsAffected()
+	return n, names, err
+}
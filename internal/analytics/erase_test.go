@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_EraseUser(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  RecorderConfig
+	}{
+		{"plain", RecorderConfig{}},
+		{"encrypted", RecorderConfig{Cipher: testCipher(t)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+			alice := Event{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com",
+				UserName: "Alice", ProfilePicURL: "https://example.com/alice.png", NodeName: "alice-mac", NodeIP: "100.64.0.1"}
+			bob := Event{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com", UserName: "Bob"}
+			if err := r.Import([]Event{alice, alice, bob}); err != nil {
+				t.Fatal(err)
+			}
+
+			n, names, err := r.EraseUser("alice@example.com", "erased-0123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 || len(names) != 1 || names[0] != "Alice" {
+				t.Errorf("EraseUser = %d, %v; want 2 requests of Alice", n, names)
+			}
+
+			var exported []Event
+			if err := r.ExportSite("docs", func(e Event) error { exported = append(exported, e); return nil }); err != nil {
+				t.Fatal(err)
+			}
+			erased := 0
+			for _, e := range exported {
+				switch e.UserLogin {
+				case "alice@example.com":
+					t.Errorf("alice was not erased: %+v", e)
+				case "erased-0123":
+					erased++
+					if e.UserName != "erased-0123" || e.ProfilePicURL != "" || e.NodeName != "" || e.NodeIP != "" {
+						t.Errorf("erased event = %+v", e)
+					}
+				}
+			}
+			if erased != 2 {
+				t.Errorf("%d events erased, want 2", erased)
+			}
+			if n, _ := r.UniqueVisitors("docs", base.Add(-time.Hour), base.Add(time.Hour)); n != 2 {
+				t.Errorf("unique visitors = %d, want 2", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package analytics
+
+import "database/sql"
+
+// LoggedEvent is a recorded event with its sequence number, which grows
+// in the order events were written.
+type LoggedEvent struct {
+	Seq int64
+	Event
+}
+
+// EventsAfter returns up to limit events recorded with a sequence number
+// above after, oldest first. Events forwarded from elsewhere are left out,
+// so they are never forwarded again.
+func (r *Recorder) EventsAfter(after int64, limit int) ([]LoggedEvent, error) {
+	rows, err := r.query(`SELECT `+eventColumns+`, id FROM requests WHERE id > ? AND event_id IS NULL ORDER BY id LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []LoggedEvent
+	for rows.Next() {
+		var seq int64
+		e, err := r.scanEvent(rows, &seq)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, LoggedEvent{Seq: seq, Event: e})
+	}
+	return events, rows.Err()
+}
+
+// ForwardCursor returns the sequence number of the last event forwarded to
+// target, or 0 if none was.
+func (r *Recorder) ForwardCursor(target string) (int64, error) {
+	var seq int64
+	err := r.queryRow(`SELECT last_id FROM forward_cursors WHERE target = ?`, target).Scan(&seq)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// SetForwardCursor records that the events up to seq were forwarded to
+// target.
+func (r *Recorder) SetForwardCursor(target string, seq int64) error {
+	_, err := r.exec(`INSERT INTO forward_cursors (target, last_id) VALUES (?, ?) ON CONFLICT (target) DO UPDATE SET last_id = excluded.last_id`, target, seq)
+	return err
+}
+
+// ImportForwarded writes events a replica forwarded synchronously, and
+// returns how many were written. Events with an ID that was imported
+// before, and events of visitors who opted out here, are skipped; the
+// others are sent to live subscribers too.
+func (r *Recorder) ImportForwarded(events []Event) (int, error) {
+	kept := make([]Event, 0, len(events))
+	for _, e := range events {
+		if !r.OptedOut(e.UserLogin) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		return 0, nil
+	}
+	written, err := r.insert(kept)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range kept {
+		r.broadcast(e)
+	}
+	return written, nil
+}
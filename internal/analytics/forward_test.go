@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_EventsAfter(t *testing.T) {
+	r, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), RecorderConfig{Cipher: testCipher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := r.Import([]Event{
+		{Timestamp: now, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com"},
+		{Timestamp: now, Site: "docs", Path: "/guide", Status: 404, Weight: 5},
+		{Timestamp: now, Site: "blog", Path: "/", Status: 200},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Events forwarded from elsewhere are not forwarded again.
+	if _, err := r.ImportForwarded([]Event{{ID: "replica:1", Timestamp: now, Site: "docs", Path: "/", Status: 200}}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := r.EventsAfter(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].UserLogin != "alice@example.com" || first[1].Weight != 5 || !first[0].Timestamp.Equal(now) {
+		t.Fatalf("first batch = %+v", first)
+	}
+	rest, err := r.EventsAfter(first[1].Seq, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].Site != "blog" {
+		t.Errorf("rest = %+v", rest)
+	}
+}
+
+func TestRecorder_ForwardCursor(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if seq, err := r.ForwardCursor("primary"); err != nil || seq != 0 {
+		t.Fatalf("new cursor = %d, %v", seq, err)
+	}
+	for _, seq := range []int64{10, 25} {
+		if err := r.SetForwardCursor("primary", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seq, _ := r.ForwardCursor("primary"); seq != 25 {
+		t.Errorf("cursor = %d, want 25", seq)
+	}
+}
+
+func TestRecorder_ImportForwarded(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetOptOut("bob@example.com", true)
+	now := time.Now()
+	batch := []Event{
+		{ID: "replica:1", Timestamp: now, Site: "docs", Path: "/", Status: 200},
+		{ID: "replica:2", Timestamp: now, Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com"},
+		{ID: "replica:3", Timestamp: now, Site: "docs", Path: "/", Status: 200, Weight: 4},
+	}
+
+	if written, err := r.ImportForwarded(batch); err != nil || written != 2 {
+		t.Fatalf("written = %d, %v; want 2", written, err)
+	}
+	// A batch sent again, say after its response was lost, is not counted
+	// twice.
+	if written, err := r.ImportForwarded(batch); err != nil || written != 0 {
+		t.Fatalf("written again = %d, %v; want 0", written, err)
+	}
+	if count, _ := r.TotalRequests("docs", now.Add(-time.Hour), now.Add(time.Hour)); count != 5 {
+		t.Errorf("requests = %d, want 5", count)
+	}
+}
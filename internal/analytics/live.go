@@ -0,0 +1,35 @@
+package analytics
+
+// liveSubscriber receives the events of one site as Record accepts them.
+type liveSubscriber struct {
+	site string
+	fn   func(Event)
+}
+
+// Subscribe calls fn with every event of site that Record accepts, as it
+// happens, for a live view of the site's traffic. fn runs on the serving
+// goroutine and must not block. Events of visitors who opted out are not
+// sent. It returns a function that removes the subscription.
+func (r *Recorder) Subscribe(site string, fn func(Event)) (unsubscribe func()) {
+	r.liveMu.Lock()
+	defer r.liveMu.Unlock()
+	id := r.liveNext
+	r.liveNext++
+	r.live[id] = liveSubscriber{site: site, fn: fn}
+	return func() {
+		r.liveMu.Lock()
+		delete(r.live, id)
+		r.liveMu.Unlock()
+	}
+}
+
+// broadcast sends e to the subscribers of its site.
+func (r *Recorder) broadcast(e Event) {
+	r.liveMu.RLock()
+	defer r.liveMu.RUnlock()
+	for _, sub := range r.live {
+		if sub.site == e.Site {
+			sub.fn(e)
+		}
+	}
+}
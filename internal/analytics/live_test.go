@@ -0,0 +1,29 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Subscribe(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetOptOut("carol@example.com", true)
+
+	var got []Event
+	unsubscribe := r.Subscribe("docs", func(e Event) { got = append(got, e) })
+	now := time.Now()
+	r.Record(Event{Timestamp: now, Site: "docs", Path: "/a", Status: 200, UserLogin: "alice@example.com"})
+	r.Record(Event{Timestamp: now, Site: "blog", Path: "/b", Status: 200, UserLogin: "alice@example.com"})
+	r.Record(Event{Timestamp: now, Site: "docs", Path: "/c", Status: 200, UserLogin: "carol@example.com"})
+	unsubscribe()
+	r.Record(Event{Timestamp: now, Site: "docs", Path: "/d", Status: 404, UserLogin: "bob@example.com"})
+
+	if len(got) != 1 || got[0].Path != "/a" {
+		t.Errorf("got %+v, want only the docs request to /a", got)
+	}
+}
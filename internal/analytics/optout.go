@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// loadOptOuts reads the opted-out logins into memory so Record can check
+// them without a query per request.
+func (r *Recorder) loadOptOuts() error {
+	rows, err := r.query(`SELECT user_login FROM opt_outs`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	optOuts := make(map[string]bool)
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return err
+		}
+		// Without the key, opted-out visitors would be recorded again.
+		if login, err = r.cipher.Decrypt(login); err != nil {
+			return fmt.Errorf("reading analytics opt-outs: %w", err)
+		}
+		optOuts[login] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	r.optMu.Lock()
+	r.optOuts = optOuts
+	r.optMu.Unlock()
+	return nil
+}
+
+// SetOptOut records whether login has opted out of access analytics. Events
+// of opted-out visitors are dropped by Record on every site; events already
+// recorded are kept.
+func (r *Recorder) SetOptOut(login string, optOut bool) error {
+	stored := r.cipher.EncryptDeterministic(login)
+	var err error
+	if optOut {
+		_, err = r.exec(`INSERT INTO opt_outs (user_login, ts) VALUES (?, ?) ON CONFLICT(user_login) DO NOTHING`,
+			stored, r.d.timeArg(time.Now()))
+	} else {
+		// The login may also be stored in plain text, from before
+		// encryption was turned on.
+		_, err = r.exec(`DELETE FROM opt_outs WHERE user_login IN (?, ?)`, stored, login)
+	}
+	if err != nil {
+		return err
+	}
+	r.optMu.Lock()
+	if optOut {
+		r.optOuts[login] = true
+	} else {
+		delete(r.optOuts, login)
+	}
+	r.optMu.Unlock()
+	return nil
+}
+
+// OptedOut reports whether login has opted out of access analytics.
+func (r *Recorder) OptedOut(login string) bool {
+	if login == "" {
+		return false
+	}
+	r.optMu.RLock()
+	defer r.optMu.RUnlock()
+	return r.optOuts[login]
+}
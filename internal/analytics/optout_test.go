@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_OptOut(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	r, err := NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOptOut("alice@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	// Opting out twice is harmless.
+	if err := r.SetOptOut("alice@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	if !r.OptedOut("alice@example.com") || r.OptedOut("bob@example.com") || r.OptedOut("") {
+		t.Fatal("unexpected opt-out state")
+	}
+
+	now := time.Now()
+	r.Record(Event{Timestamp: now, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com"})
+	r.Record(Event{Timestamp: now, Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com"})
+	r.Close()
+
+	// The opt-out survives a restart.
+	r, err = NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !r.OptedOut("alice@example.com") {
+		t.Error("opt-out not persisted")
+	}
+	count, _ := r.TotalRequests("docs", time.Time{}, now.Add(time.Hour))
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	if err := r.SetOptOut("alice@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	if r.OptedOut("alice@example.com") {
+		t.Error("opt-in not applied")
+	}
+}
+
+func TestRecorder_OptOutEncrypted(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	r, err := NewRecorderWithConfig(dbPath, RecorderConfig{Cipher: testCipher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOptOut("alice@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	r, err = NewRecorderWithConfig(dbPath, RecorderConfig{Cipher: testCipher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OptedOut("alice@example.com") {
+		t.Error("encrypted opt-out not persisted")
+	}
+	r.Close()
+
+	// Without the key, the opt-outs cannot be honored.
+	if r, err := NewRecorder(dbPath); err == nil {
+		r.Close()
+		t.Error("opened a database with encrypted opt-outs without the key")
+	}
+}
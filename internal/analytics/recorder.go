@@ -1,100 +1,169 @@
 package analytics
 
 import (
+	"cmp"
 	"database/sql"
+	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	_ "modernc.org/sqlite"
-
-	"tspages/internal/sqlmigrate"
+	"tspages/internal/fieldcrypt"
+	"tspages/internal/metrics"
 )
 
 // Event represents a single recorded request.
 type Event struct {
-	Timestamp     time.Time
-	Site          string
-	Path          string
-	Status        int
-	UserLogin     string
-	UserName      string
-	ProfilePicURL string
-	NodeName      string
-	NodeIP        string
-	OS            string
-	OSVersion     string
-	Device        string
-	Tags          []string
-}
-
-// Recorder persists request events to SQLite asynchronously.
+	Timestamp     time.Time `json:"timestamp"`
+	Site          string    `json:"site"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	UserLogin     string    `json:"user_login,omitempty"`
+	UserName      string    `json:"user_name,omitempty"`
+	ProfilePicURL string    `json:"profile_pic_url,omitempty"`
+	NodeName      string    `json:"node_name,omitempty"`
+	NodeIP        string    `json:"node_ip,omitempty"`
+	OS            string    `json:"os,omitempty"`
+	OSVersion     string    `json:"os_version,omitempty"`
+	Device        string    `json:"device,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	// DeploymentID is the deployment that served the request.
+	DeploymentID string `json:"deployment_id,omitempty"`
+	// Bot marks requests from tagged nodes, which visitor counts leave out
+	// unless asked to include them.
+	Bot bool `json:"is_bot,omitempty"`
+	// Weight is the number of requests the event stands for: N for an
+	// asset request recorded as a sample of one in N. 0 counts as 1.
+	Weight int `json:"weight,omitempty"`
+	// Download marks a completed download of a file, which is always
+	// recorded, with a weight of 1.
+	Download bool `json:"is_download,omitempty"`
+	// ID identifies an event a replica forwarded to its primary, which
+	// imports each ID once. Events recorded locally have none.
+	ID string `json:"id,omitempty"`
+}
+
+// Recorder persists request events to SQLite or PostgreSQL asynchronously.
 type Recorder struct {
-	db     *sql.DB
-	ch     chan Event
-	wg     sync.WaitGroup
-	closed atomic.Bool
+	db           *sql.DB
+	d            dialect
+	ch           chan Event
+	blockTimeout time.Duration
+	wg           sync.WaitGroup
+	closed       atomic.Bool
+	dropped      atomic.Uint64
+
+	optMu   sync.RWMutex
+	optOuts map[string]bool
+
+	transferMu sync.Mutex
+	transfer   map[transferKey]int64
+
+	liveMu   sync.RWMutex
+	liveNext int
+	live     map[int]liveSubscriber
+
+	visitors string
+	cipher   *fieldcrypt.Cipher
 }
 
+// DefaultBufferSize is the number of events queued for the writer before
+// Record starts dropping (or blocking, with a block timeout).
+const DefaultBufferSize = 1024
+
+// RecorderConfig tunes how Record behaves under load.
+type RecorderConfig struct {
+	// BufferSize is the event queue length. Zero uses DefaultBufferSize.
+	BufferSize int
+	// BlockTimeout is how long Record waits for room in a full queue
+	// before dropping the event. Zero drops immediately, so recording
+	// never adds latency to requests.
+	BlockTimeout time.Duration
+	// Driver selects the database, DriverSQLite (the default) or
+	// DriverPostgres.
+	Driver string
+	// Visitors is what tells visitors apart in unique visitor counts and
+	// top visitors: VisitorsLogin (the default), VisitorsNode, or
+	// VisitorsLoginNode.
+	Visitors string
+	// Cipher encrypts the identities of visitors: their login, name,
+	// profile picture, node name, and node IP. Rows recorded in plain text
+	// before it was set are encrypted at startup. Nil stores them in plain
+	// text.
+	Cipher *fieldcrypt.Cipher
+}
+
+// What tells visitors apart. Counting logins merges a user's devices into
+// one visitor but also merges everyone on a shared tagged node, which has
+// no login; counting nodes does the opposite. Counting both counts each
+// user on each device.
+const (
+	VisitorsLogin     = "login"
+	VisitorsNode      = "node"
+	VisitorsLoginNode = "login+node"
+)
+
 func NewRecorder(dbPath string) (*Recorder, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	return NewRecorderWithConfig(dbPath, RecorderConfig{})
+}
+
+// NewRecorderWithConfig opens the analytics database with the given driver
+// and queueing behavior. dsn is a file path for SQLite and a connection
+// string for PostgreSQL.
+func NewRecorderWithConfig(dsn string, cfg RecorderConfig) (*Recorder, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	switch cfg.Visitors {
+	case "":
+		cfg.Visitors = VisitorsLogin
+	case VisitorsLogin, VisitorsNode, VisitorsLoginNode:
+	default:
+		return nil, fmt.Errorf("unknown visitor identity %q", cfg.Visitors)
+	}
+	db, d, err := openDB(cfg.Driver, dsn)
 	if err != nil {
 		return nil, err
 	}
-	if err := sqlmigrate.Apply(db, migrations); err != nil {
+	if err := d.migrate(db); err != nil {
 		db.Close()
 		return nil, err
 	}
 	r := &Recorder{
-		db: db,
-		ch: make(chan Event, 1024),
+		db:           db,
+		d:            d,
+		ch:           make(chan Event, cfg.BufferSize),
+		blockTimeout: cfg.BlockTimeout,
+		transfer:     make(map[transferKey]int64),
+		live:         make(map[int]liveSubscriber),
+		visitors:     cfg.Visitors,
+		cipher:       cfg.Cipher,
+	}
+	if err := r.encryptPlainIdentities(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := r.loadOptOuts(); err != nil {
+		db.Close()
+		return nil, err
 	}
 	r.wg.Add(1)
 	go r.writer()
 	return r, nil
 }
 
-var migrations = []func(*sql.Tx) error{
-	// 1: baseline schema with all current columns.
-	func(tx *sql.Tx) error {
-		if _, err := tx.Exec(`
-			CREATE TABLE IF NOT EXISTS requests (
-				id              INTEGER PRIMARY KEY AUTOINCREMENT,
-				ts              TEXT NOT NULL,
-				site            TEXT NOT NULL,
-				path            TEXT NOT NULL,
-				status          INTEGER NOT NULL,
-				user_login      TEXT NOT NULL DEFAULT '',
-				user_name       TEXT NOT NULL DEFAULT '',
-				profile_pic_url TEXT NOT NULL DEFAULT '',
-				node_name       TEXT NOT NULL DEFAULT '',
-				node_ip         TEXT NOT NULL DEFAULT '',
-				os              TEXT NOT NULL DEFAULT '',
-				os_version      TEXT NOT NULL DEFAULT '',
-				device          TEXT NOT NULL DEFAULT '',
-				tags            TEXT NOT NULL DEFAULT ''
-			);
-		`); err != nil {
-			return err
-		}
-		if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_requests_site_ts ON requests(site, ts)`); err != nil {
-			return err
-		}
-		// For pre-existing databases: add profile_pic_url if missing.
-		// Ignore "duplicate column" errors for DBs that already have it.
-		_, _ = tx.Exec(`ALTER TABLE requests ADD COLUMN profile_pic_url TEXT NOT NULL DEFAULT ''`)
-		return nil
-	},
-}
-
-// Record sends an event to the writer goroutine. Non-blocking; drops on full
-// buffer. Safe to call after Close (no-op).
+// Record sends an event to the writer goroutine. When the buffer is full it
+// waits up to the configured block timeout, then drops the event and counts
+// it in Dropped. Events of visitors who opted out are discarded; the others
+// are sent to live subscribers first. Safe to call after Close (no-op).
 func (r *Recorder) Record(e Event) {
-	if r.closed.Load() {
+	if r.closed.Load() || r.OptedOut(e.UserLogin) {
 		return
 	}
+	r.broadcast(e)
 	defer func() {
 		if x := recover(); x != nil {
 			// Channel was closed between the closed check and the send.
@@ -102,8 +171,25 @@ func (r *Recorder) Record(e Event) {
 	}()
 	select {
 	case r.ch <- e:
+		return
 	default:
 	}
+	if r.blockTimeout > 0 {
+		timer := time.NewTimer(r.blockTimeout)
+		defer timer.Stop()
+		select {
+		case r.ch <- e:
+			return
+		case <-timer.C:
+		}
+	}
+	r.dropped.Add(1)
+	metrics.CountAnalyticsDropped()
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (r *Recorder) Dropped() uint64 {
+	return r.dropped.Load()
 }
 
 func (r *Recorder) writer() {
@@ -119,6 +205,7 @@ func (r *Recorder) writer() {
 				if len(batch) > 0 {
 					r.flush(batch)
 				}
+				r.flushTransfer()
 				return
 			}
 			batch = append(batch, e)
@@ -131,46 +218,145 @@ func (r *Recorder) writer() {
 				r.flush(batch)
 				batch = nil
 			}
+			r.flushTransfer()
 		}
 	}
 }
 
 func (r *Recorder) flush(events []Event) {
+	if _, err := r.insert(events); err != nil {
+		slog.Error("analytics: writing batch failed", "err", err)
+	}
+}
+
+// insert writes events in a single transaction, and returns how many were
+// written. Events with an ID that was written before are skipped.
+func (r *Recorder) insert(events []Event) (int, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		slog.Error("analytics: begin tx failed", "err", err)
-		return
+		return 0, err
 	}
-	stmt, err := tx.Prepare(`INSERT INTO requests (ts, site, path, status, user_login, user_name, profile_pic_url, node_name, node_ip, os, os_version, device, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(r.d.rebind(`INSERT INTO requests (ts, site, path, status, user_login, user_name, profile_pic_url, node_name, node_ip, os, os_version, device, tags, deployment_id, is_bot, weight, is_download, event_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`))
 	if err != nil {
-		slog.Error("analytics: prepare failed", "err", err)
 		tx.Rollback()
-		return
+		return 0, err
 	}
 	defer stmt.Close()
+	c := r.cipher
+	written := 0
 	for _, e := range events {
 		tags := strings.Join(e.Tags, ",")
-		_, err := stmt.Exec(
-			e.Timestamp.UTC().Format(time.RFC3339),
+		var id any
+		if e.ID != "" {
+			id = e.ID
+		}
+		// Identities are encrypted deterministically, so queries can still
+		// group and count visitors by them.
+		res, err := stmt.Exec(
+			r.d.timeArg(e.Timestamp),
 			e.Site, e.Path, e.Status,
-			e.UserLogin, e.UserName, e.ProfilePicURL,
-			e.NodeName, e.NodeIP,
-			e.OS, e.OSVersion, e.Device, tags,
+			c.EncryptDeterministic(e.UserLogin), c.EncryptDeterministic(e.UserName), c.EncryptDeterministic(e.ProfilePicURL),
+			c.EncryptDeterministic(e.NodeName), c.EncryptDeterministic(e.NodeIP),
+			e.OS, e.OSVersion, e.Device, tags, e.DeploymentID, e.Bot, max(e.Weight, 1), e.Download, id,
 		)
 		if err != nil {
-			slog.Error("analytics: insert failed", "err", err)
 			tx.Rollback()
-			return
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			written += int(n)
 		}
 	}
-	if err := tx.Commit(); err != nil {
-		slog.Error("analytics: commit failed", "err", err)
+	return written, tx.Commit()
+}
+
+// Import writes events synchronously, bypassing the buffered writer. Used to
+// restore analytics from a site export.
+func (r *Recorder) Import(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	_, err := r.insert(events)
+	return err
+}
+
+// ExportSite calls fn for every recorded event of site, oldest first.
+// Iteration stops at the first error fn returns.
+func (r *Recorder) ExportSite(site string, fn func(Event) error) error {
+	rows, err := r.query(`SELECT `+eventColumns+` FROM requests WHERE site = ? ORDER BY ts, id`, site)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := r.scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// eventColumns are the columns of requests scanEvent reads.
+const eventColumns = `ts, site, path, status, user_login, user_name, profile_pic_url, node_name, node_ip, os, os_version, device, tags, deployment_id, is_bot, weight, is_download`
+
+// scanEvent reads an event from the eventColumns of rows, followed by
+// extra columns, decrypting the identities of its visitor.
+func (r *Recorder) scanEvent(rows *sql.Rows, extra ...any) (Event, error) {
+	var e Event
+	var ts any
+	var tags string
+	if err := rows.Scan(append([]any{
+		&ts, &e.Site, &e.Path, &e.Status,
+		&e.UserLogin, &e.UserName, &e.ProfilePicURL,
+		&e.NodeName, &e.NodeIP,
+		&e.OS, &e.OSVersion, &e.Device, &tags, &e.DeploymentID, &e.Bot, &e.Weight, &e.Download,
+	}, extra...)...); err != nil {
+		return Event{}, err
+	}
+	if err := r.decrypt(&e.UserLogin, &e.UserName, &e.ProfilePicURL, &e.NodeName, &e.NodeIP); err != nil {
+		return Event{}, err
+	}
+	e.Timestamp = r.d.parseTime(ts)
+	if tags != "" {
+		e.Tags = strings.Split(tags, ",")
+	}
+	if e.Weight == 1 {
+		e.Weight = 0
+	}
+	return e, nil
+}
+
+// decrypt replaces each encrypted field with its plain text.
+func (r *Recorder) decrypt(fields ...*string) error {
+	for _, f := range fields {
+		plain, err := r.cipher.Decrypt(*f)
+		if err != nil {
+			return err
+		}
+		*f = plain
+	}
+	return nil
+}
+
+// reveal is decrypt for display, showing fields that cannot be decrypted
+// as "[encrypted]".
+func (r *Recorder) reveal(fields ...*string) {
+	for _, f := range fields {
+		*f = r.cipher.Reveal(*f)
 	}
 }
 
-// DB returns the underlying database connection for shared use.
+// DB returns the underlying database connection for shared use. Callers
+// that need SQLite must check Driver first.
 func (r *Recorder) DB() *sql.DB { return r.db }
 
+// Driver returns the database driver in use.
+func (r *Recorder) Driver() string { return r.d.driver() }
+
 // Ping checks whether the analytics database is reachable.
 func (r *Recorder) Ping() error {
 	return r.db.Ping()
@@ -184,11 +370,6 @@ func (r *Recorder) Close() error {
 	return r.db.Close()
 }
 
-// bucketSQL is the SQL expression that truncates a timestamp to a bucket
-// boundary using epoch-based rounding. It requires two int parameters: the
-// step size in seconds, passed twice.
-const bucketSQL = `strftime('%Y-%m-%dT%H:%M:%SZ', (CAST(strftime('%s', ts) AS INTEGER) / ?) * ?, 'unixepoch')`
-
 // bucketStep returns the largest "nice" step that produces at least 64 buckets.
 func bucketStep(from, to time.Time) time.Duration {
 	d := to.Sub(from)
@@ -211,33 +392,48 @@ func bucketStep(from, to time.Time) time.Duration {
 	return 15 * time.Minute
 }
 
-// fillBuckets takes sparse SQL results and returns a complete series with
-// zero-filled gaps from `from` to `to`.
-func fillBuckets(sparse []TimeBucket, from, to time.Time) []TimeBucket {
-	if from.IsZero() && len(sparse) > 0 {
-		// "all" range: derive from from the first bucket
-		t, err := time.Parse(time.RFC3339, sparse[0].Time)
-		if err == nil {
-			from = t
-		}
-	}
-	if from.IsZero() {
-		return sparse
-	}
-
-	step := bucketStep(from, to)
-	from = from.UTC().Truncate(step)
+// seriesSteps are the bucket steps SeriesStep picks from. They all divide a
+// day, so buckets line up with midnight.
+var seriesSteps = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	3 * time.Hour,
+	4 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
 
-	// Index sparse results by their time key.
-	lookup := make(map[string]int64, len(sparse))
-	for _, b := range sparse {
-		lookup[b.Time] = b.Count
+// SeriesStep returns the smallest bucket step of at least interval that
+// splits from to to into at most maxPoints buckets, for charting tools
+// that ask for a resolution. Ranges too long for maxPoints daily buckets
+// get daily buckets anyway.
+func SeriesStep(from, to time.Time, interval time.Duration, maxPoints int) time.Duration {
+	for _, s := range seriesSteps {
+		if s >= interval && (maxPoints <= 0 || to.Sub(from)/s <= time.Duration(maxPoints)) {
+			return s
+		}
 	}
+	return 24 * time.Hour
+}
 
+// fillBuckets takes sparse SQL results and returns a complete series with
+// zero-filled gaps from `from` to `to`, in buckets of step aligned to loc.
+// Sparse results may be finer than step; they are summed into the bucket
+// they fall in.
+func fillBuckets(sparse []TimeBucket, from, to time.Time, step time.Duration, loc *time.Location) []TimeBucket {
+	counts := make(map[string]int64, len(sparse))
+	first := rebucket(len(sparse), func(i int) string { return sparse[i].Time }, step, loc, func(i int, key string) {
+		counts[key] += sparse[i].Count
+	})
 	var out []TimeBucket
-	for t := from; !t.After(to.UTC()); t = t.Add(step) {
-		key := t.Format(time.RFC3339)
-		out = append(out, TimeBucket{Time: key, Count: lookup[key]})
+	for _, key := range bucketSeries(from, to, step, loc, first) {
+		out = append(out, TimeBucket{Time: key, Count: counts[key]})
 	}
 	return out
 }
@@ -261,10 +457,14 @@ type PathCount struct {
 	Count int64  `json:"count"`
 }
 
+// VisitorCount is the number of requests of a visitor. NodeName is set
+// when visitors are told apart by node; UserLogin is then one of the users
+// seen on the node, and empty for tagged nodes.
 type VisitorCount struct {
 	UserLogin     string `json:"user_login"`
 	UserName      string `json:"user_name"`
 	ProfilePicURL string `json:"profile_pic_url,omitempty"`
+	NodeName      string `json:"node_name,omitempty"`
 	Count         int64  `json:"count"`
 }
 
@@ -289,21 +489,36 @@ type NodeCount struct {
 	Count    int64  `json:"count"`
 }
 
+// DeploymentCount is the traffic a single deployment served.
+type DeploymentCount struct {
+	DeploymentID string `json:"deployment_id"`
+	Count        int64  `json:"count"`
+	ClientErrors int64  `json:"client_errors"`
+	ServerErrors int64  `json:"server_errors"`
+}
+
+// TagCount is the number of requests recorded with a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
 // --- Query methods ---
 
 func (r *Recorder) TotalRequests(site string, from, to time.Time) (int64, error) {
 	return r.TotalRequestsMulti([]string{site}, from, to)
 }
 
+// UniqueVisitors counts the visitors of site, leaving out bots.
 func (r *Recorder) UniqueVisitors(site string, from, to time.Time) (int64, error) {
-	return r.UniqueVisitorsMulti([]string{site}, from, to)
+	return r.UniqueVisitorsMulti([]string{site}, from, to, false)
 }
 
 func (r *Recorder) UniquePages(site string, from, to time.Time) (int64, error) {
-	timeCond, args := timeFilter(from, to)
+	timeCond, args := r.timeFilter(from, to)
 	args = append([]any{site}, args...)
 	var count int64
-	err := r.db.QueryRow(
+	err := r.queryRow(
 		`SELECT COUNT(DISTINCT path) FROM requests WHERE site = ? AND `+timeCond, args...,
 	).Scan(&count)
 	return count, err
@@ -313,30 +528,20 @@ func (r *Recorder) RequestsOverTime(site string, from, to time.Time) ([]TimeBuck
 	return r.RequestsOverTimeMulti([]string{site}, from, to)
 }
 
-func fillStatusBuckets(sparse []StatusTimeBucket, from, to time.Time) []StatusTimeBucket {
-	if from.IsZero() && len(sparse) > 0 {
-		t, err := time.Parse(time.RFC3339, sparse[0].Time)
-		if err == nil {
-			from = t
-		}
-	}
-	if from.IsZero() {
-		return sparse
-	}
-	step := bucketStep(from, to)
-	from = from.UTC().Truncate(step)
-	lookup := make(map[string]StatusTimeBucket, len(sparse))
-	for _, b := range sparse {
-		lookup[b.Time] = b
-	}
+func fillStatusBuckets(sparse []StatusTimeBucket, from, to time.Time, step time.Duration, loc *time.Location) []StatusTimeBucket {
+	sums := make(map[string]StatusTimeBucket, len(sparse))
+	first := rebucket(len(sparse), func(i int) string { return sparse[i].Time }, step, loc, func(i int, key string) {
+		b := sums[key]
+		b.OK += sparse[i].OK
+		b.ClientErr += sparse[i].ClientErr
+		b.ServerErr += sparse[i].ServerErr
+		sums[key] = b
+	})
 	var out []StatusTimeBucket
-	for t := from; !t.After(to.UTC()); t = t.Add(step) {
-		key := t.Format(time.RFC3339)
-		if b, ok := lookup[key]; ok {
-			out = append(out, b)
-		} else {
-			out = append(out, StatusTimeBucket{Time: key})
-		}
+	for _, key := range bucketSeries(from, to, step, loc, first) {
+		b := sums[key]
+		b.Time = key
+		out = append(out, b)
 	}
 	return out
 }
@@ -346,11 +551,11 @@ func (r *Recorder) RequestsOverTimeByStatus(site string, from, to time.Time) ([]
 }
 
 func (r *Recorder) TopPages(site string, from, to time.Time, limit int) ([]PathCount, error) {
-	timeCond, args := timeFilter(from, to)
+	timeCond, args := r.timeFilter(from, to)
 	args = append([]any{site}, args...)
 	args = append(args, limit)
-	rows, err := r.db.Query(
-		`SELECT path, COUNT(*) AS c FROM requests WHERE site = ? AND `+timeCond+` GROUP BY path ORDER BY c DESC LIMIT ?`, args...,
+	rows, err := r.query(
+		`SELECT path, SUM(weight) AS c FROM requests WHERE site = ? AND `+timeCond+` GROUP BY path ORDER BY c DESC LIMIT ?`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -367,8 +572,10 @@ func (r *Recorder) TopPages(site string, from, to time.Time, limit int) ([]PathC
 	return out, rows.Err()
 }
 
+// TopVisitors lists the visitors of site with the most requests, leaving
+// out bots.
 func (r *Recorder) TopVisitors(site string, from, to time.Time, limit int) ([]VisitorCount, error) {
-	return r.TopVisitorsMulti([]string{site}, from, to, limit)
+	return r.TopVisitorsMulti([]string{site}, from, to, limit, false)
 }
 
 func (r *Recorder) StatusBreakdown(site string, from, to time.Time) ([]StatusCount, error) {
@@ -387,6 +594,76 @@ func (r *Recorder) NodeBreakdown(site string, from, to time.Time) ([]NodeCount,
 	return r.NodeBreakdownMulti([]string{site}, from, to)
 }
 
+// DeploymentBreakdown counts the requests and errors of each deployment that
+// served site, most requests first. Requests recorded before deployments
+// were tracked are left out.
+func (r *Recorder) DeploymentBreakdown(site string, from, to time.Time) ([]DeploymentCount, error) {
+	timeCond, args := r.timeFilter(from, to)
+	rows, err := r.query(
+		`SELECT deployment_id, SUM(weight) AS c,
+			SUM(CASE WHEN status BETWEEN 400 AND 499 THEN weight ELSE 0 END),
+			SUM(CASE WHEN status >= 500 THEN weight ELSE 0 END)
+		FROM requests WHERE site = ? AND `+timeCond+` AND deployment_id != ''
+		GROUP BY deployment_id ORDER BY c DESC`, append([]any{site}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DeploymentCount
+	for rows.Next() {
+		var d DeploymentCount
+		if err := rows.Scan(&d.DeploymentID, &d.Count, &d.ClientErrors, &d.ServerErrors); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// TagBreakdown counts the requests to site recorded with each tag, most
+// requests first: the tags of visiting devices, and the tags extracted by
+// the site's analytics_tags rules, as "name:value".
+func (r *Recorder) TagBreakdown(site string, from, to time.Time, limit int) ([]TagCount, error) {
+	timeCond, args := r.timeFilter(from, to)
+	rows, err := r.query(
+		`SELECT tags, SUM(weight) FROM requests WHERE site = ? AND `+timeCond+` AND tags != ''
+		GROUP BY tags`, append([]any{site}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var tags string
+		var count int64
+		if err := rows.Scan(&tags, &count); err != nil {
+			return nil, err
+		}
+		for tag := range strings.SplitSeq(tags, ",") {
+			counts[tag] += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		out = append(out, TagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(out, func(a, b TagCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
 // --- Aggregate query methods (filtered to given sites) ---
 
 type SiteCount struct {
@@ -407,11 +684,53 @@ func siteFilter(sites []string) (string, []any) {
 
 // timeFilter appends "ts >= ?" and "ts <= ?" conditions, skipping the lower
 // bound when from is zero (meaning "all time").
-func timeFilter(from, to time.Time) (string, []any) {
+func (r *Recorder) timeFilter(from, to time.Time) (string, []any) {
 	if from.IsZero() {
-		return "ts <= ?", []any{to.UTC().Format(time.RFC3339)}
+		return "ts <= ?", []any{r.d.timeArg(to)}
 	}
-	return "ts >= ? AND ts <= ?", []any{from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)}
+	return "ts >= ? AND ts <= ?", []any{r.d.timeArg(from), r.d.timeArg(to)}
+}
+
+// botFilter returns an "AND is_bot = ?" condition leaving out requests from
+// bots, or nothing when they are included.
+func botFilter(includeBots bool) (string, []any) {
+	if includeBots {
+		return "", nil
+	}
+	return " AND is_bot = ?", []any{false}
+}
+
+// Visitors returns what tells visitors apart: VisitorsLogin, VisitorsNode,
+// or VisitorsLoginNode.
+func (r *Recorder) Visitors() string {
+	return r.visitors
+}
+
+// visitorKey returns the expression identifying a visitor in the requests
+// table, and the condition leaving out requests with no visitor identity.
+func (r *Recorder) visitorKey() (key, cond string) {
+	switch r.visitors {
+	case VisitorsNode:
+		return "node_name", "node_name != ''"
+	case VisitorsLoginNode:
+		return "user_login || '/' || node_name", "(user_login != '' OR node_name != '')"
+	default:
+		return "user_login", "user_login != ''"
+	}
+}
+
+// query, queryRow, and exec run a "?"-placeholder query in the
+// recorder's dialect.
+func (r *Recorder) query(query string, args ...any) (*sql.Rows, error) {
+	return r.db.Query(r.d.rebind(query), args...)
+}
+
+func (r *Recorder) queryRow(query string, args ...any) *sql.Row {
+	return r.db.QueryRow(r.d.rebind(query), args...)
+}
+
+func (r *Recorder) exec(query string, args ...any) (sql.Result, error) {
+	return r.db.Exec(r.d.rebind(query), args...)
 }
 
 func (r *Recorder) TotalRequestsMulti(sites []string, from, to time.Time) (int64, error) {
@@ -419,40 +738,69 @@ func (r *Recorder) TotalRequestsMulti(sites []string, from, to time.Time) (int64
 		return 0, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
+	args = append(args, timeArgs...)
+	var count int64
+	err := r.queryRow(
+		`SELECT COALESCE(SUM(weight), 0) FROM requests WHERE `+inClause+` AND `+timeCond, args...,
+	).Scan(&count)
+	return count, err
+}
+
+// EstimatedRequestsMulti counts the requests to sites that were not
+// recorded one by one but estimated from sampled asset requests.
+func (r *Recorder) EstimatedRequestsMulti(sites []string, from, to time.Time) (int64, error) {
+	if len(sites) == 0 {
+		return 0, nil
+	}
+	inClause, args := siteFilter(sites)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
 	var count int64
-	err := r.db.QueryRow(
-		`SELECT COUNT(*) FROM requests WHERE `+inClause+` AND `+timeCond, args...,
+	err := r.queryRow(
+		`SELECT COALESCE(SUM(weight), 0) FROM requests WHERE `+inClause+` AND `+timeCond+` AND weight > 1`, args...,
 	).Scan(&count)
 	return count, err
 }
 
-func (r *Recorder) UniqueVisitorsMulti(sites []string, from, to time.Time) (int64, error) {
+// UniqueVisitorsMulti counts the distinct visitors of sites. Requests from
+// bots are counted only with includeBots.
+func (r *Recorder) UniqueVisitorsMulti(sites []string, from, to time.Time, includeBots bool) (int64, error) {
 	if len(sites) == 0 {
 		return 0, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
+	botCond, botArgs := botFilter(includeBots)
+	args = append(args, botArgs...)
+	key, keyCond := r.visitorKey()
 	var count int64
-	err := r.db.QueryRow(
-		`SELECT COUNT(DISTINCT user_login) FROM requests WHERE `+inClause+` AND `+timeCond+` AND user_login != ''`, args...,
+	err := r.queryRow(
+		`SELECT COUNT(DISTINCT `+key+`) FROM requests WHERE `+inClause+` AND `+timeCond+` AND `+keyCond+botCond, args...,
 	).Scan(&count)
 	return count, err
 }
 
 func (r *Recorder) RequestsOverTimeMulti(sites []string, from, to time.Time) ([]TimeBucket, error) {
+	return r.RequestsOverTimeIn(sites, from, to, time.UTC)
+}
+
+// RequestsOverTimeIn is RequestsOverTimeMulti with buckets aligned to loc,
+// so that daily buckets start at local midnight. Bucket times are formatted
+// with loc's offset.
+func (r *Recorder) RequestsOverTimeIn(sites []string, from, to time.Time, loc *time.Location) ([]TimeBucket, error) {
 	if len(sites) == 0 {
 		return nil, nil
 	}
-	stepSecs := int(bucketStep(from, to).Seconds())
+	step := bucketStep(from, to)
+	grain := queryGrain(from, to, step, loc)
 	inClause, siteArgs := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
-	args := append([]any{stepSecs, stepSecs}, siteArgs...)
+	timeCond, timeArgs := r.timeFilter(from, to)
+	args := append([]any{int(grain.Seconds()), int(grain.Seconds())}, siteArgs...)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT `+bucketSQL+` AS bucket, COUNT(*) FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY bucket ORDER BY bucket`, args...,
+	rows, err := r.query(
+		`SELECT `+r.d.bucketSQL()+` AS bucket, SUM(weight) FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY bucket ORDER BY bucket`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -469,23 +817,39 @@ func (r *Recorder) RequestsOverTimeMulti(sites []string, from, to time.Time) ([]
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return fillBuckets(sparse, from, to), nil
+	return fillBuckets(sparse, from, to, step, loc), nil
 }
 
 func (r *Recorder) RequestsOverTimeByStatusMulti(sites []string, from, to time.Time) ([]StatusTimeBucket, error) {
+	return r.RequestsOverTimeByStatusIn(sites, from, to, time.UTC)
+}
+
+// RequestsOverTimeByStatusIn is RequestsOverTimeByStatusMulti with buckets
+// aligned to loc, like RequestsOverTimeIn.
+func (r *Recorder) RequestsOverTimeByStatusIn(sites []string, from, to time.Time, loc *time.Location) ([]StatusTimeBucket, error) {
+	return r.statusSeries(sites, from, to, bucketStep(from, to), loc)
+}
+
+// RequestsOverTimeByStatusStep is RequestsOverTimeByStatusMulti in UTC
+// buckets of step, which must be one of the steps SeriesStep returns.
+func (r *Recorder) RequestsOverTimeByStatusStep(sites []string, from, to time.Time, step time.Duration) ([]StatusTimeBucket, error) {
+	return r.statusSeries(sites, from, to, step, time.UTC)
+}
+
+func (r *Recorder) statusSeries(sites []string, from, to time.Time, step time.Duration, loc *time.Location) ([]StatusTimeBucket, error) {
 	if len(sites) == 0 {
 		return nil, nil
 	}
-	stepSecs := int(bucketStep(from, to).Seconds())
+	grain := queryGrain(from, to, step, loc)
 	inClause, siteArgs := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
-	args := append([]any{stepSecs, stepSecs}, siteArgs...)
+	timeCond, timeArgs := r.timeFilter(from, to)
+	args := append([]any{int(grain.Seconds()), int(grain.Seconds())}, siteArgs...)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT `+bucketSQL+` AS bucket,
-			SUM(CASE WHEN status/100 IN (1,2,3) THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status/100 = 4 THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status/100 = 5 THEN 1 ELSE 0 END)
+	rows, err := r.query(
+		`SELECT `+r.d.bucketSQL()+` AS bucket,
+			SUM(CASE WHEN status/100 IN (1,2,3) THEN weight ELSE 0 END),
+			SUM(CASE WHEN status/100 = 4 THEN weight ELSE 0 END),
+			SUM(CASE WHEN status/100 = 5 THEN weight ELSE 0 END)
 		FROM requests WHERE `+inClause+` AND `+timeCond+`
 		GROUP BY bucket ORDER BY bucket`, args...,
 	)
@@ -504,7 +868,7 @@ func (r *Recorder) RequestsOverTimeByStatusMulti(sites []string, from, to time.T
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return fillStatusBuckets(sparse, from, to), nil
+	return fillStatusBuckets(sparse, from, to, step, loc), nil
 }
 
 func (r *Recorder) SiteBreakdown(sites []string, from, to time.Time) ([]SiteCount, error) {
@@ -512,10 +876,10 @@ func (r *Recorder) SiteBreakdown(sites []string, from, to time.Time) ([]SiteCoun
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT site, COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY site ORDER BY c DESC`, args...,
+	rows, err := r.query(
+		`SELECT site, SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY site ORDER BY c DESC`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -532,16 +896,25 @@ func (r *Recorder) SiteBreakdown(sites []string, from, to time.Time) ([]SiteCoun
 	return out, rows.Err()
 }
 
-func (r *Recorder) TopVisitorsMulti(sites []string, from, to time.Time, limit int) ([]VisitorCount, error) {
+// TopVisitorsMulti lists the visitors of sites with the most requests.
+// Requests from bots are counted only with includeBots.
+func (r *Recorder) TopVisitorsMulti(sites []string, from, to time.Time, limit int, includeBots bool) ([]VisitorCount, error) {
 	if len(sites) == 0 {
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
+	botCond, botArgs := botFilter(includeBots)
+	args = append(args, botArgs...)
 	args = append(args, limit)
-	rows, err := r.db.Query(
-		`SELECT user_login, MAX(user_name), MAX(profile_pic_url), COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND user_login != '' GROUP BY user_login ORDER BY c DESC LIMIT ?`, args...,
+	key, keyCond := r.visitorKey()
+	node := "''"
+	if r.visitors != VisitorsLogin {
+		node = "MAX(node_name)"
+	}
+	rows, err := r.query(
+		`SELECT MAX(user_login), MAX(user_name), MAX(profile_pic_url), `+node+`, SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND `+keyCond+botCond+` GROUP BY `+key+` ORDER BY c DESC LIMIT ?`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -550,9 +923,10 @@ func (r *Recorder) TopVisitorsMulti(sites []string, from, to time.Time, limit in
 	var out []VisitorCount
 	for rows.Next() {
 		var v VisitorCount
-		if err := rows.Scan(&v.UserLogin, &v.UserName, &v.ProfilePicURL, &v.Count); err != nil {
+		if err := rows.Scan(&v.UserLogin, &v.UserName, &v.ProfilePicURL, &v.NodeName, &v.Count); err != nil {
 			return nil, err
 		}
+		r.reveal(&v.UserLogin, &v.UserName, &v.ProfilePicURL, &v.NodeName)
 		out = append(out, v)
 	}
 	return out, rows.Err()
@@ -563,10 +937,10 @@ func (r *Recorder) StatusBreakdownMulti(sites []string, from, to time.Time) ([]S
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT CAST(status/100 AS TEXT) || 'xx' AS cat, COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY cat ORDER BY cat`, args...,
+	rows, err := r.query(
+		`SELECT CAST(status/100 AS TEXT) || 'xx' AS cat, SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY cat ORDER BY cat`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -588,10 +962,10 @@ func (r *Recorder) HourlyPatternMulti(sites []string, from, to time.Time) ([]Hou
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT CAST(strftime('%H', ts) AS INTEGER) AS h, COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY h ORDER BY h`, args...,
+	rows, err := r.query(
+		`SELECT `+r.d.hourSQL()+` AS h, SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY h ORDER BY h`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -608,15 +982,62 @@ func (r *Recorder) HourlyPatternMulti(sites []string, from, to time.Time) ([]Hou
 	return out, rows.Err()
 }
 
+// HourlyPatternIn is HourlyPatternMulti with hours of the day in loc.
+func (r *Recorder) HourlyPatternIn(sites []string, from, to time.Time, loc *time.Location) ([]HourCount, error) {
+	if isUTC(loc) {
+		return r.HourlyPatternMulti(sites, from, to)
+	}
+	if len(sites) == 0 {
+		return nil, nil
+	}
+	// Count per grain, each of which falls within a single local hour,
+	// then sum by local hour.
+	grain := queryGrain(from, to, time.Hour, loc)
+	inClause, args := siteFilter(sites)
+	timeCond, timeArgs := r.timeFilter(from, to)
+	args = append([]any{int(grain.Seconds()), int(grain.Seconds())}, args...)
+	args = append(args, timeArgs...)
+	rows, err := r.query(
+		`SELECT `+r.d.bucketSQL()+` AS bucket, SUM(weight) FROM requests WHERE `+inClause+` AND `+timeCond+` GROUP BY bucket`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var counts [24]int64
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, key)
+		if err != nil {
+			continue
+		}
+		counts[t.In(loc).Hour()] += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var out []HourCount
+	for h, n := range counts {
+		if n > 0 {
+			out = append(out, HourCount{Hour: h, Count: n})
+		}
+	}
+	return out, nil
+}
+
 func (r *Recorder) OSBreakdownMulti(sites []string, from, to time.Time) ([]OSCount, error) {
 	if len(sites) == 0 {
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT os, COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND os != '' GROUP BY os ORDER BY c DESC`, args...,
+	rows, err := r.query(
+		`SELECT os, SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND os != '' GROUP BY os ORDER BY c DESC`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -638,10 +1059,10 @@ func (r *Recorder) NodeBreakdownMulti(sites []string, from, to time.Time) ([]Nod
 		return nil, nil
 	}
 	inClause, args := siteFilter(sites)
-	timeCond, timeArgs := timeFilter(from, to)
+	timeCond, timeArgs := r.timeFilter(from, to)
 	args = append(args, timeArgs...)
-	rows, err := r.db.Query(
-		`SELECT node_name, MAX(os), COUNT(*) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND node_name != '' GROUP BY node_name ORDER BY c DESC`, args...,
+	rows, err := r.query(
+		`SELECT node_name, MAX(os), SUM(weight) AS c FROM requests WHERE `+inClause+` AND `+timeCond+` AND node_name != '' GROUP BY node_name ORDER BY c DESC`, args...,
 	)
 	if err != nil {
 		return nil, err
@@ -653,13 +1074,14 @@ func (r *Recorder) NodeBreakdownMulti(sites []string, from, to time.Time) ([]Nod
 		if err := rows.Scan(&n.NodeName, &n.OS, &n.Count); err != nil {
 			return nil, err
 		}
+		r.reveal(&n.NodeName)
 		out = append(out, n)
 	}
 	return out, rows.Err()
 }
 
 func (r *Recorder) PurgeSite(site string) (int64, error) {
-	res, err := r.db.Exec(`DELETE FROM requests WHERE site = ?`, site)
+	res, err := r.exec(`DELETE FROM requests WHERE site = ?`, site)
 	if err != nil {
 		return 0, err
 	}
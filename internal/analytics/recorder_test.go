@@ -1,9 +1,14 @@
 package analytics
 
 import (
+	"encoding/base64"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"tspages/internal/fieldcrypt"
 )
 
 func TestRecorder_RecordAndClose(t *testing.T) {
@@ -108,6 +113,116 @@ func setupTestRecorder(t *testing.T) *Recorder {
 	return r2
 }
 
+func testCipher(t *testing.T) *fieldcrypt.Cipher {
+	t.Helper()
+	c, err := fieldcrypt.New(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRecorder_EncryptsIdentities(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	r, err := NewRecorderWithConfig(dbPath, RecorderConfig{Cipher: testCipher(t), Visitors: VisitorsLoginNode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	alice := Event{Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com", UserName: "Alice",
+		NodeName: "alice-mac.ts.net.", NodeIP: "100.64.0.1"}
+	for i := range 3 {
+		e := alice
+		e.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if err := r.Import([]Event{e}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var login, ip string
+	if err := r.DB().QueryRow(`SELECT user_login, node_ip FROM requests LIMIT 1`).Scan(&login, &ip); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(login, "alice") || strings.Contains(ip, "100.64") {
+		t.Errorf("identities stored in plain text: %q, %q", login, ip)
+	}
+
+	from, to := base.Add(-time.Hour), base.Add(time.Hour)
+	visitors, err := r.TopVisitors("docs", from, to, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visitors) != 1 || visitors[0].UserLogin != "alice@example.com" || visitors[0].NodeName != "alice-mac.ts.net." || visitors[0].Count != 3 {
+		t.Errorf("visitors = %+v, want alice once with 3 requests", visitors)
+	}
+	if n, _ := r.UniqueVisitors("docs", from, to); n != 1 {
+		t.Errorf("unique visitors = %d, want 1", n)
+	}
+	var exported []Event
+	if err := r.ExportSite("docs", func(e Event) error { exported = append(exported, e); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 3 || exported[0].UserName != "Alice" || exported[0].NodeIP != "100.64.0.1" {
+		t.Errorf("exported = %+v", exported[0])
+	}
+}
+
+func TestRecorder_EncryptsEarlierIdentities(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	alice := Event{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com", UserName: "Alice",
+		NodeName: "alice-mac.ts.net.", NodeIP: "100.64.0.1"}
+
+	r, err := NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Import([]Event{alice}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOptOut("bob@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	r, err = NewRecorderWithConfig(dbPath, RecorderConfig{Cipher: testCipher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	alice.Timestamp = base.Add(time.Minute)
+	if err := r.Import([]Event{alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	var plain int
+	if err := r.DB().QueryRow(`SELECT COUNT(*) FROM requests WHERE user_login LIKE '%alice%' OR user_name = 'Alice' OR node_ip = '100.64.0.1'`).Scan(&plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain != 0 {
+		t.Errorf("%d rows still store identities in plain text", plain)
+	}
+	if err := r.DB().QueryRow(`SELECT COUNT(*) FROM opt_outs WHERE user_login LIKE '%bob%'`).Scan(&plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain != 0 || !r.OptedOut("bob@example.com") {
+		t.Error("opt-out not carried over encrypted")
+	}
+
+	from, to := base.Add(-time.Hour), base.Add(time.Hour)
+	if n, _ := r.UniqueVisitors("docs", from, to); n != 1 {
+		t.Errorf("unique visitors = %d, want 1", n)
+	}
+	visitors, err := r.TopVisitors("docs", from, to, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visitors) != 1 || visitors[0].UserLogin != "alice@example.com" || visitors[0].Count != 2 {
+		t.Errorf("visitors = %+v, want alice once with 2 requests", visitors)
+	}
+}
+
 func TestRecorder_TotalRequests(t *testing.T) {
 	r := setupTestRecorder(t)
 	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
@@ -198,6 +313,195 @@ func TestRecorder_NodeBreakdown(t *testing.T) {
 	}
 }
 
+func TestRecorder_DeploymentBreakdown(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	r.Import([]Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, DeploymentID: "aaa11111"},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, DeploymentID: "aaa11111"},
+		{Timestamp: base, Site: "docs", Path: "/x", Status: 404, DeploymentID: "aaa11111"},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 502, DeploymentID: "bbb22222"},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200},
+		{Timestamp: base, Site: "demo", Path: "/", Status: 200, DeploymentID: "ccc33333"},
+	})
+
+	got, err := r.DeploymentBreakdown("docs", time.Time{}, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DeploymentCount{
+		{DeploymentID: "aaa11111", Count: 3, ClientErrors: 1},
+		{DeploymentID: "bbb22222", Count: 1, ServerErrors: 1},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("breakdown = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecorder_Bots(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	r.Import([]Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com"},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "tagged-devices", Tags: []string{"tag:ci"}, Bot: true},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "tagged-devices", Tags: []string{"tag:ci"}, Bot: true},
+	})
+	sites := []string{"docs"}
+	to := base.Add(time.Hour)
+
+	if n, err := r.UniqueVisitorsMulti(sites, time.Time{}, to, false); err != nil || n != 1 {
+		t.Errorf("visitors without bots = %d, %v; want 1", n, err)
+	}
+	if n, err := r.UniqueVisitorsMulti(sites, time.Time{}, to, true); err != nil || n != 2 {
+		t.Errorf("visitors with bots = %d, %v; want 2", n, err)
+	}
+	if v, err := r.TopVisitorsMulti(sites, time.Time{}, to, 10, false); err != nil || len(v) != 1 || v[0].UserLogin != "alice@example.com" {
+		t.Errorf("top visitors without bots = %+v, %v", v, err)
+	}
+	if v, err := r.TopVisitorsMulti(sites, time.Time{}, to, 10, true); err != nil || len(v) != 2 || v[0].UserLogin != "tagged-devices" {
+		t.Errorf("top visitors with bots = %+v, %v", v, err)
+	}
+	// Requests still count in full.
+	if n, _ := r.TotalRequests("docs", time.Time{}, to); n != 3 {
+		t.Errorf("total = %d, want 3", n)
+	}
+
+	var bots int
+	r.ExportSite("docs", func(e Event) error {
+		if e.Bot {
+			bots++
+		}
+		return nil
+	})
+	if bots != 2 {
+		t.Errorf("exported %d bot events, want 2", bots)
+	}
+}
+
+func TestRecorder_Visitors(t *testing.T) {
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com", NodeName: "alice-mac", Weight: 2},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com", NodeName: "alice-phone", Weight: 2},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com", NodeName: "kiosk"},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "carol@example.com", NodeName: "kiosk", Weight: 3},
+	}
+	tests := []struct {
+		visitors string
+		want     int64
+		top      VisitorCount
+	}{
+		{"", 3, VisitorCount{UserLogin: "alice@example.com", Count: 4}},
+		{VisitorsNode, 3, VisitorCount{UserLogin: "carol@example.com", NodeName: "kiosk", Count: 4}},
+		{VisitorsLoginNode, 4, VisitorCount{UserLogin: "carol@example.com", NodeName: "kiosk", Count: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.visitors, func(t *testing.T) {
+			r, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), RecorderConfig{Visitors: tt.visitors})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			r.Import(events)
+			to := base.Add(time.Hour)
+			if n, err := r.UniqueVisitors("docs", time.Time{}, to); err != nil || n != tt.want {
+				t.Errorf("visitors = %d, %v; want %d", n, err, tt.want)
+			}
+			v, err := r.TopVisitorsMulti([]string{"docs"}, time.Time{}, to, 10, false)
+			if err != nil || len(v) != int(tt.want) || v[0] != tt.top {
+				t.Errorf("top visitors = %+v, %v; want %d starting with %+v", v, err, tt.want, tt.top)
+			}
+		})
+	}
+
+	if _, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), RecorderConfig{Visitors: "device"}); err == nil {
+		t.Error("unknown visitor identity should be rejected")
+	}
+}
+
+func TestRecorder_SampledWeights(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	r.Import([]Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200},
+		{Timestamp: base, Site: "docs", Path: "/app.js", Status: 200, Weight: 10},
+		{Timestamp: base, Site: "docs", Path: "/missing.png", Status: 404, Weight: 10},
+	})
+	sites := []string{"docs"}
+	to := base.Add(time.Hour)
+
+	if n, err := r.TotalRequests("docs", time.Time{}, to); err != nil || n != 21 {
+		t.Errorf("total = %d, %v; want 21", n, err)
+	}
+	if n, err := r.EstimatedRequestsMulti(sites, time.Time{}, to); err != nil || n != 20 {
+		t.Errorf("estimated = %d, %v; want 20", n, err)
+	}
+	if pages, err := r.TopPages("docs", time.Time{}, to, 1); err != nil || len(pages) != 1 || pages[0].Count != 10 {
+		t.Errorf("top pages = %+v, %v", pages, err)
+	}
+	codes, _ := r.StatusBreakdown("docs", time.Time{}, to)
+	if len(codes) != 2 || codes[0] != (StatusCount{Status: "2xx", Count: 11}) || codes[1] != (StatusCount{Status: "4xx", Count: 10}) {
+		t.Errorf("status breakdown = %+v", codes)
+	}
+
+	// Weights survive an export, and unsampled events keep none.
+	var weights []int
+	r.ExportSite("docs", func(e Event) error {
+		weights = append(weights, e.Weight)
+		return nil
+	})
+	if !slices.Equal(weights, []int{0, 10, 10}) {
+		t.Errorf("exported weights = %v, want [0 10 10]", weights)
+	}
+}
+
+func TestRecorder_TagBreakdown(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	r.Import([]Event{
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, Tags: []string{"tag:server", "campaign:spring"}},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, Tags: []string{"campaign:spring"}},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, Tags: []string{"campaign:spring"}},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, Tags: []string{"tag:server"}},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200, Tags: []string{"source:mail"}},
+		{Timestamp: base, Site: "docs", Path: "/", Status: 200},
+		{Timestamp: base, Site: "demo", Path: "/", Status: 200, Tags: []string{"campaign:spring"}},
+	})
+
+	got, err := r.TagBreakdown("docs", time.Time{}, base.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TagCount{{"campaign:spring", 3}, {"tag:server", 2}, {"source:mail", 1}}
+	if !slices.Equal(got, want) {
+		t.Errorf("breakdown = %+v, want %+v", got, want)
+	}
+
+	got, err = r.TagBreakdown("docs", time.Time{}, base.Add(time.Hour), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("limited breakdown = %+v, want %+v", got, want[:1])
+	}
+}
+
 func TestRecorder_RequestsOverTime(t *testing.T) {
 	r := setupTestRecorder(t)
 	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
@@ -280,6 +584,51 @@ func TestRecorder_RequestsOverTimeByStatus(t *testing.T) {
 	}
 }
 
+func TestRecorder_RequestsOverTimeByStatusStep(t *testing.T) {
+	r := setupTestRecorder(t)
+	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 25, 0, 0, 0, 0, time.UTC)
+
+	buckets, err := r.RequestsOverTimeByStatusStep([]string{"docs"}, from, to, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 24*12+1 {
+		t.Fatalf("got %d buckets, want %d", len(buckets), 24*12+1)
+	}
+	if buckets[1].Time != "2026-02-24T00:05:00Z" {
+		t.Errorf("second bucket starts at %s, want 00:05", buckets[1].Time)
+	}
+	var total int64
+	for _, b := range buckets {
+		total += b.OK + b.ClientErr + b.ServerErr
+	}
+	if total != 4 {
+		t.Errorf("total = %d, want 4", total)
+	}
+}
+
+func TestSeriesStep(t *testing.T) {
+	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		span      time.Duration
+		interval  time.Duration
+		maxPoints int
+		want      time.Duration
+	}{
+		{time.Hour, 0, 0, time.Minute},
+		{time.Hour, 20 * time.Second, 1000, time.Minute},
+		{time.Hour, 7 * time.Minute, 1000, 10 * time.Minute},
+		{7 * 24 * time.Hour, time.Minute, 200, time.Hour},
+		{365 * 24 * time.Hour, time.Hour, 100, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := SeriesStep(from, from.Add(tt.span), tt.interval, tt.maxPoints); got != tt.want {
+			t.Errorf("SeriesStep(%s, %s, %d) = %s, want %s", tt.span, tt.interval, tt.maxPoints, got, tt.want)
+		}
+	}
+}
+
 func TestRecorder_StatusBreakdown(t *testing.T) {
 	r := setupTestRecorder(t)
 	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
@@ -345,7 +694,7 @@ func TestRecorder_MultiSiteQueries(t *testing.T) {
 		t.Errorf("TotalRequestsMulti = %d, want 3", total)
 	}
 
-	visitors, err := r2.UniqueVisitorsMulti(sites, from, to)
+	visitors, err := r2.UniqueVisitorsMulti(sites, from, to, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -377,7 +726,7 @@ func TestRecorder_MultiSiteQueries(t *testing.T) {
 		t.Errorf("SiteBreakdown got %d sites, want 2", len(siteCounts))
 	}
 
-	topV, err := r2.TopVisitorsMulti(sites, from, to, 10)
+	topV, err := r2.TopVisitorsMulti(sites, from, to, 10, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -437,7 +786,7 @@ func TestRecorder_MultiSiteQueries_EmptySites(t *testing.T) {
 		t.Errorf("TotalRequestsMulti(nil) = %d, want 0", total)
 	}
 
-	visitors, err := r.UniqueVisitorsMulti(nil, from, to)
+	visitors, err := r.UniqueVisitorsMulti(nil, from, to, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -462,3 +811,121 @@ func TestRecorder_PurgeSite(t *testing.T) {
 		t.Errorf("count after purge = %d, want 0", count)
 	}
 }
+
+func TestRecorder_ExportAndImport(t *testing.T) {
+	r := setupTestRecorder(t)
+
+	var events []Event
+	err := r.ExportSite("docs", func(e Event) error {
+		e.Site = "handbook"
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("exported %d events, want 4", len(events))
+	}
+	if events[0].UserLogin != "alice@example.com" || events[0].Timestamp.IsZero() {
+		t.Errorf("first event = %+v", events[0])
+	}
+
+	if err := r.Import(events); err != nil {
+		t.Fatal(err)
+	}
+	count, _ := r.TotalRequests("handbook", time.Time{}, time.Now().Add(time.Hour))
+	if count != 4 {
+		t.Errorf("imported count = %d, want 4", count)
+	}
+	pages, _ := r.TopPages("handbook", time.Time{}, time.Now().Add(time.Hour), 10)
+	if len(pages) != 2 {
+		t.Errorf("imported pages = %v, want 2 paths", pages)
+	}
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	// No writer goroutine, so the buffer is never drained.
+	r := &Recorder{ch: make(chan Event, 1)}
+	r.Record(Event{Site: "docs"})
+	r.Record(Event{Site: "docs"})
+	r.Record(Event{Site: "docs"})
+	if got := r.Dropped(); got != 2 {
+		t.Errorf("dropped = %d, want 2", got)
+	}
+}
+
+func TestRecorder_BlockTimeout(t *testing.T) {
+	r := &Recorder{ch: make(chan Event, 1), blockTimeout: time.Second}
+	r.Record(Event{Path: "/first"})
+
+	// A blocked Record succeeds once the writer makes room.
+	done := make(chan struct{})
+	go func() {
+		r.Record(Event{Path: "/second"})
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	<-r.ch
+	<-done
+	if got := r.Dropped(); got != 0 {
+		t.Errorf("dropped = %d, want 0 after room was made", got)
+	}
+
+	// Without room, the event is dropped after the timeout.
+	r.blockTimeout = 10 * time.Millisecond
+	start := time.Now()
+	r.Record(Event{Path: "/third"})
+	if time.Since(start) < r.blockTimeout {
+		t.Error("Record should wait for the block timeout before dropping")
+	}
+	if got := r.Dropped(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+}
+
+func TestNewRecorderWithConfig_BufferSize(t *testing.T) {
+	r, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), RecorderConfig{BufferSize: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if cap(r.ch) != 7 {
+		t.Errorf("buffer size = %d, want 7", cap(r.ch))
+	}
+}
+
+func BenchmarkRecorder_Record(b *testing.B) {
+	r, err := NewRecorder(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	e := Event{Timestamp: time.Now(), Site: "docs", Path: "/index.html", Status: 200, UserLogin: "alice@example.com"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		r.Record(e)
+	}
+}
+
+func BenchmarkRecorder_Insert(b *testing.B) {
+	r, err := NewRecorder(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	batch := make([]Event, 100)
+	for i := range batch {
+		batch[i] = Event{Timestamp: time.Now(), Site: "docs", Path: "/index.html", Status: 200, UserLogin: "alice@example.com"}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := r.insert(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import "time"
+
+// isUTC reports whether loc keeps UTC time, so that buckets can be
+// computed entirely in SQL.
+func isUTC(loc *time.Location) bool {
+	return loc == time.UTC || loc.String() == "UTC"
+}
+
+// queryGrain returns the bucket size to group by in SQL so that every
+// group falls within a single bucket of step in loc. Outside UTC this is
+// an hour, or a quarter hour for timezones offset by a fraction of an hour,
+// and the groups are summed into steps by rebucket.
+func queryGrain(from, to time.Time, step time.Duration, loc *time.Location) time.Duration {
+	if isUTC(loc) {
+		return step
+	}
+	grain := time.Hour
+	for _, t := range []time.Time{from, to} {
+		if _, offset := t.In(loc).Zone(); offset%3600 != 0 {
+			grain = 15 * time.Minute
+		}
+	}
+	return min(grain, step)
+}
+
+// truncateIn returns the start of the bucket of step in loc that t falls
+// in. Steps of a day or more start at local midnight; shorter steps, which
+// all divide a day, start at a multiple of step on the local clock.
+func truncateIn(t time.Time, step time.Duration, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if step >= 24*time.Hour {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+	stepMin := int(step / time.Minute)
+	mins := t.Hour()*60 + t.Minute()
+	mins -= mins % stepMin
+	return time.Date(t.Year(), t.Month(), t.Day(), mins/60, mins%60, 0, 0, loc)
+}
+
+// nextBucket returns the start of the bucket after the one starting at t.
+func nextBucket(t time.Time, step time.Duration, loc *time.Location) time.Time {
+	if step >= 24*time.Hour {
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+	}
+	next := truncateIn(t.Add(step), step, loc)
+	if !next.After(t) {
+		// The local clock was turned back; keep counting in real time.
+		next = t.Add(step)
+	}
+	return next
+}
+
+// bucketKey formats a bucket start in loc.
+func bucketKey(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// rebucket assigns n SQL groups, whose RFC 3339 times are returned by
+// timeOf, to buckets of step in loc, calling add with each group's bucket
+// key. It returns the start of the earliest bucket, or the zero time if
+// there are no groups.
+func rebucket(n int, timeOf func(i int) string, step time.Duration, loc *time.Location, add func(i int, key string)) time.Time {
+	var first time.Time
+	for i := range n {
+		t, err := time.Parse(time.RFC3339, timeOf(i))
+		if err != nil {
+			continue
+		}
+		start := truncateIn(t, step, loc)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		add(i, bucketKey(start, loc))
+	}
+	return first
+}
+
+// bucketSeries returns the keys of every bucket from the one containing
+// from to the one containing to. For a zero from ("all" range), the series
+// starts at first.
+func bucketSeries(from, to time.Time, step time.Duration, loc *time.Location, first time.Time) []string {
+	if from.IsZero() {
+		from = first
+	}
+	if from.IsZero() {
+		return nil
+	}
+	var keys []string
+	for t := truncateIn(from, step, loc); !t.After(to); t = nextBucket(t, step, loc) {
+		keys = append(keys, bucketKey(t, loc))
+	}
+	return keys
+}
@@ -0,0 +1,122 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupMidnightRecorder(t *testing.T) *Recorder {
+	t.Helper()
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	// Either side of midnight UTC, but both after midnight in Berlin.
+	_, err = r.insert([]Event{
+		{Timestamp: time.Date(2026, 2, 24, 23, 30, 0, 0, time.UTC), Site: "docs", Path: "/", Status: 200},
+		{Timestamp: time.Date(2026, 2, 25, 0, 30, 0, 0, time.UTC), Site: "docs", Path: "/", Status: 404},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func nonZeroBuckets(buckets []TimeBucket) map[string]int64 {
+	counts := map[string]int64{}
+	for _, b := range buckets {
+		if b.Count > 0 {
+			counts[b.Time] = b.Count
+		}
+	}
+	return counts
+}
+
+func TestRequestsOverTimeIn_DailyBucketsFollowLocalMidnight(t *testing.T) {
+	r := setupMidnightRecorder(t)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	utc, err := r.RequestsOverTimeIn([]string{"docs"}, from, to, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nonZeroBuckets(utc); len(got) != 2 {
+		t.Errorf("UTC buckets = %v, want two separate days", got)
+	}
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	local, err := r.RequestsOverTimeIn([]string{"docs"}, from, to, berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nonZeroBuckets(local)
+	if len(got) != 1 || got["2026-02-25T00:00:00+01:00"] != 2 {
+		t.Errorf("Berlin buckets = %v, want both events on 2026-02-25", got)
+	}
+	// The series still covers every local day without gaps.
+	for i := 1; i < len(local); i++ {
+		prev, _ := time.Parse(time.RFC3339, local[i-1].Time)
+		cur, _ := time.Parse(time.RFC3339, local[i].Time)
+		if h := cur.Sub(prev); h < 23*time.Hour || h > 25*time.Hour {
+			t.Fatalf("gap of %v between %s and %s", h, local[i-1].Time, local[i].Time)
+		}
+	}
+}
+
+func TestRequestsOverTimeByStatusIn(t *testing.T) {
+	r := setupMidnightRecorder(t)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	buckets, err := r.RequestsOverTimeByStatusIn([]string{"docs"}, from, to, berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range buckets {
+		if b.Time != "2026-02-25T00:00:00+01:00" {
+			continue
+		}
+		if b.OK != 1 || b.ClientErr != 1 {
+			t.Errorf("bucket = %+v, want 1 ok and 1 client error", b)
+		}
+		return
+	}
+	t.Error("no bucket for 2026-02-25 in Berlin")
+}
+
+func TestHourlyPatternIn_FractionalOffset(t *testing.T) {
+	r := setupTestRecorder(t)
+	from := time.Date(2026, 2, 24, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 25, 0, 0, 0, 0, time.UTC)
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+
+	hours, err := r.HourlyPatternIn([]string{"docs"}, from, to, kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Events at 10:00-13:00 UTC are 15:30-18:30 in Kolkata.
+	want := map[int]int64{15: 1, 16: 1, 17: 1, 18: 1}
+	if len(hours) != len(want) {
+		t.Fatalf("hours = %+v, want %v", hours, want)
+	}
+	for _, h := range hours {
+		if want[h.Hour] != h.Count {
+			t.Errorf("hour %d = %d, want %d", h.Hour, h.Count, want[h.Hour])
+		}
+	}
+}
+
+func TestBucketSeries_DSTDay(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	// Clocks go forward at 02:00 on 2026-03-29, so that day has 23 hours.
+	from := time.Date(2026, 3, 29, 0, 0, 0, 0, berlin)
+	to := time.Date(2026, 3, 30, 0, 0, 0, 0, berlin)
+	series := bucketSeries(from, to, time.Hour, berlin, from)
+	if len(series) != 24 {
+		t.Errorf("got %d hourly buckets, want 24 (23 hours plus the end)", len(series))
+	}
+}
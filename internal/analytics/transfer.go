@@ -0,0 +1,166 @@
+package analytics
+
+import (
+	"log/slog"
+	"time"
+)
+
+// transferKey identifies one row of the transfer table.
+type transferKey struct {
+	site string
+	day  string // UTC, "2006-01-02"
+}
+
+// TransferBucket is the number of bytes served on one UTC day. Time is the
+// start of the day in RFC 3339, matching TimeBucket.
+type TransferBucket struct {
+	Time  string `json:"time"`
+	Bytes int64  `json:"bytes"`
+}
+
+// RecordTransfer counts n response bytes served for site at t. Counts are
+// summed in memory and written by the writer goroutine once a second, so
+// recording never touches the database on the request path. Unlike Record,
+// transfer is counted for every request, including those of opted-out
+// visitors and of sites with analytics disabled, since it identifies no one.
+func (r *Recorder) RecordTransfer(site string, t time.Time, n int64) {
+	if n <= 0 || r.closed.Load() {
+		return
+	}
+	key := transferKey{site: site, day: t.UTC().Format(time.DateOnly)}
+	r.transferMu.Lock()
+	r.transfer[key] += n
+	r.transferMu.Unlock()
+}
+
+// flushTransfer adds the pending byte counts to the transfer table. Counts
+// that fail to write are kept for the next flush.
+func (r *Recorder) flushTransfer() {
+	r.transferMu.Lock()
+	pending := r.transfer
+	r.transfer = make(map[transferKey]int64)
+	r.transferMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	err := func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() //nolint:errcheck // no-op after commit
+		stmt, err := tx.Prepare(r.d.rebind(`INSERT INTO transfer (site, day, bytes) VALUES (?, ?, ?)
+			ON CONFLICT(site, day) DO UPDATE SET bytes = transfer.bytes + excluded.bytes`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for key, n := range pending {
+			if _, err := stmt.Exec(key.site, key.day, n); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		slog.Error("analytics: writing transfer failed", "err", err)
+		r.transferMu.Lock()
+		for key, n := range pending {
+			r.transfer[key] += n
+		}
+		r.transferMu.Unlock()
+	}
+}
+
+// transferDays returns the day bounds for a transfer query. A zero from
+// means all time.
+func transferDays(from, to time.Time) (string, string) {
+	first := ""
+	if !from.IsZero() {
+		first = from.UTC().Format(time.DateOnly)
+	}
+	return first, to.UTC().Format(time.DateOnly)
+}
+
+// TotalTransfer returns the bytes served for site on the UTC days from
+// from through to.
+func (r *Recorder) TotalTransfer(site string, from, to time.Time) (int64, error) {
+	return r.TotalTransferMulti([]string{site}, from, to)
+}
+
+// TotalTransferMulti is TotalTransfer summed over sites.
+func (r *Recorder) TotalTransferMulti(sites []string, from, to time.Time) (int64, error) {
+	if len(sites) == 0 {
+		return 0, nil
+	}
+	siteCond, args := siteFilter(sites)
+	first, last := transferDays(from, to)
+	args = append(args, first, last)
+	var total int64
+	err := r.queryRow(
+		`SELECT COALESCE(SUM(bytes), 0) FROM transfer WHERE `+siteCond+` AND day >= ? AND day <= ?`, args...,
+	).Scan(&total)
+	return total, err
+}
+
+// TransferOverTime returns the bytes served for site per UTC day, with
+// empty days filled in.
+func (r *Recorder) TransferOverTime(site string, from, to time.Time) ([]TransferBucket, error) {
+	return r.TransferOverTimeMulti([]string{site}, from, to)
+}
+
+// TransferOverTimeMulti is TransferOverTime summed over sites.
+func (r *Recorder) TransferOverTimeMulti(sites []string, from, to time.Time) ([]TransferBucket, error) {
+	if len(sites) == 0 {
+		return nil, nil
+	}
+	siteCond, args := siteFilter(sites)
+	first, last := transferDays(from, to)
+	args = append(args, first, last)
+	rows, err := r.query(
+		`SELECT day, SUM(bytes) FROM transfer WHERE `+siteCond+` AND day >= ? AND day <= ? GROUP BY day ORDER BY day`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byDay := make(map[string]int64)
+	for rows.Next() {
+		var day string
+		var n int64
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		byDay[day] = n
+		if first == "" {
+			first = day
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if first == "" {
+		return nil, nil
+	}
+
+	start, _ := time.Parse(time.DateOnly, first)
+	end, _ := time.Parse(time.DateOnly, last)
+	var out []TransferBucket
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		out = append(out, TransferBucket{Time: d.Format(time.RFC3339), Bytes: byDay[d.Format(time.DateOnly)]})
+	}
+	return out, nil
+}
+
+// MarkTransferAlert records that the transfer cap notice for site went out
+// in month ("2006-01"). It reports false if one was already recorded, so
+// instances sharing a database notify once.
+func (r *Recorder) MarkTransferAlert(site, month string) (bool, error) {
+	res, err := r.exec(`INSERT INTO transfer_alerts (site, month) VALUES (?, ?) ON CONFLICT(site, month) DO NOTHING`, site, month)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
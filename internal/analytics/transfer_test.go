@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Transfer(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	day1 := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	day3 := time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)
+	r.RecordTransfer("docs", day1, 1000)
+	r.RecordTransfer("docs", day1, 500)
+	r.RecordTransfer("docs", day3, 250)
+	r.RecordTransfer("demo", day1, 9000)
+	r.RecordTransfer("docs", day3, 0)
+	r.flushTransfer()
+	// A second flush adds to the existing rows.
+	r.RecordTransfer("docs", day3, 50)
+	r.flushTransfer()
+
+	total, err := r.TotalTransfer("docs", day1, day3)
+	if err != nil || total != 1800 {
+		t.Errorf("TotalTransfer = %d, %v, want 1800", total, err)
+	}
+	if total, _ := r.TotalTransfer("docs", day3, day3); total != 300 {
+		t.Errorf("TotalTransfer(day3) = %d, want 300", total)
+	}
+	if total, _ := r.TotalTransferMulti([]string{"docs", "demo"}, time.Time{}, day3); total != 10800 {
+		t.Errorf("TotalTransferMulti = %d, want 10800", total)
+	}
+
+	buckets, err := r.TransferOverTime("docs", time.Time{}, day3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TransferBucket{
+		{Time: "2026-03-01T00:00:00Z", Bytes: 1500},
+		{Time: "2026-03-02T00:00:00Z", Bytes: 0},
+		{Time: "2026-03-03T00:00:00Z", Bytes: 300},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %+v", buckets)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+	if buckets, _ := r.TransferOverTime("none", time.Time{}, day3); buckets != nil {
+		t.Errorf("buckets for unknown site = %+v", buckets)
+	}
+}
+
+func TestRecorder_TransferFlushedOnClose(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	r, err := NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.RecordTransfer("docs", now, 42)
+	r.Close()
+
+	r, err = NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if total, _ := r.TotalTransfer("docs", now, now); total != 42 {
+		t.Errorf("total = %d, want 42", total)
+	}
+}
+
+func TestRecorder_MarkTransferAlert(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if first, err := r.MarkTransferAlert("docs", "2026-03"); err != nil || !first {
+		t.Errorf("first mark = %v, %v", first, err)
+	}
+	if again, _ := r.MarkTransferAlert("docs", "2026-03"); again {
+		t.Error("second mark reported as new")
+	}
+	if next, _ := r.MarkTransferAlert("docs", "2026-04"); !next {
+		t.Error("next month not reported as new")
+	}
+}
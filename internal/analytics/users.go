@@ -0,0 +1,75 @@
+package analytics
+
+import "time"
+
+// Visit is a request of a single visitor, for their visit history.
+type Visit struct {
+	Time     time.Time `json:"time"`
+	Site     string    `json:"site"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+	NodeName string    `json:"node_name,omitempty"`
+	OS       string    `json:"os,omitempty"`
+}
+
+// storedLogins returns the values login may be stored as: encrypted, and,
+// from before encryption was turned on, in plain text.
+func (r *Recorder) storedLogins(login string) (stored, plain string) {
+	return r.cipher.EncryptDeterministic(login), login
+}
+
+// UserNames returns the display names requests of login were recorded
+// with, such as to find the deployments of a user who deployed under one.
+func (r *Recorder) UserNames(login string) ([]string, error) {
+	stored, plain := r.storedLogins(login)
+	rows, err := r.query(`SELECT DISTINCT user_name FROM requests WHERE user_login IN (?, ?) AND user_name != ''`, stored, plain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if name, err = r.cipher.Decrypt(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// UserVisits returns the newest requests of login to sites, up to limit,
+// and how many requests of login to sites were recorded in total.
+func (r *Recorder) UserVisits(login string, sites []string, limit int) ([]Visit, int64, error) {
+	visits := []Visit{}
+	if login == "" || len(sites) == 0 {
+		return visits, 0, nil
+	}
+	inClause, args := siteFilter(sites)
+	stored, plain := r.storedLogins(login)
+	args = append(args, stored, plain)
+
+	var total int64
+	if err := r.queryRow(`SELECT COUNT(*) FROM requests WHERE `+inClause+` AND user_login IN (?, ?)`, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.query(`SELECT ts, site, path, status, node_name, os FROM requests WHERE `+inClause+` AND user_login IN (?, ?) ORDER BY ts DESC, id DESC LIMIT ?`,
+		append(args, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v Visit
+		var ts any
+		if err := rows.Scan(&ts, &v.Site, &v.Path, &v.Status, &v.NodeName, &v.OS); err != nil {
+			return nil, 0, err
+		}
+		v.Time = r.d.parseTime(ts)
+		r.reveal(&v.NodeName)
+		visits = append(visits, v)
+	}
+	return visits, total, rows.Err()
+}
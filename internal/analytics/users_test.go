@@ -0,0 +1,44 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_UserVisits(t *testing.T) {
+	r, err := NewRecorderWithConfig(filepath.Join(t.TempDir(), "test.db"), RecorderConfig{Cipher: testCipher(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	base := time.Date(2026, 2, 24, 10, 0, 0, 0, time.UTC)
+	var evs []Event
+	for i, site := range []string{"docs", "docs", "blog", "docs"} {
+		evs = append(evs, Event{Timestamp: base.Add(time.Duration(i) * time.Minute), Site: site, Path: "/", Status: 200,
+			UserLogin: "alice@example.com", UserName: "Alice", NodeName: "alice-mac"})
+	}
+	evs = append(evs, Event{Timestamp: base, Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com", UserName: "Bob"})
+	if err := r.Import(evs); err != nil {
+		t.Fatal(err)
+	}
+
+	visits, total, err := r.UserVisits("alice@example.com", []string{"docs"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(visits) != 2 {
+		t.Fatalf("got %d of %d visits, want 2 of 3", len(visits), total)
+	}
+	if !visits[0].Time.Equal(base.Add(3*time.Minute)) || visits[0].NodeName != "alice-mac" {
+		t.Errorf("newest visit = %+v", visits[0])
+	}
+
+	names, err := r.UserNames("alice@example.com")
+	if err != nil || len(names) != 1 || names[0] != "Alice" {
+		t.Errorf("UserNames = %v, %v", names, err)
+	}
+	if visits, total, _ := r.UserVisits("alice@example.com", nil, 10); len(visits) != 0 || total != 0 {
+		t.Errorf("visits without sites = %+v", visits)
+	}
+}
@@ -0,0 +1,192 @@
+// Package anomaly compares each site's recent traffic with its trailing
+// baseline and announces when requests or the share of server errors
+// deviate from it.
+package anomaly
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+const (
+	// Interval is how often Run checks the sites.
+	Interval = 15 * time.Minute
+	// Window is the recent traffic compared with the baseline.
+	Window = time.Hour
+	// Baseline is the trailing traffic before Window it is compared with.
+	Baseline = 7 * 24 * time.Hour
+
+	// minRequests is the traffic per Window below which request counts are
+	// too noisy to judge: the baseline average for request anomalies, and
+	// the window's requests for error rate anomalies.
+	minRequests = 10
+	// minErrorRate is the lowest baseline share of server errors, so a site
+	// that never failed does not alert on its first 5xx response.
+	minErrorRate = 0.01
+)
+
+// Metrics an anomaly is reported for.
+const (
+	MetricRequests  = "requests"
+	MetricErrorRate = "error_rate"
+)
+
+// Detector checks sites with an anomaly_factor for traffic that deviates
+// from their baseline by that factor. An anomaly publishes one
+// events.AnalyticsAnomaly event when it starts; the detector fires again
+// only after the metric was back to normal for a check.
+type Detector struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	bus      *events.Bus
+	defaults storage.SiteConfig
+	adminURL string
+
+	mu     sync.Mutex
+	active map[string]bool // site + "\x00" + metric
+}
+
+// NewDetector returns a Detector whose events link to the analytics pages
+// of the control plane at adminURL, such as "https://pages.example.ts.net".
+func NewDetector(store *storage.Store, recorder *analytics.Recorder, bus *events.Bus, defaults storage.SiteConfig, adminURL string) *Detector {
+	return &Detector{store: store, recorder: recorder, bus: bus, defaults: defaults, adminURL: adminURL,
+		active: make(map[string]bool)}
+}
+
+// Run checks the sites every Interval until ctx ends.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		d.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check compares every watched site's traffic in the Window before now with
+// its Baseline.
+func (d *Detector) Check(now time.Time) {
+	sites, err := d.store.ListSites()
+	if err != nil {
+		slog.Error("anomaly: listing sites", "err", err)
+		return
+	}
+	for _, site := range sites {
+		if site.ActiveDeploymentID == "" {
+			continue
+		}
+		raw, err := d.store.ReadSiteConfig(site.Name, site.ActiveDeploymentID)
+		if err != nil {
+			slog.Error("anomaly: reading site config", "site", site.Name, "err", err)
+			continue
+		}
+		cfg := raw.Merge(d.defaults)
+		if cfg.AnomalyFactor <= 0 {
+			continue
+		}
+		d.checkSite(site.Name, cfg, now)
+	}
+}
+
+func (d *Detector) checkSite(site string, cfg storage.SiteConfig, now time.Time) {
+	windowStart := now.Add(-Window)
+	recent, recentErrors, err := d.counts(site, windowStart, now)
+	if err != nil {
+		slog.Error("anomaly: querying requests", "site", site, "err", err)
+		return
+	}
+	base, baseErrors, err := d.counts(site, windowStart.Add(-Baseline), windowStart)
+	if err != nil {
+		slog.Error("anomaly: querying baseline", "site", site, "err", err)
+		return
+	}
+	factor := float64(cfg.AnomalyFactor)
+
+	// Requests per Window, on average over the baseline.
+	expected := float64(base) / float64(Baseline/Window)
+	observed := float64(recent)
+	d.update(site, MetricRequests, cfg, now,
+		expected >= minRequests && (observed >= factor*expected || observed*factor <= expected),
+		observed, expected)
+
+	var rate, baseRate float64
+	if recent > 0 {
+		rate = float64(recentErrors) / float64(recent)
+	}
+	if base > 0 {
+		baseRate = float64(baseErrors) / float64(base)
+	}
+	d.update(site, MetricErrorRate, cfg, now,
+		recent >= minRequests && rate >= factor*max(baseRate, minErrorRate),
+		rate, baseRate)
+}
+
+// counts returns the requests for site between from and to, and how many
+// of them were answered with a server error.
+func (d *Detector) counts(site string, from, to time.Time) (total, serverErrors int64, err error) {
+	codes, err := d.recorder.StatusBreakdown(site, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range codes {
+		total += c.Count
+		if c.Status == "5xx" {
+			serverErrors = c.Count
+		}
+	}
+	return total, serverErrors, nil
+}
+
+// update records whether metric of site is anomalous and publishes an event
+// if it just became so.
+func (d *Detector) update(site, metric string, cfg storage.SiteConfig, now time.Time, anomalous bool, value, baseline float64) {
+	key := site + "\x00" + metric
+	d.mu.Lock()
+	started := anomalous && !d.active[key]
+	if anomalous {
+		d.active[key] = true
+	} else {
+		delete(d.active, key)
+	}
+	d.mu.Unlock()
+	if !started {
+		return
+	}
+
+	slog.Warn("site traffic deviates from its baseline", "site", site, "metric", metric,
+		"value", value, "baseline", baseline, "factor", cfg.AnomalyFactor)
+	if d.bus == nil {
+		return
+	}
+	d.bus.Publish(events.Event{
+		Type:   events.AnalyticsAnomaly,
+		Site:   site,
+		Config: cfg,
+		Data: map[string]any{
+			"site":     site,
+			"metric":   metric,
+			"value":    value,
+			"baseline": baseline,
+			"factor":   cfg.AnomalyFactor,
+			"from":     now.Add(-Window).UTC().Format(time.RFC3339),
+			"to":       now.UTC().Format(time.RFC3339),
+			"url":      d.analyticsURL(site),
+		},
+	})
+}
+
+// analyticsURL links to the site's analytics over the baseline and window.
+func (d *Detector) analyticsURL(site string) string {
+	return d.adminURL + "/sites/" + url.PathEscape(site) + "/analytics?range=P8D"
+}
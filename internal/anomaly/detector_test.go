@@ -0,0 +1,151 @@
+package anomaly
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+func setupSite(t *testing.T, store *storage.Store, site string, cfg storage.SiteConfig) {
+	t.Helper()
+	id := storage.NewDeploymentID()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteSiteConfig(site, id, cfg); err != nil {
+		t.Fatal(err)
+	}
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// traffic returns count requests for site spread over the hour before end,
+// every nth of them answered with status 500.
+func traffic(site string, end time.Time, count, nth int) []analytics.Event {
+	var evs []analytics.Event
+	for i := range count {
+		status := 200
+		if nth > 0 && i%nth == 0 {
+			status = 500
+		}
+		evs = append(evs, analytics.Event{
+			Timestamp: end.Add(-time.Duration(i+1) * Window / time.Duration(count+1)),
+			Site:      site,
+			Path:      "/",
+			Status:    status,
+		})
+	}
+	return evs
+}
+
+func TestDetector_Check(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", storage.SiteConfig{AnomalyFactor: 3})
+	setupSite(t, store, "demo", storage.SiteConfig{})
+	setupSite(t, store, "blog", storage.SiteConfig{AnomalyFactor: 3})
+
+	recorder, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	var evs []analytics.Event
+	// A baseline of 20 requests an hour for every site.
+	for h := 1; h <= 7*24; h++ {
+		end := now.Add(-time.Duration(h) * time.Hour)
+		for _, site := range []string{"docs", "demo", "blog"} {
+			evs = append(evs, traffic(site, end, 20, 0)...)
+		}
+	}
+	// docs spikes, demo spikes without anomaly_factor, blog stays normal
+	// but fails a third of its requests.
+	evs = append(evs, traffic("docs", now, 100, 0)...)
+	evs = append(evs, traffic("demo", now, 100, 0)...)
+	evs = append(evs, traffic("blog", now, 24, 3)...)
+	if err := recorder.Import(evs); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.AnalyticsAnomaly, func(e events.Event) { got = append(got, e) })
+
+	d := NewDetector(store, recorder, bus, storage.SiteConfig{}, "https://pages.example.ts.net")
+	d.Check(now)
+	if len(got) != 2 {
+		t.Fatalf("events = %+v, want 2", got)
+	}
+	docs, blog := got[0], got[1]
+	if docs.Site == "blog" {
+		docs, blog = blog, docs
+	}
+	if docs.Site != "docs" || docs.Data["metric"] != MetricRequests || docs.Data["value"] != 100.0 || docs.Data["baseline"] != 20.0 {
+		t.Errorf("docs event = %+v", docs.Data)
+	}
+	if docs.Data["url"] != "https://pages.example.ts.net/sites/docs/analytics?range=P8D" {
+		t.Errorf("url = %v", docs.Data["url"])
+	}
+	if blog.Site != "blog" || blog.Data["metric"] != MetricErrorRate {
+		t.Errorf("blog event = %+v", blog.Data)
+	}
+
+	// An ongoing anomaly does not fire again.
+	got = nil
+	d.Check(now)
+	if len(got) != 0 {
+		t.Errorf("repeated check fired %d events", len(got))
+	}
+
+	// Once traffic is back to normal, the next spike fires again.
+	later := now.Add(time.Hour)
+	if err := recorder.Import(append(traffic("docs", later, 20, 0), traffic("blog", later, 20, 0)...)); err != nil {
+		t.Fatal(err)
+	}
+	d.Check(later)
+	if err := recorder.Import(append(traffic("docs", later.Add(time.Hour), 100, 0), traffic("blog", later.Add(time.Hour), 20, 0)...)); err != nil {
+		t.Fatal(err)
+	}
+	d.Check(later.Add(time.Hour))
+	if len(got) != 1 || got[0].Site != "docs" {
+		t.Errorf("events after recovery = %+v", got)
+	}
+}
+
+func TestDetector_Drop(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", storage.SiteConfig{})
+
+	recorder, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	var evs []analytics.Event
+	for h := 1; h <= 7*24; h++ {
+		evs = append(evs, traffic("docs", now.Add(-time.Duration(h)*time.Hour), 40, 0)...)
+	}
+	evs = append(evs, traffic("docs", now, 5, 0)...)
+	if err := recorder.Import(evs); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.AnalyticsAnomaly, func(e events.Event) { got = append(got, e) })
+
+	// The factor comes from the defaults.
+	NewDetector(store, recorder, bus, storage.SiteConfig{AnomalyFactor: 4}, "").Check(now)
+	if len(got) != 1 || got[0].Data["metric"] != MetricRequests || got[0].Data["value"] != 5.0 {
+		t.Errorf("events = %+v", got)
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"slices"
 )
 
 // Cap represents a single capability object from the tailnet policy.
 // Access is one of "admin", "deploy", or "view". Each level implies the ones
-// below it (admin > deploy > view). Sites scopes which sites the cap applies
-// to; omitting it means all sites.
+// below it (admin > deploy > view). The "analytics" level only grants a
+// site's analytics, which deploy and admin include. Sites scopes which sites
+// the cap applies to; omitting it means all sites.
 type Cap struct {
 	Access string   `json:"access"`
 	Sites  []string `json:"sites,omitempty"`
@@ -56,6 +58,9 @@ type RequestInfo struct {
 	OSVersion     string
 	Device        string
 	Tags          []string
+	// Bot reports a request from a tagged node, such as a CI runner or a
+	// monitoring probe, rather than from a person's device.
+	Bot bool
 }
 
 type capsKey struct{}
@@ -126,10 +131,29 @@ func CanView(caps []Cap, site string) bool { return hasCap(caps, site, "admin",
 // CanDeploy reports whether caps grant deploy access to the named site.
 func CanDeploy(caps []Cap, site string) bool { return hasCap(caps, site, "admin", "deploy") }
 
+// CanViewAnalytics reports whether caps grant access to the analytics of
+// the named site. The "analytics" level grants it without access to the
+// site's content or deployments.
+func CanViewAnalytics(caps []Cap, site string) bool {
+	return hasCap(caps, site, "admin", "deploy", "analytics")
+}
+
 // CanDeleteSite reports whether caps grant permission to delete a site.
 // Requires an admin cap that covers the site.
 func CanDeleteSite(caps []Cap, site string) bool { return hasCap(caps, site, "admin") }
 
+// CanArchiveSite reports whether caps allow archiving or unarchiving a site.
+// It requires the same admin cap as deletion, which archiving blocks.
+func CanArchiveSite(caps []Cap, site string) bool { return hasCap(caps, site, "admin") }
+
+// CanPinDeployment reports whether caps allow pinning or unpinning a site's
+// deployments. Pins override deployers, so they require an admin cap.
+func CanPinDeployment(caps []Cap, site string) bool { return hasCap(caps, site, "admin") }
+
+// CanShare reports whether caps allow creating and revoking share links for
+// a site, which hand out read access to its files.
+func CanShare(caps []Cap, site string) bool { return hasCap(caps, site, "admin", "deploy") }
+
 // CanCreateSite reports whether caps grant permission to create a site
 // with the given name. Requires an admin cap covering that name.
 func CanCreateSite(caps []Cap, name string) bool { return hasCap(caps, name, "admin") }
@@ -141,6 +165,11 @@ func IsAdmin(caps []Cap, site string) bool { return hasCap(caps, site, "admin")
 // This is a global (non-site-scoped) capability; the Sites field is ignored.
 func CanScrapeMetrics(caps []Cap) bool { return hasCap(caps, "", "admin", "metrics") }
 
+// CanReplicate reports whether caps allow pulling all sites through the
+// replication API. This is a global capability: it requires the "replica"
+// access level, or an admin cap covering every site.
+func CanReplicate(caps []Cap) bool { return hasCap(caps, "", "replica") || hasUnscopedAdmin(caps) }
+
 // HasAdminCap reports whether any cap grants admin access to at least one site.
 // Use this for global pages (webhooks, analytics overview) and UI elements
 // that should appear when the user has any admin access at all.
@@ -150,6 +179,10 @@ func HasAdminCap(caps []Cap) bool { return hasCap(caps, "", "admin") }
 // Use this for pages that should be accessible to deployers, not just admins.
 func HasDeployCap(caps []Cap) bool { return hasCap(caps, "", "admin", "deploy") }
 
+// HasAnalyticsCap reports whether any cap grants access to the analytics of
+// at least one site. Use this for the analytics overview and its navigation.
+func HasAnalyticsCap(caps []Cap) bool { return hasCap(caps, "", "admin", "deploy", "analytics") }
+
 // CapsFromContext retrieves parsed caps from the request context.
 func CapsFromContext(ctx context.Context) []Cap {
 	caps, _ := ctx.Value(capsKey{}).([]Cap)
@@ -172,21 +205,44 @@ func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
 	return context.WithValue(ctx, identityKey{}, id)
 }
 
+// Authenticator identifies the caller of a request. Implementations return
+// the caller's profile and their capability grants in CapMap, keyed by the
+// capability name the middleware is configured with.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*WhoIsResult, error)
+}
+
+// Tailscale returns an Authenticator that identifies callers by their tailnet
+// address using WhoIs.
+func Tailscale(client WhoIsClient) Authenticator { return whoIsAuthenticator{client} }
+
+type whoIsAuthenticator struct{ client WhoIsClient }
+
+func (a whoIsAuthenticator) Authenticate(r *http.Request) (*WhoIsResult, error) {
+	return a.client.WhoIs(r.Context(), r.RemoteAddr)
+}
+
 // Middleware returns HTTP middleware that calls WhoIs, parses capabilities,
 // and attaches them to the request context. It does NOT enforce permissions --
 // individual handlers decide what access level is required.
 func Middleware(client WhoIsClient, capName string) func(http.Handler) http.Handler {
-	return middleware(client, capName, false)
+	return middleware(Tailscale(client), capName, false)
+}
+
+// MiddlewareFor is like Middleware but identifies callers with a, which need
+// not be backed by Tailscale.
+func MiddlewareFor(a Authenticator, capName string) func(http.Handler) http.Handler {
+	return middleware(a, capName, false)
 }
 
 // MiddlewareAllowAnonymous is like Middleware but allows anonymous requests
 // through when WhoIs fails (e.g. public Funnel traffic). Anonymous requests
 // get empty caps and no identity in context.
 func MiddlewareAllowAnonymous(client WhoIsClient, capName string) func(http.Handler) http.Handler {
-	return middleware(client, capName, true)
+	return middleware(Tailscale(client), capName, true)
 }
 
-func middleware(client WhoIsClient, capName string, allowAnonymous bool) func(http.Handler) http.Handler {
+func middleware(authn Authenticator, capName string, allowAnonymous bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// If caps are already in context (e.g. dev mode), skip WhoIs.
@@ -195,7 +251,7 @@ func middleware(client WhoIsClient, capName string, allowAnonymous bool) func(ht
 				return
 			}
 
-			result, err := client.WhoIs(r.Context(), r.RemoteAddr)
+			result, err := authn.Authenticate(r)
 			if err != nil {
 				if allowAnonymous {
 					ctx := context.WithValue(r.Context(), capsKey{}, []Cap{})
@@ -232,6 +288,117 @@ func middleware(client WhoIsClient, capName string, allowAnonymous bool) func(ht
 				OSVersion:     result.OSVersion,
 				Device:        result.Device,
 				Tags:          result.Tags,
+				Bot:           len(result.Tags) > 0,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserResolver looks up a tailnet user by login name. It backs the admin
+// "view as" preview, which needs another user's capabilities without a
+// request from them.
+type UserResolver interface {
+	WhoIsLogin(ctx context.Context, login string) (*WhoIsResult, error)
+}
+
+// ViewAsCookie names the cookie holding the login an admin is previewing.
+const ViewAsCookie = "tspages_view_as"
+
+type viewerKey struct{}
+
+// CanViewAs reports whether caps allow previewing other users' access.
+// Only admins of all sites qualify, since the preview reveals every site
+// the target user can see.
+func CanViewAs(caps []Cap) bool { return hasUnscopedAdmin(caps) }
+
+// CanCollectGarbage reports whether caps allow triggering storage garbage
+// collection. It spans every site, so only admins of all sites qualify.
+func CanCollectGarbage(caps []Cap) bool { return hasUnscopedAdmin(caps) }
+
+// CanViewIntegrity reports whether caps allow reading the storage integrity
+// report. It spans every site, so only admins of all sites qualify.
+func CanViewIntegrity(caps []Cap) bool { return hasUnscopedAdmin(caps) }
+
+// CanSetReadOnly reports whether caps allow switching the control plane's
+// read-only mode. It affects every site, so only admins of all sites qualify.
+func CanSetReadOnly(caps []Cap) bool { return hasUnscopedAdmin(caps) }
+
+// CanEraseUsers reports whether caps allow erasing a user's data. It spans
+// every site, so only admins of all sites qualify.
+func CanEraseUsers(caps []Cap) bool { return hasUnscopedAdmin(caps) }
+
+// hasUnscopedAdmin reports whether any admin cap covers every site, i.e. has
+// no sites list or includes "*".
+func hasUnscopedAdmin(caps []Cap) bool {
+	for _, c := range caps {
+		if c.Access != "admin" {
+			continue
+		}
+		if len(c.Sites) == 0 || slices.Contains(c.Sites, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// ViewerFromContext returns the real identity of an admin previewing
+// another user's access, and false for ordinary requests.
+func ViewerFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(viewerKey{}).(Identity)
+	return id, ok
+}
+
+// ContextWithViewer marks a context as a view-as preview by the given admin.
+// Used by tests.
+func ContextWithViewer(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, viewerKey{}, id)
+}
+
+// ViewAs returns HTTP middleware that replaces the caller's caps and identity
+// with those of the user named in the ViewAsCookie, for admins allowed to
+// preview (see CanViewAs). It must run after Middleware. Previews are
+// read-only: any method other than GET or HEAD is rejected. Cookies set by
+// non-admins are ignored.
+func ViewAs(resolver UserResolver, capName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(ViewAsCookie)
+			if err != nil || cookie.Value == "" || !CanViewAs(CapsFromContext(r.Context())) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "read-only preview: exit view-as mode to make changes", http.StatusForbidden)
+				return
+			}
+
+			result, err := resolver.WhoIsLogin(r.Context(), cookie.Value)
+			if err != nil {
+				http.SetCookie(w, &http.Cookie{Name: ViewAsCookie, Path: "/", MaxAge: -1})
+				http.Error(w, "view-as user not found; preview ended", http.StatusNotFound)
+				return
+			}
+			var caps []Cap
+			if raw, ok := result.CapMap[capName]; ok && len(raw) > 0 {
+				parsed, err := ParseCaps(raw)
+				if err != nil {
+					http.Error(w, "invalid capabilities", http.StatusInternalServerError)
+					return
+				}
+				caps = parsed
+			}
+			if caps == nil {
+				// A nil slice would make Middleware think no caps were set.
+				caps = []Cap{}
+			}
+
+			ctx := context.WithValue(r.Context(), viewerKey{}, IdentityFromContext(r.Context()))
+			ctx = context.WithValue(ctx, capsKey{}, caps)
+			ctx = context.WithValue(ctx, identityKey{}, Identity{
+				LoginName:     result.LoginName,
+				DisplayName:   result.DisplayName,
+				ProfilePicURL: result.ProfilePicURL,
 			})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -68,6 +68,57 @@ func TestCanDeploy(t *testing.T) {
 	}
 }
 
+func TestCanViewAnalytics(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		site string
+		want bool
+	}{
+		{"analytics grant", []Cap{{Access: "analytics", Sites: []string{"docs"}}}, "docs", true},
+		{"analytics wildcard", []Cap{{Access: "analytics", Sites: []string{"doc*"}}}, "docs", true},
+		{"analytics omitted sites", []Cap{{Access: "analytics"}}, "docs", true},
+		{"deploy implies analytics", []Cap{{Access: "deploy", Sites: []string{"docs"}}}, "docs", true},
+		{"admin implies analytics", []Cap{{Access: "admin"}}, "docs", true},
+		{"view does not imply analytics", []Cap{{Access: "view", Sites: []string{"docs"}}}, "docs", false},
+		{"metrics does not imply analytics", []Cap{{Access: "metrics"}}, "docs", false},
+		{"no grant", []Cap{{Access: "analytics", Sites: []string{"other"}}}, "docs", false},
+		{"empty caps", []Cap{}, "docs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanViewAnalytics(tt.caps, tt.site); got != tt.want {
+				t.Errorf("CanViewAnalytics() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAnalyticsCap_GrantsNothingElse checks that the analytics level grants
+// no access beyond a site's analytics.
+func TestAnalyticsCap_GrantsNothingElse(t *testing.T) {
+	caps := []Cap{{Access: "analytics"}}
+	checks := map[string]bool{
+		"CanView":          CanView(caps, "docs"),
+		"CanDeploy":        CanDeploy(caps, "docs"),
+		"CanDeleteSite":    CanDeleteSite(caps, "docs"),
+		"CanArchiveSite":   CanArchiveSite(caps, "docs"),
+		"CanPinDeployment": CanPinDeployment(caps, "docs"),
+		"CanShare":         CanShare(caps, "docs"),
+		"CanCreateSite":    CanCreateSite(caps, "docs"),
+		"IsAdmin":          IsAdmin(caps, "docs"),
+		"CanScrapeMetrics": CanScrapeMetrics(caps),
+		"CanReplicate":     CanReplicate(caps),
+		"HasAdminCap":      HasAdminCap(caps),
+		"HasDeployCap":     HasDeployCap(caps),
+	}
+	for name, got := range checks {
+		if got {
+			t.Errorf("%s() = true for an analytics cap", name)
+		}
+	}
+}
+
 func TestCanDeleteSite(t *testing.T) {
 	tests := []struct {
 		name string
@@ -90,6 +141,27 @@ func TestCanDeleteSite(t *testing.T) {
 	}
 }
 
+func TestCanShare(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		site string
+		want bool
+	}{
+		{"unscoped admin", []Cap{{Access: "admin"}}, "docs", true},
+		{"scoped deploy match", []Cap{{Access: "deploy", Sites: []string{"docs"}}}, "docs", true},
+		{"scoped deploy no match", []Cap{{Access: "deploy", Sites: []string{"other"}}}, "docs", false},
+		{"view cannot share", []Cap{{Access: "view"}}, "docs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanShare(tt.caps, tt.site); got != tt.want {
+				t.Errorf("CanShare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestCanCreateSite(t *testing.T) {
 	tests := []struct {
 		name string
@@ -136,6 +208,28 @@ func TestCanScrapeMetrics(t *testing.T) {
 	}
 }
 
+func TestCanReplicate(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		want bool
+	}{
+		{"replica", []Cap{{Access: "replica"}}, true},
+		{"unscoped admin", []Cap{{Access: "admin"}}, true},
+		{"scoped admin", []Cap{{Access: "admin", Sites: []string{"docs"}}}, false},
+		{"deploy", []Cap{{Access: "deploy"}}, false},
+		{"metrics", []Cap{{Access: "metrics"}}, false},
+		{"nil caps", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanReplicate(tt.caps); got != tt.want {
+				t.Errorf("CanReplicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsAdmin(t *testing.T) {
 	tests := []struct {
 		name string
@@ -207,6 +301,28 @@ func TestHasDeployCap(t *testing.T) {
 	}
 }
 
+func TestHasAnalyticsCap(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		want bool
+	}{
+		{"analytics", []Cap{{Access: "analytics", Sites: []string{"docs"}}}, true},
+		{"deploy", []Cap{{Access: "deploy", Sites: []string{"docs"}}}, true},
+		{"admin", []Cap{{Access: "admin"}}, true},
+		{"view", []Cap{{Access: "view"}}, false},
+		{"metrics", []Cap{{Access: "metrics"}}, false},
+		{"nil caps", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasAnalyticsCap(tt.caps); got != tt.want {
+				t.Errorf("HasAnalyticsCap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestParseCaps_InvalidJSON(t *testing.T) {
 	raw := []json.RawMessage{json.RawMessage(`{invalid json}`)}
 	_, err := ParseCaps(raw)
@@ -453,3 +569,183 @@ func (m *mockWhoIs) WhoIs(ctx context.Context, remoteAddr string) (*WhoIsResult,
 		DisplayName: m.displayName,
 	}, nil
 }
+
+func (m *mockWhoIs) WhoIsLogin(ctx context.Context, login string) (*WhoIsResult, error) {
+	return m.WhoIs(ctx, "")
+}
+
+func TestCanViewAs(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		want bool
+	}{
+		{"unscoped admin", []Cap{{Access: "admin"}}, true},
+		{"wildcard admin", []Cap{{Access: "admin", Sites: []string{"*"}}}, true},
+		{"scoped admin", []Cap{{Access: "admin", Sites: []string{"docs"}}}, false},
+		{"pattern admin", []Cap{{Access: "admin", Sites: []string{"docs-*"}}}, false},
+		{"deploy", []Cap{{Access: "deploy"}}, false},
+		{"nil caps", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanViewAs(tt.caps); got != tt.want {
+				t.Errorf("CanViewAs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanCollectGarbage(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		want bool
+	}{
+		{"unscoped admin", []Cap{{Access: "admin"}}, true},
+		{"wildcard admin", []Cap{{Access: "admin", Sites: []string{"*"}}}, true},
+		{"scoped admin", []Cap{{Access: "admin", Sites: []string{"docs"}}}, false},
+		{"deploy", []Cap{{Access: "deploy"}}, false},
+		{"nil caps", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanCollectGarbage(tt.caps); got != tt.want {
+				t.Errorf("CanCollectGarbage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanEraseUsers(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []Cap
+		want bool
+	}{
+		{"unscoped admin", []Cap{{Access: "admin"}}, true},
+		{"scoped admin", []Cap{{Access: "admin", Sites: []string{"docs"}}}, false},
+		{"analytics", []Cap{{Access: "analytics"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanEraseUsers(tt.caps); got != tt.want {
+				t.Errorf("CanEraseUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func viewAsRequest(method string, caps []Cap) *http.Request {
+	req := httptest.NewRequest(method, "/sites", nil)
+	ctx := ContextWithCaps(req.Context(), caps)
+	ctx = ContextWithIdentity(ctx, Identity{LoginName: "admin@example.com"})
+	req = req.WithContext(ctx)
+	req.AddCookie(&http.Cookie{Name: ViewAsCookie, Value: "bob@example.com"})
+	return req
+}
+
+func TestViewAs_ReplacesCapsAndIdentity(t *testing.T) {
+	resolver := &mockWhoIs{
+		caps:      []json.RawMessage{json.RawMessage(`{"access":"view","sites":["docs"]}`)},
+		loginName: "bob@example.com",
+	}
+
+	var gotCaps []Cap
+	var gotIdentity, gotViewer Identity
+	var viewing bool
+	handler := ViewAs(resolver, "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotCaps = CapsFromContext(r.Context())
+			gotIdentity = IdentityFromContext(r.Context())
+			gotViewer, viewing = ViewerFromContext(r.Context())
+		}),
+	)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, viewAsRequest("GET", []Cap{{Access: "admin"}}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !CanView(gotCaps, "docs") || CanView(gotCaps, "other") || HasAdminCap(gotCaps) {
+		t.Errorf("caps = %v, want bob's view cap on docs", gotCaps)
+	}
+	if gotIdentity.LoginName != "bob@example.com" {
+		t.Errorf("identity = %q, want bob@example.com", gotIdentity.LoginName)
+	}
+	if !viewing || gotViewer.LoginName != "admin@example.com" {
+		t.Errorf("viewer = %q (%v), want admin@example.com", gotViewer.LoginName, viewing)
+	}
+}
+
+func TestViewAs_NoCapsStillNonNil(t *testing.T) {
+	resolver := &mockWhoIs{loginName: "bob@example.com"}
+	var gotCaps []Cap
+	handler := ViewAs(resolver, "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotCaps = CapsFromContext(r.Context())
+		}),
+	)
+	handler.ServeHTTP(httptest.NewRecorder(), viewAsRequest("GET", []Cap{{Access: "admin"}}))
+
+	if gotCaps == nil || len(gotCaps) != 0 {
+		t.Errorf("caps = %v, want non-nil empty", gotCaps)
+	}
+}
+
+func TestViewAs_RejectsMutations(t *testing.T) {
+	resolver := &mockWhoIs{loginName: "bob@example.com"}
+	handler := ViewAs(resolver, "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called for mutations")
+		}),
+	)
+	for _, method := range []string{"POST", "PUT", "DELETE"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, viewAsRequest(method, []Cap{{Access: "admin"}}))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s status = %d, want 403", method, rec.Code)
+		}
+	}
+}
+
+func TestViewAs_IgnoredForNonAdmins(t *testing.T) {
+	resolver := &mockWhoIs{
+		caps:      []json.RawMessage{json.RawMessage(`{"access":"admin"}`)},
+		loginName: "bob@example.com",
+	}
+	var gotIdentity Identity
+	handler := ViewAs(resolver, "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotIdentity = IdentityFromContext(r.Context())
+		}),
+	)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, viewAsRequest("POST", []Cap{{Access: "admin", Sites: []string{"docs"}}}))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if gotIdentity.LoginName != "admin@example.com" {
+		t.Errorf("identity = %q, want the real caller", gotIdentity.LoginName)
+	}
+}
+
+func TestViewAs_UnknownUserClearsCookie(t *testing.T) {
+	resolver := &mockWhoIs{err: fmt.Errorf("no device found")}
+	handler := ViewAs(resolver, "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called")
+		}),
+	)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, viewAsRequest("GET", []Cap{{Access: "admin"}}))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != ViewAsCookie || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want %s cleared", cookies, ViewAsCookie)
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var (
+	// ErrUntrustedProxy is returned for requests that do not come from one
+	// of the configured trusted proxies.
+	ErrUntrustedProxy = errors.New("request not from a trusted proxy")
+	// ErrNoUser is returned when a trusted proxy did not set the user header.
+	ErrNoUser = errors.New("no authenticated user in request")
+)
+
+// EveryoneGroup is the group name whose caps apply to every authenticated
+// user, regardless of the groups the proxy reports.
+const EveryoneGroup = "*"
+
+// HeaderConfig configures identification by headers that an authenticating
+// reverse proxy, such as oauth2-proxy, sets on forwarded requests.
+type HeaderConfig struct {
+	// UserHeader carries the login name. Requests without it are rejected.
+	UserHeader string
+	// NameHeader optionally carries a display name.
+	NameHeader string
+	// GroupsHeader optionally carries a comma-separated list of groups.
+	GroupsHeader string
+	// TrustedProxies lists the networks the headers are accepted from.
+	// Requests from anywhere else are rejected, so clients cannot spoof an
+	// identity by setting the headers themselves.
+	TrustedProxies []netip.Prefix
+	// Groups maps group names to the caps their members receive, taking the
+	// place of grants in the tailnet policy.
+	Groups map[string][]Cap
+}
+
+// HeaderAuthenticator identifies callers from headers set by a trusted
+// reverse proxy, for running the control plane without Tailscale identity.
+type HeaderAuthenticator struct {
+	cfg     HeaderConfig
+	capName string
+}
+
+// NewHeaderAuthenticator returns an Authenticator for cfg that reports caps
+// under capName, the name the middleware is configured with.
+func NewHeaderAuthenticator(cfg HeaderConfig, capName string) *HeaderAuthenticator {
+	return &HeaderAuthenticator{cfg: cfg, capName: capName}
+}
+
+func (a *HeaderAuthenticator) Authenticate(r *http.Request) (*WhoIsResult, error) {
+	if !a.trusted(r.RemoteAddr) {
+		return nil, ErrUntrustedProxy
+	}
+	login := strings.TrimSpace(r.Header.Get(a.cfg.UserHeader))
+	if login == "" {
+		return nil, ErrNoUser
+	}
+
+	caps := a.cfg.Groups[EveryoneGroup]
+	if a.cfg.GroupsHeader != "" {
+		for _, g := range strings.Split(r.Header.Get(a.cfg.GroupsHeader), ",") {
+			if g = strings.TrimSpace(g); g != "" && g != EveryoneGroup {
+				caps = append(caps[:len(caps):len(caps)], a.cfg.Groups[g]...)
+			}
+		}
+	}
+	raw := make([]json.RawMessage, 0, len(caps))
+	for _, c := range caps {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, data)
+	}
+
+	result := &WhoIsResult{
+		CapMap:    map[string][]json.RawMessage{a.capName: raw},
+		LoginName: login,
+	}
+	if a.cfg.NameHeader != "" {
+		result.DisplayName = strings.TrimSpace(r.Header.Get(a.cfg.NameHeader))
+	}
+	return result, nil
+}
+
+// trusted reports whether remoteAddr belongs to a trusted proxy.
+func (a *HeaderAuthenticator) trusted(remoteAddr string) bool {
+	ap, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := ap.Addr().Unmap()
+	for _, p := range a.cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
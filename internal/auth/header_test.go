@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func testHeaderAuthenticator() *HeaderAuthenticator {
+	return NewHeaderAuthenticator(HeaderConfig{
+		UserHeader:     "X-Forwarded-User",
+		NameHeader:     "X-Forwarded-Preferred-Username",
+		GroupsHeader:   "X-Forwarded-Groups",
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")},
+		Groups: map[string][]Cap{
+			"*":       {{Access: "view", Sites: []string{"handbook"}}},
+			"admins":  {{Access: "admin"}},
+			"docs-rw": {{Access: "deploy", Sites: []string{"docs"}}},
+		},
+	}, "example.com/cap/pages")
+}
+
+func TestHeaderAuthenticator_GroupCaps(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-User", "alice@example.com")
+	req.Header.Set("X-Forwarded-Preferred-Username", "Alice")
+	req.Header.Set("X-Forwarded-Groups", "docs-rw, unknown")
+
+	result, err := testHeaderAuthenticator().Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LoginName != "alice@example.com" || result.DisplayName != "Alice" {
+		t.Errorf("identity = %q / %q", result.LoginName, result.DisplayName)
+	}
+	caps, err := ParseCaps(result.CapMap["example.com/cap/pages"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CanView(caps, "handbook") || !CanDeploy(caps, "docs") {
+		t.Errorf("caps = %+v, want view on handbook and deploy on docs", caps)
+	}
+	if IsAdmin(caps, "docs") {
+		t.Error("user outside admins group should not be admin")
+	}
+}
+
+func TestHeaderAuthenticator_DoesNotMutateGroups(t *testing.T) {
+	a := testHeaderAuthenticator()
+	for _, groups := range []string{"admins", "docs-rw"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("X-Forwarded-User", "bob@example.com")
+		req.Header.Set("X-Forwarded-Groups", groups)
+		if _, err := a.Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := a.cfg.Groups["*"]; len(got) != 1 {
+		t.Errorf("everyone caps = %+v, want unchanged", got)
+	}
+}
+
+func TestHeaderAuthenticator_UntrustedProxy(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.5:4567"
+	req.Header.Set("X-Forwarded-User", "mallory@example.com")
+	req.Header.Set("X-Forwarded-Groups", "admins")
+
+	if _, err := testHeaderAuthenticator().Authenticate(req); !errors.Is(err, ErrUntrustedProxy) {
+		t.Errorf("err = %v, want ErrUntrustedProxy", err)
+	}
+}
+
+func TestHeaderAuthenticator_NoUser(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4567"
+
+	if _, err := testHeaderAuthenticator().Authenticate(req); !errors.Is(err, ErrNoUser) {
+		t.Errorf("err = %v, want ErrNoUser", err)
+	}
+}
+
+func TestMiddlewareFor_HeaderAuthenticator(t *testing.T) {
+	var gotCaps []Cap
+	var gotID Identity
+	handler := MiddlewareFor(testHeaderAuthenticator(), "example.com/cap/pages")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotCaps = CapsFromContext(r.Context())
+			gotID = IdentityFromContext(r.Context())
+		}),
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[::ffff:127.0.0.1]:4567"
+	req.Header.Set("X-Forwarded-User", "carol@example.com")
+	req.Header.Set("X-Forwarded-Groups", "admins")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if gotID.LoginName != "carol@example.com" || !IsAdmin(gotCaps, "anything") {
+		t.Errorf("identity = %+v, caps = %+v", gotID, gotCaps)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:4567"
+	req.Header.Set("X-Forwarded-User", "carol@example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("untrusted status = %d, want 403", rec.Code)
+	}
+}
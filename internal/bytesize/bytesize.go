@@ -0,0 +1,26 @@
+// Package bytesize formats byte counts for people to read, the same way in
+// the admin UI, directory listings, and the CLI.
+package bytesize
+
+import "fmt"
+
+const (
+	kB = 1024
+	mB = 1024 * kB
+	gB = 1024 * mB
+)
+
+// Format returns n in binary units with one decimal, such as "1.5 MB".
+// Counts below a kilobyte are given in whole bytes.
+func Format(n int64) string {
+	switch {
+	case n >= gB:
+		return fmt.Sprintf("%.1f GB", float64(n)/float64(gB))
+	case n >= mB:
+		return fmt.Sprintf("%.1f MB", float64(n)/float64(mB))
+	case n >= kB:
+		return fmt.Sprintf("%.1f KB", float64(n)/float64(kB))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,24 @@
+package bytesize
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{1024 * 1024, "1.0 MB"},
+		{1024 * 1024 * 1024, "1.0 GB"},
+		{1024*1024*1024 + 512*1024*1024, "1.5 GB"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.input); got != tt.want {
+			t.Errorf("Format(%d) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
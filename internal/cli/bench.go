@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/serve"
+	"tspages/internal/storage"
+)
+
+// benchScenario is one request pattern generated by `tspages bench`.
+type benchScenario struct {
+	name           string
+	path           string
+	acceptEncoding string
+	status         int
+}
+
+var benchScenarios = []benchScenario{
+	{name: "file", path: "/assets/app.3f9a1c2b.js", status: http.StatusOK},
+	{name: "clean-url", path: "/about", status: http.StatusOK},
+	{name: "spa", path: "/app/settings/profile", status: http.StatusOK},
+	{name: "redirect", path: "/old/intro", status: http.StatusMovedPermanently},
+	{name: "gzip", path: "/style.css", acceptEncoding: "gzip", status: http.StatusOK},
+	{name: "brotli", path: "/style.css", acceptEncoding: "br", status: http.StatusOK},
+}
+
+// benchResult summarizes one scenario run.
+type benchResult struct {
+	requests  int
+	errors    int
+	elapsed   time.Duration
+	latencies []time.Duration // sorted
+	mallocs   uint64
+}
+
+func (r benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(p*float64(len(r.latencies)-1))]
+}
+
+// Bench is the entrypoint for `tspages bench`.
+func Bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	duration := fs.Duration("duration", 5*time.Second, "how long to run each scenario")
+	rate := fs.Int("rate", 0, "requests per second per scenario (0: as fast as possible)")
+	concurrency := fs.Int("concurrency", 8, "concurrent connections")
+	only := fs.String("scenario", "", "comma-separated scenarios to run (default: all)")
+	withAnalytics := fs.Bool("analytics", true, "record analytics events like a live site")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tspages bench [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Load-test the site serving path against a generated local site.\n")
+		fmt.Fprintf(os.Stderr, "No tailnet is needed; requests go over loopback to an in-process server.\n\n")
+		fmt.Fprintf(os.Stderr, "Scenarios: %s\n\n", strings.Join(benchScenarioNames(), ", "))
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if *rate < 0 {
+		return fmt.Errorf("rate must be non-negative")
+	}
+	scenarios, err := selectBenchScenarios(*only)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tspages-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var recorder *analytics.Recorder
+	if *withAnalytics {
+		recorder, err = analytics.NewRecorder(filepath.Join(dir, "analytics.db"))
+		if err != nil {
+			return fmt.Errorf("opening analytics db: %w", err)
+		}
+		defer recorder.Close() //nolint:errcheck // temporary database
+	}
+	handler, err := benchHandler(storage.New(filepath.Join(dir, "data")), recorder)
+	if err != nil {
+		return fmt.Errorf("creating bench site: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln) //nolint:errcheck // closed below
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: *concurrency,
+			DisableCompression:  true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	base := "http://" + ln.Addr().String()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "scenario\trequests\treq/s\tp50\tp90\tp99\tmax\terrors\tallocs/req\t")
+	for _, sc := range scenarios {
+		fmt.Fprintf(os.Stderr, "Running %s for %s...\n", sc.name, *duration)
+		r := runBenchScenario(client, base, sc, *duration, *rate, *concurrency)
+		var rps float64
+		if r.elapsed > 0 {
+			rps = float64(r.requests) / r.elapsed.Seconds()
+		}
+		var allocs uint64
+		if r.requests > 0 {
+			allocs = r.mallocs / uint64(r.requests)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%s\t%s\t%s\t%s\t%d\t%d\t\n",
+			sc.name, r.requests, rps,
+			r.percentile(0.5).Round(time.Microsecond), r.percentile(0.9).Round(time.Microsecond),
+			r.percentile(0.99).Round(time.Microsecond), r.percentile(1).Round(time.Microsecond),
+			r.errors, allocs)
+	}
+	fmt.Fprintf(os.Stderr, "\nallocs/req counts client and server allocations in this process.\n")
+	return tw.Flush()
+}
+
+func benchScenarioNames() []string {
+	names := make([]string, len(benchScenarios))
+	for i, sc := range benchScenarios {
+		names[i] = sc.name
+	}
+	return names
+}
+
+func selectBenchScenarios(only string) ([]benchScenario, error) {
+	if only == "" {
+		return benchScenarios, nil
+	}
+	var selected []benchScenario
+	for _, name := range strings.Split(only, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(benchScenarios, func(sc benchScenario) bool { return sc.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown scenario %q (available: %s)", name, strings.Join(benchScenarioNames(), ", "))
+		}
+		selected = append(selected, benchScenarios[i])
+	}
+	return selected, nil
+}
+
+// benchHandler deploys a generated site covering every scenario to store and
+// returns the serving handler, wrapped the way the multihost manager wraps
+// live sites, minus tsnet identity.
+func benchHandler(store *storage.Store, recorder *analytics.Recorder) (http.Handler, error) {
+	const site, id = "bench", "bench001"
+	dir, err := store.CreateDeployment(site, id)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{
+		"index.html":             "<!doctype html><title>Bench</title><h1>Bench</h1>",
+		"about.html":             "<!doctype html><title>About</title><h1>About</h1>",
+		"style.css":              strings.Repeat("body { margin: 0; color: #222; }\n", 300),
+		"assets/app.3f9a1c2b.js": strings.Repeat("console.log('tspages bench');\n", 1000),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, "content", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	spa := true
+	if err := store.WriteSiteConfig(site, id, storage.SiteConfig{
+		SPARouting: &spa,
+		Redirects:  []storage.RedirectRule{{From: "/old/:slug", To: "/new/:slug", Status: http.StatusMovedPermanently}},
+	}); err != nil {
+		return nil, err
+	}
+	if err := store.MarkComplete(site, id); err != nil {
+		return nil, err
+	}
+	if err := store.ActivateDeployment(site, id); err != nil {
+		return nil, err
+	}
+
+	h := serve.NewHandler(store, site, "bench.invalid", storage.SiteConfig{})
+	caps := []auth.Cap{{Access: "view", Sites: []string{site}}}
+	mux := http.NewServeMux()
+	mux.Handle("GET /{path...}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &benchStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(auth.ContextWithCaps(r.Context(), caps)))
+		if recorder != nil && h.AnalyticsEnabled() {
+			recorder.Record(analytics.Event{Timestamp: start, Site: site, Path: r.URL.Path, Status: sw.status})
+		}
+	}))
+	return mux, nil
+}
+
+// benchStatusWriter captures the response status for analytics events.
+type benchStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *benchStatusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *benchStatusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// runBenchScenario sends requests for sc from concurrency workers for the
+// given duration. With a positive rate, requests are paced at that many per
+// second regardless of latency, like an open-loop load generator; otherwise
+// each worker sends its next request as soon as the previous one finishes.
+func runBenchScenario(client *http.Client, base string, sc benchScenario, duration time.Duration, rate, concurrency int) benchResult {
+	var pace <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	var (
+		mu     sync.Mutex
+		result benchResult
+		wg     sync.WaitGroup
+	)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			var errs int
+			for time.Now().Before(deadline) {
+				if pace != nil {
+					select {
+					case <-pace:
+					case <-time.After(time.Until(deadline)):
+						continue
+					}
+				}
+				t := time.Now()
+				err := benchRequest(client, base, sc)
+				latencies = append(latencies, time.Since(t))
+				if err != nil {
+					errs++
+				}
+			}
+			mu.Lock()
+			result.latencies = append(result.latencies, latencies...)
+			result.errors += errs
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	result.elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	result.mallocs = after.Mallocs - before.Mallocs
+	result.requests = len(result.latencies)
+	slices.Sort(result.latencies)
+	return result
+}
+
+func benchRequest(client *http.Client, base string, sc benchScenario) error {
+	req, err := http.NewRequest("GET", base+sc.path, nil)
+	if err != nil {
+		return err
+	}
+	if sc.acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", sc.acceptEncoding)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != sc.status {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if sc.acceptEncoding != "" && resp.Header.Get("Content-Encoding") != sc.acceptEncoding {
+		return fmt.Errorf("unexpected content encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+	return nil
+}
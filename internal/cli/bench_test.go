@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/storage"
+)
+
+func TestBenchScenarios(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := analytics.NewRecorder(filepath.Join(dir, "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+	handler, err := benchHandler(storage.New(filepath.Join(dir, "data")), recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	client := &http.Client{
+		Transport:     &http.Transport{DisableCompression: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	for _, sc := range benchScenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			if err := benchRequest(client, srv.URL, sc); err != nil {
+				t.Fatal(err)
+			}
+			r := runBenchScenario(client, srv.URL, sc, 50*time.Millisecond, 0, 2)
+			if r.requests == 0 || r.errors != 0 {
+				t.Errorf("requests = %d, errors = %d", r.requests, r.errors)
+			}
+			if r.percentile(0.5) > r.percentile(1) {
+				t.Error("latencies should be sorted")
+			}
+		})
+	}
+}
+
+func TestSelectBenchScenarios(t *testing.T) {
+	got, err := selectBenchScenarios("spa, gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].name != "spa" || got[1].name != "gzip" {
+		t.Errorf("got %+v", got)
+	}
+	if _, err := selectBenchScenarios("nope"); err == nil {
+		t.Error("expected error for unknown scenario")
+	}
+}
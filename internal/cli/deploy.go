@@ -14,8 +14,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"tspages/internal/bytesize"
+	"tspages/internal/deploy"
+
 	"tailscale.com/client/local"
 )
 
@@ -55,22 +59,50 @@ func Deploy(args []string) error {
 	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
 	serverFlag := fs.String("server", "", "control plane URL (default: auto-discover)")
 	noActivate := fs.Bool("no-activate", false, "upload without activating")
+	jsonOutput := fs.Bool("json", false, "print the deployment report as JSON")
+	commit := fs.String("commit", "", "commit the site was built from")
+	branch := fs.String("branch", "", "branch the site was built from")
+	buildURL := fs.String("build-url", "", "URL of the CI build that produced the site")
+	envName := fs.String("env", "", "deploy the environment of this name in "+projectFile)
+	retries := fs.Int("retries", 3, "how often to retry an upload after a transient failure")
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: tspages deploy <path> <site> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: tspages deploy <path> <site> [flags]\n")
+		fmt.Fprintf(os.Stderr, "       tspages deploy --env <name> [path] [flags]\n\n")
 		fmt.Fprintf(os.Stderr, "Upload a directory or file to a tspages site.\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		fs.PrintDefaults()
 	}
 	fs.Parse(args)
 
-	if fs.NArg() < 2 {
-		fs.Usage()
-		return fmt.Errorf("requires <path> and <site> arguments")
+	var path, site string
+	if *envName != "" {
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return fmt.Errorf("--env takes at most a <path> argument; the site comes from %s", projectFile)
+		}
+		env, err := resolveProjectEnv(*envName)
+		if err != nil {
+			return err
+		}
+		path, site = env.Path, env.Site
+		if fs.NArg() == 1 {
+			path = fs.Arg(0)
+		}
+		if *serverFlag == "" {
+			*serverFlag = env.Server
+		}
+		if env.NoActivate != nil && *env.NoActivate {
+			*noActivate = true
+		}
+	} else {
+		if fs.NArg() < 2 {
+			fs.Usage()
+			return fmt.Errorf("requires <path> and <site> arguments")
+		}
+		path = fs.Arg(0)
+		site = fs.Arg(1)
 	}
 
-	path := fs.Arg(0)
-	site := fs.Arg(1)
-
 	server := resolveServer(*serverFlag, os.Getenv("TSPAGES_SERVER"), discoverServer)
 	if server == "" {
 		return fmt.Errorf("cannot determine server URL; use --server or set TSPAGES_SERVER")
@@ -81,7 +113,7 @@ func Deploy(args []string) error {
 		return err
 	}
 
-	deployURL := server + "/deploy/" + url.PathEscape(site)
+	deployURL := server + "/api/v1/deploy/" + url.PathEscape(site)
 	if filename != "" {
 		deployURL += "/" + url.PathEscape(filename)
 	}
@@ -89,41 +121,95 @@ func Deploy(args []string) error {
 		deployURL += "?activate=false"
 	}
 
-	req, err := http.NewRequest("PUT", deployURL, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+	header := http.Header{}
+	for name, value := range map[string]string{
+		deploy.HeaderCommit:   *commit,
+		deploy.HeaderBranch:   *branch,
+		deploy.HeaderBuildURL: *buildURL,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+
+	// The progress bar is redrawn in place, which only works on a terminal.
+	var progress io.Writer
+	if !*jsonOutput && isTerminal(os.Stderr) {
+		progress = os.Stderr
 	}
-	req.ContentLength = int64(len(body))
 
 	fmt.Fprintf(os.Stderr, "Deploying to %s...\n", site)
 	client := &http.Client{Timeout: 10 * time.Minute}
-	resp, err := client.Do(req)
+	resp, respBody, stats, err := upload(client, "PUT", deployURL, header, body, *retries, progress)
 	if err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("deploy failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		return fmt.Errorf("deploy failed (%d): %s", resp.StatusCode, errorMessage(bytes.NewReader(respBody)))
 	}
 
-	var result struct {
-		DeploymentID string `json:"deployment_id"`
-		Site         string `json:"site"`
-		URL          string `json:"url"`
-	}
+	var result deploy.DeployResponse
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		return fmt.Errorf("parsing response: %w", err)
 	}
+	if *jsonOutput {
+		_, err := os.Stdout.Write(respBody)
+		return err
+	}
 
-	fmt.Fprintf(os.Stderr, "Deployed %s (%s)\n", result.Site, result.DeploymentID)
+	printReport(os.Stderr, result, stats)
 	if result.URL != "" {
 		fmt.Println(result.URL)
 	}
 	return nil
 }
 
+// printReport writes a deployment report for people to read, including how
+// the upload went.
+func printReport(w io.Writer, r deploy.DeployResponse, up uploadStats) {
+	if r.Activated {
+		fmt.Fprintf(w, "Deployed %s (%s)\n", r.Site, r.DeploymentID)
+	} else {
+		fmt.Fprintf(w, "Uploaded %s (%s), not activated\n", r.Site, r.DeploymentID)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  Files\t%d, %s\n", r.Files, bytesize.Format(r.SizeBytes))
+	if up.Bytes > 0 {
+		line := fmt.Sprintf("%s in %s", bytesize.Format(up.Bytes), up.Duration.Round(time.Millisecond))
+		if s := up.Duration.Seconds(); s > 0 {
+			line += fmt.Sprintf(" (%s/s)", bytesize.Format(int64(float64(up.Bytes)/s)))
+		}
+		switch up.Retries {
+		case 0:
+		case 1:
+			line += ", 1 retry"
+		default:
+			line += fmt.Sprintf(", %d retries", up.Retries)
+		}
+		fmt.Fprintf(tw, "  Upload\t%s\n", line)
+	}
+	if d := r.Diff; d != nil {
+		fmt.Fprintf(tw, "  Changes\t%d added, %d changed, %d removed since %s\n", d.Added, d.Changed, d.Removed, d.Previous)
+	}
+	t := r.Timing
+	steps := []string{fmt.Sprintf("extract %dms", t.ExtractMS), fmt.Sprintf("validate %dms", t.ValidateMS)}
+	if t.MinifyMS > 0 {
+		steps = append(steps, fmt.Sprintf("minify %dms", t.MinifyMS))
+	}
+	steps = append(steps, fmt.Sprintf("index %dms", t.IndexMS))
+	if t.PrecompressMS > 0 {
+		steps = append(steps, fmt.Sprintf("precompress %dms", t.PrecompressMS))
+	}
+	if t.ActivateMS > 0 {
+		steps = append(steps, fmt.Sprintf("activate %dms", t.ActivateMS))
+	}
+	fmt.Fprintf(tw, "  Time\t%dms (%s)\n", t.TotalMS, strings.Join(steps, ", "))
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(tw, "  Warning\t%s\n", warning)
+	}
+	tw.Flush()
+}
+
 // prepareBody reads the path and returns the upload body and an optional
 // filename hint (for single-file format detection). If path is a directory,
 // it zips it and returns no filename.
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -11,6 +12,9 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"tspages/internal/deploy"
 )
 
 func TestResolveServer_FlagWins(t *testing.T) {
@@ -192,8 +196,89 @@ func TestDeploy_EscapesSpecialCharsInFilename(t *testing.T) {
 
 	mu.Lock()
 	defer mu.Unlock()
-	want := "/deploy/mysite/data%231.md"
+	want := "/api/v1/deploy/mysite/data%231.md"
 	if gotPath != want {
 		t.Errorf("request URI = %q, want %q", gotPath, want)
 	}
 }
+
+func TestDeploy_ProblemDetails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{
+			"type":   "about:blank",
+			"title":  "Conflict",
+			"status": http.StatusConflict,
+			"detail": "site is archived",
+			"code":   "site_archived",
+		})
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(t.TempDir(), "index.html")
+	os.WriteFile(p, []byte("<h1>hi</h1>"), 0644)
+
+	err := Deploy([]string{"--server", srv.URL, p, "mysite"})
+	if err == nil || err.Error() != "deploy failed (409): site is archived" {
+		t.Errorf("err = %v, want detail from server", err)
+	}
+}
+
+func TestDeploy_JSONFlag(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"deployment_id":"test-123","site":"mysite","files":2}`))
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(t.TempDir(), "index.html")
+	os.WriteFile(p, []byte("<h1>hi</h1>"), 0644)
+
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	err := Deploy([]string{"--server", srv.URL, "--json", p, "mysite"})
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(r)
+	if string(out) != `{"deployment_id":"test-123","site":"mysite","files":2}` {
+		t.Errorf("stdout = %q, want the response", out)
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	var buf bytes.Buffer
+	printReport(&buf, deploy.DeployResponse{
+		DeploymentID: "bbb22222",
+		Site:         "docs",
+		Activated:    true,
+		Files:        12,
+		SizeBytes:    2048,
+		Diff:         &deploy.DeployDiff{Previous: "aaa11111", Added: 2, Changed: 3, Removed: 1, Unchanged: 7},
+		Warnings:     []string{"there is no index.html at the root, so the site's root responds with 404"},
+		Timing:       deploy.DeployTiming{ExtractMS: 40, ValidateMS: 2, IndexMS: 8, ActivateMS: 5, TotalMS: 60},
+	}, uploadStats{Bytes: 4096, Duration: 2 * time.Second, Retries: 1})
+	out := buf.String()
+	for _, want := range []string{
+		"Deployed docs (bbb22222)",
+		"12, 2.0 KB",
+		"Upload   4.0 KB in 2s (2.0 KB/s), 1 retry",
+		"2 added, 3 changed, 1 removed since aaa11111",
+		"60ms (extract 40ms, validate 2ms, index 8ms, activate 5ms)",
+		"Warning  there is no index.html",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	printReport(&buf, deploy.DeployResponse{DeploymentID: "ccc33333", Site: "docs"}, uploadStats{})
+	if !strings.Contains(buf.String(), "Uploaded docs (ccc33333), not activated") || strings.Contains(buf.String(), "Changes") || strings.Contains(buf.String(), "Upload ") {
+		t.Errorf("report of an inactive first deployment:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Export is the entrypoint for `tspages export`.
+func Export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	serverFlag := fs.String("server", "", "control plane URL (default: auto-discover)")
+	output := fs.String("o", "", "output file (default: <site>.tar.gz)")
+	withAnalytics := fs.Bool("analytics", false, "include analytics events")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tspages export <site> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Download a site with all its deployments as a portable archive.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("requires <site> argument")
+	}
+	site := fs.Arg(0)
+
+	server := resolveServer(*serverFlag, os.Getenv("TSPAGES_SERVER"), discoverServer)
+	if server == "" {
+		return fmt.Errorf("cannot determine server URL; use --server or set TSPAGES_SERVER")
+	}
+
+	path := *output
+	if path == "" {
+		path = site + ".tar.gz"
+	}
+
+	exportURL := server + "/api/v1/sites/" + url.PathEscape(site) + "/export"
+	if *withAnalytics {
+		exportURL += "?analytics=true"
+	}
+	req, err := http.NewRequest("GET", exportURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	fmt.Fprintf(os.Stderr, "Exporting %s...\n", site)
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("export failed (%d): %s", resp.StatusCode, errorMessage(resp.Body))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("downloading archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %s\n", site)
+	fmt.Println(path)
+	return nil
+}
+
+// Import is the entrypoint for `tspages import`.
+func Import(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	serverFlag := fs.String("server", "", "control plane URL (default: auto-discover)")
+	siteFlag := fs.String("site", "", "site name to import as (default: the exported site's name)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tspages import <archive> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Create a site from an archive written by `tspages export`.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("requires <archive> argument")
+	}
+	path := fs.Arg(0)
+
+	site := *siteFlag
+	if site == "" {
+		name, err := archiveSiteName(path)
+		if err != nil {
+			return err
+		}
+		site = name
+	}
+
+	server := resolveServer(*serverFlag, os.Getenv("TSPAGES_SERVER"), discoverServer)
+	if server == "" {
+		return fmt.Errorf("cannot determine server URL; use --server or set TSPAGES_SERVER")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", server+"/api/v1/sites/"+url.PathEscape(site)+"/import", f)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Accept", "application/json")
+
+	fmt.Fprintf(os.Stderr, "Importing %s...\n", site)
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("import failed (%d): %s", resp.StatusCode, errorMessage(resp.Body))
+	}
+
+	var result struct {
+		Name               string `json:"name"`
+		ActiveDeploymentID string `json:"active_deployment_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	if result.ActiveDeploymentID != "" {
+		fmt.Fprintf(os.Stderr, "Imported %s (%s)\n", result.Name, result.ActiveDeploymentID)
+	} else {
+		fmt.Fprintf(os.Stderr, "Imported %s\n", result.Name)
+	}
+	return nil
+}
+
+// archiveSiteName reads the name a site was exported under from the
+// site.json entry of a site archive.
+func archiveSiteName(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("%s is not a site archive", path)
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Name != "site.json" {
+			continue
+		}
+		var info struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(tr).Decode(&info); err != nil || info.Name == "" {
+			return "", fmt.Errorf("%s is not a site archive", path)
+		}
+		return info.Name, nil
+	}
+}
+
+// errorMessage extracts the message from a problem details or JSON error
+// response, falling back to the raw body.
+func errorMessage(body io.Reader) string {
+	data, _ := io.ReadAll(body)
+	var e struct {
+		Detail string `json:"detail"`
+		Error  string `json:"error"`
+	}
+	if json.Unmarshal(data, &e) == nil {
+		if e.Detail != "" {
+			return e.Detail
+		}
+		if e.Error != "" {
+			return e.Error
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
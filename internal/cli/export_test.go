@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest := []byte(`{"name":"docs","active_deployment_id":"aaa11111"}`)
+	tw.WriteHeader(&tar.Header{Name: "site.json", Mode: 0644, Size: int64(len(manifest)), Typeflag: tar.TypeReg})
+	tw.Write(manifest)
+	tw.Close()
+	gz.Close()
+	archive := buf.Bytes()
+
+	var mu sync.Mutex
+	var gotExport, gotImport string
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			gotExport = r.RequestURI
+			w.Write(archive)
+			return
+		}
+		gotImport = r.RequestURI
+		uploaded, _ = io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]string{"name": "docs", "active_deployment_id": "aaa11111"})
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "docs.tar.gz")
+	if err := Export([]string{"--server", srv.URL, "--analytics", "-o", out, "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Import([]string{"--server", srv.URL, out}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gotExport != "/api/v1/sites/docs/export?analytics=true" {
+		t.Errorf("export URI = %q", gotExport)
+	}
+	if gotImport != "/api/v1/sites/docs/import" {
+		t.Errorf("import URI = %q, want site name read from archive", gotImport)
+	}
+	if !bytes.Equal(uploaded, archive) {
+		t.Error("uploaded archive differs from exported one")
+	}
+}
+
+func TestImport_SiteFlagOverridesArchive(t *testing.T) {
+	var gotImport string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotImport = r.RequestURI
+		json.NewEncoder(w).Encode(map[string]string{"name": "handbook"})
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(t.TempDir(), "site.tar.gz")
+	os.WriteFile(p, []byte("anything"), 0644)
+
+	if err := Import([]string{"--server", srv.URL, "--site", "handbook", p}); err != nil {
+		t.Fatal(err)
+	}
+	if gotImport != "/api/v1/sites/handbook/import" {
+		t.Errorf("import URI = %q", gotImport)
+	}
+}
+
+func TestImport_ErrorMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "site already exists"})
+	}))
+	defer srv.Close()
+
+	p := filepath.Join(t.TempDir(), "site.tar.gz")
+	os.WriteFile(p, []byte("anything"), 0644)
+
+	err := Import([]string{"--server", srv.URL, "--site", "docs", p})
+	if err == nil || !strings.Contains(err.Error(), "site already exists") {
+		t.Errorf("err = %v, want message from server", err)
+	}
+}
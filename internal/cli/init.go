@@ -15,6 +15,14 @@ const siteConfigTemplate = `# tspages site configuration
 # Requires the "funnel" node attribute in your tailnet policy.
 # public = false
 
+# Let search engines index the site while it is public. Otherwise, responses
+# carry "X-Robots-Tag: noindex" and robots.txt disallows crawling.
+# indexable = false
+
+# Mark the site as a staging copy: HTML pages show a "Staging" ribbon, and
+# search engines are kept out even if it is indexable.
+# staging = false
+
 # Enable single-page application routing.
 # All non-file requests serve the index page instead of 404.
 # spa_routing = false
@@ -26,9 +34,22 @@ const siteConfigTemplate = `# tspages site configuration
 # Record per-request analytics (page views, visitors, top pages).
 # analytics = true
 
+# Show visitors a notice that access is recorded, with an opt-out button.
+# analytics_notice = false
+
 # Show directory listings for folders without an index page.
 # directory_listing = false
 
+# Serve localized documents based on the Accept-Language header.
+# A request for /about.html prefers /about.de.html or /de/about.html.
+# i18n = false
+
+# Minify HTML, CSS, and JavaScript at deploy time.
+# minify = false
+
+# Language of the unsuffixed documents; negotiation stops here.
+# default_language = "en"
+
 # Default file to serve for directory requests.
 # index_page = "index.html"
 
@@ -38,6 +59,50 @@ const siteConfigTemplate = `# tspages site configuration
 # Trailing slash behavior: "add", "remove", or "" (no normalization).
 # trailing_slash = ""
 
+# Soft monthly transfer cap in MiB. Going over sends a
+# site.transfer_cap_exceeded webhook; the site keeps serving. 0 disables it.
+# transfer_cap_mb = 0
+
+# Alert when requests or the share of 5xx responses in the last hour
+# deviate this many times from the week before, with an analytics.anomaly
+# webhook. 0 disables it.
+# anomaly_factor = 0
+
+# Record one in this many requests for assets, counting each as that many
+# in analytics; HTML pages are always recorded. 0 or 1 records all.
+# analytics_sample_rate = 0
+
+# Count responses with a file of at least this many KiB, sent in full, as
+# downloads in analytics and directory listings; 0 counts none.
+# download_min_kb = 0
+
+# Tailnet node of the site. Advertised tags let ACLs tell groups of sites
+# apart; the auth key must be allowed to use them. The prefix and suffix
+# change the site's hostname, e.g. "pages-" serves docs at pages-docs.
+# ephemeral = false
+# advertise_tags = ["tag:pages-internal"]
+# hostname_prefix = ""
+# hostname_suffix = ""
+
+# Additional HTTPS ports, a redirect from plain HTTP on port 80, and the
+# address family ("ipv4" or "ipv6") to accept connections over.
+# listen_ports = [8443]
+# http_redirect = true
+# ip_family = ""
+
+# Caps on the open connections and in-flight requests of the site's
+# server; requests over them get a 503. 0 disables a cap.
+# max_connections = 0
+# max_concurrent_requests = 0
+
+# Link to a diff of the commits between deployments, if CI names them.
+# compare_url = "https://github.com/org/repo/compare/{from}...{to}"
+
+# Send a preset of security headers (HSTS, X-Content-Type-Options,
+# Referrer-Policy, Permissions-Policy): "strict", "relaxed", or "off".
+# Custom headers below take precedence over them.
+# security_headers = "off"
+
 # Custom response headers by path pattern.
 # [headers."/assets/*"]
 # Cache-Control = "public, max-age=31536000, immutable"
@@ -48,10 +113,44 @@ const siteConfigTemplate = `# tspages site configuration
 # to = "/new-path"
 # status = 301
 
-# Webhook notifications for deploy and site events.
+# Restrict paths to listed logins, device tags, or a capability level.
+# A visitor matching any of them is let through.
+# [[access]]
+# path = "/internal/*"
+# users = ["*@corp.example"]
+# tags = ["tag:ci"]
+# access = "admin"
+
+# Webhook notifications for deploy, site, analytics, and operator events.
 # webhook_url = "https://example.com/webhook"
-# webhook_events = ["deploy.success", "deploy.failed", "site.created", "site.deleted"]
+# webhook_events = ["deploy.success", "deploy.failed", "site.created", "site.deleted", "site.transfer_cap_exceeded", "analytics.anomaly", "operator.alert"]
 # webhook_secret = ""
+
+# Hold back webhooks other than failures and alerts during quiet hours, and
+# send at most this many per minute; held webhooks are sent together later.
+# webhook_quiet_hours = "22:00-07:00"
+# webhook_timezone = "Europe/Berlin"
+# webhook_rate_limit = 0
+
+# Stages of the serving pipeline (auth, redirects, headers, cache,
+# compression, analytics) that requests skip. Auth cannot be disabled.
+# disabled_stages = ["analytics"]
+
+# Purge external caches, such as Varnish, when a deployment is activated: one
+# request per added, changed, or removed path when the URL contains {path}.
+# [[purge_webhooks]]
+# type = "http-purge"
+# method = "PURGE"
+# url = "https://cache.example.com/{site}{path}"
+# auth_header = "Authorization: Bearer <token>"
+
+# Open Graph and Twitter card meta tags for link previews, added to the HTML
+# pages matching path unless they have them. Later rules override earlier ones.
+# [[social_previews]]
+# path = "/*"
+# title = "Platform docs"
+# description = "How to build, deploy, and run services on the platform."
+# image = "/assets/preview.png"
 `
 
 const serverConfigTemplate = `# tspages server configuration
@@ -84,6 +183,9 @@ const serverConfigTemplate = `# tspages server configuration
 # Maximum deployments retained per site.
 # max_deployments = 10
 
+# Number of site servers started at once when tspages starts.
+# startup_concurrency = 8
+
 # Log level: debug, info, warn, error.
 # log_level = "warn"
 
@@ -93,17 +195,128 @@ const serverConfigTemplate = `# tspages server configuration
 # Hide the admin UI footer.
 # hide_footer = false
 
+# Days deleted sites and deployments stay in the trash before being purged.
+# trash_retention_days = 7
+
+# Days webhook deliveries are kept in the delivery log (0: forever).
+# webhook_retention_days = 90
+
+# Minutes between checks of each site's served files against what was
+# deployed, flagging files changed outside tspages (0: off), and how many
+# files per site are also checked against their hashes each time.
+# tamper_check_minutes = 0
+# tamper_check_files = 20
+
+# Analytics events queued for writing, and how many milliseconds a request
+# waits for room in a full queue before its event is dropped (0: never wait).
+# analytics_buffer_size = 1024
+# analytics_block_ms = 0
+
+# Write .br and .gz variants of compressible files at deploy time, at this
+# compression level (1-11). 0 compresses responses on the fly instead.
+# precompress_level = 0
+
+# Levels responses are compressed at on the fly (gzip 1-9, brotli 0-11), the
+# largest file compressed on the fly in MB (0: no limit), and how many
+# responses are compressed at once (0: half the CPUs).
+# gzip_level = 6
+# brotli_level = 4
+# compress_max_mb = 0
+# compress_workers = 0
+
+# Limits of every site's server: seconds a client may take to send request
+# headers, seconds an idle keep-alive connection stays open, the largest
+# request headers in KB, and the connections one node may keep open to a
+# site (0: no cap).
+# site_read_header_timeout = 10
+# site_idle_timeout = 120
+# site_max_header_kb = 64
+# site_max_connections_per_node = 0
+
+# Mirror another tspages instance as a read-only replica. Set to the primary's
+# control plane hostname or URL; sites are served with the hostname suffix.
+# replica_of = ""
+# replica_sync_interval = 60
+# replica_hostname_suffix = "-replica"
+# Forward the analytics a replica records to its primary.
+# replica_forward_analytics = false
+
+# Store analytics in PostgreSQL instead of the SQLite file in data_dir.
+# [analytics]
+# driver = "postgres"
+# dsn = "postgres://tspages@db.internal/tspages_analytics"
+# Tell unique visitors apart by "login", "node", or "login+node".
+# visitors = "login"
+
+# Send a summary of the past week's deployments, traffic, and failed webhooks.
+# schedule is a cron expression (minute hour day month weekday), local time.
+# [digest]
+# schedule = "0 9 * * 1"
+# sites = []
+# slack_webhook_url = "https://hooks.slack.com/services/..."
+# email_to = ["web-team@corp.example"]
+# email_from = "tspages@corp.example"
+# smtp_host = "smtp.corp.example"
+# smtp_port = 587
+# smtp_username = ""
+# smtp_password = ""
+#
+# Verify every site on a schedule and send the report to the destinations
+# above: its active deployment, config, index page, a sample of its files,
+# and its webhook endpoint.
+# verify_schedule = "0 3 * * *"
+# verify_sample_files = 20
+
+# Identify control plane users by headers from an authenticating reverse
+# proxy instead of Tailscale. The control plane then listens for plain HTTP.
+# [auth]
+# mode = "header"
+# listen = "127.0.0.1:8080"
+# dns_suffix = ""
+# trusted_proxies = ["127.0.0.1/32", "::1/128"]
+#
+# [auth.groups]
+# admins = [{ access = "admin" }]
+
+# Serve a site under an additional hostname with its own certificate. Repeat
+# the block for each hostname; point its DNS at the site's tailnet address.
+# [[domains]]
+# site = "docs"
+# hostname = "docs.corp.example"
+# cert_file = "/etc/tspages/docs.crt"
+# key_file = "/etc/tspages/docs.key"
+
 # Default site configuration. These values apply to all sites unless
 # overridden by a per-deployment tspages.toml.
 # [defaults]
 # public = false
+# indexable = false
 # spa_routing = false
 # html_extensions = true
 # analytics = true
+# analytics_notice = false
 # directory_listing = false
+# i18n = false
+# minify = false
+# default_language = ""
 # index_page = "index.html"
 # not_found_page = ""
 # trailing_slash = ""
+# transfer_cap_mb = 0
+# anomaly_factor = 0
+# analytics_sample_rate = 0
+# download_min_kb = 0
+# ephemeral = false
+# advertise_tags = []
+# hostname_prefix = ""
+# hostname_suffix = ""
+# listen_ports = []
+# http_redirect = false
+# ip_family = ""
+# max_connections = 0
+# max_concurrent_requests = 0
+# compare_url = ""
+# security_headers = "off"
 `
 
 // Init is the entrypoint for `tspages init`.
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// projectFile names the deploy environments of a project. It is looked up
+// in the current directory and its parents.
+const projectFile = ".tspages.toml"
+
+// projectEnv is where and how `tspages deploy --env` deploys.
+type projectEnv struct {
+	Site   string `toml:"site"`
+	Path   string `toml:"path"`
+	Server string `toml:"server"`
+	// NoActivate is a pointer so an environment can turn off a no_activate
+	// set for every environment.
+	NoActivate *bool `toml:"no_activate"`
+}
+
+// projectConfig is a parsed project file. Its top-level values apply to
+// every environment that does not set its own.
+type projectConfig struct {
+	projectEnv
+	Env map[string]projectEnv `toml:"env"`
+}
+
+// findProjectFile returns the path of the project file in dir or the
+// nearest of its parents, or "" if there is none.
+func findProjectFile(dir string) string {
+	for {
+		file := filepath.Join(dir, projectFile)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProjectEnv returns environment name of the project file at file,
+// with the file's top-level values filled in and its path resolved against
+// the file's directory.
+func loadProjectEnv(file, name string) (projectEnv, error) {
+	var cfg projectConfig
+	md, err := toml.DecodeFile(file, &cfg)
+	if err != nil {
+		return projectEnv{}, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return projectEnv{}, fmt.Errorf("%s: unknown keys: %s", file, strings.Join(keys, ", "))
+	}
+
+	env, ok := cfg.Env[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Env))
+		for n := range cfg.Env {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return projectEnv{}, fmt.Errorf("%s defines no environments", file)
+		}
+		return projectEnv{}, fmt.Errorf("%s has no environment %q; it has %s", file, name, strings.Join(names, ", "))
+	}
+	if env.Site == "" {
+		env.Site = cfg.Site
+	}
+	if env.Path == "" {
+		env.Path = cfg.Path
+	}
+	if env.Server == "" {
+		env.Server = cfg.Server
+	}
+	if env.NoActivate == nil {
+		env.NoActivate = cfg.NoActivate
+	}
+
+	if env.Site == "" {
+		return projectEnv{}, fmt.Errorf("%s: environment %q has no site", file, name)
+	}
+	if env.Path == "" {
+		return projectEnv{}, fmt.Errorf("%s: environment %q has no path", file, name)
+	}
+	if !filepath.IsAbs(env.Path) {
+		env.Path = filepath.Join(filepath.Dir(file), env.Path)
+	}
+	return env, nil
+}
+
+// resolveProjectEnv finds the project file from the current directory and
+// returns its environment name.
+func resolveProjectEnv(name string) (projectEnv, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return projectEnv{}, err
+	}
+	file := findProjectFile(wd)
+	if file == "" {
+		return projectEnv{}, errors.New("--env requires a " + projectFile + " in the current directory or a parent")
+	}
+	return loadProjectEnv(file, name)
+}
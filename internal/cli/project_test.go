@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testProject = `
+path = "dist"
+server = "https://pages.example.ts.net"
+
+[env.staging]
+site = "docs-staging"
+no_activate = true
+
+[env.prod]
+site = "docs"
+path = "build/prod"
+`
+
+func TestLoadProjectEnv(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, projectFile)
+	os.WriteFile(file, []byte(testProject), 0644)
+
+	staging, err := loadProjectEnv(file, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staging.Site != "docs-staging" || staging.Path != filepath.Join(dir, "dist") ||
+		staging.Server != "https://pages.example.ts.net" || staging.NoActivate == nil || !*staging.NoActivate {
+		t.Errorf("staging = %+v", staging)
+	}
+	prod, err := loadProjectEnv(file, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Site != "docs" || prod.Path != filepath.Join(dir, "build", "prod") || prod.NoActivate != nil {
+		t.Errorf("prod = %+v", prod)
+	}
+
+	if _, err := loadProjectEnv(file, "dev"); err == nil || !strings.Contains(err.Error(), "prod, staging") {
+		t.Errorf("unknown environment: err = %v, want one naming the environments", err)
+	}
+}
+
+func TestLoadProjectEnv_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown key": "[env.prod]\nsite = \"docs\"\npath = \"dist\"\nactivate = false\n",
+		"no site":     "path = \"dist\"\n[env.prod]\nserver = \"https://pages.example.ts.net\"\n",
+		"no path":     "[env.prod]\nsite = \"docs\"\n",
+	} {
+		file := filepath.Join(t.TempDir(), projectFile)
+		os.WriteFile(file, []byte(content), 0644)
+		if _, err := loadProjectEnv(file, "prod"); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "a", "b")
+	os.MkdirAll(nested, 0755)
+	if got := findProjectFile(nested); got != "" {
+		t.Errorf("findProjectFile() = %q without a project file", got)
+	}
+	os.WriteFile(filepath.Join(dir, projectFile), []byte(testProject), 0644)
+	if got := findProjectFile(nested); got != filepath.Join(dir, projectFile) {
+		t.Errorf("findProjectFile() = %q, want the parent's", got)
+	}
+}
+
+func TestDeploy_Env(t *testing.T) {
+	var mu sync.Mutex
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotPath = r.RequestURI
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"deployment_id": "test-123", "site": "docs-staging"})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "index.html"), []byte("<h1>hi</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, projectFile), []byte(strings.ReplaceAll(testProject, "https://pages.example.ts.net", srv.URL)), 0644)
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	t.Chdir(filepath.Join(dir, "src"))
+
+	if err := Deploy([]string{"--env", "staging"}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gotPath != "/api/v1/deploy/docs-staging?activate=false" {
+		t.Errorf("request URI = %q, want the staging site without activation", gotPath)
+	}
+
+	if err := Deploy([]string{"--env", "staging", "dist", "docs"}); err == nil {
+		t.Error("--env with a site argument: no error")
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"tspages/config"
+	"tspages/internal/analytics"
+	"tspages/internal/deployindex"
+	"tspages/internal/storage"
+)
+
+// Reconcile is the entrypoint for `tspages reconcile`.
+func Reconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	configPath := fs.String("config", "tspages.toml", "path to the server's config file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tspages reconcile [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Rebuild the deployment index from the deployments in the data directory.\n")
+		fmt.Fprintf(os.Stderr, "Run it on the server's host; the server may keep running.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	db, err := analytics.OpenSQLite(filepath.Join(cfg.Server.DataDir, "analytics.db"))
+	if err != nil {
+		return fmt.Errorf("opening deployment index: %w", err)
+	}
+	defer db.Close() //nolint:errcheck // best-effort cleanup on exit
+	index, err := deployindex.New(db, storage.New(cfg.Server.DataDir))
+	if err != nil {
+		return err
+	}
+	sites, deployments, err := index.Reconcile()
+	if err != nil {
+		return fmt.Errorf("reconciling deployment index: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Indexed %d deployments of %d sites.\n", deployments, sites)
+	return nil
+}
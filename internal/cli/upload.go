@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"tspages/internal/bytesize"
+	"tspages/internal/problem"
+)
+
+// retryBase is the delay before the first retry of a failed upload; it
+// doubles with each further retry, up to retryMax.
+var (
+	retryBase = time.Second
+	retryMax  = 30 * time.Second
+)
+
+// uploadStats describes a finished upload for the deployment report.
+type uploadStats struct {
+	Bytes    int64
+	Duration time.Duration
+	// Retries is how many times the upload was retried after a transient
+	// failure.
+	Retries int
+}
+
+// upload sends body to url with method and header, retrying up to retries
+// times after network errors and responses a proxy or an overloaded server
+// send for transient failures. If progress is not nil, it draws a progress
+// bar of each attempt on it. It returns the final response with its body
+// read.
+func upload(client *http.Client, method, url string, header http.Header, body []byte, retries int, progress io.Writer) (*http.Response, []byte, uploadStats, error) {
+	stats := uploadStats{Bytes: int64(len(body))}
+	for attempt := 0; ; attempt++ {
+		var r io.Reader = bytes.NewReader(body)
+		var bar *progressBar
+		if progress != nil {
+			bar = &progressBar{r: r, w: progress, total: int64(len(body)), start: time.Now()}
+			r = bar
+		}
+		req, err := http.NewRequest(method, url, r)
+		if err != nil {
+			return nil, nil, stats, fmt.Errorf("creating request: %w", err)
+		}
+		req.ContentLength = int64(len(body))
+		req.Header = header.Clone()
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		var respBody []byte
+		if err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		stats.Duration = time.Since(start)
+		if bar != nil {
+			bar.clear()
+		}
+		if attempt >= retries || !transient(resp, err) {
+			if err != nil {
+				return nil, nil, stats, fmt.Errorf("upload failed: %w", err)
+			}
+			return resp, respBody, stats, nil
+		}
+
+		delay := retryDelay(attempt, resp)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+		}
+		fmt.Fprintf(os.Stderr, "Upload failed (%s), retrying in %s...\n", reason, delay)
+		time.Sleep(delay)
+		stats.Retries++
+	}
+}
+
+// transient reports whether an upload that got resp or err may succeed if
+// tried again.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return problem.Retryable(resp.StatusCode)
+}
+
+// retryDelay returns how long to wait before retrying after attempt: the
+// Retry-After of resp if it has one, otherwise retryBase doubled for each
+// earlier retry.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			return min(time.Duration(s)*time.Second, retryMax)
+		}
+	}
+	return min(retryBase<<attempt, retryMax)
+}
+
+// progressBar counts the bytes read from r and redraws a progress bar with
+// the estimated time left on w, at most every 100ms.
+type progressBar struct {
+	r     io.Reader
+	w     io.Writer
+	total int64
+	read  int64
+	start time.Time
+	drawn time.Time
+}
+
+func (p *progressBar) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.drawn) >= 100*time.Millisecond || p.read == p.total {
+		p.drawn = now
+		p.draw(now)
+	}
+	return n, err
+}
+
+func (p *progressBar) draw(now time.Time) {
+	const width = 30
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = float64(p.read) / float64(p.total)
+	}
+	filled := int(fraction * width)
+	bar := make([]byte, width)
+	for i := range bar {
+		if i < filled {
+			bar[i] = '#'
+		} else {
+			bar[i] = '-'
+		}
+	}
+	eta := "--"
+	if elapsed := now.Sub(p.start); p.read > 0 && elapsed > 0 {
+		left := time.Duration(float64(elapsed) * float64(p.total-p.read) / float64(p.read))
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(p.w, "\r[%s] %3.0f%%  %s / %s  %s left  ", bar, fraction*100, bytesize.Format(p.read), bytesize.Format(p.total), eta)
+}
+
+// clear erases the progress bar.
+func (p *progressBar) clear() {
+	if !p.drawn.IsZero() {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+// isTerminal reports whether f is a terminal, where a progress bar can be
+// redrawn in place.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
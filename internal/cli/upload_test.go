@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpload_RetriesTransientFailures(t *testing.T) {
+	retryBase = time.Millisecond
+	t.Cleanup(func() { retryBase = time.Second })
+
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "site" || r.Header.Get("X-Test") != "yes" {
+			t.Errorf("attempt %d got body %q, header %q", attempts, body, r.Header.Get("X-Test"))
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	header := http.Header{"X-Test": {"yes"}}
+	resp, body, stats, err := upload(srv.Client(), "PUT", srv.URL, header, []byte("site"), 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q, want 200 ok", resp.StatusCode, body)
+	}
+	if stats.Retries != 2 || stats.Bytes != 4 {
+		t.Errorf("stats = %+v, want 2 retries of 4 bytes", stats)
+	}
+}
+
+func TestUpload_GivesUp(t *testing.T) {
+	retryBase = time.Millisecond
+	t.Cleanup(func() { retryBase = time.Second })
+
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	resp, _, stats, err := upload(srv.Client(), "PUT", srv.URL, http.Header{}, []byte("site"), 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || attempts != 3 || stats.Retries != 2 {
+		t.Errorf("got %d after %d attempts (%d retries), want 502 after 3", resp.StatusCode, attempts, stats.Retries)
+	}
+}
+
+func TestUpload_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	resp, _, _, err := upload(srv.Client(), "PUT", srv.URL, http.Header{}, []byte("site"), 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || attempts != 1 {
+		t.Errorf("got %d after %d attempts, want 400 after 1", resp.StatusCode, attempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	withRetryAfter := &http.Response{Header: http.Header{"Retry-After": {"5"}}}
+	tests := []struct {
+		attempt int
+		resp    *http.Response
+		want    time.Duration
+	}{
+		{0, nil, time.Second},
+		{2, nil, 4 * time.Second},
+		{10, nil, retryMax},
+		{0, withRetryAfter, 5 * time.Second},
+		{0, &http.Response{Header: http.Header{"Retry-After": {"3600"}}}, retryMax},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt, tt.resp); got != tt.want {
+			t.Errorf("retryDelay(%d, %v) = %s, want %s", tt.attempt, tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	data := strings.Repeat("x", 2048)
+	bar := &progressBar{r: strings.NewReader(data), w: &out, total: int64(len(data)), start: time.Now()}
+	if _, err := io.Copy(io.Discard, bar); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[##############################] 100%  2.0 KB / 2.0 KB") {
+		t.Errorf("progress bar did not reach 100%%: %q", out.String())
+	}
+	out.Reset()
+	bar.clear()
+	if out.String() != "\r\033[K" {
+		t.Errorf("clear wrote %q", out.String())
+	}
+}
@@ -0,0 +1,268 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// bundleManifestFile is the file at the root of a bundle that maps its
+// directories to sites.
+const bundleManifestFile = "tspages-bundle.toml"
+
+// Bundle result statuses.
+const (
+	BundleDeployed   = "deployed"
+	BundleFailed     = "failed"
+	BundleRolledBack = "rolled_back"
+	BundleSkipped    = "skipped"
+)
+
+// BundleManifest is the content of a bundle's tspages-bundle.toml.
+type BundleManifest struct {
+	// Sites maps site names to the bundle directory each is deployed from.
+	Sites map[string]string `toml:"sites"`
+}
+
+// BundleResult is the outcome of deploying one site of a bundle.
+type BundleResult struct {
+	Site         string `json:"site"`
+	Dir          string `json:"dir"`
+	Status       string `json:"status"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// BundleResponse is the JSON response for POST /deploy.
+type BundleResponse struct {
+	Results []BundleResult `json:"results"`
+}
+
+// BundleFailedResponse is the problem sent when an all-or-nothing bundle
+// deploy fails.
+type BundleFailedResponse struct {
+	problem.Details
+	Results []BundleResult `json:"results"`
+}
+
+// BundleHandler handles POST /deploy, which deploys several sites from one
+// archive. The archive's tspages-bundle.toml names the directory each site
+// is deployed from. Sites are deployed in order of their names; with
+// atomic=true, a site that fails rolls back the others before any is
+// activated.
+type BundleHandler struct {
+	*Handler
+}
+
+// NewBundleHandler returns a handler deploying bundles through h.
+func NewBundleHandler(h *Handler) *BundleHandler {
+	return &BundleHandler{Handler: h}
+}
+
+func (h *BundleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	maxBytes := int64(h.maxUploadMB) << 20
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			problem.Write(w, http.StatusRequestEntityTooLarge, problem.UploadTooLarge, "upload too large")
+		} else {
+			problem.Error(w, "reading upload", http.StatusBadRequest)
+		}
+		return
+	}
+	if len(body) == 0 {
+		problem.Write(w, http.StatusBadRequest, problem.EmptyUpload, "empty upload")
+		return
+	}
+	if !isZip(body) && !isGzip(body) && !isXz(body) && !isTar(body) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidUpload, "a bundle must be a zip or tar archive")
+		return
+	}
+
+	// Symlinks are not extracted, since one could point out of the
+	// directory its site is deployed from.
+	bundleDir, err := os.MkdirTemp("", "tspages-bundle-")
+	if err != nil {
+		problem.Error(w, "creating bundle dir", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(bundleDir)
+	if _, err := Extract(ExtractRequest{Body: body}, bundleDir, maxBytes); err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidUpload, fmt.Sprintf("extracting bundle: %v", err))
+		return
+	}
+
+	sites, results, ok := h.readManifest(w, r, bundleDir)
+	if !ok {
+		return
+	}
+
+	atomic := r.URL.Query().Get("atomic") == "true"
+	pending := make([]*pendingDeployment, len(sites))
+	for i, site := range sites {
+		dir := filepath.Join(bundleDir, filepath.FromSlash(results[i].Dir))
+		d, derr := h.prepare(r, site, deploySource{
+			extract: func(contentDir string) (int64, error) {
+				return copyDir(dir, contentDir)
+			},
+			build:   buildInfoFromHeader(r.Header),
+			logMsg:  "bundle received",
+			logArgs: []any{"bytes", len(body), "dir", results[i].Dir},
+		})
+		if derr == nil {
+			pending[i] = d
+			continue
+		}
+		results[i].Status = BundleFailed
+		results[i].Error = derr.detail
+		if atomic {
+			h.rollBack(r, site, pending, results)
+			status := derr.status
+			code := derr.code
+			if code == "" {
+				code = problem.CodeFor(status)
+			}
+			problem.Send(w, status, BundleFailedResponse{
+				Details: problem.New(status, code, fmt.Sprintf("deploying %s: %s", site, derr.detail)),
+				Results: results,
+			})
+			return
+		}
+	}
+
+	status := http.StatusOK
+	for i, d := range pending {
+		if d == nil {
+			status = http.StatusMultiStatus
+			continue
+		}
+		if derr := h.complete(r, d); derr != nil {
+			pending[i] = nil
+			results[i].Status = BundleFailed
+			results[i].Error = derr.detail
+			status = http.StatusMultiStatus
+			continue
+		}
+		resp := d.response(h.dnsSuffix, h.defaults)
+		results[i].Status = BundleDeployed
+		results[i].DeploymentID = resp.DeploymentID
+		results[i].URL = resp.URL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSON(w, BundleResponse{Results: results})
+
+	for _, d := range pending {
+		if d != nil {
+			h.publish(r, d)
+		}
+	}
+}
+
+// readManifest reads the manifest of the bundle extracted to bundleDir and
+// checks that the caller may deploy its sites. It returns the sites in
+// order of their names, with a pending result each, or responds with an
+// error.
+func (h *BundleHandler) readManifest(w http.ResponseWriter, r *http.Request, bundleDir string) ([]string, []BundleResult, bool) {
+	data, err := os.ReadFile(filepath.Join(bundleDir, bundleManifestFile))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidUpload, "bundle has no "+bundleManifestFile)
+		return nil, nil, false
+	}
+	var manifest BundleManifest
+	if err := toml.Unmarshal(data, &manifest); err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidConfig, fmt.Sprintf("invalid %s: %v", bundleManifestFile, err))
+		return nil, nil, false
+	}
+	if len(manifest.Sites) == 0 {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidConfig, bundleManifestFile+" lists no sites")
+		return nil, nil, false
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	sites := make([]string, 0, len(manifest.Sites))
+	for site := range manifest.Sites {
+		sites = append(sites, site)
+	}
+	slices.Sort(sites)
+	results := make([]BundleResult, len(sites))
+	for i, site := range sites {
+		if !storage.ValidSiteNameForSuffix(site, h.dnsSuffix) {
+			problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, fmt.Sprintf("invalid site name: %q", site))
+			return nil, nil, false
+		}
+		if !auth.CanDeploy(caps, site) {
+			problem.Error(w, fmt.Sprintf("forbidden to deploy %s", site), http.StatusForbidden)
+			return nil, nil, false
+		}
+		if h.activationPinned(r, site) {
+			problem.Write(w, http.StatusConflict, problem.DeploymentPinned,
+				fmt.Sprintf("%s has a pinned deployment; deploy with activate=false", site))
+			return nil, nil, false
+		}
+		dir := path.Clean(manifest.Sites[site])
+		if dir == "." || path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+			problem.Write(w, http.StatusBadRequest, problem.InvalidConfig,
+				fmt.Sprintf("directory of %s must be a sub-directory of the bundle", site))
+			return nil, nil, false
+		}
+		if info, err := os.Stat(filepath.Join(bundleDir, filepath.FromSlash(dir))); err != nil || !info.IsDir() {
+			problem.Write(w, http.StatusBadRequest, problem.InvalidUpload,
+				fmt.Sprintf("bundle has no directory %s for %s", dir, site))
+			return nil, nil, false
+		}
+		results[i] = BundleResult{Site: site, Dir: dir, Status: BundleSkipped}
+	}
+	return sites, results, true
+}
+
+// rollBack marks the pending deployments of a bundle as failed because
+// the deployment of failed did, and records them as rolled back.
+func (h *BundleHandler) rollBack(r *http.Request, failed string, pending []*pendingDeployment, results []BundleResult) {
+	reason := fmt.Sprintf("rolled back: deploying %s failed", failed)
+	for i, d := range pending {
+		if d == nil {
+			continue
+		}
+		d.fail(StageBundle, reason, errors.New(reason))
+		results[i].Status = BundleRolledBack
+		results[i].DeploymentID = d.id
+		results[i].Error = reason
+	}
+}
+
+// copyDir copies the files in src to dst and returns their total size.
+func copyDir(src, dst string) (int64, error) {
+	if err := os.CopyFS(dst, os.DirFS(src)); err != nil {
+		return 0, err
+	}
+	var size int64
+	err := filepath.WalkDir(dst, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
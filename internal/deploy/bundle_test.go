@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+const bundleManifest = `
+[sites]
+docs = "docs/dist"
+blog = "blog/public"
+`
+
+func bundleRequest(t *testing.T, target string, files map[string]string, caps []auth.Cap) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", target, bytes.NewReader(makeZip(t, files)))
+	req.Header.Set("Content-Type", "application/zip")
+	return withCaps(req, caps)
+}
+
+func newBundleHandler(store *storage.Store, bus *events.Bus) *BundleHandler {
+	return NewBundleHandler(NewHandler(HandlerConfig{
+		Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10,
+		DNSSuffix: testDNSSuffix, Events: bus,
+	}))
+}
+
+var bundleCaps = []auth.Cap{{Access: "deploy", Sites: []string{"docs", "blog"}}}
+
+func TestBundleHandler_DeploysEverySite(t *testing.T) {
+	store := storage.New(t.TempDir())
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.DeploySuccess, func(e events.Event) { got = append(got, e) })
+	h := newBundleHandler(store, bus)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, bundleRequest(t, "/deploy", map[string]string{
+		"tspages-bundle.toml":    bundleManifest,
+		"docs/dist/index.html":   "<h1>Docs</h1>",
+		"blog/public/index.html": "<h1>Blog</h1>",
+		"blog/public/a/b.html":   "<p>post</p>",
+	}, bundleCaps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp BundleResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Results) != 2 || resp.Results[0].Site != "blog" || resp.Results[1].Site != "docs" {
+		t.Fatalf("results = %+v, want blog and docs", resp.Results)
+	}
+	for _, res := range resp.Results {
+		if res.Status != BundleDeployed || res.DeploymentID == "" {
+			t.Errorf("result = %+v, want deployed", res)
+		}
+		if current, _ := store.CurrentDeployment(res.Site); current != res.DeploymentID {
+			t.Errorf("%s current = %q, want %q", res.Site, current, res.DeploymentID)
+		}
+	}
+	post, err := os.ReadFile(filepath.Join(store.ContentDir("blog", resp.Results[0].DeploymentID), "a", "b.html"))
+	if err != nil || string(post) != "<p>post</p>" {
+		t.Errorf("blog a/b.html = %q, %v", post, err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d deploy.success events, want 2", len(got))
+	}
+}
+
+func TestBundleHandler_PartialFailure(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := newBundleHandler(store, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, bundleRequest(t, "/deploy", map[string]string{
+		"tspages-bundle.toml":      bundleManifest,
+		"docs/dist/index.html":     "<h1>Docs</h1>",
+		"blog/public/index.html":   "<h1>Blog</h1>",
+		"blog/public/tspages.toml": "not = [valid",
+	}, bundleCaps))
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp BundleResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if blog := resp.Results[0]; blog.Status != BundleFailed || blog.Error == "" {
+		t.Errorf("blog = %+v, want failed", blog)
+	}
+	if docs := resp.Results[1]; docs.Status != BundleDeployed {
+		t.Errorf("docs = %+v, want deployed", docs)
+	}
+}
+
+func TestBundleHandler_AtomicRollsBack(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := newBundleHandler(store, nil)
+
+	// blog is deployed first, then docs fails.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, bundleRequest(t, "/deploy?atomic=true", map[string]string{
+		"tspages-bundle.toml":    bundleManifest,
+		"docs/dist/index.html":   "<h1>Docs</h1>",
+		"docs/dist/_redirects":   "/a",
+		"blog/public/index.html": "<h1>Blog</h1>",
+	}, bundleCaps))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var resp BundleFailedResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	blog, docs := resp.Results[0], resp.Results[1]
+	if blog.Status != BundleRolledBack || docs.Status != BundleFailed {
+		t.Fatalf("results = %+v, want blog rolled back and docs failed", resp.Results)
+	}
+	if current, _ := store.CurrentDeployment("blog"); current != "" {
+		t.Errorf("blog was activated: %q", current)
+	}
+	if store.DeploymentComplete("blog", blog.DeploymentID) {
+		t.Error("rolled back deployment is complete")
+	}
+}
+
+func TestBundleHandler_Rejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		caps  []auth.Cap
+		want  int
+	}{
+		{"no manifest", map[string]string{"docs/index.html": "x"}, bundleCaps, http.StatusBadRequest},
+		{"no sites", map[string]string{"tspages-bundle.toml": "[sites]\n"}, bundleCaps, http.StatusBadRequest},
+		{"missing dir", map[string]string{"tspages-bundle.toml": `sites = { docs = "dist" }`}, bundleCaps, http.StatusBadRequest},
+		{"escaping dir", map[string]string{"tspages-bundle.toml": `sites = { docs = "../dist" }`}, bundleCaps, http.StatusBadRequest},
+		{"invalid site", map[string]string{"tspages-bundle.toml": `sites = { "Docs!" = "dist" }`, "dist/index.html": "x"}, bundleCaps, http.StatusBadRequest},
+		{"forbidden", map[string]string{"tspages-bundle.toml": `sites = { admin = "dist" }`, "dist/index.html": "x"}, bundleCaps, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.New(t.TempDir())
+			rec := httptest.NewRecorder()
+			newBundleHandler(store, nil).ServeHTTP(rec, bundleRequest(t, "/deploy", tt.files, tt.caps))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if sites, _ := store.ListSites(); len(sites) != 0 {
+				t.Errorf("sites = %+v, want none", sites)
+			}
+		})
+	}
+}
+
+func TestBundleHandler_RejectsNonArchive(t *testing.T) {
+	req := httptest.NewRequest("POST", "/deploy", bytes.NewReader([]byte("<h1>Hi</h1>")))
+	req = withCaps(req, bundleCaps)
+	rec := httptest.NewRecorder()
+	newBundleHandler(storage.New(t.TempDir()), nil).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package deploy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/metrics"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// CachePurger drops a site's serve caches. It is implemented by
+// multihost.Manager.
+type CachePurger interface {
+	PurgeCache(site, prefix string) (int, error)
+}
+
+// PurgeCacheResponse is the JSON response for POST /sites/{site}/cache/purge.
+type PurgeCacheResponse struct {
+	Site   string `json:"site"`
+	Prefix string `json:"prefix"`
+	Purged int    `json:"purged"`
+}
+
+// PurgeCacheHandler handles POST /sites/{site}/cache/purge. The optional
+// prefix query parameter limits the purge to URL paths starting with it.
+type PurgeCacheHandler struct {
+	store  *storage.Store
+	purger CachePurger
+	events *events.Bus
+}
+
+func NewPurgeCacheHandler(store *storage.Store, purger CachePurger, bus *events.Bus) *PurgeCacheHandler {
+	return &PurgeCacheHandler{store: store, purger: purger, events: bus}
+}
+
+func (h *PurgeCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeploy(caps, site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") || slices.Contains(strings.Split(prefix, "/"), "..") {
+		problem.Error(w, "prefix must be a URL path starting with /", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.store.GetSite(site); err != nil {
+		problem.Write(w, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	purged, err := h.purger.PurgeCache(site, prefix)
+	if err != nil {
+		problem.Error(w, fmt.Sprintf("purging cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+	metrics.CountCachePurge("request", purged)
+
+	writeJSON(w, PurgeCacheResponse{Site: site, Prefix: prefix, Purged: purged})
+
+	publishPurge(h.events, events.Event{
+		Site:      site,
+		RequestID: httplog.RequestID(r.Context()),
+		Data:      map[string]any{"prefix": prefix, "purged": purged, "purged_by": actorName(r)},
+	})
+}
+
+// PurgeCacheOnActivation purges a site's serve caches whenever one of its
+// deployments is activated, so the caches only hold files of the
+// deployment being served. It returns a function that stops purging.
+func PurgeCacheOnActivation(bus *events.Bus, purger CachePurger) (unsubscribe func()) {
+	return bus.Subscribe(events.DeploymentActivated, func(e events.Event) {
+		purged, err := purger.PurgeCache(e.Site, "")
+		if err != nil {
+			slog.Warn("purging cache after activation failed", "site", e.Site, "err", err)
+			return
+		}
+		metrics.CountCachePurge("activation", purged)
+		publishPurge(bus, events.Event{
+			Site:      e.Site,
+			RequestID: e.RequestID,
+			Data:      map[string]any{"purged": purged, "deployment_id": e.Data["deployment_id"]},
+		})
+	})
+}
+
+// publishPurge publishes e as a cache purge, adding its type and site.
+func publishPurge(bus *events.Bus, e events.Event) {
+	if bus == nil {
+		return
+	}
+	e.Type = events.CachePurged
+	e.Data["site"] = e.Site
+	bus.Publish(e)
+}
@@ -0,0 +1,106 @@
+package deploy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+type mockPurger struct {
+	purged []string // site + prefix of each purge
+}
+
+func (m *mockPurger) PurgeCache(site, prefix string) (int, error) {
+	m.purged = append(m.purged, site+prefix)
+	return 3, nil
+}
+
+func purgeRequest(target string, caps []auth.Cap) *http.Request {
+	req := httptest.NewRequest("POST", target, nil)
+	req = withCaps(req, caps)
+	req = req.WithContext(auth.ContextWithIdentity(req.Context(), auth.Identity{LoginName: "alice@example.com"}))
+	req.SetPathValue("site", "docs")
+	return req
+}
+
+func TestPurgeCacheHandler(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateSite("docs")
+	purger := &mockPurger{}
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	h := NewPurgeCacheHandler(store, purger, bus)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, purgeRequest("/sites/docs/cache/purge?prefix=/assets/", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp PurgeCacheResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp != (PurgeCacheResponse{Site: "docs", Prefix: "/assets/", Purged: 3}) {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(purger.purged) != 1 || purger.purged[0] != "docs/assets/" {
+		t.Errorf("purged = %v, want [docs/assets/]", purger.purged)
+	}
+	if len(got) != 1 || got[0].Type != events.CachePurged || got[0].Data["purged_by"] != "alice@example.com" {
+		t.Errorf("events = %+v, want a cache purge by alice", got)
+	}
+}
+
+func TestPurgeCacheHandler_Rejects(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateSite("docs")
+	deployer := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+	tests := []struct {
+		name   string
+		target string
+		caps   []auth.Cap
+		site   string
+		want   int
+	}{
+		{"viewer", "/sites/docs/cache/purge", []auth.Cap{{Access: "view", Sites: []string{"docs"}}}, "docs", http.StatusForbidden},
+		{"relative prefix", "/sites/docs/cache/purge?prefix=assets", deployer, "docs", http.StatusBadRequest},
+		{"dot-dot prefix", "/sites/docs/cache/purge?prefix=/../x", deployer, "docs", http.StatusBadRequest},
+		{"missing site", "/sites/demo/cache/purge", []auth.Cap{{Access: "admin"}}, "demo", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purger := &mockPurger{}
+			req := purgeRequest(tt.target, tt.caps)
+			req.SetPathValue("site", tt.site)
+			rec := httptest.NewRecorder()
+			NewPurgeCacheHandler(store, purger, nil).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if len(purger.purged) != 0 {
+				t.Errorf("purged %v", purger.purged)
+			}
+		})
+	}
+}
+
+func TestPurgeCacheOnActivation(t *testing.T) {
+	purger := &mockPurger{}
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.CachePurged, func(e events.Event) { got = append(got, e) })
+	PurgeCacheOnActivation(bus, purger)
+
+	bus.Publish(events.Event{Type: events.DeploymentActivated, Site: "docs", Data: map[string]any{"deployment_id": "bbb22222"}})
+
+	if len(purger.purged) != 1 || purger.purged[0] != "docs" {
+		t.Errorf("purged = %v, want the whole docs site", purger.purged)
+	}
+	if len(got) != 1 || got[0].Site != "docs" || got[0].Data["purged"] != 3 {
+		t.Errorf("events = %+v, want a purge of 3 files in docs", got)
+	}
+}
@@ -0,0 +1,162 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// CanaryRequest is the JSON body of POST /deploy/{site}/{id}/canary.
+type CanaryRequest struct {
+	Percent int `json:"percent"`
+}
+
+// CanaryHandler handles POST /deploy/{site}/{id}/canary, which serves
+// deployment id to a share of the site's visitors.
+type CanaryHandler struct {
+	store   *storage.Store
+	manager SiteManager
+	events  *events.Bus
+}
+
+func NewCanaryHandler(store *storage.Store, manager SiteManager, bus *events.Bus) *CanaryHandler {
+	return &CanaryHandler{store: store, manager: manager, events: bus}
+}
+
+func (h *CanaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !storage.ValidDeploymentID(id) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeploy(caps, site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req CanaryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		problem.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Percent < 1 || req.Percent > 99 {
+		problem.Error(w, "percent must be between 1 and 99", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.store.GetSite(site); err != nil {
+		problem.Write(w, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	state := storage.CanaryState{DeploymentID: id, Percent: req.Percent, StartedBy: actorName(r)}
+	if err := h.store.StartCanary(site, state); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrSiteArchived):
+			problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
+		case errors.Is(err, storage.ErrDeploymentNotFound):
+			problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found or incomplete")
+		case errors.Is(err, storage.ErrActiveDeployment):
+			problem.Write(w, http.StatusConflict, problem.DeploymentActive, "cannot canary the active deployment")
+		case errors.Is(err, storage.ErrDeploymentPinned):
+			problem.Write(w, http.StatusConflict, problem.DeploymentPinned, "site has a pinned deployment")
+		default:
+			problem.Error(w, fmt.Sprintf("starting canary: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.manager.EnsureServer(site); err != nil {
+		problem.Error(w, fmt.Sprintf("starting server: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	state, _ = h.store.ReadCanary(site)
+	writeJSON(w, state)
+
+	if h.events != nil {
+		h.events.Publish(events.Event{
+			Type:      events.CanaryStarted,
+			Site:      site,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":          site,
+				"deployment_id": id,
+				"percent":       req.Percent,
+				"started_by":    state.StartedBy,
+			},
+		})
+	}
+}
+
+// StopCanaryHandler handles DELETE /deploy/{site}/canary, which serves the
+// active deployment to all visitors again.
+type StopCanaryHandler struct {
+	store   *storage.Store
+	manager SiteManager
+	events  *events.Bus
+}
+
+func NewStopCanaryHandler(store *storage.Store, manager SiteManager, bus *events.Bus) *StopCanaryHandler {
+	return &StopCanaryHandler{store: store, manager: manager, events: bus}
+}
+
+func (h *StopCanaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeploy(caps, site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if _, err := h.store.GetSite(site); err != nil {
+		problem.Write(w, http.StatusNotFound, problem.SiteNotFound, "site not found")
+		return
+	}
+
+	state, ok := h.store.ReadCanary(site)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.store.StopCanary(site); err != nil {
+		problem.Error(w, fmt.Sprintf("stopping canary: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := h.manager.EnsureServer(site); err != nil {
+		problem.Error(w, fmt.Sprintf("starting server: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	if h.events != nil {
+		h.events.Publish(events.Event{
+			Type:      events.CanaryStopped,
+			Site:      site,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":          site,
+				"deployment_id": state.DeploymentID,
+				"stopped_by":    actorName(r),
+			},
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package deploy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+func canarySite(t *testing.T) *storage.Store {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		store.CreateDeployment("docs", id)
+		store.MarkComplete("docs", id)
+	}
+	store.ActivateDeployment("docs", "aaa11111")
+	return store
+}
+
+func canaryRequest(id, body string, caps []auth.Cap) *http.Request {
+	req := httptest.NewRequest("POST", "/deploy/docs/"+id+"/canary", strings.NewReader(body))
+	req = withCaps(req, caps)
+	req = req.WithContext(auth.ContextWithIdentity(req.Context(), auth.Identity{LoginName: "alice@example.com"}))
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestCanaryHandler_StartAndStop(t *testing.T) {
+	store := canarySite(t)
+	mgr := newMockManager()
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	caps := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+
+	rec := httptest.NewRecorder()
+	NewCanaryHandler(store, mgr, bus).ServeHTTP(rec, canaryRequest("bbb22222", `{"percent":10}`, caps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var state storage.CanaryState
+	json.NewDecoder(rec.Body).Decode(&state)
+	if state.DeploymentID != "bbb22222" || state.Percent != 10 || state.StartedBy != "alice@example.com" {
+		t.Errorf("state = %+v", state)
+	}
+	if _, ok := store.ReadCanary("docs"); !ok {
+		t.Error("canary not stored")
+	}
+	if mgr.ensured["docs"] != 1 {
+		t.Errorf("EnsureServer called %d times, want 1", mgr.ensured["docs"])
+	}
+
+	req := httptest.NewRequest("DELETE", "/deploy/docs/canary", nil)
+	req = withCaps(req, caps)
+	req.SetPathValue("site", "docs")
+	rec = httptest.NewRecorder()
+	NewStopCanaryHandler(store, mgr, bus).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("stop status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := store.ReadCanary("docs"); ok {
+		t.Error("canary still stored after stop")
+	}
+	if mgr.ensured["docs"] != 2 {
+		t.Errorf("EnsureServer called %d times, want 2", mgr.ensured["docs"])
+	}
+
+	if len(got) != 2 || got[0].Type != events.CanaryStarted || got[1].Type != events.CanaryStopped {
+		t.Errorf("events = %+v, want canary started and stopped", got)
+	}
+}
+
+func TestCanaryHandler_Rejects(t *testing.T) {
+	deployer := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+	tests := []struct {
+		name string
+		id   string
+		body string
+		caps []auth.Cap
+		want int
+	}{
+		{"forbidden", "bbb22222", `{"percent":10}`, []auth.Cap{{Access: "view"}}, http.StatusForbidden},
+		{"invalid body", "bbb22222", `percent`, deployer, http.StatusBadRequest},
+		{"percent too low", "bbb22222", `{"percent":0}`, deployer, http.StatusBadRequest},
+		{"percent too high", "bbb22222", `{"percent":100}`, deployer, http.StatusBadRequest},
+		{"unknown deployment", "ccc33333", `{"percent":10}`, deployer, http.StatusNotFound},
+		{"active deployment", "aaa11111", `{"percent":10}`, deployer, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := canarySite(t)
+			rec := httptest.NewRecorder()
+			NewCanaryHandler(store, newMockManager(), nil).ServeHTTP(rec, canaryRequest(tt.id, tt.body, tt.caps))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if _, ok := store.ReadCanary("docs"); ok {
+				t.Error("rejected canary was stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// configFiles are read from the root of an upload at deploy time and not
+// stored with the deployment's content.
+var configFiles = []string{"_redirects", "_headers", "tspages.toml"}
+
+// CompareResponse is the JSON response of POST /deploy/{site}/{id}/compare.
+type CompareResponse struct {
+	Site         string `json:"site"`
+	DeploymentID string `json:"deployment_id"`
+	// Match is set if the upload has exactly the deployment's files, with
+	// the same content.
+	Match bool `json:"match"`
+	// Files is the number of files in the deployment, and Matching how
+	// many of them the upload has with the same content.
+	Files    int `json:"files"`
+	Matching int `json:"matching"`
+	// Missing lists files of the deployment the upload lacks, Extra files
+	// of the upload the deployment lacks, and Different files whose content
+	// differs.
+	Missing   []string `json:"missing"`
+	Extra     []string `json:"extra"`
+	Different []string `json:"different"`
+	// Minified is set if the deployment was minified, so the upload was
+	// minified the same way before comparing.
+	Minified bool `json:"minified,omitempty"`
+}
+
+// CompareHandler handles POST /deploy/{site}/{id}/compare. It extracts an
+// upload like h does for a deployment and compares its files to the
+// stored deployment's by hash, to check that a site serves what CI built.
+type CompareHandler struct {
+	*Handler
+}
+
+// NewCompareHandler returns a handler that extracts uploads with h's
+// limits.
+func NewCompareHandler(h *Handler) *CompareHandler {
+	return &CompareHandler{Handler: h}
+}
+
+func (h *CompareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !storage.ValidDeploymentID(id) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
+		return
+	}
+	if !auth.CanDeploy(auth.CapsFromContext(r.Context()), site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.store.DeploymentComplete(site, id) {
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found or incomplete")
+		return
+	}
+	stored, err := h.store.ListDeploymentFiles(site, id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing deployment files", "site", site, "id", id, "err", err)
+		problem.Error(w, "listing deployment files", http.StatusInternalServerError)
+		return
+	}
+
+	maxBytes := int64(h.maxUploadMB) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			problem.Write(w, http.StatusRequestEntityTooLarge, problem.UploadTooLarge, "upload too large")
+		} else {
+			problem.Error(w, "reading upload", http.StatusBadRequest)
+		}
+		return
+	}
+	if len(body) == 0 {
+		problem.Write(w, http.StatusBadRequest, problem.EmptyUpload, "empty upload")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "tspages-compare-")
+	if err != nil {
+		problem.Error(w, "creating temporary directory", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+	req := ExtractRequest{
+		Body:               body,
+		Query:              r.URL.Query().Get("format"),
+		ContentType:        r.Header.Get("Content-Type"),
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		Filename:           r.URL.Query().Get("filename"),
+		Symlinks:           h.symlinks,
+	}
+	if _, err := Extract(req, dir, maxBytes); err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidUpload, fmt.Sprintf("extracting upload: %v", err))
+		return
+	}
+	for _, name := range configFiles {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			problem.Error(w, "removing config files", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := CompareResponse{Site: site, DeploymentID: id, Files: len(stored)}
+	for _, f := range stored {
+		if f.OriginalSize > 0 {
+			resp.Minified = true
+			break
+		}
+	}
+	if resp.Minified {
+		if _, err := MinifyDir(dir); err != nil {
+			problem.Error(w, "minifying upload", http.StatusInternalServerError)
+			return
+		}
+	}
+	uploaded, err := storage.IndexDir(dir)
+	if err != nil {
+		problem.Error(w, "hashing upload", http.StatusInternalServerError)
+		return
+	}
+
+	extra, missing, different := storage.DiffFiles(uploaded, stored)
+	resp.Extra = nonNil(extra)
+	resp.Missing = nonNil(missing)
+	resp.Different = nonNil(different)
+	resp.Matching = len(stored) - len(missing) - len(different)
+	resp.Match = len(extra) == 0 && len(missing) == 0 && len(different) == 0
+	writeJSON(w, resp)
+}
+
+// nonNil returns paths, or an empty list if it is nil, so it is encoded as
+// [] rather than null.
+func nonNil(paths []string) []string {
+	if paths == nil {
+		return []string{}
+	}
+	return paths
+}
@@ -0,0 +1,104 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// deployZip deploys files to the site docs through h and returns the new
+// deployment's ID.
+func deployZip(t *testing.T, h *Handler, files map[string]string) string {
+	t.Helper()
+	req := httptest.NewRequest("PUT", "/deploy/docs", bytes.NewReader(makeZip(t, files)))
+	req = withCaps(req, adminCaps)
+	req.SetPathValue("site", "docs")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deploy status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return resp.DeploymentID
+}
+
+func compare(t *testing.T, h *CompareHandler, id string, body []byte, caps []auth.Cap) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/deploy/docs/"+id+"/compare", bytes.NewReader(body))
+	req = withCaps(req, caps)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompareHandler(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 1, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+	files := map[string]string{
+		"index.html":   "<h1>Docs</h1>",
+		"guide.html":   "<h1>Guide</h1>",
+		"tspages.toml": "spa_routing = false\n",
+	}
+	id := deployZip(t, h, files)
+	ch := NewCompareHandler(h)
+
+	rec := compare(t, ch, id, makeZip(t, files), adminCaps)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var got CompareResponse
+	json.NewDecoder(rec.Body).Decode(&got)
+	if !got.Match || got.Files != 2 || got.Matching != 2 {
+		t.Errorf("identical upload: %+v", got)
+	}
+
+	rec = compare(t, ch, id, makeZip(t, map[string]string{
+		"index.html": "<h1>Tampered</h1>",
+		"extra.js":   "alert(1)",
+	}), adminCaps)
+	got = CompareResponse{}
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.Match || got.Matching != 0 ||
+		!slices.Equal(got.Different, []string{"index.html"}) ||
+		!slices.Equal(got.Missing, []string{"guide.html"}) ||
+		!slices.Equal(got.Extra, []string{"extra.js"}) {
+		t.Errorf("differing upload: %+v", got)
+	}
+}
+
+func TestCompareHandler_Errors(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 1, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+	id := deployZip(t, h, map[string]string{"index.html": "<h1>Docs</h1>"})
+	ch := NewCompareHandler(h)
+	zip := makeZip(t, map[string]string{"index.html": "<h1>Docs</h1>"})
+
+	tests := []struct {
+		name string
+		id   string
+		body []byte
+		caps []auth.Cap
+		want int
+	}{
+		{"view only", id, zip, []auth.Cap{{Access: "view"}}, http.StatusForbidden},
+		{"unknown deployment", "fff99999", zip, adminCaps, http.StatusNotFound},
+		{"empty upload", id, nil, adminCaps, http.StatusBadRequest},
+		{"too large", id, make([]byte, 2<<20), adminCaps, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := compare(t, ch, tt.id, tt.body, tt.caps); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"mime"
 	"os"
 	"path/filepath"
@@ -18,6 +19,8 @@ import (
 	"github.com/ulikunitz/xz"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
+
+	"tspages/internal/storage"
 )
 
 // safePath validates an archive entry name against path traversal and returns
@@ -55,6 +58,7 @@ type ExtractRequest struct {
 	ContentType        string
 	ContentDisposition string
 	Filename           string // from URL path, e.g. PUT /deploy/{site}/{filename}
+	Symlinks           string // storage.SymlinksDeny (default) or storage.SymlinksIntra
 }
 
 // Extract detects the upload format and extracts/writes content into destDir.
@@ -67,19 +71,35 @@ func Extract(req ExtractRequest, destDir string, maxBytes int64) (int64, error)
 		return 0, fmt.Errorf("empty upload")
 	}
 
-	// Archive detection by magic bytes.
+	// Archive detection by magic bytes. Symlinks are collected while
+	// extracting and created last, so no file is written through one.
+	var links *[]storage.Symlink
+	if req.Symlinks == storage.SymlinksIntra {
+		links = new([]storage.Symlink)
+	}
+	var n int64
+	var err error
 	switch {
 	case isZip(body):
-		return ExtractZip(bytes.NewReader(body), int64(len(body)), destDir, maxBytes)
+		n, err = extractZip(bytes.NewReader(body), int64(len(body)), destDir, maxBytes, links)
 	case isGzip(body):
-		return extractGzip(body, destDir, maxBytes)
+		n, err = extractGzip(body, destDir, maxBytes, links)
 	case isXz(body):
-		return extractXz(body, destDir, maxBytes)
+		n, err = extractXz(body, destDir, maxBytes, links)
 	case isTar(body):
-		return extractTar(bytes.NewReader(body), destDir, maxBytes)
+		n, err = extractTar(bytes.NewReader(body), destDir, maxBytes, links)
+	default:
+		return extractText(req, destDir)
+	}
+	if err == nil && links != nil {
+		err = storage.CreateSymlinks(destDir, *links)
 	}
+	return n, err
+}
 
-	// Non-archive: determine text format.
+// extractText writes a non-archive upload as a single page.
+func extractText(req ExtractRequest, destDir string) (int64, error) {
+	body := req.Body
 	if isMarkdown(req) {
 		return writeMarkdown(body, destDir)
 	}
@@ -146,7 +166,7 @@ func mediaType(ct string) string {
 
 // Archive extractors.
 
-func extractGzip(body []byte, destDir string, maxBytes int64) (int64, error) {
+func extractGzip(body []byte, destDir string, maxBytes int64, links *[]storage.Symlink) (int64, error) {
 	gr, err := gzip.NewReader(bytes.NewReader(body))
 	if err != nil {
 		return 0, fmt.Errorf("reading gzip: %w", err)
@@ -164,27 +184,29 @@ func extractGzip(body []byte, destDir string, maxBytes int64) (int64, error) {
 
 	// Check if inner content is a tar archive.
 	if isTar(inner) {
-		return extractTar(bytes.NewReader(inner), destDir, maxBytes)
+		return extractTar(bytes.NewReader(inner), destDir, maxBytes, links)
 	}
 
 	// Single compressed file.
 	return writeSingleFile(inner, destDir, "index.html")
 }
 
-func extractXz(body []byte, destDir string, maxBytes int64) (int64, error) {
+func extractXz(body []byte, destDir string, maxBytes int64, links *[]storage.Symlink) (int64, error) {
 	inner, err := decompressXz(bytes.NewReader(body), maxBytes)
 	if err != nil {
 		return 0, err
 	}
 
 	if isTar(inner) {
-		return extractTar(bytes.NewReader(inner), destDir, maxBytes)
+		return extractTar(bytes.NewReader(inner), destDir, maxBytes, links)
 	}
 
 	return writeSingleFile(inner, destDir, "index.html")
 }
 
-func extractTar(r io.Reader, destDir string, maxBytes int64) (int64, error) {
+// extractTar extracts a tar archive into destDir. Symlinks are appended to
+// links for the caller to create, or rejected if links is nil.
+func extractTar(r io.Reader, destDir string, maxBytes int64, links *[]storage.Symlink) (int64, error) {
 	tr := tar.NewReader(r)
 	var totalWritten int64
 
@@ -203,9 +225,14 @@ func extractTar(r io.Reader, destDir string, maxBytes int64) (int64, error) {
 		}
 
 		switch hdr.Typeflag {
-		case tar.TypeSymlink, tar.TypeLink:
-			// Symlinks and hardlinks are rejected — they could escape the
-			// deployment directory or be used for write-through attacks.
+		case tar.TypeSymlink:
+			if links == nil {
+				// Symlinks could escape the deployment directory or be used
+				// for write-through attacks unless the policy allows them.
+				return totalWritten, fmt.Errorf("unsupported tar entry type (symlink/hardlink): %q", hdr.Name)
+			}
+			*links = append(*links, storage.Symlink{Name: hdr.Name, Target: hdr.Linkname})
+		case tar.TypeLink:
 			return totalWritten, fmt.Errorf("unsupported tar entry type (symlink/hardlink): %q", hdr.Name)
 		case tar.TypeDir:
 			if err := os.MkdirAll(dest, 0755); err != nil {
@@ -281,6 +308,12 @@ func looksLikeHTML(b []byte) bool {
 // --- ZIP (unchanged) ---
 
 func ExtractZip(r io.ReaderAt, size int64, destDir string, maxBytes int64) (int64, error) {
+	return extractZip(r, size, destDir, maxBytes, nil)
+}
+
+// extractZip extracts a ZIP archive into destDir. Symlinks are appended to
+// links for the caller to create, or rejected if links is nil.
+func extractZip(r io.ReaderAt, size int64, destDir string, maxBytes int64, links *[]storage.Symlink) (int64, error) {
 	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return 0, fmt.Errorf("reading zip: %w", err)
@@ -300,6 +333,18 @@ func ExtractZip(r io.ReaderAt, size int64, destDir string, maxBytes int64) (int6
 			continue
 		}
 
+		if f.Mode()&fs.ModeSymlink != 0 {
+			if links == nil {
+				return totalWritten, fmt.Errorf("unsupported zip entry type (symlink): %q", f.Name)
+			}
+			target, err := readZipLink(f)
+			if err != nil {
+				return totalWritten, err
+			}
+			*links = append(*links, storage.Symlink{Name: f.Name, Target: target})
+			continue
+		}
+
 		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
 			return totalWritten, err
 		}
@@ -330,6 +375,21 @@ func ExtractZip(r io.ReaderAt, size int64, destDir string, maxBytes int64) (int6
 	return totalWritten, nil
 }
 
+// readZipLink returns the target of a symlink entry, which ZIP stores as
+// the entry's content.
+func readZipLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
 func decompressXz(r io.Reader, maxBytes int64) ([]byte, error) {
 	xr, err := xz.NewReader(r)
 	if err != nil {
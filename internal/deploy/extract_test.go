@@ -11,6 +11,8 @@ import (
 	"github.com/ulikunitz/xz"
 	"path/filepath"
 	"testing"
+
+	"tspages/internal/storage"
 )
 
 func makeZip(t *testing.T, files map[string]string) []byte {
@@ -233,6 +235,95 @@ func TestExtract_Tar_RejectsHardlink(t *testing.T) {
 	}
 }
 
+// makeTarWithLinks builds a tar archive holding index.html, assets/app.js,
+// and the given symlinks.
+func makeTarWithLinks(t *testing.T, links map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range map[string]string{"index.html": "<h1>Hi</h1>", "assets/app.js": "app()"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	for name, target := range links {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target})
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestExtract_Tar_IntraSymlinks(t *testing.T) {
+	body := makeTarWithLinks(t, map[string]string{
+		"latest.html":    "index.html",
+		"static":         "assets",
+		"docs/home.html": "../index.html",
+	})
+	dir := t.TempDir()
+	if _, err := Extract(ExtractRequest{Body: body, Symlinks: storage.SymlinksIntra}, dir, 10<<20); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "latest.html")); got != "<h1>Hi</h1>" {
+		t.Errorf("latest.html = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "static", "app.js")); got != "app()" {
+		t.Errorf("static/app.js = %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "docs", "home.html")); got != "<h1>Hi</h1>" {
+		t.Errorf("docs/home.html = %q", got)
+	}
+
+	// The default policy still rejects them.
+	if _, err := Extract(ExtractRequest{Body: body}, t.TempDir(), 10<<20); err == nil {
+		t.Error("expected symlinks to be rejected by default")
+	}
+}
+
+func TestExtract_Tar_IntraSymlinksRejectEscapes(t *testing.T) {
+	for name, links := range map[string]map[string]string{
+		"absolute":  {"evil": "/etc/passwd"},
+		"parent":    {"evil": "../outside"},
+		"nested":    {"docs/evil": "../../outside"},
+		"dangling":  {"evil": "missing.html"},
+		"via link":  {"root": ".", "evil": "root/../outside"},
+		"into link": {"static": "assets", "static/evil": "app.js"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "content")
+			os.Mkdir(dir, 0755)
+			_, err := Extract(ExtractRequest{Body: makeTarWithLinks(t, links), Symlinks: storage.SymlinksIntra}, dir, 10<<20)
+			if err == nil {
+				t.Fatal("expected symlink to be rejected")
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "..", "outside")); err == nil {
+				t.Error("wrote outside the content directory")
+			}
+		})
+	}
+}
+
+func TestExtract_Zip_Symlinks(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("index.html")
+	f.Write([]byte("<h1>Hi</h1>"))
+	hdr := &zip.FileHeader{Name: "latest.html"}
+	hdr.SetMode(os.ModeSymlink | 0777)
+	f, _ = w.CreateHeader(hdr)
+	f.Write([]byte("index.html"))
+	w.Close()
+
+	if _, err := Extract(ExtractRequest{Body: buf.Bytes()}, t.TempDir(), 10<<20); err == nil {
+		t.Error("expected zip symlink to be rejected by default")
+	}
+	dir := t.TempDir()
+	if _, err := Extract(ExtractRequest{Body: buf.Bytes(), Symlinks: storage.SymlinksIntra}, dir, 10<<20); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "latest.html")); err != nil || target != "index.html" {
+		t.Errorf("latest.html links to %q, %v", target, err)
+	}
+}
+
 func TestExtract_Markdown_QueryParam(t *testing.T) {
 	dir := t.TempDir()
 	body := []byte("# Hello\n\nWorld")
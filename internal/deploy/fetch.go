@@ -0,0 +1,179 @@
+package deploy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// fetchTimeout bounds how long downloading an artifact may take.
+const fetchTimeout = 5 * time.Minute
+
+// FetchRequest is the JSON body of POST /deploy/{site}/fetch.
+type FetchRequest struct {
+	URL string `json:"url"`
+	// SHA256, if set, is the hex-encoded digest the artifact must have.
+	SHA256 string `json:"sha256,omitempty"`
+	// ETag, if set, must match the ETag the artifact is served with.
+	ETag string `json:"etag,omitempty"`
+	// Commit, Branch, and BuildURL describe the CI build the artifact came
+	// from, like the X-TSPages-* headers, which they take precedence over.
+	Commit   string `json:"commit,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	BuildURL string `json:"build_url,omitempty"`
+}
+
+// FetchHandler deploys an artifact the server downloads itself, for CI
+// systems that already publish build output to an artifact store. Only
+// hosts on the allow-list are contacted, including across redirects.
+type FetchHandler struct {
+	*Handler
+	hosts  []string
+	client *http.Client
+}
+
+// NewFetchHandler returns a handler deploying through h from the given
+// hosts. An entry "*.example.com" allows every subdomain of example.com.
+// With no hosts, every fetch is rejected.
+func NewFetchHandler(h *Handler, hosts []string) *FetchHandler {
+	fh := &FetchHandler{Handler: h, hosts: hosts}
+	fh.client = &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !fh.allowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return fh
+}
+
+// allowed reports whether u may be fetched.
+func (h *FetchHandler) allowed(u *url.URL) bool {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range h.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *FetchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req FetchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8192)).Decode(&req); err != nil {
+		problem.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" {
+		problem.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	if !h.allowed(u) {
+		problem.Write(w, http.StatusForbidden, problem.HostNotAllowed, fmt.Sprintf("fetching from %s is not allowed", u.Host))
+		return
+	}
+
+	maxBytes := int64(h.maxUploadMB) << 20
+	fetchReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		problem.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.client.Do(fetchReq)
+	if err != nil {
+		problem.Write(w, http.StatusBadGateway, problem.FetchFailed, fmt.Sprintf("fetching artifact: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		problem.Write(w, http.StatusBadGateway, problem.FetchFailed, fmt.Sprintf("fetching artifact: %s", resp.Status))
+		return
+	}
+	if req.ETag != "" && trimETag(resp.Header.Get("ETag")) != trimETag(req.ETag) {
+		problem.Write(w, http.StatusPreconditionFailed, problem.ChecksumMismatch,
+			fmt.Sprintf("artifact etag is %s, want %s", resp.Header.Get("ETag"), req.ETag))
+		return
+	}
+	if resp.ContentLength > maxBytes {
+		problem.Write(w, http.StatusRequestEntityTooLarge, problem.UploadTooLarge, "artifact too large")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		problem.Write(w, http.StatusBadGateway, problem.FetchFailed, fmt.Sprintf("reading artifact: %v", err))
+		return
+	}
+	if int64(len(body)) > maxBytes {
+		problem.Write(w, http.StatusRequestEntityTooLarge, problem.UploadTooLarge, "artifact too large")
+		return
+	}
+	if req.SHA256 != "" {
+		sum := sha256.Sum256(body)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, req.SHA256) {
+			problem.Write(w, http.StatusBadRequest, problem.ChecksumMismatch,
+				fmt.Sprintf("artifact sha256 is %s, want %s", got, req.SHA256))
+			return
+		}
+	}
+
+	// Keep credentials and signed query strings out of logs and manifests.
+	source := *u
+	source.User, source.RawQuery, source.Fragment = nil, "", ""
+	h.deploy(w, r, site, ExtractRequest{
+		Body:               body,
+		Query:              r.URL.Query().Get("format"),
+		ContentType:        resp.Header.Get("Content-Type"),
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+		Filename:           path.Base(resp.Request.URL.Path),
+	}, source.String(), req.buildInfo(r.Header))
+}
+
+// buildInfo returns the build metadata of req, falling back to the
+// X-TSPages-* headers in h for fields it leaves empty.
+func (req FetchRequest) buildInfo(h http.Header) storage.BuildInfo {
+	build := buildInfoFromHeader(h)
+	if req.Commit != "" {
+		build.Commit = req.Commit
+	}
+	if req.Branch != "" {
+		build.Branch = req.Branch
+	}
+	if req.BuildURL != "" {
+		build.BuildURL = req.BuildURL
+	}
+	return build
+}
+
+// trimETag strips the weak validator prefix and quotes from an ETag.
+func trimETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
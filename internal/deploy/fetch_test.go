@@ -0,0 +1,166 @@
+package deploy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// artifactServer serves a zipped site at /site.zip with an ETag, and
+// redirects /elsewhere to a host that is not allowed.
+func artifactServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	artifact := makeZip(t, map[string]string{"index.html": "<h1>Fetched</h1>"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/site.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write(artifact)
+		case "/elsewhere":
+			http.Redirect(w, r, "http://artifacts.invalid/site.zip", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, artifact
+}
+
+func fetchRequest(t *testing.T, body FetchRequest) *http.Request {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/deploy/docs/fetch", strings.NewReader(string(data)))
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+	return req
+}
+
+func newTestFetchHandler(t *testing.T, store *storage.Store, hosts ...string) *FetchHandler {
+	t.Helper()
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 1, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+	return NewFetchHandler(h, hosts)
+}
+
+func TestFetchHandler_Success(t *testing.T) {
+	srv, artifact := artifactServer(t)
+	store := storage.New(t.TempDir())
+	h := newTestFetchHandler(t, store, "127.0.0.1")
+
+	sum := sha256.Sum256(artifact)
+	rec := httptest.NewRecorder()
+	req := fetchRequest(t, FetchRequest{
+		URL:    srv.URL + "/site.zip?token=secret",
+		SHA256: hex.EncodeToString(sum[:]),
+		ETag:   "v1",
+		Commit: "4f2a9c1e0b7d",
+	})
+	req.Header.Set(HeaderCommit, "ignored")
+	req.Header.Set(HeaderBranch, "main")
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	content, err := os.ReadFile(filepath.Join(store.ContentDir("docs", resp.DeploymentID), "index.html"))
+	if err != nil || string(content) != "<h1>Fetched</h1>" {
+		t.Errorf("index.html = %q, %v", content, err)
+	}
+	m, err := store.ReadManifest("docs", resp.DeploymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SourceURL != srv.URL+"/site.zip" {
+		t.Errorf("source_url = %q, want the URL without its query", m.SourceURL)
+	}
+	if m.Build == nil || *m.Build != (storage.BuildInfo{Commit: "4f2a9c1e0b7d", Branch: "main"}) {
+		t.Errorf("build = %+v, want the body's commit and the header's branch", m.Build)
+	}
+}
+
+func TestFetchHandler_Rejections(t *testing.T) {
+	srv, _ := artifactServer(t)
+	tests := []struct {
+		name   string
+		hosts  []string
+		req    FetchRequest
+		status int
+		code   problem.Code
+	}{
+		{"disabled", nil, FetchRequest{URL: srv.URL + "/site.zip"}, http.StatusForbidden, problem.HostNotAllowed},
+		{"other host", []string{"artifacts.example.com"}, FetchRequest{URL: srv.URL + "/site.zip"}, http.StatusForbidden, problem.HostNotAllowed},
+		{"not http", []string{"127.0.0.1"}, FetchRequest{URL: "file://127.0.0.1/etc/passwd"}, http.StatusForbidden, problem.HostNotAllowed},
+		{"relative", []string{"127.0.0.1"}, FetchRequest{URL: "/site.zip"}, http.StatusBadRequest, problem.BadRequest},
+		{"redirect", []string{"127.0.0.1"}, FetchRequest{URL: srv.URL + "/elsewhere"}, http.StatusBadGateway, problem.FetchFailed},
+		{"missing", []string{"127.0.0.1"}, FetchRequest{URL: srv.URL + "/gone.zip"}, http.StatusBadGateway, problem.FetchFailed},
+		{"checksum", []string{"127.0.0.1"}, FetchRequest{URL: srv.URL + "/site.zip", SHA256: strings.Repeat("0", 64)}, http.StatusBadRequest, problem.ChecksumMismatch},
+		{"etag", []string{"127.0.0.1"}, FetchRequest{URL: srv.URL + "/site.zip", ETag: "v2"}, http.StatusPreconditionFailed, problem.ChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.New(t.TempDir())
+			h := newTestFetchHandler(t, store, tt.hosts...)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, fetchRequest(t, tt.req))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.status, rec.Body.String())
+			}
+			var p problem.Details
+			json.NewDecoder(rec.Body).Decode(&p)
+			if p.Code != tt.code {
+				t.Errorf("code = %q, want %q", p.Code, tt.code)
+			}
+			if deployments, _ := store.ListDeployments("docs"); len(deployments) != 0 {
+				t.Errorf("created %d deployments, want none", len(deployments))
+			}
+		})
+	}
+}
+
+func TestFetchHandler_TooLarge(t *testing.T) {
+	big := make([]byte, 2<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(big)
+	}))
+	defer srv.Close()
+
+	h := newTestFetchHandler(t, storage.New(t.TempDir()), "127.0.0.1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, fetchRequest(t, FetchRequest{URL: srv.URL + "/big.zip"}))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+}
+
+func TestFetchHandler_Allowed(t *testing.T) {
+	h := NewFetchHandler(nil, []string{"artifacts.example.com", "*.ci.example.com"})
+	for raw, want := range map[string]bool{
+		"https://artifacts.example.com/a.zip":     true,
+		"http://ARTIFACTS.example.com:8080/a.zip": true,
+		"https://build.ci.example.com/a.zip":      true,
+		"https://ci.example.com/a.zip":            false,
+		"https://evil-ci.example.com/a.zip":       false,
+		"https://artifacts.example.com.evil/a":    false,
+		"ftp://artifacts.example.com/a.zip":       false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := h.allowed(u); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package deploy
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,12 +10,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
 	"tspages/internal/metrics"
+	"tspages/internal/problem"
+	"tspages/internal/serve"
 	"tspages/internal/storage"
-	"tspages/internal/webhook"
 )
 
 // SiteManager manages per-site tsnet server lifecycle.
@@ -23,10 +28,55 @@ type SiteManager interface {
 	StopServer(site string) error
 }
 
+// Headers a deploy request names the CI build it comes from with, so the
+// deployment links back to the commit and run.
+const (
+	HeaderCommit   = "X-TSPages-Commit"
+	HeaderBranch   = "X-TSPages-Branch"
+	HeaderBuildURL = "X-TSPages-Build-URL"
+)
+
+// Stages a deployment can fail in, as named by deploy.failed events and the
+// failed_stage of failed deployments.
+const (
+	StageExtract  = "extract"
+	StageConfig   = "config"
+	StageValidate = "validate"
+	StageMinify   = "minify"
+	// StageBundle is the stage of a deployment rolled back because
+	// another site of its bundle failed.
+	StageBundle = "bundle"
+)
+
+// buildInfoFromHeader returns the build metadata in h.
+func buildInfoFromHeader(h http.Header) storage.BuildInfo {
+	return storage.BuildInfo{
+		Commit:   strings.TrimSpace(h.Get(HeaderCommit)),
+		Branch:   strings.TrimSpace(h.Get(HeaderBranch)),
+		BuildURL: strings.TrimSpace(h.Get(HeaderBuildURL)),
+	}
+}
+
+// DeployResponse reports a completed deployment.
 type DeployResponse struct {
 	DeploymentID string `json:"deployment_id"`
 	Site         string `json:"site"`
 	URL          string `json:"url"`
+	Activated    bool   `json:"activated"`
+	Files        int    `json:"files"`
+	SizeBytes    int64  `json:"size_bytes"`
+	// Diff is nil for a site's first deployment.
+	Diff     *DeployDiff  `json:"diff,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Timing   DeployTiming `json:"timing"`
+}
+
+// UploadRejectedResponse is the problem sent for an upload that breaks its
+// validation rules.
+type UploadRejectedResponse struct {
+	problem.Details
+	Violations      []storage.Violation `json:"violations"`
+	TotalViolations int                 `json:"total_violations"`
 }
 
 type Handler struct {
@@ -34,8 +84,10 @@ type Handler struct {
 	manager        SiteManager
 	maxUploadMB    int
 	maxDeployments int
+	precompress    int
+	symlinks       string
 	dnsSuffix      string
-	notifier       *webhook.Notifier
+	events         *events.Bus
 	defaults       storage.SiteConfig
 }
 
@@ -46,8 +98,16 @@ type HandlerConfig struct {
 	MaxUploadMB    int
 	MaxDeployments int
 	DNSSuffix      string
-	Notifier       *webhook.Notifier
+	Events         *events.Bus
 	Defaults       storage.SiteConfig
+
+	// PrecompressLevel, if positive, writes .br and .gz variants of
+	// compressible files at this level before a deployment is completed.
+	PrecompressLevel int
+
+	// Symlinks is the symlink policy for uploads, storage.SymlinksDeny
+	// (the default) or storage.SymlinksIntra.
+	Symlinks string
 }
 
 func NewHandler(cfg HandlerConfig) *Handler {
@@ -56,22 +116,17 @@ func NewHandler(cfg HandlerConfig) *Handler {
 		manager:        cfg.Manager,
 		maxUploadMB:    cfg.MaxUploadMB,
 		maxDeployments: cfg.MaxDeployments,
+		precompress:    cfg.PrecompressLevel,
+		symlinks:       cfg.Symlinks,
 		dnsSuffix:      cfg.DNSSuffix,
-		notifier:       cfg.Notifier,
+		events:         cfg.Events,
 		defaults:       cfg.Defaults,
 	}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	site := r.PathValue("site")
-	if !storage.ValidSiteNameForSuffix(site, h.dnsSuffix) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
-		return
-	}
-
-	caps := auth.CapsFromContext(r.Context())
-	if !auth.CanDeploy(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	site, ok := h.authorize(w, r)
+	if !ok {
 		return
 	}
 
@@ -81,18 +136,184 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		var maxErr *http.MaxBytesError
 		if errors.As(err, &maxErr) {
-			http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+			problem.Write(w, http.StatusRequestEntityTooLarge, problem.UploadTooLarge, "upload too large")
 		} else {
-			http.Error(w, "reading upload", http.StatusBadRequest)
+			problem.Error(w, "reading upload", http.StatusBadRequest)
 		}
 		return
 	}
 
+	h.deploy(w, r, site, ExtractRequest{
+		Body:               body,
+		Query:              r.URL.Query().Get("format"),
+		ContentType:        r.Header.Get("Content-Type"),
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		Filename:           r.PathValue("filename"),
+	}, "", buildInfoFromHeader(r.Header))
+}
+
+// authorize returns the site r deploys to, or responds with an error if
+// the caller may not deploy it. Archived sites, and sites whose pinned
+// deployment the upload would replace, are rejected before the upload is
+// read; CreateDeployment and ActivateDeployment check again.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	site := r.PathValue("site")
+	if !storage.ValidSiteNameForSuffix(site, h.dnsSuffix) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return "", false
+	}
+	if !auth.CanDeploy(auth.CapsFromContext(r.Context()), site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+	if h.store.SiteArchived(site) {
+		problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
+		return "", false
+	}
+	if h.activationPinned(r, site) {
+		problem.Write(w, http.StatusConflict, problem.DeploymentPinned, "site has a pinned deployment; deploy with activate=false")
+		return "", false
+	}
+	return site, true
+}
+
+// activationPinned reports whether r would activate a deployment of site
+// while the site has a pinned one.
+func (h *Handler) activationPinned(r *http.Request, site string) bool {
+	return r.URL.Query().Get("activate") != "false" && len(h.store.PinnedDeployments(site)) > 0
+}
+
+// deploy creates a deployment of site from an upload, which was received
+// in r or, if sourceURL is set, fetched from there, and was built by build.
+// It responds to r.
+func (h *Handler) deploy(w http.ResponseWriter, r *http.Request, site string, extractReq ExtractRequest, sourceURL string, build storage.BuildInfo) {
+	body := extractReq.Body
+	maxBytes := int64(h.maxUploadMB) << 20
 	if len(body) == 0 {
-		http.Error(w, "empty upload", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.EmptyUpload, "empty upload")
+		return
+	}
+
+	extractReq.Symlinks = h.symlinks
+	src := deploySource{
+		sourceURL: sourceURL,
+		build:     build,
+		extract: func(contentDir string) (int64, error) {
+			return Extract(extractReq, contentDir, maxBytes)
+		},
+	}
+	if sourceURL != "" {
+		src.logMsg = "artifact fetched"
+		src.logArgs = []any{"url", sourceURL, "bytes", len(body), "content_type", extractReq.ContentType}
+	} else {
+		src.logMsg = "upload received"
+		src.logArgs = []any{"bytes", len(body), "content_type", extractReq.ContentType}
+	}
+
+	d, derr := h.prepare(r, site, src)
+	if derr == nil {
+		derr = h.complete(r, d)
+	}
+	if derr != nil {
+		derr.write(w)
 		return
 	}
+	writeJSON(w, d.response(h.dnsSuffix, h.defaults))
+	h.publish(r, d)
+}
+
+// deploySource fills the content directory of a new deployment.
+type deploySource struct {
+	// extract writes the deployment's files to contentDir and returns
+	// their total size.
+	extract func(contentDir string) (int64, error)
+	// sourceURL is the URL the files were fetched from, if any.
+	sourceURL string
+	// build is the CI build the files came from, if the request named one.
+	build storage.BuildInfo
+	// logMsg and logArgs describe the source in the deployment's log.
+	logMsg  string
+	logArgs []any
+}
+
+// pendingDeployment is a deployment being created by prepare and complete.
+type pendingDeployment struct {
+	site, id   string
+	deployDir  string
+	deployedBy string
+	requestID  string
+	build      storage.BuildInfo
+	size       int64
+	cfg        storage.SiteConfig
+	log        *deployLog
+	files      []storage.FileInfo
+	warnings   []string
+	started    time.Time
+	timing     DeployTiming
 
+	// fail marks the deployment as failed in stage for reason, saves its
+	// log, and publishes the failure, which err caused.
+	fail func(stage, reason string, err error)
+
+	// Set by complete.
+	previous    string
+	activated   bool
+	cleaned     int
+	diff        *DeployDiff
+	fileDiff    *FileDiff
+	commitRange *storage.CommitRange
+}
+
+// response describes the deployment; defaults are merged into its config to
+// name the site's hostname.
+func (d *pendingDeployment) response(dnsSuffix string, defaults storage.SiteConfig) DeployResponse {
+	return DeployResponse{
+		DeploymentID: d.id,
+		Site:         d.site,
+		URL:          fmt.Sprintf("https://%s.%s/", d.cfg.Merge(defaults).Hostname(d.site), dnsSuffix),
+		Activated:    d.activated,
+		Files:        len(d.files),
+		SizeBytes:    d.size,
+		Diff:         d.diff,
+		Warnings:     d.warnings,
+		Timing:       d.timing,
+	}
+}
+
+// deployError is the response to a deployment that could not be created.
+type deployError struct {
+	status int
+	code   problem.Code // generic code for status if empty
+	detail string
+	rules  *storage.UploadRulesError
+}
+
+func (e *deployError) Error() string { return e.detail }
+
+func (e *deployError) write(w http.ResponseWriter) {
+	switch {
+	case e.rules != nil:
+		problem.Send(w, e.status, UploadRejectedResponse{
+			Details:         problem.New(e.status, problem.UploadRejected, e.detail),
+			Violations:      e.rules.Violations,
+			TotalViolations: e.rules.Total,
+		})
+	case e.code == "":
+		problem.Error(w, e.detail, e.status)
+	default:
+		problem.Write(w, e.status, e.code, e.detail)
+	}
+}
+
+// prepare creates a deployment of site from src, up to the point where it
+// can be completed. A deployment that fails after its files were written
+// is kept and marked as failed.
+func (h *Handler) prepare(r *http.Request, site string, src deploySource) (*pendingDeployment, *deployError) {
+	if err := src.build.Validate(); err != nil {
+		return nil, &deployError{status: http.StatusBadRequest, detail: fmt.Sprintf("invalid build metadata: %v", err)}
+	}
+	started := time.Now()
+	var timing DeployTiming
 	var id, deployDir string
 	for range 10 {
 		id = storage.NewDeploymentID()
@@ -101,21 +322,28 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			break
 		}
+		if errors.Is(err, storage.ErrSiteArchived) {
+			return nil, &deployError{status: http.StatusConflict, code: problem.SiteArchived, detail: "site is archived"}
+		}
 		if !errors.Is(err, storage.ErrDeploymentExists) {
-			http.Error(w, "creating deployment", http.StatusInternalServerError)
-			return
+			return nil, &deployError{status: http.StatusInternalServerError, detail: "creating deployment"}
 		}
 	}
 	if deployDir == "" {
-		http.Error(w, "creating deployment: too many ID collisions", http.StatusInternalServerError)
-		return
+		return nil, &deployError{status: http.StatusInternalServerError, detail: "creating deployment: too many ID collisions"}
+	}
+
+	requestID := httplog.RequestID(r.Context())
+	dlog := newDeployLog(r.Context(), site, id)
+	dlog.info(src.logMsg, append(src.logArgs, "request_id", requestID)...)
+	if !src.build.IsZero() {
+		dlog.info("build metadata", "commit", src.build.Commit, "branch", src.build.Branch, "build_url", src.build.BuildURL)
 	}
 
 	contentDir := filepath.Join(deployDir, "content")
 	if err := os.MkdirAll(contentDir, 0755); err != nil {
 		os.RemoveAll(deployDir)
-		http.Error(w, "creating content dir", http.StatusInternalServerError)
-		return
+		return nil, &deployError{status: http.StatusInternalServerError, detail: "creating content dir"}
 	}
 
 	// Build identity and manifest early so failed deployments have metadata.
@@ -124,73 +352,88 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if deployedBy == "" {
 		deployedBy = identity.LoginName
 	}
+	var failedStage string
 	writeManifest := func(size int64) error {
-		return h.store.WriteManifest(site, id, storage.Manifest{
+		m := storage.Manifest{
 			Site:            site,
 			ID:              id,
 			CreatedAt:       time.Now(),
 			CreatedBy:       deployedBy,
 			CreatedByAvatar: identity.ProfilePicURL,
 			SizeBytes:       size,
-		})
+			RequestID:       requestID,
+			SourceURL:       src.sourceURL,
+			FailedStage:     failedStage,
+		}
+		if !src.build.IsZero() {
+			m.Build = &src.build
+		}
+		return h.store.WriteManifest(site, id, m)
 	}
-	// markFailed writes a manifest (if possible) and marks the deployment as failed.
-	markFailed := func(size int64, reason string) {
-		if err := writeManifest(size); err != nil {
-			slog.Warn("writing manifest for failed deployment", "site", site, "deployment", id, "err", err)
+	var extractedBytes int64
+	// fail writes a manifest (if possible), marks the deployment as
+	// failed, saves its log, and publishes the failure.
+	fail := func(stage, reason string, err error) {
+		failedStage = stage
+		dlog.error("deployment failed", "stage", stage, "reason", reason)
+		if err := writeManifest(extractedBytes); err != nil {
+			dlog.warn("writing manifest for failed deployment", "err", err)
 		}
 		if files, err := h.store.ListDeploymentFiles(site, id); err == nil {
 			if err := h.store.WriteFileIndex(site, id, files); err != nil {
-				slog.Warn("writing file index for failed deployment", "site", site, "deployment", id, "err", err)
+				dlog.warn("writing file index for failed deployment", "err", err)
 			}
 		}
 		if err := h.store.MarkFailed(site, id, reason); err != nil {
-			slog.Warn("marking deployment as failed", "site", site, "deployment", id, "err", err)
+			dlog.warn("marking deployment as failed", "err", err)
 		}
+		dlog.save(h.store)
+		h.fireDeployFailed(r.Context(), site, id, stage, reason, err)
 	}
-
-	extractReq := ExtractRequest{
-		Body:               body,
-		Query:              r.URL.Query().Get("format"),
-		ContentType:        r.Header.Get("Content-Type"),
-		ContentDisposition: r.Header.Get("Content-Disposition"),
-		Filename:           r.PathValue("filename"),
+	// reject fails the deployment in stage because of err and returns the
+	// problem to respond with.
+	reject := func(status int, code problem.Code, stage, detail string, err error) *deployError {
+		fail(stage, detail, err)
+		return &deployError{status: status, code: code, detail: detail}
 	}
-	extractedBytes, err := Extract(extractReq, contentDir, maxBytes)
+
+	extractStart := time.Now()
+	extractedBytes, err := src.extract(contentDir)
 	if err != nil {
-		markFailed(0, fmt.Sprintf("extracting upload: %v", err))
-		h.fireDeployFailed(site, err)
-		http.Error(w, fmt.Sprintf("extracting upload: %v", err), http.StatusBadRequest)
-		return
+		extractedBytes = 0
+		return nil, reject(http.StatusBadRequest, problem.InvalidUpload, StageExtract, fmt.Sprintf("extracting upload: %v", err), err)
 	}
 
+	dlog.info("extracted upload", "bytes", extractedBytes, "duration", time.Since(extractStart))
+	timing.ExtractMS = since(extractStart)
+	validateStart := time.Now()
+
 	// Write manifest now that we know the extracted size.
 	if err := writeManifest(extractedBytes); err != nil {
 		os.RemoveAll(deployDir)
-		http.Error(w, "writing manifest", http.StatusInternalServerError)
-		return
+		return nil, &deployError{status: http.StatusInternalServerError, detail: "writing manifest"}
 	}
 
 	// Build site config from _redirects, _headers, and tspages.toml.
 	// tspages.toml values take priority over _redirects/_headers.
-	var siteCfg storage.SiteConfig
+	var siteCfg, tomlCfg storage.SiteConfig
 	hasConfig := false
+	redirectsFile, headersFile := false, false
 
 	// Parse _redirects file (lower priority).
 	redirectsPath := filepath.Join(contentDir, "_redirects")
 	if data, err := os.ReadFile(redirectsPath); err == nil {
 		rules, err := storage.ParseRedirectsFile(data)
 		if err != nil {
-			markFailed(extractedBytes, fmt.Sprintf("invalid _redirects: %v", err))
-			h.fireDeployFailed(site, err)
-			http.Error(w, fmt.Sprintf("invalid _redirects: %v", err), http.StatusBadRequest)
-			return
+			return nil, reject(http.StatusBadRequest, problem.InvalidConfig, StageConfig, fmt.Sprintf("invalid _redirects: %v", err), err)
 		}
 		siteCfg.Redirects = rules
+		dlog.info("parsed _redirects", "rules", len(rules))
 		if err := os.Remove(redirectsPath); err != nil && !os.IsNotExist(err) {
-			slog.Warn("removing _redirects", "err", err)
+			dlog.warn("removing _redirects", "err", err)
 		}
-		hasConfig = hasConfig || len(rules) > 0
+		redirectsFile = len(rules) > 0
+		hasConfig = hasConfig || redirectsFile
 	}
 
 	// Parse _headers file (lower priority).
@@ -198,111 +441,273 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if data, err := os.ReadFile(headersPath); err == nil {
 		hdrs, err := storage.ParseHeadersFile(data)
 		if err != nil {
-			markFailed(extractedBytes, fmt.Sprintf("invalid _headers: %v", err))
-			h.fireDeployFailed(site, err)
-			http.Error(w, fmt.Sprintf("invalid _headers: %v", err), http.StatusBadRequest)
-			return
+			return nil, reject(http.StatusBadRequest, problem.InvalidConfig, StageConfig, fmt.Sprintf("invalid _headers: %v", err), err)
 		}
 		siteCfg.Headers = hdrs
+		dlog.info("parsed _headers", "rules", len(hdrs))
 		if err := os.Remove(headersPath); err != nil && !os.IsNotExist(err) {
-			slog.Warn("removing _headers", "err", err)
+			dlog.warn("removing _headers", "err", err)
 		}
-		hasConfig = hasConfig || len(hdrs) > 0
+		headersFile = len(hdrs) > 0
+		hasConfig = hasConfig || headersFile
 	}
 
 	// Parse tspages.toml (higher priority — merges over _redirects/_headers).
 	configPath := filepath.Join(contentDir, "tspages.toml")
 	if configData, err := os.ReadFile(configPath); err == nil {
-		tomlCfg, err := storage.ParseSiteConfig(configData)
+		tomlCfg, err = storage.ParseSiteConfig(configData)
 		if err != nil {
-			markFailed(extractedBytes, fmt.Sprintf("invalid tspages.toml: %v", err))
-			h.fireDeployFailed(site, err)
-			http.Error(w, fmt.Sprintf("invalid tspages.toml: %v", err), http.StatusBadRequest)
-			return
+			return nil, reject(http.StatusBadRequest, problem.InvalidConfig, StageConfig, fmt.Sprintf("invalid tspages.toml: %v", err), err)
 		}
 		siteCfg = tomlCfg.Merge(siteCfg)
+		dlog.info("parsed tspages.toml")
 		if err := os.Remove(configPath); err != nil && !os.IsNotExist(err) {
-			slog.Warn("removing tspages.toml", "err", err)
+			dlog.warn("removing tspages.toml", "err", err)
 		}
 		hasConfig = true
 	}
 
 	if hasConfig {
 		if err := siteCfg.Validate(); err != nil {
-			markFailed(extractedBytes, fmt.Sprintf("invalid config: %v", err))
-			h.fireDeployFailed(site, err)
-			http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
-			return
+			return nil, reject(http.StatusBadRequest, problem.InvalidConfig, StageConfig, fmt.Sprintf("invalid config: %v", err), err)
 		}
 		if err := h.store.WriteSiteConfig(site, id, siteCfg); err != nil {
-			markFailed(extractedBytes, fmt.Sprintf("writing site config: %v", err))
-			http.Error(w, "writing site config", http.StatusInternalServerError)
-			return
+			fail(StageConfig, fmt.Sprintf("writing site config: %v", err), err)
+			return nil, &deployError{status: http.StatusInternalServerError, detail: "writing site config"}
 		}
+		dlog.info("validated site config")
+	}
+
+	merged := siteCfg.Merge(h.defaults)
+	if err := storage.CheckUploadRules(contentDir, merged.Validation); err != nil {
+		var rulesErr *storage.UploadRulesError
+		if !errors.As(err, &rulesErr) {
+			fail(StageValidate, fmt.Sprintf("checking upload rules: %v", err), err)
+			return nil, &deployError{status: http.StatusInternalServerError, detail: "checking upload rules"}
+		}
+		for _, v := range rulesErr.Violations {
+			dlog.error("upload rule violated", "rule", v.Rule, "path", v.Path, "detail", v.Detail)
+		}
+		derr := reject(http.StatusBadRequest, problem.UploadRejected, StageValidate, err.Error(), err)
+		derr.rules = rulesErr
+		return nil, derr
+	}
+
+	warnings := configWarnings(contentDir, tomlCfg, merged, redirectsFile, headersFile)
+	for _, warning := range warnings {
+		dlog.warn("config warning", "warning", warning)
+	}
+	timing.ValidateMS = since(validateStart)
+
+	// Minify once the config is known, since it can opt in or out.
+	var originalSizes map[string]int64
+	if merged.Minify != nil && *merged.Minify {
+		minifyStart := time.Now()
+		originalSizes, err = MinifyDir(contentDir)
+		if err != nil {
+			fail(StageMinify, fmt.Sprintf("minifying: %v", err), err)
+			return nil, &deployError{status: http.StatusInternalServerError, detail: "minifying content"}
+		}
+		dlog.info("minified content", "files", len(originalSizes), "duration", time.Since(minifyStart))
+		timing.MinifyMS = since(minifyStart)
 	}
 
 	// Cache the file index so ListDeploymentFiles can skip hashing later.
-	if files, err := h.store.ListDeploymentFiles(site, id); err != nil {
-		slog.Warn("listing deployment files", "site", site, "deployment", id, "err", err)
-	} else if err := h.store.WriteFileIndex(site, id, files); err != nil {
-		slog.Warn("writing file index", "site", site, "deployment", id, "err", err)
+	indexStart := time.Now()
+	files, err := h.store.ListDeploymentFiles(site, id)
+	if err != nil {
+		dlog.warn("listing deployment files", "err", err)
+	} else {
+		dlog.info("indexed files", "files", len(files))
+		if len(originalSizes) > 0 {
+			var stored int64
+			for i := range files {
+				files[i].OriginalSize = originalSizes[files[i].Path]
+				stored += files[i].Size
+			}
+			if err := writeManifest(stored); err != nil {
+				dlog.warn("updating manifest size", "err", err)
+			}
+		}
+		if err := h.store.WriteFileIndex(site, id, files); err != nil {
+			dlog.warn("writing file index", "err", err)
+		}
+	}
+	timing.IndexMS = since(indexStart)
+
+	// Precompress after indexing, so the generated variants are not listed
+	// as deployment files.
+	if h.precompress > 0 {
+		precompressStart := time.Now()
+		if n, err := serve.Precompress(contentDir, h.precompress); err != nil {
+			dlog.warn("precompressing deployment", "err", err)
+		} else {
+			dlog.info("precompressed deployment", "variants", n)
+			if n > 0 && files != nil {
+				serve.RecordCompressedSizes(contentDir, files)
+				if err := h.store.WriteFileIndex(site, id, files); err != nil {
+					dlog.warn("writing file index", "err", err)
+				}
+			}
+		}
+		timing.PrecompressMS = since(precompressStart)
 	}
 
+	return &pendingDeployment{
+		site:       site,
+		id:         id,
+		deployDir:  deployDir,
+		deployedBy: deployedBy,
+		requestID:  requestID,
+		build:      src.build,
+		size:       extractedBytes,
+		cfg:        siteCfg,
+		log:        dlog,
+		files:      files,
+		warnings:   warnings,
+		started:    started,
+		timing:     timing,
+		fail:       fail,
+	}, nil
+}
+
+// complete marks a prepared deployment as complete, activates it unless r
+// asks not to, and applies the retention limit.
+func (h *Handler) complete(r *http.Request, d *pendingDeployment) *deployError {
+	site, id, dlog := d.site, d.id, d.log
+	if err := h.store.ChainDeployment(site, id); err != nil {
+		dlog.error("chaining deployment", "err", err)
+		os.RemoveAll(d.deployDir)
+		return &deployError{status: http.StatusInternalServerError, detail: "finalizing deployment"}
+	}
 	if err := h.store.MarkComplete(site, id); err != nil {
-		os.RemoveAll(deployDir)
-		http.Error(w, "finalizing deployment", http.StatusInternalServerError)
-		return
+		os.RemoveAll(d.deployDir)
+		return &deployError{status: http.StatusInternalServerError, detail: "finalizing deployment"}
 	}
 
-	if r.URL.Query().Get("activate") != "false" {
+	d.activated = r.URL.Query().Get("activate") != "false"
+	d.previous, _ = h.store.CurrentDeployment(site)
+	if d.previous != "" {
+		prevFiles, err := h.store.ListDeploymentFiles(site, d.previous)
+		if err != nil {
+			dlog.warn("listing files of the previous deployment", "err", err)
+		} else {
+			d.fileDiff = fileDiff(d.files, prevFiles, d.previous)
+			d.diff = &d.fileDiff.DeployDiff
+		}
+		if m, err := h.store.ReadManifest(site, d.previous); err == nil {
+			d.commitRange = storage.NewCommitRange(m.Build, &d.build, d.cfg.Merge(h.defaults).CompareURL)
+		}
+	} else {
+		d.fileDiff = fileDiff(d.files, nil, "")
+	}
+	if d.activated {
+		activateStart := time.Now()
 		if err := h.store.ActivateDeployment(site, id); err != nil {
-			http.Error(w, "activating deployment", http.StatusInternalServerError)
-			return
+			dlog.error("activating deployment", "err", err)
+			dlog.save(h.store)
+			if errors.Is(err, storage.ErrDeploymentPinned) {
+				return &deployError{status: http.StatusConflict, code: problem.DeploymentPinned, detail: "site has a pinned deployment"}
+			}
+			return &deployError{status: http.StatusInternalServerError, detail: "activating deployment"}
+		}
+		dlog.info("activated deployment")
+		if err := h.store.WriteConfigSnapshot(site, id, d.cfg.Merge(h.defaults)); err != nil {
+			dlog.warn("writing config snapshot", "err", err)
 		}
 		if err := h.manager.EnsureServer(site); err != nil {
-			slog.Warn("site deployed but server failed to start", "site", site, "err", err)
+			dlog.warn("site deployed but server failed to start", "err", err)
 		}
+		d.timing.ActivateMS = since(activateStart)
+	} else {
+		dlog.info("deployment complete, not activated")
 	}
 
 	// Clean up old deployments, keeping the configured maximum.
 	if h.maxDeployments > 0 {
 		if n, err := h.store.CleanupOldDeployments(site, h.maxDeployments); err != nil {
-			slog.Warn("cleaning old deployments", "site", site, "err", err)
+			dlog.warn("cleaning old deployments", "err", err)
 		} else if n > 0 {
-			slog.Info("cleaned old deployments", "count", n, "site", site)
+			dlog.info("cleaned old deployments", "count", n)
+			d.cleaned = n
 		}
 	}
+	dlog.save(h.store)
+	d.timing.TotalMS = since(d.started)
 
-	metrics.CountDeploy(site, extractedBytes)
+	metrics.CountDeploy(site, d.size)
+	return nil
+}
 
-	resp := DeployResponse{
-		DeploymentID: id,
-		Site:         site,
-		URL:          fmt.Sprintf("https://%s.%s/", site, h.dnsSuffix),
+// publish publishes the events of a completed deployment.
+func (h *Handler) publish(r *http.Request, d *pendingDeployment) {
+	if h.events == nil {
+		return
 	}
-	writeJSON(w, resp)
-
-	if h.notifier != nil {
-		resolvedCfg := siteCfg.Merge(h.defaults)
-		h.notifier.Fire("deploy.success", site, resolvedCfg, map[string]any{
-			"site":          site,
-			"deployment_id": id,
-			"created_by":    deployedBy,
-			"url":           resp.URL,
-			"size_bytes":    extractedBytes,
+	data := map[string]any{
+		"site":          d.site,
+		"deployment_id": d.id,
+		"created_by":    d.deployedBy,
+		"url":           d.response(h.dnsSuffix, h.defaults).URL,
+		"size_bytes":    d.size,
+	}
+	for key, value := range map[string]string{"commit": d.build.Commit, "branch": d.build.Branch, "build_url": d.build.BuildURL} {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	if d.commitRange != nil {
+		data["commit_range"] = d.commitRange
+	}
+	if d.fileDiff != nil {
+		data["diff"] = d.fileDiff
+	}
+	if cfg, err := d.cfg.Merge(h.defaults).ConfigMap(); err == nil {
+		data["config"] = cfg
+	}
+	h.events.Publish(events.Event{
+		Type:      events.DeploySuccess,
+		Site:      d.site,
+		Config:    d.cfg.Merge(h.defaults),
+		RequestID: d.requestID,
+		Data:      data,
+	})
+	if d.activated {
+		publishActivation(r, h.events, h.store, d.site, d.previous, d.id)
+	}
+	if d.cleaned > 0 {
+		h.events.Publish(events.Event{
+			Type:      events.DeploymentDeleted,
+			Site:      d.site,
+			RequestID: d.requestID,
+			Data: map[string]any{
+				"site":   d.site,
+				"count":  d.cleaned,
+				"reason": "removed by the retention limit",
+			},
 		})
 	}
 }
 
-func (h *Handler) fireDeployFailed(site string, err error) {
-	if h.notifier == nil {
+// fireDeployFailed publishes that deployment id of site failed in stage for
+// reason, which err caused.
+func (h *Handler) fireDeployFailed(ctx context.Context, site, id, stage, reason string, err error) {
+	if h.events == nil {
 		return
 	}
 	cfg, _ := h.store.ReadCurrentSiteConfig(site)
-	resolvedCfg := cfg.Merge(h.defaults)
-	h.notifier.Fire("deploy.failed", site, resolvedCfg, map[string]any{
-		"site":  site,
-		"error": err.Error(),
+	h.events.Publish(events.Event{
+		Type:      events.DeployFailed,
+		Site:      site,
+		Config:    cfg.Merge(h.defaults),
+		RequestID: httplog.RequestID(ctx),
+		Data: map[string]any{
+			"site":          site,
+			"deployment_id": id,
+			"stage":         stage,
+			"reason":        reason,
+			"error":         err.Error(),
+		},
 	})
 }
 
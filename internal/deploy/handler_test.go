@@ -9,10 +9,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 )
 
@@ -85,6 +89,90 @@ func TestHandler_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_PublishesEvents(t *testing.T) {
+	store := storage.New(t.TempDir())
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("deploy.*", func(e events.Event) { got = append(got, e) })
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix, Events: bus,
+		Defaults: storage.SiteConfig{IndexPage: "home.html"}})
+
+	deploy := func(body []byte) {
+		req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/zip")
+		req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+		req.SetPathValue("site", "docs")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	deploy(makeZip(t, map[string]string{"index.html": "<h1>Hi</h1>"}))
+	deploy(makeZip(t, map[string]string{"index.html": "<h1>Hi</h1>", "tspages.toml": "not = [valid"}))
+
+	if cfg, _ := got[0].Data["config"].(map[string]any); cfg["index_page"] != "home.html" {
+		t.Errorf("deploy.success config = %v, want the merged config", got[0].Data["config"])
+	}
+	id0, _ := got[0].Data["deployment_id"].(string)
+	if snapshot, err := store.ReadConfigSnapshot("docs", id0); err != nil || snapshot.Config["index_page"] != "home.html" {
+		t.Errorf("snapshot = %+v, err = %v", snapshot, err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(got), got)
+	}
+	if got[0].Type != events.DeploySuccess || got[0].Site != "docs" || got[0].Data["deployment_id"] == "" {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if got[1].Type != events.DeployFailed || got[1].Data["error"] == "" || got[1].Data["stage"] != StageConfig {
+		t.Errorf("second event = %+v", got[1])
+	}
+	id, _ := got[1].Data["deployment_id"].(string)
+	if reason, _ := got[1].Data["reason"].(string); !strings.HasPrefix(reason, "invalid tspages.toml") {
+		t.Errorf("reason = %q", reason)
+	}
+
+	// The failure is recorded with its stage.
+	deployments, _ := store.ListDeployments("docs")
+	var failed *storage.DeploymentInfo
+	for i := range deployments {
+		if deployments[i].ID == id {
+			failed = &deployments[i]
+		}
+	}
+	if failed == nil || !failed.Failed || failed.FailedStage != StageConfig {
+		t.Errorf("failed deployment = %+v", failed)
+	}
+}
+
+func TestHandler_ArchivedSite(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateDeployment("docs", "aaa11111")
+	store.MarkComplete("docs", "aaa11111")
+	store.ArchiveSite("docs", storage.ArchiveState{})
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+
+	body := makeZip(t, map[string]string{"index.html": "hi"})
+	req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/zip")
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	var details problem.Details
+	if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+		t.Fatalf("decoding problem details: %v", err)
+	}
+	if details.Code != problem.SiteArchived {
+		t.Errorf("code = %q, want %q", details.Code, problem.SiteArchived)
+	}
+	if deployments, _ := store.ListDeployments("docs"); len(deployments) != 1 {
+		t.Errorf("deployments = %d, want 1", len(deployments))
+	}
+}
+
 func TestHandler_Forbidden(t *testing.T) {
 	store := storage.New(t.TempDir())
 	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
@@ -112,6 +200,7 @@ func TestHandler_WritesManifest(t *testing.T) {
 	req.Header.Set("Content-Type", "application/zip")
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
 	req = withIdentity(req, auth.Identity{LoginName: "alice@example.com", DisplayName: "Alice"})
+	req = req.WithContext(httplog.WithRequestID(req.Context(), "req-1"))
 	req.SetPathValue("site", "docs")
 
 	rec := httptest.NewRecorder()
@@ -144,6 +233,106 @@ func TestHandler_WritesManifest(t *testing.T) {
 	if m.CreatedAt.IsZero() {
 		t.Error("manifest created_at is zero")
 	}
+	if m.RequestID != "req-1" {
+		t.Errorf("manifest request_id = %q, want %q", m.RequestID, "req-1")
+	}
+}
+
+func TestHandler_BuildMetadata(t *testing.T) {
+	store := storage.New(t.TempDir())
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.DeploySuccess, func(e events.Event) { got = append(got, e) })
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix, Events: bus})
+
+	deploy := func(header map[string]string) *httptest.ResponseRecorder {
+		body := makeZip(t, map[string]string{"index.html": "<h1>Hi</h1>"})
+		req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("Content-Type", "application/zip")
+		req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := deploy(map[string]string{
+		HeaderCommit:   "4f2a9c1e0b7d",
+		HeaderBranch:   "feature/login",
+		HeaderBuildURL: "https://ci.example.com/runs/42",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	want := storage.BuildInfo{Commit: "4f2a9c1e0b7d", Branch: "feature/login", BuildURL: "https://ci.example.com/runs/42"}
+	m, _ := store.ReadManifest("docs", resp.DeploymentID)
+	if m.Build == nil || *m.Build != want {
+		t.Errorf("manifest build = %+v, want %+v", m.Build, want)
+	}
+	if len(got) != 1 || got[0].Data["commit"] != want.Commit || got[0].Data["branch"] != want.Branch || got[0].Data["build_url"] != want.BuildURL {
+		t.Errorf("events = %+v, want deploy.success with the build metadata", got)
+	}
+
+	// Without the headers, the manifest and event carry no build.
+	rec = deploy(nil)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if m, _ := store.ReadManifest("docs", resp.DeploymentID); m.Build != nil {
+		t.Errorf("manifest build = %+v, want nil", m.Build)
+	}
+	if _, ok := got[len(got)-1].Data["commit"]; ok {
+		t.Error("event has a commit without the header")
+	}
+
+	rec = deploy(map[string]string{HeaderBuildURL: "javascript:alert(1)"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid build URL: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandler_CommitRange(t *testing.T) {
+	store := storage.New(t.TempDir())
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.DeploySuccess, func(e events.Event) { got = append(got, e) })
+	h := NewHandler(HandlerConfig{
+		Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix, Events: bus,
+		Defaults: storage.SiteConfig{CompareURL: "https://git.example.com/compare/{from}...{to}"},
+	})
+
+	for _, commit := range []string{"1111111aaaa", "2222222bbbb"} {
+		body := makeZip(t, map[string]string{"index.html": "<h1>" + commit + "</h1>"})
+		req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+		req.Header.Set(HeaderCommit, commit)
+		req.Header.Set("Content-Type", "application/zip")
+		req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if _, ok := got[0].Data["commit_range"]; ok {
+		t.Error("first deployment has a commit range")
+	}
+	r, _ := got[1].Data["commit_range"].(*storage.CommitRange)
+	want := storage.CommitRange{From: "1111111aaaa", To: "2222222bbbb", CompareURL: "https://git.example.com/compare/1111111aaaa...2222222bbbb"}
+	if r == nil || *r != want {
+		t.Errorf("commit range = %+v, want %+v", r, want)
+	}
+	if diff, _ := got[1].Data["diff"].(*FileDiff); diff == nil || diff.Changed != 1 || diff.TotalFiles != 1 ||
+		!slices.Equal(diff.ChangedPaths, []string{"index.html"}) {
+		t.Errorf("diff = %+v, want index.html changed", diff)
+	}
 }
 
 func TestHandler_UploadTooLarge(t *testing.T) {
@@ -237,6 +426,105 @@ func TestHandler_ParsesSiteConfig(t *testing.T) {
 	}
 }
 
+func TestHandler_Minify(t *testing.T) {
+	store := storage.New(t.TempDir())
+	mgr := newMockManager()
+	h := NewHandler(HandlerConfig{Store: store, Manager: mgr, MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+
+	page := "<html>\n  <body>\n    <p>  Hello,   world  </p>\n  </body>\n</html>\n"
+	vendored := "var   a = 1;\n"
+	body := makeZip(t, map[string]string{
+		"index.html":     page,
+		"style.css":      "body {\n  color: red;\n}\n",
+		"lib/app.min.js": vendored,
+		"data.txt":       "  keep   me  ",
+		"tspages.toml":   "minify = true\n",
+	})
+	req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/zip")
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	files, err := store.ListDeploymentFiles("docs", resp.DeploymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored int64
+	byPath := map[string]storage.FileInfo{}
+	for _, f := range files {
+		byPath[f.Path] = f
+		stored += f.Size
+	}
+	if f := byPath["index.html"]; f.OriginalSize != int64(len(page)) || f.Size >= f.OriginalSize {
+		t.Errorf("index.html = %+v, want minified from %d bytes", f, len(page))
+	}
+	if f := byPath["style.css"]; f.OriginalSize == 0 {
+		t.Errorf("style.css = %+v, want minified", f)
+	}
+	for _, p := range []string{"lib/app.min.js", "data.txt"} {
+		if f := byPath[p]; f.OriginalSize != 0 {
+			t.Errorf("%s = %+v, want untouched", p, f)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(store.ContentDir("docs", resp.DeploymentID), "lib", "app.min.js"))
+	if string(data) != vendored {
+		t.Errorf("app.min.js = %q, want unchanged", data)
+	}
+
+	m, err := store.ReadManifest("docs", resp.DeploymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SizeBytes != stored {
+		t.Errorf("manifest size_bytes = %d, want stored size %d", m.SizeBytes, stored)
+	}
+}
+
+func TestHandler_Precompress(t *testing.T) {
+	store := storage.New(t.TempDir())
+	mgr := newMockManager()
+	h := NewHandler(HandlerConfig{Store: store, Manager: mgr, MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix, PrecompressLevel: 5})
+
+	body := makeZip(t, map[string]string{"index.html": strings.Repeat("<p>hello</p>\n", 100)})
+	req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/zip")
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	contentDir := store.ContentDir("docs", resp.DeploymentID)
+	for _, name := range []string{"index.html.br", "index.html.gz"} {
+		if _, err := os.Stat(filepath.Join(contentDir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	files, err := store.ListDeploymentFiles("docs", resp.DeploymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("file index = %+v, want only index.html", files)
+	}
+	if c := files[0].CompressedSize; c == 0 || c >= files[0].Size {
+		t.Errorf("compressed size = %d, want below %d", c, files[0].Size)
+	}
+}
+
 func TestHandler_ParsesRedirectsFile(t *testing.T) {
 	store := storage.New(t.TempDir())
 	mgr := newMockManager()
@@ -404,6 +692,105 @@ func TestHandler_InvalidSiteConfig(t *testing.T) {
 	if m.SizeBytes == 0 {
 		t.Error("manifest size_bytes should reflect extracted content")
 	}
+
+	// The deploy log should end with the failure.
+	entries, err := store.ReadDeployLog("docs", deps[0].ID)
+	if err != nil {
+		t.Fatalf("read deploy log: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("deploy log is empty")
+	}
+	last := entries[len(entries)-1]
+	if last.Level != "ERROR" || !strings.Contains(last.Attrs["reason"].(string), "invalid config") {
+		t.Errorf("last entry = %+v, want the failure", last)
+	}
+}
+
+func TestHandler_UploadRules(t *testing.T) {
+	store := storage.New(t.TempDir())
+	defaults := storage.SiteConfig{Validation: storage.UploadRules{BlockedPaths: []string{"node_modules"}}}
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix, Defaults: defaults})
+
+	// The deployment adds its own rule on top of the server's.
+	body := makeZip(t, map[string]string{
+		"index.html":                "<h1>Hi</h1>",
+		".env":                      "SECRET=1",
+		"node_modules/pkg/index.js": "1",
+		"tspages.toml":              "[validation]\nblock_dotfiles = true\n",
+	})
+	req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Code            problem.Code        `json:"code"`
+		Violations      []storage.Violation `json:"violations"`
+		TotalViolations int                 `json:"total_violations"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Code != problem.UploadRejected || resp.TotalViolations != 2 {
+		t.Errorf("code = %q, total = %d; want upload_rejected, 2", resp.Code, resp.TotalViolations)
+	}
+	rules := map[string]string{}
+	for _, v := range resp.Violations {
+		rules[v.Path] = v.Rule
+	}
+	if rules[".env"] != "block_dotfiles" || rules["node_modules"] != "blocked_paths" {
+		t.Errorf("violations = %+v", resp.Violations)
+	}
+
+	deps, _ := store.ListDeployments("docs")
+	if len(deps) != 1 || !deps[0].Failed {
+		t.Fatalf("deployments = %+v, want one failed", deps)
+	}
+}
+
+func TestHandler_WritesDeployLog(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+
+	body := makeZip(t, map[string]string{
+		"index.html": "<h1>Hi</h1>",
+		"_headers":   "/*\n  X-Frame-Options: DENY\n",
+	})
+	req := httptest.NewRequest("POST", "/deploy/docs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/zip")
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req.SetPathValue("site", "docs")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp DeployResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	entries, err := store.ReadDeployLog("docs", resp.DeploymentID)
+	if err != nil {
+		t.Fatalf("read deploy log: %v", err)
+	}
+	var msgs []string
+	for _, e := range entries {
+		msgs = append(msgs, e.Message)
+	}
+	want := []string{"upload received", "extracted upload", "parsed _headers", "validated site config", "indexed files", "activated deployment"}
+	if strings.Join(msgs, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", msgs, want)
+	}
+	if entries[1].Attrs["duration"] == nil {
+		t.Errorf("extracted upload attrs = %v", entries[1].Attrs)
+	}
+	if entries[4].Attrs["files"] != float64(1) {
+		t.Errorf("indexed files attrs = %v, want files=1", entries[4].Attrs)
+	}
 }
 
 func TestHandler_NoSiteConfig(t *testing.T) {
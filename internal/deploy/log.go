@@ -0,0 +1,75 @@
+package deploy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// deployLog records the steps of one deployment. Each entry also goes to
+// the server log, tagged with the site, deployment, and request ID, so the
+// deployment log is the slice of the server log a deployer can see without
+// host access.
+type deployLog struct {
+	ctx     context.Context
+	site    string
+	id      string
+	entries []storage.DeployLogEntry
+}
+
+func newDeployLog(ctx context.Context, site, id string) *deployLog {
+	return &deployLog{ctx: ctx, site: site, id: id}
+}
+
+func (l *deployLog) info(msg string, args ...any)  { l.add(slog.LevelInfo, msg, args...) }
+func (l *deployLog) warn(msg string, args ...any)  { l.add(slog.LevelWarn, msg, args...) }
+func (l *deployLog) error(msg string, args ...any) { l.add(slog.LevelError, msg, args...) }
+
+func (l *deployLog) add(level slog.Level, msg string, args ...any) {
+	now := time.Now()
+	rec := slog.NewRecord(now, level, msg, 0)
+	rec.Add(args...)
+
+	var attrs map[string]any
+	rec.Attrs(func(a slog.Attr) bool {
+		if attrs == nil {
+			attrs = make(map[string]any)
+		}
+		attrs[a.Key] = logValue(a.Value)
+		return true
+	})
+	l.entries = append(l.entries, storage.DeployLogEntry{
+		Time:    now,
+		Level:   level.String(),
+		Message: msg,
+		Attrs:   attrs,
+	})
+
+	rec.AddAttrs(slog.String("site", l.site), slog.String("deployment", l.id))
+	if h := slog.Default().Handler(); h.Enabled(l.ctx, level) {
+		_ = h.Handle(l.ctx, rec)
+	}
+}
+
+// logValue converts v to a value that reads well once encoded as JSON.
+func logValue(v slog.Value) any {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().Round(time.Millisecond).String()
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	return v.Any()
+}
+
+// save writes the log next to the deployment's manifest.
+func (l *deployLog) save(store *storage.Store) {
+	if err := store.WriteDeployLog(l.site, l.id, l.entries); err != nil {
+		slog.WarnContext(l.ctx, "writing deploy log", "site", l.site, "deployment", l.id, "err", err)
+	}
+}
@@ -3,41 +3,50 @@ package deploy
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
 
 	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
-	"tspages/internal/webhook"
 )
 
 // DeleteHandler handles DELETE /deploy/{site}.
 type DeleteHandler struct {
 	store    *storage.Store
 	manager  SiteManager
-	notifier *webhook.Notifier
+	events   *events.Bus
 	defaults storage.SiteConfig
 }
 
-func NewDeleteHandler(store *storage.Store, manager SiteManager, notifier *webhook.Notifier, defaults storage.SiteConfig) *DeleteHandler {
-	return &DeleteHandler{store: store, manager: manager, notifier: notifier, defaults: defaults}
+func NewDeleteHandler(store *storage.Store, manager SiteManager, bus *events.Bus, defaults storage.SiteConfig) *DeleteHandler {
+	return &DeleteHandler{store: store, manager: manager, events: bus, defaults: defaults}
 }
 
 func (h *DeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	if !storage.ValidSiteName(site) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
 	caps := auth.CapsFromContext(r.Context())
 	if !auth.CanDeleteSite(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if h.store.SiteArchived(site) {
+		problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
 		return
 	}
 
 	// Read config before deletion so the webhook fires to the right destination.
 	var resolvedCfg storage.SiteConfig
-	if h.notifier != nil {
+	if h.events != nil {
 		if cfg, err := h.store.ReadCurrentSiteConfig(site); err == nil {
 			resolvedCfg = cfg.Merge(h.defaults)
 		} else {
@@ -46,26 +55,32 @@ func (h *DeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.manager.StopServer(site); err != nil {
-		http.Error(w, fmt.Sprintf("stopping server: %v", err), http.StatusInternalServerError)
+		problem.Error(w, fmt.Sprintf("stopping server: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.store.DeleteSite(site); err != nil {
-		http.Error(w, fmt.Sprintf("deleting site: %v", err), http.StatusInternalServerError)
+	if err := h.store.TrashSite(site); err != nil {
+		problem.Error(w, fmt.Sprintf("deleting site: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 
-	if h.notifier != nil {
+	if h.events != nil {
 		identity := auth.IdentityFromContext(r.Context())
 		deletedBy := identity.DisplayName
 		if deletedBy == "" {
 			deletedBy = identity.LoginName
 		}
-		h.notifier.Fire("site.deleted", site, resolvedCfg, map[string]any{
-			"site":       site,
-			"deleted_by": deletedBy,
+		h.events.Publish(events.Event{
+			Type:      events.SiteDeleted,
+			Site:      site,
+			Config:    resolvedCfg,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":       site,
+				"deleted_by": deletedBy,
+			},
 		})
 	}
 }
@@ -82,19 +97,19 @@ func NewListDeploymentsHandler(store *storage.Store) *ListDeploymentsHandler {
 func (h *ListDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	if !storage.ValidSiteName(site) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
 	caps := auth.CapsFromContext(r.Context())
 	if !auth.CanDeploy(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		problem.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
 	deployments, err := h.store.ListDeployments(site)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("listing deployments: %v", err), http.StatusInternalServerError)
+		problem.Error(w, fmt.Sprintf("listing deployments: %v", err), http.StatusInternalServerError)
 		return
 	}
 	if deployments == nil {
@@ -106,116 +121,155 @@ func (h *ListDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 
 // DeleteDeploymentHandler handles DELETE /deploy/{site}/{id}.
 type DeleteDeploymentHandler struct {
-	store *storage.Store
+	store  *storage.Store
+	events *events.Bus
 }
 
-func NewDeleteDeploymentHandler(store *storage.Store) *DeleteDeploymentHandler {
-	return &DeleteDeploymentHandler{store: store}
+func NewDeleteDeploymentHandler(store *storage.Store, bus *events.Bus) *DeleteDeploymentHandler {
+	return &DeleteDeploymentHandler{store: store, events: bus}
 }
 
 func (h *DeleteDeploymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	id := r.PathValue("id")
 	if !storage.ValidSiteName(site) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 	if !storage.ValidDeploymentID(id) {
-		http.Error(w, "invalid deployment id", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
 		return
 	}
 
 	caps := auth.CapsFromContext(r.Context())
 	if !auth.CanDeploy(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		problem.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	if err := h.store.DeleteDeployment(site, id); err != nil {
+	if err := h.store.TrashDeployment(site, id); err != nil {
 		switch {
 		case errors.Is(err, storage.ErrActiveDeployment):
-			http.Error(w, "cannot delete the active deployment", http.StatusConflict)
+			problem.Write(w, http.StatusConflict, problem.DeploymentActive, "cannot delete the active deployment")
+		case errors.Is(err, storage.ErrDeploymentPinned):
+			problem.Write(w, http.StatusConflict, problem.DeploymentPinned, "cannot delete a pinned deployment")
+		case errors.Is(err, storage.ErrSiteArchived):
+			problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
 		case errors.Is(err, storage.ErrDeploymentNotFound):
-			http.Error(w, "deployment not found", http.StatusNotFound)
+			problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found")
 		default:
-			http.Error(w, fmt.Sprintf("deleting deployment: %v", err), http.StatusInternalServerError)
+			problem.Error(w, fmt.Sprintf("deleting deployment: %v", err), http.StatusInternalServerError)
 		}
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
+
+	if h.events != nil {
+		h.events.Publish(events.Event{
+			Type:      events.DeploymentDeleted,
+			Site:      site,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":          site,
+				"deployment_id": id,
+				"deleted_by":    actorName(r),
+			},
+		})
+	}
 }
 
 // CleanupDeploymentsHandler handles DELETE /deploy/{site}/deployments.
 type CleanupDeploymentsHandler struct {
-	store *storage.Store
+	store  *storage.Store
+	events *events.Bus
 }
 
-func NewCleanupDeploymentsHandler(store *storage.Store) *CleanupDeploymentsHandler {
-	return &CleanupDeploymentsHandler{store: store}
+func NewCleanupDeploymentsHandler(store *storage.Store, bus *events.Bus) *CleanupDeploymentsHandler {
+	return &CleanupDeploymentsHandler{store: store, events: bus}
 }
 
 func (h *CleanupDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	if !storage.ValidSiteName(site) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 
 	caps := auth.CapsFromContext(r.Context())
 	if !auth.CanDeploy(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		problem.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
 	deleted, err := h.store.DeleteInactiveDeployments(site)
+	if errors.Is(err, storage.ErrSiteArchived) {
+		problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("cleaning up: %v", err), http.StatusInternalServerError)
+		problem.Error(w, fmt.Sprintf("cleaning up: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	writeJSON(w, map[string]int{"deleted": deleted})
+
+	if h.events != nil && deleted > 0 {
+		h.events.Publish(events.Event{
+			Type:      events.DeploymentDeleted,
+			Site:      site,
+			RequestID: httplog.RequestID(r.Context()),
+			Data: map[string]any{
+				"site":       site,
+				"count":      deleted,
+				"reason":     "removed on request",
+				"deleted_by": actorName(r),
+			},
+		})
+	}
 }
 
 // ActivateHandler handles POST /deploy/{site}/{id}/activate.
 type ActivateHandler struct {
-	store   *storage.Store
-	manager SiteManager
+	store    *storage.Store
+	manager  SiteManager
+	events   *events.Bus
+	defaults storage.SiteConfig
 }
 
-func NewActivateHandler(store *storage.Store, manager SiteManager) *ActivateHandler {
-	return &ActivateHandler{store: store, manager: manager}
+func NewActivateHandler(store *storage.Store, manager SiteManager, bus *events.Bus, defaults storage.SiteConfig) *ActivateHandler {
+	return &ActivateHandler{store: store, manager: manager, events: bus, defaults: defaults}
 }
 
 func (h *ActivateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	site := r.PathValue("site")
 	id := r.PathValue("id")
 	if !storage.ValidSiteName(site) {
-		http.Error(w, "invalid site name", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
 		return
 	}
 	if !storage.ValidDeploymentID(id) {
-		http.Error(w, "invalid deployment id", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
 		return
 	}
 
 	caps := auth.CapsFromContext(r.Context())
 	if !auth.CanDeploy(caps, site) {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		problem.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
 	// Verify deployment exists and is complete
 	deployments, err := h.store.ListDeployments(site)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("listing deployments: %v", err), http.StatusInternalServerError)
+		problem.Error(w, fmt.Sprintf("listing deployments: %v", err), http.StatusInternalServerError)
 		return
 	}
 	found := false
 	for _, d := range deployments {
 		if d.ID == id {
 			if d.Failed {
-				http.Error(w, "cannot activate a failed deployment", http.StatusConflict)
+				problem.Write(w, http.StatusConflict, problem.DeploymentFailed, "cannot activate a failed deployment")
 				return
 			}
 			found = true
@@ -223,19 +277,130 @@ func (h *ActivateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !found {
-		http.Error(w, "deployment not found or incomplete", http.StatusNotFound)
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found or incomplete")
 		return
 	}
 
+	previous, _ := h.store.CurrentDeployment(site)
 	if err := h.store.ActivateDeployment(site, id); err != nil {
-		http.Error(w, fmt.Sprintf("activating deployment: %v", err), http.StatusInternalServerError)
+		if errors.Is(err, storage.ErrSiteArchived) {
+			problem.Write(w, http.StatusConflict, problem.SiteArchived, "site is archived")
+			return
+		}
+		if errors.Is(err, storage.ErrDeploymentPinned) {
+			problem.Write(w, http.StatusConflict, problem.DeploymentPinned, "site has a pinned deployment")
+			return
+		}
+		problem.Error(w, fmt.Sprintf("activating deployment: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if cfg, err := h.store.ReadSiteConfig(site, id); err != nil {
+		slog.WarnContext(r.Context(), "reading site config for its snapshot", "site", site, "deployment", id, "err", err)
+	} else if err := h.store.WriteConfigSnapshot(site, id, cfg.Merge(h.defaults)); err != nil {
+		slog.WarnContext(r.Context(), "writing config snapshot", "site", site, "deployment", id, "err", err)
+	}
 
 	if err := h.manager.EnsureServer(site); err != nil {
-		http.Error(w, fmt.Sprintf("starting server: %v", err), http.StatusInternalServerError)
+		problem.Error(w, fmt.Sprintf("starting server: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	writeJSON(w, storage.DeploymentInfo{ID: id, Active: true})
+
+	publishActivation(r, h.events, h.store, site, previous, id)
+}
+
+// publishActivation publishes the activation of deployment id, and a
+// config change if its settings differ from those of previous, the
+// deployment it replaced.
+func publishActivation(r *http.Request, bus *events.Bus, store *storage.Store, site, previous, id string) {
+	if bus == nil || previous == id {
+		return
+	}
+	actor := actorName(r)
+	requestID := httplog.RequestID(r.Context())
+	bus.Publish(events.Event{
+		Type:      events.DeploymentActivated,
+		Site:      site,
+		RequestID: requestID,
+		Data: map[string]any{
+			"site":                   site,
+			"deployment_id":          id,
+			"previous_deployment_id": previous,
+			"activated_by":           actor,
+		},
+	})
+	if previous == "" {
+		return
+	}
+	before, err := store.ReadSiteConfig(site, previous)
+	if err != nil {
+		return
+	}
+	after, err := store.ReadSiteConfig(site, id)
+	if err != nil {
+		return
+	}
+	if changed := after.ChangedFields(before); len(changed) > 0 {
+		bus.Publish(events.Event{
+			Type:      events.ConfigChanged,
+			Site:      site,
+			RequestID: requestID,
+			Data: map[string]any{
+				"site":          site,
+				"deployment_id": id,
+				"changed":       changed,
+				"activated_by":  actor,
+			},
+		})
+	}
+}
+
+// actorName returns the name of the user making r, for events.
+func actorName(r *http.Request) string {
+	identity := auth.IdentityFromContext(r.Context())
+	if identity.DisplayName != "" {
+		return identity.DisplayName
+	}
+	return identity.LoginName
+}
+
+// DeploymentLogHandler handles GET /deploy/{site}/{id}/log.
+type DeploymentLogHandler struct {
+	store *storage.Store
+}
+
+func NewDeploymentLogHandler(store *storage.Store) *DeploymentLogHandler {
+	return &DeploymentLogHandler{store: store}
+}
+
+func (h *DeploymentLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !storage.ValidDeploymentID(id) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanDeploy(caps, site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	entries, err := h.store.ReadDeployLog(site, id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			problem.Error(w, "deploy log not found", http.StatusNotFound)
+			return
+		}
+		problem.Error(w, fmt.Sprintf("reading deploy log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, entries)
 }
@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"tspages/internal/auth"
+	"tspages/internal/events"
 	"tspages/internal/storage"
 )
 
@@ -39,6 +41,52 @@ func TestDeleteHandler_Success(t *testing.T) {
 			t.Error("site still exists after deletion")
 		}
 	}
+	// ...but retained in the trash until purged
+	trash, _ := store.ListTrash()
+	if len(trash) != 1 || trash[0].Site != "docs" {
+		t.Errorf("trash = %+v, want docs", trash)
+	}
+}
+
+func TestManageHandlers_ArchivedSite(t *testing.T) {
+	store := storage.New(t.TempDir())
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		store.CreateDeployment("docs", id)
+		store.MarkComplete("docs", id)
+	}
+	store.ActivateDeployment("docs", "aaa11111")
+	store.ArchiveSite("docs", storage.ArchiveState{})
+	mgr := newMockManager()
+
+	tests := []struct {
+		name   string
+		h      http.Handler
+		method string
+		path   string
+		id     string
+	}{
+		{"delete site", NewDeleteHandler(store, mgr, nil, storage.SiteConfig{}), "DELETE", "/deploy/docs", ""},
+		{"delete deployment", NewDeleteDeploymentHandler(store, nil), "DELETE", "/deploy/docs/bbb22222", "bbb22222"},
+		{"cleanup", NewCleanupDeploymentsHandler(store, nil), "DELETE", "/deploy/docs/deployments", ""},
+		{"activate", NewActivateHandler(store, mgr, nil, storage.SiteConfig{}), "POST", "/deploy/docs/bbb22222/activate", "bbb22222"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req = withCaps(req, []auth.Cap{{Access: "admin"}})
+			req.SetPathValue("site", "docs")
+			req.SetPathValue("id", tt.id)
+
+			rec := httptest.NewRecorder()
+			tt.h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusConflict {
+				t.Errorf("status = %d, want 409, body = %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+	if mgr.stopped["docs"] != 0 {
+		t.Error("archived site's server was stopped")
+	}
 }
 
 func TestDeleteHandler_Forbidden(t *testing.T) {
@@ -147,7 +195,7 @@ func TestDeleteDeploymentHandler_Success(t *testing.T) {
 	store.MarkComplete("docs", "bbb22222")
 	store.ActivateDeployment("docs", "bbb22222")
 
-	h := NewDeleteDeploymentHandler(store)
+	h := NewDeleteDeploymentHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/aaa11111", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -172,7 +220,7 @@ func TestDeleteDeploymentHandler_Active(t *testing.T) {
 	store.MarkComplete("docs", "aaa11111")
 	store.ActivateDeployment("docs", "aaa11111")
 
-	h := NewDeleteDeploymentHandler(store)
+	h := NewDeleteDeploymentHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/aaa11111", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -192,7 +240,7 @@ func TestDeleteDeploymentHandler_NotFound(t *testing.T) {
 	store.CreateDeployment("docs", "aaa11111")
 	store.MarkComplete("docs", "aaa11111")
 
-	h := NewDeleteDeploymentHandler(store)
+	h := NewDeleteDeploymentHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/nonexistent", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -208,7 +256,7 @@ func TestDeleteDeploymentHandler_NotFound(t *testing.T) {
 }
 
 func TestDeleteDeploymentHandler_Forbidden(t *testing.T) {
-	h := NewDeleteDeploymentHandler(storage.New(t.TempDir()))
+	h := NewDeleteDeploymentHandler(storage.New(t.TempDir()), nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/abc", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"other"}}})
@@ -232,7 +280,7 @@ func TestActivateHandler_Success(t *testing.T) {
 	store.MarkComplete("docs", "bbb22222")
 
 	mgr := newMockManager()
-	h := NewActivateHandler(store, mgr)
+	h := NewActivateHandler(store, mgr, nil, storage.SiteConfig{NotFoundPage: "missing.html"})
 
 	req := httptest.NewRequest("POST", "/deploy/docs/bbb22222/activate", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -259,6 +307,42 @@ func TestActivateHandler_Success(t *testing.T) {
 	if mgr.ensured["docs"] != 1 {
 		t.Errorf("EnsureServer called %d times, want 1", mgr.ensured["docs"])
 	}
+	if snapshot, err := store.ReadConfigSnapshot("docs", "bbb22222"); err != nil || snapshot.Config["not_found_page"] != "missing.html" {
+		t.Errorf("snapshot = %+v, err = %v", snapshot, err)
+	}
+}
+
+func TestActivateHandler_PublishesActivationAndConfigChange(t *testing.T) {
+	store := storage.New(t.TempDir())
+	spa := true
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		store.CreateDeployment("docs", id)
+		store.MarkComplete("docs", id)
+	}
+	store.WriteSiteConfig("docs", "bbb22222", storage.SiteConfig{SPARouting: &spa})
+	store.ActivateDeployment("docs", "aaa11111")
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	h := NewActivateHandler(store, newMockManager(), bus, storage.SiteConfig{})
+
+	req := httptest.NewRequest("POST", "/deploy/docs/bbb22222/activate", nil)
+	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+	req = req.WithContext(auth.ContextWithIdentity(req.Context(), auth.Identity{LoginName: "alice@example.com"}))
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "bbb22222")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(got) != 2 || got[0].Type != events.DeploymentActivated || got[1].Type != events.ConfigChanged {
+		t.Fatalf("events = %+v, want an activation and a config change", got)
+	}
+	if got[0].Data["previous_deployment_id"] != "aaa11111" || got[0].Data["activated_by"] != "alice@example.com" {
+		t.Errorf("activation data = %v", got[0].Data)
+	}
+	if changed, _ := got[1].Data["changed"].([]string); len(changed) != 1 || changed[0] != "spa_routing" {
+		t.Errorf("changed = %v, want [spa_routing]", got[1].Data["changed"])
+	}
 }
 
 func TestActivateHandler_NotFound(t *testing.T) {
@@ -266,7 +350,7 @@ func TestActivateHandler_NotFound(t *testing.T) {
 	store.CreateDeployment("docs", "aaa11111")
 	store.MarkComplete("docs", "aaa11111")
 
-	h := NewActivateHandler(store, newMockManager())
+	h := NewActivateHandler(store, newMockManager(), nil, storage.SiteConfig{})
 
 	req := httptest.NewRequest("POST", "/deploy/docs/nonexistent/activate", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -291,7 +375,7 @@ func TestCleanupDeploymentsHandler_Success(t *testing.T) {
 	store.MarkComplete("docs", "ccc33333")
 	store.ActivateDeployment("docs", "bbb22222")
 
-	h := NewCleanupDeploymentsHandler(store)
+	h := NewCleanupDeploymentsHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/deployments", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -319,7 +403,7 @@ func TestCleanupDeploymentsHandler_Success(t *testing.T) {
 }
 
 func TestCleanupDeploymentsHandler_Forbidden(t *testing.T) {
-	h := NewCleanupDeploymentsHandler(storage.New(t.TempDir()))
+	h := NewCleanupDeploymentsHandler(storage.New(t.TempDir()), nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/deployments", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"other"}}})
@@ -343,7 +427,7 @@ func TestActivateHandler_RejectsFailed(t *testing.T) {
 	store.CreateDeployment("docs", "bbb22222")
 	store.MarkFailed("docs", "bbb22222", "bad config")
 
-	h := NewActivateHandler(store, newMockManager())
+	h := NewActivateHandler(store, newMockManager(), nil, storage.SiteConfig{})
 
 	req := httptest.NewRequest("POST", "/deploy/docs/bbb22222/activate", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -380,7 +464,7 @@ func TestListDeploymentsHandler_InvalidSite(t *testing.T) {
 }
 
 func TestDeleteDeploymentHandler_InvalidDeploymentID(t *testing.T) {
-	h := NewDeleteDeploymentHandler(storage.New(t.TempDir()))
+	h := NewDeleteDeploymentHandler(storage.New(t.TempDir()), nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/../evil", nil)
 	req = withCaps(req, []auth.Cap{{Access: "admin"}})
@@ -396,7 +480,7 @@ func TestDeleteDeploymentHandler_InvalidDeploymentID(t *testing.T) {
 }
 
 func TestActivateHandler_InvalidDeploymentID(t *testing.T) {
-	h := NewActivateHandler(storage.New(t.TempDir()), newMockManager())
+	h := NewActivateHandler(storage.New(t.TempDir()), newMockManager(), nil, storage.SiteConfig{})
 
 	req := httptest.NewRequest("POST", "/deploy/docs/../activate", nil)
 	req = withCaps(req, []auth.Cap{{Access: "admin"}})
@@ -412,7 +496,7 @@ func TestActivateHandler_InvalidDeploymentID(t *testing.T) {
 }
 
 func TestCleanupDeploymentsHandler_InvalidSite(t *testing.T) {
-	h := NewCleanupDeploymentsHandler(storage.New(t.TempDir()))
+	h := NewCleanupDeploymentsHandler(storage.New(t.TempDir()), nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/BAD!/deployments", nil)
 	req = withCaps(req, []auth.Cap{{Access: "admin"}})
@@ -434,7 +518,7 @@ func TestCleanupDeploymentsHandler_NoActiveDeployment(t *testing.T) {
 	store.CreateDeployment("docs", "bbb22222")
 	store.MarkComplete("docs", "bbb22222")
 
-	h := NewCleanupDeploymentsHandler(store)
+	h := NewCleanupDeploymentsHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/docs/deployments", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
@@ -464,7 +548,7 @@ func TestCleanupDeploymentsHandler_NoActiveDeployment(t *testing.T) {
 
 func TestCleanupDeploymentsHandler_NonexistentSite(t *testing.T) {
 	store := storage.New(t.TempDir())
-	h := NewCleanupDeploymentsHandler(store)
+	h := NewCleanupDeploymentsHandler(store, nil)
 
 	req := httptest.NewRequest("DELETE", "/deploy/nosite/deployments", nil)
 	req = withCaps(req, []auth.Cap{{Access: "admin"}})
@@ -487,7 +571,7 @@ func TestCleanupDeploymentsHandler_NonexistentSite(t *testing.T) {
 }
 
 func TestActivateHandler_Forbidden(t *testing.T) {
-	h := NewActivateHandler(storage.New(t.TempDir()), newMockManager())
+	h := NewActivateHandler(storage.New(t.TempDir()), newMockManager(), nil, storage.SiteConfig{})
 
 	req := httptest.NewRequest("POST", "/deploy/docs/abc/activate", nil)
 	req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"other"}}})
@@ -501,3 +585,48 @@ func TestActivateHandler_Forbidden(t *testing.T) {
 		t.Errorf("status = %d, want 403", rec.Code)
 	}
 }
+
+func TestDeploymentLogHandler(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateDeployment("docs", "aaa11111")
+	store.WriteDeployLog("docs", "aaa11111", []storage.DeployLogEntry{
+		{Time: time.Now(), Level: "INFO", Message: "upload received"},
+	})
+	store.CreateDeployment("docs", "bbb22222")
+
+	h := NewDeploymentLogHandler(store)
+	tests := []struct {
+		name string
+		id   string
+		caps []auth.Cap
+		want int
+	}{
+		{"found", "aaa11111", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, http.StatusOK},
+		{"no log", "bbb22222", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, http.StatusNotFound},
+		{"forbidden", "aaa11111", []auth.Cap{{Access: "view", Sites: []string{"docs"}}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/deploy/docs/"+tt.id+"/log", nil)
+			req = withCaps(req, tt.caps)
+			req.SetPathValue("site", "docs")
+			req.SetPathValue("id", tt.id)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var entries []storage.DeployLogEntry
+			if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Message != "upload received" {
+				t.Errorf("entries = %+v", entries)
+			}
+		})
+	}
+}
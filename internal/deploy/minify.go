@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// minifyTypes maps file extensions to the media types minified at deploy time.
+var minifyTypes = map[string]string{
+	".html": "text/html",
+	".htm":  "text/html",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".mjs":  "application/javascript",
+}
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	// Keep document and end tags so the served HTML keeps its structure
+	// for anything that post-processes it.
+	m.Add("text/html", &html.Minifier{KeepDocumentTags: true, KeepEndTags: true})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("application/javascript", js.Minify)
+	return m
+}
+
+// MinifyDir minifies HTML, CSS, and JavaScript files in dir in place. Files
+// that are already minified (*.min.js, *.min.css), fail to parse, or would
+// not get smaller are left untouched. It returns the original size of every
+// rewritten file, keyed by its path relative to dir.
+func MinifyDir(dir string) (map[string]int64, error) {
+	m := newMinifier()
+	original := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		name := strings.ToLower(d.Name())
+		mediatype, ok := minifyTypes[filepath.Ext(name)]
+		if !ok || strings.HasSuffix(name, ".min.js") || strings.HasSuffix(name, ".min.css") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := m.Minify(mediatype, &out, bytes.NewReader(data)); err != nil {
+			rel, _ := filepath.Rel(dir, path)
+			slog.Debug("skipping minification", "file", rel, "err", err)
+			return nil
+		}
+		if out.Len() >= len(data) {
+			return nil
+		}
+		if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		original[rel] = int64(len(data))
+		return nil
+	})
+	return original, err
+}
@@ -0,0 +1,97 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// PinRequest is the optional JSON body of POST /deploy/{site}/{id}/pin.
+type PinRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// PinHandler handles POST /deploy/{site}/{id}/pin and DELETE
+// /deploy/{site}/{id}/pin. A pinned deployment cannot be deleted, and
+// while a site has one, no other deployment can be activated.
+type PinHandler struct {
+	store  *storage.Store
+	events *events.Bus
+}
+
+func NewPinHandler(store *storage.Store, bus *events.Bus) *PinHandler {
+	return &PinHandler{store: store, events: bus}
+}
+
+func (h *PinHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !storage.ValidDeploymentID(id) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidDeploymentID, "invalid deployment id")
+		return
+	}
+
+	caps := auth.CapsFromContext(r.Context())
+	if !auth.CanPinDeployment(caps, site) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.store.DeploymentComplete(site, id) {
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found or incomplete")
+		return
+	}
+
+	actor := actorName(r)
+	data := map[string]any{"site": site, "deployment_id": id}
+	var eventType string
+	if r.Method == http.MethodDelete {
+		if _, pinned := h.store.ReadPin(site, id); !pinned {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := h.store.UnpinDeployment(site, id); err != nil {
+			problem.Error(w, fmt.Sprintf("unpinning deployment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		eventType = events.DeploymentUnpinned
+		data["unpinned_by"] = actor
+	} else {
+		var req PinRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			problem.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		state := storage.PinState{PinnedBy: actor, Reason: req.Reason}
+		if err := h.store.PinDeployment(site, id, state); err != nil {
+			problem.Error(w, fmt.Sprintf("pinning deployment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		state, _ = h.store.ReadPin(site, id)
+		writeJSON(w, state)
+		eventType = events.DeploymentPinned
+		data["pinned_by"] = actor
+		data["reason"] = req.Reason
+	}
+
+	if h.events != nil {
+		h.events.Publish(events.Event{
+			Type:      eventType,
+			Site:      site,
+			RequestID: httplog.RequestID(r.Context()),
+			Data:      data,
+		})
+	}
+}
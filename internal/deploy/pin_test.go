@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/events"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+var adminCaps = []auth.Cap{{Access: "admin"}}
+
+func pinRequest(method, id, body string, caps []auth.Cap) *http.Request {
+	req := httptest.NewRequest(method, "/deploy/docs/"+id+"/pin", strings.NewReader(body))
+	req = withCaps(req, caps)
+	req = withIdentity(req, auth.Identity{LoginName: "alice@example.com"})
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestPinHandler_PinAndUnpin(t *testing.T) {
+	store := canarySite(t)
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("*", func(e events.Event) { got = append(got, e) })
+	h := NewPinHandler(store, bus)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, pinRequest("POST", "aaa11111", `{"reason":"audit"}`, adminCaps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var state storage.PinState
+	json.NewDecoder(rec.Body).Decode(&state)
+	if state.PinnedBy != "alice@example.com" || state.Reason != "audit" || state.PinnedAt.IsZero() {
+		t.Errorf("state = %+v", state)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, pinRequest("DELETE", "aaa11111", "", adminCaps))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unpin status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := store.ReadPin("docs", "aaa11111"); ok {
+		t.Error("deployment still pinned after unpinning")
+	}
+
+	// Unpinning again is a no-op without an event.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, pinRequest("DELETE", "aaa11111", "", adminCaps))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("second unpin status = %d", rec.Code)
+	}
+
+	if len(got) != 2 || got[0].Type != events.DeploymentPinned || got[1].Type != events.DeploymentUnpinned {
+		t.Fatalf("events = %+v, want pinned and unpinned", got)
+	}
+	if got[0].Data["pinned_by"] != "alice@example.com" || got[0].Data["reason"] != "audit" {
+		t.Errorf("pinned event data = %+v", got[0].Data)
+	}
+}
+
+func TestPinHandler_WithoutBody(t *testing.T) {
+	store := canarySite(t)
+	rec := httptest.NewRecorder()
+	NewPinHandler(store, nil).ServeHTTP(rec, pinRequest("POST", "bbb22222", "", adminCaps))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := store.ReadPin("docs", "bbb22222"); !ok {
+		t.Error("deployment not pinned")
+	}
+}
+
+func TestPinHandler_Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		body string
+		caps []auth.Cap
+		want int
+	}{
+		{"deployer", "aaa11111", "", []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}, http.StatusForbidden},
+		{"invalid body", "aaa11111", `reason`, adminCaps, http.StatusBadRequest},
+		{"unknown deployment", "ccc33333", "", adminCaps, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := canarySite(t)
+			rec := httptest.NewRecorder()
+			NewPinHandler(store, nil).ServeHTTP(rec, pinRequest("POST", tt.id, tt.body, tt.caps))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if len(store.PinnedDeployments("docs")) != 0 {
+				t.Error("rejected pin was stored")
+			}
+		})
+	}
+}
+
+func TestPinnedDeployment_BlocksActivation(t *testing.T) {
+	store := canarySite(t)
+	store.PinDeployment("docs", "aaa11111", storage.PinState{})
+	deployer := []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}}
+
+	req := httptest.NewRequest("POST", "/deploy/docs/bbb22222/activate", nil)
+	req = withCaps(req, deployer)
+	req.SetPathValue("site", "docs")
+	req.SetPathValue("id", "bbb22222")
+	rec := httptest.NewRecorder()
+	NewActivateHandler(store, newMockManager(), nil, storage.SiteConfig{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), string(problem.DeploymentPinned)) {
+		t.Errorf("activate status = %d, body = %s; want 409 %s", rec.Code, rec.Body.String(), problem.DeploymentPinned)
+	}
+
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+	upload := func(target string) *httptest.ResponseRecorder {
+		body := makeZip(t, map[string]string{"index.html": "<h1>Hi</h1>"})
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/zip")
+		req = withCaps(req, deployer)
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := upload("/deploy/docs"); rec.Code != http.StatusConflict {
+		t.Errorf("deploy status = %d, body = %s; want 409", rec.Code, rec.Body.String())
+	}
+	if rec := upload("/deploy/docs?activate=false"); rec.Code != http.StatusOK {
+		t.Errorf("deploy without activation status = %d, body = %s; want 200", rec.Code, rec.Body.String())
+	}
+	if cur, _ := store.CurrentDeployment("docs"); cur != "aaa11111" {
+		t.Errorf("current = %q, want the pinned aaa11111", cur)
+	}
+}
@@ -0,0 +1,127 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// DeployDiff summarizes how a deployment's files differ from those of the
+// deployment that was active before it.
+type DeployDiff struct {
+	Previous  string `json:"previous"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+	Changed   int    `json:"changed"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// maxDiffPaths caps each path list of a FileDiff, to keep webhook
+// payloads of large deployments small.
+const maxDiffPaths = 100
+
+// FileDiff is the file-level diff of a deployment against the one that was
+// active before it, sent with deploy.success. Against no previous
+// deployment, every file is added.
+type FileDiff struct {
+	DeployDiff
+	TotalFiles int `json:"total_files"`
+	// SizeDelta is the total size of the files minus that of the previous
+	// deployment's files, in bytes.
+	SizeDelta    int64    `json:"size_delta_bytes"`
+	AddedPaths   []string `json:"added_paths"`
+	RemovedPaths []string `json:"removed_paths"`
+	ChangedPaths []string `json:"changed_paths"`
+	// PathsTruncated is set if a path list was cut short at maxDiffPaths.
+	PathsTruncated bool `json:"paths_truncated,omitempty"`
+}
+
+// DeployTiming is the time spent on each step of a deployment, in
+// milliseconds. Steps that did not run are zero.
+type DeployTiming struct {
+	ExtractMS     int64 `json:"extract_ms"`
+	ValidateMS    int64 `json:"validate_ms"`
+	MinifyMS      int64 `json:"minify_ms,omitempty"`
+	IndexMS       int64 `json:"index_ms"`
+	PrecompressMS int64 `json:"precompress_ms,omitempty"`
+	ActivateMS    int64 `json:"activate_ms,omitempty"`
+	TotalMS       int64 `json:"total_ms"`
+}
+
+// since returns the milliseconds elapsed since t.
+func since(t time.Time) int64 { return time.Since(t).Milliseconds() }
+
+// fileDiff compares files with those of the deployment previous, path by
+// path.
+func fileDiff(files, prevFiles []storage.FileInfo, previous string) *FileDiff {
+	added, removed, changed := storage.DiffFiles(files, prevFiles)
+	diff := &FileDiff{
+		DeployDiff: DeployDiff{
+			Previous:  previous,
+			Added:     len(added),
+			Removed:   len(removed),
+			Changed:   len(changed),
+			Unchanged: len(files) - len(added) - len(changed),
+		},
+		TotalFiles: len(files),
+	}
+	for _, f := range files {
+		diff.SizeDelta += f.Size
+	}
+	for _, f := range prevFiles {
+		diff.SizeDelta -= f.Size
+	}
+	truncate := func(paths []string) []string {
+		if len(paths) > maxDiffPaths {
+			diff.PathsTruncated = true
+			paths = paths[:maxDiffPaths]
+		}
+		return append([]string{}, paths...)
+	}
+	diff.AddedPaths = truncate(added)
+	diff.RemovedPaths = truncate(removed)
+	diff.ChangedPaths = truncate(changed)
+	return diff
+}
+
+// configWarnings returns problems with the config of the deployment in
+// contentDir that do not prevent it from being served, but likely are
+// mistakes. cfg is the config of tspages.toml alone, and redirectsFile and
+// headersFile report whether _redirects and _headers had rules.
+func configWarnings(contentDir string, cfg, merged storage.SiteConfig, redirectsFile, headersFile bool) []string {
+	var warnings []string
+	exists := func(name string) bool {
+		info, err := os.Stat(filepath.Join(contentDir, filepath.FromSlash(name)))
+		return err == nil && !info.IsDir()
+	}
+
+	if redirectsFile && cfg.Redirects != nil {
+		warnings = append(warnings, "tspages.toml redirects replace the rules of _redirects")
+	}
+	if headersFile && cfg.Headers != nil {
+		warnings = append(warnings, "tspages.toml headers override the rules of _headers for the same paths")
+	}
+
+	indexPage := merged.IndexPage
+	if indexPage == "" {
+		indexPage = "index.html"
+	}
+	spa := merged.SPARouting != nil && *merged.SPARouting
+	listing := merged.DirectoryListing != nil && *merged.DirectoryListing
+	// Localized sites may only have suffixed index pages.
+	i18n := merged.I18n != nil && *merged.I18n
+	if !i18n && !exists(indexPage) {
+		switch {
+		case spa:
+			warnings = append(warnings, "spa_routing is enabled, but there is no "+indexPage+" to serve")
+		case !listing:
+			warnings = append(warnings, "there is no "+indexPage+" at the root, so the site's root responds with 404")
+		}
+	}
+	if merged.NotFoundPage != "" && merged.NotFoundPage != "404.html" && !exists(merged.NotFoundPage) {
+		warnings = append(warnings, "not_found_page "+merged.NotFoundPage+" does not exist; the built-in page is served instead")
+	}
+	return warnings
+}
@@ -0,0 +1,127 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestHandler_Report(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := NewHandler(HandlerConfig{Store: store, Manager: newMockManager(), MaxUploadMB: 10, MaxDeployments: 10, DNSSuffix: testDNSSuffix})
+	deploy := func(target string, files map[string]string) DeployResponse {
+		t.Helper()
+		req := httptest.NewRequest("POST", target, bytes.NewReader(makeZip(t, files)))
+		req.Header.Set("Content-Type", "application/zip")
+		req = withCaps(req, []auth.Cap{{Access: "deploy", Sites: []string{"docs"}}})
+		req.SetPathValue("site", "docs")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var resp DeployResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	first := deploy("/deploy/docs", map[string]string{
+		"index.html": "<h1>Hi</h1>",
+		"old.css":    "body{}",
+		"same.js":    "1",
+	})
+	if !first.Activated || first.Files != 3 || first.SizeBytes != 18 {
+		t.Errorf("first = %+v, want 3 activated files of 18 bytes", first)
+	}
+	if first.Diff != nil || len(first.Warnings) != 0 {
+		t.Errorf("first diff = %+v, warnings = %v; want none", first.Diff, first.Warnings)
+	}
+
+	second := deploy("/deploy/docs?activate=false", map[string]string{
+		"index.html": "<h1>Hello</h1>",
+		"new.css":    "p{}",
+		"same.js":    "1",
+	})
+	if second.Activated || second.Files != 3 {
+		t.Errorf("second = %+v, want 3 files, not activated", second)
+	}
+	want := DeployDiff{Previous: first.DeploymentID, Added: 1, Removed: 1, Changed: 1, Unchanged: 1}
+	if second.Diff == nil || *second.Diff != want {
+		t.Errorf("diff = %+v, want %+v", second.Diff, want)
+	}
+	if second.Timing.ActivateMS != 0 || second.Timing.TotalMS < second.Timing.ExtractMS {
+		t.Errorf("timing = %+v", second.Timing)
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name          string
+		files         []string
+		cfg           storage.SiteConfig
+		redirectsFile bool
+		headersFile   bool
+		want          int
+	}{
+		{"clean", []string{"index.html"}, storage.SiteConfig{}, false, false, 0},
+		{"no index page", []string{"about.html"}, storage.SiteConfig{}, false, false, 1},
+		{"directory listing", []string{"about.html"}, storage.SiteConfig{DirectoryListing: &yes}, false, false, 0},
+		{"localized", []string{"index.en.html"}, storage.SiteConfig{I18n: &yes}, false, false, 0},
+		{"spa without index", []string{"app.js"}, storage.SiteConfig{SPARouting: &yes}, false, false, 1},
+		{"custom index page", []string{"home.html"}, storage.SiteConfig{IndexPage: "home.html"}, false, false, 0},
+		{"missing 404 page", []string{"index.html"}, storage.SiteConfig{NotFoundPage: "missing.html"}, false, false, 1},
+		{"redirects replaced", []string{"index.html"}, storage.SiteConfig{Redirects: []storage.RedirectRule{{From: "/a", To: "/b"}}}, true, false, 1},
+		{"headers overridden", []string{"index.html"}, storage.SiteConfig{Headers: map[string]map[string]string{"/*": {"X-A": "1"}}}, false, true, 1},
+		{"netlify files only", []string{"index.html"}, storage.SiteConfig{}, true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+			}
+			got := configWarnings(dir, tt.cfg, tt.cfg, tt.redirectsFile, tt.headersFile)
+			if len(got) != tt.want {
+				t.Errorf("warnings = %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileDiff(t *testing.T) {
+	files := []storage.FileInfo{{Path: "a", Hash: "1", Size: 10}, {Path: "b", Hash: "2", Size: 500}}
+	prev := []storage.FileInfo{{Path: "a", Hash: "1", Size: 10}, {Path: "c", Hash: "3", Size: 200}}
+	got := fileDiff(files, prev, "aaa11111")
+	want := DeployDiff{Previous: "aaa11111", Added: 1, Removed: 1, Unchanged: 1}
+	if got.DeployDiff != want {
+		t.Errorf("diff = %+v, want %+v", got.DeployDiff, want)
+	}
+	if got.TotalFiles != 2 || got.SizeDelta != 300 {
+		t.Errorf("total files = %d, size delta = %d; want 2, 300", got.TotalFiles, got.SizeDelta)
+	}
+	if !slices.Equal(got.AddedPaths, []string{"b"}) || !slices.Equal(got.RemovedPaths, []string{"c"}) ||
+		len(got.ChangedPaths) != 0 || got.PathsTruncated {
+		t.Errorf("paths = %v, %v, %v (truncated %v)", got.AddedPaths, got.RemovedPaths, got.ChangedPaths, got.PathsTruncated)
+	}
+
+	// Long path lists are cut short.
+	var many []storage.FileInfo
+	for i := range maxDiffPaths + 5 {
+		many = append(many, storage.FileInfo{Path: fmt.Sprintf("f%d", i), Hash: "x", Size: 1})
+	}
+	got = fileDiff(many, nil, "")
+	if len(got.AddedPaths) != maxDiffPaths || !got.PathsTruncated || got.Added != maxDiffPaths+5 || got.SizeDelta != maxDiffPaths+5 {
+		t.Errorf("first deployment diff: %d paths, truncated %v, added %d, delta %d",
+			len(got.AddedPaths), got.PathsTruncated, got.Added, got.SizeDelta)
+	}
+}
@@ -0,0 +1,327 @@
+// Package deployindex keeps a SQLite index of every site's deployments, so
+// deployment lists can be ordered, filtered, and paginated without reading
+// the manifest of every deployment on disk.
+//
+// The filesystem stays the source of truth: the index is updated from it
+// whenever an event says a site's deployments changed, and Reconcile
+// rebuilds it from scratch.
+package deployindex
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/sqlmigrate"
+	"tspages/internal/storage"
+)
+
+// Query selects deployments to list.
+type Query struct {
+	// Sites limits the results to deployments of the given sites, or
+	// selects all sites if nil.
+	Sites []string
+	// Failed limits the results to failed deployments, and Succeeded to
+	// those that did not fail.
+	Failed, Succeeded bool
+	// Inactive limits the results to deployments that are not active.
+	Inactive bool
+	// CreatedBy limits the results to deployments created by the given
+	// name, ignoring case.
+	CreatedBy string
+	// Limit is the maximum number of deployments returned, or unlimited if
+	// zero. Offset skips as many of the newest ones first.
+	Limit, Offset int
+}
+
+// Entry is a deployment with the name of its site. Its commit range, if it
+// has one, has no compare URL, since that depends on the site's config.
+type Entry struct {
+	storage.DeploymentInfo
+	Site string `json:"site"`
+}
+
+// Index is the SQLite index of deployments.
+type Index struct {
+	db    *sql.DB
+	store *storage.Store
+	// mu serializes syncs, so that one reading the filesystem earlier
+	// cannot overwrite the rows of one that read it later.
+	mu sync.Mutex
+}
+
+// New creates an Index of the deployments in store and runs its migration.
+// db may be shared with analytics, so the migration version is tracked
+// separately.
+func New(db *sql.DB, store *storage.Store) (*Index, error) {
+	if err := sqlmigrate.ApplyScoped(db, "deployments", migrations); err != nil {
+		return nil, fmt.Errorf("deployment index migration: %w", err)
+	}
+	return &Index{db: db, store: store}, nil
+}
+
+var migrations = []func(*sql.Tx) error{
+	// 1: one row per deployment. info holds the storage.DeploymentInfo as
+	// JSON; the other columns are the ones lists are ordered and filtered by.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS deployments (
+				site       TEXT NOT NULL,
+				id         TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				active     INTEGER NOT NULL,
+				failed     INTEGER NOT NULL,
+				info       TEXT NOT NULL,
+				PRIMARY KEY (site, id)
+			)
+		`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_deployments_created_at ON deployments(created_at)`)
+		return err
+	},
+	// 2: who created each deployment, to filter by deployer.
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`ALTER TABLE deployments ADD COLUMN created_by TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE deployments SET created_by = COALESCE(json_extract(info, '$.created_by'), '')`)
+		return err
+	},
+}
+
+// Subscribe updates the index of a site whenever an event published on bus
+// may have changed its deployments. Updates run in the background.
+func (x *Index) Subscribe(bus *events.Bus) {
+	for _, pattern := range []string{"deploy.*", "deployment.*", "site.*"} {
+		bus.Subscribe(pattern, func(e events.Event) {
+			if e.Site == "" {
+				return
+			}
+			go func() {
+				if err := x.SyncSite(e.Site); err != nil {
+					slog.Warn("updating deployment index", "site", e.Site, "err", err)
+				}
+			}()
+		})
+	}
+}
+
+// SyncSite replaces the indexed deployments of site with those on disk. A
+// site that no longer exists loses all of its rows.
+func (x *Index) SyncSite(site string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	deployments, err := siteDeployments(x.store, site)
+	if err != nil {
+		return err
+	}
+	tx, err := x.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	if err := replaceSite(tx, site, deployments); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reconcile rebuilds the index from the deployments on disk, dropping the
+// rows of sites that no longer exist. It returns how many sites and
+// deployments it indexed.
+func (x *Index) Reconcile() (sites, deployments int, err error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	infos, err := x.store.ListSites()
+	if err != nil {
+		return 0, 0, fmt.Errorf("listing sites: %w", err)
+	}
+	bySite := make(map[string][]storage.DeploymentInfo, len(infos))
+	for _, s := range infos {
+		deps, err := siteDeployments(x.store, s.Name)
+		if err != nil {
+			return 0, 0, fmt.Errorf("listing deployments of %s: %w", s.Name, err)
+		}
+		bySite[s.Name] = deps
+		deployments += len(deps)
+	}
+
+	tx, err := x.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	if _, err := tx.Exec(`DELETE FROM deployments`); err != nil {
+		return 0, 0, err
+	}
+	for site, deps := range bySite {
+		if err := replaceSite(tx, site, deps); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return len(bySite), deployments, nil
+}
+
+// List returns the deployments selected by q, newest first, and how many
+// there are in total regardless of q.Limit and q.Offset.
+func (x *Index) List(q Query) ([]Entry, int, error) {
+	if q.Sites != nil && len(q.Sites) == 0 {
+		return []Entry{}, 0, nil
+	}
+	var (
+		where []string
+		args  []any
+	)
+	if q.Sites != nil {
+		where = append(where, "site IN (?"+strings.Repeat(", ?", len(q.Sites)-1)+")")
+		for _, s := range q.Sites {
+			args = append(args, s)
+		}
+	}
+	if q.Failed {
+		where = append(where, "failed = 1")
+	}
+	if q.Succeeded {
+		where = append(where, "failed = 0")
+	}
+	if q.Inactive {
+		where = append(where, "active = 0")
+	}
+	if q.CreatedBy != "" {
+		where = append(where, "created_by = ? COLLATE NOCASE")
+		args = append(args, q.CreatedBy)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := x.db.QueryRow(`SELECT COUNT(*) FROM deployments`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1 // no limit in SQLite
+	}
+	rows, err := x.db.Query(`SELECT site, info FROM deployments`+filter+`
+		ORDER BY created_at DESC, site, id DESC LIMIT ? OFFSET ?`, append(args, limit, max(q.Offset, 0))...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var (
+			e    Entry
+			info string
+		)
+		if err := rows.Scan(&e.Site, &info); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal([]byte(info), &e.DeploymentInfo); err != nil {
+			return nil, 0, fmt.Errorf("decoding deployment %s/%s: %w", e.Site, e.ID, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// Scan is List without an index: it reads the deployments selected by q
+// from disk. It serves lists when no index is configured.
+func Scan(store *storage.Store, q Query) ([]Entry, int, error) {
+	sites := q.Sites
+	if sites == nil {
+		infos, err := store.ListSites()
+		if err != nil {
+			return nil, 0, fmt.Errorf("listing sites: %w", err)
+		}
+		for _, s := range infos {
+			sites = append(sites, s.Name)
+		}
+	}
+
+	entries := []Entry{}
+	for _, site := range sites {
+		deps, err := siteDeployments(store, site)
+		if err != nil {
+			continue
+		}
+		for _, d := range deps {
+			if (q.Failed && !d.Failed) || (q.Succeeded && d.Failed) || (q.Inactive && d.Active) ||
+				(q.CreatedBy != "" && !strings.EqualFold(d.CreatedBy, q.CreatedBy)) {
+				continue
+			}
+			entries = append(entries, Entry{Site: site, DeploymentInfo: d})
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(
+			b.CreatedAt.Compare(a.CreatedAt),
+			strings.Compare(a.Site, b.Site),
+			strings.Compare(b.ID, a.ID),
+		)
+	})
+
+	total := len(entries)
+	entries = entries[min(max(q.Offset, 0), total):]
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, total, nil
+}
+
+// siteDeployments lists the deployments of site newest first, each with
+// its commit range to the one before it.
+func siteDeployments(store *storage.Store, site string) ([]storage.DeploymentInfo, error) {
+	deployments, err := store.ListDeployments(site)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(deployments, func(a, b storage.DeploymentInfo) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID, a.ID))
+	})
+	storage.SetCommitRanges(deployments, "")
+	return deployments, nil
+}
+
+// replaceSite replaces the rows of site with deployments in tx.
+func replaceSite(tx *sql.Tx, site string, deployments []storage.DeploymentInfo) error {
+	if _, err := tx.Exec(`DELETE FROM deployments WHERE site = ?`, site); err != nil {
+		return err
+	}
+	for _, d := range deployments {
+		info, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO deployments (site, id, created_at, active, failed, created_by, info) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			site, d.ID, createdAt(d.CreatedAt), d.Active, d.Failed, d.CreatedBy, string(info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createdAt converts t into the created_at column, which orders deployments
+// without a creation time before all others.
+func createdAt(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,200 @@
+package deployindex
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+func testIndex(t *testing.T) (*Index, *storage.Store) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := storage.New(t.TempDir())
+	x, err := New(db, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x, store
+}
+
+// deploy creates a complete deployment of site created by Alice at the
+// given hour of 2026-03-01, with the given commit.
+func deploy(t *testing.T, store *storage.Store, site, id string, hour int, commit string) {
+	t.Helper()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	m := storage.Manifest{Site: site, ID: id, CreatedBy: "Alice", CreatedAt: time.Date(2026, 3, 1, hour, 0, 0, 0, time.UTC)}
+	if commit != "" {
+		m.Build = &storage.BuildInfo{Commit: commit}
+	}
+	if err := store.WriteManifest(site, id, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkComplete(site, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupDeployments creates docs with three deployments, the middle one
+// failed and the newest active, and demo with one.
+func setupDeployments(t *testing.T, store *storage.Store) {
+	t.Helper()
+	deploy(t, store, "docs", "aaa11111", 1, "1111111aaaa")
+	deploy(t, store, "docs", "bbb22222", 3, "2222222bbbb")
+	store.MarkFailed("docs", "bbb22222", "invalid _headers")
+	deploy(t, store, "docs", "ccc33333", 4, "3333333cccc")
+	store.ActivateDeployment("docs", "ccc33333")
+	deploy(t, store, "demo", "ddd44444", 2, "")
+	store.WriteManifest("demo", "ddd44444", storage.Manifest{
+		Site: "demo", ID: "ddd44444", CreatedBy: "Bob", CreatedAt: time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC),
+	})
+}
+
+func ids(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Site+"/"+e.ID)
+	}
+	return out
+}
+
+func TestIndex_List(t *testing.T) {
+	x, store := testIndex(t)
+	setupDeployments(t, store)
+	if sites, deployments, err := x.Reconcile(); err != nil || sites != 2 || deployments != 4 {
+		t.Fatalf("Reconcile() = %d, %d, %v", sites, deployments, err)
+	}
+
+	tests := []struct {
+		name  string
+		q     Query
+		want  []string
+		total int
+	}{
+		{"all", Query{}, []string{"docs/ccc33333", "docs/bbb22222", "demo/ddd44444", "docs/aaa11111"}, 4},
+		{"site", Query{Sites: []string{"demo"}}, []string{"demo/ddd44444"}, 1},
+		{"no sites", Query{Sites: []string{}}, nil, 0},
+		{"failed", Query{Failed: true}, []string{"docs/bbb22222"}, 1},
+		{"succeeded", Query{Succeeded: true}, []string{"docs/ccc33333", "demo/ddd44444", "docs/aaa11111"}, 3},
+		{"deployer", Query{CreatedBy: "bob"}, []string{"demo/ddd44444"}, 1},
+		{"inactive", Query{Sites: []string{"docs"}, Inactive: true}, []string{"docs/bbb22222", "docs/aaa11111"}, 2},
+		{"page", Query{Limit: 2, Offset: 1}, []string{"docs/bbb22222", "demo/ddd44444"}, 4},
+		{"past the end", Query{Offset: 10}, nil, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, list := range map[string]func(Query) ([]Entry, int, error){
+				"index": x.List,
+				"scan":  func(q Query) ([]Entry, int, error) { return Scan(store, q) },
+			} {
+				got, total, err := list(tt.q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(ids(got), tt.want) || total != tt.total {
+					t.Errorf("%s: got %v (total %d), want %v (total %d)", name, ids(got), total, tt.want, tt.total)
+				}
+			}
+		})
+	}
+}
+
+func TestIndex_ListDetails(t *testing.T) {
+	x, store := testIndex(t)
+	setupDeployments(t, store)
+	x.Reconcile()
+
+	got, _, err := x.List(Query{Sites: []string{"docs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest, failed := got[0], got[1]
+	if !newest.Active || newest.Build == nil || newest.Build.Commit != "3333333cccc" {
+		t.Errorf("newest = %+v", newest)
+	}
+	// The failed deployment is skipped as the start of the range.
+	if newest.CommitRange == nil || newest.CommitRange.From != "1111111aaaa" || newest.CommitRange.CompareURL != "" {
+		t.Errorf("commit range = %+v", newest.CommitRange)
+	}
+	if !failed.Failed || failed.FailedReason != "invalid _headers" {
+		t.Errorf("failed = %+v", failed)
+	}
+}
+
+func TestIndex_SyncSite(t *testing.T) {
+	x, store := testIndex(t)
+	setupDeployments(t, store)
+	x.Reconcile()
+
+	deploy(t, store, "docs", "eee55555", 5, "")
+	store.DeleteDeployment("docs", "aaa11111")
+	if err := x.SyncSite("docs"); err != nil {
+		t.Fatal(err)
+	}
+	got, _, _ := x.List(Query{Sites: []string{"docs"}})
+	if want := []string{"docs/eee55555", "docs/ccc33333", "docs/bbb22222"}; !slices.Equal(ids(got), want) {
+		t.Errorf("after sync = %v, want %v", ids(got), want)
+	}
+
+	// A deleted site loses its rows.
+	store.DeleteSite("demo")
+	if err := x.SyncSite("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if got, total, _ := x.List(Query{Sites: []string{"demo"}}); len(got) != 0 || total != 0 {
+		t.Errorf("deleted site = %v", ids(got))
+	}
+}
+
+func TestIndex_ReconcileDropsMissingSites(t *testing.T) {
+	x, store := testIndex(t)
+	setupDeployments(t, store)
+	x.Reconcile()
+
+	store.DeleteSite("demo")
+	if sites, deployments, err := x.Reconcile(); err != nil || sites != 1 || deployments != 3 {
+		t.Fatalf("Reconcile() = %d, %d, %v", sites, deployments, err)
+	}
+	got, _, _ := x.List(Query{})
+	if want := []string{"docs/ccc33333", "docs/bbb22222", "docs/aaa11111"}; !slices.Equal(ids(got), want) {
+		t.Errorf("after reconcile = %v, want %v", ids(got), want)
+	}
+}
+
+func TestIndex_Subscribe(t *testing.T) {
+	x, store := testIndex(t)
+	bus := events.New()
+	x.Subscribe(bus)
+
+	deploy(t, store, "docs", "aaa11111", 1, "")
+	bus.Publish(events.Event{Type: events.HealthDegraded, Site: "docs"})
+	bus.Publish(events.Event{Type: events.DeploySuccess, Site: "docs"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _, err := x.List(Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Equal(ids(got), []string{"docs/aaa11111"}) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index = %v after deploy.success", ids(got))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,163 @@
+// Package digest compiles periodic per-site activity summaries and sends
+// them to Slack or email on a cron schedule.
+package digest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/storage"
+	"tspages/internal/webhook"
+)
+
+// Period is the span a digest covers, ending when it is sent.
+const Period = 7 * 24 * time.Hour
+
+// topPagesLimit is how many pages a site summary lists.
+const topPagesLimit = 5
+
+// SiteSummary is one site's activity during the digest period.
+type SiteSummary struct {
+	Site           string                `json:"site"`
+	Deployments    int                   `json:"deployments"`
+	Requests       int64                 `json:"requests"`
+	Visitors       int64                 `json:"visitors"`
+	TopPages       []analytics.PathCount `json:"top_pages"`
+	FailedWebhooks int64                 `json:"failed_webhooks"`
+}
+
+// Quiet reports whether the site saw no activity at all.
+func (s SiteSummary) Quiet() bool {
+	return s.Deployments == 0 && s.Requests == 0 && s.FailedWebhooks == 0
+}
+
+// Digest is a summary of all sites over [From, To).
+type Digest struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Sites []SiteSummary `json:"sites"`
+}
+
+// Compiler gathers site activity from storage, analytics, and the webhook
+// delivery log.
+type Compiler struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	notifier *webhook.Notifier
+	// sites limits the digest to these sites; empty includes every site.
+	sites []string
+}
+
+// NewCompiler returns a Compiler for sites, or for every site if sites is
+// empty.
+func NewCompiler(store *storage.Store, recorder *analytics.Recorder, notifier *webhook.Notifier, sites []string) *Compiler {
+	return &Compiler{store: store, recorder: recorder, notifier: notifier, sites: sites}
+}
+
+// Compile summarizes activity between from and to.
+func (c *Compiler) Compile(from, to time.Time) (Digest, error) {
+	sites := c.sites
+	if len(sites) == 0 {
+		infos, err := c.store.ListSites()
+		if err != nil {
+			return Digest{}, err
+		}
+		for _, info := range infos {
+			sites = append(sites, info.Name)
+		}
+	}
+
+	d := Digest{From: from, To: to, Sites: make([]SiteSummary, 0, len(sites))}
+	for _, site := range sites {
+		summary, err := c.summarize(site, from, to)
+		if err != nil {
+			return Digest{}, fmt.Errorf("summarizing %s: %w", site, err)
+		}
+		d.Sites = append(d.Sites, summary)
+	}
+	return d, nil
+}
+
+func (c *Compiler) summarize(site string, from, to time.Time) (SiteSummary, error) {
+	s := SiteSummary{Site: site}
+	deployments, err := c.store.ListDeployments(site)
+	if err != nil {
+		return s, err
+	}
+	for _, dep := range deployments {
+		if !dep.Failed && !dep.CreatedAt.Before(from) && dep.CreatedAt.Before(to) {
+			s.Deployments++
+		}
+	}
+
+	if c.recorder != nil {
+		if s.Requests, err = c.recorder.TotalRequests(site, from, to); err != nil {
+			return s, err
+		}
+		if s.Visitors, err = c.recorder.UniqueVisitors(site, from, to); err != nil {
+			return s, err
+		}
+		if s.TopPages, err = c.recorder.TopPages(site, from, to, topPagesLimit); err != nil {
+			return s, err
+		}
+	}
+	if c.notifier != nil {
+		if _, _, s.FailedWebhooks, err = c.notifier.DeliveryStats(site, from, to); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// Subject is the digest's one-line title.
+func (d Digest) Subject() string {
+	return fmt.Sprintf("tspages digest: %s to %s", d.From.Format("Jan 2"), d.To.Format("Jan 2, 2006"))
+}
+
+// Text renders the digest as plain text, one block per active site
+// followed by a line naming the quiet ones.
+func (d Digest) Text() string {
+	var b strings.Builder
+	b.WriteString(d.Subject())
+	b.WriteString("\n")
+
+	var quiet []string
+	for _, s := range d.Sites {
+		if s.Quiet() {
+			quiet = append(quiet, s.Site)
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n  %s, %s, %s",
+			s.Site,
+			plural(int64(s.Deployments), "deployment"),
+			plural(s.Requests, "request"),
+			plural(s.Visitors, "visitor"))
+		if s.FailedWebhooks > 0 {
+			fmt.Fprintf(&b, ", %s", plural(s.FailedWebhooks, "failed webhook"))
+		}
+		b.WriteString("\n")
+		if len(s.TopPages) > 0 {
+			pages := make([]string, len(s.TopPages))
+			for i, p := range s.TopPages {
+				pages[i] = fmt.Sprintf("%s (%d)", p.Path, p.Count)
+			}
+			fmt.Fprintf(&b, "  Top pages: %s\n", strings.Join(pages, ", "))
+		}
+	}
+	switch {
+	case len(d.Sites) == 0:
+		b.WriteString("\nNo sites.\n")
+	case len(quiet) > 0:
+		fmt.Fprintf(&b, "\nNo activity: %s\n", strings.Join(quiet, ", "))
+	}
+	return b.String()
+}
+
+func plural(n int64, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
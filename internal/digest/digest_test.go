@@ -0,0 +1,138 @@
+package digest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/storage"
+	"tspages/internal/webhook"
+)
+
+func setupDigest(t *testing.T, now time.Time) *Compiler {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	deploy := func(site, id string, at time.Time) {
+		store.CreateDeployment(site, id)
+		store.WriteManifest(site, id, storage.Manifest{CreatedAt: at})
+		store.MarkComplete(site, id)
+		store.ActivateDeployment(site, id)
+	}
+	deploy("docs", "aaa11111", now.Add(-2*24*time.Hour))
+	deploy("docs", "bbb22222", now.Add(-time.Hour))
+	deploy("docs", "ccc33333", now.Add(-10*24*time.Hour))
+	deploy("quiet", "ddd44444", now.Add(-30*24*time.Hour))
+
+	rec, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rec.Close() })
+	rec.Import([]analytics.Event{
+		{Timestamp: now.Add(-time.Hour), Site: "docs", Path: "/", Status: 200, UserLogin: "alice@example.com"},
+		{Timestamp: now.Add(-time.Hour), Site: "docs", Path: "/", Status: 200, UserLogin: "bob@example.com"},
+		{Timestamp: now.Add(-time.Hour), Site: "docs", Path: "/guide/", Status: 200, UserLogin: "alice@example.com"},
+		{Timestamp: now.Add(-9 * 24 * time.Hour), Site: "docs", Path: "/old/", Status: 200},
+	})
+
+	notifier, err := webhook.NewNotifier(rec.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.DB().Exec(`INSERT INTO webhook_deliveries (webhook_id, event, site, url, payload, attempt, status, created_at)
+		VALUES ('msg_1', 'deploy.success', 'docs', 'https://x', '{}', 1, 500, ?)`, now.Add(-time.Hour).UTC().Format(time.RFC3339))
+
+	return NewCompiler(store, rec, notifier, nil)
+}
+
+func TestCompile(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	c := setupDigest(t, now)
+
+	d, err := c.Compile(now.Add(-Period), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Sites) != 2 {
+		t.Fatalf("sites = %+v", d.Sites)
+	}
+	docs := d.Sites[0]
+	if docs.Site != "docs" || docs.Deployments != 2 || docs.Requests != 3 || docs.Visitors != 2 || docs.FailedWebhooks != 1 {
+		t.Errorf("docs = %+v", docs)
+	}
+	if len(docs.TopPages) != 2 || docs.TopPages[0].Path != "/" || docs.TopPages[0].Count != 2 {
+		t.Errorf("top pages = %+v", docs.TopPages)
+	}
+	if !d.Sites[1].Quiet() {
+		t.Errorf("quiet = %+v", d.Sites[1])
+	}
+
+	text := d.Text()
+	for _, want := range []string{"2 deployments, 3 requests, 2 visitors, 1 failed webhook", "Top pages: / (2), /guide/ (1)", "No activity: quiet"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text missing %q:\n%s", want, text)
+		}
+	}
+
+	// A site filter limits the digest.
+	c.sites = []string{"quiet"}
+	d, _ = c.Compile(now.Add(-Period), now)
+	if len(d.Sites) != 1 || d.Sites[0].Site != "quiet" {
+		t.Errorf("filtered sites = %+v", d.Sites)
+	}
+}
+
+func TestSlack_Send(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	d := Digest{From: time.Now().Add(-Period), To: time.Now(), Sites: []SiteSummary{{Site: "docs", Requests: 5}}}
+	if err := NewSlack(srv.URL).Send(d); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got["text"], "docs") {
+		t.Errorf("text = %q", got["text"])
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+	if err := NewSlack(failing.URL).Send(d); err == nil {
+		t.Error("expected error for 404")
+	}
+}
+
+func TestEmail_Send(t *testing.T) {
+	e := NewEmail("smtp.example.com", 587, "user", "secret", "tspages@example.com", []string{"a@example.com", "b@example.com"})
+	var addr string
+	var to []string
+	var msg []byte
+	var auth smtp.Auth
+	e.sendMail = func(a string, au smtp.Auth, from string, rcpt []string, m []byte) error {
+		addr, auth, to, msg = a, au, rcpt, m
+		return nil
+	}
+
+	d := Digest{From: time.Now().Add(-Period), To: time.Now(), Sites: []SiteSummary{{Site: "docs", Requests: 5}}}
+	if err := e.Send(d); err != nil {
+		t.Fatal(err)
+	}
+	if addr != "smtp.example.com:587" || auth == nil || len(to) != 2 {
+		t.Errorf("addr = %q, auth = %v, to = %v", addr, auth, to)
+	}
+	for _, want := range []string{"Subject: tspages digest: ", "To: a@example.com, b@example.com\r\n", "\r\n\r\ntspages digest", "docs\r\n"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package digest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Scheduler compiles and sends a digest each time its schedule fires.
+type Scheduler struct {
+	schedule Schedule
+	compiler *Compiler
+	senders  []Sender
+}
+
+// NewScheduler returns a Scheduler that sends digests compiled by compiler
+// to every sender.
+func NewScheduler(schedule Schedule, compiler *Compiler, senders ...Sender) *Scheduler {
+	return &Scheduler{schedule: schedule, compiler: compiler, senders: senders}
+}
+
+// Run sends a digest at every scheduled time until ctx ends. A digest
+// covers the Period before the time it is sent.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("digest schedule never fires")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.Send(next)
+	}
+}
+
+// Send compiles the digest for the Period ending at to and delivers it to
+// every sender. A failing sender does not keep the others from receiving
+// it.
+func (s *Scheduler) Send(to time.Time) {
+	d, err := s.compiler.Compile(to.Add(-Period), to)
+	if err != nil {
+		slog.Error("compiling digest", "err", err)
+		return
+	}
+	sent := 0
+	for _, sender := range s.senders {
+		if err := sender.Send(d); err != nil {
+			slog.Error("sending digest", "err", err)
+			continue
+		}
+		sent++
+	}
+	slog.Info("sent digest", "sites", len(d.Sites), "destinations", sent)
+}
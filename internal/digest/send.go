@@ -0,0 +1,101 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is what a Sender delivers: a digest, or another report sent to
+// the digest's destinations.
+type Message interface {
+	Subject() string
+	Text() string
+}
+
+// Sender delivers a message to one destination.
+type Sender interface {
+	Send(m Message) error
+}
+
+// Slack posts messages to a Slack incoming webhook URL.
+type Slack struct {
+	URL    string
+	client *http.Client
+}
+
+// NewSlack returns a Sender that posts to the incoming webhook at url.
+func NewSlack(url string) *Slack {
+	return &Slack{URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *Slack) Send(m Message) error {
+	payload, err := json.Marshal(map[string]string{"text": m.Text()})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("slack: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Email sends messages as plain-text mail through an SMTP server. The
+// connection is upgraded with STARTTLS when the server supports it.
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+
+	// sendMail is smtp.SendMail, replaced in tests.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmail returns a Sender that mails messages from from to the to
+// addresses. Username and password are optional.
+func NewEmail(host string, port int, username, password, from string, to []string) *Email {
+	return &Email{Host: host, Port: port, Username: username, Password: password,
+		From: from, To: to, sendMail: smtp.SendMail}
+}
+
+func (e *Email) Send(m Message) error {
+	var a smtp.Auth
+	if e.Username != "" {
+		a = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	if err := e.sendMail(addr, a, e.From, e.To, e.message(m, time.Now())); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
+
+// message builds the RFC 5322 message for m, dated date.
+func (e *Email) message(m Message, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Text(), "\n", "\r\n"))
+	return b.Bytes()
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"tspages/internal/storage"
+)
+
+// RecordActivity appends every event published on b to the activity log of
+// its site, and events without a site, such as health transitions, to the
+// server-wide log. Startup progress is only summarized, by startup.complete.
+// It returns a function that stops recording.
+func RecordActivity(b *Bus, store *storage.Store) (unsubscribe func()) {
+	return b.Subscribe("*", func(e Event) {
+		if e.Type == StartupProgress {
+			return
+		}
+		entry := storage.ActivityEntry{
+			Time:         e.Time,
+			Type:         e.Type,
+			Actor:        dataString(e.Data, "created_by", "activated_by", "deleted_by", "purged_by", "started_by", "stopped_by", "pinned_by", "unpinned_by", "restarted_by", "erased_by"),
+			DeploymentID: dataString(e.Data, "deployment_id"),
+			Detail:       activityDetail(e),
+			RequestID:    e.RequestID,
+		}
+		if err := store.AppendActivity(e.Site, entry); err != nil {
+			slog.Warn("recording activity failed", "type", e.Type, "site", e.Site, "err", err)
+		}
+	})
+}
+
+// activityDetail summarizes what an event's data says beyond its type.
+func activityDetail(e Event) string {
+	switch e.Type {
+	case DeployFailed:
+		return dataString(e.Data, "error")
+	case DeploymentActivated:
+		if previous := dataString(e.Data, "previous_deployment_id"); previous != "" {
+			return "replaced " + previous
+		}
+	case DeploymentDeleted:
+		if count, ok := e.Data["count"].(int); ok {
+			return fmt.Sprintf("%d inactive deployments %s", count, dataString(e.Data, "reason"))
+		}
+	case DeploymentPinned:
+		return dataString(e.Data, "reason")
+	case ConfigChanged:
+		changed, _ := e.Data["changed"].([]string)
+		return "changed " + strings.Join(changed, ", ")
+	case CachePurged:
+		purged, _ := e.Data["purged"].(int)
+		files := "files"
+		if purged == 1 {
+			files = "file"
+		}
+		if prefix := dataString(e.Data, "prefix"); prefix != "" {
+			return fmt.Sprintf("%d cached %s under %s", purged, files, prefix)
+		}
+		return fmt.Sprintf("%d cached %s", purged, files)
+	case CanaryStarted:
+		if percent, ok := e.Data["percent"].(int); ok {
+			return fmt.Sprintf("serving to %d%% of visitors", percent)
+		}
+	case HealthDegraded, HealthRecovered:
+		return "control plane " + dataString(e.Data, "status")
+	case SiteTransferCapExceeded:
+		used, _ := e.Data["bytes"].(int64)
+		capBytes, _ := e.Data["cap_bytes"].(int64)
+		return fmt.Sprintf("%d of %d MiB transferred in %v", used>>20, capBytes>>20, e.Data["month"])
+	case AnalyticsAnomaly:
+		factor, _ := e.Data["factor"].(int)
+		return fmt.Sprintf("%s deviates %d× from the baseline", dataString(e.Data, "metric"), factor)
+	case OperatorAlert, ServerRestarted:
+		return dataString(e.Data, "error")
+	case UserErased:
+		return "replaced with " + dataString(e.Data, "token")
+	case StartupComplete:
+		started, _ := e.Data["started"].(int)
+		total, _ := e.Data["total"].(int)
+		return fmt.Sprintf("%d of %d sites started", started, total)
+	}
+	return ""
+}
+
+// dataString returns the first of keys that is a non-empty string in data.
+func dataString(data map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := data[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"testing"
+
+	"tspages/internal/storage"
+)
+
+func TestRecordActivity(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateDeployment("docs", "aaa11111")
+	b := New()
+	unsubscribe := RecordActivity(b, store)
+
+	b.Publish(Event{Type: DeploySuccess, Site: "docs", RequestID: "req-1", Data: map[string]any{
+		"deployment_id": "aaa11111", "created_by": "alice",
+	}})
+	b.Publish(Event{Type: ConfigChanged, Site: "docs", Data: map[string]any{
+		"deployment_id": "aaa11111", "changed": []string{"headers", "redirects"},
+	}})
+	b.Publish(Event{Type: HealthDegraded, Data: map[string]any{"status": "degraded"}})
+	b.Publish(Event{Type: StartupProgress, Data: map[string]any{"site": "docs", "started": 1, "total": 2}})
+	b.Publish(Event{Type: StartupComplete, Data: map[string]any{"started": 1, "total": 2}})
+	unsubscribe()
+	b.Publish(Event{Type: DeployFailed, Site: "docs"})
+
+	entries, err := store.ListActivity("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", entries)
+	}
+	if e := entries[1]; e.Type != DeploySuccess || e.Actor != "alice" || e.DeploymentID != "aaa11111" || e.RequestID != "req-1" {
+		t.Errorf("deploy entry = %+v", e)
+	}
+	if e := entries[0]; e.Detail != "changed headers, redirects" {
+		t.Errorf("config entry detail = %q", e.Detail)
+	}
+
+	server, _ := store.ListActivity("")
+	if len(server) != 2 || server[1].Detail != "control plane degraded" || server[0].Detail != "1 of 2 sites started" {
+		t.Errorf("server-wide entries = %+v", server)
+	}
+}
+
+func TestActivityDetail_CachePurged(t *testing.T) {
+	for _, tt := range []struct {
+		data map[string]any
+		want string
+	}{
+		{map[string]any{"purged": 3}, "3 cached files"},
+		{map[string]any{"purged": 1, "prefix": "/assets/"}, "1 cached file under /assets/"},
+	} {
+		if got := activityDetail(Event{Type: CachePurged, Data: tt.data}); got != tt.want {
+			t.Errorf("activityDetail(%v) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package events is an in-process publish/subscribe bus for platform events.
+// Deploy handlers, site lifecycle, and health checks publish to it; webhooks,
+// metrics, logging, and the admin event stream subscribe.
+package events
+
+import (
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// Event types published on the bus.
+const (
+	DeploySuccess           = "deploy.success"
+	DeployFailed            = "deploy.failed"
+	SiteCreated             = "site.created"
+	SiteDeleted             = "site.deleted"
+	HealthDegraded          = "health.degraded"
+	HealthRecovered         = "health.recovered"
+	SiteTransferCapExceeded = "site.transfer_cap_exceeded"
+	AnalyticsAnomaly        = "analytics.anomaly"
+	DeploymentActivated     = "deployment.activated"
+	DeploymentDeleted       = "deployment.deleted"
+	DeploymentPinned        = "deployment.pinned"
+	DeploymentUnpinned      = "deployment.unpinned"
+	ConfigChanged           = "config.changed"
+	CachePurged             = "cache.purged"
+	CanaryStarted           = "canary.started"
+	CanaryStopped           = "canary.stopped"
+	OperatorAlert           = "operator.alert"
+	StartupProgress         = "startup.progress"
+	StartupComplete         = "startup.complete"
+	ServerRestarted         = "server.restarted"
+	UserErased              = "user.erased"
+)
+
+// Event is a single occurrence published on the bus.
+type Event struct {
+	Type string         `json:"type"`
+	Site string         `json:"site,omitempty"`
+	Time time.Time      `json:"time"`
+	Data map[string]any `json:"data,omitempty"`
+	// RequestID is the ID of the request that caused the event, if any.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Config is the site's merged configuration when the event happened,
+	// for subscribers with per-site settings such as webhook destinations.
+	// It is never serialized, since it may hold secrets.
+	Config storage.SiteConfig `json:"-"`
+}
+
+// Handler receives events. Handlers run synchronously on the publishing
+// goroutine and must not block; slow work belongs in a goroutine.
+type Handler func(Event)
+
+type subscription struct {
+	id      int
+	pattern string
+	fn      Handler
+}
+
+// Bus fans out published events to matching subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	next int
+	subs []subscription
+}
+
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers fn for events whose type matches pattern, a
+// path.Match pattern such as "deploy.success", "deploy.*", or "*". It
+// returns a function that removes the subscription.
+func (b *Bus) Subscribe(pattern string, fn Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs = append(b.subs, subscription{id: id, pattern: pattern, fn: fn})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs = slices.DeleteFunc(b.subs, func(s subscription) bool { return s.id == id })
+	}
+}
+
+// Publish delivers e to every matching subscriber, in subscription order.
+// A zero Time is set to the current time.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b.mu.RLock()
+	var matched []Handler
+	for _, s := range b.subs {
+		if ok, _ := path.Match(s.pattern, e.Type); ok {
+			matched = append(matched, s.fn)
+		}
+	}
+	b.mu.RUnlock()
+	for _, fn := range matched {
+		fn(e)
+	}
+}
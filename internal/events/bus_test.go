@@ -0,0 +1,80 @@
+package events
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBus_PatternMatching(t *testing.T) {
+	b := New()
+	var exact, prefix, all []string
+	b.Subscribe(DeploySuccess, func(e Event) { exact = append(exact, e.Type) })
+	b.Subscribe("deploy.*", func(e Event) { prefix = append(prefix, e.Type) })
+	b.Subscribe("*", func(e Event) { all = append(all, e.Type) })
+
+	for _, typ := range []string{DeploySuccess, DeployFailed, SiteCreated} {
+		b.Publish(Event{Type: typ, Site: "docs"})
+	}
+
+	if !slices.Equal(exact, []string{DeploySuccess}) {
+		t.Errorf("exact = %v", exact)
+	}
+	if !slices.Equal(prefix, []string{DeploySuccess, DeployFailed}) {
+		t.Errorf("prefix = %v", prefix)
+	}
+	if !slices.Equal(all, []string{DeploySuccess, DeployFailed, SiteCreated}) {
+		t.Errorf("all = %v", all)
+	}
+}
+
+func TestBus_SubscriptionOrder(t *testing.T) {
+	b := New()
+	var order []int
+	for i := range 3 {
+		b.Subscribe("*", func(Event) { order = append(order, i) })
+	}
+	b.Publish(Event{Type: SiteCreated})
+	if !slices.Equal(order, []int{0, 1, 2}) {
+		t.Errorf("order = %v, want [0 1 2]", order)
+	}
+}
+
+func TestBus_Unsubscribe(t *testing.T) {
+	b := New()
+	var calls int
+	unsubscribe := b.Subscribe("*", func(Event) { calls++ })
+	b.Publish(Event{Type: SiteCreated})
+	unsubscribe()
+	b.Publish(Event{Type: SiteCreated})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestBus_SetsTime(t *testing.T) {
+	b := New()
+	var got Event
+	b.Subscribe("*", func(e Event) { got = e })
+
+	before := time.Now()
+	b.Publish(Event{Type: SiteCreated})
+	if got.Time.Before(before.Add(-time.Second)) || got.Time.IsZero() {
+		t.Errorf("time = %v, want about %v", got.Time, before)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	b.Publish(Event{Type: SiteCreated, Time: at})
+	if !got.Time.Equal(at) {
+		t.Errorf("time = %v, want %v", got.Time, at)
+	}
+}
+
+func TestBus_SubscribeDuringPublish(t *testing.T) {
+	b := New()
+	b.Subscribe("*", func(Event) {
+		// Handlers may subscribe without deadlocking the bus.
+		b.Subscribe("*", func(Event) {})
+	})
+	b.Publish(Event{Type: SiteCreated})
+}
@@ -0,0 +1,162 @@
+// Package fieldcrypt encrypts single database fields, such as the user
+// identifiers in analytics events and webhook payloads, with a key from the
+// server config, for installations that must not store them in plain text.
+//
+// Encrypted values are strings prefixed with "enc:v1:", so a database can
+// hold plain values written before encryption was turned on next to
+// encrypted ones; Decrypt returns plain values as they are.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix marks an encrypted value.
+const Prefix = "enc:v1:"
+
+// KeySize is the size of a key in bytes, before base64 encoding.
+const KeySize = 32
+
+// Cipher encrypts and decrypts fields. A nil *Cipher stores values as they
+// are, so callers need not check whether encryption is on.
+type Cipher struct {
+	aead         cipher.AEAD
+	nonceKey     []byte
+	pseudonymKey []byte
+}
+
+// ParseKey decodes a base64 encoded key of KeySize bytes, as generated by
+// `openssl rand -base64 32`.
+func ParseKey(key string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64: %w", err)
+	}
+	if len(b) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(b))
+	}
+	return b, nil
+}
+
+// New returns a Cipher for a key in the format ParseKey reads. An empty
+// key returns nil, which leaves values unencrypted.
+func New(key string) (*Cipher, error) {
+	if key == "" {
+		return nil, nil
+	}
+	master, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derive(master, "tspages field encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{
+		aead:         aead,
+		nonceKey:     derive(master, "tspages field nonce"),
+		pseudonymKey: derive(master, "tspages pseudonym"),
+	}, nil
+}
+
+// derive returns a subkey of master for purpose, so the encryption and
+// nonce keys are independent.
+func derive(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Encrypt encrypts s with a random nonce, for values that are only read
+// back. Empty values stay empty.
+func (c *Cipher) Encrypt(s string) string {
+	if c == nil || s == "" {
+		return s
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("fieldcrypt: reading random nonce: %v", err))
+	}
+	return c.seal(nonce, s)
+}
+
+// EncryptDeterministic encrypts s so that equal values encrypt equally,
+// for columns that queries group, count, or look up by. The nonce is
+// derived from s, which reveals which rows share a value but not the value.
+// Empty values stay empty, so queries can still tell them apart.
+func (c *Cipher) EncryptDeterministic(s string) string {
+	if c == nil || s == "" {
+		return s
+	}
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write([]byte(s))
+	return c.seal(mac.Sum(nil)[:c.aead.NonceSize()], s)
+}
+
+// Pseudonym returns a stable token of 16 hex digits standing in for s, such
+// as for a user whose data was erased. With a key, tokens cannot be traced
+// back to s without it; a nil Cipher hashes s without a key, so a token can
+// be matched against guessed values.
+func (c *Cipher) Pseudonym(s string) string {
+	key := []byte("tspages pseudonym")
+	if c != nil {
+		key = c.pseudonymKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (c *Cipher) seal(nonce []byte, s string) string {
+	sealed := c.aead.Seal(nonce, nonce, []byte(s), nil)
+	return Prefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// ErrNoKey is returned when decrypting an encrypted value without a key.
+var ErrNoKey = errors.New("fieldcrypt: value is encrypted but no encryption key is configured")
+
+// Decrypt returns the plain text of a value written by Encrypt or
+// EncryptDeterministic. Values without the encrypted prefix are returned
+// as they are.
+func (c *Cipher) Decrypt(s string) (string, error) {
+	data, ok := strings.CutPrefix(s, Prefix)
+	if !ok {
+		return s, nil
+	}
+	if c == nil {
+		return "", ErrNoKey
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("fieldcrypt: malformed encrypted value")
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", errors.New("fieldcrypt: decrypting value failed; was it encrypted with another key?")
+	}
+	return string(plain), nil
+}
+
+// Reveal is Decrypt for display: a value that cannot be decrypted is shown
+// as "[encrypted]" instead of failing the whole query.
+func (c *Cipher) Reveal(s string) string {
+	plain, err := c.Decrypt(s)
+	if err != nil {
+		return "[encrypted]"
+	}
+	return plain
+}
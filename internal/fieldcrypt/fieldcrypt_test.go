@@ -0,0 +1,99 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func newCipher(t *testing.T, key string) *Cipher {
+	t.Helper()
+	c, err := New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCipher_RoundTrip(t *testing.T) {
+	c := newCipher(t, testKey)
+	for _, encrypt := range []func(string) string{c.Encrypt, c.EncryptDeterministic} {
+		enc := encrypt("alice@example.com")
+		if !strings.HasPrefix(enc, Prefix) || strings.Contains(enc, "alice") {
+			t.Fatalf("encrypted = %q", enc)
+		}
+		got, err := c.Decrypt(enc)
+		if err != nil || got != "alice@example.com" {
+			t.Errorf("Decrypt = %q, %v", got, err)
+		}
+	}
+}
+
+func TestCipher_Deterministic(t *testing.T) {
+	c := newCipher(t, testKey)
+	if c.EncryptDeterministic("alice") != c.EncryptDeterministic("alice") {
+		t.Error("deterministic encryption differs for equal values")
+	}
+	if c.EncryptDeterministic("alice") == c.EncryptDeterministic("bob") {
+		t.Error("deterministic encryption equal for different values")
+	}
+	if c.Encrypt("alice") == c.Encrypt("alice") {
+		t.Error("random encryption equal for equal values")
+	}
+}
+
+func TestCipher_PlainValues(t *testing.T) {
+	c := newCipher(t, testKey)
+	if c.Encrypt("") != "" || c.EncryptDeterministic("") != "" {
+		t.Error("empty value was encrypted")
+	}
+	if got, err := c.Decrypt("alice"); err != nil || got != "alice" {
+		t.Errorf("Decrypt of a plain value = %q, %v", got, err)
+	}
+
+	var none *Cipher
+	if none.Encrypt("alice") != "alice" || none.EncryptDeterministic("alice") != "alice" {
+		t.Error("nil cipher encrypted")
+	}
+	if _, err := none.Decrypt(c.Encrypt("alice")); err != ErrNoKey {
+		t.Errorf("nil cipher Decrypt err = %v, want ErrNoKey", err)
+	}
+	if got := none.Reveal(c.Encrypt("alice")); got != "[encrypted]" {
+		t.Errorf("Reveal = %q", got)
+	}
+}
+
+func TestCipher_Pseudonym(t *testing.T) {
+	c := newCipher(t, testKey)
+	var none *Cipher
+	for _, c := range []*Cipher{c, none} {
+		p := c.Pseudonym("alice")
+		if len(p) != 16 || p != c.Pseudonym("alice") || p == c.Pseudonym("bob") {
+			t.Errorf("Pseudonym = %q", p)
+		}
+	}
+	if c.Pseudonym("alice") == none.Pseudonym("alice") {
+		t.Error("keyed pseudonym equals the unkeyed one")
+	}
+}
+
+func TestCipher_WrongKey(t *testing.T) {
+	enc := newCipher(t, testKey).Encrypt("alice")
+	other := newCipher(t, base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")))
+	if _, err := other.Decrypt(enc); err == nil {
+		t.Error("decrypted with another key")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c := newCipher(t, ""); c != nil {
+		t.Error("empty key returned a cipher")
+	}
+	for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := New(key); err == nil {
+			t.Errorf("New(%q) succeeded", key)
+		}
+	}
+}
@@ -1,11 +1,54 @@
 package httplog
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log/slog"
 	"net/http"
 	"time"
 )
 
+// RequestIDHeader carries a request's ID in requests and responses.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a
+// request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 16-character hex ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a client-supplied ID is safe to adopt:
+// up to 64 letters, digits, dots, dashes, and underscores.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
@@ -21,18 +64,63 @@ func (r *statusRecorder) Unwrap() http.ResponseWriter {
 }
 
 // Wrap returns an http.Handler that logs each request with method, path,
-// status code, and duration. Extra slog attributes (e.g. site name) are
-// prepended to every log line.
+// status code, duration, and request ID. Extra slog attributes (e.g. site
+// name) are prepended to every log line.
+//
+// The request ID is taken from the X-Request-Id request header if it is
+// well-formed, and generated otherwise. It is echoed in the response and
+// stored in the request's context for RequestID.
 func Wrap(h http.Handler, attrs ...slog.Attr) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+
 		rec := &statusRecorder{ResponseWriter: w, status: 200}
 		start := time.Now()
 		h.ServeHTTP(rec, r)
-		args := make([]any, 0, len(attrs)+4)
+		args := make([]any, 0, len(attrs)+5)
 		for _, a := range attrs {
 			args = append(args, a)
 		}
-		args = append(args, "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start))
+		args = append(args, "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start), "request_id", id)
 		slog.Info("request", args...)
 	})
 }
+
+// NewHandler wraps h so that records logged with a request's context, such
+// as through slog.ErrorContext(r.Context(), ...), carry its request ID.
+func NewHandler(h slog.Handler) slog.Handler {
+	return contextHandler{h}
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" && !hasAttr(r, "request_id") {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
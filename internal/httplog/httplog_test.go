@@ -1,9 +1,12 @@
 package httplog
 
 import (
+	"bytes"
+	"context"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -53,3 +56,60 @@ func TestWrap_WithAttrs(t *testing.T) {
 		t.Errorf("response status = %d, want 200", rec.Code)
 	}
 }
+
+func TestWrap_RequestID(t *testing.T) {
+	var got string
+	h := Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestID(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if len(got) != 16 {
+		t.Errorf("generated request ID = %q, want 16 hex characters", got)
+	}
+	if rec.Header().Get(RequestIDHeader) != got {
+		t.Errorf("response header = %q, want %q", rec.Header().Get(RequestIDHeader), got)
+	}
+
+	for _, tt := range []struct {
+		incoming string
+		adopted  bool
+	}{
+		{"ci-run-42.deploy_1", true},
+		{"has spaces", false},
+		{"new\nline", false},
+		{strings.Repeat("a", 65), false},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, tt.incoming)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if (got == tt.incoming) != tt.adopted {
+			t.Errorf("incoming %q: request ID = %q, adopted = %v", tt.incoming, got, !tt.adopted)
+		}
+	}
+}
+
+func TestNewHandler_AddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, nil)))
+	ctx := WithRequestID(context.Background(), "abc123")
+
+	logger.InfoContext(ctx, "with context")
+	logger.Info("without context")
+	logger.InfoContext(ctx, "explicit", "request_id", "abc123")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	if !strings.Contains(lines[0], "request_id=abc123") {
+		t.Errorf("line = %q, want request_id", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("line = %q, want no request_id outside a request", lines[1])
+	}
+	if strings.Count(lines[2], "request_id") != 1 {
+		t.Errorf("line = %q, want request_id once", lines[2])
+	}
+}
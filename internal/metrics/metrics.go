@@ -21,6 +21,11 @@ var (
 		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
 	}, []string{"site"})
 
+	transferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_transfer_bytes_total",
+		Help: "Response body bytes served by site.",
+	}, []string{"site"})
+
 	deploymentsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "tspages_deployments_total",
 		Help: "Total deployments by site.",
@@ -36,15 +41,88 @@ var (
 		Name: "tspages_sites_active",
 		Help: "Number of active site servers.",
 	})
+
+	analyticsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tspages_analytics_dropped_events_total",
+		Help: "Analytics events dropped because the recorder buffer was full.",
+	})
+
+	compressionCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_compression_cache_requests_total",
+		Help: "On-the-fly compression lookups by result (hit, miss, coalesced).",
+	}, []string{"result"})
+
+	compressionSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_compression_skipped_total",
+		Help: "Compressible responses sent uncompressed by reason (size, busy).",
+	}, []string{"reason"})
+
+	cachePurges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_cache_purges_total",
+		Help: "Serve cache purges by trigger (request, activation).",
+	}, []string{"trigger"})
+
+	cachePurgedEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tspages_cache_purged_entries_total",
+		Help: "Cached compressed files dropped by purges.",
+	})
+
+	siteConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tspages_site_connections",
+		Help: "Open connections to site servers by site.",
+	}, []string{"site"})
+
+	siteRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tspages_site_requests_in_flight",
+		Help: "Requests being handled by site servers by site.",
+	}, []string{"site"})
+
+	siteGoroutines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tspages_site_goroutines",
+		Help: "Goroutines serving listeners, connections, and HTTP/2 requests of site servers by site.",
+	}, []string{"site"})
+
+	siteRequestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_site_requests_shed_total",
+		Help: "Requests rejected with 503 by site and the cap they exceeded (connections, requests).",
+	}, []string{"site", "cap"})
+
+	siteConnectionsRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_site_connections_refused_total",
+		Help: "Connections closed right away for exceeding the cap on connections per node, by site.",
+	}, []string{"site"})
+
+	eventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tspages_events_total",
+		Help: "Events published on the internal event bus by type.",
+	}, []string{"type"})
+
+	siteHealthScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tspages_site_health_score",
+		Help: "Health score of sites from 0 (failing) to 1 (healthy), over the last 15 minutes.",
+	}, []string{"site"})
 )
 
 func init() {
 	prometheus.MustRegister(
 		httpRequests,
 		httpDuration,
+		transferBytes,
 		deploymentsTotal,
 		deploymentSize,
 		activeSites,
+		analyticsDropped,
+		compressionCache,
+		compressionSkipped,
+		cachePurges,
+		cachePurgedEntries,
+		siteConnections,
+		siteRequestsInFlight,
+		siteGoroutines,
+		siteRequestsShed,
+		siteConnectionsRefused,
+		eventsPublished,
+		siteHealthScore,
 	)
 }
 
@@ -59,13 +137,89 @@ func ObserveRequest(site string, status int, duration time.Duration) {
 	httpDuration.WithLabelValues(site).Observe(duration.Seconds())
 }
 
+// AddTransfer records n response body bytes served for a site.
+func AddTransfer(site string, n int64) {
+	if n > 0 {
+		transferBytes.WithLabelValues(site).Add(float64(n))
+	}
+}
+
 // CountDeploy records a deployment.
 func CountDeploy(site string, sizeBytes int64) {
 	deploymentsTotal.WithLabelValues(site).Inc()
 	deploymentSize.Observe(float64(sizeBytes))
 }
 
+// CountAnalyticsDropped records an analytics event dropped under load.
+func CountAnalyticsDropped() {
+	analyticsDropped.Inc()
+}
+
+// CountCompressionCache records an on-the-fly compression lookup. result is
+// "hit" for cached output, "miss" for a request that compressed the file,
+// and "coalesced" for a request that waited on a concurrent miss.
+func CountCompressionCache(result string) {
+	compressionCache.WithLabelValues(result).Inc()
+}
+
+// CountCompressionSkipped records a compressible response sent uncompressed.
+// reason is "size" for a file over the size ceiling and "busy" for a
+// response streamed while every compression worker was busy.
+func CountCompressionSkipped(reason string) {
+	compressionSkipped.WithLabelValues(reason).Inc()
+}
+
+// CountCachePurge records a purge of a site's serve caches that dropped
+// entries cached files. trigger is "request" or "activation".
+func CountCachePurge(trigger string, entries int) {
+	cachePurges.WithLabelValues(trigger).Inc()
+	cachePurgedEntries.Add(float64(entries))
+}
+
 // SetActiveSites sets the gauge of active site servers.
 func SetActiveSites(n int) {
 	activeSites.Set(float64(n))
 }
+
+// AddSiteConnections adds delta to the open connections of a site.
+func AddSiteConnections(site string, delta int) {
+	siteConnections.WithLabelValues(site).Add(float64(delta))
+}
+
+// AddSiteRequestsInFlight adds delta to the in-flight requests of a site.
+func AddSiteRequestsInFlight(site string, delta int) {
+	siteRequestsInFlight.WithLabelValues(site).Add(float64(delta))
+}
+
+// AddSiteGoroutines adds delta to the goroutines serving a site.
+func AddSiteGoroutines(site string, delta int) {
+	siteGoroutines.WithLabelValues(site).Add(float64(delta))
+}
+
+// CountShed records a request of a site rejected because it exceeded
+// limit, "connections" or "requests".
+func CountShed(site, limit string) {
+	siteRequestsShed.WithLabelValues(site, limit).Inc()
+}
+
+// CountRefused records a connection to a site closed because its node
+// exceeded the cap on connections per node.
+func CountRefused(site string) {
+	siteConnectionsRefused.WithLabelValues(site).Inc()
+}
+
+// CountEvent records an event published on the internal event bus.
+func CountEvent(eventType string) {
+	eventsPublished.WithLabelValues(eventType).Inc()
+}
+
+// SetSiteHealth sets the health score of a site.
+func SetSiteHealth(site string, score float64) {
+	siteHealthScore.WithLabelValues(site).Set(score)
+}
+
+// DeleteSiteHealth removes the health score of a site that is no longer
+// scored.
+func DeleteSiteHealth(site string) {
+	siteHealthScore.DeleteLabelValues(site)
+}
@@ -0,0 +1,108 @@
+package multihost
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain binds a site to an additional hostname outside MagicDNS, served
+// with an externally managed certificate. DNS for the hostname must point at
+// the site's tailnet address.
+type Domain struct {
+	Site     string
+	Hostname string
+	CertFile string
+	KeyFile  string
+}
+
+// certReloadInterval is how often certificate files are checked for changes,
+// so renewals by an external ACME client are picked up without a restart.
+const certReloadInterval = time.Minute
+
+// certFile serves a certificate from a PEM cert/key pair on disk, reloading
+// it when either file changes.
+type certFile struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertFile(certPath, keyPath string) (*certFile, error) {
+	c := &certFile{certPath: certPath, keyPath: keyPath}
+	if _, err := c.get(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// get returns the current certificate, reloading it if the files changed
+// since the last check. A failed reload keeps serving the previous
+// certificate.
+func (c *certFile) get(now time.Time) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && now.Sub(c.checked) < certReloadInterval {
+		return c.cert, nil
+	}
+	c.checked = now
+
+	modTime, err := c.latestModTime()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+	cert, lerr := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err == nil {
+		err = lerr
+	}
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("loading certificate %s: %w", c.certPath, err)
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return c.cert, nil
+}
+
+func (c *certFile) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, p := range []string{c.certPath, c.keyPath} {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// domainCertificates returns a tls.Config.GetCertificate function that
+// serves the custom certificate for each domain's hostname and falls back to
+// fallback, the tailnet certificate, for every other name.
+func domainCertificates(domains []Domain, fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	certs := make(map[string]*certFile, len(domains))
+	for _, d := range domains {
+		c, err := newCertFile(d.CertFile, d.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("domain %s: %w", d.Hostname, err)
+		}
+		certs[strings.ToLower(d.Hostname)] = c
+	}
+	return func(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if c, ok := certs[strings.ToLower(hi.ServerName)]; ok {
+			return c.get(time.Now())
+		}
+		return fallback(hi)
+	}, nil
+}
@@ -0,0 +1,135 @@
+package multihost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for hostname to dir and
+// returns the cert and key paths.
+func writeTestCert(t *testing.T, dir, hostname string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, hostname+".crt")
+	keyPath := filepath.Join(dir, hostname+".key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestDomainCertificates_SelectsBySNI(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir, "docs.corp.example")
+
+	fallbackCalled := false
+	fallback := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		fallbackCalled = true
+		return &tls.Certificate{}, nil
+	}
+	getCert, err := domainCertificates([]Domain{{Site: "docs", Hostname: "Docs.Corp.Example", CertFile: certPath, KeyFile: keyPath}}, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := getCert(&tls.ClientHelloInfo{ServerName: "docs.corp.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "docs.corp.example" {
+		t.Errorf("got certificate for %v, want docs.corp.example", cert.Leaf)
+	}
+	if fallbackCalled {
+		t.Error("custom domain should not use the tailnet certificate")
+	}
+
+	if _, err := getCert(&tls.ClientHelloInfo{ServerName: "docs.tailnet.ts.net"}); err != nil {
+		t.Fatal(err)
+	}
+	if !fallbackCalled {
+		t.Error("tailnet name should use the tailnet certificate")
+	}
+}
+
+func TestDomainCertificates_MissingFiles(t *testing.T) {
+	_, err := domainCertificates([]Domain{{Site: "docs", Hostname: "docs.corp.example", CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"}}, nil)
+	if err == nil {
+		t.Fatal("expected error for missing certificate files")
+	}
+}
+
+func TestCertFile_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir, "docs.corp.example")
+
+	c, err := newCertFile(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := c.get(time.Now())
+
+	// Replace the files as a renewal would, with a newer modification time.
+	newCert, newKey := writeTestCert(t, t.TempDir(), "docs.corp.example")
+	os.Rename(newCert, certPath)
+	os.Rename(newKey, keyPath)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(certPath, later, later)
+
+	if got, _ := c.get(time.Now()); got != first {
+		t.Error("certificate should not be reloaded before the check interval")
+	}
+	got, err := c.get(time.Now().Add(2 * certReloadInterval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == first {
+		t.Error("certificate should be reloaded after the files changed")
+	}
+
+	// A broken renewal keeps serving the last good certificate.
+	os.WriteFile(certPath, []byte("garbage"), 0644)
+	later = later.Add(time.Hour)
+	os.Chtimes(certPath, later, later)
+	kept, err := c.get(time.Now().Add(4 * certReloadInterval))
+	if err != nil || kept != got {
+		t.Errorf("got %v, %v; want previous certificate", kept, err)
+	}
+}
+
+func TestNew_GroupsDomainsBySite(t *testing.T) {
+	m := New(ManagerConfig{Domains: []Domain{
+		{Site: "docs", Hostname: "docs.corp.example"},
+		{Site: "docs", Hostname: "handbook.corp.example"},
+		{Site: "wiki", Hostname: "wiki.corp.example"},
+	}})
+	if len(m.domains["docs"]) != 2 || len(m.domains["wiki"]) != 1 {
+		t.Errorf("domains = %v", m.domains)
+	}
+}
@@ -0,0 +1,57 @@
+package multihost
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// Defaults for ServerLimits fields left zero.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 64 << 10
+)
+
+// ServerLimits hardens the HTTP servers of all sites against slow and
+// abusive clients.
+type ServerLimits struct {
+	// ReadHeaderTimeout is how long a client may take to send the headers
+	// of a request, so that connections trickling them in (slowloris)
+	// cannot be held open. IdleTimeout is how long a keep-alive
+	// connection may wait for its next request.
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	// MaxHeaderBytes caps the size of request headers; larger ones are
+	// answered with 431.
+	MaxHeaderBytes int
+	// MaxConnectionsPerNode caps the connections a site keeps open to a
+	// single address, so one node cannot take all of them. Further
+	// connections are closed right away. 0 means no cap.
+	MaxConnectionsPerNode int
+}
+
+// withDefaults returns l with zero fields set to their defaults.
+func (l ServerLimits) withDefaults() ServerLimits {
+	if l.ReadHeaderTimeout <= 0 {
+		l.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if l.IdleTimeout <= 0 {
+		l.IdleTimeout = DefaultIdleTimeout
+	}
+	if l.MaxHeaderBytes <= 0 {
+		l.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	return l
+}
+
+// newServer returns a site server for handler with the limits applied.
+func (l ServerLimits) newServer(handler http.Handler, connState func(net.Conn, http.ConnState)) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ConnState:         connState,
+		ReadHeaderTimeout: l.ReadHeaderTimeout,
+		IdleTimeout:       l.IdleTimeout,
+		MaxHeaderBytes:    l.MaxHeaderBytes,
+	}
+}
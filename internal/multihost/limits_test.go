@@ -0,0 +1,61 @@
+package multihost
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerLimits_Defaults(t *testing.T) {
+	srv := ServerLimits{}.withDefaults().newServer(http.NotFoundHandler(), nil)
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.IdleTimeout != DefaultIdleTimeout || srv.MaxHeaderBytes != DefaultMaxHeaderBytes {
+		t.Errorf("server = %v/%v/%d, want the defaults", srv.ReadHeaderTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+	srv = ServerLimits{ReadHeaderTimeout: time.Second, IdleTimeout: time.Minute, MaxHeaderBytes: 1024}.withDefaults().newServer(http.NotFoundHandler(), nil)
+	if srv.ReadHeaderTimeout != time.Second || srv.IdleTimeout != time.Minute || srv.MaxHeaderBytes != 1024 {
+		t.Errorf("server = %v/%v/%d, want the configured limits", srv.ReadHeaderTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+	}
+}
+
+func TestServerLimits_SlowHeaders(t *testing.T) {
+	limits := ServerLimits{ReadHeaderTimeout: 100 * time.Millisecond}.withDefaults()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = limits.newServer(http.NotFoundHandler(), nil)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Send part of the headers, then stall.
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: docs\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("read = %v, want the server to close the connection", err)
+	}
+}
+
+func TestServerLimits_OversizedHeaders(t *testing.T) {
+	limits := ServerLimits{MaxHeaderBytes: 1024}.withDefaults()
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = limits.newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("X-Padding", strings.Repeat("a", 8<<10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %d, want 431", resp.StatusCode)
+	}
+}
@@ -0,0 +1,89 @@
+package multihost
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tspages/internal/storage"
+
+	"tailscale.com/tsnet"
+)
+
+// listenNetwork returns the network a site listens on for its ip_family
+// setting: "tcp4", "tcp6", or "tcp" for both.
+func listenNetwork(ipFamily string) string {
+	switch ipFamily {
+	case "ipv4":
+		return "tcp4"
+	case "ipv6":
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// listenTLS listens on the site's tailnet address like ListenTLS, but on any
+// network and with certificates from getCert.
+func listenTLS(srv *tsnet.Server, network, addr string, getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (net.Listener, error) {
+	ln, err := srv.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, &tls.Config{GetCertificate: getCert}), nil
+}
+
+// listenPorts returns the additional HTTPS ports of cfg, sorted and without
+// duplicates.
+func listenPorts(cfg storage.SiteConfig) []int {
+	ports := slices.Clone(cfg.ListenPorts)
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
+
+func joinPorts(ports []int) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		s[i] = strconv.Itoa(p)
+	}
+	return strings.Join(s, ",")
+}
+
+// siteURLs returns the URLs a site serves at: fqdn on port 443 and each of
+// ports, the custom domains, and fqdn over plain HTTP if it redirects.
+func siteURLs(fqdn string, ports []int, domains []Domain, httpRedirect bool) []string {
+	urls := []string{"https://" + fqdn}
+	for _, p := range ports {
+		urls = append(urls, "https://"+fqdn+":"+strconv.Itoa(p))
+	}
+	for _, d := range domains {
+		urls = append(urls, "https://"+d.Hostname)
+	}
+	if httpRedirect {
+		urls = append(urls, "http://"+fqdn)
+	}
+	return urls
+}
+
+// redirectToHTTPS redirects plain HTTP requests to the same path over HTTPS.
+// Requests for a custom domain keep it; all others, including those for the
+// short hostname or an IP address, go to fqdn, since the certificate only
+// covers full names.
+func redirectToHTTPS(fqdn string, domains []Domain) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		target := fqdn
+		for _, d := range domains {
+			if strings.EqualFold(host, d.Hostname) {
+				target = d.Hostname
+				break
+			}
+		}
+		http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
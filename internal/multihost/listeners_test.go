@@ -0,0 +1,55 @@
+package multihost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"tspages/internal/storage"
+)
+
+func TestSiteURLs(t *testing.T) {
+	cfg := storage.SiteConfig{ListenPorts: []int{9443, 8443, 9443}}
+	got := siteURLs("docs.example.ts.net", listenPorts(cfg), []Domain{{Hostname: "docs.corp.example"}}, true)
+	want := []string{
+		"https://docs.example.ts.net",
+		"https://docs.example.ts.net:8443",
+		"https://docs.example.ts.net:9443",
+		"https://docs.corp.example",
+		"http://docs.example.ts.net",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("siteURLs = %v, want %v", got, want)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	h := redirectToHTTPS("docs.example.ts.net", []Domain{{Hostname: "docs.corp.example"}})
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"docs", "https://docs.example.ts.net/guide/?q=1"},
+		{"docs.example.ts.net", "https://docs.example.ts.net/guide/?q=1"},
+		{"100.64.0.1:80", "https://docs.example.ts.net/guide/?q=1"},
+		{"DOCS.corp.example", "https://docs.corp.example/guide/?q=1"},
+		{"evil.example", "https://docs.example.ts.net/guide/?q=1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+"/guide/?q=1", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("host %s: status = %d, location = %q, want %q", tt.host, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestListenNetwork(t *testing.T) {
+	for family, want := range map[string]string{"": "tcp", "ipv4": "tcp4", "ipv6": "tcp6"} {
+		if got := listenNetwork(family); got != want {
+			t.Errorf("listenNetwork(%q) = %q, want %q", family, got, want)
+		}
+	}
+}
@@ -2,31 +2,61 @@ package multihost
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"tspages/internal/analytics"
 	"tspages/internal/auth"
+	"tspages/internal/events"
 	"tspages/internal/httplog"
 	"tspages/internal/metrics"
 	"tspages/internal/serve"
 	"tspages/internal/storage"
 	"tspages/internal/tsadapter"
 
+	"tailscale.com/ipn"
 	"tailscale.com/tsnet"
 )
 
+// ErrLogin marks a site server that could not log in to the tailnet, most
+// often because the auth key expired or was revoked.
+var ErrLogin = errors.New("tailnet login failed")
+
+// loginTimeout is how long a new site server may take to log in to the
+// tailnet before it counts as failed.
+const loginTimeout = 2 * time.Minute
+
+// LoginFailure records a site whose server could not log in to the tailnet.
+type LoginFailure struct {
+	Site  string    `json:"site"`
+	Error string    `json:"error"`
+	Since time.Time `json:"since"`
+}
+
 type siteServer struct {
-	ts       *tsnet.Server
-	httpSrv  *http.Server
-	handler  *serve.Handler
-	closer   func() error // if set, used instead of default close logic
-	isPublic bool
+	ts          *tsnet.Server
+	httpSrv     *http.Server
+	redirectSrv *http.Server // plain HTTP redirect listener, if enabled
+	handler     *serve.Handler
+	resources   *siteResources
+	closer      func() error // if set, used instead of default close logic
+	isPublic    bool
+	node        nodeOptions
+	// listeners are the URLs the server listens on.
+	listeners []string
+	// login waits until the server is logged in to the tailnet, returning
+	// an error wrapping ErrLogin if it cannot. Nil skips the check.
+	login func(ctx context.Context) error
 }
 
 func (ss *siteServer) Close() error {
@@ -38,9 +68,40 @@ func (ss *siteServer) Close() error {
 	if err := ss.httpSrv.Shutdown(ctx); err != nil {
 		slog.Warn("graceful shutdown failed", "err", err)
 	}
+	if ss.redirectSrv != nil {
+		if err := ss.redirectSrv.Shutdown(ctx); err != nil {
+			slog.Warn("graceful shutdown failed", "err", err)
+		}
+	}
 	return ss.ts.Close()
 }
 
+// nodeOptions are the settings of a site's tailnet node and its listeners,
+// beyond whether it is public. Changing any of them takes a new server.
+type nodeOptions struct {
+	ephemeral      bool
+	tags           string // sorted, comma-separated
+	hostnamePrefix string
+	hostnameSuffix string
+	ports          string // sorted, comma-separated additional HTTPS ports
+	httpRedirect   bool
+	ipFamily       string
+}
+
+func nodeOptionsFor(cfg storage.SiteConfig) nodeOptions {
+	tags := slices.Clone(cfg.AdvertiseTags)
+	slices.Sort(tags)
+	return nodeOptions{
+		ephemeral:      cfg.Ephemeral != nil && *cfg.Ephemeral,
+		tags:           strings.Join(slices.Compact(tags), ","),
+		hostnamePrefix: cfg.HostnamePrefix,
+		hostnameSuffix: cfg.HostnameSuffix,
+		ports:          joinPorts(listenPorts(cfg)),
+		httpRedirect:   cfg.HTTPRedirect != nil && *cfg.HTTPRedirect,
+		ipFamily:       cfg.IPFamily,
+	}
+}
+
 // siteStarter creates and starts a site server. The default implementation
 // creates a real tsnet.Server; tests can replace this to avoid network calls.
 type siteStarter func(site string) (*siteServer, error)
@@ -55,23 +116,46 @@ type ManagerConfig struct {
 	Recorder   *analytics.Recorder
 	DNSSuffix  string
 	Defaults   storage.SiteConfig
+	// HostnameSuffix is appended to each site's tailnet hostname, so a
+	// replica can serve the same sites alongside its primary.
+	HostnameSuffix string
+	// Domains binds sites to additional hostnames with their own certificates.
+	Domains []Domain
+	// Events, if set, receives an events.OperatorAlert when a site's
+	// server cannot log in to the tailnet, and the progress of
+	// StartExistingSites.
+	Events *events.Bus
+	// StartupConcurrency is how many site servers StartExistingSites
+	// starts at once. 0 uses DefaultStartupConcurrency.
+	StartupConcurrency int
+	// Limits are the timeouts and caps of the sites' HTTP servers.
+	Limits ServerLimits
 }
 
 // Manager tracks per-site tsnet servers.
 type Manager struct {
 	store      *storage.Store
 	stateDir   string
-	authKey    string
 	capability string
 	maxSites   int
 	recorder   *analytics.Recorder
 	dnsSuffix  string
 	defaults   storage.SiteConfig
+	hostSuffix string
+	domains    map[string][]Domain
+	events     *events.Bus
+	limits     ServerLimits
 	startSite  siteStarter
 
-	mu       sync.Mutex
-	servers  map[string]*siteServer
-	starting map[string]chan struct{} // closed when startup completes
+	startupConcurrency int
+	retryBackoff       time.Duration
+	startup            startupState
+
+	mu            sync.Mutex
+	authKey       string
+	servers       map[string]*siteServer
+	starting      map[string]chan struct{} // closed when startup completes
+	loginFailures map[string]LoginFailure
 }
 
 func New(cfg ManagerConfig) *Manager {
@@ -84,16 +168,32 @@ func New(cfg ManagerConfig) *Manager {
 		recorder:   cfg.Recorder,
 		dnsSuffix:  cfg.DNSSuffix,
 		defaults:   cfg.Defaults,
-		servers:    make(map[string]*siteServer),
-		starting:   make(map[string]chan struct{}),
+		hostSuffix: cfg.HostnameSuffix,
+		domains:    make(map[string][]Domain),
+		events:     cfg.Events,
+		limits:     cfg.Limits.withDefaults(),
+
+		startupConcurrency: cfg.StartupConcurrency,
+		retryBackoff:       startupBackoff,
+		startup:            startupState{state: StartupPending},
+
+		servers:       make(map[string]*siteServer),
+		starting:      make(map[string]chan struct{}),
+		loginFailures: make(map[string]LoginFailure),
+	}
+	for _, d := range cfg.Domains {
+		m.domains[d.Site] = append(m.domains[d.Site], d)
+	}
+	if m.startupConcurrency < 1 {
+		m.startupConcurrency = DefaultStartupConcurrency
 	}
 	m.startSite = m.defaultStartSite
 	return m
 }
 
 // EnsureServer starts a tsnet server for the given site if one isn't already running.
-// If the site's public status has changed since it was started, the old server
-// is stopped and a new one is started with the correct listener type.
+// If the site's public status or node options have changed since it was
+// started, the old server is stopped and a new one is started in its place.
 func (m *Manager) EnsureServer(site string) error {
 	m.mu.Lock()
 
@@ -109,14 +209,18 @@ func (m *Manager) EnsureServer(site string) error {
 		cfg, _ := m.store.ReadCurrentSiteConfig(site)
 		merged := cfg.Merge(m.defaults)
 		wantPublic := merged.Public != nil && *merged.Public
-		if existing.isPublic == wantPublic {
+		if existing.isPublic == wantPublic && existing.node == nodeOptionsFor(merged) {
 			if existing.handler != nil {
 				existing.handler.InvalidateConfig()
 			}
+			if existing.resources != nil {
+				existing.resources.setCaps(merged)
+			}
 			m.mu.Unlock()
 			return nil
 		}
-		// Public status changed — close old server, fall through to start new one.
+		// Public status or node options changed — close old server, fall
+		// through to start new one.
 		old = existing
 		delete(m.servers, site)
 	} else if len(m.servers) >= m.maxSites {
@@ -128,7 +232,40 @@ func (m *Manager) EnsureServer(site string) error {
 	ch := make(chan struct{})
 	m.starting[site] = ch
 	m.mu.Unlock()
+	return m.replaceServer(site, old, ch)
+}
 
+// RestartServer stops the tsnet server of the given site, if one is running,
+// and starts a new one in its place, leaving other sites' servers alone.
+func (m *Manager) RestartServer(site string) error {
+	m.mu.Lock()
+	// Let a start already in progress finish, then restart what it started.
+	for {
+		ch, ok := m.starting[site]
+		if !ok {
+			break
+		}
+		m.mu.Unlock()
+		<-ch
+		m.mu.Lock()
+	}
+
+	old, ok := m.servers[site]
+	if !ok && len(m.servers) >= m.maxSites {
+		m.mu.Unlock()
+		return fmt.Errorf("maximum site limit (%d) reached", m.maxSites)
+	}
+	delete(m.servers, site)
+	ch := make(chan struct{})
+	m.starting[site] = ch
+	m.mu.Unlock()
+	return m.replaceServer(site, old, ch)
+}
+
+// replaceServer closes old, if not nil, starts a new server for site, and
+// closes ch once it is registered. The caller must have marked site as
+// starting with ch.
+func (m *Manager) replaceServer(site string, old *siteServer, ch chan struct{}) error {
 	// Close the old server (if restarting) outside the lock.
 	// The starting guard prevents concurrent starts for the same site.
 	if old != nil {
@@ -143,6 +280,9 @@ func (m *Manager) EnsureServer(site string) error {
 	close(ch)
 	if err != nil {
 		m.mu.Unlock()
+		if errors.Is(err, ErrLogin) {
+			m.loginFailed(site, err)
+		}
 		return err
 	}
 	if len(m.servers) >= m.maxSites {
@@ -154,19 +294,143 @@ func (m *Manager) EnsureServer(site string) error {
 	}
 	m.servers[site] = ss
 	metrics.SetActiveSites(len(m.servers))
+	if ss.login == nil {
+		delete(m.loginFailures, site)
+	}
+	m.mu.Unlock()
+	if ss.login != nil {
+		go m.watchLogin(site, ss)
+	}
+	return nil
+}
+
+// watchLogin waits for ss to log in to the tailnet. A server that cannot is
+// stopped and recorded as a login failure, until a later start succeeds.
+func (m *Manager) watchLogin(site string, ss *siteServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+	err := ss.login(ctx)
+
+	m.mu.Lock()
+	if m.servers[site] != ss {
+		// Stopped or replaced while logging in.
+		m.mu.Unlock()
+		return
+	}
+	if err == nil {
+		delete(m.loginFailures, site)
+		m.mu.Unlock()
+		return
+	}
+	if !errors.Is(err, ErrLogin) {
+		m.mu.Unlock()
+		slog.Warn("site has not connected to the tailnet", "site", site, "err", err)
+		return
+	}
+	delete(m.servers, site)
+	metrics.SetActiveSites(len(m.servers))
+	m.mu.Unlock()
+
+	if cerr := ss.Close(); cerr != nil {
+		slog.Warn("closing site after failed login", "site", site, "err", cerr)
+	}
+	m.loginFailed(site, err)
+}
+
+// loginFailed records that site's server could not log in, and raises an
+// operator alert the first time it fails since it last logged in.
+func (m *Manager) loginFailed(site string, err error) {
+	m.mu.Lock()
+	f, seen := m.loginFailures[site]
+	if !seen {
+		f = LoginFailure{Site: site, Since: time.Now().UTC()}
+	}
+	f.Error = err.Error()
+	m.loginFailures[site] = f
 	m.mu.Unlock()
+
+	slog.Error("site could not log in to the tailnet", "site", site, "err", err)
+	if seen || m.events == nil {
+		return
+	}
+	cfg, _ := m.store.ReadCurrentSiteConfig(site)
+	m.events.Publish(events.Event{
+		Type:   events.OperatorAlert,
+		Site:   site,
+		Config: cfg.Merge(m.defaults),
+		Data: map[string]any{
+			"site":  site,
+			"alert": "login_failed",
+			"error": f.Error,
+		},
+	})
+}
+
+// LoginError returns why site's server could not log in to the tailnet, or
+// "" if it did not fail.
+func (m *Manager) LoginError(site string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loginFailures[site].Error
+}
+
+// Listeners returns the URLs site's server listens on, or nil if it is not
+// running.
+func (m *Manager) Listeners(site string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ss, ok := m.servers[site]; ok {
+		return slices.Clone(ss.listeners)
+	}
 	return nil
 }
 
+// LoginFailures returns the sites whose servers could not log in to the
+// tailnet, sorted by name.
+func (m *Manager) LoginFailures() []LoginFailure {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failures := make([]LoginFailure, 0, len(m.loginFailures))
+	for _, site := range slices.Sorted(maps.Keys(m.loginFailures)) {
+		failures = append(failures, m.loginFailures[site])
+	}
+	return failures
+}
+
+// SetAuthKey replaces the auth key that new site servers log in with, and
+// starts the servers of sites that failed to log in again.
+func (m *Manager) SetAuthKey(key string) error {
+	m.mu.Lock()
+	m.authKey = key
+	failed := slices.Sorted(maps.Keys(m.loginFailures))
+	m.mu.Unlock()
+
+	var errs []error
+	for _, site := range failed {
+		if err := m.EnsureServer(site); err != nil {
+			errs = append(errs, fmt.Errorf("site %s: %w", site, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (m *Manager) defaultStartSite(site string) (*siteServer, error) {
 	cfg, _ := m.store.ReadCurrentSiteConfig(site)
 	merged := cfg.Merge(m.defaults)
 	public := merged.Public != nil && *merged.Public
 
+	m.mu.Lock()
+	authKey := m.authKey
+	m.mu.Unlock()
+
+	node := nodeOptionsFor(merged)
+	hostname := merged.Hostname(site) + m.hostSuffix
 	srv := &tsnet.Server{
-		Hostname: site,
-		Dir:      filepath.Join(m.stateDir, "sites", site),
-		AuthKey:  m.authKey,
+		Hostname:      hostname,
+		Dir:           filepath.Join(m.stateDir, "sites", site),
+		AuthKey:       authKey,
+		Ephemeral:     node.ephemeral,
+		AdvertiseTags: merged.AdvertiseTags,
 	}
 
 	lc, err := srv.LocalClient()
@@ -185,58 +449,139 @@ func (m *Manager) defaultStartSite(site string) (*siteServer, error) {
 
 	handler := serve.NewHandler(m.store, site, m.dnsSuffix, m.defaults)
 	handler.SetPublic(public)
+	if m.recorder != nil {
+		handler.SetOptOuts(m.recorder)
+		handler.SetDownloads(m.recorder)
+	}
 	logged := httplog.Wrap(handler, slog.String("site", site))
-	recorded := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	measured := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sw := &statusWriter{ResponseWriter: w, status: 200}
 		start := time.Now()
 		logged.ServeHTTP(sw, r)
 		metrics.ObserveRequest(site, sw.status, time.Since(start))
-		if m.recorder != nil && handler.AnalyticsEnabled() {
-			ri := auth.RequestInfoFromContext(r.Context())
-			m.recorder.Record(analytics.Event{
-				Timestamp:     start,
-				Site:          site,
-				Path:          r.URL.Path,
-				Status:        sw.status,
-				UserLogin:     ri.UserLogin,
-				UserName:      ri.UserName,
-				ProfilePicURL: ri.ProfilePicURL,
-				NodeName:      ri.NodeName,
-				NodeIP:        ri.NodeIP,
-				OS:            ri.OS,
-				OSVersion:     ri.OSVersion,
-				Device:        ri.Device,
-				Tags:          ri.Tags,
-			})
+		metrics.AddTransfer(site, sw.bytes)
+		if m.recorder != nil {
+			m.recorder.RecordTransfer(site, start, sw.bytes)
 		}
 	})
+	stages := []serve.Stage{{Name: storage.StageAuth, Wrap: withAuth}}
+	if m.recorder != nil {
+		stages = append(stages, serve.Stage{Name: storage.StageAnalytics, Wrap: m.recordAnalytics(site, handler)})
+	}
 	mux := http.NewServeMux()
-	mux.Handle("GET /{path...}", withAuth(recorded))
+	mux.Handle("GET /{path...}", serve.Pipeline(measured, handler.StageEnabled, stages...))
+	mux.Handle("POST "+serve.OptOutPath, withAuth(logged))
 
-	var ln net.Listener
+	domains := m.domains[site]
+	network := listenNetwork(node.ipFamily)
 	if public {
+		if len(domains) > 0 {
+			slog.Warn("custom domains are not supported for public sites", "site", site)
+			domains = nil
+		}
+		if network != "tcp" {
+			slog.Warn("ip_family is not supported for public sites", "site", site)
+			network = "tcp"
+		}
+	}
+	getCert := lc.GetCertificate
+	if len(domains) > 0 {
+		if getCert, err = domainCertificates(domains, lc.GetCertificate); err != nil {
+			srv.Close() //nolint:errcheck // cleanup on error path
+			return nil, fmt.Errorf("listen for site %q: %w", site, err)
+		}
+	}
+
+	var lns []net.Listener
+	var ln, redirectLn net.Listener
+	switch {
+	case public:
 		ln, err = srv.ListenFunnel("tcp", ":443")
-	} else {
+	case len(domains) > 0 || network != "tcp":
+		ln, err = listenTLS(srv, network, ":443", getCert)
+	default:
 		ln, err = srv.ListenTLS("tcp", ":443")
 	}
+	if err == nil {
+		lns = append(lns, ln)
+	}
+	for _, port := range listenPorts(merged) {
+		if err != nil {
+			break
+		}
+		if ln, err = listenTLS(srv, network, ":"+strconv.Itoa(port), getCert); err == nil {
+			lns = append(lns, ln)
+		}
+	}
+	if err == nil && node.httpRedirect {
+		redirectLn, err = srv.Listen(network, ":80")
+	}
 	if err != nil {
+		for _, ln := range lns {
+			ln.Close() //nolint:errcheck // cleanup on error path
+		}
 		srv.Close() //nolint:errcheck // cleanup on error path
 		return nil, fmt.Errorf("listen for site %q: %w", site, err)
 	}
 
-	httpSrv := &http.Server{Handler: mux}
-	go func() {
+	fqdn := hostname
+	if m.dnsSuffix != "" {
+		fqdn += "." + m.dnsSuffix
+	}
+	listeners := siteURLs(fqdn, listenPorts(merged), domains, node.httpRedirect)
+	for _, u := range listeners {
 		if public {
-			slog.Info("site listening", "site", site, "url", "https://"+site, "public", true)
+			slog.Info("site listening", "site", site, "url", u, "public", true)
 		} else {
-			slog.Info("site listening", "site", site, "url", "https://"+site)
-		}
-		if err := httpSrv.Serve(ln); err != http.ErrServerClosed {
-			slog.Error("site serve error", "site", site, "err", err)
+			slog.Info("site listening", "site", site, "url", u)
 		}
-	}()
+	}
 
-	return &siteServer{ts: srv, httpSrv: httpSrv, handler: handler, isPublic: public}, nil
+	resources := newSiteResources(site, merged, m.limits.MaxConnectionsPerNode)
+	httpSrv := m.limits.newServer(resources.limit(mux), resources.connState)
+	for _, ln := range lns {
+		go func() {
+			if err := resources.serve(httpSrv, ln); err != http.ErrServerClosed {
+				slog.Error("site serve error", "site", site, "err", err)
+			}
+		}()
+	}
+	var redirectSrv *http.Server
+	if redirectLn != nil {
+		redirectSrv = m.limits.newServer(redirectToHTTPS(fqdn, domains), resources.connState)
+		go func() {
+			if err := resources.serve(redirectSrv, redirectLn); err != http.ErrServerClosed {
+				slog.Error("site serve error", "site", site, "err", err)
+			}
+		}()
+	}
+
+	login := func(ctx context.Context) error {
+		_, err := srv.Up(ctx)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() == nil:
+			// Up returns early when the control server rejects the node.
+			return fmt.Errorf("%w: %v", ErrLogin, err)
+		}
+		st, serr := lc.StatusWithoutPeers(context.Background())
+		if serr == nil && st.BackendState == ipn.NeedsLogin.String() {
+			return fmt.Errorf("%w: not logged in after %v; the auth key may have expired", ErrLogin, loginTimeout)
+		}
+		return err
+	}
+	return &siteServer{
+		ts:          srv,
+		httpSrv:     httpSrv,
+		redirectSrv: redirectSrv,
+		handler:     handler,
+		resources:   resources,
+		listeners:   listeners,
+		isPublic:    public,
+		node:        node,
+		login:       login,
+	}, nil
 }
 
 // StopServer shuts down and removes the tsnet server for the given site.
@@ -255,24 +600,58 @@ func (m *Manager) StopServer(site string) error {
 	return ss.Close()
 }
 
-// StartExistingSites starts servers for all created sites.
-// Sites without an active deployment will serve a placeholder page.
-func (m *Manager) StartExistingSites() error {
-	sites, err := m.store.ListSites()
-	if err != nil {
-		return fmt.Errorf("listing sites: %w", err)
-	}
-	for _, s := range sites {
-		if err := m.EnsureServer(s.Name); err != nil {
-			slog.Warn("failed to start site", "site", s.Name, "err", err)
-		}
+// recordAnalytics returns the analytics stage of a site's pipeline, which
+// records an analytics event for the responses of handler, unless the
+// site's config turns analytics off.
+func (m *Manager) recordAnalytics(site string, handler *serve.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !handler.AnalyticsEnabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w, status: 200}
+			start := time.Now()
+			r, servedBy := serve.TrackDeployment(r)
+			next.ServeHTTP(sw, r)
+
+			// Downloads are always recorded, so each file's count is exact.
+			download := handler.IsDownload(sw.status, sw.Header(), sw.bytes)
+			weight := 1
+			if !download {
+				weight = handler.AnalyticsWeight(r.URL.Path, sw.Header().Get("Content-Type"))
+			}
+			if weight == 0 {
+				return
+			}
+			ri := auth.RequestInfoFromContext(r.Context())
+			m.recorder.Record(analytics.Event{
+				Timestamp:     start,
+				Site:          site,
+				Path:          r.URL.Path,
+				Status:        sw.status,
+				UserLogin:     ri.UserLogin,
+				UserName:      ri.UserName,
+				ProfilePicURL: ri.ProfilePicURL,
+				NodeName:      ri.NodeName,
+				NodeIP:        ri.NodeIP,
+				OS:            ri.OS,
+				OSVersion:     ri.OSVersion,
+				Device:        ri.Device,
+				Tags:          slices.Concat(ri.Tags, handler.AnalyticsTags(r)),
+				DeploymentID:  servedBy(),
+				Bot:           ri.Bot,
+				Weight:        weight,
+				Download:      download,
+			})
+		})
 	}
-	return nil
 }
 
 type statusWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (w *statusWriter) WriteHeader(code int) {
@@ -280,6 +659,12 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
 func (w *statusWriter) Unwrap() http.ResponseWriter {
 	return w.ResponseWriter
 }
@@ -292,6 +677,75 @@ func (m *Manager) IsRunning(site string) bool {
 	return ok
 }
 
+// Resources returns what the site's server uses and the caps it is held to,
+// and false if it is not running.
+func (m *Manager) Resources(site string) (Resources, bool) {
+	m.mu.Lock()
+	ss, ok := m.servers[site]
+	m.mu.Unlock()
+	if !ok || ss.resources == nil {
+		return Resources{}, false
+	}
+	return ss.resources.snapshot(), true
+}
+
+// PurgeCache drops the site's cached compressed files under prefix, see
+// serve.PurgeCache, and makes its running server re-read its deployment
+// state and early hints. It returns how many cached files it dropped.
+func (m *Manager) PurgeCache(site, prefix string) (int, error) {
+	n, err := serve.PurgeCache(m.store, site, prefix)
+	m.mu.Lock()
+	if ss, ok := m.servers[site]; ok && ss.handler != nil {
+		ss.handler.InvalidateConfig()
+	}
+	m.mu.Unlock()
+	return n, err
+}
+
+// Probe requests reqPath from the site's running server in-process, as a
+// viewer of the site, and returns the response status. The request skips
+// the tailnet, resource caps, and analytics.
+func (m *Manager) Probe(site, reqPath string) (int, error) {
+	m.mu.Lock()
+	ss, ok := m.servers[site]
+	m.mu.Unlock()
+	if !ok || ss.handler == nil {
+		return 0, fmt.Errorf("server for %s is not running", site)
+	}
+	ctx := auth.ContextWithCaps(context.Background(), []auth.Cap{{Access: "view", Sites: []string{site}}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqPath, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Host = site
+	req.SetPathValue("path", strings.TrimPrefix(reqPath, "/"))
+	w := &probeWriter{header: http.Header{}}
+	ss.handler.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.status, nil
+}
+
+// probeWriter records the status of a probe and discards its body.
+type probeWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *probeWriter) Header() http.Header { return w.header }
+
+func (w *probeWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *probeWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
 // RunningCount returns the number of currently running site servers.
 func (m *Manager) RunningCount() int {
 	m.mu.Lock()
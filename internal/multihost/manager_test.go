@@ -1,13 +1,19 @@
 package multihost
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"tspages/internal/events"
+	"tspages/internal/serve"
 	"tspages/internal/storage"
 )
 
@@ -150,7 +156,7 @@ func TestStartExistingSites(t *testing.T) {
 
 	store.CreateSite("inactive")
 
-	if err := m.StartExistingSites(); err != nil {
+	if err := m.StartExistingSites(context.Background()); err != nil {
 		t.Fatalf("StartExistingSites: %v", err)
 	}
 
@@ -291,7 +297,7 @@ func TestStartExistingSites_ListError(t *testing.T) {
 		return &siteServer{closer: func() error { return nil }}, nil
 	}
 
-	err := m.StartExistingSites()
+	err := m.StartExistingSites(context.Background())
 	if err == nil {
 		t.Error("expected error from ListSites failure")
 	}
@@ -352,6 +358,112 @@ func TestEnsureServer_PublicToggle_Restart(t *testing.T) {
 	}
 }
 
+func TestEnsureServer_NodeOptionsChange_Restart(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.New(dir)
+	m := New(ManagerConfig{
+		Store:      store,
+		StateDir:   t.TempDir(),
+		Capability: "test/cap",
+		MaxSites:   10,
+		Defaults:   storage.SiteConfig{AdvertiseTags: []string{"tag:pages-internal"}},
+	})
+
+	var startCount atomic.Int32
+	m.startSite = func(site string) (*siteServer, error) {
+		startCount.Add(1)
+		cfg, _ := store.ReadCurrentSiteConfig(site)
+		return &siteServer{
+			node:   nodeOptionsFor(cfg.Merge(m.defaults)),
+			closer: func() error { return nil },
+		}, nil
+	}
+
+	store.CreateSite("docs")
+	depDir, _ := store.CreateDeployment("docs", "d1")
+	writeFile(t, depDir, "index.html", "hi")
+	store.MarkComplete("docs", "d1")
+	store.ActivateDeployment("docs", "d1")
+
+	for _, cfg := range []storage.SiteConfig{
+		{},
+		{AdvertiseTags: []string{"tag:pages-public"}},
+		{AdvertiseTags: []string{"tag:pages-public"}, HostnamePrefix: "pages-"},
+		{AdvertiseTags: []string{"tag:pages-public"}, HostnamePrefix: "pages-", ListenPorts: []int{8443}},
+		{AdvertiseTags: []string{"tag:pages-public"}, HostnamePrefix: "pages-", ListenPorts: []int{8443}, IPFamily: "ipv6"},
+	} {
+		store.WriteSiteConfig("docs", "d1", cfg)
+		if err := m.EnsureServer("docs"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if startCount.Load() != 5 {
+		t.Errorf("startSite called %d times, want 5", startCount.Load())
+	}
+
+	// Listing a tag or port twice needs no restart.
+	store.WriteSiteConfig("docs", "d1", storage.SiteConfig{
+		AdvertiseTags:  []string{"tag:pages-public", "tag:pages-public"},
+		HostnamePrefix: "pages-",
+		ListenPorts:    []int{8443, 8443},
+		IPFamily:       "ipv6",
+	})
+	if err := m.EnsureServer("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if startCount.Load() != 5 {
+		t.Errorf("startSite called %d times, want 5 (no restart)", startCount.Load())
+	}
+}
+
+func TestRestartServer(t *testing.T) {
+	store := storage.New(t.TempDir())
+	m := New(ManagerConfig{Store: store, StateDir: t.TempDir(), Capability: "test/cap", MaxSites: 10})
+
+	starts := map[string]int{}
+	closes := map[string]int{}
+	var mu sync.Mutex
+	m.startSite = func(site string) (*siteServer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		starts[site]++
+		return &siteServer{closer: func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			closes[site]++
+			return nil
+		}}, nil
+	}
+
+	for _, site := range []string{"docs", "blog"} {
+		store.CreateSite(site)
+		if err := m.EnsureServer(site); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RestartServer("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsRunning("docs") || !m.IsRunning("blog") {
+		t.Error("a site is not running after the restart")
+	}
+	if starts["docs"] != 2 || closes["docs"] != 1 {
+		t.Errorf("docs started %d and closed %d times, want 2 and 1", starts["docs"], closes["docs"])
+	}
+	if starts["blog"] != 1 || closes["blog"] != 0 {
+		t.Errorf("blog started %d and closed %d times, want 1 and 0", starts["blog"], closes["blog"])
+	}
+
+	// A site whose server is not running is started.
+	m.StopServer("blog")
+	if err := m.RestartServer("blog"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsRunning("blog") || starts["blog"] != 2 {
+		t.Errorf("blog running = %v, started %d times, want true and 2", m.IsRunning("blog"), starts["blog"])
+	}
+}
+
 func TestEnsureServer_PublicUnchanged_NoRestart(t *testing.T) {
 	dir := t.TempDir()
 	store := storage.New(dir)
@@ -390,3 +502,104 @@ func writeFile(t *testing.T, dir, name, content string) {
 		t.Fatal(err)
 	}
 }
+
+func TestEnsureServer_LoginFailure(t *testing.T) {
+	bus := events.New()
+	var alerts []events.Event
+	bus.Subscribe(events.OperatorAlert, func(e events.Event) { alerts = append(alerts, e) })
+	m := New(ManagerConfig{
+		Store:      storage.New(t.TempDir()),
+		StateDir:   t.TempDir(),
+		Capability: "test/cap",
+		MaxSites:   10,
+		Events:     bus,
+	})
+	m.startSite = func(site string) (*siteServer, error) {
+		if m.authKey != "tskey-fresh" {
+			return nil, fmt.Errorf("%w: invalid key", ErrLogin)
+		}
+		return &siteServer{closer: func() error { return nil }}, nil
+	}
+
+	for range 2 {
+		if err := m.EnsureServer("docs"); !errors.Is(err, ErrLogin) {
+			t.Fatalf("EnsureServer error = %v, want ErrLogin", err)
+		}
+	}
+	if got := m.LoginError("docs"); !strings.Contains(got, "invalid key") {
+		t.Errorf("LoginError = %q", got)
+	}
+	if failures := m.LoginFailures(); len(failures) != 1 || failures[0].Site != "docs" {
+		t.Errorf("LoginFailures = %+v", failures)
+	}
+	if len(alerts) != 1 || alerts[0].Site != "docs" || alerts[0].Data["alert"] != "login_failed" {
+		t.Errorf("alerts = %+v, want one for docs", alerts)
+	}
+
+	if err := m.SetAuthKey("tskey-fresh"); err != nil {
+		t.Fatalf("SetAuthKey: %v", err)
+	}
+	if !m.IsRunning("docs") || m.LoginError("docs") != "" {
+		t.Errorf("running = %v, login error = %q after reload", m.IsRunning("docs"), m.LoginError("docs"))
+	}
+}
+
+func TestEnsureServer_LoginTimesOut(t *testing.T) {
+	m, _ := newTestManager(t, 10)
+	closed := make(chan struct{})
+	m.startSite = func(site string) (*siteServer, error) {
+		return &siteServer{
+			closer: func() error { close(closed); return nil },
+			login: func(ctx context.Context) error {
+				return fmt.Errorf("%w: not logged in", ErrLogin)
+			},
+		}, nil
+	}
+
+	if err := m.EnsureServer("docs"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server that could not log in was not stopped")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.servers["docs"]; ok {
+		t.Error("server that could not log in is still registered")
+	}
+	if m.loginFailures["docs"].Error == "" {
+		t.Error("login failure was not recorded")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	m, _ := newTestManager(t, 10)
+	m.startSite = func(site string) (*siteServer, error) {
+		return &siteServer{
+			handler: serve.NewHandler(m.store, site, "", storage.SiteConfig{}),
+			closer:  func() error { return nil },
+		}, nil
+	}
+	if _, err := m.Probe("docs", "/"); err == nil {
+		t.Error("expected error for a site without a running server")
+	}
+
+	m.store.CreateDeployment("docs", "aaa11111")
+	content := m.store.ContentDir("docs", "aaa11111")
+	os.MkdirAll(content, 0755)
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("<h1>Docs</h1>"), 0644)
+	m.store.MarkComplete("docs", "aaa11111")
+	m.store.ActivateDeployment("docs", "aaa11111")
+	if err := m.EnsureServer("docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, err := m.Probe("docs", "/"); err != nil || status != 200 {
+		t.Errorf("probe / = %d, %v; want 200", status, err)
+	}
+	if status, err := m.Probe("docs", "/missing"); err != nil || status != 404 {
+		t.Errorf("probe /missing = %d, %v; want 404", status, err)
+	}
+}
@@ -0,0 +1,160 @@
+package multihost
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"tspages/internal/metrics"
+	"tspages/internal/storage"
+)
+
+// Resources is what a site's server uses, and the caps it is held to.
+type Resources struct {
+	Connections int64 `json:"connections"`
+	InFlight    int64 `json:"in_flight"`
+	// Goroutines counts one per listener and open connection, and one per
+	// in-flight HTTP/2 request, which net/http handles in its own goroutine.
+	Goroutines int64 `json:"goroutines"`
+	// Shed is how many requests were rejected with 503 for exceeding a cap
+	// since the server started.
+	Shed int64 `json:"shed"`
+	// Refused is how many connections were closed right away for exceeding
+	// the cap on connections per node since the server started.
+	Refused               int64 `json:"refused"`
+	MaxConnections        int64 `json:"max_connections"`
+	MaxConcurrentRequests int64 `json:"max_concurrent_requests"`
+}
+
+// siteResources accounts for the connections, requests, and goroutines of a
+// site's server, and sheds requests over the site's caps.
+type siteResources struct {
+	site        string
+	maxConns    atomic.Int64
+	maxRequests atomic.Int64
+	conns       atomic.Int64
+	inFlight    atomic.Int64
+	goroutines  atomic.Int64
+	shed        atomic.Int64
+	refused     atomic.Int64
+
+	// maxPerNode caps the connections per remote address; 0 means no cap.
+	maxPerNode int
+	nodeMu     sync.Mutex
+	nodeConns  map[string]int
+}
+
+func newSiteResources(site string, cfg storage.SiteConfig, maxPerNode int) *siteResources {
+	r := &siteResources{site: site, maxPerNode: maxPerNode, nodeConns: make(map[string]int)}
+	r.setCaps(cfg)
+	return r
+}
+
+// setCaps applies the caps of cfg, which take effect without a restart.
+func (r *siteResources) setCaps(cfg storage.SiteConfig) {
+	r.maxConns.Store(int64(cfg.MaxConnections))
+	r.maxRequests.Store(int64(cfg.MaxConcurrentRequests))
+}
+
+func (r *siteResources) snapshot() Resources {
+	return Resources{
+		Connections:           r.conns.Load(),
+		InFlight:              r.inFlight.Load(),
+		Goroutines:            r.goroutines.Load(),
+		Shed:                  r.shed.Load(),
+		Refused:               r.refused.Load(),
+		MaxConnections:        r.maxConns.Load(),
+		MaxConcurrentRequests: r.maxRequests.Load(),
+	}
+}
+
+func (r *siteResources) addConns(delta int) {
+	r.conns.Add(int64(delta))
+	metrics.AddSiteConnections(r.site, delta)
+	r.addGoroutines(delta)
+}
+
+func (r *siteResources) addInFlight(delta int) {
+	r.inFlight.Add(int64(delta))
+	metrics.AddSiteRequestsInFlight(r.site, delta)
+}
+
+func (r *siteResources) addGoroutines(delta int) {
+	r.goroutines.Add(int64(delta))
+	metrics.AddSiteGoroutines(r.site, delta)
+}
+
+// connState is an http.Server ConnState hook that counts open connections,
+// and closes those over the cap on connections per node.
+func (r *siteResources) connState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		r.addConns(1)
+		if n := r.addNodeConns(c, 1); r.maxPerNode > 0 && n > r.maxPerNode {
+			r.refused.Add(1)
+			metrics.CountRefused(r.site)
+			c.Close() //nolint:errcheck // the server reports StateClosed next
+		}
+	case http.StateClosed, http.StateHijacked:
+		r.addConns(-1)
+		r.addNodeConns(c, -1)
+	}
+}
+
+// addNodeConns adds delta to the open connections from the remote address
+// of c, and returns their number.
+func (r *siteResources) addNodeConns(c net.Conn, delta int) int {
+	node := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	r.nodeMu.Lock()
+	defer r.nodeMu.Unlock()
+	n := r.nodeConns[node] + delta
+	if n <= 0 {
+		delete(r.nodeConns, node)
+	} else {
+		r.nodeConns[node] = n
+	}
+	return n
+}
+
+// serve runs srv on ln, counting the goroutine it runs in.
+func (r *siteResources) serve(srv *http.Server, ln net.Listener) error {
+	r.addGoroutines(1)
+	defer r.addGoroutines(-1)
+	return srv.Serve(ln)
+}
+
+// limit counts the in-flight requests of next and rejects those over the
+// site's caps with a 503. A request over the connection cap also closes its
+// connection.
+func (r *siteResources) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.addInFlight(1)
+		defer r.addInFlight(-1)
+		if req.ProtoMajor == 2 {
+			r.addGoroutines(1)
+			defer r.addGoroutines(-1)
+		}
+
+		if limit := r.maxRequests.Load(); limit > 0 && r.inFlight.Load() > limit {
+			r.reject(w, "requests")
+			return
+		}
+		if limit := r.maxConns.Load(); limit > 0 && r.conns.Load() > limit {
+			w.Header().Set("Connection", "close")
+			r.reject(w, "connections")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *siteResources) reject(w http.ResponseWriter, limit string) {
+	r.shed.Add(1)
+	metrics.CountShed(r.site, limit)
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "site is busy, try again shortly", http.StatusServiceUnavailable)
+}
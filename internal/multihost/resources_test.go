@@ -0,0 +1,123 @@
+package multihost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+func TestSiteResources_RequestCap(t *testing.T) {
+	res := newSiteResources("docs", storage.SiteConfig{MaxConcurrentRequests: 1}, 0)
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := res.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		done <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("request over the cap: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := res.snapshot(); got.InFlight != 1 || got.Shed != 1 || got.MaxConcurrentRequests != 1 {
+		t.Errorf("resources = %+v, want 1 in flight and 1 shed", got)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("request under the cap: status = %d", code)
+	}
+	if got := res.snapshot(); got.InFlight != 0 {
+		t.Errorf("in flight = %d after the requests finished", got.InFlight)
+	}
+}
+
+func TestSiteResources_ConnectionCap(t *testing.T) {
+	res := newSiteResources("docs", storage.SiteConfig{MaxConnections: 1}, 0)
+	srv := httptest.NewUnstartedServer(res.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	srv.Config.ConnState = res.connState
+	srv.Start()
+	defer srv.Close()
+
+	// Each client keeps its own idle connection open.
+	get := func(c *http.Client) *http.Response {
+		t.Helper()
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	first := &http.Client{Transport: &http.Transport{}}
+	second := &http.Client{Transport: &http.Transport{}}
+	defer first.CloseIdleConnections()
+	defer second.CloseIdleConnections()
+
+	if resp := get(first); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first connection: status = %d", resp.StatusCode)
+	}
+	resp := get(second)
+	if resp.StatusCode != http.StatusServiceUnavailable || !resp.Close {
+		t.Errorf("connection over the cap: status = %d, close = %v", resp.StatusCode, resp.Close)
+	}
+	if got := res.snapshot(); got.Shed != 1 {
+		t.Errorf("shed = %d, want 1", got.Shed)
+	}
+
+	// Caps change without a restart.
+	res.setCaps(storage.SiteConfig{})
+	if resp := get(second); resp.StatusCode != http.StatusOK {
+		t.Errorf("without a cap: status = %d", resp.StatusCode)
+	}
+}
+
+func TestSiteResources_ConnectionsPerNode(t *testing.T) {
+	res := newSiteResources("docs", storage.SiteConfig{}, 1)
+	srv := httptest.NewUnstartedServer(res.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	srv.Config.ConnState = res.connState
+	srv.Start()
+	defer srv.Close()
+
+	first := &http.Client{Transport: &http.Transport{}}
+	second := &http.Client{Transport: &http.Transport{}}
+	defer first.CloseIdleConnections()
+	defer second.CloseIdleConnections()
+
+	resp, err := first.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// Both clients connect from the same address.
+	if resp, err := second.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatalf("connection over the cap per node: status = %d, want it closed", resp.StatusCode)
+	}
+	if got := res.snapshot(); got.Refused != 1 {
+		t.Errorf("refused = %d, want 1", got.Refused)
+	}
+
+	// The slot frees up once the first connection closes.
+	first.CloseIdleConnections()
+	deadline := time.Now().Add(time.Second)
+	for res.snapshot().Connections > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err = second.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("connection after the first closed: %v", err)
+	}
+	resp.Body.Close()
+}
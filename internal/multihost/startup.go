@@ -0,0 +1,224 @@
+package multihost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"tspages/internal/events"
+)
+
+// Startup states of the servers of existing sites.
+const (
+	StartupPending  = "pending"
+	StartupStarting = "starting"
+	StartupReady    = "ready"
+	StartupFailed   = "failed"
+)
+
+// DefaultStartupConcurrency is how many site servers StartExistingSites
+// starts at once unless configured otherwise.
+const DefaultStartupConcurrency = 8
+
+// startupRetries is how many more times a site that failed to start is
+// tried, waiting Manager.retryBackoff before the first retry and twice as
+// long before each next one.
+const (
+	startupRetries = 5
+	startupBackoff = 5 * time.Second
+)
+
+// Startup is the progress of starting the servers of existing sites.
+type Startup struct {
+	// State is StartupPending before StartExistingSites runs, StartupReady
+	// once every site was tried at least once, and StartupFailed if the
+	// sites could not be listed.
+	State   string           `json:"state"`
+	Total   int              `json:"total"`
+	Started int              `json:"started"`
+	Failed  []StartupFailure `json:"failed"`
+	Error   string           `json:"error,omitempty"`
+	// Since is when starting began; Duration how long the first attempt
+	// at every site took.
+	Since    *time.Time `json:"since,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+}
+
+// StartupFailure is a site whose server could not be started.
+type StartupFailure struct {
+	Site     string `json:"site"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	// NextRetry is when the site is tried again, or nil if it no longer is.
+	NextRetry *time.Time `json:"next_retry,omitempty"`
+}
+
+// startupState tracks the progress of StartExistingSites.
+type startupState struct {
+	mu       sync.Mutex
+	state    string
+	total    int
+	started  int
+	failures map[string]StartupFailure
+	err      string
+	since    time.Time
+	duration time.Duration
+}
+
+// Startup returns the progress of starting the servers of existing sites.
+func (m *Manager) Startup() Startup {
+	s := &m.startup
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := Startup{
+		State:   s.state,
+		Total:   s.total,
+		Started: s.started,
+		Failed:  make([]StartupFailure, 0, len(s.failures)),
+		Error:   s.err,
+	}
+	if !s.since.IsZero() {
+		since := s.since
+		out.Since = &since
+	}
+	for _, site := range slices.Sorted(maps.Keys(s.failures)) {
+		out.Failed = append(out.Failed, s.failures[site])
+	}
+	if s.state == StartupReady {
+		out.Duration = s.duration.Round(time.Millisecond).String()
+	}
+	return out
+}
+
+// StartExistingSites starts servers for all created sites, up to the
+// configured number at once, and returns once every site was tried. Sites
+// without an active deployment serve a placeholder page. Sites that fail to
+// start are tried again in the background with increasing delays, until ctx
+// is done.
+func (m *Manager) StartExistingSites(ctx context.Context) error {
+	s := &m.startup
+	sites, err := m.store.ListSites()
+	if err != nil {
+		s.mu.Lock()
+		s.state = StartupFailed
+		s.err = err.Error()
+		s.mu.Unlock()
+		return fmt.Errorf("listing sites: %w", err)
+	}
+
+	start := time.Now()
+	s.mu.Lock()
+	s.state = StartupStarting
+	s.total = len(sites)
+	s.since = start.UTC()
+	s.mu.Unlock()
+	slog.Info("starting sites", "sites", len(sites), "concurrency", m.startupConcurrency)
+
+	sem := make(chan struct{}, m.startupConcurrency)
+	var wg sync.WaitGroup
+	for _, site := range sites {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.EnsureServer(site.Name)
+			<-sem
+			if m.startDone(site.Name, 1, err) {
+				go m.retryStart(ctx, site.Name)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.state = StartupReady
+	s.duration = time.Since(start)
+	started, failed, total := s.started, len(s.failures), s.total
+	s.mu.Unlock()
+
+	slog.Info("sites started", "started", started, "failed", failed, "sites", total, "duration", time.Since(start).Round(time.Millisecond))
+	if m.events != nil {
+		m.events.Publish(events.Event{
+			Type: events.StartupComplete,
+			Data: map[string]any{
+				"started":     started,
+				"failed":      failed,
+				"total":       total,
+				"duration_ms": time.Since(start).Milliseconds(),
+			},
+		})
+	}
+	return ctx.Err()
+}
+
+// startDone records the outcome of the given attempt to start site, and
+// reports whether it should be tried again.
+func (m *Manager) startDone(site string, attempt int, err error) (retry bool) {
+	s := &m.startup
+	s.mu.Lock()
+	if err == nil {
+		s.started++
+		delete(s.failures, site)
+	} else {
+		f := StartupFailure{Site: site, Error: err.Error(), Attempts: attempt}
+		// A rejected auth key fails every retry; SetAuthKey restarts the
+		// site once it is replaced.
+		retry = attempt <= startupRetries && !errors.Is(err, ErrLogin)
+		if retry {
+			next := time.Now().Add(m.retryBackoff << (attempt - 1)).UTC()
+			f.NextRetry = &next
+		}
+		if s.failures == nil {
+			s.failures = make(map[string]StartupFailure)
+		}
+		s.failures[site] = f
+	}
+	started, failed, total := s.started, len(s.failures), s.total
+	s.mu.Unlock()
+
+	data := map[string]any{
+		"site":    site,
+		"attempt": attempt,
+		"started": started,
+		"failed":  failed,
+		"total":   total,
+	}
+	if err == nil {
+		slog.Info("site started", "site", site, "attempt", attempt, "progress", fmt.Sprintf("%d/%d", started, total))
+	} else {
+		slog.Warn("failed to start site", "site", site, "attempt", attempt, "retry", retry, "err", err)
+		data["error"] = err.Error()
+	}
+	if m.events != nil {
+		m.events.Publish(events.Event{Type: events.StartupProgress, Data: data})
+	}
+	return retry
+}
+
+// retryStart tries to start site again with increasing delays until it
+// starts, runs out of retries, or ctx is done.
+func (m *Manager) retryStart(ctx context.Context, site string) {
+	for attempt := 2; ; attempt++ {
+		t := time.NewTimer(m.retryBackoff << (attempt - 2))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if !m.startDone(site, attempt, m.EnsureServer(site)) {
+			return
+		}
+	}
+}
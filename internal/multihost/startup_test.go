@@ -0,0 +1,167 @@
+package multihost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+func newStartupManager(t *testing.T, sites int, concurrency int) (*Manager, *events.Bus) {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	for i := range sites {
+		store.CreateSite(fmt.Sprintf("site-%02d", i))
+	}
+	bus := events.New()
+	m := New(ManagerConfig{
+		Store:              store,
+		StateDir:           t.TempDir(),
+		Capability:         "test/cap",
+		MaxSites:           100,
+		Events:             bus,
+		StartupConcurrency: concurrency,
+	})
+	m.retryBackoff = time.Millisecond
+	return m, bus
+}
+
+func TestStartExistingSites_BoundedConcurrency(t *testing.T) {
+	m, _ := newStartupManager(t, 20, 4)
+
+	var running, peak atomic.Int32
+	m.startSite = func(site string) (*siteServer, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return &siteServer{closer: func() error { return nil }}, nil
+	}
+
+	if got := m.Startup().State; got != StartupPending {
+		t.Errorf("state before start = %q, want pending", got)
+	}
+	if err := m.StartExistingSites(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 4 || p < 2 {
+		t.Errorf("peak concurrency = %d, want 2-4", p)
+	}
+	s := m.Startup()
+	if s.State != StartupReady || s.Total != 20 || s.Started != 20 || len(s.Failed) != 0 || s.Since == nil {
+		t.Errorf("startup = %+v", s)
+	}
+}
+
+func TestStartExistingSites_RetriesFailures(t *testing.T) {
+	m, bus := newStartupManager(t, 3, 2)
+
+	var mu sync.Mutex
+	var progress []events.Event
+	var complete events.Event
+	bus.Subscribe("startup.*", func(e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == events.StartupComplete {
+			complete = e
+		} else {
+			progress = append(progress, e)
+		}
+	})
+
+	var flakyAttempts atomic.Int32
+	m.startSite = func(site string) (*siteServer, error) {
+		switch site {
+		case "site-01":
+			if flakyAttempts.Add(1) < 3 {
+				return nil, errors.New("temporary failure")
+			}
+		case "site-02":
+			return nil, fmt.Errorf("%w: invalid key", ErrLogin)
+		}
+		return &siteServer{closer: func() error { return nil }}, nil
+	}
+
+	if err := m.StartExistingSites(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := m.Startup()
+	if s.State != StartupReady || len(s.Failed) != 2 {
+		t.Fatalf("startup = %+v", s)
+	}
+	mu.Lock()
+	if complete.Data["total"] != 3 || complete.Data["failed"] != 2 {
+		t.Errorf("startup.complete data = %v", complete.Data)
+	}
+	mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.IsRunning("site-01") {
+		if time.Now().After(deadline) {
+			t.Fatalf("site-01 was not retried: %+v", m.Startup())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The starting guard releases before the outcome is recorded.
+	for m.Startup().Started != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	s = m.Startup()
+	if s.Started != 2 || len(s.Failed) != 1 {
+		t.Fatalf("startup after retry = %+v", s)
+	}
+	if f := s.Failed[0]; f.Site != "site-02" || f.Attempts != 1 || f.NextRetry != nil {
+		t.Errorf("login failure = %+v, want one attempt without retry", f)
+	}
+	if got := flakyAttempts.Load(); got != 3 {
+		t.Errorf("site-01 attempts = %d, want 3", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 5 {
+		t.Errorf("got %d startup.progress events, want 5", len(progress))
+	}
+}
+
+func TestStartExistingSites_GivesUp(t *testing.T) {
+	m, _ := newStartupManager(t, 1, 1)
+
+	var attempts atomic.Int32
+	m.startSite = func(site string) (*siteServer, error) {
+		attempts.Add(1)
+		return nil, errors.New("broken")
+	}
+
+	if err := m.StartExistingSites(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := m.Startup()
+		if len(s.Failed) == 1 && s.Failed[0].NextRetry == nil {
+			if s.Failed[0].Attempts != startupRetries+1 {
+				t.Errorf("attempts = %d, want %d", s.Failed[0].Attempts, startupRetries+1)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("retries did not end: %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := attempts.Load(); got != startupRetries+1 {
+		t.Errorf("startSite called %d times, want %d", got, startupRetries+1)
+	}
+}
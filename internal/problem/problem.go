@@ -0,0 +1,144 @@
+// Package problem writes API errors as problem details (RFC 9457, which
+// obsoletes RFC 7807), each carrying a stable code clients can branch on.
+package problem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// ContentType is the media type of a problem details response.
+const ContentType = "application/problem+json"
+
+// Code identifies the kind of error. Codes are part of the API: once
+// published, a code keeps its meaning.
+type Code string
+
+// Generic codes, used when no specific code applies. CodeFor maps HTTP
+// statuses to them.
+const (
+	BadRequest       Code = "bad_request"
+	Forbidden        Code = "forbidden"
+	NotFound         Code = "not_found"
+	MethodNotAllowed Code = "method_not_allowed"
+	Conflict         Code = "conflict"
+	TooLarge         Code = "payload_too_large"
+	Internal         Code = "internal_error"
+	BadGateway       Code = "bad_gateway"
+	Unavailable      Code = "unavailable"
+)
+
+// Specific codes.
+const (
+	InvalidSiteName     Code = "invalid_site_name"
+	InvalidDeploymentID Code = "invalid_deployment_id"
+	SiteExists          Code = "site_exists"
+	SiteNotFound        Code = "site_not_found"
+	SiteArchived        Code = "site_archived"
+	DeploymentExists    Code = "deployment_exists"
+	DeploymentNotFound  Code = "deployment_not_found"
+	DeploymentActive    Code = "deployment_active"
+	DeploymentFailed    Code = "deployment_failed"
+	DeploymentPinned    Code = "deployment_pinned"
+	UploadTooLarge      Code = "upload_too_large"
+	EmptyUpload         Code = "empty_upload"
+	InvalidUpload       Code = "invalid_upload"
+	InvalidConfig       Code = "invalid_config"
+	UploadRejected      Code = "upload_rejected"
+	HostNotAllowed      Code = "host_not_allowed"
+	FetchFailed         Code = "fetch_failed"
+	ChecksumMismatch    Code = "checksum_mismatch"
+	ReadOnly            Code = "read_only"
+)
+
+// CodeFor returns the generic code for an HTTP status.
+func CodeFor(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusRequestEntityTooLarge:
+		return TooLarge
+	case http.StatusBadGateway:
+		return BadGateway
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return BadRequest
+}
+
+// Details is a problem details object. Type is always "about:blank", so
+// Title is the status text; Code tells problems with the same status apart.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   Code   `json:"code"`
+	// Error repeats Detail for clients of the earlier {"error": ...} format.
+	Error string `json:"error"`
+	// Retryable is set if the same request may succeed when sent again
+	// later.
+	Retryable bool `json:"retryable,omitempty"`
+	// RequestID and Actions are set for errors shown to people: the ID the
+	// request is logged with, and what they can do about the error.
+	RequestID string   `json:"request_id,omitempty"`
+	Actions   []string `json:"actions,omitempty"`
+}
+
+// New returns the problem details for status, code, and detail.
+func New(status int, code Code, detail string) Details {
+	return Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Code:      code,
+		Error:     detail,
+		Retryable: Retryable(status),
+	}
+}
+
+// Retryable reports whether a request that failed with status may succeed
+// when sent again later.
+func Retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Write sends a problem details response with the given status, code, and
+// human-readable detail.
+func Write(w http.ResponseWriter, status int, code Code, detail string) {
+	Send(w, status, New(status, code, detail))
+}
+
+// Send sends v as a problem details response. v is Details, or a struct
+// embedding it to add extension members.
+func Send(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("encoding problem response failed", "err", err)
+	}
+}
+
+// Error sends a problem details response with the generic code for status,
+// like http.Error does for plain text.
+func Error(w http.ResponseWriter, detail string, status int) {
+	Write(w, status, CodeFor(status), detail)
+}
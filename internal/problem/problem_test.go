@@ -0,0 +1,59 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, http.StatusConflict, SiteExists, "site already exists")
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"type":   "about:blank",
+		"title":  "Conflict",
+		"status": float64(409),
+		"detail": "site already exists",
+		"code":   "site_exists",
+		"error":  "site already exists",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestCodeFor(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Code
+	}{
+		{http.StatusBadRequest, BadRequest},
+		{http.StatusForbidden, Forbidden},
+		{http.StatusNotFound, NotFound},
+		{http.StatusConflict, Conflict},
+		{http.StatusRequestEntityTooLarge, TooLarge},
+		{http.StatusInternalServerError, Internal},
+		{http.StatusGatewayTimeout, Internal},
+		{http.StatusServiceUnavailable, Unavailable},
+		{http.StatusTeapot, BadRequest},
+	}
+	for _, tt := range tests {
+		if got := CodeFor(tt.status); got != tt.want {
+			t.Errorf("CodeFor(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
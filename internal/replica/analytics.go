@@ -0,0 +1,229 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/storage"
+)
+
+// MaxForwardBatch is the most analytics events a replica forwards to its
+// primary in one request.
+const MaxForwardBatch = 500
+
+// maxForwardBackoff caps how long a forwarder waits after failed attempts.
+const maxForwardBackoff = 5 * time.Minute
+
+// ForwardBatch is the body of POST /replication/analytics.
+type ForwardBatch struct {
+	Events []analytics.Event `json:"events"`
+}
+
+// AnalyticsHandler serves POST /replication/analytics on the primary: a
+// batch of analytics events a replica recorded, written to the primary's
+// database so its dashboards show the traffic of every instance. Each
+// event carries an ID, and a batch sent again is imported only once.
+// Batches are imported one at a time; while one is, others are turned away
+// with 503 and a Retry-After header, and the replica keeps them until then.
+type AnalyticsHandler struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	busy     chan struct{}
+}
+
+func NewAnalyticsHandler(store *storage.Store, recorder *analytics.Recorder) *AnalyticsHandler {
+	return &AnalyticsHandler{store: store, recorder: recorder, busy: make(chan struct{}, 1)}
+}
+
+func (h *AnalyticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanReplicate(auth.CapsFromContext(r.Context())) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var batch ForwardBatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<20)).Decode(&batch); err != nil {
+		problem.Error(w, "invalid batch", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Events) > MaxForwardBatch {
+		problem.Error(w, fmt.Sprintf("batch holds more than %d events", MaxForwardBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Events of sites deleted here since are dropped, as they would be
+	// with the site's own analytics.
+	events := make([]analytics.Event, 0, len(batch.Events))
+	exists := make(map[string]bool)
+	for _, e := range batch.Events {
+		if e.ID == "" || !storage.ValidSiteName(e.Site) {
+			problem.Error(w, "every event needs an id and a valid site", http.StatusBadRequest)
+			return
+		}
+		ok, seen := exists[e.Site]
+		if !seen {
+			_, err := h.store.GetSite(e.Site)
+			ok = err == nil
+			exists[e.Site] = ok
+		}
+		if ok {
+			events = append(events, e)
+		}
+	}
+
+	select {
+	case h.busy <- struct{}{}:
+		defer func() { <-h.busy }()
+	case <-r.Context().Done():
+		return
+	case <-time.After(5 * time.Second):
+		w.Header().Set("Retry-After", "5")
+		problem.Error(w, "importing another batch", http.StatusServiceUnavailable)
+		return
+	}
+
+	imported, err := h.recorder.ImportForwarded(events)
+	if err != nil {
+		slog.Error("importing forwarded analytics failed", "events", len(events), "err", err)
+		problem.Error(w, "writing events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"imported": imported}); err != nil {
+		slog.Warn("encoding analytics import result failed", "err", err)
+	}
+}
+
+// retryAfterError is returned when the primary asks the replica to wait
+// before forwarding again.
+type retryAfterError struct {
+	status string
+	wait   time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("%v: %s, retry after %s", errStatus, e.status, e.wait)
+}
+
+// Forwarder forwards the analytics events a replica records to its
+// primary. The replica's analytics database is the queue: events are
+// recorded there as on any instance, and forwarded in order in batches of
+// up to MaxForwardBatch, each once the primary has taken the one before.
+// How far forwarding got is stored in the database too, so events recorded
+// while the primary is unreachable, or before a restart, are forwarded
+// later.
+type Forwarder struct {
+	recorder *analytics.Recorder
+	client   *http.Client
+	primary  string
+	origin   string
+}
+
+// NewForwarder creates a forwarder to the primary at the given base URL.
+// origin names the replica, such as its hostname, and must differ between
+// the replicas of a primary: it makes the IDs of the events it forwards
+// unique.
+func NewForwarder(recorder *analytics.Recorder, client *http.Client, primary, origin string) *Forwarder {
+	return &Forwarder{recorder: recorder, client: client, primary: primary, origin: origin}
+}
+
+// Run forwards the pending events immediately and then every interval
+// until ctx is cancelled. After a failure, it waits twice as long as
+// before, up to five minutes, or as long as the primary asks to.
+func (f *Forwarder) Run(ctx context.Context, interval time.Duration) {
+	wait := interval
+	for {
+		n, err := f.Forward(ctx)
+		var retry *retryAfterError
+		switch {
+		case err == nil:
+			wait = interval
+		case errors.As(err, &retry):
+			wait = max(retry.wait, interval)
+		default:
+			wait = min(wait*2, max(maxForwardBackoff, interval))
+		}
+		if err != nil {
+			slog.Warn("forwarding analytics failed", "primary", f.primary, "forwarded", n, "retry_in", wait, "err", err)
+		} else if n > 0 {
+			slog.Debug("forwarded analytics", "primary", f.primary, "events", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Forward sends the events recorded since the last forward to the primary,
+// batch by batch, and returns how many it sent. It stops at the first
+// batch that fails, which is sent again next time.
+func (f *Forwarder) Forward(ctx context.Context) (int, error) {
+	cursor, err := f.recorder.ForwardCursor(f.primary)
+	if err != nil {
+		return 0, fmt.Errorf("reading forward cursor: %w", err)
+	}
+	sent := 0
+	for {
+		logged, err := f.recorder.EventsAfter(cursor, MaxForwardBatch)
+		if err != nil {
+			return sent, fmt.Errorf("reading events: %w", err)
+		}
+		if len(logged) == 0 {
+			return sent, nil
+		}
+		batch := ForwardBatch{Events: make([]analytics.Event, len(logged))}
+		for i, l := range logged {
+			l.ID = f.origin + ":" + strconv.FormatInt(l.Seq, 10)
+			batch.Events[i] = l.Event
+		}
+		if err := f.send(ctx, batch); err != nil {
+			return sent, err
+		}
+		cursor = logged[len(logged)-1].Seq
+		if err := f.recorder.SetForwardCursor(f.primary, cursor); err != nil {
+			return sent, fmt.Errorf("storing forward cursor: %w", err)
+		}
+		sent += len(logged)
+	}
+}
+
+func (f *Forwarder) send(ctx context.Context, batch ForwardBatch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.primary+"/api/v1/replication/analytics", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests:
+		wait := time.Second
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		return &retryAfterError{status: resp.Status, wait: wait}
+	default:
+		return fmt.Errorf("%w: POST /replication/analytics: %s", errStatus, resp.Status)
+	}
+}
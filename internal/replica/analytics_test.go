@@ -0,0 +1,148 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func newRecorder(t *testing.T) *analytics.Recorder {
+	t.Helper()
+	r, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// startAnalyticsPrimary serves the analytics forwarding endpoint of a
+// primary with the docs site, recording into recorder.
+func startAnalyticsPrimary(t *testing.T, recorder *analytics.Recorder, handler func(h http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	addDeployment(t, store, "docs", "aaa11111", "v1")
+	h := handler(NewAnalyticsHandler(store, recorder))
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/v1/replication/analytics", h)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(auth.ContextWithCaps(r.Context(), []auth.Cap{{Access: "replica"}})))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func passthrough(h http.Handler) http.Handler { return h }
+
+func totalRequests(t *testing.T, r *analytics.Recorder) int64 {
+	t.Helper()
+	n, err := r.TotalRequests("docs", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestForwarder_Forward(t *testing.T) {
+	primary := newRecorder(t)
+	srv := startAnalyticsPrimary(t, primary, passthrough)
+
+	local := newRecorder(t)
+	now := time.Now()
+	events := make([]analytics.Event, MaxForwardBatch+20)
+	for i := range events {
+		events[i] = analytics.Event{Timestamp: now, Site: "docs", Path: "/", Status: 200}
+	}
+	events = append(events, analytics.Event{Timestamp: now, Site: "gone", Path: "/", Status: 200})
+	if err := local.Import(events); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewForwarder(local, srv.Client(), srv.URL, "pages-replica")
+	n, err := f.Forward(context.Background())
+	if err != nil || n != len(events) {
+		t.Fatalf("forwarded %d, %v; want %d", n, err, len(events))
+	}
+	if got := totalRequests(t, primary); got != int64(MaxForwardBatch+20) {
+		t.Errorf("primary requests = %d, want %d", got, MaxForwardBatch+20)
+	}
+
+	// Nothing is pending, so nothing is sent again.
+	if n, err := f.Forward(context.Background()); err != nil || n != 0 {
+		t.Errorf("second forward = %d, %v; want 0", n, err)
+	}
+
+	// With the cursor lost, say when a response went missing, the primary
+	// still counts every event once.
+	if err := local.SetForwardCursor(srv.URL, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Forward(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := totalRequests(t, primary); got != int64(MaxForwardBatch+20) {
+		t.Errorf("after sending again, primary requests = %d, want %d", got, MaxForwardBatch+20)
+	}
+}
+
+func TestForwarder_Backpressure(t *testing.T) {
+	primary := newRecorder(t)
+	busy := true
+	srv := startAnalyticsPrimary(t, primary, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if busy {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	local := newRecorder(t)
+	local.Import([]analytics.Event{{Timestamp: time.Now(), Site: "docs", Path: "/", Status: 200}})
+	f := NewForwarder(local, srv.Client(), srv.URL, "pages-replica")
+
+	_, err := f.Forward(context.Background())
+	var retry *retryAfterError
+	if !errors.As(err, &retry) || retry.wait != 7*time.Second {
+		t.Fatalf("err = %v, want a retry after 7s", err)
+	}
+	// The events stay queued until the primary takes them.
+	busy = false
+	if n, err := f.Forward(context.Background()); err != nil || n != 1 {
+		t.Errorf("forwarded %d, %v; want 1", n, err)
+	}
+}
+
+func TestAnalyticsHandler_Rejects(t *testing.T) {
+	recorder := newRecorder(t)
+	h := NewAnalyticsHandler(storage.New(t.TempDir()), recorder)
+
+	for name, tt := range map[string]struct {
+		caps   []auth.Cap
+		body   string
+		status int
+	}{
+		"no replica cap": {[]auth.Cap{{Access: "view", Sites: []string{"*"}}}, `{"events":[]}`, http.StatusForbidden},
+		"invalid JSON":   {[]auth.Cap{{Access: "replica"}}, `{`, http.StatusBadRequest},
+		"missing ID":     {[]auth.Cap{{Access: "replica"}}, `{"events":[{"site":"docs","path":"/","status":200}]}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/replication/analytics", strings.NewReader(tt.body))
+		req = req.WithContext(auth.ContextWithCaps(req.Context(), tt.caps))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package replica keeps a secondary tspages instance in sync with a primary.
+//
+// The primary exposes a pull-based API: a snapshot of all sites with their
+// complete deployments and active deployment, and an archive download per
+// deployment. A replica polls the snapshot, downloads deployments it is
+// missing, mirrors activation state, and removes what the primary no longer
+// has. Replicas serve read-only copies of every site under alternate
+// hostnames so clients can fail over when the primary is unavailable.
+package replica
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"tspages/internal/auth"
+	"tspages/internal/problem"
+	"tspages/internal/serve"
+	"tspages/internal/storage"
+)
+
+// Snapshot is the replication state of a primary.
+type Snapshot struct {
+	Sites []Site `json:"sites"`
+}
+
+// Site is the replication state of a single site. Deployments lists the IDs
+// of all complete deployments; failed or in-progress uploads are omitted.
+type Site struct {
+	Name               string   `json:"name"`
+	ActiveDeploymentID string   `json:"active_deployment_id,omitempty"`
+	Deployments        []string `json:"deployments"`
+}
+
+// TakeSnapshot reads the replication state of all sites in store.
+func TakeSnapshot(store *storage.Store) (Snapshot, error) {
+	sites, err := store.ListSites()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{Sites: make([]Site, 0, len(sites))}
+	for _, s := range sites {
+		deps, err := store.ListDeployments(s.Name)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		site := Site{Name: s.Name, ActiveDeploymentID: s.ActiveDeploymentID, Deployments: make([]string, 0, len(deps))}
+		for _, d := range deps {
+			if store.DeploymentComplete(s.Name, d.ID) {
+				site.Deployments = append(site.Deployments, d.ID)
+			}
+		}
+		snap.Sites = append(snap.Sites, site)
+	}
+	return snap, nil
+}
+
+// SnapshotHandler serves GET /replication/snapshot on the primary.
+type SnapshotHandler struct {
+	store *storage.Store
+}
+
+func NewSnapshotHandler(store *storage.Store) *SnapshotHandler {
+	return &SnapshotHandler{store: store}
+}
+
+func (h *SnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanReplicate(auth.CapsFromContext(r.Context())) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	snap, err := TakeSnapshot(h.store)
+	if err != nil {
+		slog.Error("taking replication snapshot failed", "err", err)
+		problem.Error(w, "reading sites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
+		slog.Warn("encoding replication snapshot failed", "err", err)
+	}
+}
+
+// ArchiveHandler serves GET /replication/sites/{site}/deployments/{id} on the
+// primary: a gzipped tar of the deployment.
+type ArchiveHandler struct {
+	store *storage.Store
+}
+
+func NewArchiveHandler(store *storage.Store) *ArchiveHandler {
+	return &ArchiveHandler{store: store}
+}
+
+func (h *ArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !auth.CanReplicate(auth.CapsFromContext(r.Context())) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.store.DeploymentComplete(site, id) {
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	if err := h.store.WriteDeploymentArchive(w, site, id); err != nil {
+		// Headers are already sent; the replica detects the truncated
+		// archive and retries on the next sync.
+		slog.Error("streaming deployment archive failed", "site", site, "id", id, "err", err)
+	}
+}
+
+// CachePolicyHandler serves
+// GET /replication/sites/{site}/deployments/{id}/cache-policy on the
+// primary: the cache policies of the deployment's files, keyed by path, so
+// replicas and mirrors cache them as the primary does.
+type CachePolicyHandler struct {
+	store    *storage.Store
+	defaults storage.SiteConfig
+}
+
+func NewCachePolicyHandler(store *storage.Store, defaults storage.SiteConfig) *CachePolicyHandler {
+	return &CachePolicyHandler{store: store, defaults: defaults}
+}
+
+func (h *CachePolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	site := r.PathValue("site")
+	id := r.PathValue("id")
+	if !storage.ValidSiteName(site) {
+		problem.Write(w, http.StatusBadRequest, problem.InvalidSiteName, "invalid site name")
+		return
+	}
+	if !auth.CanReplicate(auth.CapsFromContext(r.Context())) {
+		problem.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.store.DeploymentComplete(site, id) {
+		problem.Write(w, http.StatusNotFound, problem.DeploymentNotFound, "deployment not found")
+		return
+	}
+
+	policies, err := serve.DeploymentCachePolicies(h.store, site, id, h.defaults)
+	if err != nil {
+		slog.Error("reading cache policies failed", "site", site, "id", id, "err", err)
+		problem.Error(w, "reading cache policies", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policies); err != nil {
+		slog.Warn("encoding cache policies failed", "err", err)
+	}
+}
+
+// ReadOnly rejects every request other than GET and HEAD. Replicas wrap
+// their control plane with it, since changes must be made on the primary.
+func ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			problem.Write(w, http.StatusForbidden, problem.ReadOnly, "read-only replica: make changes on the primary")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,167 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+type mockSites struct {
+	ensured []string
+	stopped []string
+}
+
+func (m *mockSites) EnsureServer(site string) error {
+	m.ensured = append(m.ensured, site)
+	return nil
+}
+
+func (m *mockSites) StopServer(site string) error {
+	m.stopped = append(m.stopped, site)
+	return nil
+}
+
+func addDeployment(t *testing.T, s *storage.Store, site, id, body string) {
+	t.Helper()
+	if _, err := s.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(s.ContentDir(site, id), 0755)
+	os.WriteFile(filepath.Join(s.ContentDir(site, id), "index.html"), []byte(body), 0644)
+	s.MarkComplete(site, id)
+}
+
+// startPrimary serves the replication API for store with the given caps.
+func startPrimary(t *testing.T, store *storage.Store, caps []auth.Cap) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/replication/snapshot", NewSnapshotHandler(store))
+	mux.Handle("GET /api/v1/replication/sites/{site}/deployments/{id}", NewArchiveHandler(store))
+	mux.Handle("GET /api/v1/replication/sites/{site}/deployments/{id}/cache-policy", NewCachePolicyHandler(store, storage.SiteConfig{}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(auth.ContextWithCaps(r.Context(), caps)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSync_MirrorsPrimary(t *testing.T) {
+	primary := storage.New(t.TempDir())
+	addDeployment(t, primary, "docs", "aaa11111", "v1")
+	addDeployment(t, primary, "docs", "bbb22222", "v2")
+	primary.ActivateDeployment("docs", "bbb22222")
+	srv := startPrimary(t, primary, []auth.Cap{{Access: "replica"}})
+
+	local := storage.New(t.TempDir())
+	addDeployment(t, local, "gone", "ccc33333", "old")
+	sites := &mockSites{}
+	syncer := NewSyncer(local, srv.Client(), srv.URL, sites)
+
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := local.CurrentDeployment("docs")
+	if err != nil || id != "bbb22222" {
+		t.Errorf("active = %q, %v; want bbb22222", id, err)
+	}
+	if !local.DeploymentComplete("docs", "aaa11111") {
+		t.Error("inactive deployment should be replicated too")
+	}
+	data, _ := os.ReadFile(filepath.Join(local.SiteRoot("docs"), "index.html"))
+	if string(data) != "v2" {
+		t.Errorf("index.html = %q, want v2", data)
+	}
+	if len(sites.ensured) != 1 || sites.ensured[0] != "docs" {
+		t.Errorf("ensured = %v, want [docs]", sites.ensured)
+	}
+	if _, err := local.GetSite("gone"); err == nil {
+		t.Error("site missing on primary should be removed")
+	}
+	if len(sites.stopped) != 1 || sites.stopped[0] != "gone" {
+		t.Errorf("stopped = %v, want [gone]", sites.stopped)
+	}
+
+	// Activation and deletions on the primary follow on the next sync.
+	primary.ActivateDeployment("docs", "aaa11111")
+	primary.DeleteDeployment("docs", "bbb22222")
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := local.CurrentDeployment("docs"); id != "aaa11111" {
+		t.Errorf("active = %q, want aaa11111", id)
+	}
+	if local.DeploymentComplete("docs", "bbb22222") {
+		t.Error("deployment deleted on primary should be removed")
+	}
+}
+
+func TestSync_Forbidden(t *testing.T) {
+	primary := storage.New(t.TempDir())
+	addDeployment(t, primary, "docs", "aaa11111", "v1")
+	srv := startPrimary(t, primary, []auth.Cap{{Access: "deploy"}})
+
+	local := storage.New(t.TempDir())
+	addDeployment(t, local, "docs", "aaa11111", "v1")
+	syncer := NewSyncer(local, srv.Client(), srv.URL, &mockSites{})
+
+	if err := syncer.Sync(context.Background()); err == nil {
+		t.Fatal("expected error without replica capability")
+	}
+	if _, err := local.GetSite("docs"); err != nil {
+		t.Error("a failed snapshot must not remove local sites")
+	}
+}
+
+func TestCachePolicyHandler(t *testing.T) {
+	primary := storage.New(t.TempDir())
+	addDeployment(t, primary, "docs", "aaa11111", "v1")
+	primary.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{
+		Headers: map[string]map[string]string{"/*": {"Surrogate-Control": "max-age=600"}},
+	})
+	srv := startPrimary(t, primary, []auth.Cap{{Access: "replica"}})
+
+	resp, err := srv.Client().Get(srv.URL + "/api/v1/replication/sites/docs/deployments/aaa11111/cache-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var policies map[string]storage.CachePolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policies); err != nil {
+		t.Fatal(err)
+	}
+	if p := policies["index.html"]; p.MaxAge != 600 || p.SurrogateControl != "max-age=600" {
+		t.Errorf("index.html policy = %+v", p)
+	}
+	// A deployment never activated has its policies stored on first request.
+	if _, err := primary.ReadCachePolicies("docs", "aaa11111"); err != nil {
+		t.Errorf("policies not stored: %v", err)
+	}
+
+	resp, err = srv.Client().Get(srv.URL + "/api/v1/replication/sites/docs/deployments/zzz99999/cache-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown deployment: status = %d", resp.StatusCode)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	handler := ReadOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for method, want := range map[string]int{"GET": 200, "HEAD": 200, "POST": 403, "DELETE": 403} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/sites", nil))
+		if rec.Code != want {
+			t.Errorf("%s status = %d, want %d", method, rec.Code, want)
+		}
+	}
+}
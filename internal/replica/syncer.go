@@ -0,0 +1,187 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// errStatus is returned when the primary answers with a non-200 status.
+var errStatus = errors.New("unexpected status from primary")
+
+// SiteManager is the subset of multihost.Manager the syncer needs to start
+// and stop site servers as sites appear and disappear on the primary.
+type SiteManager interface {
+	EnsureServer(site string) error
+	StopServer(site string) error
+}
+
+// Syncer pulls sites and deployments from a primary into the local store.
+type Syncer struct {
+	store   *storage.Store
+	client  *http.Client
+	primary string
+	sites   SiteManager
+}
+
+// NewSyncer creates a syncer for the primary at the given base URL. The
+// client must be able to reach the primary over the tailnet, so the primary
+// can identify the replica and check its capabilities.
+func NewSyncer(store *storage.Store, client *http.Client, primary string, sites SiteManager) *Syncer {
+	return &Syncer{store: store, client: client, primary: primary, sites: sites}
+}
+
+// Run syncs immediately and then every interval until ctx is cancelled.
+// Failed syncs are logged and retried on the next tick.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil {
+			slog.Warn("replication sync failed", "primary", s.primary, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync brings the local store in line with the primary's current snapshot.
+// Errors for individual sites do not stop the others from syncing; they are
+// returned together.
+func (s *Syncer) Sync(ctx context.Context) error {
+	snap, err := s.fetchSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	want := make(map[string]bool, len(snap.Sites))
+	for _, site := range snap.Sites {
+		if !storage.ValidSiteName(site.Name) {
+			continue
+		}
+		want[site.Name] = true
+		if err := s.syncSite(ctx, site); err != nil {
+			errs = append(errs, fmt.Errorf("site %s: %w", site.Name, err))
+		}
+	}
+
+	local, err := s.store.ListSites()
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("listing local sites: %w", err))...)
+	}
+	for _, site := range local {
+		if want[site.Name] {
+			continue
+		}
+		slog.Info("removing site deleted on primary", "site", site.Name)
+		if err := s.sites.StopServer(site.Name); err != nil {
+			slog.Warn("stopping replicated site", "site", site.Name, "err", err)
+		}
+		if err := s.store.TrashSite(site.Name); err != nil {
+			errs = append(errs, fmt.Errorf("site %s: %w", site.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Syncer) syncSite(ctx context.Context, site Site) error {
+	changed := false
+	if err := s.store.CreateSite(site.Name); err == nil {
+		changed = true
+	} else if !errors.Is(err, storage.ErrSiteExists) {
+		return err
+	}
+
+	want := make(map[string]bool, len(site.Deployments))
+	for _, id := range site.Deployments {
+		if !storage.ValidDeploymentID(id) {
+			continue
+		}
+		want[id] = true
+		if s.store.DeploymentComplete(site.Name, id) {
+			continue
+		}
+		// Drop leftovers of an interrupted download before retrying.
+		_ = s.store.DeleteDeployment(site.Name, id)
+		if err := s.fetchDeployment(ctx, site.Name, id); err != nil {
+			return fmt.Errorf("deployment %s: %w", id, err)
+		}
+		slog.Info("replicated deployment", "site", site.Name, "id", id)
+	}
+
+	current, _ := s.store.CurrentDeployment(site.Name)
+	if site.ActiveDeploymentID != "" && site.ActiveDeploymentID != current && want[site.ActiveDeploymentID] {
+		if err := s.store.ActivateDeployment(site.Name, site.ActiveDeploymentID); err != nil {
+			return fmt.Errorf("activating %s: %w", site.ActiveDeploymentID, err)
+		}
+		changed = true
+	}
+
+	deps, err := s.store.ListDeployments(site.Name)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		if want[d.ID] {
+			continue
+		}
+		if err := s.store.DeleteDeployment(site.Name, d.ID); err != nil && !errors.Is(err, storage.ErrActiveDeployment) {
+			return fmt.Errorf("removing %s: %w", d.ID, err)
+		}
+	}
+
+	if changed {
+		return s.sites.EnsureServer(site.Name)
+	}
+	return nil
+}
+
+func (s *Syncer) fetchSnapshot(ctx context.Context) (Snapshot, error) {
+	resp, err := s.get(ctx, "/api/v1/replication/snapshot")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer resp.Body.Close()
+
+	var snap Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return Snapshot{}, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+func (s *Syncer) fetchDeployment(ctx context.Context, site, id string) error {
+	resp, err := s.get(ctx, "/api/v1/replication/sites/"+url.PathEscape(site)+"/deployments/"+url.PathEscape(id))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s.store.ImportDeployment(site, id, resp.Body)
+}
+
+func (s *Syncer) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.primary+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: GET %s: %s", errStatus, path, resp.Status)
+	}
+	return resp, nil
+}
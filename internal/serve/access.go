@@ -0,0 +1,83 @@
+package serve
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// deniedRule returns the first access rule covering reqPath that the
+// visitor does not satisfy. Every matching rule must allow the visitor. A
+// rule naming a file also covers the clean URL and directory request that
+// resolve to it, so "/secret.html" protects "/secret" as well.
+func (h *Handler) deniedRule(r *http.Request, reqPath, indexPage string, rules []storage.AccessRule) (storage.AccessRule, bool) {
+	if len(rules) == 0 {
+		return storage.AccessRule{}, false
+	}
+	candidates := []string{reqPath, reqPath + ".html", path.Join(reqPath, indexPage)}
+	caps := auth.CapsFromContext(r.Context())
+	info := auth.RequestInfoFromContext(r.Context())
+	for _, rule := range rules {
+		for _, p := range candidates {
+			if matchAccessPath(rule.Path, p) {
+				if !allows(rule, h.site, caps, info) {
+					return rule, true
+				}
+				break
+			}
+		}
+	}
+	return storage.AccessRule{}, false
+}
+
+// allows reports whether the visitor matches any of the rule's users,
+// tags, or capability level.
+func allows(rule storage.AccessRule, site string, caps []auth.Cap, info auth.RequestInfo) bool {
+	if info.UserLogin != "" {
+		login := strings.ToLower(info.UserLogin)
+		for _, user := range rule.Users {
+			if ok, _ := path.Match(strings.ToLower(user), login); ok {
+				return true
+			}
+		}
+	}
+	for _, tag := range rule.Tags {
+		if slices.Contains(info.Tags, tag) {
+			return true
+		}
+	}
+	switch rule.Access {
+	case "view":
+		return auth.CanView(caps, site)
+	case "deploy":
+		return auth.CanDeploy(caps, site)
+	case "admin":
+		return auth.IsAdmin(caps, site)
+	}
+	return false
+}
+
+// matchAccessPath is matchHeaderPath, except that "/dir/*" also matches
+// "/dir" so the directory's own page is covered.
+func matchAccessPath(pattern, reqPath string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/*"); ok && dir != "" && reqPath == dir {
+		return true
+	}
+	return matchHeaderPath(pattern, reqPath)
+}
+
+// serveDenied logs the denial and responds with the 403 page.
+func (h *Handler) serveDenied(w http.ResponseWriter, r *http.Request, reqPath string, rule storage.AccessRule) {
+	info := auth.RequestInfoFromContext(r.Context())
+	slog.Warn("access denied", "site", h.site, "path", reqPath, "rule", rule.Path,
+		"user", info.UserLogin, "node", info.NodeName, "ip", info.NodeIP)
+	w.Header().Set("Cache-Control", "private, no-store")
+	h.serveError(w, r, http.StatusForbidden, "You don't have access to this page.",
+		"Ask the site's admins for access. If you think you should have it, give them the request ID below.")
+}
@@ -0,0 +1,107 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestHandler_AccessRules(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":          "<h1>Docs</h1>",
+		"internal/index.html": "<h1>Internal</h1>",
+		"internal/plan.html":  "<h1>Plan</h1>",
+		"reports/q3.html":     "<h1>Q3</h1>",
+		"secret.html":         "<h1>Secret</h1>",
+		"team/index.html":     "<h1>Team</h1>",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Access: []storage.AccessRule{
+		{Path: "/internal/*", Access: "admin"},
+		{Path: "/reports/*", Users: []string{"*@corp.example"}, Tags: []string{"tag:ci"}},
+		{Path: "/secret.html", Access: "admin"},
+		{Path: "/team/index.html", Access: "admin"},
+	}})
+
+	viewer := []auth.Cap{{Access: "view", Sites: []string{"docs"}}}
+	admin := []auth.Cap{{Access: "admin", Sites: []string{"docs"}}}
+	get := func(p string, caps []auth.Cap, info auth.RequestInfo) *httptest.ResponseRecorder {
+		req := withCaps(httptest.NewRequest("GET", p, nil), caps)
+		req = req.WithContext(auth.ContextWithRequestInfo(req.Context(), info))
+		req.SetPathValue("path", strings.TrimPrefix(p, "/"))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name string
+		path string
+		caps []auth.Cap
+		info auth.RequestInfo
+		want int
+	}{
+		{"unrestricted", "/", viewer, auth.RequestInfo{}, http.StatusOK},
+		{"viewer denied", "/internal/plan", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"directory itself", "/internal", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"missing file", "/internal/nope", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"dot segments", "/x/../internal/plan", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"clean URL", "/secret", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"exact file", "/secret.html", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"directory index", "/team/", viewer, auth.RequestInfo{}, http.StatusForbidden},
+		{"admin allowed", "/internal/plan", admin, auth.RequestInfo{}, http.StatusOK},
+		{"user pattern", "/reports/q3", viewer, auth.RequestInfo{UserLogin: "Alice@Corp.example"}, http.StatusOK},
+		{"other user", "/reports/q3", viewer, auth.RequestInfo{UserLogin: "bob@gmail.com"}, http.StatusForbidden},
+		{"tagged node", "/reports/q3", viewer, auth.RequestInfo{Tags: []string{"tag:ci"}}, http.StatusOK},
+		// Admins get no special treatment where the rule names people.
+		{"admin not listed", "/reports/q3", admin, auth.RequestInfo{UserLogin: "root@gmail.com"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.path, tt.caps, tt.info)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "403") {
+				t.Errorf("body = %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_AccessRulesPermanentDeployment(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"internal/plan.html": "<h1>Plan</h1>"})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Access: []storage.AccessRule{{Path: "/internal/*", Access: "admin"}}})
+
+	req := withCaps(httptest.NewRequest("GET", "/__deployments/aaa11111/internal/plan.html", nil), []auth.Cap{{Access: "view"}})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestMatchAccessPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/internal/*", "/internal", true},
+		{"/internal/*", "/internal/a/b", true},
+		{"/internal/*", "/internals", false},
+		{"/*", "/anything", true},
+		{"/*.pdf", "/docs/a.pdf", true},
+		{"/secret.html", "/secret.html", true},
+		{"/secret.html", "/secret", false},
+	}
+	for _, tt := range tests {
+		if got := matchAccessPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchAccessPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package serve
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"tspages/internal/storage"
+)
+
+// AnalyticsTags returns the analytics tags the current deployment's config
+// extracts from r, as "name:value". Values outside a rule's allow-list are
+// skipped, and longer values are cut to the rule's maximum length. Safe to
+// call from other goroutines.
+func (h *Handler) AnalyticsTags(r *http.Request) []string {
+	h.mu.RLock()
+	rules := h.cachedCfg.AnalyticsTags
+	h.mu.RUnlock()
+
+	var tags []string
+	for _, rule := range rules {
+		var value string
+		if rule.Header != "" {
+			value = r.Header.Get(rule.Header)
+		} else {
+			value = r.URL.Query().Get(rule.Query)
+		}
+		value = cleanTagValue(value)
+		if value == "" || (len(rule.Values) > 0 && !slices.Contains(rule.Values, value)) {
+			continue
+		}
+		maxLength := rule.MaxLength
+		if maxLength == 0 {
+			maxLength = storage.DefaultAnalyticsTagLength
+		}
+		if runes := []rune(value); len(runes) > maxLength {
+			value = string(runes[:maxLength])
+		}
+		tags = append(tags, rule.Name+":"+value)
+	}
+	return tags
+}
+
+// cleanTagValue removes the characters a tag cannot hold: commas separate
+// stored tags, and control characters have no place in a report.
+func cleanTagValue(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == ',' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s))
+}
@@ -0,0 +1,51 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"tspages/internal/storage"
+)
+
+func TestHandler_AnalyticsTags(t *testing.T) {
+	store := storage.New(t.TempDir())
+	h := NewHandler(store, "docs", "", storage.SiteConfig{AnalyticsTags: []storage.AnalyticsTagRule{
+		{Name: "campaign", Header: "X-Campaign", MaxLength: 8},
+		{Name: "source", Query: "utm_source", Values: []string{"mail", "chat"}},
+		{Name: "ref", Query: "ref"},
+	}})
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   []string
+	}{
+		{"none", "/", "", nil},
+		{"header", "/", "spring", []string{"campaign:spring"}},
+		{"truncated", "/", "spring-sale-2026", []string{"campaign:spring-s"}},
+		{"allowed value", "/?utm_source=mail", "", []string{"source:mail"}},
+		{"disallowed value", "/?utm_source=ads", "", nil},
+		{"cleaned", "/?ref=a,b%0A", "", []string{"ref:ab"}},
+		{"all", "/?utm_source=chat&ref=wiki", "q3", []string{"campaign:q3", "source:chat", "ref:wiki"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Campaign", tt.header)
+			}
+			if got := h.AnalyticsTags(req); !slices.Equal(got, tt.want) {
+				t.Errorf("AnalyticsTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	long := strings.Repeat("é", storage.DefaultAnalyticsTagLength+1)
+	got := h.AnalyticsTags(httptest.NewRequest("GET", "/?ref="+long, nil))
+	if len(got) != 1 || got[0] != "ref:"+long[:2*storage.DefaultAnalyticsTagLength] {
+		t.Errorf("AnalyticsTags() = %v, want the value cut to %d runes", got, storage.DefaultAnalyticsTagLength)
+	}
+}
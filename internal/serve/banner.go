@@ -0,0 +1,149 @@
+package serve
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+//go:embed templates/banner.gohtml
+var bannerTmplStr string
+
+//go:embed templates/analytics-notice.gohtml
+var noticeTmplStr string
+
+var bannerTmpl = template.Must(template.New("banner").Parse(bannerTmplStr))
+var noticeTmpl = template.Must(template.New("notice").Parse(noticeTmplStr))
+
+// defaultBannerMessage is shown on archived sites without a custom message.
+const defaultBannerMessage = "This site has been archived and is no longer updated."
+
+// stagingRibbon is injected into HTML pages of sites with staging = true.
+// It sits in a corner and lets clicks through, so it never covers the page.
+const stagingRibbon = `<div role="note" style="position:fixed;top:0;right:0;z-index:2147483647;margin:0;padding:0.25em 0.75em;` +
+	`font:600 12px/1.4 system-ui,-apple-system,sans-serif;letter-spacing:0.05em;text-transform:uppercase;` +
+	`background:#c2410c;color:#fff;border-bottom-left-radius:6px;opacity:0.9;pointer-events:none">Staging</div>`
+
+// archiveBanner returns the banner markup for an archived site, or nil if
+// the site is not archived or its banner is turned off.
+func archiveBanner(store *storage.Store, site string) []byte {
+	state, archived := store.ReadArchiveState(site)
+	if !archived || !state.Banner {
+		return nil
+	}
+	msg := state.Message
+	if msg == "" {
+		msg = defaultBannerMessage
+	}
+	var buf bytes.Buffer
+	if err := bannerTmpl.Execute(&buf, msg); err != nil {
+		return nil
+	}
+	return bytes.TrimSpace(buf.Bytes())
+}
+
+// banner returns the markup injected at the top of HTML pages for r: the
+// staging ribbon, the cached archive banner, the service worker
+// registration, and the analytics notice, any of which may be off. All but
+// the archive banner follow cfg, the config of the deployment served,
+// which need not be the active one. Nil means the page is served
+// unchanged. personal reports whether the markup holds the analytics
+// notice, which differs between visitors.
+func (h *Handler) banner(r *http.Request, cfg storage.SiteConfig) (banner []byte, personal bool) {
+	h.resolve() // fills cachedBanner
+	h.mu.RLock()
+	banner = h.cachedBanner
+	h.mu.RUnlock()
+	if cfg.Staging != nil && *cfg.Staging {
+		banner = append([]byte(stagingRibbon), banner...)
+	}
+	if cfg.Offline != nil && *cfg.Offline {
+		banner = append(append([]byte(nil), banner...), offlineRegistration...)
+	}
+	if h.optOuts == nil || cfg.AnalyticsNotice == nil || !*cfg.AnalyticsNotice ||
+		(cfg.Analytics != nil && !*cfg.Analytics) {
+		return banner, false
+	}
+	login := auth.RequestInfoFromContext(r.Context()).UserLogin
+	var buf bytes.Buffer
+	if err := noticeTmpl.Execute(&buf, struct {
+		Login, Action string
+		OptedOut      bool
+	}{login, OptOutPath, h.optOuts.OptedOut(login)}); err != nil {
+		return banner, false
+	}
+	return append(append([]byte(nil), banner...), bytes.TrimSpace(buf.Bytes())...), true
+}
+
+// isHTMLFile reports whether name is served as an HTML document.
+func isHTMLFile(name string) bool {
+	return strings.HasPrefix(mime.TypeByExtension(filepath.Ext(name)), "text/html")
+}
+
+// injectBanner inserts banner right after the opening <body> tag, or at the
+// start of the document if it has none. Longer tag names, like <body-part>,
+// do not count.
+func injectBanner(page, banner []byte) []byte {
+	at := 0
+	if i := openingTag(bytes.ToLower(page), "body"); i >= 0 {
+		if end := bytes.IndexByte(page[i:], '>'); end >= 0 {
+			at = i + end + 1
+		}
+	}
+	out := make([]byte, 0, len(page)+len(banner))
+	out = append(out, page[:at]...)
+	out = append(out, banner...)
+	return append(out, page[at:]...)
+}
+
+// serveWithBanner serves an HTML file with banner and the meta tags it
+// lacks injected. Precompressed variants and the compression cache hold the
+// original document, so the result is compressed on the fly instead, unless
+// compress is false. A personal banner keeps the page out of shared caches.
+func serveWithBanner(w http.ResponseWriter, r *http.Request, name string, banner []byte, personal bool, meta []metaTag, since time.Time, compress bool) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	stat, err := os.Stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// The document differs from the deployed file, so the ETag covers the
+	// banner and meta tags. With the analytics notice, it also differs
+	// between visitors, so it must not be shared at all.
+	if personal {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Del("ETag")
+	} else if etag := w.Header().Get("ETag"); etag != "" {
+		sum := fnv.New32a()
+		sum.Write(banner)
+		for _, t := range meta {
+			sum.Write([]byte(t.key + "\x00" + t.content + "\x00"))
+		}
+		w.Header().Set("ETag", fmt.Sprintf("%s:%08x\"", strings.TrimSuffix(etag, `"`), sum.Sum32()))
+	}
+	if br, gz := acceptsBrotli(r), acceptsGzip(r); compress && (br || gz) {
+		encoding := "gzip"
+		if br {
+			encoding = "br"
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close() //nolint:errcheck // best-effort flush on response end
+		w = cw
+	}
+	http.ServeContent(w, r, filepath.Base(name), modTime(since, stat), bytes.NewReader(injectMeta(injectBanner(content, banner), meta)))
+}
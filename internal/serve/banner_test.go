@@ -0,0 +1,96 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestInjectBanner(t *testing.T) {
+	banner := []byte("<div>B</div>")
+	tests := []struct {
+		name, page, want string
+	}{
+		{"after body", "<html><body><h1>x</h1></body></html>", "<html><body><div>B</div><h1>x</h1></body></html>"},
+		{"body attributes", `<BODY class="a"><p>x`, `<BODY class="a"><div>B</div><p>x`},
+		{"no body", "<h1>x</h1>", "<div>B</div><h1>x</h1>"},
+		{"unterminated body", "<body", "<div>B</div><body"},
+		{"longer tag name", "<bodyguard-x><p>x</p></bodyguard-x><body><p>y", "<bodyguard-x><p>x</p></bodyguard-x><body><div>B</div><p>y"},
+		{"only longer tag name", "<body-part>x</body-part>", "<div>B</div><body-part>x</body-part>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectBanner([]byte(tt.page), banner)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_ArchiveBanner(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<html><body><h1>Docs</h1></body></html>",
+		"style.css":  "body{}",
+		"404.html":   "<body>missing</body>",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	get := func(path string) *httptest.ResponseRecorder {
+		req := withCaps(httptest.NewRequest("GET", "/"+path, nil), []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+		req.SetPathValue("path", path)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plainETag := get("").Header().Get("ETag")
+
+	store.ArchiveSite("docs", storage.ArchiveState{Banner: true, Message: "Read <only>"})
+	h.InvalidateConfig()
+
+	rec := get("")
+	body := rec.Body.String()
+	if !strings.Contains(body, "<body><div") || !strings.Contains(body, "Read &lt;only&gt;") {
+		t.Errorf("banner missing or unescaped: %s", body)
+	}
+	if etag := rec.Header().Get("ETag"); etag == plainETag || etag == "" {
+		t.Errorf("ETag = %q, same as unarchived %q", etag, plainETag)
+	}
+	if got := get("style.css").Body.String(); got != "body{}" {
+		t.Errorf("css = %q, want untouched", got)
+	}
+	if got := get("nope").Body.String(); !strings.Contains(got, "Read &lt;only&gt;") {
+		t.Errorf("404 page missing banner: %s", got)
+	}
+
+	store.ArchiveSite("docs", storage.ArchiveState{Banner: false})
+	h.InvalidateConfig()
+	if got := get("").Body.String(); strings.Contains(got, "<div") {
+		t.Errorf("banner shown while disabled: %s", got)
+	}
+}
+
+func TestHandler_ArchiveBannerDefaultMessage(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "<h1>Docs</h1>"})
+	store.ArchiveSite("docs", storage.ArchiveState{Banner: true})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	req := withCaps(httptest.NewRequest("GET", "/", nil), []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	req = withCaps(httptest.NewRequest("GET", "/", nil), []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if !strings.HasPrefix(rec.Body.String(), "<div") || !strings.Contains(rec.Body.String(), defaultBannerMessage) {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,82 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// benchSite deploys a small site that exercises every serve path and
+// returns a handler for it.
+func benchSite(b *testing.B) *Handler {
+	b.Helper()
+	store := storage.New(b.TempDir())
+	setupSite(b, store, "docs", "aaa11111", map[string]string{
+		"index.html":             "<!doctype html><h1>Docs</h1>",
+		"about.html":             "<!doctype html><h1>About</h1>",
+		"style.css":              strings.Repeat("body { color: red; }\n", 200),
+		"assets/app.3f9a1c2b.js": strings.Repeat("console.log('hello');\n", 500),
+		"logo.css":               strings.Repeat("a{}", 100),
+		"logo.css.br":            "precompressed",
+	})
+	truthy := true
+	if err := store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{
+		SPARouting: &truthy,
+		Redirects:  []storage.RedirectRule{{From: "/old/:slug", To: "/new/:slug", Status: 301}},
+	}); err != nil {
+		b.Fatal(err)
+	}
+	return NewHandler(store, "docs", "", storage.SiteConfig{})
+}
+
+func benchServe(b *testing.B, h *Handler, path, acceptEncoding string, want int) {
+	b.Helper()
+	caps := []auth.Cap{{Access: "view", Sites: []string{"docs"}}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		req := httptest.NewRequest("GET", path, nil)
+		req = withCaps(req, caps)
+		req.SetPathValue("path", strings.TrimPrefix(path, "/"))
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			b.Fatalf("GET %s: status = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func BenchmarkServe_File(b *testing.B) {
+	benchServe(b, benchSite(b), "/assets/app.3f9a1c2b.js", "", http.StatusOK)
+}
+
+func BenchmarkServe_CleanURL(b *testing.B) {
+	benchServe(b, benchSite(b), "/about", "", http.StatusOK)
+}
+
+func BenchmarkServe_SPAFallback(b *testing.B) {
+	benchServe(b, benchSite(b), "/app/settings/profile", "", http.StatusOK)
+}
+
+func BenchmarkServe_Redirect(b *testing.B) {
+	benchServe(b, benchSite(b), "/old/intro", "", http.StatusMovedPermanently)
+}
+
+func BenchmarkServe_Gzip(b *testing.B) {
+	benchServe(b, benchSite(b), "/style.css", "gzip", http.StatusOK)
+}
+
+func BenchmarkServe_Brotli(b *testing.B) {
+	benchServe(b, benchSite(b), "/style.css", "br", http.StatusOK)
+}
+
+func BenchmarkServe_Precompressed(b *testing.B) {
+	benchServe(b, benchSite(b), "/logo.css", "br", http.StatusOK)
+}
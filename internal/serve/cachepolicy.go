@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+
+	"tspages/internal/storage"
+)
+
+// CachePolicyFor returns the cache policy of the file at filePath: the
+// default Cache-Control for its type, unless the config's headers set one,
+// and the Surrogate-Control the headers set.
+func CachePolicyFor(filePath string, cfg storage.SiteConfig) storage.CachePolicy {
+	header := http.Header{}
+	header.Set("Cache-Control", defaultCacheControl(filePath))
+	setConfigHeaders(header, filePath, cfg)
+	return storage.NewCachePolicy(header.Get("Cache-Control"), header.Get("Surrogate-Control"))
+}
+
+// CachePolicies returns the cache policies of files, keyed by path.
+func CachePolicies(files []storage.FileInfo, cfg storage.SiteConfig) map[string]storage.CachePolicy {
+	policies := make(map[string]storage.CachePolicy, len(files))
+	for _, f := range files {
+		policies[f.Path] = CachePolicyFor(f.Path, cfg)
+	}
+	return policies
+}
+
+// DeploymentCachePolicies returns the cache policies stored for a
+// deployment, working them out and storing them if it was never activated.
+func DeploymentCachePolicies(store *storage.Store, site, id string, defaults storage.SiteConfig) (map[string]storage.CachePolicy, error) {
+	if policies, err := store.ReadCachePolicies(site, id); err == nil || !os.IsNotExist(err) {
+		return policies, err
+	}
+	raw, err := store.ReadSiteConfig(site, id)
+	if err != nil {
+		return nil, err
+	}
+	files, err := store.ListDeploymentFiles(site, id)
+	if err != nil {
+		return nil, err
+	}
+	policies := CachePolicies(files, raw.Merge(defaults))
+	return policies, store.WriteCachePolicies(site, id, policies)
+}
+
+// activateCachePolicies works out the cache policies of the deployment
+// being activated and stores them, unless the stored ones still hold. The
+// server's defaults may have changed since the deployment was last active.
+func activateCachePolicies(store *storage.Store, site, id string, cfg storage.SiteConfig) map[string]storage.CachePolicy {
+	files, err := store.ListDeploymentFiles(site, id)
+	if err != nil {
+		slog.Warn("listing files for cache policies", "site", site, "deployment", id, "err", err)
+		return nil
+	}
+	policies := CachePolicies(files, cfg)
+	if stored, err := store.ReadCachePolicies(site, id); err == nil && maps.Equal(stored, policies) {
+		return policies
+	}
+	if err := store.WriteCachePolicies(site, id, policies); err != nil {
+		slog.Warn("storing cache policies", "site", site, "deployment", id, "err", err)
+	}
+	return policies
+}
+
+// cachePolicy returns the cache policy of reqPath in deployment id. Paths
+// of the active deployment come from the policies worked out on activation;
+// others, such as those of canaries or permanent links, are worked out
+// on the spot.
+func (h *Handler) cachePolicy(id, reqPath string, cfg storage.SiteConfig) storage.CachePolicy {
+	h.mu.RLock()
+	policy, ok := h.cachedPolicies[reqPath]
+	ok = ok && id == h.cachedID
+	h.mu.RUnlock()
+	if ok {
+		return policy
+	}
+	return CachePolicyFor(reqPath, cfg)
+}
@@ -0,0 +1,69 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestCachePolicyFor(t *testing.T) {
+	cfg := storage.SiteConfig{Headers: map[string]map[string]string{
+		"/*.css":   {"Cache-Control": "public, max-age=60"},
+		"/docs/*":  {"Surrogate-Control": "max-age=600"},
+		"/private": {"Cache-Control": "no-store"},
+	}}
+	tests := []struct {
+		path string
+		want storage.CachePolicy
+	}{
+		{"index.html", storage.NewCachePolicy("public, no-cache, stale-while-revalidate=60", "")},
+		{"app.a1b2c3d4.js", storage.NewCachePolicy("public, max-age=31536000, immutable", "")},
+		{"style.css", storage.NewCachePolicy("public, max-age=60", "")},
+		{"docs/guide.html", storage.NewCachePolicy("public, no-cache, stale-while-revalidate=60", "max-age=600")},
+		{"private", storage.NewCachePolicy("no-store", "")},
+	}
+	for _, tt := range tests {
+		if got := CachePolicyFor(tt.path, cfg); got != tt.want {
+			t.Errorf("CachePolicyFor(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_CachePolicies(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>Docs</h1>",
+		"style.css":  "body{}",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Headers: map[string]map[string]string{
+		"/*.css": {"Cache-Control": "public, max-age=60", "Surrogate-Control": "max-age=86400"},
+	}})
+
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "style.css")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	// tspages is the surrogate, so the header is not passed on.
+	if got := rec.Header().Get("Surrogate-Control"); got != "" {
+		t.Errorf("Surrogate-Control = %q, want none", got)
+	}
+
+	// Serving resolved the deployment, which stored its policies.
+	policies, err := store.ReadCachePolicies("docs", "aaa11111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := policies["style.css"]; p.MaxAge != 86400 || p.CacheControl != "public, max-age=60" {
+		t.Errorf("stored style.css policy = %+v", p)
+	}
+	if p := policies["index.html"]; p.MaxAge != 0 || p.NoStore {
+		t.Errorf("stored index.html policy = %+v", p)
+	}
+}
@@ -0,0 +1,94 @@
+package serve
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// canaryTarget is a resolved canary candidate, cached like the active
+// deployment.
+type canaryTarget struct {
+	id      string
+	root    string
+	since   time.Time
+	cfg     storage.SiteConfig
+	percent int
+}
+
+// resolveCanary returns the site's canary candidate, or nil if it has none
+// that can be served. Called from resolve with h.mu held.
+func (h *Handler) resolveCanary(activeID string) *canaryTarget {
+	state, ok := h.store.ReadCanary(h.site)
+	if !ok || state.DeploymentID == activeID || !h.store.DeploymentComplete(h.site, state.DeploymentID) {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(h.store.ContentDir(h.site, state.DeploymentID))
+	if err != nil {
+		slog.Error("resolving canary root", "site", h.site, "deployment", state.DeploymentID, "err", err)
+		return nil
+	}
+	raw, err := h.store.ReadSiteConfig(h.site, state.DeploymentID)
+	if err != nil {
+		slog.Error("reading site config", "site", h.site, "deployment", state.DeploymentID, "err", err)
+	}
+	return &canaryTarget{
+		id:      state.DeploymentID,
+		root:    root,
+		since:   state.StartedAt,
+		cfg:     raw.Merge(h.defaults),
+		percent: state.Percent,
+	}
+}
+
+// canaryFor returns the canary candidate if r's visitor is among those
+// served it, or nil. Visitors are assigned by a hash of their login name,
+// so each keeps seeing the same deployment; anonymous visitors always get
+// the active one.
+func (h *Handler) canaryFor(r *http.Request) *canaryTarget {
+	h.mu.RLock()
+	c := h.cachedCanary
+	h.mu.RUnlock()
+	if c == nil {
+		return nil
+	}
+	login := auth.IdentityFromContext(r.Context()).LoginName
+	if login == "" || canaryBucket(h.site, login) >= c.percent {
+		return nil
+	}
+	return c
+}
+
+// canaryBucket maps a visitor of site to one of 100 buckets. The site is
+// part of the hash so that the same visitors are not the canary audience
+// of every site.
+func canaryBucket(site, login string) int {
+	f := fnv.New32a()
+	f.Write([]byte(site + "\x00" + login))
+	return int(f.Sum32() % 100)
+}
+
+type servedDeploymentKey struct{}
+
+// TrackDeployment returns a copy of r that records which deployment serves
+// it, and a function that returns the deployment's ID once r was served.
+// The ID is empty if no deployment served r, such as for a placeholder.
+func TrackDeployment(r *http.Request) (*http.Request, func() string) {
+	id := new(string)
+	ctx := context.WithValue(r.Context(), servedDeploymentKey{}, id)
+	return r.WithContext(ctx), func() string { return *id }
+}
+
+// recordServedDeployment notes id as the deployment serving r, for
+// TrackDeployment.
+func recordServedDeployment(r *http.Request, id string) {
+	if p, ok := r.Context().Value(servedDeploymentKey{}).(*string); ok {
+		*p = id
+	}
+}
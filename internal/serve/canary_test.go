@@ -0,0 +1,64 @@
+package serve
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// loginInBucket returns a login whose canary bucket for site is below
+// percent, or not, as in says.
+func loginInBucket(t *testing.T, site string, percent int, in bool) string {
+	t.Helper()
+	for i := range 1000 {
+		login := fmt.Sprintf("user%d@example.com", i)
+		if (canaryBucket(site, login) < percent) == in {
+			return login
+		}
+	}
+	t.Fatal("no login found")
+	return ""
+}
+
+func TestHandler_Canary(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "bbb22222", map[string]string{"index.html": "candidate"})
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "active"})
+	if err := store.StartCanary("docs", storage.CanaryState{DeploymentID: "bbb22222", Percent: 30}); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	get := func(login string) (string, string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+		req = req.WithContext(auth.ContextWithIdentity(req.Context(), auth.Identity{LoginName: login}))
+		req.SetPathValue("path", "")
+		req, servedBy := TrackDeployment(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Body.String(), servedBy()
+	}
+
+	canaryUser := loginInBucket(t, "docs", 30, true)
+	for range 3 {
+		if body, id := get(canaryUser); body != "candidate" || id != "bbb22222" {
+			t.Fatalf("canary visitor got %q from %q, want the candidate", body, id)
+		}
+	}
+	if body, id := get(loginInBucket(t, "docs", 30, false)); body != "active" || id != "aaa11111" {
+		t.Errorf("other visitor got %q from %q, want the active deployment", body, id)
+	}
+	if body, _ := get(""); body != "active" {
+		t.Errorf("anonymous visitor got %q, want the active deployment", body)
+	}
+
+	store.StopCanary("docs")
+	h.InvalidateConfig()
+	if body, _ := get(canaryUser); body != "active" {
+		t.Errorf("after the canary ended, got %q, want the active deployment", body)
+	}
+}
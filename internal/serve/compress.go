@@ -4,10 +4,13 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"runtime"
 	"strconv"
 	"strings"
 
 	"github.com/andybalholm/brotli"
+
+	"tspages/internal/metrics"
 )
 
 const compressMinBytes = 256
@@ -59,9 +62,60 @@ func isCompressible(contentType string) bool {
 	return false
 }
 
-// brotliLevel is the compression level for on-the-fly brotli.
-// Level 4 balances compression ratio with CPU cost for dynamic content.
-const brotliLevel = 4
+// addVary appends field to the Vary header unless it is already listed.
+// Unlike Header.Set it preserves other fields (e.g. Accept-Language).
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// CompressionConfig tunes on-the-fly compression for all sites.
+type CompressionConfig struct {
+	// GzipLevel (1-9) and BrotliLevel (0-11) are the compression levels.
+	GzipLevel   int
+	BrotliLevel int
+	// MaxBytes is the size of the largest file compressed on the fly; larger
+	// files are sent uncompressed. 0 compresses files of any size.
+	MaxBytes int64
+	// Workers is how many responses are compressed at the same time, so a
+	// burst of large compressible responses cannot take every CPU from
+	// other sites. 0 uses DefaultCompressWorkers.
+	Workers int
+}
+
+// compression is the on-the-fly compression config. Level 4 brotli
+// balances compression ratio with CPU cost for dynamic content.
+var compression = CompressionConfig{GzipLevel: 6, BrotliLevel: 4, Workers: DefaultCompressWorkers()}
+
+// compressSlots holds a token for every compression in progress.
+var compressSlots = make(chan struct{}, compression.Workers)
+
+// SetCompression replaces the on-the-fly compression config. Must be called
+// before the site servers start.
+func SetCompression(c CompressionConfig) {
+	if c.Workers < 1 {
+		c.Workers = DefaultCompressWorkers()
+	}
+	compression = c
+	compressSlots = make(chan struct{}, c.Workers)
+}
+
+// DefaultCompressWorkers is half the CPUs, and at least one.
+func DefaultCompressWorkers() int {
+	return max(1, runtime.GOMAXPROCS(0)/2)
+}
+
+// overCompressLimit reports whether a file of size bytes is too large to be
+// compressed on the fly.
+func overCompressLimit(size int64) bool {
+	return compression.MaxBytes > 0 && size > compression.MaxBytes
+}
 
 // compressWriter wraps an http.ResponseWriter to transparently compress
 // responses (gzip or brotli) when the content type is compressible and
@@ -70,6 +124,7 @@ type compressWriter struct {
 	http.ResponseWriter
 	enc           io.WriteCloser // gzip or brotli writer, nil until first compressible Write
 	encoding      string         // "gzip" or "br"
+	slots         chan struct{}  // compressSlots while holding a worker
 	headerWritten bool
 	statusCode    int
 }
@@ -97,16 +152,18 @@ func (cw *compressWriter) Write(b []byte) (int, error) {
 		}
 		ct := cw.Header().Get("Content-Type")
 		if isCompressible(ct) {
-			cw.Header().Set("Vary", "Accept-Encoding")
+			addVary(cw.Header(), "Accept-Encoding")
 			clStr := cw.Header().Get("Content-Length")
 			cl, err := strconv.ParseInt(clStr, 10, 64)
-			if err != nil || cl >= compressMinBytes {
-				switch cw.encoding {
-				case "br":
-					cw.enc = brotli.NewWriterLevel(cw.ResponseWriter, brotliLevel)
-				default:
-					cw.enc = gzip.NewWriter(cw.ResponseWriter)
-				}
+			switch {
+			case err == nil && cl < compressMinBytes:
+				// Too small to benefit.
+			case err == nil && overCompressLimit(cl):
+				metrics.CountCompressionSkipped("size")
+			case !cw.acquireWorker():
+				metrics.CountCompressionSkipped("busy")
+			default:
+				cw.enc = newCompressor(cw.ResponseWriter, cw.encoding)
 				cw.Header().Del("Content-Length")
 				cw.Header().Set("Content-Encoding", cw.encoding)
 			}
@@ -128,12 +185,43 @@ func (cw *compressWriter) Close() error {
 		}
 		cw.ResponseWriter.WriteHeader(cw.statusCode)
 	}
+	if cw.slots != nil {
+		defer func() { <-cw.slots }()
+	}
 	if cw.enc != nil {
 		return cw.enc.Close()
 	}
 	return nil
 }
 
+// acquireWorker takes a compression worker without waiting for one. A
+// streamed response holds its worker for as long as the client takes to
+// read it, so when all are busy it is sent uncompressed instead.
+func (cw *compressWriter) acquireWorker() bool {
+	slots := compressSlots
+	select {
+	case slots <- struct{}{}:
+		cw.slots = slots
+		return true
+	default:
+		return false
+	}
+}
+
+// newCompressor returns a writer compressing to w with encoding at the
+// configured level.
+func newCompressor(w io.Writer, encoding string) io.WriteCloser {
+	if encoding == "br" {
+		return brotli.NewWriterLevel(w, compression.BrotliLevel)
+	}
+	enc, err := gzip.NewWriterLevel(w, compression.GzipLevel)
+	if err != nil {
+		// The level is validated with the server config.
+		return gzip.NewWriter(w)
+	}
+	return enc
+}
+
 func (cw *compressWriter) Flush() {
 	type flusher interface{ Flush() error }
 	if f, ok := cw.enc.(flusher); ok {
@@ -0,0 +1,198 @@
+package serve
+
+import (
+	"bytes"
+	"container/list"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"tspages/internal/metrics"
+	"tspages/internal/storage"
+)
+
+const (
+	// compressCacheBytes bounds the total size of cached compressed bodies
+	// across all sites.
+	compressCacheBytes = 32 << 20
+	// compressCacheMaxFile is the largest file whose compressed form is
+	// cached. Larger files are compressed while streaming, as before.
+	compressCacheMaxFile = 1 << 20
+)
+
+// sharedCompressCache holds on-the-fly compression results for all sites.
+var sharedCompressCache = newCompressCache(compressCacheBytes)
+
+// compressCache is an LRU cache of compressed file bodies. Concurrent misses
+// for the same key are coalesced so a file is compressed only once, no
+// matter how many requests for it arrive at the same time.
+type compressCache struct {
+	max      int64
+	compress func(name, encoding string) ([]byte, error)
+	group    singleflight.Group
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type compressEntry struct {
+	key  string
+	data []byte
+}
+
+func newCompressCache(max int64) *compressCache {
+	return &compressCache{max: max, compress: compressFile, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the body of name compressed with encoding. Keys are the
+// resolved file path, which includes the deployment ID, and the encoding;
+// deployments are immutable, so entries never go stale.
+func (c *compressCache) get(name, encoding string) ([]byte, error) {
+	key := name + "\x00" + encoding
+	if data, ok := c.lookup(key); ok {
+		metrics.CountCompressionCache("hit")
+		return data, nil
+	}
+
+	leader := false
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		leader = true
+		data, err := c.compress(name, encoding)
+		if err != nil {
+			return nil, err
+		}
+		c.add(key, data)
+		return data, nil
+	})
+	if leader {
+		metrics.CountCompressionCache("miss")
+	} else {
+		metrics.CountCompressionCache("coalesced")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func (c *compressCache) lookup(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*compressEntry).data, true
+}
+
+func (c *compressCache) add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok || int64(len(data)) > c.max {
+		return
+	}
+	c.items[key] = c.order.PushFront(&compressEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.max {
+		el := c.order.Back()
+		e := el.Value.(*compressEntry)
+		c.order.Remove(el)
+		delete(c.items, e.key)
+		c.size -= int64(len(e.data))
+	}
+}
+
+// purge drops every entry whose file path starts with one of prefixes and
+// returns how many it dropped.
+func (c *compressCache) purge(prefixes []string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, el := range c.items {
+		name, _, _ := strings.Cut(key, "\x00")
+		if !slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(name, p) }) {
+			continue
+		}
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.size -= int64(len(el.Value.(*compressEntry).data))
+		n++
+	}
+	return n
+}
+
+// PurgeCache drops the cached compressed files of every deployment of site
+// whose URL path starts with prefix, such as "/assets/", or all of them if
+// prefix is empty or "/". It returns how many entries it dropped.
+func PurgeCache(store *storage.Store, site, prefix string) (int, error) {
+	deployments, err := store.ListDeployments(site)
+	if err != nil {
+		return 0, err
+	}
+	prefixes := make([]string, 0, len(deployments))
+	for _, d := range deployments {
+		// Keys hold the resolved path, see Handler.resolve.
+		root, err := filepath.EvalSymlinks(store.ContentDir(site, d.ID))
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, root+filepath.FromSlash("/"+strings.TrimPrefix(prefix, "/")))
+	}
+	return sharedCompressCache.purge(prefixes), nil
+}
+
+// compressFile compresses name at the same levels as compressWriter. Files
+// are small enough to wait for a free compression worker.
+func compressFile(name, encoding string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	slots := compressSlots
+	slots <- struct{}{}
+	defer func() { <-slots }()
+	var buf bytes.Buffer
+	enc := newCompressor(&buf, encoding)
+	if _, err := enc.Write(data); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// serveCachedCompressed serves name compressed with encoding from the
+// shared cache. It returns false, without writing, for files that are not
+// compressible by extension or fall outside the cacheable size range, so the
+// caller can stream them through compressWriter instead.
+func serveCachedCompressed(w http.ResponseWriter, r *http.Request, name, encoding string, since time.Time) bool {
+	ct := mime.TypeByExtension(filepath.Ext(name))
+	if !isCompressible(ct) {
+		return false
+	}
+	stat, err := os.Stat(name)
+	if err != nil || stat.IsDir() || stat.Size() < compressMinBytes || stat.Size() > compressCacheMaxFile || overCompressLimit(stat.Size()) {
+		return false
+	}
+	data, err := sharedCompressCache.get(name, encoding)
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Encoding", encoding)
+	addVary(w.Header(), "Accept-Encoding")
+	http.ServeContent(w, r, "", modTime(since, stat), bytes.NewReader(data))
+	return true
+}
@@ -0,0 +1,136 @@
+package serve
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestCompressCache_CoalescesConcurrentMisses(t *testing.T) {
+	c := newCompressCache(1 << 20)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c.compress = func(name, encoding string) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("compressed"), nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := c.get("/data/app.js", "br")
+			if err != nil || string(data) != "compressed" {
+				t.Errorf("get = %q, %v", data, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("compressed %d times, want 1", n)
+	}
+	// Later requests are served from the cache.
+	c.get("/data/app.js", "br")
+	if n := calls.Load(); n != 1 {
+		t.Errorf("compressed %d times after cache fill, want 1", n)
+	}
+	// Other encodings are cached separately.
+	c.get("/data/app.js", "gzip")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("compressed %d times for second encoding, want 2", n)
+	}
+}
+
+func TestCompressCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCompressCache(10)
+	c.compress = func(name, encoding string) ([]byte, error) {
+		return []byte("abcd"), nil
+	}
+	c.get("a", "br")
+	c.get("b", "br")
+	c.get("a", "br") // a is now most recently used
+	c.get("c", "br") // exceeds 10 bytes, evicting b
+
+	if _, ok := c.lookup("a\x00br"); !ok {
+		t.Error("a should still be cached")
+	}
+	if _, ok := c.lookup("b\x00br"); ok {
+		t.Error("b should have been evicted")
+	}
+	if c.size > c.max {
+		t.Errorf("size = %d, exceeds max %d", c.size, c.max)
+	}
+}
+
+func TestHandler_OnTheFlyCompression_Cached(t *testing.T) {
+	store := storage.New(t.TempDir())
+	css := strings.Repeat("body { color: red; }\n", 100)
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"style.css": css})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	for i := range 2 {
+		req := httptest.NewRequest("GET", "/style.css", nil)
+		req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+		req.SetPathValue("path", "style.css")
+		req.Header.Set("Accept-Encoding", "br")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "br" {
+			t.Fatalf("request %d: status = %d, Content-Encoding = %q", i, rec.Code, rec.Header().Get("Content-Encoding"))
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+			t.Errorf("Content-Type = %q, want text/css", ct)
+		}
+		body, err := io.ReadAll(brotli.NewReader(rec.Body))
+		if err != nil || string(body) != css {
+			t.Errorf("request %d: body does not decode to the original (err %v)", i, err)
+		}
+	}
+
+	name, _ := filepath.EvalSymlinks(filepath.Join(store.SiteRoot("docs"), "style.css"))
+	if _, ok := sharedCompressCache.lookup(name + "\x00br"); !ok {
+		t.Error("compressed body should be cached")
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "hi"})
+	root, _ := filepath.EvalSymlinks(store.ContentDir("docs", "aaa11111"))
+	for _, name := range []string{"/index.html", "/assets/app.js", "/assets2/app.js"} {
+		sharedCompressCache.add(root+name+"\x00br", []byte("x"))
+	}
+	sharedCompressCache.add("/elsewhere/assets/app.js\x00br", []byte("x"))
+
+	n, err := PurgeCache(store, "docs", "/assets/")
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeCache(/assets/) = %d, %v, want 1", n, err)
+	}
+	if _, ok := sharedCompressCache.lookup(root + "/assets2/app.js\x00br"); !ok {
+		t.Error("/assets2/app.js should not match /assets/")
+	}
+
+	if n, _ := PurgeCache(store, "docs", ""); n != 2 {
+		t.Errorf("PurgeCache(\"\") = %d, want 2", n)
+	}
+	if _, ok := sharedCompressCache.lookup("/elsewhere/assets/app.js\x00br"); !ok {
+		t.Error("other sites' entries should stay cached")
+	}
+}
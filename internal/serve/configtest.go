@@ -0,0 +1,209 @@
+package serve
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// maxTraceRedirects is how many redirects TracePaths follows before it
+// reports a loop.
+const maxTraceRedirects = 10
+
+// PathTrace is how a deployment answers a request for Path: the redirect
+// rule it matches, where its redirects end, and the file and headers served
+// there.
+type PathTrace struct {
+	Path string `json:"path"`
+	// Status is the status Path is answered with.
+	Status int `json:"status"`
+	// Redirect is the redirect rule Path matches.
+	Redirect *storage.RedirectRule `json:"redirect,omitempty"`
+	// Target is where the redirects of Path end, following those within
+	// the site. It is empty if Path is not redirected.
+	Target string `json:"target,omitempty"`
+	// TargetStatus is the status Target is answered with, unless it is
+	// outside the site.
+	TargetStatus int `json:"target_status,omitempty"`
+	// File is the file served in the end, relative to the content root.
+	File string `json:"file,omitempty"`
+	// Headers are the response headers served with File.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Error explains why the redirects could not be followed to the end.
+	Error string `json:"error,omitempty"`
+}
+
+// TracePaths traces requests for paths through the redirects, headers, and
+// file lookup of a deployment with the given files and config, as the
+// handler would serve them now. Access rules are left out, since they
+// depend on the visitor.
+func TracePaths(files []storage.FileInfo, cfg storage.SiteConfig, paths []string) []PathTrace {
+	t := newTracer(files, cfg)
+	traces := make([]PathTrace, 0, len(paths))
+	for _, p := range paths {
+		traces = append(traces, t.trace(p))
+	}
+	return traces
+}
+
+type tracer struct {
+	cfg       storage.SiteConfig
+	files     map[string]bool
+	dirs      map[string]bool
+	indexPage string
+	now       time.Time
+}
+
+func newTracer(files []storage.FileInfo, cfg storage.SiteConfig) *tracer {
+	t := &tracer{
+		cfg:       cfg,
+		files:     make(map[string]bool, len(files)),
+		dirs:      make(map[string]bool),
+		indexPage: cfg.IndexPage,
+		now:       time.Now(),
+	}
+	if t.indexPage == "" {
+		t.indexPage = "index.html"
+	}
+	for _, f := range files {
+		t.files[f.Path] = true
+		for dir := path.Dir(f.Path); dir != "."; dir = path.Dir(dir) {
+			t.dirs[dir] = true
+		}
+	}
+	return t
+}
+
+func (t *tracer) trace(reqPath string) PathTrace {
+	reqPath, _, _ = strings.Cut(reqPath, "?")
+	if !strings.HasPrefix(reqPath, "/") {
+		reqPath = "/" + reqPath
+	}
+	trace := PathTrace{Path: reqPath}
+	current := reqPath
+	for hop := 0; ; hop++ {
+		status, location, rule := t.step(current)
+		if hop == 0 {
+			trace.Status, trace.Redirect = status, rule
+		}
+		switch {
+		case location == "":
+			if hop > 0 {
+				trace.Target, trace.TargetStatus = current, status
+			}
+			file, _ := t.lookup(current)
+			trace.File, trace.Headers = file, t.headers(file, status)
+			return trace
+		case !strings.HasPrefix(location, "/"):
+			trace.Target = location
+			return trace
+		case hop == maxTraceRedirects:
+			trace.Target = location
+			trace.Error = "too many redirects"
+			return trace
+		}
+		current = location
+	}
+}
+
+// step returns the status of a request for reqPath, and its location and
+// matched rule if it is redirected, checking in the handler's order.
+func (t *tracer) step(reqPath string) (int, string, *storage.RedirectRule) {
+	if unpublished(path.Clean(reqPath), t.indexPage, t.cfg.Schedule, t.now) {
+		return http.StatusNotFound, "", nil
+	}
+	pathSegs := strings.Split(reqPath, "/")
+	for _, rule := range t.cfg.Redirects {
+		if target, ok := matchRedirect(rule, pathSegs); ok {
+			status := rule.Status
+			if status == 0 {
+				status = 301
+			}
+			return status, target, &rule
+		}
+	}
+	if target, ok := checkTrailingSlash(reqPath, t.cfg.TrailingSlash); ok {
+		return http.StatusMovedPermanently, target, nil
+	}
+	if t.cleanURLs() {
+		if target, ok := cleanURLRedirect(reqPath); ok {
+			return http.StatusMovedPermanently, target, nil
+		}
+	}
+	_, status := t.lookup(reqPath)
+	return status, "", nil
+}
+
+func (t *tracer) cleanURLs() bool {
+	return t.cfg.HTMLExtensions == nil || !*t.cfg.HTMLExtensions
+}
+
+// lookup returns the file served for reqPath and its status: the site's 404
+// page, or "" for the built-in one, if nothing is found. Directory listings
+// are named by the directory with a trailing slash.
+func (t *tracer) lookup(reqPath string) (string, int) {
+	filePath := strings.TrimPrefix(path.Clean("/"+reqPath), "/")
+	if filePath == "" {
+		filePath = t.indexPage
+	}
+	listing := t.cfg.DirectoryListing != nil && *t.cfg.DirectoryListing
+	hidden := unpublished(path.Clean(reqPath), t.indexPage, t.cfg.Schedule, t.now) ||
+		listing && isListingTemplate(filePath, t.cleanURLs())
+	if !hidden {
+		switch {
+		case t.files[filePath]:
+			return filePath, http.StatusOK
+		case t.dirs[filePath]:
+			if index := path.Join(filePath, t.indexPage); t.files[index] {
+				return index, http.StatusOK
+			}
+			if listing {
+				return filePath + "/", http.StatusOK
+			}
+		case listing && path.Clean("/"+reqPath) == "/":
+			return "/", http.StatusOK
+		case t.cleanURLs() && t.files[filePath+".html"]:
+			return filePath + ".html", http.StatusOK
+		}
+		if t.cfg.SPARouting != nil && *t.cfg.SPARouting && t.files[t.indexPage] {
+			return t.indexPage, http.StatusOK
+		}
+	}
+	notFoundPage := t.cfg.NotFoundPage
+	if notFoundPage == "" {
+		notFoundPage = "404.html"
+	}
+	if t.files[notFoundPage] {
+		return notFoundPage, http.StatusNotFound
+	}
+	return "", http.StatusNotFound
+}
+
+// headers returns the response headers file is served with.
+func (t *tracer) headers(file string, status int) map[string]string {
+	header := http.Header{}
+	switch {
+	case file == "" || strings.HasSuffix(file, "/"):
+		// The built-in 404 page or a directory listing.
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	case status == http.StatusNotFound:
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		header.Set("Cache-Control", "public, no-cache, stale-while-revalidate=60")
+	default:
+		if ct := mime.TypeByExtension(path.Ext(file)); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+		setConfigHeaders(header, file, t.cfg)
+		header.Set("Cache-Control", CachePolicyFor(file, t.cfg).CacheControl)
+		header.Del("Surrogate-Control")
+	}
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+	return headers
+}
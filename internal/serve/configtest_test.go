@@ -0,0 +1,88 @@
+package serve
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+func TestTracePaths(t *testing.T) {
+	files := []storage.FileInfo{
+		{Path: "index.html"},
+		{Path: "about.html"},
+		{Path: "404.html"},
+		{Path: "blog/index.html"},
+		{Path: "blog/hello.html"},
+		{Path: "assets/app.css"},
+		{Path: "assets/app.a1b2c3d4.js"},
+		{Path: "launch.html"},
+	}
+	cfg := storage.SiteConfig{
+		Redirects: []storage.RedirectRule{
+			{From: "/old-blog/:slug", To: "/blog/:slug"},
+			{From: "/docs/*", To: "https://docs.example.com/*", Status: 302},
+			{From: "/loop-a", To: "/loop-b"},
+			{From: "/loop-b", To: "/loop-a"},
+		},
+		Headers: map[string]map[string]string{
+			"/assets/*": {"Cache-Control": "public, max-age=3600", "X-Frame-Options": "DENY"},
+		},
+		Schedule: []storage.ScheduleRule{{Path: "/launch.html", VisibleFrom: time.Now().Add(time.Hour)}},
+	}
+	traces := TracePaths(files, cfg, []string{
+		"/old-blog/hello",
+		"/docs/setup?x=1",
+		"/about.html",
+		"/assets/app.css",
+		"/assets/app.a1b2c3d4.js",
+		"/blog/",
+		"/nope",
+		"/loop-a",
+		"/launch",
+	})
+	byPath := make(map[string]PathTrace, len(traces))
+	for _, tr := range traces {
+		byPath[tr.Path] = tr
+	}
+
+	if tr := byPath["/old-blog/hello"]; tr.Status != 301 || tr.Redirect == nil || tr.Redirect.From != "/old-blog/:slug" ||
+		tr.Target != "/blog/hello" || tr.TargetStatus != 200 || tr.File != "blog/hello.html" {
+		t.Errorf("redirect rule: %+v", tr)
+	}
+	if tr := byPath["/docs/setup"]; tr.Status != 302 || tr.Target != "https://docs.example.com/setup" || tr.TargetStatus != 0 || tr.File != "" {
+		t.Errorf("external redirect: %+v", tr)
+	}
+	if tr := byPath["/about.html"]; tr.Status != 301 || tr.Redirect != nil || tr.Target != "/about" || tr.File != "about.html" {
+		t.Errorf("clean URL redirect: %+v", tr)
+	}
+	if tr := byPath["/assets/app.css"]; tr.Status != 200 || tr.Headers["Cache-Control"] != "public, max-age=3600" ||
+		tr.Headers["X-Frame-Options"] != "DENY" || tr.Headers["Content-Type"] != "text/css; charset=utf-8" {
+		t.Errorf("config headers: %+v", tr)
+	}
+	if tr := byPath["/assets/app.a1b2c3d4.js"]; tr.Headers["Cache-Control"] != "public, max-age=3600" {
+		t.Errorf("config header over hashed asset default: %+v", tr)
+	}
+	if tr := byPath["/blog/"]; tr.Status != 200 || tr.File != "blog/index.html" || tr.Target != "" {
+		t.Errorf("directory index: %+v", tr)
+	}
+	if tr := byPath["/nope"]; tr.Status != http.StatusNotFound || tr.File != "404.html" || tr.Headers["X-Frame-Options"] != "" {
+		t.Errorf("not found: %+v", tr)
+	}
+	if tr := byPath["/loop-a"]; tr.Error == "" {
+		t.Errorf("redirect loop: %+v", tr)
+	}
+	if tr := byPath["/launch"]; tr.Status != http.StatusNotFound || tr.File != "404.html" {
+		t.Errorf("unpublished: %+v", tr)
+	}
+}
+
+func TestTracePaths_SPA(t *testing.T) {
+	on := true
+	files := []storage.FileInfo{{Path: "index.html"}}
+	traces := TracePaths(files, storage.SiteConfig{SPARouting: &on, TrailingSlash: "remove"}, []string{"/app/settings/"})
+	if tr := traces[0]; tr.Status != 301 || tr.Target != "/app/settings" || tr.TargetStatus != 200 || tr.File != "index.html" {
+		t.Errorf("trace = %+v", tr)
+	}
+}
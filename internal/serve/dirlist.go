@@ -0,0 +1,169 @@
+package serve
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tspages/internal/bytesize"
+)
+
+//go:embed templates/dirlist.gohtml
+var dirlistTmplStr string
+
+var dirlistTmpl = template.Must(template.New("dirlist").Parse(dirlistTmplStr))
+
+// listingTemplate is the file at the root of a deployment that replaces the
+// built-in directory listing. It is not served itself while listings are on.
+const listingTemplate = "_listing.html"
+
+// isListingTemplate reports whether filePath requests the listing template.
+func isListingTemplate(filePath string, cleanURLs bool) bool {
+	return filePath == listingTemplate || cleanURLs && filePath == strings.TrimSuffix(listingTemplate, ".html")
+}
+
+type dirlistEntry struct {
+	Name  string `json:"name"`
+	Href  string `json:"href"`
+	IsDir bool   `json:"is_dir"`
+	// Size is formatted for display; Bytes is the exact size of a file.
+	Size    string    `json:"-"`
+	Bytes   int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Downloads is how often the file was downloaded, if the site counts
+	// downloads.
+	Downloads int64 `json:"downloads,omitempty"`
+}
+
+// dirlistCrumb links to one of the directories leading to a listed one,
+// starting at the root, which is named after the site.
+type dirlistCrumb struct {
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+// dirlistData is what listing templates are executed with, and what is
+// returned for ?format=json.
+type dirlistData struct {
+	Site        string         `json:"site"`
+	Path        string         `json:"path"`
+	Parent      string         `json:"parent,omitempty"`
+	Breadcrumbs []dirlistCrumb `json:"breadcrumbs"`
+	Entries     []dirlistEntry `json:"entries"`
+	// CountsDownloads is set if the entries have download counts.
+	CountsDownloads bool `json:"counts_downloads,omitempty"`
+}
+
+// serveDirectoryListing lists dirPath, which r requested, with the
+// deployment's listing template if it has one, or as JSON if asked to.
+// base is prepended to every link, as for the deployment's other paths.
+func (h *Handler) serveDirectoryListing(w http.ResponseWriter, r *http.Request, resolvedRoot, dirPath, base string) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Sort: directories first, then files, alphabetical within each group.
+	sort.Slice(entries, func(i, j int) bool {
+		di, dj := entries[i].IsDir(), entries[j].IsDir()
+		if di != dj {
+			return di
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	urlPath := r.URL.Path
+	if !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	reqPath := base + urlPath
+
+	downloads := h.downloadCounts(reqPath)
+	data := dirlistData{Site: h.site, Path: reqPath, Entries: []dirlistEntry{}, CountsDownloads: downloads != nil}
+	atRoot := dirPath == resolvedRoot
+	for _, e := range entries {
+		name := e.Name()
+		if atRoot && name == listingTemplate {
+			continue
+		}
+		item := dirlistEntry{Name: name, Href: reqPath + name, IsDir: e.IsDir()}
+		if info, err := e.Info(); err == nil {
+			item.ModTime = info.ModTime().UTC()
+			if !e.IsDir() {
+				item.Bytes = info.Size()
+				item.Size = bytesize.Format(info.Size())
+				item.Downloads = downloads[item.Href]
+			}
+		}
+		data.Entries = append(data.Entries, item)
+	}
+
+	data.Breadcrumbs = []dirlistCrumb{{Name: h.site, Href: base + "/"}}
+	href := base + "/"
+	for _, name := range strings.Split(strings.Trim(urlPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		href += name + "/"
+		data.Breadcrumbs = append(data.Breadcrumbs, dirlistCrumb{Name: name, Href: href})
+	}
+	if urlPath != "/" {
+		data.Parent = path.Dir(strings.TrimRight(reqPath, "/"))
+		if data.Parent != "/" {
+			data.Parent += "/"
+		}
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		body, err := json.Marshal(data)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if body, ok := h.renderListingTemplate(resolvedRoot, data); ok {
+		_, _ = w.Write(body)
+		return
+	}
+	_ = dirlistTmpl.Execute(w, data)
+}
+
+// renderListingTemplate executes the deployment's listing template with
+// data. It reports false if there is none, or it fails, so the built-in
+// listing is shown instead.
+func (h *Handler) renderListingTemplate(resolvedRoot string, data dirlistData) ([]byte, bool) {
+	resolved, err := filepath.EvalSymlinks(filepath.Join(resolvedRoot, listingTemplate))
+	if err != nil || !isUnderRoot(resolved, resolvedRoot) {
+		return nil, false
+	}
+	src, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, false
+	}
+	tmpl, err := template.New(listingTemplate).Parse(string(src))
+	if err != nil {
+		slog.Warn("parsing listing template", "site", h.site, "err", err)
+		return nil, false
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Warn("executing listing template", "site", h.site, "err", err)
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
@@ -0,0 +1,57 @@
+package serve
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DownloadCounter counts the completed downloads of a site's files.
+// *analytics.Recorder implements it.
+type DownloadCounter interface {
+	DownloadCounts(site, prefix string) (map[string]int64, error)
+}
+
+// SetDownloads shows how often each file was downloaded in directory
+// listings of sites that count downloads. Call before serving requests.
+func (h *Handler) SetDownloads(c DownloadCounter) { h.downloads = c }
+
+// IsDownload reports whether a response with status and header, of which
+// written bytes were sent, is a completed download: a 200 with a body
+// other than HTML of at least download_min_kb, sent in full. Range
+// requests are not downloads, so seeking in a video does not count as
+// many. Safe to call from other goroutines.
+func (h *Handler) IsDownload(status int, header http.Header, written int64) bool {
+	h.mu.RLock()
+	minKB := h.cachedCfg.DownloadMinKB
+	h.mu.RUnlock()
+	if minKB <= 0 || status != http.StatusOK || written < minKB*1024 ||
+		strings.HasPrefix(header.Get("Content-Type"), "text/html") {
+		return false
+	}
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && written < n {
+		return false
+	}
+	return true
+}
+
+// downloadCounts returns how often each file under prefix was downloaded,
+// or nil if the site does not count downloads.
+func (h *Handler) downloadCounts(prefix string) map[string]int64 {
+	if h.downloads == nil {
+		return nil
+	}
+	h.mu.RLock()
+	minKB := h.cachedCfg.DownloadMinKB
+	h.mu.RUnlock()
+	if minKB <= 0 {
+		return nil
+	}
+	counts, err := h.downloads.DownloadCounts(h.site, prefix)
+	if err != nil {
+		slog.Warn("counting downloads", "site", h.site, "err", err)
+		return nil
+	}
+	return counts
+}
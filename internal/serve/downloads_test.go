@@ -0,0 +1,94 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestHandler_IsDownload(t *testing.T) {
+	h := NewHandler(storage.New(t.TempDir()), "files", "", storage.SiteConfig{DownloadMinKB: 1})
+	header := func(contentType, length string) http.Header {
+		hdr := http.Header{"Content-Type": {contentType}}
+		if length != "" {
+			hdr.Set("Content-Length", length)
+		}
+		return hdr
+	}
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		written int64
+		want    bool
+	}{
+		{"complete", 200, header("application/zip", "4096"), 4096, true},
+		{"without length", 200, header("application/zip", ""), 4096, true},
+		{"cancelled", 200, header("application/zip", "4096"), 2048, false},
+		{"too small", 200, header("application/zip", "512"), 512, false},
+		{"html", 200, header("text/html; charset=utf-8", "4096"), 4096, false},
+		{"range", 206, header("video/mp4", "4096"), 4096, false},
+		{"not modified", 304, header("application/zip", ""), 0, false},
+	}
+	for _, tt := range tests {
+		if got := h.IsDownload(tt.status, tt.header, tt.written); got != tt.want {
+			t.Errorf("%s: IsDownload() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	off := NewHandler(storage.New(t.TempDir()), "files", "", storage.SiteConfig{})
+	if off.IsDownload(200, header("application/zip", "4096"), 4096) {
+		t.Error("IsDownload() = true without download_min_kb")
+	}
+}
+
+type fakeDownloads map[string]int64
+
+func (f fakeDownloads) DownloadCounts(site, prefix string) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for path, n := range f {
+		if strings.HasPrefix(path, prefix) {
+			counts[path] = n
+		}
+	}
+	return counts, nil
+}
+
+func TestHandler_DirectoryListing_Downloads(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "files", "aaa11111", map[string]string{
+		"iso/a.iso": "a",
+		"iso/b.iso": "b",
+	})
+	dl := true
+	h := NewHandler(store, "files", "", storage.SiteConfig{DirectoryListing: &dl, DownloadMinKB: 1})
+	h.SetDownloads(fakeDownloads{"/iso/a.iso": 3, "/other/a.iso": 9})
+
+	req := httptest.NewRequest("GET", "/iso/?format=json", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "iso")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var listing struct {
+		CountsDownloads bool `json:"counts_downloads"`
+		Entries         []struct {
+			Name      string `json:"name"`
+			Downloads int64  `json:"downloads"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("decode: %v\n%s", err, rec.Body.String())
+	}
+	if !listing.CountsDownloads || len(listing.Entries) != 2 {
+		t.Fatalf("listing = %+v", listing)
+	}
+	if listing.Entries[0].Downloads != 3 || listing.Entries[1].Downloads != 0 {
+		t.Errorf("downloads = %+v, want 3 for a.iso and none for b.iso", listing.Entries)
+	}
+}
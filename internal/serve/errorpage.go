@@ -0,0 +1,43 @@
+package serve
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
+)
+
+//go:embed templates/error.gohtml
+var errorTmplStr string
+
+var errorTmpl = template.Must(template.New("error").Parse(errorTmplStr))
+
+// serveError responds with the built-in error page for status, showing
+// message, what the visitor can do about it, and the request ID. Requests
+// that accept JSON get the same as problem details instead.
+func (h *Handler) serveError(w http.ResponseWriter, r *http.Request, status int, message string, actions ...string) {
+	details := problem.New(status, problem.CodeFor(status), message)
+	details.RequestID = httplog.RequestID(r.Context())
+	details.Actions = actions
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		problem.Send(w, status, details)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := errorTmpl.Execute(&buf, details); err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+func (h *Handler) serveDefault404(w http.ResponseWriter, r *http.Request) {
+	h.serveError(w, r, http.StatusNotFound, "There is no page at this address.", "Check the address for typos.")
+}
@@ -14,22 +14,16 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"tspages/internal/auth"
 	"tspages/internal/storage"
 )
 
-//go:embed templates/404.gohtml
-var default404HTML []byte
-
 //go:embed templates/placeholder.gohtml
 var placeholderTmplStr string
 
-//go:embed templates/dirlist.gohtml
-var dirlistTmplStr string
-
 var placeholderTmpl = template.Must(template.New("placeholder").Parse(placeholderTmplStr))
-var dirlistTmpl = template.Must(template.New("dirlist").Parse(dirlistTmplStr))
 
 type Handler struct {
 	store     *storage.Store
@@ -37,15 +31,32 @@ type Handler struct {
 	dnsSuffix string
 	defaults  storage.SiteConfig
 	public    atomic.Bool
-
-	mu         sync.RWMutex
-	resolved   bool // true once resolve() has run; cleared by InvalidateConfig
-	cachedID   string
-	cachedRoot string // resolved content root (no symlinks)
-	cachedCfg  storage.SiteConfig
-	hintCache  map[string][]string
+	optOuts   OptOutStore
+	downloads DownloadCounter
+
+	// assetResponses counts the responses other than HTML pages, to record
+	// one in analytics_sample_rate of them.
+	assetResponses atomic.Uint64
+
+	mu           sync.RWMutex
+	resolved     bool // true once resolve() has run; cleared by InvalidateConfig
+	cachedID     string
+	cachedRoot   string    // resolved content root (no symlinks)
+	cachedSince  time.Time // activation time, sent as Last-Modified
+	cachedCfg    storage.SiteConfig
+	cachedBanner []byte        // archive banner injected into HTML, nil if none
+	cachedCanary *canaryTarget // nil if the site has no canary
+	hintCache    map[string][]string
+
+	// cachedPolicies are the cache policies of the active deployment's
+	// files, worked out when it was resolved.
+	cachedPolicies map[string]storage.CachePolicy
 }
 
+// deploymentPrefix is the URL prefix under which every completed deployment
+// stays reachable at a permanent, read-only address.
+const deploymentPrefix = "/__deployments/"
+
 // isUnderRoot reports whether resolved is equal to resolvedRoot or a child of it.
 func isUnderRoot(resolved, resolvedRoot string) bool {
 	return resolved == resolvedRoot || strings.HasPrefix(resolved, resolvedRoot+string(os.PathSeparator))
@@ -62,27 +73,29 @@ func (h *Handler) SetPublic(b bool) { h.public.Store(b) }
 
 // resolve returns the cached deployment state, resolving it on first call or
 // after InvalidateConfig. All filesystem lookups (Readlink, EvalSymlinks,
-// ReadSiteConfig) happen here and are cached until the next invalidation.
-func (h *Handler) resolve() (deployID, resolvedRoot string, cfg storage.SiteConfig, ok bool) {
+// ReadSiteConfig, ReadArchiveState) happen here and are cached until the
+// next invalidation.
+func (h *Handler) resolve() (deployID, resolvedRoot string, since time.Time, cfg storage.SiteConfig, ok bool) {
 	h.mu.RLock()
 	if h.resolved {
-		id, root, c := h.cachedID, h.cachedRoot, h.cachedCfg
+		id, root, t, c := h.cachedID, h.cachedRoot, h.cachedSince, h.cachedCfg
 		h.mu.RUnlock()
-		return id, root, c, id != ""
+		return id, root, t, c, id != ""
 	}
 	h.mu.RUnlock()
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if h.resolved {
-		return h.cachedID, h.cachedRoot, h.cachedCfg, h.cachedID != ""
+		return h.cachedID, h.cachedRoot, h.cachedSince, h.cachedCfg, h.cachedID != ""
 	}
 
+	h.cachedBanner = archiveBanner(h.store, h.site)
 	id, err := h.store.CurrentDeployment(h.site)
 	if err != nil {
 		h.resolved = true
 		h.cachedID = ""
-		return "", "", storage.SiteConfig{}, false
+		return "", "", time.Time{}, storage.SiteConfig{}, false
 	}
 
 	root := h.store.SiteRoot(h.site)
@@ -91,7 +104,13 @@ func (h *Handler) resolve() (deployID, resolvedRoot string, cfg storage.SiteConf
 		slog.Error("resolving site root", "site", h.site, "err", err)
 		h.resolved = true
 		h.cachedID = ""
-		return "", "", storage.SiteConfig{}, false
+		return "", "", time.Time{}, storage.SiteConfig{}, false
+	}
+
+	// A zero time falls back to file modification times.
+	activated, err := h.store.ActivatedAt(h.site)
+	if err != nil {
+		slog.Warn("reading activation time", "site", h.site, "err", err)
 	}
 
 	raw, err := h.store.ReadSiteConfig(h.site, id)
@@ -102,10 +121,13 @@ func (h *Handler) resolve() (deployID, resolvedRoot string, cfg storage.SiteConf
 
 	h.cachedID = id
 	h.cachedRoot = rr
+	h.cachedSince = activated
 	h.cachedCfg = merged
+	h.cachedCanary = h.resolveCanary(id)
+	h.cachedPolicies = activateCachePolicies(h.store, h.site, id, merged)
 	h.hintCache = nil
 	h.resolved = true
-	return id, rr, merged, true
+	return id, rr, activated, merged, true
 }
 
 // InvalidateConfig clears the cached deployment state so the next request
@@ -116,7 +138,11 @@ func (h *Handler) InvalidateConfig() {
 	h.resolved = false
 	h.cachedID = ""
 	h.cachedRoot = ""
+	h.cachedSince = time.Time{}
 	h.cachedCfg = storage.SiteConfig{}.Merge(h.defaults)
+	h.cachedBanner = nil
+	h.cachedCanary = nil
+	h.cachedPolicies = nil
 	h.hintCache = nil
 	h.mu.Unlock()
 }
@@ -132,44 +158,170 @@ func (h *Handler) AnalyticsEnabled() bool {
 	return *h.cachedCfg.Analytics
 }
 
+// AnalyticsWeight returns the number of requests the analytics event of a
+// response to reqPath with contentType stands for, or 0 to leave the event
+// out. Pages are always recorded; with an analytics_sample_rate of N, one
+// in N assets is recorded, standing for N. Pages are paths without an
+// extension or with an HTML one, and HTML responses, so that not modified
+// responses without a Content-Type count too. Safe to call from other
+// goroutines.
+func (h *Handler) AnalyticsWeight(reqPath, contentType string) int {
+	h.mu.RLock()
+	rate := h.cachedCfg.AnalyticsSampleRate
+	h.mu.RUnlock()
+	if rate <= 1 || path.Ext(reqPath) == "" || isHTMLFile(reqPath) || strings.HasPrefix(contentType, "text/html") {
+		return 1
+	}
+	if (h.assetResponses.Add(1)-1)%uint64(rate) != 0 {
+		return 0
+	}
+	return rate
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Share links carry their own authorization.
+	if strings.HasPrefix(r.URL.Path, SharePrefix) {
+		h.serveShare(w, r)
+		return
+	}
+
 	caps := auth.CapsFromContext(r.Context())
 	if !h.public.Load() && !auth.CanView(caps, h.site) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	if h.noIndex() {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		if r.URL.Path == "/robots.txt" {
+			serveNoRobots(w, r)
+			return
+		}
+	}
 
-	deploymentID, resolvedRoot, cfg, ok := h.resolve()
+	if r.URL.Path == OptOutPath {
+		h.serveOptOut(w, r)
+		return
+	}
+	if r.URL.Path == OfflineWorkerPath {
+		h.serveOfflineWorker(w, r)
+		return
+	}
+	if r.URL.Path == ManifestPath {
+		h.serveManifest(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, deploymentPrefix) {
+		h.servePermanentDeployment(w, r)
+		return
+	}
+
+	deploymentID, resolvedRoot, since, cfg, ok := h.resolve()
 	if !ok {
 		h.servePlaceholder(w)
 		return
 	}
+	if c := h.canaryFor(r); c != nil {
+		deploymentID, resolvedRoot, since, cfg = c.id, c.root, c.since, c.cfg
+	}
+	h.serveDeployment(w, r, "", deploymentID, resolvedRoot, since, cfg)
+}
 
-	// Check redirects before file resolution (first match wins).
-	if target, status, ok := h.checkRedirects(r.URL.Path, cfg); ok {
-		http.Redirect(w, r, target, status)
+// servePermanentDeployment serves a specific deployment under
+// /__deployments/{id}/..., regardless of which deployment is active. The
+// deployment's own config applies, so a permanent link renders exactly as
+// the site did while that deployment was live.
+func (h *Handler) servePermanentDeployment(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, deploymentPrefix)
+	id, sub, hasSlash := strings.Cut(rest, "/")
+	if !storage.ValidDeploymentID(id) || !h.store.DeploymentComplete(h.site, id) {
+		h.serveDefault404(w, r)
+		return
+	}
+	base := deploymentPrefix + id
+	if !hasSlash {
+		http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
 		return
 	}
 
-	// Trailing slash normalization (before file resolution).
-	if target, ok := checkTrailingSlash(r.URL.Path, cfg.TrailingSlash); ok {
-		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	resolvedRoot, err := filepath.EvalSymlinks(h.store.ContentDir(h.site, id))
+	if err != nil {
+		h.serveDefault404(w, r)
+		return
+	}
+	raw, err := h.store.ReadSiteConfig(h.site, id)
+	if err != nil {
+		slog.Error("reading site config", "site", h.site, "deployment", id, "err", err)
+	}
+	cfg := raw.Merge(h.defaults)
+	// Deployments never change once complete, so their creation
+	// time is a stable Last-Modified.
+	var since time.Time
+	if m, err := h.store.ReadManifest(h.site, id); err == nil {
+		since = m.CreatedAt
+	}
+
+	// Re-root the request so path matching (redirects, headers, clean URLs)
+	// sees the same paths it would for the live deployment.
+	permanent := r.Clone(r.Context())
+	permanent.URL.Path = "/" + sub
+	permanent.URL.RawPath = ""
+	permanent.SetPathValue("path", sub)
+	h.serveDeployment(w, permanent, base, id, resolvedRoot, since, cfg)
+}
+
+// serveDeployment serves r from the given deployment. base is the URL prefix
+// the deployment is mounted under ("" for the active deployment) and is
+// prepended to site-relative redirect targets, listing links, and og:url.
+// since is sent as Last-Modified for every file; if zero, file modification
+// times are used instead.
+func (h *Handler) serveDeployment(w http.ResponseWriter, r *http.Request, base, deploymentID, resolvedRoot string, since time.Time, cfg storage.SiteConfig) {
+	recordServedDeployment(r, deploymentID)
+	// ServeHTTP follows the active deployment; a permanently linked or canary
+	// deployment marked as staging is kept out of search engines too.
+	if cfg.Staging != nil && *cfg.Staging {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+
+	// Access rules apply before anything else, so neither redirects nor
+	// file lookups reveal what a restricted path holds.
+	indexPage := cfg.IndexPage
+	if indexPage == "" {
+		indexPage = "index.html"
+	}
+	reqPath := path.Clean("/" + r.URL.Path)
+	if rule, denied := h.deniedRule(r, reqPath, indexPage, cfg.Access); denied {
+		h.serveDenied(w, r, reqPath, rule)
+		return
+	}
+	// Scheduled paths are not found outside their window, as if they had
+	// not been deployed yet, or were removed.
+	if unpublished(reqPath, indexPage, cfg.Schedule, time.Now()) {
+		h.serve404(w, r, resolvedRoot, cfg)
 		return
 	}
 
 	cleanURLs := cfg.HTMLExtensions == nil || !*cfg.HTMLExtensions
 
-	// Canonical redirect: strip .html/.htm extension when clean URLs are on.
-	if cleanURLs {
-		if target, ok := cleanURLRedirect(r.URL.Path); ok {
-			http.Redirect(w, r, target, http.StatusMovedPermanently)
+	if cfg.StageEnabled(storage.StageRedirects) {
+		// Check redirects before file resolution (first match wins).
+		if target, status, ok := h.checkRedirects(r.URL.Path, cfg); ok {
+			http.Redirect(w, r, rebase(base, target), status)
 			return
 		}
-	}
 
-	indexPage := cfg.IndexPage
-	if indexPage == "" {
-		indexPage = "index.html"
+		// Trailing slash normalization (before file resolution).
+		if target, ok := checkTrailingSlash(r.URL.Path, cfg.TrailingSlash); ok {
+			http.Redirect(w, r, base+target, http.StatusMovedPermanently)
+			return
+		}
+
+		// Canonical redirect: strip .html/.htm extension when clean URLs are on.
+		if cleanURLs {
+			if target, ok := cleanURLRedirect(r.URL.Path); ok {
+				http.Redirect(w, r, base+target, http.StatusMovedPermanently)
+				return
+			}
+		}
 	}
 
 	filePath := filepath.Clean(r.PathValue("path"))
@@ -180,6 +332,21 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if cfg.DirectoryListing != nil && *cfg.DirectoryListing && isListingTemplate(filePath, cleanURLs) {
+		h.serve404(w, r, resolvedRoot, cfg)
+		return
+	}
+
+	// Language negotiation: swap in a localized variant of the document
+	// before resolution so the usual lookup order still applies to it.
+	// Variants are other paths, so the checks on reqPath apply to each.
+	if cfg.I18n != nil && *cfg.I18n {
+		filePath = negotiateLanguage(w, r, resolvedRoot, filePath, indexPage, cleanURLs, cfg.DefaultLanguage, func(candidate string) bool {
+			p := "/" + filepath.ToSlash(candidate)
+			_, denied := h.deniedRule(r, p, indexPage, cfg.Access)
+			return !denied && shareAllows(r, p, indexPage) && !unpublished(p, indexPage, cfg.Schedule, time.Now())
+		})
+	}
 
 	fullPath := filepath.Join(resolvedRoot, filePath)
 
@@ -192,22 +359,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			htmlPath := fullPath + ".html"
 			if resolvedHTML, err := filepath.EvalSymlinks(htmlPath); err == nil {
 				if isUnderRoot(resolvedHTML, resolvedRoot) {
-					htmlFilePath := filePath + ".html"
-					h.sendEarlyHints(w, deploymentID, htmlFilePath, htmlPath)
-					w.Header().Set("Cache-Control", defaultCacheControl(htmlFilePath))
-					h.applyHeaders(w, htmlFilePath, cfg)
-					w.Header().Set("ETag", fmt.Sprintf(`"%s:%s"`, deploymentID, htmlFilePath))
-					h.serveFileCompressed(w, r, resolvedRoot, htmlPath)
+					h.serveFile(w, r, base, resolvedRoot, deploymentID, filePath+".html", htmlPath, since, cfg)
 					return
 				}
 			}
 		}
+		// A root without an index page is listed like any other directory.
+		if reqPath == "/" && cfg.DirectoryListing != nil && *cfg.DirectoryListing {
+			h.serveDirectoryListing(w, r, resolvedRoot, resolvedRoot, base)
+			return
+		}
 		// SPA fallback or 404
 		if cfg.SPARouting != nil && *cfg.SPARouting {
-			h.serveSPAFallback(w, r, resolvedRoot, deploymentID, indexPage, cfg)
+			h.serveSPAFallback(w, r, base, resolvedRoot, deploymentID, indexPage, since, cfg)
 			return
 		}
-		h.serve404(w, resolvedRoot, cfg)
+		h.serve404(w, r, resolvedRoot, cfg)
 		return
 	}
 	if !isUnderRoot(resolved, resolvedRoot) {
@@ -220,58 +387,75 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		dirIndexPath := filepath.Join(fullPath, indexPage)
 		resolvedIndex, err := filepath.EvalSymlinks(dirIndexPath)
 		if err == nil && isUnderRoot(resolvedIndex, resolvedRoot) {
-			indexFilePath := filepath.Join(filePath, indexPage)
-			h.sendEarlyHints(w, deploymentID, indexFilePath, dirIndexPath)
-			w.Header().Set("Cache-Control", defaultCacheControl(indexFilePath))
-			h.applyHeaders(w, indexFilePath, cfg)
-			w.Header().Set("ETag", fmt.Sprintf(`"%s:%s"`, deploymentID, indexFilePath))
-			h.serveFileCompressed(w, r, resolvedRoot, dirIndexPath)
+			h.serveFile(w, r, base, resolvedRoot, deploymentID, filepath.Join(filePath, indexPage), dirIndexPath, since, cfg)
 			return
 		}
 		// No index file — try directory listing
 		if cfg.DirectoryListing != nil && *cfg.DirectoryListing {
-			h.serveDirectoryListing(w, resolved, r.URL.Path)
+			h.serveDirectoryListing(w, r, resolvedRoot, resolved, base)
 			return
 		}
 		// No index, no listing — SPA fallback or 404
 		if cfg.SPARouting != nil && *cfg.SPARouting {
-			h.serveSPAFallback(w, r, resolvedRoot, deploymentID, indexPage, cfg)
+			h.serveSPAFallback(w, r, base, resolvedRoot, deploymentID, indexPage, since, cfg)
 			return
 		}
-		h.serve404(w, resolvedRoot, cfg)
+		h.serve404(w, r, resolvedRoot, cfg)
 		return
 	}
 
-	// Send early hints for HTML files before setting final response headers.
-	h.sendEarlyHints(w, deploymentID, filePath, fullPath)
-	// Set default Cache-Control before user headers so [headers] config can override.
-	w.Header().Set("Cache-Control", defaultCacheControl(filePath))
-	h.applyHeaders(w, filePath, cfg)
-	// Deployments are immutable, so deploymentID:filePath is a stable ETag.
-	// http.ServeFile checks If-None-Match and returns 304 when it matches.
-	w.Header().Set("ETag", fmt.Sprintf(`"%s:%s"`, deploymentID, filePath))
-	h.serveFileCompressed(w, r, resolvedRoot, fullPath)
+	h.serveFile(w, r, base, resolvedRoot, deploymentID, filePath, fullPath, since, cfg)
 }
 
-func (h *Handler) serveSPAFallback(w http.ResponseWriter, r *http.Request, resolvedRoot, deploymentID, indexPage string, cfg storage.SiteConfig) {
+func (h *Handler) serveSPAFallback(w http.ResponseWriter, r *http.Request, base, resolvedRoot, deploymentID, indexPage string, since time.Time, cfg storage.SiteConfig) {
 	indexPath := filepath.Join(resolvedRoot, indexPage)
 	resolved, err := filepath.EvalSymlinks(indexPath)
 	if err != nil {
-		h.serveDefault404(w)
+		h.serveDefault404(w, r)
 		return
 	}
 	if !isUnderRoot(resolved, resolvedRoot) {
-		h.serveDefault404(w)
+		h.serveDefault404(w, r)
 		return
 	}
-	h.sendEarlyHints(w, deploymentID, indexPage, indexPath)
-	w.Header().Set("Cache-Control", defaultCacheControl(indexPage))
-	h.applyHeaders(w, indexPage, cfg)
-	w.Header().Set("ETag", fmt.Sprintf(`"%s:%s"`, deploymentID, indexPage))
-	h.serveFileCompressed(w, r, resolvedRoot, indexPath)
+	h.serveFile(w, r, base, resolvedRoot, deploymentID, indexPage, indexPath, since, cfg)
+}
+
+// serveFile serves the file at fullPath, filePath relative to the content
+// root, passing it through the headers, cache, and compression stages of
+// the pipeline that cfg leaves enabled. base is as for serveDeployment.
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, base, resolvedRoot, deploymentID, filePath, fullPath string, since time.Time, cfg storage.SiteConfig) {
+	// Send early hints for HTML files before setting final response headers.
+	h.sendEarlyHints(w, deploymentID, filePath, fullPath)
+	h.applyHeaders(w, deploymentID, filePath, cfg)
+	if cfg.StageEnabled(storage.StageCache) {
+		// Deployments are immutable, so deploymentID:filePath is a stable
+		// ETag. http.ServeContent checks If-None-Match and returns 304 when
+		// it matches.
+		w.Header().Set("ETag", fmt.Sprintf(`"%s:%s"`, deploymentID, filePath))
+	}
+	h.serveFileCompressed(w, r, base, resolvedRoot, fullPath, since, cfg)
+}
+
+// applyHeaders sets the headers the config sets for reqPath, over those of
+// its security_headers preset, and the Cache-Control header of its cache
+// policy, unless the headers or cache stage is disabled. Surrogate-Control
+// is for caches in between, which tspages is itself, so it is not passed
+// on.
+func (h *Handler) applyHeaders(w http.ResponseWriter, deploymentID, reqPath string, cfg storage.SiteConfig) {
+	if cfg.StageEnabled(storage.StageHeaders) {
+		setConfigHeaders(w.Header(), reqPath, cfg)
+	}
+	if cfg.StageEnabled(storage.StageCache) {
+		w.Header().Set("Cache-Control", h.cachePolicy(deploymentID, reqPath, cfg).CacheControl)
+	}
+	w.Header().Del("Surrogate-Control")
 }
 
-func (h *Handler) applyHeaders(w http.ResponseWriter, reqPath string, cfg storage.SiteConfig) {
+func setConfigHeaders(header http.Header, reqPath string, cfg storage.SiteConfig) {
+	for name, value := range cfg.SecurityHeaderSet() {
+		header.Set(name, value)
+	}
 	// Sort patterns so that more specific patterns (longer, no wildcard)
 	// are applied after less specific ones, producing deterministic results
 	// when multiple patterns match.
@@ -283,7 +467,7 @@ func (h *Handler) applyHeaders(w http.ResponseWriter, reqPath string, cfg storag
 	for _, pattern := range patterns {
 		if matchHeaderPath(pattern, "/"+reqPath) {
 			for name, value := range cfg.Headers[pattern] {
-				w.Header().Set(name, value)
+				header.Set(name, value)
 			}
 		}
 	}
@@ -352,24 +536,36 @@ func isMixedAlphanumeric(s string) bool {
 // serveFileCompressed serves a file, preferring a precompressed variant on
 // disk (.br, .gz) before falling back to on-the-fly compression.
 // Priority: precompressed .br > precompressed .gz > on-the-fly br > on-the-fly gzip.
-func (h *Handler) serveFileCompressed(w http.ResponseWriter, r *http.Request, resolvedRoot, path string) {
+// On-the-fly results for small files are cached and shared across requests.
+// When cfg, the config of the deployment served, disables the compression
+// stage, the file is always served as it is. base is as for serveDeployment.
+func (h *Handler) serveFileCompressed(w http.ResponseWriter, r *http.Request, base, resolvedRoot, path string, since time.Time, cfg storage.SiteConfig) {
+	compress := cfg.StageEnabled(storage.StageCompression)
 	// Set Vary unconditionally for compressible types so caches know the
 	// response can differ by encoding, even when served uncompressed.
-	if ct := mime.TypeByExtension(filepath.Ext(path)); isCompressible(ct) {
-		w.Header().Set("Vary", "Accept-Encoding")
+	if ct := mime.TypeByExtension(filepath.Ext(path)); compress && isCompressible(ct) {
+		addVary(w.Header(), "Accept-Encoding")
+	}
+
+	if isHTMLFile(path) {
+		banner, personal := h.banner(r, cfg)
+		if meta := previewTags(r, base, cfg.SocialPreviews); banner != nil || meta != nil {
+			serveWithBanner(w, r, path, banner, personal, meta, since, compress)
+			return
+		}
 	}
 
-	br := acceptsBrotli(r)
-	gz := acceptsGzip(r)
+	br := compress && acceptsBrotli(r)
+	gz := compress && acceptsGzip(r)
 
 	// Prefer precompressed files (higher compression quality than on-the-fly).
 	if br {
-		if servePrecompressed(w, r, resolvedRoot, path, ".br", "br") {
+		if servePrecompressed(w, r, resolvedRoot, path, ".br", "br", since) {
 			return
 		}
 	}
 	if gz {
-		if servePrecompressed(w, r, resolvedRoot, path, ".gz", "gzip") {
+		if servePrecompressed(w, r, resolvedRoot, path, ".gz", "gzip", since) {
 			return
 		}
 	}
@@ -380,20 +576,24 @@ func (h *Handler) serveFileCompressed(w http.ResponseWriter, r *http.Request, re
 		if br {
 			encoding = "br"
 		}
+		if serveCachedCompressed(w, r, path, encoding, since) {
+			return
+		}
 		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
 		defer cw.Close() //nolint:errcheck // best-effort flush on response end
-		serveFileContent(cw, r, path)
+		serveFileContent(cw, r, path, since)
 		return
 	}
 
-	serveFileContent(w, r, path)
+	serveFileContent(w, r, path, since)
 }
 
 // serveFileContent opens a file and serves it with http.ServeContent.
 // Unlike http.ServeFile, it does not perform internal redirects, so
 // caller-set headers (ETag, Cache-Control) are never leaked into a
-// redirect response.
-func serveFileContent(w http.ResponseWriter, r *http.Request, name string) {
+// redirect response. since overrides the file's modification time for
+// Last-Modified and If-Modified-Since unless it is zero.
+func serveFileContent(w http.ResponseWriter, r *http.Request, name string, since time.Time) {
 	f, err := os.Open(name)
 	if err != nil {
 		http.NotFound(w, r)
@@ -405,13 +605,13 @@ func serveFileContent(w http.ResponseWriter, r *http.Request, name string) {
 		http.NotFound(w, r)
 		return
 	}
-	http.ServeContent(w, r, filepath.Base(name), stat.ModTime(), f)
+	http.ServeContent(w, r, filepath.Base(name), modTime(since, stat), f)
 }
 
 // servePrecompressed tries to serve a precompressed variant of origPath
 // (e.g. style.css.br for style.css). Returns true if the file existed
 // and was served.
-func servePrecompressed(w http.ResponseWriter, r *http.Request, resolvedRoot, origPath, ext, encoding string) bool {
+func servePrecompressed(w http.ResponseWriter, r *http.Request, resolvedRoot, origPath, ext, encoding string, since time.Time) bool {
 	compPath := origPath + ext
 	resolved, err := filepath.EvalSymlinks(compPath)
 	if err != nil {
@@ -435,14 +635,24 @@ func servePrecompressed(w http.ResponseWriter, r *http.Request, resolvedRoot, or
 		w.Header().Set("Content-Type", ct)
 	}
 	w.Header().Set("Content-Encoding", encoding)
-	w.Header().Set("Vary", "Accept-Encoding")
+	addVary(w.Header(), "Accept-Encoding")
 
 	// ETag is already set by the caller; http.ServeContent handles
-	// If-None-Match and range requests.
-	http.ServeContent(w, r, "", stat.ModTime(), f)
+	// conditional and range requests.
+	http.ServeContent(w, r, "", modTime(since, stat), f)
 	return true
 }
 
+// modTime returns since, or the file's modification time if since is zero.
+// http.ServeContent derives Last-Modified from it and evaluates
+// If-Modified-Since and If-Unmodified-Since against it.
+func modTime(since time.Time, stat os.FileInfo) time.Time {
+	if since.IsZero() {
+		return stat.ModTime()
+	}
+	return since
+}
+
 // matchHeaderPath matches a request path against a header pattern.
 // Patterns: "/*" matches all, "/dir/*" matches paths under /dir/,
 // "/*.ext" matches files with that extension anywhere.
@@ -518,6 +728,15 @@ func matchRedirect(rule storage.RedirectRule, pathSegs []string) (string, bool)
 	return strings.Join(toSegs, "/"), true
 }
 
+// rebase prefixes a site-relative redirect target with base. Absolute URLs
+// are returned unchanged.
+func rebase(base, target string) string {
+	if base == "" || !strings.HasPrefix(target, "/") {
+		return target
+	}
+	return base + target
+}
+
 func (h *Handler) checkRedirects(reqPath string, cfg storage.SiteConfig) (string, int, bool) {
 	pathSegs := strings.Split(reqPath, "/")
 	for _, rule := range cfg.Redirects {
@@ -532,85 +751,6 @@ func (h *Handler) checkRedirects(reqPath string, cfg storage.SiteConfig) (string
 	return "", 0, false
 }
 
-type dirlistEntry struct {
-	Name  string
-	Href  string
-	IsDir bool
-	Size  string
-}
-
-func (h *Handler) serveDirectoryListing(w http.ResponseWriter, dirPath, reqPath string) {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	// Sort: directories first, then files, alphabetical within each group.
-	sort.Slice(entries, func(i, j int) bool {
-		di, dj := entries[i].IsDir(), entries[j].IsDir()
-		if di != dj {
-			return di
-		}
-		return entries[i].Name() < entries[j].Name()
-	})
-
-	if !strings.HasSuffix(reqPath, "/") {
-		reqPath += "/"
-	}
-
-	var items []dirlistEntry
-	for _, e := range entries {
-		name := e.Name()
-		href := reqPath + name
-		size := ""
-		if !e.IsDir() {
-			if info, err := e.Info(); err == nil {
-				size = formatBytes(info.Size())
-			}
-		}
-		items = append(items, dirlistEntry{
-			Name:  name,
-			Href:  href,
-			IsDir: e.IsDir(),
-			Size:  size,
-		})
-	}
-
-	parent := ""
-	if reqPath != "/" {
-		parent = path.Dir(strings.TrimRight(reqPath, "/"))
-		if parent != "/" {
-			parent += "/"
-		}
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_ = dirlistTmpl.Execute(w, struct {
-		Path    string
-		Parent  string
-		Entries []dirlistEntry
-	}{reqPath, parent, items})
-}
-
-func formatBytes(b int64) string {
-	const (
-		kB = 1024
-		mB = 1024 * kB
-		gB = 1024 * mB
-	)
-	switch {
-	case b >= gB:
-		return fmt.Sprintf("%.1f GB", float64(b)/float64(gB))
-	case b >= mB:
-		return fmt.Sprintf("%.1f MB", float64(b)/float64(mB))
-	case b >= kB:
-		return fmt.Sprintf("%.1f KB", float64(b)/float64(kB))
-	default:
-		return fmt.Sprintf("%d B", b)
-	}
-}
-
 // checkTrailingSlash returns a redirect target if the request path needs
 // trailing-slash normalization. mode is "add", "remove", or "" (disabled).
 // Paths with file extensions and the root "/" are never redirected.
@@ -647,7 +787,7 @@ func cleanURLRedirect(reqPath string) (string, bool) {
 	return strings.TrimSuffix(reqPath, path.Ext(reqPath)), true
 }
 
-func (h *Handler) serve404(w http.ResponseWriter, resolvedRoot string, cfg storage.SiteConfig) {
+func (h *Handler) serve404(w http.ResponseWriter, r *http.Request, resolvedRoot string, cfg storage.SiteConfig) {
 	notFoundPage := cfg.NotFoundPage
 	if notFoundPage == "" {
 		notFoundPage = "404.html"
@@ -656,21 +796,23 @@ func (h *Handler) serve404(w http.ResponseWriter, resolvedRoot string, cfg stora
 	if resolved, err := filepath.EvalSymlinks(custom404); err == nil {
 		if isUnderRoot(resolved, resolvedRoot) {
 			if content, err := os.ReadFile(resolved); err == nil {
+				banner, personal := h.banner(r, cfg)
+				if banner != nil {
+					content = injectBanner(content, banner)
+				}
 				w.Header().Set("Content-Type", "text/html; charset=utf-8")
-				w.Header().Set("Cache-Control", "public, no-cache, stale-while-revalidate=60")
+				if personal {
+					w.Header().Set("Cache-Control", "private, no-cache")
+				} else {
+					w.Header().Set("Cache-Control", "public, no-cache, stale-while-revalidate=60")
+				}
 				w.WriteHeader(http.StatusNotFound)
 				_, _ = w.Write(content)
 				return
 			}
 		}
 	}
-	h.serveDefault404(w)
-}
-
-func (h *Handler) serveDefault404(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusNotFound)
-	_, _ = w.Write(default404HTML)
+	h.serveDefault404(w, r)
 }
 
 func (h *Handler) servePlaceholder(w http.ResponseWriter) {
@@ -2,21 +2,27 @@ package serve
 
 import (
 	"compress/gzip"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/andybalholm/brotli"
 
 	"tspages/internal/auth"
+	"tspages/internal/httplog"
+	"tspages/internal/problem"
 	"tspages/internal/storage"
 )
 
-func setupSite(t *testing.T, store *storage.Store, site, id string, files map[string]string) {
+func setupSite(t testing.TB, store *storage.Store, site, id string, files map[string]string) {
 	t.Helper()
 	dir, err := store.CreateDeployment(site, id)
 	if err != nil {
@@ -261,6 +267,91 @@ func TestHandler_ETag_ChangesOnNewDeployment(t *testing.T) {
 	}
 }
 
+func TestHandler_LastModified_FromActivation(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"style.css": "body{}",
+	})
+	// Archives carry arbitrary mtimes; they must not leak into Last-Modified.
+	old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(store.ContentDir("docs", "aaa11111"), "style.css"), old, old)
+	activated, err := store.ActivatedAt("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	req.SetPathValue("path", "style.css")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	lastModified := rec.Header().Get("Last-Modified")
+	if want := activated.UTC().Format(http.TimeFormat); lastModified != want {
+		t.Errorf("Last-Modified = %q, want activation time %q", lastModified, want)
+	}
+}
+
+func TestHandler_ConditionalByTime(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"style.css": "body{}",
+	})
+	activated, err := store.ActivatedAt("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	tests := []struct {
+		name   string
+		header string
+		value  time.Time
+		want   int
+	}{
+		{"modified since activation", "If-Modified-Since", activated, http.StatusNotModified},
+		{"modified before activation", "If-Modified-Since", activated.Add(-time.Hour), http.StatusOK},
+		{"unmodified since activation", "If-Unmodified-Since", activated, http.StatusOK},
+		{"unmodified before activation", "If-Unmodified-Since", activated.Add(-time.Hour), http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/style.css", nil)
+			req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+			req.SetPathValue("path", "style.css")
+			req.Header.Set(tt.header, tt.value.UTC().Format(http.TimeFormat))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_LastModified_PermanentDeployment(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"style.css": "body{}",
+	})
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.WriteManifest("docs", "aaa11111", storage.Manifest{Site: "docs", ID: "aaa11111", CreatedAt: created})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/__deployments/aaa11111/style.css", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if got, want := rec.Header().Get("Last-Modified"), created.Format(http.TimeFormat); got != want {
+		t.Errorf("Last-Modified = %q, want %q", got, want)
+	}
+}
+
 func TestHandler_404_Custom(t *testing.T) {
 	store := storage.New(t.TempDir())
 	setupSite(t, store, "docs", "aaa11111", map[string]string{
@@ -305,8 +396,36 @@ func TestHandler_404_Default(t *testing.T) {
 	if !strings.Contains(body, "404") {
 		t.Error("default 404 should contain '404'")
 	}
-	if !strings.Contains(body, "doesn't exist") {
-		t.Error("default 404 should explain page doesn't exist")
+	if !strings.Contains(body, "There is no page at this address.") {
+		t.Error("default 404 should explain there is no page")
+	}
+}
+
+func TestHandler_404_DefaultJSON(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>Docs</h1>",
+	})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/nope", nil)
+	req.Header.Set("Accept", "application/json")
+	req = req.WithContext(httplog.WithRequestID(req.Context(), "req-1"))
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	req.SetPathValue("path", "nope")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("got %d %s, want a 404 problem", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got problem.Details
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != problem.NotFound || got.RequestID != "req-1" || len(got.Actions) == 0 {
+		t.Errorf("problem = %+v", got)
 	}
 }
 
@@ -335,7 +454,7 @@ func TestHandler_NoDeployment_Placeholder(t *testing.T) {
 	if !strings.Contains(body, "no deployment yet") {
 		t.Error("placeholder should explain there is no deployment")
 	}
-	if !strings.Contains(body, "/deploy/mysite") {
+	if !strings.Contains(body, "/api/v1/deploy/mysite") {
 		t.Error("placeholder should show the deploy command")
 	}
 }
@@ -646,6 +765,52 @@ func TestHandler_CustomHeaders_FromDefaults(t *testing.T) {
 	}
 }
 
+func TestHandler_SecurityHeaders(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>Docs</h1>",
+	})
+	get := func(cfg storage.SiteConfig) http.Header {
+		t.Helper()
+		h := NewHandler(store, "docs", "", cfg)
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+		req.SetPathValue("path", "index.html")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Header()
+	}
+
+	strict := get(storage.SiteConfig{SecurityHeaders: storage.SecurityHeadersStrict})
+	if got := strict.Get("Strict-Transport-Security"); got != "max-age=63072000; includeSubDomains" {
+		t.Errorf("strict HSTS = %q", got)
+	}
+	if got := strict.Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("strict Referrer-Policy = %q", got)
+	}
+	if got := strict.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("strict X-Content-Type-Options = %q", got)
+	}
+
+	// Headers the config sets win over the preset's.
+	relaxed := get(storage.SiteConfig{
+		SecurityHeaders: storage.SecurityHeadersRelaxed,
+		Headers:         map[string]map[string]string{"/*": {"Referrer-Policy": "same-origin"}},
+	})
+	if got := relaxed.Get("Referrer-Policy"); got != "same-origin" {
+		t.Errorf("relaxed Referrer-Policy = %q, want the config's same-origin", got)
+	}
+	if got := relaxed.Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("relaxed X-Frame-Options = %q", got)
+	}
+
+	for _, preset := range []string{"", storage.SecurityHeadersOff} {
+		if got := get(storage.SiteConfig{SecurityHeaders: preset}).Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("%q: HSTS = %q, want none", preset, got)
+		}
+	}
+}
+
 func TestMatchHeaderPath(t *testing.T) {
 	tests := []struct {
 		pattern string
@@ -795,6 +960,40 @@ func TestHandler_AnalyticsEnabled_FromDefaults(t *testing.T) {
 	}
 }
 
+func TestHandler_AnalyticsWeight(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "hi"})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{AnalyticsSampleRate: 3})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Pages are always recorded, by path or content type.
+	for _, page := range [][2]string{{"/", ""}, {"/docs/intro", ""}, {"/about.html", ""}, {"/feed", "text/html; charset=utf-8"}} {
+		if w := h.AnalyticsWeight(page[0], page[1]); w != 1 {
+			t.Errorf("AnalyticsWeight(%q, %q) = %d, want 1", page[0], page[1], w)
+		}
+	}
+	// One in three assets is recorded, standing for three.
+	var weights []int
+	for range 6 {
+		weights = append(weights, h.AnalyticsWeight("/app.js", "text/javascript; charset=utf-8"))
+	}
+	if !slices.Equal(weights, []int{3, 0, 0, 3, 0, 0}) {
+		t.Errorf("asset weights = %v, want [3 0 0 3 0 0]", weights)
+	}
+}
+
+func TestHandler_AnalyticsWeight_NotSampled(t *testing.T) {
+	h := NewHandler(storage.New(t.TempDir()), "docs", "", storage.SiteConfig{})
+	if w := h.AnalyticsWeight("/app.js", "text/javascript"); w != 1 {
+		t.Errorf("AnalyticsWeight() = %d, want 1 without a sample rate", w)
+	}
+}
+
 func TestHandler_AnalyticsEnabled_NoDeployment(t *testing.T) {
 	store := storage.New(t.TempDir())
 	// Site exists but has no deployment — serve handler shows placeholder.
@@ -1661,6 +1860,126 @@ func TestHandler_DirectoryListing_ParentLink(t *testing.T) {
 	}
 }
 
+func TestHandler_DirectoryListing_Template(t *testing.T) {
+	store := storage.New(t.TempDir())
+	dir, _ := store.CreateDeployment("files", "aaa11111")
+	contentDir := filepath.Join(dir, "content")
+	os.MkdirAll(filepath.Join(contentDir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(contentDir, "a", "b", "file.txt"), []byte("hi"), 0644)
+	os.WriteFile(filepath.Join(contentDir, "_listing.html"), []byte(
+		`{{range .Breadcrumbs}}[{{.Name}} {{.Href}}]{{end}}{{range .Entries}}({{.Name}} {{.Bytes}} {{.Size}}){{end}}`), 0644)
+	store.MarkComplete("files", "aaa11111")
+	store.ActivateDeployment("files", "aaa11111")
+
+	dl := true
+	store.WriteSiteConfig("files", "aaa11111", storage.SiteConfig{DirectoryListing: &dl})
+
+	h := NewHandler(store, "files", "", storage.SiteConfig{})
+	get := func(target, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req = withCaps(req, []auth.Cap{{Access: "view"}})
+		req.SetPathValue("path", path)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/a/b/", "a/b")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if want := "[files /][a /a/][b /a/b/](file.txt 2 2 B)"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+
+	// The template is neither listed nor served.
+	if rec := get("/", ""); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "_listing") {
+		t.Errorf("root listing: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("/_listing", "_listing"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /_listing status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandler_DirectoryListing_TemplateError(t *testing.T) {
+	store := storage.New(t.TempDir())
+	dir, _ := store.CreateDeployment("files", "aaa11111")
+	contentDir := filepath.Join(dir, "content")
+	os.MkdirAll(filepath.Join(contentDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(contentDir, "docs", "file.txt"), []byte("hi"), 0644)
+	os.WriteFile(filepath.Join(contentDir, "_listing.html"), []byte(`{{.Missing}}`), 0644)
+	store.MarkComplete("files", "aaa11111")
+	store.ActivateDeployment("files", "aaa11111")
+
+	dl := true
+	store.WriteSiteConfig("files", "aaa11111", storage.SiteConfig{DirectoryListing: &dl})
+
+	h := NewHandler(store, "files", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/docs/", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "docs")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if body := rec.Body.String(); !strings.Contains(body, "Index of") || !strings.Contains(body, "file.txt") {
+		t.Errorf("a failing template should fall back to the built-in listing, got %q", body)
+	}
+}
+
+func TestHandler_DirectoryListing_JSON(t *testing.T) {
+	store := storage.New(t.TempDir())
+	dir, _ := store.CreateDeployment("files", "aaa11111")
+	contentDir := filepath.Join(dir, "content", "docs")
+	os.MkdirAll(filepath.Join(contentDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(contentDir, "readme.txt"), []byte("hello"), 0644)
+	store.MarkComplete("files", "aaa11111")
+	store.ActivateDeployment("files", "aaa11111")
+
+	dl := true
+	store.WriteSiteConfig("files", "aaa11111", storage.SiteConfig{DirectoryListing: &dl})
+
+	h := NewHandler(store, "files", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/docs/?format=json", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "docs")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var listing struct {
+		Path        string `json:"path"`
+		Parent      string `json:"parent"`
+		Breadcrumbs []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"breadcrumbs"`
+		Entries []struct {
+			Name    string    `json:"name"`
+			Href    string    `json:"href"`
+			IsDir   bool      `json:"is_dir"`
+			Size    int64     `json:"size"`
+			ModTime time.Time `json:"mod_time"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("decode: %v\n%s", err, rec.Body.String())
+	}
+	if listing.Path != "/docs/" || listing.Parent != "/" || len(listing.Breadcrumbs) != 2 || listing.Breadcrumbs[1].Href != "/docs/" {
+		t.Errorf("listing = %+v", listing)
+	}
+	if len(listing.Entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", listing.Entries)
+	}
+	if e := listing.Entries[0]; e.Name != "sub" || !e.IsDir {
+		t.Errorf("entries[0] = %+v, want directory sub first", e)
+	}
+	if e := listing.Entries[1]; e.Name != "readme.txt" || e.Href != "/docs/readme.txt" || e.Size != 5 || e.ModTime.IsZero() {
+		t.Errorf("entries[1] = %+v", e)
+	}
+}
+
 // --- Trailing Slash ---
 
 func TestCheckTrailingSlash(t *testing.T) {
@@ -2069,6 +2388,61 @@ func TestCompressWriter_NonOK_PassesThrough(t *testing.T) {
 	}
 }
 
+// setCompression replaces the compression config for the duration of t.
+func setCompression(t *testing.T, c CompressionConfig) {
+	t.Helper()
+	prev := compression
+	SetCompression(c)
+	t.Cleanup(func() { SetCompression(prev) })
+}
+
+// writeCompressible writes size bytes of CSS through a compressWriter and
+// returns the response.
+func writeCompressible(t *testing.T, size int) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: rec, encoding: "gzip"}
+	cw.Header().Set("Content-Type", "text/css")
+	cw.Header().Set("Content-Length", strconv.Itoa(size))
+	cw.Write([]byte(strings.Repeat("a", size)))
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return rec
+}
+
+func TestCompressWriter_MaxBytes(t *testing.T) {
+	setCompression(t, CompressionConfig{GzipLevel: 6, BrotliLevel: 4, MaxBytes: 1000, Workers: 1})
+
+	if rec := writeCompressible(t, 1000); rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("file at the size ceiling should be compressed")
+	}
+	rec := writeCompressible(t, 1001)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Error("file over the size ceiling should not be compressed")
+	}
+	if rec.Body.Len() != 1001 {
+		t.Errorf("body length = %d, want 1001", rec.Body.Len())
+	}
+}
+
+func TestCompressWriter_BusyWorkers(t *testing.T) {
+	setCompression(t, CompressionConfig{GzipLevel: 6, BrotliLevel: 4, Workers: 1})
+
+	compressSlots <- struct{}{}
+	if rec := writeCompressible(t, 1000); rec.Header().Get("Content-Encoding") != "" {
+		t.Error("response should be sent uncompressed while all workers are busy")
+	}
+	<-compressSlots
+
+	if rec := writeCompressible(t, 1000); rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("response should be compressed with a free worker")
+	}
+	if n := len(compressSlots); n != 0 {
+		t.Errorf("%d workers held after Close, want 0", n)
+	}
+}
+
 func TestHandler_Gzip_RefusedWithQZero(t *testing.T) {
 	store := storage.New(t.TempDir())
 	body := strings.Repeat("hello world ", 100)
@@ -2094,23 +2468,144 @@ func TestHandler_Gzip_RefusedWithQZero(t *testing.T) {
 	}
 }
 
-func TestFormatBytes(t *testing.T) {
+func permanentRequest(path string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	req.SetPathValue("path", strings.TrimPrefix(path, "/"))
+	return req
+}
+
+func TestHandler_PermanentDeployment_ServesInactive(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>v1</h1>",
+		"style.css":  "body{}",
+	})
+	setupSite(t, store, "docs", "bbb22222", map[string]string{
+		"index.html": "<h1>v2</h1>",
+	})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if rec.Body.String() != "<h1>v1</h1>" {
+		t.Errorf("body = %q, want old deployment", rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); !strings.Contains(etag, "aaa11111") {
+		t.Errorf("ETag = %q, want permanent deployment ID", etag)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/style.css"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "body{}" {
+		t.Errorf("asset: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	// The live site is unaffected.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/"))
+	if rec.Body.String() != "<h1>v2</h1>" {
+		t.Errorf("live body = %q, want active deployment", rec.Body.String())
+	}
+}
+
+func TestHandler_PermanentDeployment_NotFound(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>v1</h1>",
+	})
+	dir, err := store.CreateDeployment("docs", "fff99999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "content"), 0755)
+	os.WriteFile(filepath.Join(dir, "content", "index.html"), []byte("partial"), 0644)
+	store.MarkFailed("docs", "fff99999", "extract failed")
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	for _, p := range []string{"/__deployments/zzz00000/", "/__deployments/fff99999/", "/__deployments/../"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, permanentRequest(p))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", p, rec.Code)
+		}
+	}
+}
+
+func TestHandler_PermanentDeployment_AddsTrailingSlash(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>v1</h1>",
+	})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111"))
+
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, want 301", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/__deployments/aaa11111/" {
+		t.Errorf("Location = %q", loc)
+	}
+}
+
+func TestHandler_PermanentDeployment_RedirectsStayPermanent(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>v1</h1>",
+		"about.html": "<h1>About</h1>",
+	})
+	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{
+		Redirects: []storage.RedirectRule{
+			{From: "/old", To: "/about", Status: 302},
+			{From: "/ext", To: "https://example.com/"},
+		},
+	})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
 	tests := []struct {
-		input int64
-		want  string
+		path, want string
 	}{
-		{0, "0 B"},
-		{1, "1 B"},
-		{1023, "1023 B"},
-		{1024, "1.0 KB"},
-		{1536, "1.5 KB"},
-		{1024 * 1024, "1.0 MB"},
-		{1024 * 1024 * 1024, "1.0 GB"},
-		{1024*1024*1024 + 512*1024*1024, "1.5 GB"},
+		{"/__deployments/aaa11111/old", "/__deployments/aaa11111/about"},
+		{"/__deployments/aaa11111/about.html", "/__deployments/aaa11111/about"},
+		{"/__deployments/aaa11111/ext", "https://example.com/"},
 	}
 	for _, tt := range tests {
-		if got := formatBytes(tt.input); got != tt.want {
-			t.Errorf("formatBytes(%d) = %q, want %q", tt.input, got, tt.want)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, permanentRequest(tt.path))
+		if loc := rec.Header().Get("Location"); loc != tt.want {
+			t.Errorf("%s: Location = %q, want %q", tt.path, loc, tt.want)
 		}
 	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/about"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>About</h1>" {
+		t.Errorf("clean URL: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandler_PermanentDeployment_Forbidden(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>v1</h1>",
+	})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	req := httptest.NewRequest("GET", "/__deployments/aaa11111/", nil)
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"other"}}})
+	req.SetPathValue("path", "__deployments/aaa11111/")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
 }
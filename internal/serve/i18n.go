@@ -0,0 +1,152 @@
+package serve
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tspages/internal/storage"
+)
+
+// maxLanguageTags caps how many Accept-Language entries are considered, so a
+// long header can't turn one request into dozens of filesystem lookups.
+const maxLanguageTags = 8
+
+// parseAcceptLanguage returns the language tags from an Accept-Language
+// header, lowercased and ordered by preference. Each region-qualified tag is
+// followed by its shorter prefixes ("de-at" yields "de-at", "de"). Wildcards,
+// malformed tags and tags with q=0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var prefs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" || !storage.ValidLanguageTag(tag) {
+			continue
+		}
+		q := 1.0
+		if _, qval, ok := strings.Cut(params, "q="); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(qval), 64)
+			if err != nil {
+				continue
+			}
+			q = v
+		}
+		if q <= 0 {
+			continue
+		}
+		prefs = append(prefs, weighted{tag, q})
+		if len(prefs) == maxLanguageTags {
+			break
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	seen := make(map[string]bool, len(prefs))
+	var tags []string
+	for _, p := range prefs {
+		for tag := p.tag; tag != ""; {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+			i := strings.LastIndexByte(tag, '-')
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return tags
+}
+
+// isDocumentPath reports whether filePath refers to an HTML document (or an
+// extensionless clean URL / directory) and is therefore eligible for
+// language negotiation. Assets like CSS and images are never localized.
+func isDocumentPath(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case "", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// localizedCandidates returns the content-relative paths that may hold the
+// lang variant of filePath, in lookup order: a language suffix before the
+// extension ("about.de.html"), a language directory ("de/about.html"), and
+// for extensionless paths, a localized directory index ("guide/index.de.html").
+func localizedCandidates(filePath, lang, indexPage string) []string {
+	ext := filepath.Ext(filePath)
+	stem := strings.TrimSuffix(filePath, ext)
+	candidates := []string{
+		stem + "." + lang + ext,
+		filepath.Join(lang, filePath),
+	}
+	if ext == "" {
+		indexExt := filepath.Ext(indexPage)
+		indexStem := strings.TrimSuffix(indexPage, indexExt)
+		candidates = append(candidates, filepath.Join(filePath, indexStem+"."+lang+indexExt))
+	}
+	return candidates
+}
+
+// servableUnderRoot reports whether filePath would resolve to content under
+// resolvedRoot: either a file, a directory containing indexPage, or (with
+// clean URLs) a sibling filePath + ".html".
+func servableUnderRoot(resolvedRoot, filePath, indexPage string, cleanURLs bool) bool {
+	fullPath := filepath.Join(resolvedRoot, filePath)
+	if resolved, err := filepath.EvalSymlinks(fullPath); err == nil && isUnderRoot(resolved, resolvedRoot) {
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return false
+		}
+		if !info.IsDir() {
+			return true
+		}
+		resolvedIndex, err := filepath.EvalSymlinks(filepath.Join(fullPath, indexPage))
+		return err == nil && isUnderRoot(resolvedIndex, resolvedRoot)
+	}
+	if cleanURLs {
+		resolvedHTML, err := filepath.EvalSymlinks(fullPath + ".html")
+		return err == nil && isUnderRoot(resolvedHTML, resolvedRoot)
+	}
+	return false
+}
+
+// negotiateLanguage picks the best localized variant of filePath for the
+// request's Accept-Language header and returns the path to serve. Unsuffixed
+// files are treated as the default language: when the client's preference
+// reaches defaultLang (or nothing matches), filePath is returned unchanged.
+// Candidates that allowed rejects, such as ones the visitor may not view,
+// are skipped. Vary and Content-Language are set on w for every negotiable
+// document.
+func negotiateLanguage(w http.ResponseWriter, r *http.Request, resolvedRoot, filePath, indexPage string, cleanURLs bool, defaultLang string, allowed func(candidate string) bool) string {
+	if !isDocumentPath(filePath) {
+		return filePath
+	}
+	addVary(w.Header(), "Accept-Language")
+
+	for _, lang := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if strings.EqualFold(lang, defaultLang) {
+			break
+		}
+		for _, candidate := range localizedCandidates(filePath, lang, indexPage) {
+			if allowed(candidate) && servableUnderRoot(resolvedRoot, candidate, indexPage, cleanURLs) {
+				w.Header().Set("Content-Language", lang)
+				return candidate
+			}
+		}
+	}
+
+	if defaultLang != "" {
+		w.Header().Set("Content-Language", defaultLang)
+	}
+	return filePath
+}
@@ -0,0 +1,205 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"de", []string{"de"}},
+		{"de-AT, en;q=0.5", []string{"de-at", "de", "en"}},
+		{"en;q=0.3, fr;q=0.9, de", []string{"de", "fr", "en"}},
+		{"fr;q=0, en", []string{"en"}},
+		{"*, en", []string{"en"}},
+		{"../etc, en", []string{"en"}},
+		{"de-CH, de-AT", []string{"de-ch", "de", "de-at"}},
+		{"internal, docs, en", []string{"en"}},
+	}
+	for _, tt := range tests {
+		if got := parseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func i18nRequest(path, acceptLanguage string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req = withCaps(req, []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", strings.TrimPrefix(path, "/"))
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	return req
+}
+
+func TestHandler_I18n_SuffixVariant(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"about.html":    "english",
+		"about.de.html": "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/about", "de-DE,de;q=0.9,en;q=0.5"))
+
+	if rec.Body.String() != "deutsch" {
+		t.Errorf("body = %q, want deutsch", rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Language"); got != "de" {
+		t.Errorf("Content-Language = %q, want de", got)
+	}
+	if vary := strings.Join(rec.Header().Values("Vary"), ", "); !strings.Contains(vary, "Accept-Language") {
+		t.Errorf("Vary = %q, want Accept-Language", vary)
+	}
+}
+
+func TestHandler_I18n_DirectoryVariant(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":    "english",
+		"de/index.html": "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/", "de"))
+
+	if rec.Body.String() != "deutsch" {
+		t.Errorf("body = %q, want deutsch", rec.Body.String())
+	}
+}
+
+func TestHandler_I18n_FallsBackToDefault(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"about.html":    "english",
+		"about.de.html": "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n, DefaultLanguage: "en"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/about", "fr"))
+
+	if rec.Body.String() != "english" {
+		t.Errorf("body = %q, want english", rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Language"); got != "en" {
+		t.Errorf("Content-Language = %q, want en", got)
+	}
+}
+
+func TestHandler_I18n_DefaultLanguageBeatsLowerPreference(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"about.html":    "english",
+		"about.de.html": "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n, DefaultLanguage: "en"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/about", "en-US, de;q=0.8"))
+
+	if rec.Body.String() != "english" {
+		t.Errorf("body = %q, want english", rec.Body.String())
+	}
+}
+
+func TestHandler_I18n_AssetsNotLocalized(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"style.css":    "body{}",
+		"style.de.css": "body{color:red}",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/style.css", "de"))
+
+	if rec.Body.String() != "body{}" {
+		t.Errorf("body = %q, want body{}", rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Language"); got != "" {
+		t.Errorf("Content-Language = %q, want empty", got)
+	}
+}
+
+func TestHandler_I18n_Disabled(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"about.html":    "english",
+		"about.de.html": "deutsch",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/about", "de"))
+
+	if rec.Body.String() != "english" {
+		t.Errorf("body = %q, want english", rec.Body.String())
+	}
+	if vary := strings.Join(rec.Header().Values("Vary"), ", "); strings.Contains(vary, "Accept-Language") {
+		t.Errorf("Vary = %q, should not include Accept-Language", vary)
+	}
+}
+
+func TestHandler_I18n_SkipsDeniedVariants(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"plan.html":          "public",
+		"internal/plan.html": "internal",
+		"de/plan.html":       "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n, Access: []storage.AccessRule{
+		{Path: "/internal/*", Access: "admin"},
+		{Path: "/de/*", Access: "admin"},
+	}})
+
+	for _, lang := range []string{"internal", "de"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, i18nRequest("/plan", lang))
+		if rec.Code != http.StatusOK || rec.Body.String() != "public" {
+			t.Errorf("Accept-Language %s: status = %d, body = %q, want public", lang, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestHandler_I18n_ShareCoversVariants(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"plan.html":    "english",
+		"de/plan.html": "deutsch",
+	})
+	sh, err := store.CreateShare("docs", storage.Share{Path: "/plan", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n})
+
+	req := withCaps(httptest.NewRequest("GET", "/__share/"+sh.Token+"/plan", nil), []auth.Cap{})
+	req.Header.Set("Accept-Language", "de")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "english" {
+		t.Errorf("body = %q, want english: the share does not cover de/plan.html", rec.Body.String())
+	}
+}
@@ -0,0 +1,75 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// ManifestPath is the reserved path on every site that lists the files of
+// the deployment a visitor is served, with their sizes and content hashes.
+const ManifestPath = "/__manifest.json"
+
+// Manifest is the JSON body served at ManifestPath.
+type Manifest struct {
+	DeploymentID string             `json:"deployment_id"`
+	Files        []storage.FileInfo `json:"files"`
+}
+
+// serveManifest serves the file index of the deployment the visitor is
+// served. Unlike the site itself, it requires view capability even on public
+// sites, and leaves out files the visitor's access rules deny and scheduled
+// files that are not published now.
+func (h *Handler) serveManifest(w http.ResponseWriter, r *http.Request) {
+	if !auth.CanView(auth.CapsFromContext(r.Context()), h.site) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	deploymentID, _, since, cfg, ok := h.resolve()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if c := h.canaryFor(r); c != nil {
+		deploymentID, since, cfg = c.id, c.since, c.cfg
+	}
+	recordServedDeployment(r, deploymentID)
+
+	files, err := h.store.ListDeploymentFiles(h.site, deploymentID)
+	if err != nil {
+		slog.Error("listing files for manifest", "site", h.site, "deployment", deploymentID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	indexPage := cfg.IndexPage
+	if indexPage == "" {
+		indexPage = "index.html"
+	}
+	now := time.Now()
+	manifest := Manifest{DeploymentID: deploymentID, Files: []storage.FileInfo{}}
+	for _, f := range files {
+		reqPath := path.Clean("/" + f.Path)
+		if _, denied := h.deniedRule(r, reqPath, indexPage, cfg.Access); denied {
+			continue
+		}
+		if unpublished(reqPath, indexPage, cfg.Schedule, now) {
+			continue
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", since, bytes.NewReader(data))
+}
@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestHandler_Manifest(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":         "<h1>Docs</h1>",
+		"app.css":            "body{}",
+		"internal/plan.html": "<h1>Plan</h1>",
+		"launch.html":        "<h1>Launch</h1>",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{
+		Access:   []storage.AccessRule{{Path: "/internal/*", Access: "admin"}},
+		Schedule: []storage.ScheduleRule{{Path: "/launch.html", VisibleFrom: time.Now().Add(time.Hour)}},
+	})
+
+	get := func(caps []auth.Cap) (*httptest.ResponseRecorder, Manifest) {
+		req := withCaps(httptest.NewRequest("GET", ManifestPath, nil), caps)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var m Manifest
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, m
+	}
+	paths := func(m Manifest) []string {
+		var ps []string
+		for _, f := range m.Files {
+			ps = append(ps, f.Path)
+		}
+		return ps
+	}
+
+	rec, m := get([]auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if m.DeploymentID != "aaa11111" {
+		t.Errorf("deployment_id = %q", m.DeploymentID)
+	}
+	if got := paths(m); len(got) != 2 || got[0] != "app.css" || got[1] != "index.html" {
+		t.Errorf("viewer files = %v, want [app.css index.html]", got)
+	}
+	if f := m.Files[0]; f.Size != 6 || len(f.Hash) != 64 {
+		t.Errorf("app.css = %+v", f)
+	}
+
+	_, m = get([]auth.Cap{{Access: "admin", Sites: []string{"docs"}}})
+	if got := paths(m); len(got) != 3 || got[2] != "internal/plan.html" {
+		t.Errorf("admin files = %v", got)
+	}
+}
+
+func TestHandler_Manifest_PublicRequiresView(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "<h1>Docs</h1>"})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	h.SetPublic(true)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", ManifestPath, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("anonymous status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package serve
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// OfflineWorkerPath is the reserved path of the service worker that sites
+// with offline = true register on every HTML page.
+const OfflineWorkerPath = "/__tspages/sw.js"
+
+// offlineMaxBytes caps the size of the files a worker precaches, so a large
+// site does not fill its visitors' disks. Documents are precached first.
+const offlineMaxBytes = 50 << 20
+
+//go:embed templates/offline-worker.js
+var offlineWorkerTmplStr string
+
+var offlineWorkerTmpl = template.Must(template.New("offline-worker").Parse(offlineWorkerTmplStr))
+
+// offlineRegistration is injected into HTML pages of sites with offline =
+// true to install the worker for the whole site.
+const offlineRegistration = `<script>"serviceWorker"in navigator&&navigator.serviceWorker.register("` +
+	OfflineWorkerPath + `",{scope:"/"})</script>`
+
+// offlineWorker generates the service worker of deployment id for the
+// visitor of r, precaching the files listed in its file index that the
+// visitor's access rules allow and that are published now, as in the
+// manifest. Without offline = true, it returns a worker that uninstalls
+// itself, so visitors who registered one before the site turned it off do
+// not keep serving a stale copy.
+func (h *Handler) offlineWorker(r *http.Request, id string, cfg storage.SiteConfig) []byte {
+	data := struct {
+		Deployment string
+		Precache   string
+	}{Deployment: id}
+	if id != "" && cfg.Offline != nil && *cfg.Offline {
+		files, err := h.store.ListDeploymentFiles(h.site, id)
+		if err != nil {
+			slog.Warn("listing files to precache", "site", h.site, "deployment", id, "err", err)
+		}
+		indexPage := cfg.IndexPage
+		if indexPage == "" {
+			indexPage = "index.html"
+		}
+		now := time.Now()
+		visible := files[:0:0]
+		for _, f := range files {
+			reqPath := path.Clean("/" + f.Path)
+			if _, denied := h.deniedRule(r, reqPath, indexPage, cfg.Access); denied {
+				continue
+			}
+			if unpublished(reqPath, indexPage, cfg.Schedule, now) {
+				continue
+			}
+			visible = append(visible, f)
+		}
+		urls, _ := json.Marshal(precacheURLs(visible, cfg))
+		data.Precache = string(urls)
+	}
+	var buf bytes.Buffer
+	if err := offlineWorkerTmpl.Execute(&buf, data); err != nil {
+		slog.Error("generating service worker", "site", h.site, "err", err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// precacheURLs returns the URLs files are served at under cfg, documents
+// first, leaving out files once offlineMaxBytes is used up.
+func precacheURLs(files []storage.FileInfo, cfg storage.SiteConfig) []string {
+	indexPage := cfg.IndexPage
+	if indexPage == "" {
+		indexPage = "index.html"
+	}
+	cleanURLs := cfg.HTMLExtensions == nil || !*cfg.HTMLExtensions
+
+	files = slices.Clone(files)
+	slices.SortStableFunc(files, func(a, b storage.FileInfo) int {
+		switch aHTML, bHTML := isHTMLFile(a.Path), isHTMLFile(b.Path); {
+		case aHTML && !bHTML:
+			return -1
+		case bHTML && !aHTML:
+			return 1
+		}
+		return 0
+	})
+
+	urls := []string{}
+	var budget int64 = offlineMaxBytes
+	for _, f := range files {
+		if f.Size > budget {
+			continue
+		}
+		budget -= f.Size
+
+		u := "/" + f.Path
+		switch {
+		case path.Base(f.Path) == indexPage:
+			u = strings.TrimSuffix(u, indexPage)
+		case cleanURLs && (path.Ext(f.Path) == ".html" || path.Ext(f.Path) == ".htm"):
+			u = strings.TrimSuffix(u, path.Ext(f.Path))
+		}
+		// Cache the URL visitors end up at; a redirected response cannot
+		// answer a navigation.
+		if target, ok := checkTrailingSlash(u, cfg.TrailingSlash); ok {
+			u = target
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// serveOfflineWorker serves the service worker of the active deployment.
+// Browsers check it for updates on navigation, so it is always revalidated;
+// its precache list differs between visitors and changes with the
+// schedule, so the ETag covers its content.
+func (h *Handler) serveOfflineWorker(w http.ResponseWriter, r *http.Request) {
+	id, _, _, cfg, _ := h.resolve()
+	worker := h.offlineWorker(r, id, cfg)
+	if worker == nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	sum := fnv.New32a()
+	sum.Write(worker)
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"sw:%s:%08x"`, id, sum.Sum32()))
+	w.Header().Set("Service-Worker-Allowed", "/")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(worker))
+}
@@ -0,0 +1,131 @@
+package serve
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+func TestPrecacheURLs(t *testing.T) {
+	files := []storage.FileInfo{
+		{Path: "app.js", Size: 10},
+		{Path: "docs/index.html", Size: 10},
+		{Path: "guide.html", Size: 10},
+		{Path: "index.html", Size: 10},
+		{Path: "video.mp4", Size: offlineMaxBytes},
+	}
+	on := true
+	tests := []struct {
+		name string
+		cfg  storage.SiteConfig
+		want []string
+	}{
+		{"clean URLs", storage.SiteConfig{}, []string{"/docs/", "/guide", "/", "/app.js"}},
+		{"html extensions", storage.SiteConfig{HTMLExtensions: &on}, []string{"/docs/", "/guide.html", "/", "/app.js"}},
+		{"no trailing slash", storage.SiteConfig{TrailingSlash: "remove"}, []string{"/docs", "/guide", "/", "/app.js"}},
+		{"trailing slash", storage.SiteConfig{TrailingSlash: "add"}, []string{"/docs/", "/guide/", "/", "/app.js"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := precacheURLs(files, tt.cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("precacheURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_OfflineWorker(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<html><body><h1>Docs</h1></body></html>",
+		"style.css":  "body{}",
+	})
+	on := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Offline: &on})
+
+	rec := visit(h, "GET", OfflineWorkerPath, "", nil)
+	if rec.Code != 200 {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `const PRECACHE = ["/","/style.css"];`) || !strings.Contains(body, "tspages-offline-aaa11111") {
+		t.Errorf("worker = %s", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if got := rec.Header().Get("Service-Worker-Allowed"); got != "/" {
+		t.Errorf("Service-Worker-Allowed = %q", got)
+	}
+
+	rec = visit(h, "GET", "/", "", nil)
+	if !strings.Contains(rec.Body.String(), `register("`+OfflineWorkerPath+`"`) {
+		t.Errorf("page does not register the worker: %s", rec.Body.String())
+	}
+}
+
+func TestHandler_OfflineWorker_LeavesOutHiddenPaths(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":         "<h1>Docs</h1>",
+		"internal/plan.html": "<h1>Plan</h1>",
+		"launch.html":        "<h1>Launch</h1>",
+		"old.html":           "<h1>Old</h1>",
+	})
+	on := true
+	now := time.Now()
+	h := NewHandler(store, "docs", "", storage.SiteConfig{
+		Offline: &on,
+		Access:  []storage.AccessRule{{Path: "/internal/*", Access: "admin"}},
+		Schedule: []storage.ScheduleRule{
+			{Path: "/launch.html", VisibleFrom: now.Add(time.Hour)},
+			{Path: "/old.html", VisibleUntil: now.Add(-time.Hour)},
+		},
+	})
+
+	rec := visit(h, "GET", OfflineWorkerPath, "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, `const PRECACHE = ["/"];`) {
+		t.Errorf("worker = %s", body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+}
+
+func TestHandler_OfflineWorker_Disabled(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<html><body><h1>Docs</h1></body></html>",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	// Visitors who installed the worker before get one that removes itself.
+	rec := visit(h, "GET", OfflineWorkerPath, "", nil)
+	if body := rec.Body.String(); rec.Code != 200 || !strings.Contains(body, "unregister()") || strings.Contains(body, "PRECACHE") {
+		t.Errorf("status = %d, worker = %s", rec.Code, body)
+	}
+
+	rec = visit(h, "GET", "/", "", nil)
+	if strings.Contains(rec.Body.String(), "serviceWorker") {
+		t.Errorf("page registers a worker: %s", rec.Body.String())
+	}
+}
+
+func TestHandler_OfflineWorker_FollowsActivation(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "v1"})
+	on := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Offline: &on})
+	visit(h, "GET", OfflineWorkerPath, "", nil)
+
+	setupSite(t, store, "docs", "bbb22222", map[string]string{"index.html": "v2", "new.html": "new"})
+	h.InvalidateConfig()
+
+	rec := visit(h, "GET", OfflineWorkerPath, "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "tspages-offline-bbb22222") || !strings.Contains(body, `"/new"`) {
+		t.Errorf("worker after activation = %s", body)
+	}
+}
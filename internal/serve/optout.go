@@ -0,0 +1,65 @@
+package serve
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"tspages/internal/auth"
+)
+
+// OptOutPath is the reserved path on every site that records a visitor's
+// analytics opt-out, posted to by the analytics notice.
+const OptOutPath = "/__tspages/analytics/opt-out"
+
+// OptOutStore records which visitors opted out of access analytics.
+// *analytics.Recorder implements it.
+type OptOutStore interface {
+	OptedOut(login string) bool
+	SetOptOut(login string, optOut bool) error
+}
+
+// SetOptOuts enables the analytics notice and the opt-out endpoint. Without
+// a store, sites never show the notice. Call before serving requests.
+func (h *Handler) SetOptOuts(s OptOutStore) { h.optOuts = s }
+
+// serveOptOut handles POST OptOutPath with form field opt_out=true|false and
+// sends the visitor back to the page they came from.
+func (h *Handler) serveOptOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.optOuts == nil {
+		http.NotFound(w, r)
+		return
+	}
+	login := auth.RequestInfoFromContext(r.Context()).UserLogin
+	if login == "" {
+		http.Error(w, "opting out requires a Tailscale login", http.StatusForbidden)
+		return
+	}
+	optOut, err := strconv.ParseBool(r.FormValue("opt_out"))
+	if err != nil {
+		http.Error(w, "opt_out must be true or false", http.StatusBadRequest)
+		return
+	}
+	if err := h.optOuts.SetOptOut(login, optOut); err != nil {
+		slog.Error("saving analytics opt-out", "site", h.site, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, sameSiteReferer(r), http.StatusSeeOther)
+}
+
+// sameSiteReferer returns the path of the Referer if it points at this
+// site, and "/" otherwise.
+func sameSiteReferer(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || ref.Path == "" || ref.Path == OptOutPath {
+		return "/"
+	}
+	return ref.RequestURI()
+}
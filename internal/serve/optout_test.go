@@ -0,0 +1,140 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+type fakeOptOuts map[string]bool
+
+func (f fakeOptOuts) OptedOut(login string) bool { return f[login] }
+
+func (f fakeOptOuts) SetOptOut(login string, optOut bool) error {
+	f[login] = optOut
+	return nil
+}
+
+func noticeHandler(t *testing.T, defaults storage.SiteConfig) (*Handler, fakeOptOuts) {
+	t.Helper()
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<html><body><h1>Docs</h1></body></html>",
+	})
+	h := NewHandler(store, "docs", "", defaults)
+	optOuts := fakeOptOuts{}
+	h.SetOptOuts(optOuts)
+	return h, optOuts
+}
+
+func visit(h *Handler, method, path, login string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	req = withCaps(req, []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+	req = req.WithContext(auth.ContextWithRequestInfo(req.Context(), auth.RequestInfo{UserLogin: login}))
+	req.SetPathValue("path", strings.TrimPrefix(path, "/"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_AnalyticsNotice(t *testing.T) {
+	on := true
+	h, optOuts := noticeHandler(t, storage.SiteConfig{AnalyticsNotice: &on})
+
+	rec := visit(h, "GET", "/", "alice@example.com", nil)
+	body := rec.Body.String()
+	if !strings.Contains(body, "recorded for access analytics") || !strings.Contains(body, `action="`+OptOutPath+`"`) {
+		t.Fatalf("notice missing: %s", body)
+	}
+	if !strings.Contains(body, `value="true"`) {
+		t.Errorf("want opt-out button: %s", body)
+	}
+	// The notice differs between visitors, so shared caches must not keep it.
+	if cc := rec.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Cache-Control = %q, want private, no-cache", cc)
+	}
+	if etag := rec.Header().Get("ETag"); etag != "" {
+		t.Errorf("ETag = %q, want none", etag)
+	}
+
+	optOuts["alice@example.com"] = true
+	rec = visit(h, "GET", "/", "alice@example.com", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "opted out") || !strings.Contains(body, `value="false"`) {
+		t.Errorf("want opt-in button: %s", body)
+	}
+
+	// Anonymous visitors see the notice without a button.
+	if body := visit(h, "GET", "/", "", nil).Body.String(); strings.Contains(body, "<form") {
+		t.Errorf("anonymous visitor got a form: %s", body)
+	}
+}
+
+func TestHandler_AnalyticsNoticeOff(t *testing.T) {
+	on, off := true, false
+	for name, cfg := range map[string]storage.SiteConfig{
+		"not configured":     {},
+		"analytics disabled": {AnalyticsNotice: &on, Analytics: &off},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h, _ := noticeHandler(t, cfg)
+			if body := visit(h, "GET", "/", "alice@example.com", nil).Body.String(); strings.Contains(body, "<div") {
+				t.Errorf("notice shown: %s", body)
+			}
+		})
+	}
+}
+
+func TestHandler_OptOut(t *testing.T) {
+	h, optOuts := noticeHandler(t, storage.SiteConfig{})
+
+	req := url.Values{"opt_out": {"true"}}
+	rec := visit(h, "POST", OptOutPath, "alice@example.com", req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if !optOuts["alice@example.com"] {
+		t.Error("opt-out not recorded")
+	}
+
+	rec = visit(h, "POST", OptOutPath, "alice@example.com", url.Values{"opt_out": {"false"}})
+	if rec.Code != http.StatusSeeOther || optOuts["alice@example.com"] {
+		t.Errorf("opt-in not recorded: %d", rec.Code)
+	}
+
+	if rec := visit(h, "POST", OptOutPath, "", req); rec.Code != http.StatusForbidden {
+		t.Errorf("anonymous: status = %d, want 403", rec.Code)
+	}
+	if rec := visit(h, "POST", OptOutPath, "alice@example.com", url.Values{"opt_out": {"maybe"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad value: status = %d, want 400", rec.Code)
+	}
+	if rec := visit(h, "GET", OptOutPath, "alice@example.com", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want 405", rec.Code)
+	}
+}
+
+func TestSameSiteReferer(t *testing.T) {
+	tests := []struct{ referer, want string }{
+		{"", "/"},
+		{"https://docs.example.ts.net/guide/?q=1", "/guide/?q=1"},
+		{"https://evil.example.com/guide/", "/"},
+		{"https://docs.example.ts.net" + OptOutPath, "/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "https://docs.example.ts.net"+OptOutPath, nil)
+		req.Header.Set("Referer", tt.referer)
+		if got := sameSiteReferer(req); got != tt.want {
+			t.Errorf("sameSiteReferer(%q) = %q, want %q", tt.referer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package serve
+
+import "net/http"
+
+// Stage is a step of the pipeline a site's requests pass through, named
+// after one of storage.ServeStages.
+type Stage struct {
+	Name string
+	Wrap func(next http.Handler) http.Handler
+}
+
+// Pipeline composes stages around h, the first one outermost, so a request
+// passes through them in order before reaching h. enabled is asked for
+// each stage on every request, so a newly activated config applies without
+// building the pipeline again; a request skips the stages it reports as
+// disabled, straight to the next one.
+func Pipeline(h http.Handler, enabled func(stage string) bool, stages ...Stage) http.Handler {
+	for i := len(stages) - 1; i >= 0; i-- {
+		name, next := stages[i].Name, h
+		wrapped := stages[i].Wrap(next)
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if enabled(name) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	return h
+}
+
+// StageEnabled reports whether requests pass through stage with the current
+// deployment's merged config. The redirects, headers, cache, and
+// compression stages are applied by the handler itself. Safe to call from
+// other goroutines.
+func (h *Handler) StageEnabled(stage string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cachedCfg.StageEnabled(stage)
+}
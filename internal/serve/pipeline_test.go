@@ -0,0 +1,132 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// tracingStage returns a stage that appends its name to trace on the way
+// in and out of the request.
+func tracingStage(name string, trace *[]string) Stage {
+	return Stage{Name: name, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+			*trace = append(*trace, "/"+name)
+		})
+	}}
+}
+
+func TestPipeline_Order(t *testing.T) {
+	var trace []string
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+	})
+	var stages []Stage
+	for _, name := range storage.ServeStages {
+		stages = append(stages, tracingStage(name, &trace))
+	}
+	cfg := storage.SiteConfig{}
+	Pipeline(final, cfg.StageEnabled, stages...).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{
+		"auth", "redirects", "headers", "cache", "compression", "analytics", "handler",
+		"/analytics", "/compression", "/cache", "/headers", "/redirects", "/auth",
+	}
+	if !slices.Equal(trace, want) {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+}
+
+func TestPipeline_DisabledStages(t *testing.T) {
+	var trace []string
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+	})
+	cfg := storage.SiteConfig{DisabledStages: []string{storage.StageAnalytics, storage.StageCache}}
+	p := Pipeline(final, func(stage string) bool { return cfg.StageEnabled(stage) },
+		tracingStage(storage.StageAuth, &trace),
+		tracingStage(storage.StageCache, &trace),
+		tracingStage(storage.StageAnalytics, &trace),
+	)
+
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if want := []string{"auth", "handler", "/auth"}; !slices.Equal(trace, want) {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+
+	// Stages are looked up per request, so a new config applies at once.
+	trace = nil
+	cfg = storage.SiteConfig{}
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if want := []string{"auth", "cache", "analytics", "handler", "/analytics", "/cache", "/auth"}; !slices.Equal(trace, want) {
+		t.Errorf("after re-enabling, trace = %q, want %q", trace, want)
+	}
+}
+
+func TestPipeline_StageShortCircuits(t *testing.T) {
+	reached := false
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true })
+	deny := Stage{Name: storage.StageAuth, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}}
+	rec := httptest.NewRecorder()
+	Pipeline(final, storage.SiteConfig{}.StageEnabled, deny).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusForbidden || reached {
+		t.Errorf("status = %d, reached = %v; want 403 before the handler", rec.Code, reached)
+	}
+}
+
+func TestHandler_DisabledStages(t *testing.T) {
+	content := strings.Repeat("<p>Hello world</p>\n", 30)
+	cfg := storage.SiteConfig{
+		Redirects: []storage.RedirectRule{{From: "/old", To: "/", Status: http.StatusFound}},
+		Headers:   map[string]map[string]string{"/*": {"X-Custom": "yes"}},
+	}
+	serveStages := func(disabled []string, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		store := storage.New(t.TempDir())
+		setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": content, "old": content})
+		site := cfg
+		site.DisabledStages = disabled
+		h := NewHandler(store, "docs", "", site)
+		req := withCaps(httptest.NewRequest("GET", path, nil), []auth.Cap{{Access: "view", Sites: []string{"docs"}}})
+		req.SetPathValue("path", strings.TrimPrefix(path, "/"))
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serveStages(nil, "/")
+	if rec.Header().Get("X-Custom") != "yes" || rec.Header().Get("ETag") == "" ||
+		rec.Header().Get("Cache-Control") == "" || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("all stages: headers = %v", rec.Header())
+	}
+	if rec := serveStages(nil, "/old"); rec.Code != http.StatusFound {
+		t.Fatalf("all stages: /old status = %d, want 302", rec.Code)
+	}
+
+	if rec := serveStages([]string{storage.StageRedirects}, "/old"); rec.Code != http.StatusOK {
+		t.Errorf("without redirects: /old status = %d, want 200", rec.Code)
+	}
+	if rec := serveStages([]string{storage.StageHeaders}, "/"); rec.Header().Get("X-Custom") != "" {
+		t.Error("without headers: X-Custom was sent")
+	}
+	rec = serveStages([]string{storage.StageCache}, "/")
+	if rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("without cache: ETag = %q, Cache-Control = %q", rec.Header().Get("ETag"), rec.Header().Get("Cache-Control"))
+	}
+	rec = serveStages([]string{storage.StageCompression}, "/")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != content {
+		t.Errorf("without compression: Content-Encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,113 @@
+package serve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"tspages/internal/storage"
+)
+
+// Precompress writes .br and .gz siblings for compressible files in dir, so
+// serveFileCompressed finds a precompressed variant instead of compressing
+// on every request. level is used for brotli and capped at 9 for gzip.
+// Files below compressMinBytes, files that already have a sibling, and
+// variants that would not be smaller than the original are skipped. It
+// returns the number of variants written.
+func Precompress(dir string, level int) (int, error) {
+	gzLevel := min(level, gzip.BestCompression)
+	var written int
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".br" || ext == ".gz" || !isCompressible(mime.TypeByExtension(ext)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < compressMinBytes {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		variants := []struct {
+			ext string
+			enc func(io.Writer) (io.WriteCloser, error)
+		}{
+			{".br", func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriterLevel(w, level), nil }},
+			{".gz", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzLevel) }},
+		}
+		for _, v := range variants {
+			if _, err := os.Lstat(path + v.ext); err == nil {
+				continue
+			}
+			var buf bytes.Buffer
+			enc, err := v.enc(&buf)
+			if err != nil {
+				return err
+			}
+			if _, err := enc.Write(data); err != nil {
+				return err
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+			if buf.Len() >= len(data) {
+				continue
+			}
+			if err := os.WriteFile(path+v.ext, buf.Bytes(), 0644); err != nil {
+				// A truncated variant would be served as-is; drop it.
+				os.Remove(path + v.ext)
+				return err
+			}
+			// Match the original's modification time so Last-Modified does
+			// not change with the encoding.
+			os.Chtimes(path+v.ext, info.ModTime(), info.ModTime())
+			written++
+		}
+		return nil
+	})
+	return written, err
+}
+
+// RecordCompressedSizes records the precompressed variants of files in
+// dir, as written by Precompress: their sizes and hashes as Variants, and
+// the size of the smallest as CompressedSize.
+func RecordCompressedSizes(dir string, files []storage.FileInfo) {
+	for i := range files {
+		full := filepath.Join(dir, filepath.FromSlash(files[i].Path))
+		files[i].CompressedSize = 0
+		files[i].Variants = nil
+		for _, ext := range []string{".br", ".gz"} {
+			info, err := os.Lstat(full + ext)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			size, hash, err := storage.HashFile(full + ext)
+			if err != nil {
+				continue
+			}
+			if files[i].Variants == nil {
+				files[i].Variants = make(map[string]storage.FileVariant, 2)
+			}
+			files[i].Variants[ext] = storage.FileVariant{Size: size, Hash: hash}
+			if files[i].CompressedSize == 0 || size < files[i].CompressedSize {
+				files[i].CompressedSize = size
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package serve
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"tspages/internal/storage"
+)
+
+func TestPrecompress(t *testing.T) {
+	dir := t.TempDir()
+	css := strings.Repeat("body { color: red; }\n", 50)
+	files := map[string]string{
+		"style.css":       css,
+		"small.js":        "let a = 1;",
+		"logo.png":        strings.Repeat("x", 1024),
+		"app.js":          strings.Repeat("console.log(1);\n", 50),
+		"app.js.br":       "uploaded",
+		"docs/index.html": strings.Repeat("<p>hello</p>\n", 50),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := Precompress(dir, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// style.css and docs/index.html get both variants, app.js only .gz.
+	if n != 5 {
+		t.Errorf("wrote %d variants, want 5", n)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "style.css.br"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(brotli.NewReader(f))
+	if err != nil || string(got) != css {
+		t.Errorf("style.css.br decodes to %d bytes (err %v), want original", len(got), err)
+	}
+
+	g, err := os.Open(filepath.Join(dir, "docs", "index.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	zr, err := gzip.NewReader(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != files["docs/index.html"] {
+		t.Error("index.html.gz does not decode to the original")
+	}
+
+	for _, name := range []string{"small.js.br", "logo.png.gz", "app.js.br.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be written", name)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "app.js.br")); string(data) != "uploaded" {
+		t.Error("uploaded variant should not be overwritten")
+	}
+}
+
+func TestRecordCompressedSizes(t *testing.T) {
+	dir := t.TempDir()
+	css := strings.Repeat("body { color: red; }\n", 50)
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte(css), 0644)
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte(strings.Repeat("x", 1024)), 0644)
+	if _, err := Precompress(dir, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []storage.FileInfo{{Path: "style.css", Size: int64(len(css))}, {Path: "logo.png", Size: 1024}}
+	RecordCompressedSizes(dir, files)
+	br, _ := os.Stat(filepath.Join(dir, "style.css.br"))
+	gz, _ := os.Stat(filepath.Join(dir, "style.css.gz"))
+	if want := min(br.Size(), gz.Size()); files[0].CompressedSize != want {
+		t.Errorf("style.css compressed size = %d, want %d", files[0].CompressedSize, want)
+	}
+	if files[1].CompressedSize != 0 || files[1].Variants != nil {
+		t.Errorf("logo.png compressed size = %d, variants = %v, want none", files[1].CompressedSize, files[1].Variants)
+	}
+	if v := files[0].Variants[".br"]; v.Size != br.Size() || len(v.Hash) != 64 {
+		t.Errorf("style.css.br variant = %+v", v)
+	}
+	if v := files[0].Variants[".gz"]; v.Size != gz.Size() || v.Hash == files[0].Variants[".br"].Hash {
+		t.Errorf("style.css.gz variant = %+v", v)
+	}
+}
+
+func TestPrecompress_TamperedVariant(t *testing.T) {
+	store := storage.New(t.TempDir())
+	store.CreateDeployment("docs", "aaa11111")
+	dir := store.ContentDir("docs", "aaa11111")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte(strings.Repeat("body { color: red; }\n", 50)), 0644)
+	files, err := storage.IndexDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Precompress(dir, 9); err != nil {
+		t.Fatal(err)
+	}
+	RecordCompressedSizes(dir, files)
+	store.WriteFileIndex("docs", "aaa11111", files)
+
+	if problems, err := store.CheckContent("docs", "aaa11111", 10); err != nil || len(problems) != 0 {
+		t.Fatalf("untouched deployment: %q, %v", problems, err)
+	}
+
+	// Rewrite the generated variant with other content of the same size.
+	br := filepath.Join(dir, "style.css.br")
+	data, _ := os.ReadFile(br)
+	os.WriteFile(br, []byte(strings.Repeat("x", len(data))), 0644)
+	problems, err := store.CheckContent("docs", "aaa11111", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "style.css.br: content does not match its hash"; len(problems) != 1 || problems[0] != want {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
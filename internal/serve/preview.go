@@ -0,0 +1,131 @@
+package serve
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"strings"
+
+	"tspages/internal/storage"
+)
+
+// metaTag is a <meta> tag added to the head of HTML pages. Open Graph
+// tags are keyed by property, Twitter card tags by name.
+type metaTag struct {
+	attr, key, content string
+}
+
+// previewTags returns the social preview meta tags of the page requested
+// by r under the site's social_previews rules, or nil if no rule matches.
+// base is the prefix r was re-rooted from, which og:url keeps so it names
+// the page the visitor opened rather than the live deployment's.
+func previewTags(r *http.Request, base string, rules []storage.SocialPreview) []metaTag {
+	var preview storage.SocialPreview
+	matched := false
+	for _, rule := range rules {
+		if !matchHeaderPath(rule.Path, r.URL.Path) {
+			continue
+		}
+		matched = true
+		for _, f := range []struct {
+			dst *string
+			src string
+		}{
+			{&preview.Title, rule.Title},
+			{&preview.Description, rule.Description},
+			{&preview.Image, rule.Image},
+			{&preview.Type, rule.Type},
+		} {
+			if f.src != "" {
+				*f.dst = f.src
+			}
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	origin := scheme + "://" + r.Host
+	if preview.Type == "" {
+		preview.Type = "website"
+	}
+	if strings.HasPrefix(preview.Image, "/") {
+		preview.Image = origin + preview.Image
+	}
+	card := "summary"
+	if preview.Image != "" {
+		card = "summary_large_image"
+	}
+
+	tags := []metaTag{
+		{"property", "og:type", preview.Type},
+		{"property", "og:url", origin + base + r.URL.EscapedPath()},
+		{"property", "og:title", preview.Title},
+		{"property", "og:description", preview.Description},
+		{"property", "og:image", preview.Image},
+		{"name", "twitter:card", card},
+		{"name", "twitter:title", preview.Title},
+		{"name", "twitter:description", preview.Description},
+		{"name", "twitter:image", preview.Image},
+	}
+	set := tags[:0]
+	for _, t := range tags {
+		if t.content != "" {
+			set = append(set, t)
+		}
+	}
+	return set
+}
+
+// injectMeta inserts the tags the page does not have yet right after its
+// opening <head> tag, or before its <body> tag if it has no head, or at the
+// start of the document if it has neither.
+func injectMeta(page []byte, tags []metaTag) []byte {
+	lower := bytes.ToLower(page)
+	var markup bytes.Buffer
+	for _, t := range tags {
+		if bytes.Contains(lower, []byte(`"`+t.key+`"`)) || bytes.Contains(lower, []byte(`'`+t.key+`'`)) {
+			continue
+		}
+		markup.WriteString(`<meta ` + t.attr + `="` + t.key + `" content="` + html.EscapeString(t.content) + `">`)
+	}
+	if markup.Len() == 0 {
+		return page
+	}
+
+	at := 0
+	if i := openingTag(lower, "head"); i >= 0 {
+		if end := bytes.IndexByte(page[i:], '>'); end >= 0 {
+			at = i + end + 1
+		}
+	} else if i := openingTag(lower, "body"); i >= 0 {
+		at = i
+	}
+	out := make([]byte, 0, len(page)+markup.Len())
+	out = append(out, page[:at]...)
+	out = append(out, markup.Bytes()...)
+	return append(out, page[at:]...)
+}
+
+// openingTag returns the index of the first opening tag named name in the
+// lower-cased page, or -1. Longer names that start with it, like <header>
+// for head, do not count.
+func openingTag(lower []byte, name string) int {
+	prefix := []byte("<" + name)
+	for offset := 0; ; {
+		i := bytes.Index(lower[offset:], prefix)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		next := i + len(prefix)
+		if next == len(lower) || strings.IndexByte(" \t\r\n/>", lower[next]) >= 0 {
+			return i
+		}
+		offset = next
+	}
+}
@@ -0,0 +1,100 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestInjectMeta(t *testing.T) {
+	tags := []metaTag{{"property", "og:title", `Docs & "more"`}, {"name", "twitter:card", "summary"}}
+	const meta = `<meta property="og:title" content="Docs &amp; &#34;more&#34;"><meta name="twitter:card" content="summary">`
+	tests := []struct {
+		name, page, want string
+	}{
+		{"after head", "<html><head><title>x</title></head>", "<html><head>" + meta + "<title>x</title></head>"},
+		{"head attributes", `<HEAD lang="en"><title>x`, `<HEAD lang="en">` + meta + `<title>x`},
+		{"header is not head", "<header>x</header><body>y", "<header>x</header>" + meta + "<body>y"},
+		{"no head", "<body>x</body>", meta + "<body>x</body>"},
+		{"neither", "<h1>x</h1>", meta + "<h1>x</h1>"},
+		{
+			"existing tag kept", `<head><meta property="og:title" content="Own">`,
+			`<head><meta name="twitter:card" content="summary"><meta property="og:title" content="Own">`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectMeta([]byte(tt.page), tags)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_SocialPreviews(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":     "<html><head></head><body>Docs</body></html>",
+		"blog/post.html": "<html><head></head><body>Post</body></html>",
+		"about.html":     "<html><head></head><body>About</body></html>",
+		"blog/style.css": "body{}",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{SocialPreviews: []storage.SocialPreview{
+		{Path: "/*", Title: "Docs", Image: "/og.png"},
+		{Path: "/blog/*", Title: "Blog", Description: "What we shipped", Type: "article"},
+		{Path: "/about", Image: "https://cdn.example.com/about.png"},
+	}})
+	get := func(path string) string {
+		req := withCaps(httptest.NewRequest("GET", "https://docs.example.ts.net/"+path, nil), []auth.Cap{{Access: "view"}})
+		req.SetPathValue("path", path)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	post := get("blog/post")
+	for _, want := range []string{
+		`<meta property="og:title" content="Blog">`,
+		`<meta property="og:description" content="What we shipped">`,
+		`<meta property="og:type" content="article">`,
+		`<meta property="og:image" content="https://docs.example.ts.net/og.png">`,
+		`<meta property="og:url" content="https://docs.example.ts.net/blog/post">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(post, want) {
+			t.Errorf("blog post lacks %s: %s", want, post)
+		}
+	}
+	if about := get("about"); !strings.Contains(about, `content="https://cdn.example.com/about.png"`) || !strings.Contains(about, `content="Docs"`) {
+		t.Errorf("about page: %s", about)
+	}
+	if css := get("blog/style.css"); css != "body{}" {
+		t.Errorf("style.css = %q, want it unchanged", css)
+	}
+}
+
+func TestHandler_SocialPreviews_PermanentDeployment(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "<head></head><h1>v1</h1>"})
+	setupSite(t, store, "docs", "bbb22222", map[string]string{"index.html": "<head></head><h1>v2</h1>"})
+	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{SocialPreviews: []storage.SocialPreview{{Path: "/*", Title: "Old docs"}}})
+	store.WriteSiteConfig("docs", "bbb22222", storage.SiteConfig{SocialPreviews: []storage.SocialPreview{{Path: "/*", Title: "New docs"}}})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/"))
+	if body := rec.Body.String(); !strings.Contains(body, `content="Old docs"`) || strings.Contains(body, "New docs") {
+		t.Errorf("permanent deployment: %s", body)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `<meta property="og:url" content="http://example.com/__deployments/aaa11111/">`) {
+		t.Errorf("permanent deployment og:url: %s", body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/"))
+	if body := rec.Body.String(); !strings.Contains(body, `content="New docs"`) {
+		t.Errorf("active deployment: %s", body)
+	}
+}
@@ -0,0 +1,33 @@
+package serve
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// noRobots is the robots.txt of public sites that are not indexable.
+const noRobots = "User-agent: *\nDisallow: /\n"
+
+// noIndex reports whether search engines are kept from indexing the site:
+// staging sites always are, and public sites are, since Funnel exposes them
+// to the internet, unless the active deployment's config makes them
+// indexable.
+func (h *Handler) noIndex() bool {
+	_, _, _, cfg, ok := h.resolve()
+	if cfg.Staging != nil && *cfg.Staging {
+		return true
+	}
+	if !h.public.Load() {
+		return false
+	}
+	return !ok || cfg.Indexable == nil || !*cfg.Indexable
+}
+
+// serveNoRobots serves a robots.txt that disallows crawling the whole site,
+// in place of the deployment's own.
+func serveNoRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, no-cache")
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(noRobots))
+}
@@ -0,0 +1,135 @@
+package serve
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func serveRobotsTest(h *Handler, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	req.SetPathValue("path", strings.TrimPrefix(target, "/"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_PublicNoIndex(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>Docs</h1>",
+		"robots.txt": "User-agent: *\nAllow: /\n",
+	})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+	h.SetPublic(true)
+
+	rec := serveRobotsTest(h, "/")
+	if rec.Code != 200 || rec.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("status = %d, X-Robots-Tag = %q; want 200, noindex", rec.Code, rec.Header().Get("X-Robots-Tag"))
+	}
+	rec = serveRobotsTest(h, "/robots.txt")
+	if body := rec.Body.String(); body != noRobots {
+		t.Errorf("robots.txt = %q, want %q", body, noRobots)
+	}
+	if rec := serveRobotsTest(h, "/missing"); rec.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Error("404 response should carry noindex")
+	}
+}
+
+func TestHandler_PublicIndexable(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<h1>Docs</h1>",
+		"robots.txt": "User-agent: *\nAllow: /\n",
+	})
+	indexable := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Indexable: &indexable})
+	h.SetPublic(true)
+
+	if rec := serveRobotsTest(h, "/"); rec.Header().Get("X-Robots-Tag") != "" {
+		t.Errorf("X-Robots-Tag = %q on an indexable site", rec.Header().Get("X-Robots-Tag"))
+	}
+	if body := serveRobotsTest(h, "/robots.txt").Body.String(); body != "User-agent: *\nAllow: /\n" {
+		t.Errorf("robots.txt = %q, want the deployment's", body)
+	}
+}
+
+func TestHandler_PrivateNotNoIndexed(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "<h1>Docs</h1>"})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	req := withCaps(httptest.NewRequest("GET", "/", nil), []auth.Cap{{Access: "view"}})
+	req.SetPathValue("path", "")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("X-Robots-Tag") != "" {
+		t.Errorf("X-Robots-Tag = %q on a tailnet-only site", rec.Header().Get("X-Robots-Tag"))
+	}
+}
+
+func TestHandler_Staging(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html": "<html><body><h1>Docs</h1></body></html>",
+		"style.css":  "h1{}",
+	})
+	staging, indexable := true, true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Staging: &staging, Indexable: &indexable})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := withCaps(httptest.NewRequest("GET", target, nil), []auth.Cap{{Access: "view"}})
+		req.SetPathValue("path", strings.TrimPrefix(target, "/"))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Staging sites are kept out of search engines even when tailnet-only
+	// or indexable.
+	rec := get("/")
+	if rec.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("X-Robots-Tag = %q on a staging site", rec.Header().Get("X-Robots-Tag"))
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "<body>"+stagingRibbon+"<h1>") {
+		t.Errorf("page lacks the staging ribbon: %s", body)
+	}
+	if body := get("/style.css").Body.String(); body != "h1{}" {
+		t.Errorf("style.css = %q, want it unchanged", body)
+	}
+}
+
+func TestHandler_Staging_PermanentDeployment(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"index.html": "<body><h1>v1</h1></body>"})
+	setupSite(t, store, "docs", "bbb22222", map[string]string{"index.html": "<body><h1>v2</h1></body>"})
+	staging := true
+	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{Staging: &staging})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	// The older deployment was a staging build, the active one is not:
+	// each is served as its own config says.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/"))
+	if !strings.Contains(rec.Body.String(), stagingRibbon) || rec.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("permanent staging deployment: X-Robots-Tag = %q, body = %s", rec.Header().Get("X-Robots-Tag"), rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/"))
+	if strings.Contains(rec.Body.String(), stagingRibbon) || rec.Header().Get("X-Robots-Tag") != "" {
+		t.Errorf("active deployment: X-Robots-Tag = %q, body = %s", rec.Header().Get("X-Robots-Tag"), rec.Body.String())
+	}
+
+	// And the other way round.
+	store.WriteSiteConfig("docs", "aaa11111", storage.SiteConfig{})
+	store.WriteSiteConfig("docs", "bbb22222", storage.SiteConfig{Staging: &staging})
+	h.InvalidateConfig()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, permanentRequest("/__deployments/aaa11111/"))
+	if strings.Contains(rec.Body.String(), stagingRibbon) {
+		t.Errorf("permanent production deployment shows the ribbon: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,29 @@
+package serve
+
+import (
+	"path"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// unpublished reports whether a schedule rule covering reqPath hides it at
+// now. Like access rules, every matching rule must publish the path, and a
+// rule naming a file also covers its clean URL and directory request.
+func unpublished(reqPath, indexPage string, rules []storage.ScheduleRule, now time.Time) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	candidates := []string{reqPath, reqPath + ".html", path.Join(reqPath, indexPage)}
+	for _, rule := range rules {
+		for _, p := range candidates {
+			if matchAccessPath(rule.Path, p) {
+				if !rule.Visible(now) {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
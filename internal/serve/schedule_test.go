@@ -0,0 +1,91 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+func TestHandler_Schedule(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":          "<h1>Docs</h1>",
+		"announcement.html":   "<h1>Launch</h1>",
+		"sale/index.html":     "<h1>Sale</h1>",
+		"old-banner.html":     "<h1>Old</h1>",
+		"404.html":            "<h1>Not here</h1>",
+		"sale/countdown.html": "<h1>Soon</h1>",
+	})
+	now := time.Now()
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Schedule: []storage.ScheduleRule{
+		{Path: "/announcement*", VisibleFrom: now.Add(-time.Hour), VisibleUntil: now.Add(time.Hour)},
+		{Path: "/sale/*", VisibleFrom: now.Add(24 * time.Hour)},
+		{Path: "/sale/countdown.html", VisibleUntil: now.Add(24 * time.Hour)},
+		{Path: "/old-banner.html", VisibleUntil: now.Add(-time.Hour)},
+	}})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusOK},
+		{"/announcement", http.StatusOK},
+		{"/sale/", http.StatusNotFound},
+		{"/sale", http.StatusNotFound},
+		// Every matching rule must publish the path.
+		{"/sale/countdown", http.StatusNotFound},
+		{"/old-banner", http.StatusNotFound},
+		{"/old-banner.html", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := visit(h, "GET", tt.path, "", nil)
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusNotFound && rec.Body.String() != "<h1>Not here</h1>" {
+			t.Errorf("GET %s: body = %q, want the site's 404 page", tt.path, rec.Body.String())
+		}
+	}
+}
+
+func TestHandler_Schedule_LanguageVariants(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"news.html":    "english",
+		"news.de.html": "deutsch",
+	})
+	i18n := true
+	h := NewHandler(store, "docs", "", storage.SiteConfig{I18n: &i18n, Schedule: []storage.ScheduleRule{
+		{Path: "/news.de.html", VisibleUntil: time.Now().Add(-time.Hour)},
+	}})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, i18nRequest("/news", "de"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "english" {
+		t.Errorf("status = %d, body = %q, want the english page", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUnpublished(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rules := []storage.ScheduleRule{{Path: "/launch.html", VisibleFrom: now.Add(time.Hour)}}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/launch.html", true},
+		{"/launch", true},
+		{"/other", false},
+	}
+	for _, tt := range tests {
+		if got := unpublished(tt.path, "index.html", rules, now); got != tt.want {
+			t.Errorf("unpublished(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if unpublished("/launch", "index.html", rules, now.Add(2*time.Hour)) {
+		t.Error("path hidden after visible_from")
+	}
+}
@@ -0,0 +1,77 @@
+package serve
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+// SharePrefix is the URL prefix for share links: /__share/{token}/{path}.
+// Requests under it skip the view capability check and may only reach the
+// path the share covers.
+const SharePrefix = "/__share/"
+
+// serveShare serves the active deployment to the holder of a share token.
+// Unknown, expired, and revoked tokens, and paths the share does not cover,
+// all get the same 404 so a token reveals nothing beyond its own path.
+func (h *Handler) serveShare(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, SharePrefix)
+	token, sub, hasSlash := strings.Cut(rest, "/")
+	share, ok := h.store.LookupShare(h.site, token)
+	if !ok {
+		h.serveDefault404(w, r)
+		return
+	}
+	base := SharePrefix + token
+	if !hasSlash {
+		http.Redirect(w, r, base+"/", http.StatusFound)
+		return
+	}
+
+	deploymentID, resolvedRoot, since, cfg, ok := h.resolve()
+	if !ok {
+		h.servePlaceholder(w)
+		return
+	}
+	indexPage := cfg.IndexPage
+	if indexPage == "" {
+		indexPage = "index.html"
+	}
+	reqPath := path.Clean("/" + sub)
+	if !sharedPath(share, reqPath, indexPage) {
+		h.serveDefault404(w, r)
+		return
+	}
+
+	info := auth.RequestInfoFromContext(r.Context())
+	slog.Info("share accessed", "site", h.site, "share", share.ID, "path", reqPath,
+		"user", info.UserLogin, "node", info.NodeName, "ip", info.NodeIP)
+
+	// Keep the token out of Referer headers sent to linked sites.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	shared := r.Clone(context.WithValue(r.Context(), shareKey{}, share))
+	shared.URL.Path = "/" + sub
+	shared.URL.RawPath = ""
+	shared.SetPathValue("path", sub)
+	h.serveDeployment(w, shared, base, deploymentID, resolvedRoot, since, cfg)
+}
+
+type shareKey struct{}
+
+// sharedPath reports whether share covers the site path reqPath, or the
+// document it resolves to.
+func sharedPath(share storage.Share, reqPath, indexPage string) bool {
+	return share.Covers(reqPath) || share.Covers(reqPath+".html") || share.Covers(path.Join(reqPath, indexPage))
+}
+
+// shareAllows reports whether r may reach the site path reqPath: always,
+// unless r came in through a share link that does not cover it.
+func shareAllows(r *http.Request, reqPath, indexPage string) bool {
+	share, ok := r.Context().Value(shareKey{}).(storage.Share)
+	return !ok || sharedPath(share, reqPath, indexPage)
+}
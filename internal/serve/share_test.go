@@ -0,0 +1,92 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/auth"
+	"tspages/internal/storage"
+)
+
+func TestHandler_Share(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{
+		"index.html":       "<h1>Home</h1>",
+		"report.html":      "<h1>Report</h1>",
+		"guide/index.html": "<h1>Guide</h1>",
+		"guide/setup.html": "<h1>Setup</h1>",
+		"secret.html":      "<h1>Secret</h1>",
+	})
+	file, err := store.CreateShare("docs", storage.Share{Path: "/report.html", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.CreateShare("docs", storage.Share{Path: "/guide/", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _ := store.CreateShare("docs", storage.Share{Path: "/", ExpiresAt: time.Now().Add(time.Hour)})
+	store.RevokeShare("docs", revoked.ID, "admin")
+	expired, _ := store.CreateShare("docs", storage.Share{Path: "/", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	h := NewHandler(store, "docs", "", storage.SiteConfig{})
+
+	tests := []struct {
+		name string
+		path string
+		want int
+		body string
+	}{
+		{"clean URL", "/__share/" + file.Token + "/report", http.StatusOK, "Report"},
+		{"extension redirects", "/__share/" + file.Token + "/report.html", http.StatusMovedPermanently, ""},
+		{"other file", "/__share/" + file.Token + "/secret", http.StatusNotFound, ""},
+		{"dot segments", "/__share/" + file.Token + "/x/../secret", http.StatusNotFound, ""},
+		{"directory", "/__share/" + dir.Token + "/guide/", http.StatusOK, "Guide"},
+		{"below directory", "/__share/" + dir.Token + "/guide/setup", http.StatusOK, "Setup"},
+		{"outside directory", "/__share/" + dir.Token + "/", http.StatusNotFound, ""},
+		{"unknown token", "/__share/nope/report", http.StatusNotFound, ""},
+		{"revoked", "/__share/" + revoked.Token + "/report", http.StatusNotFound, ""},
+		{"expired", "/__share/" + expired.Token + "/report", http.StatusNotFound, ""},
+		{"no capability", "/report", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The visitor is on the tailnet but holds no capability.
+			req := withCaps(httptest.NewRequest("GET", tt.path, nil), []auth.Cap{})
+			req.SetPathValue("path", strings.TrimPrefix(tt.path, "/"))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.body != "" && !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %s, want %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+
+	// Redirects stay under the share prefix.
+	req := withCaps(httptest.NewRequest("GET", "/__share/"+file.Token+"/report.html", nil), []auth.Cap{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if loc := rec.Header().Get("Location"); loc != "/__share/"+file.Token+"/report" {
+		t.Errorf("Location = %q", loc)
+	}
+}
+
+func TestHandler_ShareRespectsAccessRules(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", "aaa11111", map[string]string{"internal/plan.html": "<h1>Plan</h1>"})
+	sh, _ := store.CreateShare("docs", storage.Share{Path: "/", ExpiresAt: time.Now().Add(time.Hour)})
+	h := NewHandler(store, "docs", "", storage.SiteConfig{Access: []storage.AccessRule{{Path: "/internal/*", Access: "admin"}}})
+
+	req := withCaps(httptest.NewRequest("GET", "/__share/"+sh.Token+"/internal/plan", nil), []auth.Cap{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
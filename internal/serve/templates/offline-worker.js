@@ -0,0 +1,60 @@
+// Service worker of a tspages site.
+{{- if .Precache}}
+// Generated when deployment {{.Deployment}} was activated, it precaches the
+// deployment's files and answers from that cache while the network is
+// unreachable.
+
+const CACHE = "tspages-offline-{{.Deployment}}";
+const PRECACHE = {{.Precache}};
+
+self.addEventListener("install", (event) => {
+    // Files that vanished since the worker was generated are skipped rather
+    // than failing the installation.
+    event.waitUntil(
+        caches.open(CACHE)
+            .then((cache) => Promise.all(PRECACHE.map(
+                (url) => cache.add(new Request(url, {cache: "reload"}))
+                    .catch((error) => console.warn(`tspages: precaching ${url} failed:`, error)),
+            )))
+            .then(() => self.skipWaiting()),
+    );
+});
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((keys) => Promise.all(keys
+                .filter((key) => key.startsWith("tspages-offline-") && key !== CACHE)
+                .map((key) => caches.delete(key))))
+            .then(() => self.clients.claim()),
+    );
+});
+
+// Network first, so visitors who are online always see the live site.
+self.addEventListener("fetch", (event) => {
+    const request = event.request;
+    if (request.method !== "GET" || new URL(request.url).origin !== self.location.origin) {
+        return;
+    }
+    event.respondWith(
+        fetch(request).catch(() => caches
+            .match(request, {cacheName: CACHE, ignoreSearch: true})
+            .then((response) => response || Response.error())),
+    );
+});
+{{- else}}
+// The site no longer works offline, so the worker removes its caches and
+// unregisters itself.
+
+self.addEventListener("install", () => self.skipWaiting());
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((keys) => Promise.all(keys
+                .filter((key) => key.startsWith("tspages-offline-"))
+                .map((key) => caches.delete(key))))
+            .then(() => self.registration.unregister()),
+    );
+});
+{{- end}}
@@ -0,0 +1,226 @@
+// Package sitehealth scores each site's health from its recent server
+// errors, the checks of its server, and its webhook deliveries, and exports
+// the score as a Prometheus gauge.
+package sitehealth
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/metrics"
+	"tspages/internal/storage"
+)
+
+const (
+	// Interval is how often Run scores the sites.
+	Interval = time.Minute
+	// Window is how far back a score looks.
+	Window = 15 * time.Minute
+
+	// minRequests is the traffic per Window below which the error rate is
+	// too noisy to count against a site.
+	minRequests = 10
+	// errorRateFloor is the share of server errors at which the error part
+	// of the score drops to zero.
+	errorRateFloor = 0.1
+	// tamperedMax is the highest score of a site serving files changed
+	// outside tspages, which is failing whatever else.
+	tamperedMax = 0.5
+)
+
+// Weights of the parts of a score. They add up to 1.
+const (
+	errorWeight   = 0.5
+	serverWeight  = 0.3
+	webhookWeight = 0.2
+)
+
+// Levels a score is shown as.
+const (
+	LevelHealthy  = "healthy"
+	LevelDegraded = "degraded"
+	LevelFailing  = "failing"
+)
+
+// Checker reports on a site's server.
+type Checker interface {
+	IsRunning(site string) bool
+	LoginError(site string) string
+}
+
+// WebhookStats counts a site's webhook deliveries.
+type WebhookStats interface {
+	DeliveryStats(site string, from, to time.Time) (total, succeeded, failed int64, err error)
+}
+
+// Score is a site's health over the Window before it was computed.
+type Score struct {
+	// Score is from 0, failing entirely, to 1, healthy.
+	Score float64 `json:"score"`
+	Level string  `json:"level"`
+	// ErrorRate is the share of requests answered with a server error, or
+	// 0 with too few requests to tell.
+	ErrorRate float64 `json:"error_rate"`
+	// ServerUptime is the share of checks that found the site's server
+	// running and logged in.
+	ServerUptime float64 `json:"server_uptime"`
+	// WebhookFailureRate is the share of webhook deliveries that failed
+	// after every attempt.
+	WebhookFailureRate float64 `json:"webhook_failure_rate"`
+	// Tampered is set when files of the site's active deployment were
+	// changed outside tspages.
+	Tampered bool `json:"tampered,omitempty"`
+}
+
+// level returns the level of score.
+func level(score float64) string {
+	switch {
+	case score >= 0.9:
+		return LevelHealthy
+	case score >= 0.6:
+		return LevelDegraded
+	default:
+		return LevelFailing
+	}
+}
+
+// sample is one check of a site's server.
+type sample struct {
+	time time.Time
+	up   bool
+}
+
+// Scorer periodically scores the sites with an active deployment. Server
+// checks are kept in memory, so they start over when tspages restarts.
+type Scorer struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	checker  Checker
+	webhooks WebhookStats
+
+	mu     sync.Mutex
+	checks map[string][]sample
+	scores map[string]Score
+}
+
+// NewScorer returns a Scorer. recorder and webhooks may be nil, which
+// leaves their parts out of the score.
+func NewScorer(store *storage.Store, recorder *analytics.Recorder, checker Checker, webhooks WebhookStats) *Scorer {
+	return &Scorer{store: store, recorder: recorder, checker: checker, webhooks: webhooks,
+		checks: make(map[string][]sample), scores: make(map[string]Score)}
+}
+
+// Run scores the sites every Interval until ctx ends.
+func (s *Scorer) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		s.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks each site's server and scores the site as of now. Sites
+// that were deleted, archived, or lost their active deployment are
+// forgotten.
+func (s *Scorer) Check(now time.Time) {
+	sites, err := s.store.ListSites()
+	if err != nil {
+		slog.Error("site health: listing sites", "err", err)
+		return
+	}
+	seen := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		if site.ActiveDeploymentID == "" || s.store.SiteArchived(site.Name) {
+			continue
+		}
+		seen[site.Name] = true
+		up := s.checker.IsRunning(site.Name) && s.checker.LoginError(site.Name) == ""
+		score := s.score(site.Name, up, now)
+		if _, tampered := s.store.Tampered(site.Name, site.ActiveDeploymentID); tampered {
+			score.Tampered = true
+			score.Score = min(score.Score, tamperedMax)
+			score.Level = level(score.Score)
+		}
+		metrics.SetSiteHealth(site.Name, score.Score)
+		s.mu.Lock()
+		s.scores[site.Name] = score
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.scores {
+		if !seen[name] {
+			delete(s.scores, name)
+			delete(s.checks, name)
+			metrics.DeleteSiteHealth(name)
+		}
+	}
+}
+
+// score records a check of site's server and computes its score.
+func (s *Scorer) score(site string, up bool, now time.Time) Score {
+	from := now.Add(-Window)
+	s.mu.Lock()
+	checks := append(s.checks[site], sample{time: now, up: up})
+	checks = checks[slices.IndexFunc(checks, func(c sample) bool { return c.time.After(from) }):]
+	s.checks[site] = checks
+	upCount := 0
+	for _, c := range checks {
+		if c.up {
+			upCount++
+		}
+	}
+	s.mu.Unlock()
+
+	score := Score{ServerUptime: float64(upCount) / float64(len(checks))}
+	if s.recorder != nil {
+		codes, err := s.recorder.StatusBreakdown(site, from, now)
+		if err != nil {
+			slog.Error("site health: querying requests", "site", site, "err", err)
+		}
+		var total, serverErrors int64
+		for _, c := range codes {
+			total += c.Count
+			if c.Status == "5xx" {
+				serverErrors = c.Count
+			}
+		}
+		if total >= minRequests {
+			score.ErrorRate = float64(serverErrors) / float64(total)
+		}
+	}
+	if s.webhooks != nil {
+		total, _, failed, err := s.webhooks.DeliveryStats(site, from, now)
+		if err != nil {
+			slog.Error("site health: querying webhook deliveries", "site", site, "err", err)
+		}
+		if total > 0 {
+			score.WebhookFailureRate = float64(failed) / float64(total)
+		}
+	}
+
+	score.Score = math.Round((errorWeight*(1-min(score.ErrorRate/errorRateFloor, 1))+
+		serverWeight*score.ServerUptime+
+		webhookWeight*(1-score.WebhookFailureRate))*1000) / 1000
+	score.Level = level(score.Score)
+	return score
+}
+
+// Score returns the last score of site, if it was scored.
+func (s *Scorer) Score(site string) (Score, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	score, ok := s.scores[site]
+	return score, ok
+}
@@ -0,0 +1,161 @@
+package sitehealth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/storage"
+)
+
+func setupSite(t *testing.T, store *storage.Store, site string) {
+	t.Helper()
+	id := storage.NewDeploymentID()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type fakeChecker struct{ stopped map[string]bool }
+
+func (c fakeChecker) IsRunning(site string) bool    { return !c.stopped[site] }
+func (c fakeChecker) LoginError(site string) string { return "" }
+
+type fakeWebhooks struct{ failed map[string]int64 }
+
+func (w fakeWebhooks) DeliveryStats(site string, from, to time.Time) (int64, int64, int64, error) {
+	return 10, 10 - w.failed[site], w.failed[site], nil
+}
+
+// requests returns count requests for site in the Window before end, every
+// nth of them answered with status 500.
+func requests(site string, end time.Time, count, nth int) []analytics.Event {
+	var evs []analytics.Event
+	for i := range count {
+		status := 200
+		if nth > 0 && i%nth == 0 {
+			status = 500
+		}
+		evs = append(evs, analytics.Event{
+			Timestamp: end.Add(-time.Duration(i+1) * Window / time.Duration(count+1)),
+			Site:      site,
+			Path:      "/",
+			Status:    status,
+		})
+	}
+	return evs
+}
+
+func TestScorer_Check(t *testing.T) {
+	store := storage.New(t.TempDir())
+	for _, site := range []string{"docs", "blog", "demo", "quiet"} {
+		setupSite(t, store, site)
+	}
+	if err := store.CreateSite("empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := analytics.NewRecorder(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	var evs []analytics.Event
+	evs = append(evs, requests("docs", now, 100, 0)...)
+	// blog fails a fifth of its requests, quiet one of too few to count.
+	evs = append(evs, requests("blog", now, 100, 5)...)
+	evs = append(evs, requests("quiet", now, 5, 5)...)
+	if err := recorder.Import(evs); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := fakeChecker{stopped: map[string]bool{"demo": true}}
+	webhooks := fakeWebhooks{failed: map[string]int64{"docs": 5}}
+	s := NewScorer(store, recorder, checker, webhooks)
+	s.Check(now)
+
+	tests := []struct {
+		site  string
+		score float64
+		level string
+	}{
+		{"docs", 0.9, LevelHealthy},
+		{"blog", 0.5, LevelFailing},
+		{"demo", 0.7, LevelDegraded},
+		{"quiet", 1, LevelHealthy},
+	}
+	for _, tt := range tests {
+		got, ok := s.Score(tt.site)
+		if !ok {
+			t.Errorf("%s was not scored", tt.site)
+			continue
+		}
+		if got.Score != tt.score || got.Level != tt.level {
+			t.Errorf("%s scored %+v, want %v (%s)", tt.site, got, tt.score, tt.level)
+		}
+	}
+	if _, ok := s.Score("empty"); ok {
+		t.Error("site without an active deployment was scored")
+	}
+}
+
+func TestScorer_ServerUptime(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs")
+
+	checker := fakeChecker{stopped: map[string]bool{}}
+	s := NewScorer(store, nil, checker, nil)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		checker.stopped["docs"] = i == 0
+		s.Check(now.Add(time.Duration(i) * Interval))
+	}
+	if got, _ := s.Score("docs"); got.ServerUptime != 0.75 {
+		t.Errorf("uptime = %v, want 0.75", got.ServerUptime)
+	}
+
+	// The failed check drops out of the window.
+	s.Check(now.Add(Window + time.Minute))
+	if got, _ := s.Score("docs"); got.ServerUptime != 1 || got.Score != 1 {
+		t.Errorf("score = %+v, want full uptime", got)
+	}
+}
+
+func TestScorer_Tampered(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs")
+	id, _ := store.CurrentDeployment("docs")
+	store.MarkTampered("docs", id, "index.html: missing")
+
+	s := NewScorer(store, nil, fakeChecker{}, nil)
+	s.Check(time.Now())
+	if got, _ := s.Score("docs"); !got.Tampered || got.Score != tamperedMax || got.Level != LevelFailing {
+		t.Errorf("score = %+v, want a failing tampered site", got)
+	}
+}
+
+func TestScorer_ForgetsRemovedSites(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs")
+
+	s := NewScorer(store, nil, fakeChecker{}, nil)
+	now := time.Now()
+	s.Check(now)
+	if _, ok := s.Score("docs"); !ok {
+		t.Fatal("docs was not scored")
+	}
+	if err := store.DeleteSite("docs"); err != nil {
+		t.Fatal(err)
+	}
+	s.Check(now.Add(Interval))
+	if _, ok := s.Score("docs"); ok {
+		t.Error("deleted site kept its score")
+	}
+}
@@ -15,6 +15,37 @@ func Apply(db *sql.DB, migrations []func(*sql.Tx) error) error {
 	if err := db.QueryRow("PRAGMA user_version").Scan(&current); err != nil {
 		return fmt.Errorf("sqlmigrate: reading schema version: %w", err)
 	}
+	return apply(db, current, migrations, func(tx *sql.Tx, version int) error {
+		_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+		return err
+	})
+}
+
+// ApplyScoped is like Apply but tracks the version under scope in a
+// schema_versions table instead of PRAGMA user_version, so packages that
+// share a database keep independent migration histories.
+func ApplyScoped(db *sql.DB, scope string, migrations []func(*sql.Tx) error) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_versions (
+		scope   TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("sqlmigrate: creating schema_versions: %w", err)
+	}
+	var current int
+	err := db.QueryRow(`SELECT version FROM schema_versions WHERE scope = ?`, scope).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("sqlmigrate: reading %s schema version: %w", scope, err)
+	}
+	return apply(db, current, migrations, func(tx *sql.Tx, version int) error {
+		_, err := tx.Exec(`INSERT INTO schema_versions (scope, version) VALUES (?, ?)
+			ON CONFLICT(scope) DO UPDATE SET version = excluded.version`, scope, version)
+		return err
+	})
+}
+
+// apply runs the migrations after current, recording each new version with
+// setVersion in the migration's transaction.
+func apply(db *sql.DB, current int, migrations []func(*sql.Tx) error, setVersion func(*sql.Tx, int) error) error {
 	for i, fn := range migrations {
 		version := i + 1
 		if version <= current {
@@ -28,7 +59,7 @@ func Apply(db *sql.DB, migrations []func(*sql.Tx) error) error {
 			tx.Rollback()
 			return fmt.Errorf("sqlmigrate: migration %d: %w", version, err)
 		}
-		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		if err := setVersion(tx, version); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("sqlmigrate: migration %d: setting version: %w", version, err)
 		}
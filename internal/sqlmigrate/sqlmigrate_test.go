@@ -175,3 +175,36 @@ func TestApply_ResumesFromVersion(t *testing.T) {
 		t.Fatalf("want version 2, got %d", v)
 	}
 }
+
+func TestApplyScoped_SharedDB(t *testing.T) {
+	db := openTestDB(t)
+
+	create := func(table string) []func(*sql.Tx) error {
+		return []func(*sql.Tx) error{
+			func(tx *sql.Tx) error {
+				_, err := tx.Exec(`CREATE TABLE ` + table + ` (id INTEGER PRIMARY KEY)`)
+				return err
+			},
+		}
+	}
+	// Another package has already migrated the database.
+	if err := Apply(db, create("t1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplyScoped(db, "other", create("t2")); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='t2'`).Scan(&name); err != nil {
+		t.Fatal("table t2 not created")
+	}
+	if v := userVersion(t, db); v != 1 {
+		t.Fatalf("user_version changed to %d", v)
+	}
+
+	// Run again — migration should be skipped.
+	if err := ApplyScoped(db, "other", create("t2")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package status
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+//go:embed templates/status.gohtml
+var statusTmplStr string
+
+var statusTmpl = template.Must(template.New("status").Funcs(template.FuncMap{
+	"uptime": func(pct float64) string { return fmt.Sprintf("%.2f%%", pct) },
+	"time":   func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(statusTmplStr))
+
+// JSONPath is where Handler serves the report as JSON.
+const JSONPath = "/status.json"
+
+// Handler serves the status page at / and its report at JSONPath.
+type Handler struct {
+	monitor *Monitor
+	title   string
+}
+
+func NewHandler(monitor *Monitor, title string) *Handler {
+	return &Handler{monitor: monitor, title: title}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != JSONPath {
+		http.NotFound(w, r)
+		return
+	}
+	report := h.monitor.Report(time.Now())
+	report.Title = h.title
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.URL.Path == JSONPath {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			slog.Warn("encoding status report failed", "err", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTmpl.Execute(w, report); err != nil {
+		slog.Error("rendering status page", "err", err)
+	}
+}
@@ -0,0 +1,235 @@
+// Package status checks whether each site's server is up and renders a
+// status page from the history of those checks.
+package status
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// Window is how far back the status page reports uptime.
+const Window = 24 * time.Hour
+
+// bucketCount is how many bars a site's history is shown as.
+const bucketCount = 24
+
+// deploymentLimit is how many recent deployments a site lists.
+const deploymentLimit = 3
+
+// Checker reports whether a site's server is running.
+type Checker interface {
+	IsRunning(site string) bool
+}
+
+// Sample is the result of checking a site once.
+type Sample struct {
+	Time time.Time
+	Up   bool
+}
+
+// Bucket summarizes the checks of a site during part of the Window.
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Checks int       `json:"checks"`
+	Up     int       `json:"up"`
+}
+
+// State returns "up" if every check in the bucket passed, "down" if none
+// did, "degraded" if some did, and "" if there were no checks.
+func (b Bucket) State() string {
+	switch {
+	case b.Checks == 0:
+		return ""
+	case b.Up == b.Checks:
+		return "up"
+	case b.Up == 0:
+		return "down"
+	default:
+		return "degraded"
+	}
+}
+
+// Deployment is a completed deployment shown on the status page.
+type Deployment struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SiteStatus is the state of one site on the status page.
+type SiteStatus struct {
+	Site string `json:"site"`
+	Up   bool   `json:"up"`
+	// Uptime is the percentage of checks during the Window that found the
+	// site up.
+	Uptime      float64      `json:"uptime"`
+	History     []Bucket     `json:"history"`
+	Deployments []Deployment `json:"deployments"`
+}
+
+// Report is the content of the status page.
+type Report struct {
+	Title     string       `json:"title"`
+	CheckedAt time.Time    `json:"checked_at"`
+	Sites     []SiteStatus `json:"sites"`
+}
+
+// AllUp reports whether every site was up at the last check.
+func (r Report) AllUp() bool {
+	for _, s := range r.Sites {
+		if !s.Up {
+			return false
+		}
+	}
+	return true
+}
+
+// Monitor periodically checks the servers of sites with an active
+// deployment and keeps the results for the last Window in memory, so the
+// history starts over when tspages restarts.
+type Monitor struct {
+	store   *storage.Store
+	checker Checker
+	// sites limits the monitor to sites matching these patterns; empty
+	// includes every site.
+	sites []string
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	history   map[string][]Sample
+}
+
+func NewMonitor(store *storage.Store, checker Checker, sites []string) *Monitor {
+	return &Monitor{store: store, checker: checker, sites: sites, history: make(map[string][]Sample)}
+}
+
+// Run checks the sites every interval until ctx ends.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check records whether each monitored site is up. Sites that were
+// deleted, archived, or lost their active deployment are forgotten.
+func (m *Monitor) Check(now time.Time) {
+	sites, err := m.store.ListSites()
+	if err != nil {
+		slog.Error("status: listing sites", "err", err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		if site.ActiveDeploymentID == "" || !m.includes(site.Name) || m.store.SiteArchived(site.Name) {
+			continue
+		}
+		seen[site.Name] = true
+		samples := append(m.history[site.Name], Sample{Time: now, Up: m.checker.IsRunning(site.Name)})
+		start := now.Add(-Window)
+		i := slices.IndexFunc(samples, func(s Sample) bool { return s.Time.After(start) })
+		m.history[site.Name] = samples[i:]
+	}
+	for name := range m.history {
+		if !seen[name] {
+			delete(m.history, name)
+		}
+	}
+	m.checkedAt = now
+}
+
+// includes reports whether the monitor covers site.
+func (m *Monitor) includes(site string) bool {
+	if len(m.sites) == 0 {
+		return true
+	}
+	for _, pattern := range m.sites {
+		if ok, _ := path.Match(pattern, site); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Report returns the state of every monitored site as of now, sorted by
+// name.
+func (m *Monitor) Report(now time.Time) Report {
+	m.mu.Lock()
+	r := Report{CheckedAt: m.checkedAt, Sites: make([]SiteStatus, 0, len(m.history))}
+	for name, samples := range m.history {
+		r.Sites = append(r.Sites, siteStatus(name, samples, now))
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(r.Sites, func(a, b SiteStatus) int { return strings.Compare(a.Site, b.Site) })
+	for i := range r.Sites {
+		r.Sites[i].Deployments = m.recentDeployments(r.Sites[i].Site)
+	}
+	return r
+}
+
+// siteStatus summarizes a site's samples over the Window ending at now.
+func siteStatus(site string, samples []Sample, now time.Time) SiteStatus {
+	s := SiteStatus{Site: site, History: make([]Bucket, bucketCount)}
+	width := Window / bucketCount
+	start := now.Add(-Window)
+	for i := range s.History {
+		s.History[i].Start = start.Add(time.Duration(i) * width)
+	}
+	var checks, up int
+	for _, sample := range samples {
+		if !sample.Time.After(start) || sample.Time.After(now) {
+			continue
+		}
+		// A check at exactly now belongs to the last bucket.
+		i := min(int(sample.Time.Sub(start)/width), bucketCount-1)
+		s.History[i].Checks++
+		checks++
+		if sample.Up {
+			s.History[i].Up++
+			up++
+		}
+	}
+	if len(samples) > 0 {
+		s.Up = samples[len(samples)-1].Up
+	}
+	if checks > 0 {
+		s.Uptime = float64(up) * 100 / float64(checks)
+	}
+	return s
+}
+
+// recentDeployments returns the site's latest completed deployments,
+// newest first.
+func (m *Monitor) recentDeployments(site string) []Deployment {
+	infos, err := m.store.ListDeployments(site)
+	if err != nil {
+		slog.Error("status: listing deployments", "site", site, "err", err)
+		return nil
+	}
+	deployments := make([]Deployment, 0, deploymentLimit)
+	for _, d := range infos {
+		if !d.Failed && !d.CreatedAt.IsZero() {
+			deployments = append(deployments, Deployment{ID: d.ID, CreatedAt: d.CreatedAt})
+		}
+	}
+	slices.SortFunc(deployments, func(a, b Deployment) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	if len(deployments) > deploymentLimit {
+		deployments = deployments[:deploymentLimit]
+	}
+	return deployments
+}
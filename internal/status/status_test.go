@@ -0,0 +1,139 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+type fakeChecker map[string]bool
+
+func (c fakeChecker) IsRunning(site string) bool { return c[site] }
+
+func deploySite(t *testing.T, store *storage.Store, site, id string, at time.Time) {
+	t.Helper()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteManifest(site, id, storage.Manifest{Site: site, ID: id, CreatedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMonitor_Report(t *testing.T) {
+	store := storage.New(t.TempDir())
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	deploySite(t, store, "docs", "aaa11111", now.Add(-48*time.Hour))
+	deploySite(t, store, "docs", "bbb22222", now.Add(-time.Hour))
+	deploySite(t, store, "blog", "ccc33333", now.Add(-time.Hour))
+	deploySite(t, store, "internal", "ddd44444", now.Add(-time.Hour))
+	if _, err := store.CreateDeployment("empty", "eee55555"); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := fakeChecker{"docs": true, "blog": true, "internal": true}
+	m := NewMonitor(store, checker, []string{"docs", "b*"})
+	// Checks older than the window are dropped.
+	m.Check(now.Add(-25 * time.Hour))
+	m.Check(now.Add(-90 * time.Minute))
+	checker["blog"] = false
+	m.Check(now.Add(-30 * time.Minute))
+	m.Check(now)
+
+	r := m.Report(now)
+	if len(r.Sites) != 2 || r.Sites[0].Site != "blog" || r.Sites[1].Site != "docs" {
+		t.Fatalf("sites = %+v, want blog and docs", r.Sites)
+	}
+	if !r.CheckedAt.Equal(now) || r.AllUp() {
+		t.Errorf("checked at %v, all up %v", r.CheckedAt, r.AllUp())
+	}
+
+	blog, docs := r.Sites[0], r.Sites[1]
+	if blog.Up || int(blog.Uptime) != 33 {
+		t.Errorf("blog up = %v, uptime = %.2f; want down at 33%%", blog.Up, blog.Uptime)
+	}
+	if !docs.Up || docs.Uptime != 100 {
+		t.Errorf("docs up = %v, uptime = %.2f; want up at 100%%", docs.Up, docs.Uptime)
+	}
+	if len(blog.History) != bucketCount {
+		t.Fatalf("history has %d buckets, want %d", len(blog.History), bucketCount)
+	}
+	if got := blog.History[bucketCount-2].State(); got != "up" {
+		t.Errorf("second-to-last bucket = %q, want up", got)
+	}
+	if got := blog.History[bucketCount-1].State(); got != "down" {
+		t.Errorf("last bucket = %q, want down", got)
+	}
+	if got := blog.History[0].State(); got != "" {
+		t.Errorf("first bucket = %q, want no checks", got)
+	}
+	if len(docs.Deployments) != 2 || docs.Deployments[0].ID != "bbb22222" {
+		t.Errorf("docs deployments = %+v, want newest first", docs.Deployments)
+	}
+
+	// Archived sites are dropped from the page.
+	if err := store.ArchiveSite("blog", storage.ArchiveState{ArchivedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	m.Check(now.Add(time.Minute))
+	if r := m.Report(now.Add(time.Minute)); len(r.Sites) != 1 || !r.AllUp() {
+		t.Errorf("sites after archiving = %+v", r.Sites)
+	}
+}
+
+func TestBucket_State(t *testing.T) {
+	for _, tt := range []struct {
+		b    Bucket
+		want string
+	}{
+		{Bucket{}, ""},
+		{Bucket{Checks: 3, Up: 3}, "up"},
+		{Bucket{Checks: 3, Up: 1}, "degraded"},
+		{Bucket{Checks: 3}, "down"},
+	} {
+		if got := tt.b.State(); got != tt.want {
+			t.Errorf("%+v.State() = %q, want %q", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := storage.New(t.TempDir())
+	deploySite(t, store, "docs", "aaa11111", time.Now().Add(-time.Hour))
+	m := NewMonitor(store, fakeChecker{"docs": true}, nil)
+	m.Check(time.Now())
+	h := NewHandler(m, "Acme status")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "<title>Acme status</title>") ||
+		!strings.Contains(body, "All sites are up.") || !strings.Contains(body, "aaa11111") {
+		t.Errorf("status = %d, body = %s", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", JSONPath, nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Title != "Acme status" || len(report.Sites) != 1 || !report.Sites[0].Up {
+		t.Errorf("report = %+v", report)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/docs", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path status = %d, want 404", rec.Code)
+	}
+}
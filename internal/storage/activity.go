@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// activityFile holds a site's activity log, one JSON entry per line, in
+	// the site directory. Server-wide activity is kept in the data
+	// directory under the same name.
+	activityFile = "activity.jsonl"
+	// maxActivityEntries is the number of entries an activity log keeps;
+	// older entries are dropped once the log holds twice as many.
+	maxActivityEntries = 1000
+	// minActivityLine is a lower bound on the length of an entry's line,
+	// to skip counting lines in logs too small to need trimming.
+	minActivityLine = 48
+)
+
+// ActivityEntry is a single event in an activity log.
+type ActivityEntry struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	Actor        string    `json:"actor,omitempty"`
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+}
+
+// AppendActivity records e in the activity log of site, or in the
+// server-wide log if site is empty. Activity of sites that do not exist,
+// such as one that was just deleted, is dropped.
+func (s *Store) AppendActivity(site string, e ActivityEntry) error {
+	dir := s.dataDir
+	if site != "" {
+		if !ValidSiteName(site) {
+			return fmt.Errorf("invalid site name: %q", site)
+		}
+		dir = filepath.Join(s.dataDir, "sites", site)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.activityMu.Lock()
+	defer s.activityMu.Unlock()
+	file := filepath.Join(dir, activityFile)
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return trimActivity(file)
+}
+
+// ListActivity returns the activity log of site, or the server-wide log
+// if site is empty, newest first.
+func (s *Store) ListActivity(site string) ([]ActivityEntry, error) {
+	dir := s.dataDir
+	if site != "" {
+		if !ValidSiteName(site) {
+			return nil, fmt.Errorf("invalid site name: %q", site)
+		}
+		dir = filepath.Join(s.dataDir, "sites", site)
+	}
+	s.activityMu.Lock()
+	data, err := os.ReadFile(filepath.Join(dir, activityFile))
+	s.activityMu.Unlock()
+	if os.IsNotExist(err) {
+		return []ActivityEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ActivityEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e ActivityEntry
+		// Skip lines that cannot be parsed, such as one cut short by a crash.
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading activity: %w", err)
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// trimActivity rewrites the log at file with its newest maxActivityEntries
+// entries once it holds twice as many, so appending stays cheap.
+func trimActivity(file string) error {
+	info, err := os.Stat(file)
+	if err != nil || info.Size() <= 2*maxActivityEntries*minActivityLine {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 2*maxActivityEntries {
+		return nil
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, bytes.Join(lines[len(lines)-maxActivityEntries:], nil), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestActivity(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, typ := range []string{"deploy.success", "deployment.activated"} {
+		err := s.AppendActivity("docs", ActivityEntry{Time: at.Add(time.Duration(i) * time.Minute), Type: typ, DeploymentID: "aaa11111", Actor: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AppendActivity("", ActivityEntry{Type: "health.degraded"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.ListActivity("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != "deployment.activated" || entries[1].Actor != "alice" {
+		t.Errorf("entries = %+v, want newest first", entries)
+	}
+	server, _ := s.ListActivity("")
+	if len(server) != 1 || server[0].Time.IsZero() {
+		t.Errorf("server-wide entries = %+v", server)
+	}
+}
+
+func TestActivity_MissingSite(t *testing.T) {
+	s := New(t.TempDir())
+	if err := s.AppendActivity("gone", ActivityEntry{Type: "site.deleted"}); err != nil {
+		t.Errorf("appending to a missing site: %v", err)
+	}
+	entries, err := s.ListActivity("gone")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("entries = %+v, %v; want none", entries, err)
+	}
+}
+
+func TestActivity_Trims(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	for i := range 2*maxActivityEntries + 1 {
+		if err := s.AppendActivity("docs", ActivityEntry{Type: "deploy.success", Detail: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := s.ListActivity("docs")
+	if len(entries) != maxActivityEntries || entries[0].Detail != fmt.Sprint(2*maxActivityEntries) {
+		t.Errorf("kept %d entries, newest %q", len(entries), entries[0].Detail)
+	}
+}
+
+func TestActivity_SkipsCorruptLines(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.AppendActivity("docs", ActivityEntry{Type: "deploy.success"})
+	f, _ := os.OpenFile(filepath.Join(s.dataDir, "sites", "docs", activityFile), os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"time":`)
+	f.Close()
+
+	entries, err := s.ListActivity("docs")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("entries = %+v, %v", entries, err)
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"slices"
+)
+
+// DefaultAnalyticsTagLength is the length analytics tag values are cut to
+// when a rule sets no max_length.
+const DefaultAnalyticsTagLength = 64
+
+// maxAnalyticsTagRules caps the analytics tag rules of a site.
+const maxAnalyticsTagRules = 10
+
+// analyticsTagName matches the names of analytics tags.
+var analyticsTagName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// sensitiveHeaders carry credentials or identities and cannot be recorded.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Tailscale-User-Login",
+	"Tailscale-User-Name",
+	"Tailscale-User-Profile-Pic",
+}
+
+// AnalyticsTagRule records the value of a request header or query
+// parameter with each analytics event, as the tag "name:value", so traffic
+// can be broken down by it.
+type AnalyticsTagRule struct {
+	Name string `toml:"name"`
+	// Header and Query name the request header or query parameter read;
+	// exactly one is set.
+	Header string `toml:"header"`
+	Query  string `toml:"query"`
+	// Values, if set, are the only values recorded; others are ignored.
+	Values []string `toml:"values"`
+	// MaxLength cuts longer values. Zero uses DefaultAnalyticsTagLength.
+	MaxLength int `toml:"max_length"`
+}
+
+func validateAnalyticsTags(rules []AnalyticsTagRule) error {
+	if len(rules) > maxAnalyticsTagRules {
+		return fmt.Errorf("analytics_tags: at most %d rules are allowed, got %d", maxAnalyticsTagRules, len(rules))
+	}
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if !analyticsTagName.MatchString(rule.Name) || rule.Name == "tag" {
+			return fmt.Errorf("analytics_tags %d: 'name' must be 1-32 lowercase letters, digits, - or _, and not \"tag\", got %q", i, rule.Name)
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("analytics_tags %d: duplicate name %q", i, rule.Name)
+		}
+		seen[rule.Name] = true
+		if (rule.Header == "") == (rule.Query == "") {
+			return fmt.Errorf("analytics_tags %d: exactly one of 'header' or 'query' is required", i)
+		}
+		if slices.Contains(sensitiveHeaders, textproto.CanonicalMIMEHeaderKey(rule.Header)) {
+			return fmt.Errorf("analytics_tags %d: header %q cannot be recorded", i, rule.Header)
+		}
+		if rule.MaxLength < 0 || rule.MaxLength > 256 {
+			return fmt.Errorf("analytics_tags %d: 'max_length' must be between 0 and 256, got %d", i, rule.MaxLength)
+		}
+	}
+	return nil
+}
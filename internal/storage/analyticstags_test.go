@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSiteConfig_AnalyticsTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []AnalyticsTagRule
+		wantErr bool
+	}{
+		{"header", []AnalyticsTagRule{{Name: "campaign", Header: "X-Campaign"}}, false},
+		{"query with values", []AnalyticsTagRule{{Name: "utm_source", Query: "utm_source", Values: []string{"mail"}, MaxLength: 32}}, false},
+		{"missing name", []AnalyticsTagRule{{Header: "X-Campaign"}}, true},
+		{"uppercase name", []AnalyticsTagRule{{Name: "Campaign", Header: "X-Campaign"}}, true},
+		{"reserved name", []AnalyticsTagRule{{Name: "tag", Header: "X-Campaign"}}, true},
+		{"duplicate name", []AnalyticsTagRule{{Name: "c", Header: "X-A"}, {Name: "c", Query: "c"}}, true},
+		{"no source", []AnalyticsTagRule{{Name: "campaign"}}, true},
+		{"both sources", []AnalyticsTagRule{{Name: "campaign", Header: "X-Campaign", Query: "campaign"}}, true},
+		{"sensitive header", []AnalyticsTagRule{{Name: "auth", Header: "authorization"}}, true},
+		{"identity header", []AnalyticsTagRule{{Name: "user", Header: "Tailscale-User-Login"}}, true},
+		{"negative length", []AnalyticsTagRule{{Name: "campaign", Header: "X-Campaign", MaxLength: -1}}, true},
+		{"excessive length", []AnalyticsTagRule{{Name: "campaign", Header: "X-Campaign", MaxLength: 257}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SiteConfig{AnalyticsTags: tt.rules}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var many []AnalyticsTagRule
+	for i := range maxAnalyticsTagRules + 1 {
+		many = append(many, AnalyticsTagRule{Name: "t" + strings.Repeat("x", i), Query: "q"})
+	}
+	if err := (SiteConfig{AnalyticsTags: many}).Validate(); err == nil {
+		t.Error("Validate() accepted too many rules")
+	}
+}
+
+func TestSiteConfig_Merge_AnalyticsTags(t *testing.T) {
+	defaults := SiteConfig{AnalyticsTags: []AnalyticsTagRule{{Name: "campaign", Header: "X-Campaign"}}}
+
+	merged := SiteConfig{}.Merge(defaults)
+	if len(merged.AnalyticsTags) != 1 {
+		t.Errorf("AnalyticsTags = %+v, want the defaults", merged.AnalyticsTags)
+	}
+
+	merged = SiteConfig{AnalyticsTags: []AnalyticsTagRule{{Name: "ref", Query: "ref"}}}.Merge(defaults)
+	if len(merged.AnalyticsTags) != 1 || merged.AnalyticsTags[0].Name != "ref" {
+		t.Errorf("AnalyticsTags = %+v, want the site's rules", merged.AnalyticsTags)
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// siteArchiveManifest is the first entry of a site archive.
+const siteArchiveManifest = "site.json"
+
+// SiteArchiveInfo describes the site contained in a site archive.
+type SiteArchiveInfo struct {
+	Name               string    `json:"name"`
+	ActiveDeploymentID string    `json:"active_deployment_id,omitempty"`
+	ExportedAt         time.Time `json:"exported_at"`
+}
+
+// WriteDeploymentArchive streams a complete deployment to w as a gzipped tar
+// archive holding its manifest, file index, site config, and content. Status
+// markers are left out; ImportDeployment recreates them.
+func (s *Store) WriteDeploymentArchive(w io.Writer, site, id string) error {
+	if !s.DeploymentComplete(site, id) {
+		return ErrDeploymentNotFound
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := s.writeDeploymentTar(tw, "", site, id); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportDeployment creates a complete deployment from an archive written by
+// WriteDeploymentArchive. The deployment is not activated. Returns
+// ErrDeploymentExists if the ID is already taken; a partially extracted
+// deployment is removed on failure.
+func (s *Store) ImportDeployment(site, id string, r io.Reader) error {
+	if !ValidDeploymentID(id) {
+		return ErrDeploymentNotFound
+	}
+	dir, err := s.CreateDeployment(site, id)
+	if err != nil {
+		return err
+	}
+	var links []Symlink
+	err = readArchive(r, func(hdr *tar.Header, name string, body io.Reader) error {
+		if isStatusMarker(name) {
+			return nil
+		}
+		return writeArchiveEntry(dir, name, hdr, body, &links)
+	})
+	if err == nil {
+		err = CreateSymlinks(filepath.Join(dir, "content"), links)
+	}
+	if err == nil {
+		err = s.chain(site, id, ChainImported)
+	}
+	if err == nil {
+		err = s.MarkComplete(site, id)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// WriteSiteArchive writes a site and all its complete deployments to tw:
+// a site.json entry followed by each deployment under deployments/{id}/.
+// The caller owns tw and may add further entries before closing it.
+func (s *Store) WriteSiteArchive(tw *tar.Writer, site string) error {
+	info, err := s.GetSite(site)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(SiteArchiveInfo{
+		Name:               info.Name,
+		ActiveDeploymentID: info.ActiveDeploymentID,
+		ExportedAt:         time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     siteArchiveManifest,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	deps, err := s.ListDeployments(site)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		if !s.DeploymentComplete(site, d.ID) {
+			continue
+		}
+		if err := s.writeDeploymentTar(tw, "deployments/"+d.ID+"/", site, d.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportSiteArchive creates site from a gzipped tar archive written by
+// WriteSiteArchive, restoring all deployments and the active deployment.
+// The site may be given a different name than the one it was exported
+// under. Entries outside site.json and deployments/ are passed to extra,
+// which may be nil. Returns ErrSiteExists if the site already exists; on
+// any other failure the partially imported site is removed.
+func (s *Store) ImportSiteArchive(r io.Reader, site string, extra func(name string, body io.Reader) error) (SiteArchiveInfo, error) {
+	if err := s.CreateSite(site); err != nil {
+		return SiteArchiveInfo{}, err
+	}
+
+	var info SiteArchiveInfo
+	var seen bool
+	deployments := make(map[string]string)
+	links := make(map[string][]Symlink)
+	err := readArchive(r, func(hdr *tar.Header, name string, body io.Reader) error {
+		if name == siteArchiveManifest {
+			seen = true
+			return json.NewDecoder(body).Decode(&info)
+		}
+		rest, ok := strings.CutPrefix(filepath.ToSlash(name), "deployments/")
+		if !ok {
+			if extra != nil && hdr.Typeflag == tar.TypeReg {
+				return extra(name, body)
+			}
+			return nil
+		}
+		id, sub, _ := strings.Cut(rest, "/")
+		if !ValidDeploymentID(id) {
+			return fmt.Errorf("invalid deployment id in archive: %q", id)
+		}
+		dir, ok := deployments[id]
+		if !ok {
+			var err error
+			if dir, err = s.CreateDeployment(site, id); err != nil {
+				return err
+			}
+			deployments[id] = dir
+		}
+		if sub == "" || isStatusMarker(sub) {
+			return nil
+		}
+		l := links[id]
+		err := writeArchiveEntry(dir, filepath.FromSlash(sub), hdr, body, &l)
+		links[id] = l
+		return err
+	})
+	if err == nil && !seen {
+		err = errors.New("not a site archive: missing " + siteArchiveManifest)
+	}
+	for id, dir := range deployments {
+		if err != nil {
+			break
+		}
+		if err = CreateSymlinks(filepath.Join(dir, "content"), links[id]); err == nil {
+			err = s.chain(site, id, ChainImported)
+		}
+		if err == nil {
+			err = s.MarkComplete(site, id)
+		}
+	}
+	if err == nil && info.ActiveDeploymentID != "" {
+		if _, ok := deployments[info.ActiveDeploymentID]; ok {
+			err = s.ActivateDeployment(site, info.ActiveDeploymentID)
+		}
+	}
+	if err != nil {
+		s.DeleteSite(site)
+		return SiteArchiveInfo{}, err
+	}
+	return info, nil
+}
+
+// writeDeploymentTar adds a deployment's files to tw, naming entries with
+// prefix followed by their path relative to the deployment directory.
+func (s *Store) writeDeploymentTar(tw *tar.Writer, prefix, site, id string) error {
+	root := filepath.Join(s.dataDir, "sites", site, "deployments", id)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if isStatusMarker(rel) || rel == trashedMarker {
+			return nil
+		}
+		isLink := d.Type()&fs.ModeSymlink != 0
+		if !d.IsDir() && !d.Type().IsRegular() && !isLink {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if isLink {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() || isLink {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archiving deployment %s: %w", id, err)
+	}
+	return nil
+}
+
+// readArchive calls fn for every entry of a gzipped tar archive with the
+// entry's cleaned, relative name. Names that would escape the destination
+// are rejected here, so fn only sees safe paths.
+func readArchive(r io.Reader, fn func(hdr *tar.Header, name string, body io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid archive entry: %q", hdr.Name)
+		}
+		if err := fn(hdr, name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeArchiveEntry creates the directory or regular file described by hdr
+// at name inside dir. Symlinks in the deployment's content are appended to
+// links, to be created with CreateSymlinks once all files are written.
+// Other entry types are rejected.
+func writeArchiveEntry(dir, name string, hdr *tar.Header, body io.Reader, links *[]Symlink) error {
+	dest := filepath.Join(dir, name)
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		rel, ok := strings.CutPrefix(name, "content"+string(os.PathSeparator))
+		if !ok {
+			return fmt.Errorf("unsupported archive entry type %d: %q", hdr.Typeflag, hdr.Name)
+		}
+		*links = append(*links, Symlink{Name: rel, Target: hdr.Linkname})
+		return nil
+	case tar.TypeDir:
+		return os.MkdirAll(dest, 0755)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, body)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	default:
+		return fmt.Errorf("unsupported archive entry type %d: %q", hdr.Typeflag, hdr.Name)
+	}
+}
+
+// isStatusMarker reports whether name, relative to a deployment directory,
+// is one of the markers the store maintains itself. Pins are left out of
+// exports, so a replica never refuses an activation of its primary.
+func isStatusMarker(name string) bool {
+	return name == ".complete" || name == ".failed" || name == pinnedMarker || name == tamperedMarker
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeploymentArchive_RoundTrip(t *testing.T) {
+	src := New(t.TempDir())
+	src.CreateDeployment("docs", "aaa11111")
+	os.MkdirAll(filepath.Join(src.ContentDir("docs", "aaa11111"), "css"), 0755)
+	os.WriteFile(filepath.Join(src.ContentDir("docs", "aaa11111"), "index.html"), []byte("<h1>hi</h1>"), 0644)
+	os.WriteFile(filepath.Join(src.ContentDir("docs", "aaa11111"), "css", "site.css"), []byte("body{}"), 0644)
+	os.Symlink("css", filepath.Join(src.ContentDir("docs", "aaa11111"), "styles"))
+	src.WriteManifest("docs", "aaa11111", Manifest{Site: "docs", ID: "aaa11111", CreatedBy: "alice", CreatedAt: time.Now()})
+	src.MarkComplete("docs", "aaa11111")
+
+	var buf bytes.Buffer
+	if err := src.WriteDeploymentArchive(&buf, "docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := New(t.TempDir())
+	if err := dst.ImportDeployment("docs", "aaa11111", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.DeploymentComplete("docs", "aaa11111") {
+		t.Error("imported deployment should be complete")
+	}
+	data, err := os.ReadFile(filepath.Join(dst.ContentDir("docs", "aaa11111"), "css", "site.css"))
+	if err != nil || string(data) != "body{}" {
+		t.Errorf("site.css = %q, %v", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst.ContentDir("docs", "aaa11111"), "styles")); err != nil || target != "css" {
+		t.Errorf("styles links to %q, %v", target, err)
+	}
+	m, err := dst.ReadManifest("docs", "aaa11111")
+	if err != nil || m.CreatedBy != "alice" {
+		t.Errorf("manifest = %+v, %v", m, err)
+	}
+	if _, err := dst.CurrentDeployment("docs"); err == nil {
+		t.Error("imported deployment should not be activated")
+	}
+}
+
+func TestWriteDeploymentArchive_Incomplete(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	var buf bytes.Buffer
+	if err := s.WriteDeploymentArchive(&buf, "docs", "aaa11111"); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("got %v, want ErrDeploymentNotFound", err)
+	}
+}
+
+func TestImportDeployment_RejectsTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+
+	s := New(t.TempDir())
+	if err := s.ImportDeployment("docs", "aaa11111", &buf); err == nil {
+		t.Fatal("expected error for path traversal")
+	}
+	if _, err := os.Stat(filepath.Join(s.dataDir, "sites", "docs", "deployments", "aaa11111")); !os.IsNotExist(err) {
+		t.Error("partial deployment should be removed")
+	}
+}
+
+func writeTestSiteArchive(t *testing.T, s *Store, site string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := s.WriteSiteArchive(tw, site); err != nil {
+		t.Fatal(err)
+	}
+	tw.WriteHeader(&tar.Header{Name: "extra.txt", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("extra"))
+	tw.Close()
+	gz.Close()
+	return &buf
+}
+
+func TestSiteArchive_RoundTrip(t *testing.T) {
+	src := New(t.TempDir())
+	src.CreateSite("docs")
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		src.CreateDeployment("docs", id)
+		os.MkdirAll(src.ContentDir("docs", id), 0755)
+		os.WriteFile(filepath.Join(src.ContentDir("docs", id), "index.html"), []byte(id), 0644)
+		src.WriteManifest("docs", id, Manifest{Site: "docs", ID: id, CreatedAt: time.Now()})
+		src.MarkComplete("docs", id)
+	}
+	src.CreateDeployment("docs", "ccc33333") // incomplete, left out
+	src.ActivateDeployment("docs", "aaa11111")
+
+	buf := writeTestSiteArchive(t, src, "docs")
+
+	dst := New(t.TempDir())
+	var extra string
+	info, err := dst.ImportSiteArchive(buf, "handbook", func(name string, body io.Reader) error {
+		data, _ := io.ReadAll(body)
+		extra = name + ":" + string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "docs" || info.ActiveDeploymentID != "aaa11111" {
+		t.Errorf("info = %+v", info)
+	}
+	if extra != "extra.txt:extra" {
+		t.Errorf("extra = %q", extra)
+	}
+	if cur, _ := dst.CurrentDeployment("handbook"); cur != "aaa11111" {
+		t.Errorf("current = %q, want aaa11111", cur)
+	}
+	if !dst.DeploymentComplete("handbook", "bbb22222") {
+		t.Error("bbb22222 should be imported and complete")
+	}
+	if _, err := os.Stat(filepath.Join(dst.dataDir, "sites", "handbook", "deployments", "ccc33333")); !os.IsNotExist(err) {
+		t.Error("incomplete deployment should not be exported")
+	}
+	data, err := os.ReadFile(filepath.Join(dst.ContentDir("handbook", "bbb22222"), "index.html"))
+	if err != nil || string(data) != "bbb22222" {
+		t.Errorf("index.html = %q, %v", data, err)
+	}
+}
+
+func TestImportSiteArchive_Exists(t *testing.T) {
+	src := New(t.TempDir())
+	src.CreateSite("docs")
+	buf := writeTestSiteArchive(t, src, "docs")
+
+	dst := New(t.TempDir())
+	dst.CreateSite("docs")
+	if _, err := dst.ImportSiteArchive(buf, "docs", nil); !errors.Is(err, ErrSiteExists) {
+		t.Errorf("got %v, want ErrSiteExists", err)
+	}
+	if _, err := dst.GetSite("docs"); err != nil {
+		t.Error("existing site should be left alone")
+	}
+}
+
+func TestImportSiteArchive_NotASiteArchive(t *testing.T) {
+	src := New(t.TempDir())
+	src.CreateDeployment("docs", "aaa11111")
+	src.MarkComplete("docs", "aaa11111")
+	var buf bytes.Buffer
+	src.WriteDeploymentArchive(&buf, "docs", "aaa11111")
+
+	dst := New(t.TempDir())
+	if _, err := dst.ImportSiteArchive(&buf, "docs", nil); err == nil {
+		t.Fatal("expected error for deployment archive")
+	}
+	if _, err := dst.GetSite("docs"); err == nil {
+		t.Error("partially imported site should be removed")
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrSiteArchived is returned for changes to an archived site's deployments.
+var ErrSiteArchived = errors.New("site is archived")
+
+// archivedMarker is the file in a site directory that marks it archived.
+const archivedMarker = ".archived"
+
+// ArchiveState describes an archived site. Archived sites keep serving their
+// active deployment but refuse deploys and deletions until unarchived.
+type ArchiveState struct {
+	ArchivedAt time.Time `json:"archived_at"`
+	ArchivedBy string    `json:"archived_by,omitempty"`
+	// Banner injects a notice at the top of every HTML page.
+	Banner bool `json:"banner"`
+	// Message replaces the default banner text.
+	Message string `json:"message,omitempty"`
+}
+
+// ArchiveSite marks a site archived, replacing any earlier archive state.
+func (s *Store) ArchiveSite(site string, state ArchiveState) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	dir := filepath.Join(s.dataDir, "sites", site)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	if state.ArchivedAt.IsZero() {
+		state.ArchivedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, archivedMarker), data, 0644)
+}
+
+// UnarchiveSite clears a site's archive state. Unarchiving a site that is
+// not archived is a no-op.
+func (s *Store) UnarchiveSite(site string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	err := os.Remove(filepath.Join(s.dataDir, "sites", site, archivedMarker))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadArchiveState returns a site's archive state and whether it is
+// archived. A marker that cannot be parsed still counts as archived.
+func (s *Store) ReadArchiveState(site string) (ArchiveState, bool) {
+	if !ValidSiteName(site) {
+		return ArchiveState{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, archivedMarker))
+	if err != nil {
+		return ArchiveState{}, false
+	}
+	var state ArchiveState
+	json.Unmarshal(data, &state) //nolint:errcheck // a damaged marker still archives
+	return state, true
+}
+
+// SiteArchived reports whether a site is archived.
+func (s *Store) SiteArchived(site string) bool {
+	_, archived := s.ReadArchiveState(site)
+	return archived
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestArchiveSite(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	if s.SiteArchived("docs") {
+		t.Fatal("new site is archived")
+	}
+	if err := s.ArchiveSite("docs", ArchiveState{ArchivedBy: "Alice", Banner: true, Message: "Retired"}); err != nil {
+		t.Fatal(err)
+	}
+	state, ok := s.ReadArchiveState("docs")
+	if !ok || state.ArchivedBy != "Alice" || !state.Banner || state.Message != "Retired" || state.ArchivedAt.IsZero() {
+		t.Errorf("state = %+v, archived = %v", state, ok)
+	}
+
+	if err := s.UnarchiveSite("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if s.SiteArchived("docs") {
+		t.Error("site still archived")
+	}
+	if err := s.UnarchiveSite("docs"); err != nil {
+		t.Errorf("unarchiving twice: %v", err)
+	}
+}
+
+func TestArchiveSite_NotFound(t *testing.T) {
+	s := New(t.TempDir())
+	if err := s.ArchiveSite("missing", ArchiveState{}); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
+
+func TestArchiveSite_BlocksChanges(t *testing.T) {
+	s := New(t.TempDir())
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		s.CreateDeployment("docs", id)
+		s.MarkComplete("docs", id)
+	}
+	s.ActivateDeployment("docs", "aaa11111")
+	s.ArchiveSite("docs", ArchiveState{})
+
+	if _, err := s.CreateDeployment("docs", "ccc33333"); !errors.Is(err, ErrSiteArchived) {
+		t.Errorf("CreateDeployment: err = %v", err)
+	}
+	if err := s.ActivateDeployment("docs", "bbb22222"); !errors.Is(err, ErrSiteArchived) {
+		t.Errorf("ActivateDeployment: err = %v", err)
+	}
+	if err := s.TrashDeployment("docs", "bbb22222"); !errors.Is(err, ErrSiteArchived) {
+		t.Errorf("TrashDeployment: err = %v", err)
+	}
+	if _, err := s.DeleteInactiveDeployments("docs"); !errors.Is(err, ErrSiteArchived) {
+		t.Errorf("DeleteInactiveDeployments: err = %v", err)
+	}
+	if err := s.TrashSite("docs"); !errors.Is(err, ErrSiteArchived) {
+		t.Errorf("TrashSite: err = %v", err)
+	}
+	if id, _ := s.CurrentDeployment("docs"); id != "aaa11111" {
+		t.Errorf("active deployment = %q", id)
+	}
+
+	s.UnarchiveSite("docs")
+	if err := s.TrashDeployment("docs", "bbb22222"); err != nil {
+		t.Errorf("after unarchive: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Limits on build metadata, which CI systems send with deployments.
+const (
+	maxCommitLen   = 64
+	maxBranchLen   = 255
+	maxBuildURLLen = 2048
+)
+
+// BuildInfo describes the CI build a deployment came from, so it can link
+// back to the commit and the run that produced it.
+type BuildInfo struct {
+	Commit   string `json:"commit,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	BuildURL string `json:"build_url,omitempty"`
+}
+
+// IsZero reports whether b records nothing.
+func (b BuildInfo) IsZero() bool { return b == BuildInfo{} }
+
+// ShortCommit returns the commit abbreviated to 7 characters, as git does.
+func (b BuildInfo) ShortCommit() string {
+	if len(b.Commit) > 7 {
+		return b.Commit[:7]
+	}
+	return b.Commit
+}
+
+// Validate checks that b is safe to store and show: a commit of letters,
+// digits, dots, hyphens, and underscores, a branch without control
+// characters, and an http or https build URL.
+func (b BuildInfo) Validate() error {
+	if len(b.Commit) > maxCommitLen || strings.ContainsFunc(b.Commit, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_')
+	}) {
+		return fmt.Errorf("commit: must be at most %d letters, digits, dots, hyphens, and underscores, got %q", maxCommitLen, b.Commit)
+	}
+	if len(b.Branch) > maxBranchLen || strings.ContainsFunc(b.Branch, unicode.IsControl) {
+		return fmt.Errorf("branch: must be at most %d characters without control characters", maxBranchLen)
+	}
+	if b.BuildURL != "" {
+		u, err := url.Parse(b.BuildURL)
+		if err != nil || len(b.BuildURL) > maxBuildURLLen || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("build_url: must be an http or https URL of at most %d characters, got %q", maxBuildURLLen, b.BuildURL)
+		}
+	}
+	return nil
+}
+
+// CommitRange spans the commits between the deployment before another one
+// and that deployment, so their sources can be compared.
+type CommitRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// CompareURL is the site's compare_url with both commits filled in.
+	CompareURL string `json:"compare_url,omitempty"`
+}
+
+// NewCommitRange returns the range from the commit of prev to that of next,
+// with the {from} and {to} placeholders of compareURL filled in if it is
+// set. It returns nil unless both name a commit and the commits differ.
+func NewCommitRange(prev, next *BuildInfo, compareURL string) *CommitRange {
+	if prev == nil || next == nil || prev.Commit == "" || next.Commit == "" || prev.Commit == next.Commit {
+		return nil
+	}
+	r := &CommitRange{From: prev.Commit, To: next.Commit}
+	if compareURL != "" {
+		r.CompareURL = strings.NewReplacer(
+			"{from}", url.PathEscape(r.From),
+			"{to}", url.PathEscape(r.To),
+		).Replace(compareURL)
+	}
+	return r
+}
+
+// String returns the range in git's notation, with abbreviated commits.
+func (r CommitRange) String() string {
+	return BuildInfo{Commit: r.From}.ShortCommit() + ".." + BuildInfo{Commit: r.To}.ShortCommit()
+}
+
+// SetCommitRanges sets the commit range of each of deployments, sorted
+// newest first, to the next older one that did not fail.
+func SetCommitRanges(deployments []DeploymentInfo, compareURL string) {
+	for i := range deployments {
+		for j := i + 1; j < len(deployments); j++ {
+			if !deployments[j].Failed {
+				deployments[i].CommitRange = NewCommitRange(deployments[j].Build, deployments[i].Build, compareURL)
+				break
+			}
+		}
+	}
+}
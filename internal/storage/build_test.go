@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildInfo_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   BuildInfo
+		wantErr bool
+	}{
+		{"empty", BuildInfo{}, false},
+		{"full", BuildInfo{Commit: "4f2a9c1e0b7d", Branch: "feature/login", BuildURL: "https://ci.example.com/runs/42"}, false},
+		{"svn revision", BuildInfo{Commit: "r1234"}, false},
+		{"commit with space", BuildInfo{Commit: "4f2a 9c1e"}, true},
+		{"commit with markup", BuildInfo{Commit: "<b>"}, true},
+		{"commit too long", BuildInfo{Commit: strings.Repeat("a", 65)}, true},
+		{"branch with newline", BuildInfo{Branch: "main\nX-Evil: 1"}, true},
+		{"branch too long", BuildInfo{Branch: strings.Repeat("a", 256)}, true},
+		{"javascript URL", BuildInfo{BuildURL: "javascript:alert(1)"}, true},
+		{"relative URL", BuildInfo{BuildURL: "/runs/42"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.build.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildInfo_ShortCommit(t *testing.T) {
+	if got := (BuildInfo{Commit: "4f2a9c1e0b7d"}).ShortCommit(); got != "4f2a9c1" {
+		t.Errorf("ShortCommit() = %q, want 4f2a9c1", got)
+	}
+	if got := (BuildInfo{Commit: "r12"}).ShortCommit(); got != "r12" {
+		t.Errorf("ShortCommit() = %q, want r12", got)
+	}
+}
+
+func TestNewCommitRange(t *testing.T) {
+	prev := &BuildInfo{Commit: "1111111aaaa"}
+	next := &BuildInfo{Commit: "2222222bbbb"}
+
+	r := NewCommitRange(prev, next, "https://github.com/org/repo/compare/{from}...{to}")
+	if r == nil || r.From != prev.Commit || r.To != next.Commit {
+		t.Fatalf("range = %+v", r)
+	}
+	if r.CompareURL != "https://github.com/org/repo/compare/1111111aaaa...2222222bbbb" {
+		t.Errorf("compare URL = %q", r.CompareURL)
+	}
+	if got := r.String(); got != "1111111..2222222" {
+		t.Errorf("String() = %q", got)
+	}
+
+	if r := NewCommitRange(prev, next, ""); r == nil || r.CompareURL != "" {
+		t.Errorf("range without compare URL = %+v", r)
+	}
+	for name, pair := range map[string][2]*BuildInfo{
+		"no previous build": {nil, next},
+		"no commit":         {{Branch: "main"}, next},
+		"same commit":       {next, next},
+	} {
+		if r := NewCommitRange(pair[0], pair[1], ""); r != nil {
+			t.Errorf("%s: range = %+v, want nil", name, r)
+		}
+	}
+}
+
+func TestSetCommitRanges(t *testing.T) {
+	deployments := []DeploymentInfo{
+		{ID: "c", Build: &BuildInfo{Commit: "ccc"}},
+		{ID: "f", Failed: true, Build: &BuildInfo{Commit: "fff"}},
+		{ID: "b", Build: &BuildInfo{Commit: "bbb"}},
+		{ID: "x"},
+		{ID: "a", Build: &BuildInfo{Commit: "aaa"}},
+	}
+	SetCommitRanges(deployments, "")
+
+	if r := deployments[0].CommitRange; r == nil || r.From != "bbb" || r.To != "ccc" {
+		t.Errorf("range of c = %+v, want failed deployment skipped", r)
+	}
+	if r := deployments[2].CommitRange; r != nil {
+		t.Errorf("range of b = %+v, want none after a deployment without commit", r)
+	}
+	if r := deployments[4].CommitRange; r != nil {
+		t.Errorf("range of oldest = %+v", r)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cachePolicyFile holds the cache policies of a deployment's files, next to
+// its file index. Archives carry it along, so replicas cache as the primary
+// does.
+const cachePolicyFile = "cache.json"
+
+// CachePolicy is how one file of a deployment may be cached. It is worked
+// out from the site config when the deployment is activated, so browsers,
+// replicas, and in-memory caches all decide the same way.
+type CachePolicy struct {
+	// CacheControl is the Cache-Control header sent to visitors.
+	CacheControl string `json:"cache_control"`
+	// SurrogateControl is the Surrogate-Control header the config sets for
+	// the file. It is meant for caches in between and never sent to
+	// visitors.
+	SurrogateControl string `json:"surrogate_control,omitempty"`
+	// MaxAge is how many seconds a shared cache may serve the file without
+	// revalidating it.
+	MaxAge int `json:"max_age"`
+	// NoStore forbids shared caches to keep the file.
+	NoStore bool `json:"no_store,omitempty"`
+	// Immutable marks files that never change under their path, such as
+	// assets with a content hash in their name.
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// NewCachePolicy derives the policy of a file served with the given
+// Cache-Control and Surrogate-Control headers. For shared caches,
+// Surrogate-Control takes precedence over Cache-Control, whose s-maxage
+// takes precedence over its max-age.
+func NewCachePolicy(cacheControl, surrogateControl string) CachePolicy {
+	p := CachePolicy{CacheControl: cacheControl, SurrogateControl: surrogateControl}
+	cc := cacheDirectives(cacheControl)
+	_, p.Immutable = cc["immutable"]
+
+	if sc := cacheDirectives(surrogateControl); len(sc) > 0 {
+		_, p.NoStore = sc["no-store"]
+		if !p.NoStore {
+			p.MaxAge = directiveSeconds(sc["max-age"])
+		}
+		return p
+	}
+
+	_, noStore := cc["no-store"]
+	_, private := cc["private"]
+	_, noCache := cc["no-cache"]
+	p.NoStore = noStore || private
+	switch {
+	case p.NoStore || noCache:
+	case cc["s-maxage"] != "":
+		p.MaxAge = directiveSeconds(cc["s-maxage"])
+	default:
+		p.MaxAge = directiveSeconds(cc["max-age"])
+	}
+	return p
+}
+
+// cacheDirectives parses a Cache-Control style header into its directives,
+// keyed by lowercase name, with unquoted values.
+func cacheDirectives(header string) map[string]string {
+	directives := make(map[string]string)
+	for d := range strings.SplitSeq(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return directives
+}
+
+// directiveSeconds parses a delta-seconds value, treating invalid or
+// negative values as 0.
+func directiveSeconds(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// WriteCachePolicies persists the cache policies of a deployment's files,
+// keyed by path as in the file index.
+func (s *Store) WriteCachePolicies(site, id string, policies map[string]CachePolicy) error {
+	if !ValidDeploymentID(id) {
+		return ErrDeploymentNotFound
+	}
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return fmt.Errorf("marshal cache policies: %w", err)
+	}
+	path := filepath.Join(s.dataDir, "sites", site, "deployments", id, cachePolicyFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadCachePolicies reads the cache policies stored when the deployment was
+// last activated. Returns os.ErrNotExist if it never was.
+func (s *Store) ReadCachePolicies(site, id string) (map[string]CachePolicy, error) {
+	if !ValidDeploymentID(id) {
+		return nil, ErrDeploymentNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, cachePolicyFile))
+	if err != nil {
+		return nil, err
+	}
+	var policies map[string]CachePolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("parse cache policies: %w", err)
+	}
+	return policies, nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNewCachePolicy(t *testing.T) {
+	tests := []struct {
+		cacheControl, surrogateControl string
+		want                           CachePolicy
+	}{
+		{"public, max-age=31536000, immutable", "", CachePolicy{MaxAge: 31536000, Immutable: true}},
+		{"public, no-cache, stale-while-revalidate=60", "", CachePolicy{}},
+		{"public, max-age=60, s-maxage=3600", "", CachePolicy{MaxAge: 3600}},
+		{"private, max-age=60", "", CachePolicy{NoStore: true}},
+		{"no-store", "", CachePolicy{NoStore: true}},
+		{`public, Max-Age="120"`, "", CachePolicy{MaxAge: 120}},
+		{"public, max-age=-5", "", CachePolicy{}},
+		// Surrogate-Control decides for shared caches.
+		{"public, no-cache", "max-age=600", CachePolicy{MaxAge: 600}},
+		{"public, max-age=600", "no-store", CachePolicy{NoStore: true}},
+	}
+	for _, tt := range tests {
+		tt.want.CacheControl, tt.want.SurrogateControl = tt.cacheControl, tt.surrogateControl
+		if got := NewCachePolicy(tt.cacheControl, tt.surrogateControl); got != tt.want {
+			t.Errorf("NewCachePolicy(%q, %q) = %+v, want %+v", tt.cacheControl, tt.surrogateControl, got, tt.want)
+		}
+	}
+}
+
+func TestCachePolicies_RoundTrip(t *testing.T) {
+	s := New(t.TempDir())
+	if _, err := s.CreateDeployment("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadCachePolicies("docs", "aaa11111"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("before write: err = %v, want ErrNotExist", err)
+	}
+
+	policies := map[string]CachePolicy{
+		"index.html":      NewCachePolicy("public, no-cache", ""),
+		"app.1a2b3c4d.js": NewCachePolicy("public, max-age=31536000, immutable", ""),
+	}
+	if err := s.WriteCachePolicies("docs", "aaa11111", policies); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.ReadCachePolicies("docs", "aaa11111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, policies) {
+		t.Errorf("got %+v, want %+v", got, policies)
+	}
+}
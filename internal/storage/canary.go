@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// canaryFile is the file in a site directory holding its canary state.
+const canaryFile = "canary.json"
+
+// CanaryState describes a canary: a share of a site's visitors is served a
+// candidate deployment instead of the active one, to compare the two before
+// activating the candidate.
+type CanaryState struct {
+	DeploymentID string `json:"deployment_id"`
+	// Percent is the share of visitors, from 1 to 99, served the candidate.
+	Percent   int       `json:"percent"`
+	StartedAt time.Time `json:"started_at"`
+	StartedBy string    `json:"started_by,omitempty"`
+}
+
+// StartCanary makes state the site's canary, replacing any earlier one. The
+// candidate must be a complete deployment that is not active, and pinned if
+// the site has pinned deployments. Activating any deployment ends the
+// canary.
+func (s *Store) StartCanary(site string, state CanaryState) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if state.Percent < 1 || state.Percent > 99 {
+		return fmt.Errorf("canary percent must be between 1 and 99, got %d", state.Percent)
+	}
+	if s.SiteArchived(site) {
+		return ErrSiteArchived
+	}
+	if !ValidDeploymentID(state.DeploymentID) || !s.DeploymentComplete(site, state.DeploymentID) {
+		return ErrDeploymentNotFound
+	}
+	if current, _ := s.CurrentDeployment(site); current == state.DeploymentID {
+		return ErrActiveDeployment
+	}
+	if err := s.checkPins(site, state.DeploymentID); err != nil {
+		return err
+	}
+	if state.StartedAt.IsZero() {
+		state.StartedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dataDir, "sites", site, canaryFile), data, 0644)
+}
+
+// StopCanary ends a site's canary. Stopping a site without one is a no-op.
+func (s *Store) StopCanary(site string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	err := os.Remove(filepath.Join(s.dataDir, "sites", site, canaryFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadCanary returns a site's canary state and whether it has one.
+func (s *Store) ReadCanary(site string) (CanaryState, bool) {
+	if !ValidSiteName(site) {
+		return CanaryState{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, canaryFile))
+	if err != nil {
+		return CanaryState{}, false
+	}
+	var state CanaryState
+	if err := json.Unmarshal(data, &state); err != nil || state.DeploymentID == "" {
+		return CanaryState{}, false
+	}
+	return state, true
+}
+
+// canaryDeployment returns the ID of the site's canary candidate, or "".
+func (s *Store) canaryDeployment(site string) string {
+	state, _ := s.ReadCanary(site)
+	return state.DeploymentID
+}
+
+// stopCanaryOf ends the site's canary if id is its candidate.
+func (s *Store) stopCanaryOf(site, id string) error {
+	if s.canaryDeployment(site) != id {
+		return nil
+	}
+	return s.StopCanary(site)
+}
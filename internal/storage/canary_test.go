@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func canarySite(t *testing.T) *Store {
+	t.Helper()
+	s := New(t.TempDir())
+	for _, id := range []string{"aaa11111", "bbb22222", "ccc33333"} {
+		s.CreateDeployment("docs", id)
+		s.MarkComplete("docs", id)
+	}
+	s.ActivateDeployment("docs", "aaa11111")
+	return s
+}
+
+func TestCanary(t *testing.T) {
+	s := canarySite(t)
+	if _, ok := s.ReadCanary("docs"); ok {
+		t.Fatal("new site has a canary")
+	}
+	if err := s.StartCanary("docs", CanaryState{DeploymentID: "bbb22222", Percent: 10, StartedBy: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	state, ok := s.ReadCanary("docs")
+	if !ok || state.DeploymentID != "bbb22222" || state.Percent != 10 || state.StartedAt.IsZero() {
+		t.Errorf("state = %+v, ok = %v", state, ok)
+	}
+
+	// Cleanups keep the candidate like the active deployment.
+	if n, err := s.DeleteInactiveDeployments("docs"); err != nil || n != 1 {
+		t.Errorf("DeleteInactiveDeployments = %d, %v, want 1", n, err)
+	}
+	if !s.DeploymentComplete("docs", "bbb22222") {
+		t.Error("canary candidate was deleted")
+	}
+
+	if err := s.StopCanary("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.ReadCanary("docs"); ok {
+		t.Error("canary still running")
+	}
+	if err := s.StopCanary("docs"); err != nil {
+		t.Errorf("stopping twice: %v", err)
+	}
+}
+
+func TestCanary_EndedByActivationAndDeletion(t *testing.T) {
+	s := canarySite(t)
+	s.StartCanary("docs", CanaryState{DeploymentID: "bbb22222", Percent: 50})
+	s.ActivateDeployment("docs", "bbb22222")
+	if _, ok := s.ReadCanary("docs"); ok {
+		t.Error("activation did not end the canary")
+	}
+
+	s.StartCanary("docs", CanaryState{DeploymentID: "ccc33333", Percent: 50})
+	if err := s.TrashDeployment("docs", "ccc33333"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.ReadCanary("docs"); ok {
+		t.Error("deleting the candidate did not end the canary")
+	}
+}
+
+func TestStartCanary_Rejects(t *testing.T) {
+	s := canarySite(t)
+	for _, tt := range []struct {
+		name  string
+		state CanaryState
+		want  error
+	}{
+		{"active deployment", CanaryState{DeploymentID: "aaa11111", Percent: 10}, ErrActiveDeployment},
+		{"missing deployment", CanaryState{DeploymentID: "ddd44444", Percent: 10}, ErrDeploymentNotFound},
+	} {
+		if err := s.StartCanary("docs", tt.state); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	for _, percent := range []int{0, 100} {
+		if err := s.StartCanary("docs", CanaryState{DeploymentID: "bbb22222", Percent: percent}); err == nil {
+			t.Errorf("percent %d accepted", percent)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// chainFile holds a site's deployment chain, one JSON entry per line, in
+// the site directory. Unlike the deployments it lists, it is never
+// trimmed, so it also records deployments that were deleted since.
+const chainFile = "chain.jsonl"
+
+// ChainGenesis is the previous hash of the first entry of every chain.
+var ChainGenesis = strings.Repeat("0", sha256.Size*2)
+
+// Reasons for a chain entry.
+const (
+	// ChainDeployed records a deployment that completed.
+	ChainDeployed = "deployed"
+	// ChainImported records a deployment imported from an archive, such as
+	// one copied from a primary. Its manifest keeps the previous hash it
+	// had where it was deployed.
+	ChainImported = "imported"
+	// ChainErased records that a deployment's manifest was rewritten to
+	// erase personal data of its deployer.
+	ChainErased = "erased"
+)
+
+// ChainEntry is a single entry of a site's deployment chain. Its hash
+// covers the hash of the entry before it, so no entry can be changed,
+// removed, or inserted without changing the hash of every entry after it.
+type ChainEntry struct {
+	DeploymentID string    `json:"deployment_id"`
+	Time         time.Time `json:"time"`
+	Reason       string    `json:"reason"`
+	// ManifestHash is the SHA-256 hash of the deployment's manifest.json,
+	// empty for an imported deployment that has none.
+	ManifestHash string `json:"manifest_hash,omitempty"`
+	// FilesHash is the SHA-256 hash of the deployment's file index, which
+	// in turn holds the hash of every file.
+	FilesHash string `json:"files_hash,omitempty"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+// sum returns the hash of e, computed from its other fields.
+func (e ChainEntry) sum() string {
+	h := sha256.New()
+	for _, field := range []string{e.PrevHash, e.DeploymentID, e.Time.UTC().Format(time.RFC3339Nano), e.Reason, e.ManifestHash, e.FilesHash} {
+		h.Write([]byte(field))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChainDeployment adds a deployment to the deployment chain of site: its
+// manifest records the chain's current head as PrevHash, and a new entry
+// records the hashes of its manifest and file index. Call it before the
+// deployment is marked complete; a deployment that is chained already is
+// left alone.
+func (s *Store) ChainDeployment(site, id string) error {
+	return s.chain(site, id, ChainDeployed)
+}
+
+// chain adds a deployment to the deployment chain of site for reason,
+// which is ChainDeployed or ChainImported. Only deployed manifests are
+// rewritten to link to the chain.
+func (s *Store) chain(site, id, reason string) error {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return fmt.Errorf("invalid site or deployment: %q/%q", site, id)
+	}
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	entries, err := s.readChain(site)
+	if err != nil {
+		return err
+	}
+	head := ChainGenesis
+	for _, e := range entries {
+		if e.DeploymentID == id {
+			return nil
+		}
+		head = e.Hash
+	}
+
+	if reason == ChainDeployed {
+		m, err := s.ReadManifest(site, id)
+		if err != nil {
+			return fmt.Errorf("manifest: %w", err)
+		}
+		m.PrevHash = head
+		if err := s.WriteManifest(site, id, m); err != nil {
+			return err
+		}
+	}
+	return s.appendChain(site, id, reason, head, entries)
+}
+
+// rechainManifest records in the chain of site that the manifest of a
+// chained deployment was rewritten for reason. Deployments that are not
+// chained are left alone.
+func (s *Store) rechainManifest(site, id, reason string) error {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	entries, err := s.readChain(site)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	chained := false
+	for _, e := range entries {
+		chained = chained || e.DeploymentID == id
+	}
+	if !chained {
+		return nil
+	}
+	return s.appendChain(site, id, reason, entries[len(entries)-1].Hash, entries)
+}
+
+// appendChain adds an entry for the current manifest and file index of a
+// deployment to the chain of site, which holds entries and ends in head.
+// The chain is replaced as a whole, so a crash never leaves half an entry.
+func (s *Store) appendChain(site, id, reason, head string, entries []ChainEntry) error {
+	e := ChainEntry{DeploymentID: id, Time: time.Now().UTC(), Reason: reason, PrevHash: head}
+	var err error
+	if e.ManifestHash, err = s.hashDeploymentFile(site, id, "manifest.json"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("hashing manifest: %w", err)
+	}
+	if e.FilesHash, err = s.hashDeploymentFile(site, id, "files.json"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("hashing file index: %w", err)
+	}
+	e.Hash = e.sum()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range append(entries, e) {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Join(s.dataDir, "sites", site)
+	tmp := filepath.Join(dir, chainFile+".tmp")
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := syncPath(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, chainFile)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// hashDeploymentFile returns the hex SHA-256 hash of a file in the
+// directory of a deployment.
+func (s *Store) hashDeploymentFile(site, id, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, name))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// errChainLine is returned by readChain for a line that cannot be parsed.
+var errChainLine = errors.New("unreadable chain entry")
+
+// readChain returns the deployment chain of site, oldest entry first.
+func (s *Store) readChain(site string) ([]ChainEntry, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, chainFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []ChainEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e ChainEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w on line %d", errChainLine, line)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading chain: %w", err)
+	}
+	return entries, nil
+}
+
+// ChainProblem is a way in which a site's deployments disagree with its
+// deployment chain.
+type ChainProblem struct {
+	// Entry is the 1-based position of the entry the problem was found
+	// in, or 0 for problems with a deployment.
+	Entry        int    `json:"entry,omitempty"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+	Problem      string `json:"problem"`
+}
+
+// ChainReport is the result of verifying a site's deployment chain.
+type ChainReport struct {
+	Site string `json:"site"`
+	// Valid reports whether no problems were found.
+	Valid bool `json:"valid"`
+	// Head is the hash of the last entry. Recording it elsewhere, such as
+	// in an audit log, lets a later verification prove that the entries up
+	// to it were not rewritten since.
+	Head    string `json:"head"`
+	Entries int    `json:"entries"`
+	// Verified is the number of chained deployments still on disk whose
+	// manifest and file index match their latest entry.
+	Verified int            `json:"verified"`
+	Problems []ChainProblem `json:"problems"`
+	// Unchained lists complete deployments the chain does not hold, such
+	// as ones made before deployments were chained.
+	Unchained []string `json:"unchained"`
+}
+
+// VerifyChain checks the deployment chain of site: every entry's hash and
+// its link to the entry before it, and for every complete deployment that
+// is chained, that its manifest and file index still match the latest
+// entry about it and that a deployed manifest links to the chain's head at
+// the time it was added. Deployments that were deleted since they were chained
+// are not reported.
+func (s *Store) VerifyChain(site string) (ChainReport, error) {
+	if !ValidSiteName(site) {
+		return ChainReport{}, fmt.Errorf("invalid site name: %q", site)
+	}
+	report := ChainReport{Site: site, Head: ChainGenesis, Problems: []ChainProblem{}, Unchained: []string{}}
+	s.chainMu.Lock()
+	entries, err := s.readChain(site)
+	s.chainMu.Unlock()
+	if errors.Is(err, errChainLine) {
+		report.Problems = append(report.Problems, ChainProblem{Problem: err.Error()})
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+
+	type chained struct{ first, latest ChainEntry }
+	deployments := make(map[string]*chained)
+	for i, e := range entries {
+		problem := func(msg string) {
+			report.Problems = append(report.Problems, ChainProblem{Entry: i + 1, DeploymentID: e.DeploymentID, Problem: msg})
+		}
+		if e.PrevHash != report.Head {
+			problem("previous hash does not match the entry before it")
+		}
+		if e.sum() != e.Hash {
+			problem("hash does not match the entry")
+		}
+		report.Head = e.Hash
+
+		d := deployments[e.DeploymentID]
+		added := e.Reason == ChainDeployed || e.Reason == ChainImported
+		switch {
+		case added && d != nil:
+			problem("deployment was chained before")
+		case added:
+			deployments[e.DeploymentID] = &chained{first: e, latest: e}
+		case d == nil:
+			problem("amends a deployment that was not chained")
+		default:
+			d.latest = e
+		}
+	}
+	report.Entries = len(entries)
+
+	dirs, err := os.ReadDir(filepath.Join(s.dataDir, "sites", site, "deployments"))
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, dir := range dirs {
+		id := dir.Name()
+		if !dir.IsDir() || !s.DeploymentComplete(site, id) {
+			continue
+		}
+		problem := func(msg string) {
+			report.Problems = append(report.Problems, ChainProblem{DeploymentID: id, Problem: msg})
+		}
+		m, err := s.ReadManifest(site, id)
+		if err != nil {
+			problem("manifest cannot be read: " + err.Error())
+			continue
+		}
+		d := deployments[id]
+		if d == nil {
+			// Deployments made since are always chained, so an unchained one
+			// that links to a chain was removed from it.
+			if m.PrevHash != "" {
+				problem("manifest is chained, but the chain does not hold it")
+			} else {
+				report.Unchained = append(report.Unchained, id)
+			}
+			continue
+		}
+		ok := true
+		if hash, _ := s.hashDeploymentFile(site, id, "manifest.json"); hash != d.latest.ManifestHash {
+			problem("manifest changed since it was chained")
+			ok = false
+		}
+		if hash, _ := s.hashDeploymentFile(site, id, "files.json"); hash != d.latest.FilesHash {
+			problem("file index changed since it was chained")
+			ok = false
+		}
+		if d.first.Reason == ChainDeployed && m.PrevHash != d.first.PrevHash {
+			problem("manifest links to a different previous hash than its entry")
+			ok = false
+		}
+		if ok {
+			report.Verified++
+		}
+	}
+	report.Valid = len(report.Problems) == 0
+	return report, nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chainedSite returns a store whose docs site has the given deployments,
+// each deployed and chained in order.
+func chainedSite(t *testing.T, ids ...string) *Store {
+	t.Helper()
+	s := New(t.TempDir())
+	for _, id := range ids {
+		if _, err := s.CreateDeployment("docs", id); err != nil {
+			t.Fatal(err)
+		}
+		s.WriteManifest("docs", id, Manifest{Site: "docs", ID: id, CreatedBy: "Alice"})
+		s.WriteFileIndex("docs", id, []FileInfo{{Path: "index.html", Size: 5}})
+		if err := s.ChainDeployment("docs", id); err != nil {
+			t.Fatal(err)
+		}
+		s.MarkComplete("docs", id)
+	}
+	return s
+}
+
+func verifyChain(t *testing.T, s *Store) ChainReport {
+	t.Helper()
+	report, err := s.VerifyChain("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestChainDeployment(t *testing.T) {
+	s := chainedSite(t, "aaa11111", "bbb22222")
+	entries, err := s.readChain("docs")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	first, _ := s.ReadManifest("docs", "aaa11111")
+	second, _ := s.ReadManifest("docs", "bbb22222")
+	if first.PrevHash != ChainGenesis || second.PrevHash != entries[0].Hash {
+		t.Errorf("manifest links = %q, %q", first.PrevHash, second.PrevHash)
+	}
+
+	// Chaining again, say after a crash before the deployment was marked
+	// complete, adds nothing.
+	if err := s.ChainDeployment("docs", "bbb22222"); err != nil {
+		t.Fatal(err)
+	}
+	report := verifyChain(t, s)
+	if !report.Valid || report.Entries != 2 || report.Verified != 2 || report.Head != entries[1].Hash {
+		t.Errorf("report = %+v", report)
+	}
+
+	// Deleting a deployment leaves the chain valid.
+	if err := s.DeleteDeployment("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+	if report := verifyChain(t, s); !report.Valid || report.Verified != 1 {
+		t.Errorf("after deleting, report = %+v", report)
+	}
+}
+
+func TestVerifyChain_DetectsRewrites(t *testing.T) {
+	for name, tamper := range map[string]func(s *Store){
+		"manifest": func(s *Store) {
+			m, _ := s.ReadManifest("docs", "aaa11111")
+			m.CreatedBy = "Mallory"
+			s.WriteManifest("docs", "aaa11111", m)
+		},
+		"file index": func(s *Store) {
+			s.WriteFileIndex("docs", "bbb22222", []FileInfo{{Path: "index.html", Size: 6}})
+		},
+		"entry": func(s *Store) {
+			file := filepath.Join(s.dataDir, "sites", "docs", chainFile)
+			data, _ := os.ReadFile(file)
+			os.WriteFile(file, []byte(strings.Replace(string(data), "aaa11111", "ccc33333", 1)), 0644)
+		},
+		"dropped entry": func(s *Store) {
+			file := filepath.Join(s.dataDir, "sites", "docs", chainFile)
+			data, _ := os.ReadFile(file)
+			first, _, _ := strings.Cut(string(data), "\n")
+			os.WriteFile(file, []byte(first+"\n"), 0644)
+		},
+		"removed chain": func(s *Store) {
+			os.Remove(filepath.Join(s.dataDir, "sites", "docs", chainFile))
+		},
+	} {
+		s := chainedSite(t, "aaa11111", "bbb22222")
+		tamper(s)
+		if report := verifyChain(t, s); report.Valid || len(report.Problems) == 0 {
+			t.Errorf("%s: rewrite not detected: %+v", name, report)
+		}
+	}
+}
+
+func TestVerifyChain_Erasure(t *testing.T) {
+	s := chainedSite(t, "aaa11111", "bbb22222")
+	if _, err := s.EraseUser("alice@example.com", []string{"Alice"}, "erased-0123"); err != nil {
+		t.Fatal(err)
+	}
+	report := verifyChain(t, s)
+	if !report.Valid || report.Entries != 4 || report.Verified != 2 {
+		t.Errorf("report after erasure = %+v", report)
+	}
+}
+
+func TestVerifyChain_Unchained(t *testing.T) {
+	s := chainedSite(t, "bbb22222")
+	s.CreateDeployment("docs", "aaa11111")
+	s.WriteManifest("docs", "aaa11111", Manifest{Site: "docs", ID: "aaa11111"})
+	s.MarkComplete("docs", "aaa11111")
+
+	report := verifyChain(t, s)
+	if !report.Valid || len(report.Unchained) != 1 || report.Unchained[0] != "aaa11111" {
+		t.Errorf("report = %+v", report)
+	}
+}
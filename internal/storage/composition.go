@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"cmp"
+	"path"
+	"slices"
+	"strings"
+)
+
+// File kinds a deployment's size is broken down by.
+const (
+	KindHTML   = "html"
+	KindCSS    = "css"
+	KindJS     = "js"
+	KindImages = "images"
+	KindFonts  = "fonts"
+	KindOther  = "other"
+)
+
+// FileKind returns the kind of the file at p by its extension: one of
+// KindHTML, KindCSS, KindJS, KindImages, KindFonts, or KindOther.
+func FileKind(p string) string {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".html", ".htm":
+		return KindHTML
+	case ".css":
+		return KindCSS
+	case ".js", ".mjs", ".cjs", ".map", ".wasm":
+		return KindJS
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico", ".bmp":
+		return KindImages
+	case ".woff", ".woff2", ".ttf", ".otf", ".eot":
+		return KindFonts
+	}
+	return KindOther
+}
+
+// KindSize is the number and total size of a deployment's files of a kind.
+type KindSize struct {
+	Kind  string `json:"kind"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Composition is what a deployment's size is made of, worked out from the
+// file index recorded when it was extracted.
+type Composition struct {
+	// Kinds are the sizes per file kind, largest first.
+	Kinds []KindSize `json:"kinds"`
+	// Largest are the largest files, largest first.
+	Largest []FileInfo `json:"largest"`
+	// PrecompressedBytes is the size of the files that were precompressed,
+	// and CompressedBytes that of their smallest variants.
+	PrecompressedBytes int64 `json:"precompressed_bytes,omitempty"`
+	CompressedBytes    int64 `json:"compressed_bytes,omitempty"`
+}
+
+// Compose breaks files down by kind and lists the largest n of them.
+func Compose(files []FileInfo, n int) Composition {
+	var c Composition
+	byKind := make(map[string]*KindSize)
+	for _, f := range files {
+		kind := FileKind(f.Path)
+		ks, ok := byKind[kind]
+		if !ok {
+			ks = &KindSize{Kind: kind}
+			byKind[kind] = ks
+		}
+		ks.Files++
+		ks.Bytes += f.Size
+		if f.CompressedSize > 0 {
+			c.PrecompressedBytes += f.Size
+			c.CompressedBytes += f.CompressedSize
+		}
+	}
+	for _, ks := range byKind {
+		c.Kinds = append(c.Kinds, *ks)
+	}
+	slices.SortFunc(c.Kinds, func(a, b KindSize) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Kind, b.Kind))
+	})
+
+	c.Largest = slices.Clone(files)
+	slices.SortStableFunc(c.Largest, func(a, b FileInfo) int { return cmp.Compare(b.Size, a.Size) })
+	c.Largest = c.Largest[:min(n, len(c.Largest))]
+	return c
+}
+
+// CompressionSavings returns the percentage by which precompression shrank
+// the precompressed files, or 0 if none were.
+func (c Composition) CompressionSavings() int {
+	if c.PrecompressedBytes == 0 {
+		return 0
+	}
+	return int(100 - c.CompressedBytes*100/c.PrecompressedBytes)
+}
@@ -0,0 +1,62 @@
+package storage
+
+import "testing"
+
+func TestFileKind(t *testing.T) {
+	for p, want := range map[string]string{
+		"index.html":            KindHTML,
+		"docs/page.HTM":         KindHTML,
+		"assets/app.css":        KindCSS,
+		"assets/app.js":         KindJS,
+		"assets/app.js.map":     KindJS,
+		"img/logo.svg":          KindImages,
+		"img/photo.JPEG":        KindImages,
+		"fonts/inter.woff2":     KindFonts,
+		"robots.txt":            KindOther,
+		"downloads/archive.zip": KindOther,
+		"LICENSE":               KindOther,
+	} {
+		if got := FileKind(p); got != want {
+			t.Errorf("FileKind(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	c := Compose([]FileInfo{
+		{Path: "index.html", Size: 1000, CompressedSize: 300},
+		{Path: "about.html", Size: 500},
+		{Path: "app.js", Size: 4000, CompressedSize: 1000},
+		{Path: "hero.png", Size: 9000},
+		{Path: "font.woff2", Size: 2000},
+	}, 3)
+
+	want := []KindSize{
+		{Kind: KindImages, Files: 1, Bytes: 9000},
+		{Kind: KindJS, Files: 1, Bytes: 4000},
+		{Kind: KindFonts, Files: 1, Bytes: 2000},
+		{Kind: KindHTML, Files: 2, Bytes: 1500},
+	}
+	if len(c.Kinds) != len(want) {
+		t.Fatalf("kinds = %+v", c.Kinds)
+	}
+	for i := range want {
+		if c.Kinds[i] != want[i] {
+			t.Errorf("kinds[%d] = %+v, want %+v", i, c.Kinds[i], want[i])
+		}
+	}
+
+	if len(c.Largest) != 3 || c.Largest[0].Path != "hero.png" || c.Largest[1].Path != "app.js" || c.Largest[2].Path != "font.woff2" {
+		t.Errorf("largest = %+v", c.Largest)
+	}
+
+	if c.PrecompressedBytes != 5000 || c.CompressedBytes != 1300 {
+		t.Errorf("precompressed = %d, compressed = %d", c.PrecompressedBytes, c.CompressedBytes)
+	}
+	if got := c.CompressionSavings(); got != 74 {
+		t.Errorf("savings = %d%%, want 74%%", got)
+	}
+	if got := (Composition{}).CompressionSavings(); got != 0 {
+		t.Errorf("savings without precompression = %d%%", got)
+	}
+}
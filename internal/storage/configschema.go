@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// siteConfigSchemaDocs adds descriptions, defaults, and the constraints
+// Validate checks to the JSON Schema of SiteConfig. Keys are setting paths
+// as in tspages.toml, with "[]" for the items of an array and ".*" for the
+// values of a table with arbitrary keys.
+var siteConfigSchemaDocs = map[string]map[string]any{
+	"public": {
+		"description": "Make the site publicly accessible via Tailscale Funnel. Requires the funnel node attribute.",
+		"default":     false,
+	},
+	"spa_routing": {
+		"description": "Serve the index page instead of 404 for unresolved paths.",
+		"default":     false,
+	},
+	"html_extensions": {
+		"description": "Disable clean URLs and keep .html in paths.",
+		"default":     false,
+	},
+	"analytics": {
+		"description": "Record analytics for the site.",
+		"default":     true,
+	},
+	"analytics_notice": {
+		"description": "Show visitors a notice that access is recorded, with an opt-out button.",
+		"default":     false,
+	},
+	"directory_listing": {
+		"description": "List the files of directories without an index page.",
+		"default":     false,
+	},
+	"i18n": {
+		"description": "Serve localized documents based on the Accept-Language header.",
+		"default":     false,
+	},
+	"minify": {
+		"description": "Minify HTML, CSS, and JavaScript at deploy time.",
+		"default":     false,
+	},
+	"offline": {
+		"description": "Register a service worker that keeps the site readable while the visitor is offline.",
+		"default":     false,
+	},
+	"indexable": {
+		"description": "Let search engines index the site while it is public, instead of sending noindex and a robots.txt that disallows crawling.",
+		"default":     false,
+	},
+	"staging": {
+		"description": "Mark the site as a staging copy: HTML pages show a staging ribbon, and search engines are kept out even if it is indexable.",
+		"default":     false,
+	},
+	"default_language": {
+		"description": "Language tag of the unsuffixed documents, such as \"en\".",
+		"pattern":     "^[A-Za-z]{1,8}(-[A-Za-z0-9]{1,8})*$",
+	},
+	"index_page": {
+		"description": "File served for directory paths.",
+		"default":     "index.html",
+	},
+	"not_found_page": {
+		"description": "Custom 404 page. Falls back to a built-in page if the file is missing.",
+		"default":     "404.html",
+	},
+	"trailing_slash": {
+		"description": "Add or remove trailing slashes; empty leaves paths as they are.",
+		"enum":        []string{"", "add", "remove"},
+	},
+	"transfer_cap_mb": {
+		"description": "Soft monthly transfer cap in MiB; 0 disables it.",
+		"minimum":     0,
+	},
+	"anomaly_factor": {
+		"description": "Alert when requests or the server error rate deviate this many times from the baseline; 0 disables it.",
+		"not":         map[string]any{"enum": []int{1}},
+		"minimum":     0,
+	},
+	"analytics_sample_rate": {
+		"description": "Record one in this many asset requests, counting each as that many; HTML pages are always recorded. 0 or 1 records all.",
+		"minimum":     0,
+	},
+	"headers": {
+		"description":   "Custom response headers keyed by path pattern, such as \"/*.js\".",
+		"propertyNames": map[string]any{"pattern": "^/"},
+	},
+	"headers.*.*": {
+		"minLength": 1,
+	},
+	"redirects": {
+		"description": "Redirect rules, evaluated first-match.",
+	},
+	"redirects[]": {
+		"required": []string{"from", "to"},
+	},
+	"redirects[].from": {
+		"description": "Path pattern with :named segments and a * splat.",
+		"pattern":     "^/",
+	},
+	"redirects[].to": {
+		"description": "Target path or full URL. Named segments and * of from are substituted.",
+		"pattern":     "^(/|https?://)",
+	},
+	"redirects[].status": {
+		"description": "Redirect status.",
+		"enum":        []int{301, 302},
+		"default":     301,
+	},
+	"access": {
+		"description": "Restrictions of paths to specific users, tagged devices, or capability levels.",
+	},
+	"access[]": {
+		"required": []string{"path"},
+		"anyOf": []map[string]any{
+			{"required": []string{"users"}},
+			{"required": []string{"tags"}},
+			{"required": []string{"access"}},
+		},
+	},
+	"access[].path": {
+		"description": "Path pattern; \"/dir/*\" also covers \"/dir\" itself.",
+		"pattern":     "^/",
+	},
+	"access[].users": {
+		"description": "Login names; * matches any characters.",
+	},
+	"access[].tags": {
+		"description": "Tags of the visiting device.",
+	},
+	"access[].tags[]": {
+		"pattern": "^tag:",
+	},
+	"access[].access": {
+		"description": "Minimum capability level for the site.",
+		"enum":        []string{"view", "deploy", "admin"},
+	},
+	"schedule": {
+		"description": "Time windows outside of which paths are not found, to publish and unpublish content at a time.",
+	},
+	"schedule[]": {
+		"required": []string{"path"},
+		"anyOf": []map[string]any{
+			{"required": []string{"visible_from"}},
+			{"required": []string{"visible_until"}},
+		},
+	},
+	"schedule[].path": {
+		"description": "Path pattern; \"/dir/*\" also covers \"/dir\" itself.",
+		"pattern":     "^/",
+	},
+	"schedule[].visible_from": {
+		"description": "Date and time from which the paths are published.",
+	},
+	"schedule[].visible_until": {
+		"description": "Date and time from which the paths are no longer published.",
+	},
+	"webhook_url": {
+		"description": "URL to receive webhook notifications for the site.",
+		"pattern":     "^https?://",
+	},
+	"webhook_events": {
+		"description": "Events to notify; all of them when empty.",
+	},
+	"webhook_events[]": {
+		"enum": webhookEvents,
+	},
+	"webhook_secret": {
+		"description": "HMAC secret for signing webhook payloads.",
+	},
+	"webhook_quiet_hours": {
+		"description": "Daily period, such as \"22:00-07:00\", during which webhooks that are not critical are held back and sent together once it ends.",
+		"pattern":     "^\\d{2}:\\d{2}\\s*-\\s*\\d{2}:\\d{2}$",
+	},
+	"webhook_timezone": {
+		"description": "IANA timezone of webhook_quiet_hours; UTC when empty.",
+	},
+	"webhook_rate_limit": {
+		"description": "Most webhooks sent per minute; further ones are sent together once the minute is over. 0 disables the limit.",
+		"minimum":     0,
+	},
+	"validation": {
+		"description": "Rules the uploaded files must pass.",
+	},
+	"validation.max_files": {
+		"description": "Maximum number of files; 0 means no limit.",
+		"minimum":     0,
+	},
+	"validation.max_file_size_mb": {
+		"description": "Maximum size of a single file in MiB; 0 means no limit.",
+		"minimum":     0,
+	},
+	"validation.block_dotfiles": {
+		"description": "Reject files and directories whose name starts with a dot, except .well-known.",
+	},
+	"validation.block_executables": {
+		"description": "Reject native executables and libraries.",
+	},
+	"validation.blocked_paths": {
+		"description": "Glob patterns matched against each file's path and name.",
+	},
+	"validation.allowed_extensions": {
+		"description": "The only extensions allowed, with the leading dot; \"\" allows files without one.",
+	},
+	"analytics_tags": {
+		"description": "Request headers or query parameters recorded as analytics tags.",
+		"maxItems":    maxAnalyticsTagRules,
+	},
+	"analytics_tags[]": {
+		"required": []string{"name"},
+		"oneOf": []map[string]any{
+			{"required": []string{"header"}},
+			{"required": []string{"query"}},
+		},
+	},
+	"analytics_tags[].name": {
+		"description": "Name of the tag, recorded as \"name:value\".",
+		"pattern":     analyticsTagName.String(),
+		"not":         map[string]any{"const": "tag"},
+	},
+	"analytics_tags[].header": {
+		"description": "Request header to read. Credentials and identity headers cannot be recorded.",
+		"minLength":   1,
+	},
+	"analytics_tags[].query": {
+		"description": "Query parameter to read.",
+		"minLength":   1,
+	},
+	"analytics_tags[].values": {
+		"description": "The only values recorded; any value when empty.",
+	},
+	"analytics_tags[].max_length": {
+		"description": "Length values are cut to; 0 uses the default.",
+		"minimum":     0,
+		"maximum":     256,
+		"default":     DefaultAnalyticsTagLength,
+	},
+	"ephemeral": {
+		"description": "Register the site's node as ephemeral, so the tailnet removes it soon after it goes offline.",
+		"default":     false,
+	},
+	"advertise_tags": {
+		"description": "ACL tags the site's node advertises, such as \"tag:pages-public\". The auth key must be allowed to use them.",
+	},
+	"advertise_tags[]": {
+		"pattern": "^tag:.+",
+	},
+	"hostname_prefix": {
+		"description": "Prepended to the site name to form the node's hostname.",
+		"pattern":     "^[a-z0-9][a-z0-9-]*$",
+	},
+	"hostname_suffix": {
+		"description": "Appended to the site name to form the node's hostname.",
+		"pattern":     "^[a-z0-9-]*[a-z0-9]$",
+	},
+	"listen_ports": {
+		"description": "Additional ports the site serves HTTPS on, on the tailnet only.",
+	},
+	"listen_ports[]": {
+		"minimum": 1,
+		"maximum": 65535,
+		"not":     map[string]any{"enum": []int{80, 443}},
+	},
+	"http_redirect": {
+		"description": "Listen for plain HTTP on port 80 and redirect it to HTTPS.",
+		"default":     false,
+	},
+	"ip_family": {
+		"description": "Accept connections only to the node's IPv4 or IPv6 address; empty accepts both.",
+		"enum":        []string{"", "ipv4", "ipv6"},
+	},
+	"max_connections": {
+		"description": "Most open connections the site's server keeps; requests over it get a 503. 0 disables the cap.",
+		"minimum":     0,
+	},
+	"max_concurrent_requests": {
+		"description": "Most requests the site's server handles at once; requests over it get a 503. 0 disables the cap.",
+		"minimum":     0,
+	},
+	"compare_url": {
+		"description": "URL comparing two commits of the site's source, with {from} and {to} placeholders, linked between deployments built from them.",
+		"pattern":     "^https?://",
+	},
+	"security_headers": {
+		"description": "Preset of security headers sent under the custom headers: \"strict\", \"relaxed\", or \"off\".",
+		"enum":        []string{"", SecurityHeadersStrict, SecurityHeadersRelaxed, SecurityHeadersOff},
+	},
+	"download_min_kb": {
+		"description": "Count responses with a non-HTML file of at least this many KiB, sent in full, as downloads; 0 counts none.",
+		"minimum":     0,
+	},
+	"purge_webhooks": {
+		"description": "Requests that purge external caches in front of the site when a deployment is activated.",
+	},
+	"purge_webhooks[]": {
+		"required": []string{"type", "url"},
+	},
+	"purge_webhooks[].type": {
+		"description": "Kind of purge; \"http-purge\" sends an HTTP request per changed path.",
+		"enum":        []string{PurgeWebhookHTTP},
+	},
+	"purge_webhooks[].method": {
+		"description": "Request method; PURGE when empty.",
+		"pattern":     "^[A-Z]+$",
+	},
+	"purge_webhooks[].url": {
+		"description": "URL template with {site} and {path} placeholders; with {path}, one request is sent per added, changed, or removed path.",
+		"pattern":     "^https?://",
+	},
+	"purge_webhooks[].auth_header": {
+		"description": "Header sent with each request, such as \"Authorization: Bearer <token>\".",
+	},
+	"social_previews": {
+		"description": "Open Graph and Twitter card meta tags added to HTML pages by path, for link previews.",
+		"maxItems":    maxSocialPreviews,
+	},
+	"social_previews[]": {
+		"required": []string{"path"},
+	},
+	"social_previews[].path": {
+		"description": "Pages the rule applies to: \"/*\", \"/*.ext\", \"/dir/*\", or an exact path.",
+		"pattern":     "^/",
+	},
+	"social_previews[].title": {
+		"description": "og:title and twitter:title.",
+		"maxLength":   200,
+	},
+	"social_previews[].description": {
+		"description": "og:description and twitter:description.",
+		"maxLength":   1000,
+	},
+	"social_previews[].image": {
+		"description": "og:image and twitter:image: an http(s) URL, or a path on the site.",
+		"pattern":     "^(/|https?://)",
+	},
+	"social_previews[].type": {
+		"description": "og:type, such as \"article\"; \"website\" when empty.",
+		"pattern":     "^[a-z._]+$",
+	},
+	"disabled_stages": {
+		"description": "Stages of the serving pipeline that requests skip; auth cannot be disabled.",
+	},
+	"disabled_stages[]": {
+		"enum": ServeStages[1:],
+	},
+}
+
+// SiteConfigSchema returns a JSON Schema of tspages.toml, generated from
+// SiteConfig, for editors to validate and complete site configs with.
+func SiteConfigSchema() map[string]any {
+	schema := typeSchema(reflect.TypeFor[SiteConfig](), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "tspages.toml"
+	schema["description"] = "Per-site configuration of a tspages deployment."
+	return schema
+}
+
+// typeSchema returns the schema of values of type t, found at path in
+// tspages.toml.
+func typeSchema(t reflect.Type, path string) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var schema map[string]any
+	switch t.Kind() {
+	case reflect.Bool:
+		schema = map[string]any{"type": "boolean"}
+	case reflect.String:
+		schema = map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema = map[string]any{"type": "integer"}
+	case reflect.Slice:
+		schema = map[string]any{"type": "array", "items": typeSchema(t.Elem(), path+"[]")}
+	case reflect.Map:
+		schema = map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), path+".*")}
+	case reflect.Struct:
+		if t == reflect.TypeFor[time.Time]() {
+			// TOML dates and times, which editors check as strings.
+			schema = map[string]any{"type": "string", "format": "date-time"}
+			break
+		}
+		props := make(map[string]any)
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+			if name == "" || name == "-" || !f.IsExported() {
+				continue
+			}
+			key := name
+			if path != "" {
+				key = path + "." + name
+			}
+			props[name] = typeSchema(f.Type, key)
+		}
+		schema = map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		schema = map[string]any{}
+	}
+	maps.Copy(schema, siteConfigSchemaDocs[path])
+	return schema
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// schemaPaths returns the setting paths of schema and its sub-schemas,
+// named as in siteConfigSchemaDocs.
+func schemaPaths(schema map[string]any, path string, paths map[string]bool) {
+	paths[path] = true
+	if props, ok := schema["properties"].(map[string]any); ok {
+		for name, sub := range props {
+			key := name
+			if path != "" {
+				key = path + "." + name
+			}
+			schemaPaths(sub.(map[string]any), key, paths)
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		schemaPaths(items, path+"[]", paths)
+	}
+	if values, ok := schema["additionalProperties"].(map[string]any); ok {
+		schemaPaths(values, path+".*", paths)
+	}
+}
+
+func TestSiteConfigSchema_DocsMatchFields(t *testing.T) {
+	schema := SiteConfigSchema()
+	paths := make(map[string]bool)
+	schemaPaths(schema, "", paths)
+	for key := range siteConfigSchemaDocs {
+		if !paths[key] {
+			t.Errorf("siteConfigSchemaDocs has %q, which is not a SiteConfig setting", key)
+		}
+	}
+	for name, prop := range schema["properties"].(map[string]any) {
+		if _, ok := prop.(map[string]any)["description"]; !ok {
+			t.Errorf("setting %q has no description", name)
+		}
+	}
+}
+
+func TestSiteConfigSchema(t *testing.T) {
+	data, err := json.Marshal(SiteConfigSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Type                 string `json:"type"`
+		AdditionalProperties bool   `json:"additionalProperties"`
+		Properties           struct {
+			Public        map[string]any `json:"public"`
+			TransferCapMB map[string]any `json:"transfer_cap_mb"`
+			Redirects     struct {
+				Items struct {
+					Required   []string `json:"required"`
+					Properties struct {
+						Status struct {
+							Enum []int `json:"enum"`
+						} `json:"status"`
+					} `json:"properties"`
+				} `json:"items"`
+			} `json:"redirects"`
+			Headers struct {
+				AdditionalProperties struct {
+					Type                 string         `json:"type"`
+					AdditionalProperties map[string]any `json:"additionalProperties"`
+				} `json:"additionalProperties"`
+			} `json:"headers"`
+			WebhookEvents struct {
+				Items struct {
+					Enum []string `json:"enum"`
+				} `json:"items"`
+			} `json:"webhook_events"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	p := schema.Properties
+	if schema.Type != "object" || schema.AdditionalProperties {
+		t.Errorf("root = %s, additionalProperties %v; want a closed object", schema.Type, schema.AdditionalProperties)
+	}
+	if p.Public["type"] != "boolean" || p.TransferCapMB["type"] != "integer" {
+		t.Errorf("public = %v, transfer_cap_mb = %v", p.Public, p.TransferCapMB)
+	}
+	if len(p.Redirects.Items.Required) != 2 || len(p.Redirects.Items.Properties.Status.Enum) != 2 {
+		t.Errorf("redirects = %+v", p.Redirects)
+	}
+	if p.Headers.AdditionalProperties.Type != "object" || p.Headers.AdditionalProperties.AdditionalProperties["type"] != "string" {
+		t.Errorf("headers = %+v, want a table of tables of strings", p.Headers)
+	}
+	if len(p.WebhookEvents.Items.Enum) != len(webhookEvents) {
+		t.Errorf("webhook_events enum = %v", p.WebhookEvents.Items.Enum)
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const configSnapshotFile = "config-snapshot.json"
+
+// redacted replaces secrets in config snapshots.
+const redacted = "[redacted]"
+
+// ConfigSnapshot is the config a deployment was last activated with: its
+// tspages.toml merged with the server defaults in effect at the time.
+type ConfigSnapshot struct {
+	DeploymentID string    `json:"deployment_id"`
+	ActivatedAt  time.Time `json:"activated_at"`
+	// Config is keyed by tspages.toml names, with webhook_secret redacted.
+	Config map[string]any `json:"config"`
+}
+
+// ConfigMap returns c keyed by its tspages.toml names, as it is shown in
+// snapshots and webhook payloads, with webhook_secret redacted.
+func (c SiteConfig) ConfigMap() (map[string]any, error) {
+	if c.WebhookSecret != "" {
+		c.WebhookSecret = redacted
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteConfigSnapshot records merged as the config deployment id of site
+// was activated with now, replacing the snapshot of an earlier activation.
+func (s *Store) WriteConfigSnapshot(site, id string, merged SiteConfig) error {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return ErrDeploymentNotFound
+	}
+	m, err := merged.ConfigMap()
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	data, err := json.Marshal(ConfigSnapshot{DeploymentID: id, ActivatedAt: time.Now().UTC(), Config: m})
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, "sites", site, "deployments", id, configSnapshotFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// ReadConfigSnapshot returns the config deployment id of site was last
+// activated with. Returns os.ErrNotExist if it was not activated since
+// snapshots were recorded.
+func (s *Store) ReadConfigSnapshot(site, id string) (ConfigSnapshot, error) {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return ConfigSnapshot{}, ErrDeploymentNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, configSnapshotFile))
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	var snapshot ConfigSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return ConfigSnapshot{}, fmt.Errorf("parse config snapshot: %w", err)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigSnapshot(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	if _, err := s.ReadConfigSnapshot("docs", "aaa11111"); !os.IsNotExist(err) {
+		t.Fatalf("before activation: err = %v, want not exist", err)
+	}
+
+	spa := true
+	cfg := SiteConfig{
+		SPARouting:    &spa,
+		IndexPage:     "home.html",
+		WebhookURL:    "https://hooks.example.com/x",
+		WebhookSecret: "whsec_abc",
+		Headers:       map[string]map[string]string{"/*": {"X-Frame-Options": "DENY"}},
+	}
+	if err := s.WriteConfigSnapshot("docs", "aaa11111", cfg); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := s.ReadConfigSnapshot("docs", "aaa11111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.DeploymentID != "aaa11111" || snapshot.ActivatedAt.IsZero() {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+	c := snapshot.Config
+	if c["spa_routing"] != true || c["index_page"] != "home.html" || c["webhook_secret"] != redacted {
+		t.Errorf("config = %v", c)
+	}
+	if headers, _ := c["headers"].(map[string]any); headers["/*"] == nil {
+		t.Errorf("headers = %v", c["headers"])
+	}
+	if _, ok := c["public"]; ok {
+		t.Error("unset settings should be left out")
+	}
+
+	if _, err := s.ReadConfigSnapshot("docs", "../../x"); err == nil {
+		t.Error("expected error for an invalid deployment ID")
+	}
+}
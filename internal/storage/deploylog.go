@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// deployLogFile holds a deployment's log as JSON Lines, next to its
+// manifest.
+const deployLogFile = "deploy.log"
+
+// DeployLogEntry is one step recorded while a deployment was processed.
+type DeployLogEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"msg"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// WriteDeployLog replaces the log of a deployment with entries.
+func (s *Store) WriteDeployLog(site, id string, entries []DeployLogEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("marshal deploy log: %w", err)
+		}
+	}
+	path := filepath.Join(s.dataDir, "sites", site, "deployments", id, deployLogFile)
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReadDeployLog returns the log of a deployment. Returns os.ErrNotExist for
+// deployments made before deploy logs were kept.
+func (s *Store) ReadDeployLog(site, id string) ([]DeployLogEntry, error) {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return nil, ErrDeploymentNotFound
+	}
+	path := filepath.Join(s.dataDir, "sites", site, "deployments", id, deployLogFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []DeployLogEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e DeployLogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("parse deploy log: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read deploy log: %w", err)
+	}
+	return entries, nil
+}
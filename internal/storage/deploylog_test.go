@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteReadDeployLog(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "abc12345")
+
+	now := time.Now().Truncate(time.Second)
+	entries := []DeployLogEntry{
+		{Time: now, Level: "INFO", Message: "upload received", Attrs: map[string]any{"bytes": 2048}},
+		{Time: now, Level: "ERROR", Message: "invalid _headers"},
+	}
+	if err := s.WriteDeployLog("docs", "abc12345", entries); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got, err := s.ReadDeployLog("docs", "abc12345")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if got[0].Message != "upload received" || got[0].Attrs["bytes"] != float64(2048) {
+		t.Errorf("entry 0 = %+v", got[0])
+	}
+	if got[1].Level != "ERROR" || got[1].Attrs != nil {
+		t.Errorf("entry 1 = %+v", got[1])
+	}
+	if !got[0].Time.Equal(now) {
+		t.Errorf("time = %v, want %v", got[0].Time, now)
+	}
+}
+
+func TestReadDeployLog_Missing(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "abc12345")
+	if _, err := s.ReadDeployLog("docs", "abc12345"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v, want os.ErrNotExist", err)
+	}
+	if _, err := s.ReadDeployLog("docs", ".."); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Fatalf("got %v, want ErrDeploymentNotFound", err)
+	}
+}
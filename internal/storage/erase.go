@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Erasure counts what EraseUser changed.
+type Erasure struct {
+	Manifests       int `json:"manifests"`
+	ActivityEntries int `json:"activity_entries"`
+	Shares          int `json:"shares"`
+	SavedFilters    int `json:"saved_filters"`
+	Preferences     int `json:"preferences"`
+	// Sites are the sites whose manifests changed, for refreshing caches
+	// of them.
+	Sites []string `json:"-"`
+}
+
+// EraseUser replaces a user's identity with token wherever the store keeps
+// it: the deployer of manifests, the actor of activity log entries, and
+// the creator and revoker of shares. The user is matched by login or any
+// of names, such as the display names they deployed under. Their saved
+// filters and preferences, which are keyed by login, are deleted.
+//
+// Pins, archive states, and canaries keep the name they were set by;
+// sites in the trash are left alone until they are purged.
+func (s *Store) EraseUser(login string, names []string, token string) (Erasure, error) {
+	var e Erasure
+	if login == "" {
+		return e, fmt.Errorf("erasing a user requires a login name")
+	}
+	match := func(name string) bool {
+		return name != "" && (name == login || slices.Contains(names, name))
+	}
+
+	n, err := s.eraseActivity(s.dataDir, match, token)
+	if err != nil {
+		return e, err
+	}
+	e.ActivityEntries += n
+
+	sites, err := s.ListSites()
+	if err != nil {
+		return e, err
+	}
+	for _, site := range sites {
+		dir := filepath.Join(s.dataDir, "sites", site.Name)
+		n, err := s.eraseActivity(dir, match, token)
+		if err != nil {
+			return e, fmt.Errorf("erasing activity of %s: %w", site.Name, err)
+		}
+		e.ActivityEntries += n
+
+		if n, err = s.eraseManifests(site.Name, match, token); err != nil {
+			return e, fmt.Errorf("erasing manifests of %s: %w", site.Name, err)
+		}
+		if n > 0 {
+			e.Manifests += n
+			e.Sites = append(e.Sites, site.Name)
+		}
+
+		if n, err = s.eraseShares(site.Name, match, token); err != nil {
+			return e, fmt.Errorf("erasing shares of %s: %w", site.Name, err)
+		}
+		e.Shares += n
+	}
+
+	s.filtersMu.Lock()
+	filters, err := s.readFilters()
+	if err == nil && len(filters[login]) > 0 {
+		e.SavedFilters = len(filters[login])
+		delete(filters, login)
+		err = s.writeFilters(filters)
+	}
+	s.filtersMu.Unlock()
+	if err != nil {
+		return e, err
+	}
+
+	prefs, err := s.Preferences(login)
+	if err != nil {
+		return e, err
+	}
+	if prefs != (Preferences{}) {
+		if err := s.SetPreferences(login, Preferences{}); err != nil {
+			return e, err
+		}
+		e.Preferences = 1
+	}
+	return e, nil
+}
+
+// eraseActivity rewrites the activity log in dir, replacing each actor
+// that matches with token, and returns the number of entries changed.
+// Lines that cannot be parsed are kept as they are.
+func (s *Store) eraseActivity(dir string, match func(string) bool, token string) (int, error) {
+	s.activityMu.Lock()
+	defer s.activityMu.Unlock()
+	file := filepath.Join(dir, activityFile)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var out bytes.Buffer
+	changed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e ActivityEntry
+		if json.Unmarshal(line, &e) == nil && match(e.Actor) {
+			e.Actor = token
+			if line, err = json.Marshal(e); err != nil {
+				return 0, err
+			}
+			changed++
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("reading activity: %w", err)
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	return changed, os.Rename(tmp, file)
+}
+
+// eraseManifests replaces the deployer of the manifests of site that match
+// with token, dropping their avatar, and returns the number changed. The
+// rewritten manifests are recorded in the site's deployment chain.
+func (s *Store) eraseManifests(site string, match func(string) bool, token string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, "sites", site, "deployments"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		m, err := s.ReadManifest(site, entry.Name())
+		if err != nil || !match(m.CreatedBy) {
+			continue
+		}
+		m.CreatedBy = token
+		m.CreatedByAvatar = ""
+		if err := s.WriteManifest(site, entry.Name(), m); err != nil {
+			return changed, err
+		}
+		if err := s.rechainManifest(site, entry.Name(), ChainErased); err != nil {
+			return changed, fmt.Errorf("chaining erased manifest: %w", err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// eraseShares replaces the creator and revoker of the shares of site that
+// match with token, and returns the number of shares changed.
+func (s *Store) eraseShares(site string, match func(string) bool, token string) (int, error) {
+	s.sharesMu.Lock()
+	defer s.sharesMu.Unlock()
+	shares, err := s.readShares(site)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for i := range shares {
+		sh := &shares[i]
+		creator, revoker := match(sh.CreatedBy), match(sh.RevokedBy)
+		if creator {
+			sh.CreatedBy = token
+		}
+		if revoker {
+			sh.RevokedBy = token
+		}
+		if creator || revoker {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, s.writeShares(site, shares)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEraseUser(t *testing.T) {
+	s := New(t.TempDir())
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		if _, err := s.CreateDeployment("docs", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.WriteManifest("docs", "aaa11111", Manifest{Site: "docs", ID: "aaa11111", CreatedBy: "Alice", CreatedByAvatar: "https://example.com/a.png"})
+	s.WriteManifest("docs", "bbb22222", Manifest{Site: "docs", ID: "bbb22222", CreatedBy: "Bob"})
+
+	s.AppendActivity("docs", ActivityEntry{Type: "deploy.success", Actor: "Alice"})
+	s.AppendActivity("docs", ActivityEntry{Type: "deploy.success", Actor: "Bob"})
+	s.AppendActivity("", ActivityEntry{Type: "site.created", Actor: "alice@example.com"})
+
+	sh, err := s.CreateShare("docs", Share{Path: "/", CreatedBy: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveFilter("alice@example.com", SavedFilter{Name: "mine", DeploymentFilter: DeploymentFilter{Deployer: "Alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPreferences("alice@example.com", Preferences{Theme: ThemeDark}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := s.EraseUser("alice@example.com", []string{"Alice"}, "erased-0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Manifests != 1 || e.ActivityEntries != 2 || e.Shares != 1 || e.SavedFilters != 1 || e.Preferences != 1 {
+		t.Errorf("erasure = %+v", e)
+	}
+	if len(e.Sites) != 1 || e.Sites[0] != "docs" {
+		t.Errorf("sites = %v, want docs", e.Sites)
+	}
+
+	if m, _ := s.ReadManifest("docs", "aaa11111"); m.CreatedBy != "erased-0123" || m.CreatedByAvatar != "" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if m, _ := s.ReadManifest("docs", "bbb22222"); m.CreatedBy != "Bob" {
+		t.Errorf("other deployer erased: %+v", m)
+	}
+	activity, _ := s.ListActivity("docs")
+	if len(activity) != 2 || activity[0].Actor != "Bob" || activity[1].Actor != "erased-0123" {
+		t.Errorf("activity = %+v", activity)
+	}
+	if server, _ := s.ListActivity(""); len(server) != 1 || server[0].Actor != "erased-0123" {
+		t.Errorf("server activity = %+v", server)
+	}
+	if shares, _ := s.ListShares("docs"); len(shares) != 1 || shares[0].ID != sh.ID || shares[0].CreatedBy != "erased-0123" {
+		t.Errorf("shares = %+v", shares)
+	}
+	if filters, _ := s.SavedFilters("alice@example.com"); len(filters) != 0 {
+		t.Errorf("saved filters = %+v", filters)
+	}
+	if prefs, _ := s.Preferences("alice@example.com"); prefs != (Preferences{}) {
+		t.Errorf("preferences = %+v", prefs)
+	}
+
+	// Erasing again finds nothing left.
+	if e, err := s.EraseUser("alice@example.com", []string{"Alice"}, "erased-0123"); err != nil || e.Manifests+e.ActivityEntries+e.Shares != 0 {
+		t.Errorf("second erasure = %+v, %v", e, err)
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrFilterNotFound is returned for an unknown saved filter ID.
+var ErrFilterNotFound = errors.New("saved filter not found")
+
+// filtersFile holds every user's saved deployment filters, keyed by login
+// name, in the data directory.
+const filtersFile = "filters.json"
+
+// Limits on saved filters.
+const (
+	maxSavedFilters   = 50
+	maxFilterNameLen  = 100
+	maxFilterSites    = 20
+	maxFilterDeployer = 255
+)
+
+// Deployment types a DeploymentFilter can select, named after the events
+// the deployments fired.
+const (
+	FilterTypeSuccess = "deploy.success"
+	FilterTypeFailed  = "deploy.failed"
+)
+
+// DeploymentFilter selects deployments across sites, for the deployments
+// page and Atom feed. Empty fields select everything.
+type DeploymentFilter struct {
+	// Sites are site names or path.Match patterns such as "*-prod"; a
+	// deployment matches if its site matches any of them.
+	Sites []string `json:"sites,omitempty"`
+	// Deployer matches the name a deployment was created by, ignoring case.
+	Deployer string `json:"deployer,omitempty"`
+	// Type is FilterTypeSuccess for deployments that completed, or
+	// FilterTypeFailed for those that failed.
+	Type string `json:"type,omitempty"`
+}
+
+// IsZero reports whether f selects every deployment.
+func (f DeploymentFilter) IsZero() bool {
+	return len(f.Sites) == 0 && f.Deployer == "" && f.Type == ""
+}
+
+// Validate reports the first field holding an invalid value.
+func (f DeploymentFilter) Validate() error {
+	if len(f.Sites) > maxFilterSites {
+		return fmt.Errorf("site: at most %d sites or patterns", maxFilterSites)
+	}
+	for _, s := range f.Sites {
+		if _, err := path.Match(s, ""); err != nil || s == "" {
+			return fmt.Errorf("site: %q is not a site name or pattern", s)
+		}
+	}
+	if len(f.Deployer) > maxFilterDeployer || strings.ContainsFunc(f.Deployer, unicode.IsControl) {
+		return fmt.Errorf("deployer: must be at most %d characters without control characters", maxFilterDeployer)
+	}
+	if f.Type != "" && f.Type != FilterTypeSuccess && f.Type != FilterTypeFailed {
+		return fmt.Errorf("type must be %q or %q", FilterTypeSuccess, FilterTypeFailed)
+	}
+	return nil
+}
+
+// MatchesSite reports whether f selects deployments of site.
+func (f DeploymentFilter) MatchesSite(site string) bool {
+	if len(f.Sites) == 0 {
+		return true
+	}
+	for _, s := range f.Sites {
+		if matched, _ := path.Match(s, site); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// SavedFilter is a deployment filter a user saved under a name, to return
+// to or subscribe to as a feed.
+type SavedFilter struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	DeploymentFilter
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SavedFilters returns the filters login saved, oldest first.
+func (s *Store) SavedFilters(login string) ([]SavedFilter, error) {
+	s.filtersMu.Lock()
+	defer s.filtersMu.Unlock()
+	all, err := s.readFilters()
+	if err != nil {
+		return nil, err
+	}
+	if all[login] == nil {
+		return []SavedFilter{}, nil
+	}
+	return all[login], nil
+}
+
+// SaveFilter adds a filter for login, generating its ID. Name is required,
+// and a user can keep at most 50 filters.
+func (s *Store) SaveFilter(login string, f SavedFilter) (SavedFilter, error) {
+	if login == "" {
+		return SavedFilter{}, fmt.Errorf("saved filters require a login name")
+	}
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" || len(f.Name) > maxFilterNameLen || strings.ContainsFunc(f.Name, unicode.IsControl) {
+		return SavedFilter{}, fmt.Errorf("name: must be 1 to %d characters without control characters", maxFilterNameLen)
+	}
+	if err := f.Validate(); err != nil {
+		return SavedFilter{}, err
+	}
+	f.ID = NewDeploymentID()
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now().UTC()
+	}
+
+	s.filtersMu.Lock()
+	defer s.filtersMu.Unlock()
+	all, err := s.readFilters()
+	if err != nil {
+		return SavedFilter{}, err
+	}
+	if len(all[login]) >= maxSavedFilters {
+		return SavedFilter{}, fmt.Errorf("at most %d saved filters", maxSavedFilters)
+	}
+	all[login] = append(all[login], f)
+	if err := s.writeFilters(all); err != nil {
+		return SavedFilter{}, err
+	}
+	return f, nil
+}
+
+// DeleteSavedFilter removes the filter of login with the given ID.
+func (s *Store) DeleteSavedFilter(login, id string) error {
+	s.filtersMu.Lock()
+	defer s.filtersMu.Unlock()
+	all, err := s.readFilters()
+	if err != nil {
+		return err
+	}
+	filters := all[login]
+	for i, f := range filters {
+		if f.ID != id {
+			continue
+		}
+		filters = append(filters[:i], filters[i+1:]...)
+		if len(filters) == 0 {
+			delete(all, login)
+		} else {
+			all[login] = filters
+		}
+		return s.writeFilters(all)
+	}
+	return ErrFilterNotFound
+}
+
+func (s *Store) readFilters() (map[string][]SavedFilter, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, filtersFile))
+	if os.IsNotExist(err) {
+		return map[string][]SavedFilter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all := map[string][]SavedFilter{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("reading saved filters: %w", err)
+	}
+	return all, nil
+}
+
+// writeFilters replaces the filters file atomically.
+func (s *Store) writeFilters(all map[string][]SavedFilter) error {
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, filtersFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
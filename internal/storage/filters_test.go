@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDeploymentFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  DeploymentFilter
+		wantErr string
+	}{
+		{"empty", DeploymentFilter{}, ""},
+		{"full", DeploymentFilter{Sites: []string{"docs", "*-prod"}, Deployer: "Alice", Type: FilterTypeFailed}, ""},
+		{"bad pattern", DeploymentFilter{Sites: []string{"[docs"}}, "site"},
+		{"empty site", DeploymentFilter{Sites: []string{""}}, "site"},
+		{"control character", DeploymentFilter{Deployer: "Al\nice"}, "deployer"},
+		{"unknown type", DeploymentFilter{Type: "site.created"}, "type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeploymentFilter_MatchesSite(t *testing.T) {
+	f := DeploymentFilter{Sites: []string{"docs", "*-prod"}}
+	for site, want := range map[string]bool{"docs": true, "shop-prod": true, "shop-staging": false} {
+		if got := f.MatchesSite(site); got != want {
+			t.Errorf("MatchesSite(%q) = %v, want %v", site, got, want)
+		}
+	}
+	if !(DeploymentFilter{}).MatchesSite("anything") {
+		t.Error("empty filter does not match every site")
+	}
+}
+
+func TestSavedFilters(t *testing.T) {
+	s := New(t.TempDir())
+
+	if filters, err := s.SavedFilters("alice@example.com"); err != nil || len(filters) != 0 {
+		t.Fatalf("SavedFilters() = %v, %v", filters, err)
+	}
+
+	saved, err := s.SaveFilter("alice@example.com", SavedFilter{
+		Name:             " Production deploys ",
+		DeploymentFilter: DeploymentFilter{Sites: []string{"*-prod"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID == "" || saved.Name != "Production deploys" || saved.CreatedAt.IsZero() {
+		t.Errorf("saved = %+v", saved)
+	}
+	s.SaveFilter("bob@example.com", SavedFilter{Name: "Mine", DeploymentFilter: DeploymentFilter{Deployer: "Bob"}})
+
+	filters, _ := s.SavedFilters("alice@example.com")
+	if len(filters) != 1 || filters[0].ID != saved.ID || filters[0].Sites[0] != "*-prod" {
+		t.Errorf("alice's filters = %+v", filters)
+	}
+
+	if err := s.DeleteSavedFilter("bob@example.com", saved.ID); !errors.Is(err, ErrFilterNotFound) {
+		t.Errorf("deleting another user's filter: err = %v", err)
+	}
+	if err := s.DeleteSavedFilter("alice@example.com", saved.ID); err != nil {
+		t.Fatal(err)
+	}
+	if filters, _ := s.SavedFilters("alice@example.com"); len(filters) != 0 {
+		t.Errorf("after delete = %+v", filters)
+	}
+	if filters, _ := s.SavedFilters("bob@example.com"); len(filters) != 1 {
+		t.Errorf("bob's filters = %+v", filters)
+	}
+}
+
+func TestSaveFilter_Invalid(t *testing.T) {
+	s := New(t.TempDir())
+	if _, err := s.SaveFilter("", SavedFilter{Name: "x"}); err == nil {
+		t.Error("saved without a login")
+	}
+	if _, err := s.SaveFilter("alice@example.com", SavedFilter{Name: "  "}); err == nil {
+		t.Error("saved without a name")
+	}
+	if _, err := s.SaveFilter("alice@example.com", SavedFilter{Name: "x", DeploymentFilter: DeploymentFilter{Type: "nope"}}); err == nil {
+		t.Error("saved an invalid filter")
+	}
+	for i := range maxSavedFilters {
+		if _, err := s.SaveFilter("alice@example.com", SavedFilter{Name: "filter"}); err != nil {
+			t.Fatalf("filter %d: %v", i, err)
+		}
+	}
+	if _, err := s.SaveFilter("alice@example.com", SavedFilter{Name: "one too many"}); err == nil {
+		t.Error("saved more than the maximum")
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OrphanMinAge is how old an incomplete deployment must be before garbage
+// collection removes it while the server is running, so uploads that are
+// still being extracted are left alone.
+const OrphanMinAge = time.Hour
+
+// GCOptions controls a garbage collection run.
+type GCOptions struct {
+	// DryRun reports what would be reclaimed without removing anything.
+	DryRun bool
+	// MinAge is how long an incomplete deployment must have been untouched
+	// to count as orphaned. Zero treats every incomplete deployment as
+	// orphaned, which is only safe when no upload can be in progress.
+	MinAge time.Duration
+	// StateDir, if set, is the directory holding per-site tsnet state
+	// directories. Entries for sites that neither exist nor are in the
+	// trash are reclaimed.
+	StateDir string
+}
+
+// GCItem is one reclaimed (or, in a dry run, reclaimable) path. Path is
+// relative to the data directory, or to StateDir for state directories.
+type GCItem struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// GCReport summarizes a garbage collection run.
+type GCReport struct {
+	DryRun bool `json:"dry_run"`
+	// OrphanedDeployments are deployment directories that were never
+	// marked complete or failed, left behind by interrupted uploads.
+	OrphanedDeployments []GCItem `json:"orphaned_deployments"`
+	// DanglingStateDirs are tsnet state directories of deleted sites.
+	DanglingStateDirs []GCItem `json:"dangling_state_dirs"`
+	// UnreferencedFiles are temporary files left by interrupted writes and
+	// "current" links to deployments that no longer exist.
+	UnreferencedFiles []GCItem `json:"unreferenced_files"`
+	ReclaimedBytes    int64    `json:"reclaimed_bytes"`
+	// Errors lists paths that could not be removed. Other items are still
+	// collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Empty reports whether the run found nothing to reclaim.
+func (r GCReport) Empty() bool {
+	return len(r.OrphanedDeployments) == 0 && len(r.DanglingStateDirs) == 0 && len(r.UnreferencedFiles) == 0
+}
+
+// CollectGarbage scans the data directory (and opts.StateDir) for storage no
+// site can reach and removes it, unless opts.DryRun is set.
+func (s *Store) CollectGarbage(opts GCOptions) (GCReport, error) {
+	report := GCReport{
+		DryRun:              opts.DryRun,
+		OrphanedDeployments: []GCItem{},
+		DanglingStateDirs:   []GCItem{},
+		UnreferencedFiles:   []GCItem{},
+	}
+	reclaim := func(list *[]GCItem, root, path string) {
+		rel, _ := filepath.Rel(root, path)
+		item := GCItem{Path: rel, Bytes: diskUsage(path)}
+		if !opts.DryRun {
+			if err := os.RemoveAll(path); err != nil {
+				report.Errors = append(report.Errors, rel+": "+err.Error())
+				return
+			}
+		}
+		*list = append(*list, item)
+		report.ReclaimedBytes += item.Bytes
+	}
+
+	sitesDir := filepath.Join(s.dataDir, "sites")
+	siteEntries, err := os.ReadDir(sitesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	cutoff := time.Now().Add(-opts.MinAge)
+	for _, site := range siteEntries {
+		if !site.IsDir() {
+			continue
+		}
+		siteDir := filepath.Join(sitesDir, site.Name())
+
+		deploymentsDir := filepath.Join(siteDir, "deployments")
+		depEntries, _ := os.ReadDir(deploymentsDir)
+		for _, dep := range depEntries {
+			if !dep.IsDir() {
+				continue
+			}
+			depDir := filepath.Join(deploymentsDir, dep.Name())
+			if !isOrphanedDeployment(depDir, cutoff) {
+				continue
+			}
+			reclaim(&report.OrphanedDeployments, s.dataDir, depDir)
+		}
+
+		link := filepath.Join(siteDir, "current")
+		if _, err := os.Lstat(link + ".tmp"); err == nil {
+			reclaim(&report.UnreferencedFiles, s.dataDir, link+".tmp")
+		}
+		if _, err := os.Lstat(link); err == nil {
+			if _, err := os.Stat(link); os.IsNotExist(err) {
+				reclaim(&report.UnreferencedFiles, s.dataDir, link)
+			}
+		}
+	}
+
+	if opts.StateDir != "" {
+		stateEntries, err := os.ReadDir(opts.StateDir)
+		if err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+		for _, e := range stateEntries {
+			name := e.Name()
+			if !e.IsDir() || !ValidSiteName(name) || s.siteKnown(name) {
+				continue
+			}
+			reclaim(&report.DanglingStateDirs, opts.StateDir, filepath.Join(opts.StateDir, name))
+		}
+	}
+	return report, nil
+}
+
+// CleanupOrphans removes deployments left incomplete by an interrupted
+// upload. Call it at startup, before any upload can be in progress.
+func (s *Store) CleanupOrphans() {
+	s.CollectGarbage(GCOptions{}) //nolint:errcheck // best-effort at startup
+}
+
+// isOrphanedDeployment reports whether depDir has neither completion marker
+// and neither it nor its content changed since cutoff.
+func isOrphanedDeployment(depDir string, cutoff time.Time) bool {
+	for _, marker := range []string{".complete", ".failed"} {
+		if _, err := os.Stat(filepath.Join(depDir, marker)); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	for _, dir := range []string{depDir, filepath.Join(depDir, "content")} {
+		if info, err := os.Stat(dir); err == nil && info.ModTime().After(cutoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// siteKnown reports whether site exists or is in the trash.
+func (s *Store) siteKnown(site string) bool {
+	for _, dir := range []string{filepath.Join(s.dataDir, "sites", site), s.trashedSiteDir(site)} {
+		if _, err := os.Stat(dir); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// diskUsage returns the total size of the regular files under path.
+func diskUsage(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error { //nolint:errcheck // best-effort size
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupGarbage creates a site with a live deployment, an orphaned upload,
+// a leftover current.tmp link, and tsnet state for live, trashed, and
+// deleted sites.
+func setupGarbage(t *testing.T) (*Store, string) {
+	t.Helper()
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "live0001")
+	s.MarkComplete("docs", "live0001")
+	s.ActivateDeployment("docs", "live0001")
+
+	content, _ := s.CreateDeployment("docs", "orphan01")
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("hello"), 0644)
+
+	siteDir := filepath.Join(s.dataDir, "sites", "docs")
+	os.Symlink("deployments/gone", filepath.Join(siteDir, "current.tmp"))
+
+	s.CreateDeployment("old", "old00001")
+	s.MarkComplete("old", "old00001")
+	s.TrashSite("old")
+
+	stateDir := t.TempDir()
+	for _, site := range []string{"docs", "old", "removed"} {
+		os.MkdirAll(filepath.Join(stateDir, site), 0755)
+		os.WriteFile(filepath.Join(stateDir, site, "tailscaled.state"), []byte("{}"), 0600)
+	}
+	return s, stateDir
+}
+
+func TestCollectGarbage(t *testing.T) {
+	s, stateDir := setupGarbage(t)
+
+	report, err := s.CollectGarbage(GCOptions{StateDir: stateDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := filepath.Join("sites", "docs", "deployments", "orphan01")
+	if len(report.OrphanedDeployments) != 1 || report.OrphanedDeployments[0].Path != orphan {
+		t.Errorf("orphaned = %+v, want %s", report.OrphanedDeployments, orphan)
+	}
+	if len(report.DanglingStateDirs) != 1 || report.DanglingStateDirs[0].Path != "removed" {
+		t.Errorf("state dirs = %+v, want [removed]", report.DanglingStateDirs)
+	}
+	tmp := filepath.Join("sites", "docs", "current.tmp")
+	if len(report.UnreferencedFiles) != 1 || report.UnreferencedFiles[0].Path != tmp {
+		t.Errorf("files = %+v, want %s", report.UnreferencedFiles, tmp)
+	}
+	if report.ReclaimedBytes != int64(len("hello")+len("{}")) {
+		t.Errorf("reclaimed = %d", report.ReclaimedBytes)
+	}
+
+	for _, gone := range []string{filepath.Join(s.dataDir, orphan), filepath.Join(s.dataDir, tmp), filepath.Join(stateDir, "removed")} {
+		if _, err := os.Lstat(gone); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", gone)
+		}
+	}
+	for _, kept := range []string{filepath.Join(stateDir, "docs"), filepath.Join(stateDir, "old")} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+	if _, err := s.CurrentDeployment("docs"); err != nil {
+		t.Errorf("live deployment lost: %v", err)
+	}
+}
+
+func TestCollectGarbage_DryRun(t *testing.T) {
+	s, stateDir := setupGarbage(t)
+
+	report, err := s.CollectGarbage(GCOptions{DryRun: true, StateDir: stateDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Empty() {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, item := range report.OrphanedDeployments {
+		if _, err := os.Stat(filepath.Join(s.dataDir, item.Path)); err != nil {
+			t.Errorf("dry run removed %s", item.Path)
+		}
+	}
+	for _, item := range report.DanglingStateDirs {
+		if _, err := os.Stat(filepath.Join(stateDir, item.Path)); err != nil {
+			t.Errorf("dry run removed %s", item.Path)
+		}
+	}
+
+	// A second, real run reclaims the same set.
+	again, _ := s.CollectGarbage(GCOptions{StateDir: stateDir})
+	if again.ReclaimedBytes != report.ReclaimedBytes {
+		t.Errorf("reclaimed %d, dry run reported %d", again.ReclaimedBytes, report.ReclaimedBytes)
+	}
+}
+
+func TestCollectGarbage_MinAge(t *testing.T) {
+	s := New(t.TempDir())
+	content, _ := s.CreateDeployment("docs", "upload01")
+
+	// An upload still being extracted is left alone.
+	report, _ := s.CollectGarbage(GCOptions{MinAge: time.Hour})
+	if len(report.OrphanedDeployments) != 0 {
+		t.Fatalf("recent upload collected: %+v", report.OrphanedDeployments)
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(content, past, past)
+	os.Chtimes(filepath.Dir(content), past, past)
+	report, _ = s.CollectGarbage(GCOptions{MinAge: time.Hour})
+	if len(report.OrphanedDeployments) != 1 {
+		t.Errorf("stale upload not collected: %+v", report)
+	}
+}
+
+func TestCollectGarbage_DanglingCurrent(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.MarkComplete("docs", "aaa11111")
+	s.ActivateDeployment("docs", "aaa11111")
+	os.RemoveAll(filepath.Join(s.dataDir, "sites", "docs", "deployments", "aaa11111"))
+
+	report, _ := s.CollectGarbage(GCOptions{})
+	want := filepath.Join("sites", "docs", "current")
+	if len(report.UnreferencedFiles) != 1 || report.UnreferencedFiles[0].Path != want {
+		t.Errorf("files = %+v, want %s", report.UnreferencedFiles, want)
+	}
+}
+
+func TestCollectGarbage_Empty(t *testing.T) {
+	report, err := New(t.TempDir()).CollectGarbage(GCOptions{StateDir: filepath.Join(t.TempDir(), "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() || report.OrphanedDeployments == nil {
+		t.Errorf("report = %+v", report)
+	}
+}
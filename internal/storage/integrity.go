@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const integrityFile = "integrity.json"
+
+// Actions taken by CheckIntegrity.
+const (
+	// IntegrityCompleted marks a deployment whose upload had finished but
+	// was not marked complete; its files were verified against its index.
+	IntegrityCompleted = "completed"
+	// IntegrityQuarantined marks an incomplete deployment that could not be
+	// verified. It was moved to the trash, where it can still be inspected
+	// or restored until the trash is purged.
+	IntegrityQuarantined = "quarantined"
+	// IntegrityRolledBack marks a site whose active deployment was unusable
+	// and was replaced by its newest complete deployment.
+	IntegrityRolledBack = "rolled_back"
+	// IntegrityDeactivated marks a site whose active deployment was unusable
+	// and that had no complete deployment to fall back to.
+	IntegrityDeactivated = "deactivated"
+)
+
+// IntegrityIssue is a problem CheckIntegrity found and what it did about it.
+type IntegrityIssue struct {
+	Site         string `json:"site"`
+	DeploymentID string `json:"deployment_id"`
+	Action       string `json:"action"`
+	Reason       string `json:"reason"`
+	// RolledBackTo is the deployment activated instead, for rolled_back.
+	RolledBackTo string `json:"rolled_back_to,omitempty"`
+}
+
+// IntegrityReport is the result of the startup consistency check.
+type IntegrityReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Issues    []IntegrityIssue `json:"issues"`
+	// Errors lists problems that could not be repaired.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// CheckIntegrity repairs what an interrupted upload or activation left
+// behind. Deployments without a completion marker are marked complete if
+// their manifest and file index are intact and every indexed file matches
+// its size and hash; otherwise they are quarantined. Sites whose active
+// deployment is missing, incomplete, or failed are rolled back to their
+// newest complete deployment the site's pins allow, or deactivated. The
+// report is saved for LastIntegrityReport.
+//
+// Call it at startup, before any upload can be in progress.
+func (s *Store) CheckIntegrity() (IntegrityReport, error) {
+	report := IntegrityReport{CheckedAt: time.Now().UTC(), Issues: []IntegrityIssue{}}
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, "sites"))
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && ValidSiteName(e.Name()) {
+			s.checkSiteIntegrity(e.Name(), &report)
+		}
+	}
+	if err := s.writeIntegrityReport(report); err != nil {
+		return report, fmt.Errorf("saving integrity report: %w", err)
+	}
+	return report, nil
+}
+
+func (s *Store) checkSiteIntegrity(site string, report *IntegrityReport) {
+	fail := func(id string, err error) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", site, id, err))
+	}
+
+	deploymentsDir := filepath.Join(s.dataDir, "sites", site, "deployments")
+	entries, _ := os.ReadDir(deploymentsDir)
+	for _, e := range entries {
+		id := e.Name()
+		if !e.IsDir() || !ValidDeploymentID(id) {
+			continue
+		}
+		depDir := filepath.Join(deploymentsDir, id)
+		if hasMarker(depDir, ".complete") || hasMarker(depDir, ".failed") {
+			continue
+		}
+		if verr := s.verifyDeployment(site, id); verr == nil {
+			if err := s.ChainDeployment(site, id); err != nil {
+				fail(id, err)
+				continue
+			}
+			if err := s.MarkComplete(site, id); err != nil {
+				fail(id, err)
+				continue
+			}
+			report.Issues = append(report.Issues, IntegrityIssue{
+				Site: site, DeploymentID: id, Action: IntegrityCompleted,
+				Reason: "upload finished but was not marked complete",
+			})
+		} else {
+			if err := moveToTrash(depDir, s.trashedDeploymentDir(site, id)); err != nil {
+				fail(id, err)
+				continue
+			}
+			report.Issues = append(report.Issues, IntegrityIssue{
+				Site: site, DeploymentID: id, Action: IntegrityQuarantined,
+				Reason: "incomplete upload: " + verr.Error(),
+			})
+		}
+	}
+
+	current, err := s.CurrentDeployment(site)
+	if err != nil {
+		return
+	}
+	depDir := filepath.Join(deploymentsDir, current)
+	var reason string
+	switch {
+	case !ValidDeploymentID(current) || !exists(depDir):
+		reason = "active deployment is missing"
+	case hasMarker(depDir, ".failed"):
+		reason = "active deployment failed"
+	case !hasMarker(depDir, ".complete"):
+		reason = "active deployment is incomplete"
+	default:
+		return
+	}
+
+	issue := IntegrityIssue{Site: site, DeploymentID: current, Reason: reason}
+	if prev := s.fallbackDeployment(site, current); prev != "" {
+		if err := s.setCurrent(site, prev); err != nil {
+			fail(current, err)
+			return
+		}
+		issue.Action = IntegrityRolledBack
+		issue.RolledBackTo = prev
+	} else {
+		link := filepath.Join(s.dataDir, "sites", site, "current")
+		if err := os.Remove(link); err != nil {
+			fail(current, err)
+			return
+		}
+		syncDir(filepath.Dir(link)) //nolint:errcheck // the link is gone either way
+		issue.Action = IntegrityDeactivated
+	}
+	report.Issues = append(report.Issues, issue)
+}
+
+// verifyDeployment checks an incomplete deployment against its file index.
+// Precompressed variants are written after indexing, so those not recorded
+// in the index yet may be truncated; they are removed, and the server
+// compresses on the fly instead. Recorded variants are checked like files.
+func (s *Store) verifyDeployment(site, id string) error {
+	if _, err := s.ReadManifest(site, id); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	files, err := s.ReadFileIndex(site, id)
+	if err != nil {
+		return fmt.Errorf("file index: %w", err)
+	}
+	indexed := make(map[string]FileInfo, len(files))
+	for _, f := range files {
+		indexed[f.Path] = f
+	}
+
+	contentDir := s.ContentDir(site, id)
+	var variants []string
+	var recorded []FileInfo
+	err = filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(contentDir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := indexed[rel]; ok {
+			return nil
+		}
+		if v, ok := recordedVariant(rel, indexed); ok {
+			recorded = append(recorded, FileInfo{Path: rel, Size: v.Size, Hash: v.Hash})
+			return nil
+		}
+		ext := filepath.Ext(rel)
+		if _, ok := indexed[strings.TrimSuffix(rel, ext)]; ok && (ext == ".br" || ext == ".gz") {
+			variants = append(variants, path)
+			return nil
+		}
+		return fmt.Errorf("%s is not in the file index", rel)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, f := range append(files, recorded...) {
+		if err := verifyFile(filepath.Join(contentDir, f.Path), f); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	for _, path := range variants {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyFile checks that the file at path has the size and hash of f.
+func verifyFile(path string, f FileInfo) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return err
+	}
+	if n != f.Size {
+		return fmt.Errorf("size is %d bytes, want %d", n, f.Size)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.Hash {
+		return errors.New("content does not match its hash")
+	}
+	return nil
+}
+
+// fallbackDeployment returns the newest complete deployment of site other
+// than exclude that its pins allow, or "" if there is none.
+func (s *Store) fallbackDeployment(site, exclude string) string {
+	deployments, _ := s.ListDeployments(site)
+	sort.SliceStable(deployments, func(i, j int) bool {
+		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
+	})
+	for _, d := range deployments {
+		if d.ID == exclude || d.Failed || s.checkPins(site, d.ID) != nil {
+			continue
+		}
+		return d.ID
+	}
+	return ""
+}
+
+// LastIntegrityReport returns the report of the last CheckIntegrity run.
+// Returns os.ErrNotExist if it never ran.
+func (s *Store) LastIntegrityReport() (IntegrityReport, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, integrityFile))
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	var report IntegrityReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return IntegrityReport{}, fmt.Errorf("parse integrity report: %w", err)
+	}
+	return report, nil
+}
+
+func (s *Store) writeIntegrityReport(report IntegrityReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, integrityFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func hasMarker(depDir, marker string) bool {
+	_, err := os.Stat(filepath.Join(depDir, marker))
+	return err == nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// syncTree flushes every regular file and directory under root to disk.
+func syncTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		return syncPath(path)
+	})
+}
+
+// syncDir flushes dir's entries to disk, making renames and new files in
+// it durable.
+func syncDir(dir string) error { return syncPath(dir) }
+
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
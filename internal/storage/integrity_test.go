@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// uploadDeployment creates a deployment with an index.html, its manifest,
+// and its file index, as an upload does before marking it complete.
+func uploadDeployment(t *testing.T, s *Store, site, id string, at time.Time) string {
+	t.Helper()
+	if _, err := s.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	content := s.ContentDir(site, id)
+	os.MkdirAll(content, 0755)
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("<h1>"+id+"</h1>"), 0644)
+	s.WriteManifest(site, id, Manifest{Site: site, ID: id, CreatedAt: at})
+	files, err := s.ListDeploymentFiles(site, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.WriteFileIndex(site, id, files)
+	return content
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	s := New(t.TempDir())
+	now := time.Now()
+
+	// An upload that finished but crashed before being marked complete,
+	// with a recorded precompressed variant and one cut short before it was
+	// recorded.
+	content := uploadDeployment(t, s, "docs", "done0001", now)
+	os.WriteFile(filepath.Join(content, "index.html.br"), []byte("small"), 0644)
+	files, _ := s.ReadFileIndex("docs", "done0001")
+	size, hash, _ := HashFile(filepath.Join(content, "index.html.br"))
+	files[0].Variants = map[string]FileVariant{".br": {Size: size, Hash: hash}}
+	s.WriteFileIndex("docs", "done0001", files)
+	os.WriteFile(filepath.Join(content, "index.html.gz"), []byte("trunc"), 0644)
+
+	// An upload interrupted while extracting.
+	content = uploadDeployment(t, s, "docs", "torn0001", now)
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("<h1>"), 0644)
+
+	// A site pointing at a deployment whose upload never finished.
+	uploadDeployment(t, s, "blog", "good0001", now.Add(-time.Hour))
+	s.MarkComplete("blog", "good0001")
+	s.CreateDeployment("blog", "bad00001")
+	s.ActivateDeployment("blog", "bad00001")
+
+	// A site pointing at a deployment that is gone.
+	uploadDeployment(t, s, "wiki", "only0001", now)
+	s.MarkComplete("wiki", "only0001")
+	s.ActivateDeployment("wiki", "only0001")
+	os.RemoveAll(filepath.Join(s.dataDir, "sites", "wiki", "deployments", "only0001"))
+
+	report, err := s.CheckIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"blog/bad00001": IntegrityQuarantined,
+		"blog/":         IntegrityRolledBack,
+		"docs/done0001": IntegrityCompleted,
+		"docs/torn0001": IntegrityQuarantined,
+		"wiki/":         IntegrityDeactivated,
+	}
+	got := map[string]string{}
+	for _, issue := range report.Issues {
+		key := issue.Site + "/" + issue.DeploymentID
+		if issue.Action == IntegrityRolledBack || issue.Action == IntegrityDeactivated {
+			key = issue.Site + "/"
+		}
+		got[key] = issue.Action
+	}
+	if len(got) != len(want) {
+		t.Fatalf("issues = %+v", report.Issues)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: action = %q, want %q", k, got[k], v)
+		}
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("errors = %v", report.Errors)
+	}
+
+	if !s.DeploymentComplete("docs", "done0001") {
+		t.Error("verified upload was not marked complete")
+	}
+	if _, err := os.Stat(filepath.Join(s.ContentDir("docs", "done0001"), "index.html.gz")); !os.IsNotExist(err) {
+		t.Error("truncated variant was kept")
+	}
+	if _, err := os.Stat(filepath.Join(s.ContentDir("docs", "done0001"), "index.html.br")); err != nil {
+		t.Errorf("recorded variant was removed: %v", err)
+	}
+	if _, err := os.Stat(s.trashedDeploymentDir("docs", "torn0001")); err != nil {
+		t.Errorf("torn upload was not quarantined: %v", err)
+	}
+	if cur, _ := s.CurrentDeployment("blog"); cur != "good0001" {
+		t.Errorf("blog current = %q, want good0001", cur)
+	}
+	if cur, err := s.CurrentDeployment("wiki"); err == nil {
+		t.Errorf("wiki current = %q, want none", cur)
+	}
+
+	last, err := s.LastIntegrityReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Issues) != len(report.Issues) || !last.CheckedAt.Equal(report.CheckedAt) {
+		t.Errorf("saved report = %+v", last)
+	}
+
+	// A second run finds nothing left to repair.
+	if report, _ := s.CheckIntegrity(); len(report.Issues) != 0 {
+		t.Errorf("second run issues = %+v", report.Issues)
+	}
+}
+
+func TestCheckIntegrity_RespectsPins(t *testing.T) {
+	s := New(t.TempDir())
+	now := time.Now()
+	uploadDeployment(t, s, "docs", "pinned01", now.Add(-2*time.Hour))
+	s.MarkComplete("docs", "pinned01")
+	uploadDeployment(t, s, "docs", "newer001", now.Add(-time.Hour))
+	s.MarkComplete("docs", "newer001")
+	s.CreateDeployment("docs", "broken01")
+	s.ActivateDeployment("docs", "broken01")
+	if err := s.PinDeployment("docs", "pinned01", PinState{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := s.CurrentDeployment("docs"); cur != "pinned01" {
+		t.Errorf("current = %q, want the pinned deployment", cur)
+	}
+}
+
+func TestLastIntegrityReport_NeverRan(t *testing.T) {
+	s := New(t.TempDir())
+	if _, err := s.LastIntegrityReport(); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// ErrDeploymentPinned is returned for deleting a pinned deployment, and for
+// activating a deployment that is not pinned while the site has one that
+// is.
+var ErrDeploymentPinned = errors.New("deployment is pinned")
+
+// pinnedMarker is the file in a deployment directory that marks it pinned.
+const pinnedMarker = ".pinned"
+
+// PinState describes a pinned deployment. A pinned deployment cannot be
+// deleted, and while a site has one, no other deployment can be activated.
+type PinState struct {
+	PinnedAt time.Time `json:"pinned_at"`
+	PinnedBy string    `json:"pinned_by,omitempty"`
+	// Reason tells others why the deployment is pinned.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PinDeployment pins a complete deployment, replacing any earlier pin
+// state.
+func (s *Store) PinDeployment(site, id string, state PinState) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if !s.DeploymentComplete(site, id) {
+		return ErrDeploymentNotFound
+	}
+	if state.PinnedAt.IsZero() {
+		state.PinnedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, pinnedMarker), data, 0644)
+}
+
+// UnpinDeployment unpins a deployment. Unpinning a deployment that is not
+// pinned is a no-op.
+func (s *Store) UnpinDeployment(site, id string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if !ValidDeploymentID(id) {
+		return ErrDeploymentNotFound
+	}
+	err := os.Remove(filepath.Join(s.dataDir, "sites", site, "deployments", id, pinnedMarker))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ReadPin returns a deployment's pin state and whether it is pinned. A
+// marker that cannot be parsed still counts as pinned.
+func (s *Store) ReadPin(site, id string) (PinState, bool) {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return PinState{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, pinnedMarker))
+	if err != nil {
+		return PinState{}, false
+	}
+	var state PinState
+	json.Unmarshal(data, &state) //nolint:errcheck // a damaged marker still pins
+	return state, true
+}
+
+// PinnedDeployments returns the IDs of a site's pinned deployments.
+func (s *Store) PinnedDeployments(site string) []string {
+	if !ValidSiteName(site) {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.dataDir, "sites", site, "deployments", "*", pinnedMarker))
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, filepath.Base(filepath.Dir(m)))
+	}
+	return ids
+}
+
+// checkPins returns ErrDeploymentPinned if the site has pinned deployments
+// and id is not one of them.
+func (s *Store) checkPins(site, id string) error {
+	pinned := s.PinnedDeployments(site)
+	if len(pinned) > 0 && !slices.Contains(pinned, id) {
+		return ErrDeploymentPinned
+	}
+	return nil
+}
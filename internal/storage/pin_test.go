@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPinDeployment(t *testing.T) {
+	s := canarySite(t)
+	if _, ok := s.ReadPin("docs", "aaa11111"); ok {
+		t.Fatal("new deployment is pinned")
+	}
+	if err := s.PinDeployment("docs", "aaa11111", PinState{PinnedBy: "alice", Reason: "audit"}); err != nil {
+		t.Fatal(err)
+	}
+	pin, ok := s.ReadPin("docs", "aaa11111")
+	if !ok || pin.PinnedBy != "alice" || pin.Reason != "audit" || pin.PinnedAt.IsZero() {
+		t.Errorf("pin = %+v, ok = %v", pin, ok)
+	}
+	deployments, _ := s.ListDeployments("docs")
+	for _, d := range deployments {
+		if (d.Pinned != nil) != (d.ID == "aaa11111") {
+			t.Errorf("%s pinned = %+v", d.ID, d.Pinned)
+		}
+	}
+
+	// Only pinned deployments can be activated.
+	if err := s.ActivateDeployment("docs", "bbb22222"); !errors.Is(err, ErrDeploymentPinned) {
+		t.Errorf("activating an unpinned deployment: %v, want ErrDeploymentPinned", err)
+	}
+	if err := s.StartCanary("docs", CanaryState{DeploymentID: "bbb22222", Percent: 10}); !errors.Is(err, ErrDeploymentPinned) {
+		t.Errorf("canary of an unpinned deployment: %v, want ErrDeploymentPinned", err)
+	}
+	s.PinDeployment("docs", "bbb22222", PinState{})
+	if err := s.ActivateDeployment("docs", "bbb22222"); err != nil {
+		t.Errorf("activating a pinned deployment: %v", err)
+	}
+
+	// Pinned deployments survive cleanups and cannot be deleted.
+	if n, err := s.DeleteInactiveDeployments("docs"); err != nil || n != 1 {
+		t.Errorf("DeleteInactiveDeployments = %d, %v, want 1", n, err)
+	}
+	if !s.DeploymentComplete("docs", "aaa11111") {
+		t.Error("pinned deployment was deleted")
+	}
+	if err := s.DeleteDeployment("docs", "aaa11111"); !errors.Is(err, ErrDeploymentPinned) {
+		t.Errorf("DeleteDeployment = %v, want ErrDeploymentPinned", err)
+	}
+
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		if err := s.UnpinDeployment("docs", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pinned := s.PinnedDeployments("docs"); len(pinned) != 0 {
+		t.Errorf("pinned = %v after unpinning", pinned)
+	}
+	if err := s.UnpinDeployment("docs", "aaa11111"); err != nil {
+		t.Errorf("unpinning twice: %v", err)
+	}
+}
+
+func TestPinDeployment_Rejects(t *testing.T) {
+	s := canarySite(t)
+	s.CreateDeployment("docs", "ddd44444")
+	if err := s.PinDeployment("docs", "ddd44444", PinState{}); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("pinning an incomplete deployment: %v, want ErrDeploymentNotFound", err)
+	}
+	if err := s.PinDeployment("docs", "eee55555", PinState{}); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("pinning a missing deployment: %v, want ErrDeploymentNotFound", err)
+	}
+}
+
+func TestDeploymentArchive_LeavesOutPin(t *testing.T) {
+	s := canarySite(t)
+	s.PinDeployment("docs", "aaa11111", PinState{})
+	var buf bytes.Buffer
+	if err := s.WriteDeploymentArchive(&buf, "docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := New(t.TempDir())
+	if err := dst.ImportDeployment("docs", "aaa11111", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dst.ReadPin("docs", "aaa11111"); ok {
+		t.Error("imported deployment is pinned")
+	}
+}
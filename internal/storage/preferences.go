@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// preferencesFile holds every user's admin panel preferences, keyed by
+// login name, in the data directory.
+const preferencesFile = "preferences.json"
+
+// Themes the admin panel can be shown in. ThemeSystem follows the
+// browser's prefers-color-scheme.
+const (
+	ThemeSystem = "system"
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
+// Table densities of the admin panel.
+const (
+	DensityComfortable = "comfortable"
+	DensityCompact     = "compact"
+)
+
+// LandingPages are the admin pages a user may land on when opening the
+// control plane's root.
+var LandingPages = []string{"/sites", "/deployments", "/analytics", "/webhooks"}
+
+// Preferences are a user's admin panel settings. Empty fields mean the
+// default: the system theme, the sites page, comfortable tables, and the
+// server's timezone.
+type Preferences struct {
+	Theme        string `json:"theme,omitempty"`
+	LandingPage  string `json:"landing_page,omitempty"`
+	TableDensity string `json:"table_density,omitempty"`
+	Timezone     string `json:"timezone,omitempty"`
+}
+
+// Validate reports the first field holding an unknown value.
+func (p Preferences) Validate() error {
+	if p.Theme != "" && !slices.Contains([]string{ThemeSystem, ThemeLight, ThemeDark}, p.Theme) {
+		return fmt.Errorf("theme must be %q, %q, or %q", ThemeSystem, ThemeLight, ThemeDark)
+	}
+	if p.LandingPage != "" && !slices.Contains(LandingPages, p.LandingPage) {
+		return fmt.Errorf("landing_page must be one of %v", LandingPages)
+	}
+	if p.TableDensity != "" && p.TableDensity != DensityComfortable && p.TableDensity != DensityCompact {
+		return fmt.Errorf("table_density must be %q or %q", DensityComfortable, DensityCompact)
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("timezone %q is not an IANA timezone name", p.Timezone)
+		}
+	}
+	return nil
+}
+
+// Location returns the preferred timezone, or fallback if none is set.
+func (p Preferences) Location(fallback *time.Location) *time.Location {
+	if p.Timezone == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Preferences returns the preferences of login, which are empty if the user
+// never saved any.
+func (s *Store) Preferences(login string) (Preferences, error) {
+	s.prefsMu.Lock()
+	defer s.prefsMu.Unlock()
+	all, err := s.readPreferences()
+	if err != nil {
+		return Preferences{}, err
+	}
+	return all[login], nil
+}
+
+// SetPreferences replaces the preferences of login. Resetting them to the
+// zero value forgets the user.
+func (s *Store) SetPreferences(login string, p Preferences) error {
+	if login == "" {
+		return fmt.Errorf("preferences require a login name")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	s.prefsMu.Lock()
+	defer s.prefsMu.Unlock()
+	all, err := s.readPreferences()
+	if err != nil {
+		return err
+	}
+	if p == (Preferences{}) {
+		delete(all, login)
+	} else {
+		all[login] = p
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, preferencesFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (s *Store) readPreferences() (map[string]Preferences, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, preferencesFile))
+	if os.IsNotExist(err) {
+		return map[string]Preferences{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]Preferences{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("reading preferences: %w", err)
+	}
+	return all, nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreferences(t *testing.T) {
+	s := New(t.TempDir())
+
+	prefs, err := s.Preferences("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs != (Preferences{}) {
+		t.Errorf("preferences of new user = %+v, want zero", prefs)
+	}
+
+	want := Preferences{Theme: ThemeDark, LandingPage: "/analytics", TableDensity: DensityCompact, Timezone: "Europe/Berlin"}
+	if err := s.SetPreferences("alice@example.com", want); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPreferences("bob@example.com", Preferences{Theme: ThemeLight}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Preferences("alice@example.com"); got != want {
+		t.Errorf("Preferences = %+v, want %+v", got, want)
+	}
+	if got := want.Location(time.UTC); got.String() != "Europe/Berlin" {
+		t.Errorf("Location = %v", got)
+	}
+
+	if err := s.SetPreferences("alice@example.com", Preferences{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Preferences("alice@example.com"); got != (Preferences{}) {
+		t.Errorf("reset preferences = %+v", got)
+	}
+	if got, _ := s.Preferences("bob@example.com"); got.Theme != ThemeLight {
+		t.Errorf("other user's preferences = %+v", got)
+	}
+}
+
+func TestPreferences_Validate(t *testing.T) {
+	for _, p := range []Preferences{
+		{Theme: "sepia"},
+		{LandingPage: "/trash"},
+		{TableDensity: "cozy"},
+		{Timezone: "Mars/Olympus"},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", p)
+		}
+	}
+	if err := (Preferences{}).Validate(); err != nil {
+		t.Errorf("Validate(zero) = %v", err)
+	}
+	if (Preferences{}).Location(time.UTC) != time.UTC {
+		t.Error("default location is not the fallback")
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily period, in minutes since midnight, during which
+// webhooks that are not critical are held back. It wraps past midnight if
+// Start is after End.
+type QuietHours struct {
+	Start, End int
+}
+
+// ParseQuietHours parses a period such as "22:00-07:00".
+func ParseQuietHours(s string) (QuietHours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("must be a period such as \"22:00-07:00\", got %q", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid start %q, want HH:MM", from)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid end %q, want HH:MM", to)
+	}
+	q := QuietHours{Start: start.Hour()*60 + start.Minute(), End: end.Hour()*60 + end.Minute()}
+	if q.Start == q.End {
+		return QuietHours{}, fmt.Errorf("start and end must differ, got %q", s)
+	}
+	return q, nil
+}
+
+// Until reports whether t falls within q, in t's location, and if so,
+// when q ends.
+func (q QuietHours) Until(t time.Time) (time.Time, bool) {
+	m := t.Hour()*60 + t.Minute()
+	var quiet bool
+	if q.Start < q.End {
+		quiet = m >= q.Start && m < q.End
+	} else {
+		quiet = m >= q.Start || m < q.End
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	y, mo, d := t.Date()
+	end := time.Date(y, mo, d, q.End/60, q.End%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// WebhookQuietUntil reports whether t falls within the webhook quiet hours
+// of c, in its webhook_timezone, and if so, when they end.
+func (c SiteConfig) WebhookQuietUntil(t time.Time) (time.Time, bool) {
+	if c.WebhookQuietHours == "" {
+		return time.Time{}, false
+	}
+	q, err := ParseQuietHours(c.WebhookQuietHours)
+	if err != nil {
+		return time.Time{}, false
+	}
+	loc := time.UTC
+	if c.WebhookTimezone != "" {
+		if l, err := time.LoadLocation(c.WebhookTimezone); err == nil {
+			loc = l
+		}
+	}
+	return q.Until(t.In(loc))
+}
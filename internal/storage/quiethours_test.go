@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    QuietHours
+		wantErr bool
+	}{
+		{"22:00-07:00", QuietHours{Start: 22 * 60, End: 7 * 60}, false},
+		{"12:30 - 13:15", QuietHours{Start: 12*60 + 30, End: 13*60 + 15}, false},
+		{"22:00", QuietHours{}, true},
+		{"25:00-07:00", QuietHours{}, true},
+		{"22:00-7pm", QuietHours{}, true},
+		{"08:00-08:00", QuietHours{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuietHours(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseQuietHours(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQuietHours_Until(t *testing.T) {
+	night := QuietHours{Start: 22 * 60, End: 7 * 60}
+	lunch := QuietHours{Start: 12 * 60, End: 13 * 60}
+	day := func(d, h, m int) time.Time { return time.Date(2025, 3, d, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name  string
+		q     QuietHours
+		t     time.Time
+		until time.Time
+		quiet bool
+	}{
+		{"before midnight", night, day(1, 23, 0), day(2, 7, 0), true},
+		{"after midnight", night, day(2, 3, 0), day(2, 7, 0), true},
+		{"at end", night, day(2, 7, 0), time.Time{}, false},
+		{"daytime", night, day(2, 15, 0), time.Time{}, false},
+		{"within", lunch, day(2, 12, 30), day(2, 13, 0), true},
+		{"after", lunch, day(2, 13, 30), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		until, quiet := tt.q.Until(tt.t)
+		if quiet != tt.quiet || !until.Equal(tt.until) {
+			t.Errorf("%s: Until = %v, %v; want %v, %v", tt.name, until, quiet, tt.until, tt.quiet)
+		}
+	}
+}
+
+func TestSiteConfig_WebhookQuietUntil(t *testing.T) {
+	cfg := SiteConfig{WebhookQuietHours: "22:00-07:00", WebhookTimezone: "Europe/Berlin"}
+	// 21:30 UTC is 22:30 in Berlin in winter.
+	until, quiet := cfg.WebhookQuietUntil(time.Date(2025, 1, 10, 21, 30, 0, 0, time.UTC))
+	if !quiet || !until.Equal(time.Date(2025, 1, 11, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("WebhookQuietUntil = %v, %v", until, quiet)
+	}
+	if _, quiet := (SiteConfig{}).WebhookQuietUntil(time.Now()); quiet {
+		t.Error("quiet without quiet hours")
+	}
+}
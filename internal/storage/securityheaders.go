@@ -0,0 +1,36 @@
+package storage
+
+// Presets of security_headers.
+const (
+	SecurityHeadersStrict  = "strict"
+	SecurityHeadersRelaxed = "relaxed"
+	SecurityHeadersOff     = "off"
+)
+
+// securityHeaderPresets are the headers each security_headers preset sends.
+// Strict suits sites that embed nothing from elsewhere and are not embedded
+// themselves; relaxed keeps referrers within the site's origin and allows
+// framing by it.
+var securityHeaderPresets = map[string]map[string]string{
+	SecurityHeadersStrict: {
+		"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Permissions-Policy":        "camera=(), microphone=(), geolocation=(), payment=(), usb=(), browsing-topics=()",
+	},
+	SecurityHeadersRelaxed: {
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Permissions-Policy":        "browsing-topics=()",
+	},
+}
+
+// SecurityHeaderSet returns the headers of the config's security_headers
+// preset, or nil with none. Headers the config sets for a path take
+// precedence over them.
+func (c SiteConfig) SecurityHeaderSet() map[string]string {
+	return securityHeaderPresets[c.SecurityHeaders]
+}
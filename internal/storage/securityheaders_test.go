@@ -0,0 +1,38 @@
+package storage
+
+import "testing"
+
+func TestSiteConfig_SecurityHeaderSet(t *testing.T) {
+	for preset, want := range map[string]string{
+		SecurityHeadersStrict:  "DENY",
+		SecurityHeadersRelaxed: "SAMEORIGIN",
+		SecurityHeadersOff:     "",
+		"":                     "",
+	} {
+		got := SiteConfig{SecurityHeaders: preset}.SecurityHeaderSet()["X-Frame-Options"]
+		if got != want {
+			t.Errorf("%q: X-Frame-Options = %q, want %q", preset, got, want)
+		}
+	}
+}
+
+func TestValidateSiteConfig_SecurityHeaders(t *testing.T) {
+	for _, preset := range []string{"", SecurityHeadersStrict, SecurityHeadersRelaxed, SecurityHeadersOff} {
+		if err := (SiteConfig{SecurityHeaders: preset}).Validate(); err != nil {
+			t.Errorf("%q: %v", preset, err)
+		}
+	}
+	if err := (SiteConfig{SecurityHeaders: "paranoid"}).Validate(); err == nil {
+		t.Error("unknown preset should be rejected")
+	}
+}
+
+func TestSiteConfig_Merge_SecurityHeaders(t *testing.T) {
+	defaults := SiteConfig{SecurityHeaders: SecurityHeadersStrict}
+	if got := (SiteConfig{}).Merge(defaults).SecurityHeaders; got != SecurityHeadersStrict {
+		t.Errorf("inherited = %q, want strict", got)
+	}
+	if got := (SiteConfig{SecurityHeaders: SecurityHeadersOff}).Merge(defaults).SecurityHeaders; got != SecurityHeadersOff {
+		t.Errorf("overridden = %q, want off", got)
+	}
+}
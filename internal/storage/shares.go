@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrShareNotFound is returned for an unknown share ID.
+var ErrShareNotFound = errors.New("share not found")
+
+// sharesFile holds a site's shares, in the site directory.
+const sharesFile = "shares.json"
+
+// Share grants anyone holding Token read access to Path on a site until
+// ExpiresAt, without a view capability. A Path ending in "/" covers
+// everything below it; any other Path covers a single file.
+type Share struct {
+	ID        string     `json:"id"`
+	Token     string     `json:"token"`
+	Path      string     `json:"path"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// Active reports whether the share is neither revoked nor expired at now.
+func (sh Share) Active(now time.Time) bool {
+	return sh.RevokedAt == nil && now.Before(sh.ExpiresAt)
+}
+
+// Covers reports whether the share grants access to the site path p.
+func (sh Share) Covers(p string) bool {
+	if strings.HasSuffix(sh.Path, "/") {
+		return strings.HasPrefix(p+"/", sh.Path)
+	}
+	return p == sh.Path
+}
+
+// ValidSharePath reports whether p is a clean absolute site path.
+func ValidSharePath(p string) bool {
+	if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\\?#") {
+		return false
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean == p
+}
+
+// CreateShare adds a share for site, generating its ID and token. Path and
+// ExpiresAt must be set.
+func (s *Store) CreateShare(site string, sh Share) (Share, error) {
+	if !ValidSiteName(site) {
+		return Share{}, fmt.Errorf("invalid site name: %q", site)
+	}
+	if !ValidSharePath(sh.Path) {
+		return Share{}, fmt.Errorf("invalid share path: %q", sh.Path)
+	}
+	if _, err := os.Stat(filepath.Join(s.dataDir, "sites", site)); err != nil {
+		return Share{}, err
+	}
+	sh.ID = NewDeploymentID()
+	sh.Token = newShareToken()
+	if sh.CreatedAt.IsZero() {
+		sh.CreatedAt = time.Now().UTC()
+	}
+
+	s.sharesMu.Lock()
+	defer s.sharesMu.Unlock()
+	shares, err := s.readShares(site)
+	if err != nil {
+		return Share{}, err
+	}
+	// Drop shares that ended long enough ago not to matter for auditing.
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	kept := shares[:0]
+	for _, old := range shares {
+		ended := old.ExpiresAt
+		if old.RevokedAt != nil {
+			ended = *old.RevokedAt
+		}
+		if ended.After(cutoff) {
+			kept = append(kept, old)
+		}
+	}
+	if err := s.writeShares(site, append(kept, sh)); err != nil {
+		return Share{}, err
+	}
+	return sh, nil
+}
+
+// ListShares returns a site's shares, newest first, including expired and
+// revoked ones.
+func (s *Store) ListShares(site string) ([]Share, error) {
+	if !ValidSiteName(site) {
+		return nil, fmt.Errorf("invalid site name: %q", site)
+	}
+	s.sharesMu.Lock()
+	defer s.sharesMu.Unlock()
+	shares, err := s.readShares(site)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(shares)-1; i < j; i, j = i+1, j-1 {
+		shares[i], shares[j] = shares[j], shares[i]
+	}
+	return shares, nil
+}
+
+// RevokeShare ends a share before it expires. Revoking a revoked share
+// keeps the original revocation.
+func (s *Store) RevokeShare(site, id, by string) (Share, error) {
+	if !ValidSiteName(site) {
+		return Share{}, fmt.Errorf("invalid site name: %q", site)
+	}
+	s.sharesMu.Lock()
+	defer s.sharesMu.Unlock()
+	shares, err := s.readShares(site)
+	if err != nil {
+		return Share{}, err
+	}
+	for i := range shares {
+		if shares[i].ID != id {
+			continue
+		}
+		if shares[i].RevokedAt == nil {
+			now := time.Now().UTC()
+			shares[i].RevokedAt = &now
+			shares[i].RevokedBy = by
+			if err := s.writeShares(site, shares); err != nil {
+				return Share{}, err
+			}
+		}
+		return shares[i], nil
+	}
+	return Share{}, ErrShareNotFound
+}
+
+// LookupShare returns the active share of site with the given token.
+func (s *Store) LookupShare(site, token string) (Share, bool) {
+	if !ValidSiteName(site) || token == "" {
+		return Share{}, false
+	}
+	s.sharesMu.Lock()
+	shares, err := s.readShares(site)
+	s.sharesMu.Unlock()
+	if err != nil {
+		return Share{}, false
+	}
+	now := time.Now()
+	for _, sh := range shares {
+		if subtle.ConstantTimeCompare([]byte(sh.Token), []byte(token)) == 1 && sh.Active(now) {
+			return sh, true
+		}
+	}
+	return Share{}, false
+}
+
+func (s *Store) readShares(site string) ([]Share, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, sharesFile))
+	if os.IsNotExist(err) {
+		return []Share{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var shares []Share
+	if err := json.Unmarshal(data, &shares); err != nil {
+		return nil, fmt.Errorf("reading shares: %w", err)
+	}
+	return shares, nil
+}
+
+// writeShares replaces the shares file atomically.
+func (s *Store) writeShares(site string, shares []Share) error {
+	data, err := json.Marshal(shares)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, "sites", site, sharesFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// newShareToken returns a random URL-safe token.
+func newShareToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
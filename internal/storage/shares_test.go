@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	sh, err := s.CreateShare("docs", Share{Path: "/report.html", CreatedBy: "alice", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh.ID == "" || len(sh.Token) < 32 || sh.CreatedAt.IsZero() {
+		t.Fatalf("share = %+v", sh)
+	}
+	if got, ok := s.LookupShare("docs", sh.Token); !ok || got.ID != sh.ID {
+		t.Errorf("LookupShare = %+v, %v", got, ok)
+	}
+	if _, ok := s.LookupShare("docs", "wrong"); ok {
+		t.Error("unknown token found")
+	}
+	if _, ok := s.LookupShare("other", sh.Token); ok {
+		t.Error("token found on another site")
+	}
+
+	revoked, err := s.RevokeShare("docs", sh.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.RevokedAt == nil || revoked.RevokedBy != "bob" {
+		t.Errorf("revoked = %+v", revoked)
+	}
+	if _, ok := s.LookupShare("docs", sh.Token); ok {
+		t.Error("revoked share still found")
+	}
+	again, err := s.RevokeShare("docs", sh.ID, "carol")
+	if err != nil || again.RevokedBy != "bob" {
+		t.Errorf("revoking twice = %+v, %v", again, err)
+	}
+	if _, err := s.RevokeShare("docs", "nope", "bob"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("err = %v, want ErrShareNotFound", err)
+	}
+
+	list, err := s.ListShares("docs")
+	if err != nil || len(list) != 1 || list[0].RevokedBy != "bob" {
+		t.Errorf("ListShares = %+v, %v", list, err)
+	}
+}
+
+func TestShares_Expired(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	sh, err := s.CreateShare("docs", Share{Path: "/", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.LookupShare("docs", sh.Token); ok {
+		t.Error("expired share found")
+	}
+}
+
+func TestShares_PrunesOldShares(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	if _, err := s.CreateShare("docs", Share{Path: "/", ExpiresAt: time.Now().Add(-60 * 24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateShare("docs", Share{Path: "/a/", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := s.ListShares("docs")
+	if len(list) != 1 || list[0].Path != "/a/" {
+		t.Errorf("ListShares = %+v, want only /a/", list)
+	}
+}
+
+func TestCreateShare_Invalid(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+
+	for _, p := range []string{"", "report.html", "/a/../b", "/a//b", "/a?b"} {
+		if _, err := s.CreateShare("docs", Share{Path: p, ExpiresAt: time.Now().Add(time.Hour)}); err == nil {
+			t.Errorf("CreateShare(%q) succeeded", p)
+		}
+	}
+	if _, err := s.CreateShare("missing", Share{Path: "/", ExpiresAt: time.Now().Add(time.Hour)}); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
+
+func TestShareCovers(t *testing.T) {
+	tests := []struct {
+		share, path string
+		want        bool
+	}{
+		{"/report.html", "/report.html", true},
+		{"/report.html", "/report", false},
+		{"/report.html", "/report.html/x", false},
+		{"/docs/", "/docs", true},
+		{"/docs/", "/docs/a/b.html", true},
+		{"/docs/", "/docsx", false},
+		{"/", "/anything", true},
+	}
+	for _, tt := range tests {
+		if got := (Share{Path: tt.share}).Covers(tt.path); got != tt.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", tt.share, tt.path, got, tt.want)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package storage
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -16,26 +20,137 @@ type SiteConfig struct {
 	SPARouting       *bool                        `toml:"spa_routing"`
 	HTMLExtensions   *bool                        `toml:"html_extensions"`
 	Analytics        *bool                        `toml:"analytics"`
+	AnalyticsNotice  *bool                        `toml:"analytics_notice"`
 	DirectoryListing *bool                        `toml:"directory_listing"`
+	I18n             *bool                        `toml:"i18n"`
+	Minify           *bool                        `toml:"minify"`
+	Offline          *bool                        `toml:"offline"`
+	Indexable        *bool                        `toml:"indexable"`
+	Staging          *bool                        `toml:"staging"`
+	DefaultLanguage  string                       `toml:"default_language"`
 	IndexPage        string                       `toml:"index_page"`
 	NotFoundPage     string                       `toml:"not_found_page"`
 	TrailingSlash    string                       `toml:"trailing_slash"`
+	TransferCapMB    int64                        `toml:"transfer_cap_mb"`
+	AnomalyFactor    int                          `toml:"anomaly_factor"`
 	Headers          map[string]map[string]string `toml:"headers"`
 	Redirects        []RedirectRule               `toml:"redirects"`
+	Access           []AccessRule                 `toml:"access"`
+	Schedule         []ScheduleRule               `toml:"schedule"`
 	WebhookURL       string                       `toml:"webhook_url"`
 	WebhookEvents    []string                     `toml:"webhook_events"`
 	WebhookSecret    string                       `toml:"webhook_secret"`
+	// WebhookQuietHours is a daily period, such as "22:00-07:00" in
+	// WebhookTimezone, during which webhooks that are not critical are held
+	// back and sent together once it ends.
+	WebhookQuietHours string `toml:"webhook_quiet_hours"`
+	WebhookTimezone   string `toml:"webhook_timezone"`
+	// WebhookRateLimit is the most webhooks sent per minute; further ones
+	// are sent together once the minute is over. 0 means no limit.
+	WebhookRateLimit int                `toml:"webhook_rate_limit"`
+	Validation       UploadRules        `toml:"validation"`
+	AnalyticsTags    []AnalyticsTagRule `toml:"analytics_tags"`
+	Ephemeral        *bool              `toml:"ephemeral"`
+	AdvertiseTags    []string           `toml:"advertise_tags"`
+	HostnamePrefix   string             `toml:"hostname_prefix"`
+	HostnameSuffix   string             `toml:"hostname_suffix"`
+	ListenPorts      []int              `toml:"listen_ports"`
+	HTTPRedirect     *bool              `toml:"http_redirect"`
+	IPFamily         string             `toml:"ip_family"`
+	// MaxConnections and MaxConcurrentRequests cap the open connections
+	// and in-flight requests of the site's server; 0 means no cap.
+	MaxConnections        int `toml:"max_connections"`
+	MaxConcurrentRequests int `toml:"max_concurrent_requests"`
+	// AnalyticsSampleRate records one in N requests for assets, counting
+	// each as N; HTML pages are always recorded. 0 or 1 records all.
+	AnalyticsSampleRate int `toml:"analytics_sample_rate"`
+	// CompareURL links to a diff of two commits, named by the {from} and
+	// {to} placeholders, e.g. "https://github.com/org/repo/compare/{from}...{to}".
+	CompareURL string `toml:"compare_url"`
+	// SecurityHeaders sends a preset of security headers, "strict" or
+	// "relaxed", under the headers the config sets; "off" sends none.
+	SecurityHeaders string `toml:"security_headers"`
+	// DownloadMinKB counts responses with a file of at least this many KiB
+	// other than HTML as downloads when they are sent in full; 0 counts none.
+	DownloadMinKB int64 `toml:"download_min_kb"`
+	// PurgeWebhooks are requests sent to external caches in front of the
+	// site whenever one of its deployments is activated.
+	PurgeWebhooks []PurgeWebhook `toml:"purge_webhooks"`
+	// DisabledStages are stages of the serving pipeline requests skip,
+	// such as "analytics" for a site that only serves assets.
+	DisabledStages []string `toml:"disabled_stages"`
+	// SocialPreviews set the Open Graph and Twitter card meta tags of
+	// HTML pages by path.
+	SocialPreviews []SocialPreview `toml:"social_previews"`
 }
 
 // RedirectRule defines a single redirect from one path pattern to another.
 type RedirectRule struct {
-	From   string `toml:"from"`
-	To     string `toml:"to"`
-	Status int    `toml:"status,omitempty"`
+	From   string `toml:"from" json:"from"`
+	To     string `toml:"to" json:"to"`
+	Status int    `toml:"status,omitempty" json:"status,omitempty"`
+}
+
+// AccessRule restricts the paths matching Path to visitors who match at
+// least one of Users, Tags, or Access. Path uses the same patterns as
+// headers; "/dir/*" also covers "/dir" itself.
+type AccessRule struct {
+	Path string `toml:"path"`
+	// Users are login names, optionally with wildcards ("*@corp.example").
+	Users []string `toml:"users"`
+	// Tags are node tags of the visiting device ("tag:ci").
+	Tags []string `toml:"tags"`
+	// Access is the capability level required for the site: "view",
+	// "deploy", or "admin".
+	Access string `toml:"access"`
+}
+
+// PurgeWebhookHTTP is the type of purge webhook that sends an HTTP request
+// for each changed path, as Varnish, Fastly, and similar caches expect.
+const PurgeWebhookHTTP = "http-purge"
+
+// PurgeWebhook purges an external cache after an activation. URL may hold
+// the {site} and {path} placeholders; with {path}, one request is sent for
+// every path the activated deployment added, changed, or removed, and
+// without it a single request is sent.
+type PurgeWebhook struct {
+	Type string `toml:"type"`
+	// Method is the request method, "PURGE" by default.
+	Method string `toml:"method,omitempty"`
+	URL    string `toml:"url"`
+	// AuthHeader is a header sent with each request, such as
+	// "Authorization: Bearer <token>".
+	AuthHeader string `toml:"auth_header,omitempty"`
+}
+
+// ScheduleRule publishes the paths matching Path only between VisibleFrom
+// and VisibleUntil, so time-bound content can be deployed ahead of time.
+// Outside the window, the paths are not found. Path uses the same patterns
+// as access rules. A zero time leaves the window open on that side.
+type ScheduleRule struct {
+	Path         string    `toml:"path"`
+	VisibleFrom  time.Time `toml:"visible_from,omitempty"`
+	VisibleUntil time.Time `toml:"visible_until,omitempty"`
+}
+
+// Visible reports whether the rule's paths are published at t.
+func (r ScheduleRule) Visible(t time.Time) bool {
+	return !t.Before(r.VisibleFrom) && (r.VisibleUntil.IsZero() || t.Before(r.VisibleUntil))
 }
 
 const siteConfigFile = "config.toml"
 
+// webhookEvents are the events a site's webhook_events can name.
+var webhookEvents = []string{
+	"deploy.success",
+	"deploy.failed",
+	"site.created",
+	"site.deleted",
+	"site.transfer_cap_exceeded",
+	"analytics.anomaly",
+	"operator.alert",
+}
+
 func (c SiteConfig) Validate() error {
 	if err := validateConfigPath(c.IndexPage, "index_page"); err != nil {
 		return err
@@ -43,6 +158,9 @@ func (c SiteConfig) Validate() error {
 	if err := validateConfigPath(c.NotFoundPage, "not_found_page"); err != nil {
 		return err
 	}
+	if c.DefaultLanguage != "" && !ValidLanguageTag(c.DefaultLanguage) {
+		return fmt.Errorf("default_language: invalid language tag %q", c.DefaultLanguage)
+	}
 	if c.TrailingSlash != "" && c.TrailingSlash != "add" && c.TrailingSlash != "remove" {
 		return fmt.Errorf("trailing_slash: must be \"add\" or \"remove\", got %q", c.TrailingSlash)
 	}
@@ -95,24 +213,200 @@ func (c SiteConfig) Validate() error {
 		}
 	}
 
+	for i, rule := range c.Access {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("access %d: 'path' must start with /", i)
+		}
+		if len(rule.Users) == 0 && len(rule.Tags) == 0 && rule.Access == "" {
+			return fmt.Errorf("access %d: at least one of 'users', 'tags', or 'access' is required", i)
+		}
+		for _, user := range rule.Users {
+			if _, err := path.Match(user, ""); err != nil || user == "" {
+				return fmt.Errorf("access %d: invalid user pattern %q", i, user)
+			}
+		}
+		for _, tag := range rule.Tags {
+			if !strings.HasPrefix(tag, "tag:") {
+				return fmt.Errorf("access %d: tag %q must start with tag:", i, tag)
+			}
+		}
+		switch rule.Access {
+		case "", "view", "deploy", "admin":
+		default:
+			return fmt.Errorf("access %d: 'access' must be view, deploy, or admin, got %q", i, rule.Access)
+		}
+	}
+
+	for i, rule := range c.Schedule {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("schedule %d: 'path' must start with /", i)
+		}
+		if rule.VisibleFrom.IsZero() && rule.VisibleUntil.IsZero() {
+			return fmt.Errorf("schedule %d: at least one of 'visible_from' or 'visible_until' is required", i)
+		}
+		if !rule.VisibleFrom.IsZero() && !rule.VisibleUntil.IsZero() && !rule.VisibleUntil.After(rule.VisibleFrom) {
+			return fmt.Errorf("schedule %d: 'visible_until' must be after 'visible_from'", i)
+		}
+	}
+
+	if c.TransferCapMB < 0 {
+		return fmt.Errorf("transfer_cap_mb: must not be negative, got %d", c.TransferCapMB)
+	}
+	if c.AnomalyFactor < 0 || c.AnomalyFactor == 1 {
+		return fmt.Errorf("anomaly_factor: must be 0 or at least 2, got %d", c.AnomalyFactor)
+	}
+	if c.AnalyticsSampleRate < 0 {
+		return fmt.Errorf("analytics_sample_rate: must not be negative, got %d", c.AnalyticsSampleRate)
+	}
+
+	if err := c.Validation.Validate(); err != nil {
+		return err
+	}
+	if err := validateAnalyticsTags(c.AnalyticsTags); err != nil {
+		return err
+	}
+
+	for i, tag := range c.AdvertiseTags {
+		if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+			return fmt.Errorf("advertise_tags[%d]: tag %q must start with tag:", i, tag)
+		}
+	}
+	if c.HostnamePrefix != "" && (!validHostnamePart(c.HostnamePrefix) || c.HostnamePrefix[0] == '-') {
+		return fmt.Errorf("hostname_prefix: must be lowercase letters, digits, and hyphens, not starting with a hyphen, got %q", c.HostnamePrefix)
+	}
+	if c.HostnameSuffix != "" && (!validHostnamePart(c.HostnameSuffix) || strings.HasSuffix(c.HostnameSuffix, "-")) {
+		return fmt.Errorf("hostname_suffix: must be lowercase letters, digits, and hyphens, not ending with a hyphen, got %q", c.HostnameSuffix)
+	}
+
+	for i, port := range c.ListenPorts {
+		if port < 1 || port > 65535 || port == 80 || port == 443 {
+			return fmt.Errorf("listen_ports[%d]: must be a port other than 80 and 443, got %d", i, port)
+		}
+	}
+	if c.IPFamily != "" && c.IPFamily != "ipv4" && c.IPFamily != "ipv6" {
+		return fmt.Errorf("ip_family: must be \"ipv4\" or \"ipv6\", got %q", c.IPFamily)
+	}
+	if c.MaxConnections < 0 {
+		return fmt.Errorf("max_connections: must not be negative, got %d", c.MaxConnections)
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests: must not be negative, got %d", c.MaxConcurrentRequests)
+	}
+
+	if c.CompareURL != "" {
+		if !strings.HasPrefix(c.CompareURL, "http://") && !strings.HasPrefix(c.CompareURL, "https://") {
+			return fmt.Errorf("compare_url: must start with http:// or https://, got %q", c.CompareURL)
+		}
+		if !strings.Contains(c.CompareURL, "{from}") || !strings.Contains(c.CompareURL, "{to}") {
+			return fmt.Errorf("compare_url: must contain {from} and {to}, got %q", c.CompareURL)
+		}
+	}
+
+	if c.DownloadMinKB < 0 {
+		return fmt.Errorf("download_min_kb: must not be negative, got %d", c.DownloadMinKB)
+	}
+
+	switch c.SecurityHeaders {
+	case "", SecurityHeadersStrict, SecurityHeadersRelaxed, SecurityHeadersOff:
+	default:
+		return fmt.Errorf("security_headers: must be %q, %q, or %q, got %q",
+			SecurityHeadersStrict, SecurityHeadersRelaxed, SecurityHeadersOff, c.SecurityHeaders)
+	}
+
 	if c.WebhookURL != "" && !strings.HasPrefix(c.WebhookURL, "http://") && !strings.HasPrefix(c.WebhookURL, "https://") {
 		return fmt.Errorf("webhook_url: must start with http:// or https://, got %q", c.WebhookURL)
 	}
-	validEvents := map[string]bool{
-		"deploy.success": true,
-		"deploy.failed":  true,
-		"site.created":   true,
-		"site.deleted":   true,
-	}
 	for i, ev := range c.WebhookEvents {
-		if !validEvents[ev] {
+		if !slices.Contains(webhookEvents, ev) {
 			return fmt.Errorf("webhook_events[%d]: unknown event %q", i, ev)
 		}
 	}
+	if c.WebhookQuietHours != "" {
+		if _, err := ParseQuietHours(c.WebhookQuietHours); err != nil {
+			return fmt.Errorf("webhook_quiet_hours: %w", err)
+		}
+	}
+	if c.WebhookTimezone != "" {
+		if _, err := time.LoadLocation(c.WebhookTimezone); err != nil {
+			return fmt.Errorf("webhook_timezone: %q is not an IANA timezone name", c.WebhookTimezone)
+		}
+	}
+	if c.WebhookRateLimit < 0 {
+		return fmt.Errorf("webhook_rate_limit: must not be negative, got %d", c.WebhookRateLimit)
+	}
+	for i, p := range c.PurgeWebhooks {
+		if p.Type != PurgeWebhookHTTP {
+			return fmt.Errorf("purge_webhooks %d: 'type' must be %q, got %q", i, PurgeWebhookHTTP, p.Type)
+		}
+		if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+			return fmt.Errorf("purge_webhooks %d: 'url' must start with http:// or https://, got %q", i, p.URL)
+		}
+		if p.Method != "" && strings.ContainsFunc(p.Method, func(r rune) bool { return r < 'A' || r > 'Z' }) {
+			return fmt.Errorf("purge_webhooks %d: 'method' must be an upper-case HTTP method, got %q", i, p.Method)
+		}
+		if p.AuthHeader != "" {
+			name, value, ok := strings.Cut(p.AuthHeader, ":")
+			if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" || strings.ContainsAny(p.AuthHeader, "\r\n") {
+				return fmt.Errorf("purge_webhooks %d: 'auth_header' must be of the form \"Name: value\"", i)
+			}
+		}
+	}
+	for i, stage := range c.DisabledStages {
+		if stage == StageAuth {
+			return fmt.Errorf("disabled_stages[%d]: %q cannot be disabled", i, stage)
+		}
+		if !slices.Contains(ServeStages, stage) {
+			return fmt.Errorf("disabled_stages[%d]: unknown stage %q", i, stage)
+		}
+	}
+	if err := validateSocialPreviews(c.SocialPreviews); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// validHostnamePart reports whether s may be part of a DNS label that
+// also holds a site name.
+func validHostnamePart(s string) bool {
+	if len(s) >= 63 {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Hostname returns the tailnet hostname of site's server: the site name
+// between HostnamePrefix and HostnameSuffix.
+func (c SiteConfig) Hostname(site string) string {
+	return c.HostnamePrefix + site + c.HostnameSuffix
+}
+
+// ValidLanguageTag reports whether tag looks like a BCP 47 language tag: a
+// primary language subtag of 2-3 ASCII letters, followed by hyphen-separated
+// subtags of 1-8 ASCII letters or digits (e.g. "en", "de-AT", "zh-Hant").
+// Other words, like directory names, are not language tags. Tags that pass
+// are safe to use as path components.
+func ValidLanguageTag(tag string) bool {
+	for i, sub := range strings.Split(tag, "-") {
+		if sub == "" || len(sub) > 8 || i == 0 && (len(sub) < 2 || len(sub) > 3) {
+			return false
+		}
+		for _, c := range sub {
+			isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			isDigit := c >= '0' && c <= '9'
+			if !isLetter && (i == 0 || !isDigit) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func extractParams(pattern string) map[string]bool {
 	params := make(map[string]bool)
 	for _, seg := range strings.Split(pattern, "/") {
@@ -237,6 +531,24 @@ func (s *Store) ReadSiteConfig(site, id string) (SiteConfig, error) {
 	return ParseSiteConfig(data)
 }
 
+// ChangedFields returns the tspages.toml names of the settings that differ
+// between c and other, such as "spa_routing" or "headers". Empty and
+// missing lists count as equal.
+func (c SiteConfig) ChangedFields(other SiteConfig) []string {
+	a, b := reflect.ValueOf(c), reflect.ValueOf(other)
+	var changed []string
+	for i := range a.NumField() {
+		x, y := a.Field(i), b.Field(i)
+		if (x.Kind() == reflect.Slice || x.Kind() == reflect.Map) && x.Len() == 0 && y.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(x.Interface(), y.Interface()) {
+			changed = append(changed, a.Type().Field(i).Tag.Get("toml"))
+		}
+	}
+	return changed
+}
+
 // Merge returns a new SiteConfig with deployment values (c) taking priority over defaults.
 // For *bool fields, nil means "use default", non-nil overrides.
 // For string fields, empty means "use default", non-empty overrides.
@@ -256,9 +568,30 @@ func (c SiteConfig) Merge(defaults SiteConfig) SiteConfig {
 	if c.Analytics != nil {
 		merged.Analytics = c.Analytics
 	}
+	if c.AnalyticsNotice != nil {
+		merged.AnalyticsNotice = c.AnalyticsNotice
+	}
 	if c.DirectoryListing != nil {
 		merged.DirectoryListing = c.DirectoryListing
 	}
+	if c.I18n != nil {
+		merged.I18n = c.I18n
+	}
+	if c.Minify != nil {
+		merged.Minify = c.Minify
+	}
+	if c.Offline != nil {
+		merged.Offline = c.Offline
+	}
+	if c.Indexable != nil {
+		merged.Indexable = c.Indexable
+	}
+	if c.Staging != nil {
+		merged.Staging = c.Staging
+	}
+	if c.DefaultLanguage != "" {
+		merged.DefaultLanguage = c.DefaultLanguage
+	}
 	if c.IndexPage != "" {
 		merged.IndexPage = c.IndexPage
 	}
@@ -268,6 +601,15 @@ func (c SiteConfig) Merge(defaults SiteConfig) SiteConfig {
 	if c.TrailingSlash != "" {
 		merged.TrailingSlash = c.TrailingSlash
 	}
+	if c.TransferCapMB != 0 {
+		merged.TransferCapMB = c.TransferCapMB
+	}
+	if c.AnomalyFactor != 0 {
+		merged.AnomalyFactor = c.AnomalyFactor
+	}
+	if c.AnalyticsSampleRate != 0 {
+		merged.AnalyticsSampleRate = c.AnalyticsSampleRate
+	}
 
 	// Deep-copy headers to avoid mutating the defaults map.
 	if defaults.Headers != nil || c.Headers != nil {
@@ -292,10 +634,76 @@ func (c SiteConfig) Merge(defaults SiteConfig) SiteConfig {
 		merged.Redirects = c.Redirects
 	}
 
+	// Access rules accumulate, so a deployment can add restrictions but
+	// never lift the server's.
+	if len(defaults.Access) > 0 || len(c.Access) > 0 {
+		merged.Access = append(append([]AccessRule(nil), defaults.Access...), c.Access...)
+	}
+
+	if c.Schedule != nil {
+		merged.Schedule = c.Schedule
+	}
+
+	// Upload rules accumulate like access rules.
+	merged.Validation = c.Validation.Tighten(defaults.Validation)
+
+	if c.AnalyticsTags != nil {
+		merged.AnalyticsTags = c.AnalyticsTags
+	}
+
+	if c.Ephemeral != nil {
+		merged.Ephemeral = c.Ephemeral
+	}
+	if c.AdvertiseTags != nil {
+		merged.AdvertiseTags = c.AdvertiseTags
+	}
+	if c.HostnamePrefix != "" {
+		merged.HostnamePrefix = c.HostnamePrefix
+	}
+	if c.HostnameSuffix != "" {
+		merged.HostnameSuffix = c.HostnameSuffix
+	}
+	if c.ListenPorts != nil {
+		merged.ListenPorts = c.ListenPorts
+	}
+	if c.HTTPRedirect != nil {
+		merged.HTTPRedirect = c.HTTPRedirect
+	}
+	if c.IPFamily != "" {
+		merged.IPFamily = c.IPFamily
+	}
+	if c.MaxConnections != 0 {
+		merged.MaxConnections = c.MaxConnections
+	}
+	if c.MaxConcurrentRequests != 0 {
+		merged.MaxConcurrentRequests = c.MaxConcurrentRequests
+	}
+	if c.CompareURL != "" {
+		merged.CompareURL = c.CompareURL
+	}
+	if c.SecurityHeaders != "" {
+		merged.SecurityHeaders = c.SecurityHeaders
+	}
+	if c.DownloadMinKB != 0 {
+		merged.DownloadMinKB = c.DownloadMinKB
+	}
+
 	if c.WebhookURL != "" {
 		merged.WebhookURL = c.WebhookURL
 		merged.WebhookEvents = c.WebhookEvents
 		merged.WebhookSecret = c.WebhookSecret
+		merged.WebhookQuietHours = c.WebhookQuietHours
+		merged.WebhookTimezone = c.WebhookTimezone
+		merged.WebhookRateLimit = c.WebhookRateLimit
+	}
+	if c.PurgeWebhooks != nil {
+		merged.PurgeWebhooks = c.PurgeWebhooks
+	}
+	if c.DisabledStages != nil {
+		merged.DisabledStages = c.DisabledStages
+	}
+	if c.SocialPreviews != nil {
+		merged.SocialPreviews = c.SocialPreviews
 	}
 
 	return merged
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseSiteConfig_Full(t *testing.T) {
@@ -193,9 +196,10 @@ func TestSiteConfig_Merge(t *testing.T) {
 
 func TestSiteConfig_Merge_EmptyDeployment(t *testing.T) {
 	defaults := SiteConfig{
-		SPARouting: boolPtr(true),
-		Analytics:  boolPtr(true),
-		IndexPage:  "home.html",
+		SPARouting:      boolPtr(true),
+		Analytics:       boolPtr(true),
+		AnalyticsNotice: boolPtr(true),
+		IndexPage:       "home.html",
 	}
 	deploy := SiteConfig{} // all zero values
 
@@ -206,6 +210,9 @@ func TestSiteConfig_Merge_EmptyDeployment(t *testing.T) {
 	if merged.Analytics == nil || *merged.Analytics != true {
 		t.Error("should inherit analytics from defaults")
 	}
+	if merged.AnalyticsNotice == nil || *merged.AnalyticsNotice != true {
+		t.Error("should inherit analytics_notice from defaults")
+	}
 	if merged.IndexPage != "home.html" {
 		t.Errorf("index_page = %q, want home.html", merged.IndexPage)
 	}
@@ -622,6 +629,87 @@ func TestSiteConfig_Merge_TrailingSlash(t *testing.T) {
 	}
 }
 
+func TestSiteConfig_TransferCap(t *testing.T) {
+	cfg, err := ParseSiteConfig([]byte("transfer_cap_mb = 5120\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TransferCapMB != 5120 {
+		t.Errorf("transfer_cap_mb = %d", cfg.TransferCapMB)
+	}
+	if err := (SiteConfig{TransferCapMB: -1}).Validate(); err == nil {
+		t.Error("negative cap accepted")
+	}
+
+	defaults := SiteConfig{TransferCapMB: 100}
+	if got := (SiteConfig{}).Merge(defaults).TransferCapMB; got != 100 {
+		t.Errorf("inherited cap = %d, want 100", got)
+	}
+	if got := cfg.Merge(defaults).TransferCapMB; got != 5120 {
+		t.Errorf("overridden cap = %d, want 5120", got)
+	}
+}
+
+func TestSiteConfig_AnomalyFactor(t *testing.T) {
+	cfg, err := ParseSiteConfig([]byte("anomaly_factor = 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AnomalyFactor != 3 {
+		t.Errorf("anomaly_factor = %d", cfg.AnomalyFactor)
+	}
+	for _, factor := range []int{-1, 1} {
+		if err := (SiteConfig{AnomalyFactor: factor}).Validate(); err == nil {
+			t.Errorf("anomaly_factor = %d accepted", factor)
+		}
+	}
+
+	defaults := SiteConfig{AnomalyFactor: 5}
+	if got := (SiteConfig{}).Merge(defaults).AnomalyFactor; got != 5 {
+		t.Errorf("inherited factor = %d, want 5", got)
+	}
+	if got := cfg.Merge(defaults).AnomalyFactor; got != 3 {
+		t.Errorf("overridden factor = %d, want 3", got)
+	}
+}
+
+func TestSiteConfig_AnalyticsSampleRate(t *testing.T) {
+	cfg, err := ParseSiteConfig([]byte("analytics_sample_rate = 10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AnalyticsSampleRate != 10 {
+		t.Errorf("analytics_sample_rate = %d", cfg.AnalyticsSampleRate)
+	}
+	if err := (SiteConfig{AnalyticsSampleRate: -1}).Validate(); err == nil {
+		t.Error("negative analytics_sample_rate accepted")
+	}
+
+	defaults := SiteConfig{AnalyticsSampleRate: 5}
+	if got := (SiteConfig{}).Merge(defaults).AnalyticsSampleRate; got != 5 {
+		t.Errorf("inherited rate = %d, want 5", got)
+	}
+	if got := (SiteConfig{AnalyticsSampleRate: 1}).Merge(defaults).AnalyticsSampleRate; got != 1 {
+		t.Errorf("overridden rate = %d, want 1", got)
+	}
+}
+
+func TestSiteConfig_DownloadMinKB(t *testing.T) {
+	cfg, err := ParseSiteConfig([]byte("download_min_kb = 1024\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DownloadMinKB != 1024 {
+		t.Errorf("download_min_kb = %d", cfg.DownloadMinKB)
+	}
+	if err := (SiteConfig{DownloadMinKB: -1}).Validate(); err == nil {
+		t.Error("negative download_min_kb accepted")
+	}
+	if got := (SiteConfig{}).Merge(SiteConfig{DownloadMinKB: 64}).DownloadMinKB; got != 64 {
+		t.Errorf("inherited download_min_kb = %d, want 64", got)
+	}
+}
+
 func TestParseSiteConfig_Webhook(t *testing.T) {
 	input := `
 webhook_url = "https://example.com/hook"
@@ -676,7 +764,7 @@ func TestValidateSiteConfig_WebhookEvents(t *testing.T) {
 		{"nil", nil, false},
 		{"empty", []string{}, false},
 		{"valid single", []string{"deploy.success"}, false},
-		{"valid all", []string{"deploy.success", "deploy.failed", "site.created", "site.deleted"}, false},
+		{"valid all", []string{"deploy.success", "deploy.failed", "site.created", "site.deleted", "site.transfer_cap_exceeded", "operator.alert"}, false},
 		{"unknown event", []string{"deploy.success", "deploy.started"}, true},
 		{"empty string event", []string{""}, true},
 	}
@@ -691,6 +779,31 @@ func TestValidateSiteConfig_WebhookEvents(t *testing.T) {
 	}
 }
 
+func TestValidateSiteConfig_PurgeWebhooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    PurgeWebhook
+		wantErr bool
+	}{
+		{"valid", PurgeWebhook{Type: "http-purge", URL: "https://cache.example.com/{site}{path}"}, false},
+		{"method and header", PurgeWebhook{Type: "http-purge", Method: "BAN", URL: "http://cache/{path}", AuthHeader: "X-Token: secret"}, false},
+		{"unknown type", PurgeWebhook{Type: "cloudflare", URL: "https://cache.example.com/"}, true},
+		{"no url", PurgeWebhook{Type: "http-purge"}, true},
+		{"lower-case method", PurgeWebhook{Type: "http-purge", Method: "purge", URL: "https://cache.example.com/"}, true},
+		{"header without value", PurgeWebhook{Type: "http-purge", URL: "https://cache.example.com/", AuthHeader: "Authorization"}, true},
+		{"header with newline", PurgeWebhook{Type: "http-purge", URL: "https://cache.example.com/", AuthHeader: "A: b\r\nC: d"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := SiteConfig{PurgeWebhooks: []PurgeWebhook{tt.hook}}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestSiteConfig_Merge_WebhookOverride(t *testing.T) {
 	defaults := SiteConfig{
 		WebhookURL:    "https://global.example.com/hook",
@@ -767,3 +880,287 @@ func TestSiteConfig_Merge_WebhookInherit(t *testing.T) {
 		t.Errorf("webhook_secret = %q, want global-secret", merged.WebhookSecret)
 	}
 }
+
+func TestValidateSiteConfig_DefaultLanguage(t *testing.T) {
+	for _, tag := range []string{"en", "de-AT", "zh-Hant", "es-419"} {
+		if err := (SiteConfig{DefaultLanguage: tag}).Validate(); err != nil {
+			t.Errorf("default_language %q: unexpected error: %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"-en", "en-", "../de", "de_AT", "123", "toolongtag", "d", "docs", "internal"} {
+		if err := (SiteConfig{DefaultLanguage: tag}).Validate(); err == nil {
+			t.Errorf("default_language %q: expected error", tag)
+		}
+	}
+}
+
+func TestSiteConfig_Merge_I18n(t *testing.T) {
+	defaults := SiteConfig{I18n: boolPtr(true), DefaultLanguage: "en"}
+	merged := SiteConfig{DefaultLanguage: "de"}.Merge(defaults)
+	if merged.I18n == nil || !*merged.I18n {
+		t.Error("i18n should inherit true from defaults")
+	}
+	if merged.DefaultLanguage != "de" {
+		t.Errorf("default_language = %q, want de", merged.DefaultLanguage)
+	}
+}
+
+func TestSiteConfig_Merge_Offline(t *testing.T) {
+	merged := SiteConfig{}.Merge(SiteConfig{Offline: boolPtr(true)})
+	if merged.Offline == nil || !*merged.Offline {
+		t.Error("offline should inherit true from defaults")
+	}
+	merged = SiteConfig{Offline: boolPtr(false)}.Merge(SiteConfig{Offline: boolPtr(true)})
+	if merged.Offline == nil || *merged.Offline {
+		t.Error("deployment offline = false should override defaults")
+	}
+}
+
+func TestSiteConfig_Merge_Minify(t *testing.T) {
+	merged := SiteConfig{}.Merge(SiteConfig{Minify: boolPtr(true)})
+	if merged.Minify == nil || !*merged.Minify {
+		t.Error("minify should inherit true from defaults")
+	}
+	merged = SiteConfig{Minify: boolPtr(false)}.Merge(SiteConfig{Minify: boolPtr(true)})
+	if merged.Minify == nil || *merged.Minify {
+		t.Error("deployment minify = false should override defaults")
+	}
+}
+
+func TestParseSiteConfig_Access(t *testing.T) {
+	input := `
+[[access]]
+path = "/internal/*"
+access = "admin"
+
+[[access]]
+path = "/reports/*"
+users = ["*@corp.example"]
+tags = ["tag:ci"]
+`
+	cfg, err := ParseSiteConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(cfg.Access) != 2 || cfg.Access[0].Access != "admin" || cfg.Access[1].Users[0] != "*@corp.example" || cfg.Access[1].Tags[0] != "tag:ci" {
+		t.Errorf("access = %+v", cfg.Access)
+	}
+}
+
+func TestValidateSiteConfig_Access(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AccessRule
+		wantErr bool
+	}{
+		{"access level", AccessRule{Path: "/internal/*", Access: "admin"}, false},
+		{"users", AccessRule{Path: "/hr/*", Users: []string{"alice@corp.example"}}, false},
+		{"tags", AccessRule{Path: "/ci/*", Tags: []string{"tag:ci"}}, false},
+		{"no slash", AccessRule{Path: "internal/*", Access: "view"}, true},
+		{"nobody", AccessRule{Path: "/internal/*"}, true},
+		{"unknown level", AccessRule{Path: "/internal/*", Access: "owner"}, true},
+		{"bad pattern", AccessRule{Path: "/internal/*", Users: []string{"[a"}}, true},
+		{"empty user", AccessRule{Path: "/internal/*", Users: []string{""}}, true},
+		{"bare tag", AccessRule{Path: "/internal/*", Tags: []string{"ci"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := SiteConfig{Access: []AccessRule{tt.rule}}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSiteConfig_Merge_Access(t *testing.T) {
+	defaults := SiteConfig{Access: []AccessRule{{Path: "/admin/*", Access: "admin"}}}
+	deploy := SiteConfig{Access: []AccessRule{{Path: "/team/*", Users: []string{"*@corp.example"}}}}
+
+	merged := deploy.Merge(defaults)
+	if len(merged.Access) != 2 || merged.Access[0].Path != "/admin/*" || merged.Access[1].Path != "/team/*" {
+		t.Errorf("access = %+v, want defaults followed by deployment rules", merged.Access)
+	}
+	if len(defaults.Access) != 1 {
+		t.Error("merge mutated defaults")
+	}
+}
+
+func TestParseSiteConfig_Schedule(t *testing.T) {
+	input := `
+[[schedule]]
+path = "/announcement*"
+visible_from = 2026-03-01T09:00:00+01:00
+visible_until = 2026-03-08T00:00:00Z
+`
+	cfg, err := ParseSiteConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(cfg.Schedule) != 1 || !cfg.Schedule[0].VisibleFrom.Equal(time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("schedule = %+v", cfg.Schedule)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestValidateSiteConfig_Schedule(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	tests := []struct {
+		name    string
+		rule    ScheduleRule
+		wantErr bool
+	}{
+		{"window", ScheduleRule{Path: "/sale/*", VisibleFrom: from, VisibleUntil: until}, false},
+		{"from only", ScheduleRule{Path: "/launch.html", VisibleFrom: from}, false},
+		{"until only", ScheduleRule{Path: "/beta.html", VisibleUntil: until}, false},
+		{"no slash", ScheduleRule{Path: "sale/*", VisibleFrom: from}, true},
+		{"no times", ScheduleRule{Path: "/sale/*"}, true},
+		{"until before from", ScheduleRule{Path: "/sale/*", VisibleFrom: until, VisibleUntil: from}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := SiteConfig{Schedule: []ScheduleRule{tt.rule}}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleRule_Visible(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	rule := ScheduleRule{Path: "/sale/*", VisibleFrom: from, VisibleUntil: until}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{from.Add(-time.Second), false},
+		{from, true},
+		{until.Add(-time.Second), true},
+		{until, false},
+	}
+	for _, tt := range tests {
+		if got := rule.Visible(tt.at); got != tt.want {
+			t.Errorf("Visible(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	if !(ScheduleRule{VisibleUntil: until}).Visible(from) {
+		t.Error("rule without visible_from hides paths before visible_until")
+	}
+	if !(ScheduleRule{VisibleFrom: from}).Visible(until.AddDate(10, 0, 0)) {
+		t.Error("rule without visible_until hides paths after visible_from")
+	}
+}
+
+func TestSiteConfig_Merge_Schedule(t *testing.T) {
+	until := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	defaults := SiteConfig{Schedule: []ScheduleRule{{Path: "/beta/*", VisibleUntil: until}}}
+
+	if merged := (SiteConfig{}).Merge(defaults); len(merged.Schedule) != 1 {
+		t.Errorf("schedule = %+v, want the defaults", merged.Schedule)
+	}
+	deploy := SiteConfig{Schedule: []ScheduleRule{{Path: "/sale/*", VisibleUntil: until}}}
+	if merged := deploy.Merge(defaults); len(merged.Schedule) != 1 || merged.Schedule[0].Path != "/sale/*" {
+		t.Errorf("schedule = %+v, want the deployment's rules", merged.Schedule)
+	}
+}
+
+func TestSiteConfig_ChangedFields(t *testing.T) {
+	old := SiteConfig{SPARouting: boolPtr(true), Headers: map[string]map[string]string{}}
+	cfg := SiteConfig{SPARouting: boolPtr(true), IndexPage: "home.html", Redirects: []RedirectRule{{From: "/a", To: "/b"}}}
+
+	got := cfg.ChangedFields(old)
+	if len(got) != 2 || got[0] != "index_page" || got[1] != "redirects" {
+		t.Errorf("ChangedFields = %v, want [index_page redirects]", got)
+	}
+	if got := cfg.ChangedFields(cfg); len(got) != 0 {
+		t.Errorf("ChangedFields of itself = %v", got)
+	}
+}
+
+func TestValidateSiteConfig_Node(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SiteConfig
+		wantErr bool
+	}{
+		{"tags", SiteConfig{AdvertiseTags: []string{"tag:pages-public", "tag:docs"}}, false},
+		{"bare tag", SiteConfig{AdvertiseTags: []string{"pages"}}, true},
+		{"empty tag", SiteConfig{AdvertiseTags: []string{"tag:"}}, true},
+		{"prefix", SiteConfig{HostnamePrefix: "pages-"}, false},
+		{"suffix", SiteConfig{HostnameSuffix: "-pages"}, false},
+		{"prefix with leading hyphen", SiteConfig{HostnamePrefix: "-pages"}, true},
+		{"suffix with trailing hyphen", SiteConfig{HostnameSuffix: "pages-"}, true},
+		{"uppercase", SiteConfig{HostnamePrefix: "Pages-"}, true},
+		{"dot", SiteConfig{HostnameSuffix: ".pages"}, true},
+		{"too long", SiteConfig{HostnamePrefix: strings.Repeat("a", 63)}, true},
+		{"ports", SiteConfig{ListenPorts: []int{8443, 8080}}, false},
+		{"port 80", SiteConfig{ListenPorts: []int{80}}, true},
+		{"port 443", SiteConfig{ListenPorts: []int{443}}, true},
+		{"port out of range", SiteConfig{ListenPorts: []int{70000}}, true},
+		{"ipv6", SiteConfig{IPFamily: "ipv6"}, false},
+		{"unknown family", SiteConfig{IPFamily: "ipx"}, true},
+		{"caps", SiteConfig{MaxConnections: 100, MaxConcurrentRequests: 50}, false},
+		{"negative max_connections", SiteConfig{MaxConnections: -1}, true},
+		{"negative max_concurrent_requests", SiteConfig{MaxConcurrentRequests: -1}, true},
+		{"compare url", SiteConfig{CompareURL: "https://github.com/org/repo/compare/{from}...{to}"}, false},
+		{"compare url without placeholders", SiteConfig{CompareURL: "https://github.com/org/repo/compare"}, true},
+		{"compare url without scheme", SiteConfig{CompareURL: "github.com/org/repo/compare/{from}...{to}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSiteConfig_Merge_Node(t *testing.T) {
+	yes, no := true, false
+	defaults := SiteConfig{
+		Ephemeral:      &yes,
+		AdvertiseTags:  []string{"tag:pages-internal"},
+		HostnamePrefix: "pages-",
+	}
+
+	merged := SiteConfig{}.Merge(defaults)
+	if !*merged.Ephemeral || !slices.Equal(merged.AdvertiseTags, []string{"tag:pages-internal"}) {
+		t.Errorf("should inherit node settings, got %+v", merged)
+	}
+	if got := merged.Hostname("docs"); got != "pages-docs" {
+		t.Errorf("Hostname = %q, want pages-docs", got)
+	}
+
+	merged = SiteConfig{
+		Ephemeral:      &no,
+		AdvertiseTags:  []string{"tag:pages-public"},
+		HostnameSuffix: "-web",
+	}.Merge(defaults)
+	if *merged.Ephemeral || !slices.Equal(merged.AdvertiseTags, []string{"tag:pages-public"}) {
+		t.Errorf("deployment should override node settings, got %+v", merged)
+	}
+	if got := merged.Hostname("docs"); got != "pages-docs-web" {
+		t.Errorf("Hostname = %q, want pages-docs-web", got)
+	}
+}
+
+func TestSiteConfig_Merge_Caps(t *testing.T) {
+	defaults := SiteConfig{MaxConnections: 200, MaxConcurrentRequests: 100}
+
+	merged := SiteConfig{}.Merge(defaults)
+	if merged.MaxConnections != 200 || merged.MaxConcurrentRequests != 100 {
+		t.Errorf("should inherit caps, got %d and %d", merged.MaxConnections, merged.MaxConcurrentRequests)
+	}
+	merged = SiteConfig{MaxConcurrentRequests: 10}.Merge(defaults)
+	if merged.MaxConnections != 200 || merged.MaxConcurrentRequests != 10 {
+		t.Errorf("deployment should override non-zero caps, got %d and %d", merged.MaxConnections, merged.MaxConcurrentRequests)
+	}
+}
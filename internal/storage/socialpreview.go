@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSocialPreviews caps the social preview rules of a site.
+const maxSocialPreviews = 50
+
+// SocialPreview sets the Open Graph and Twitter card meta tags of the HTML
+// pages whose path matches Path, for link previews in chat tools. Path
+// takes the same patterns as headers: "/*", "/*.ext", "/dir/*", or an
+// exact path. When several rules match, each field is taken from the last
+// one that sets it.
+type SocialPreview struct {
+	Path        string `toml:"path"`
+	Title       string `toml:"title"`
+	Description string `toml:"description"`
+	// Image is an absolute URL, or a path on the site that is resolved
+	// against the host the page was requested on.
+	Image string `toml:"image"`
+	// Type is the og:type, such as "article"; "website" when empty.
+	Type string `toml:"type"`
+}
+
+func validateSocialPreviews(rules []SocialPreview) error {
+	if len(rules) > maxSocialPreviews {
+		return fmt.Errorf("social_previews: at most %d rules are allowed, got %d", maxSocialPreviews, len(rules))
+	}
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("social_previews %d: 'path' must start with /, got %q", i, rule.Path)
+		}
+		if rule.Title == "" && rule.Description == "" && rule.Image == "" && rule.Type == "" {
+			return fmt.Errorf("social_previews %d: at least one of 'title', 'description', 'image', or 'type' is required", i)
+		}
+		if len(rule.Title) > 200 {
+			return fmt.Errorf("social_previews %d: 'title' must be at most 200 bytes", i)
+		}
+		if len(rule.Description) > 1000 {
+			return fmt.Errorf("social_previews %d: 'description' must be at most 1000 bytes", i)
+		}
+		if rule.Image != "" && !strings.HasPrefix(rule.Image, "/") &&
+			!strings.HasPrefix(rule.Image, "https://") && !strings.HasPrefix(rule.Image, "http://") {
+			return fmt.Errorf("social_previews %d: 'image' must be a path starting with / or an http(s) URL, got %q", i, rule.Image)
+		}
+		if strings.ContainsFunc(rule.Type, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r == '.' || r == '_') }) {
+			return fmt.Errorf("social_previews %d: 'type' must be an Open Graph type such as \"article\", got %q", i, rule.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSocialPreviews(t *testing.T) {
+	valid := []SocialPreview{
+		{Path: "/*", Title: "Docs", Image: "/og.png"},
+		{Path: "/blog/*", Type: "article", Image: "https://cdn.example.com/blog.png"},
+	}
+	if err := (SiteConfig{SocialPreviews: valid}).Validate(); err != nil {
+		t.Errorf("valid rules: %v", err)
+	}
+	for name, rule := range map[string]SocialPreview{
+		"relative path":  {Path: "blog/*", Title: "Blog"},
+		"nothing set":    {Path: "/*"},
+		"relative image": {Path: "/*", Image: "og.png"},
+		"image scheme":   {Path: "/*", Image: "javascript:alert(1)"},
+		"type":           {Path: "/*", Type: "Article!"},
+		"long title":     {Path: "/*", Title: strings.Repeat("x", 201)},
+	} {
+		if err := (SiteConfig{SocialPreviews: []SocialPreview{rule}}).Validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "slices"
+
+// Stages of the pipeline a site's requests pass through.
+const (
+	StageAuth        = "auth"
+	StageRedirects   = "redirects"
+	StageHeaders     = "headers"
+	StageCache       = "cache"
+	StageCompression = "compression"
+	StageAnalytics   = "analytics"
+)
+
+// ServeStages are the stages of the serving pipeline, in the order a
+// request passes through them. Every stage but auth can be disabled with
+// disabled_stages.
+var ServeStages = []string{
+	StageAuth, StageRedirects, StageHeaders, StageCache, StageCompression, StageAnalytics,
+}
+
+// StageEnabled reports whether requests pass through stage, that is, it is
+// not one of the config's disabled stages. Auth is always enabled.
+func (c SiteConfig) StageEnabled(stage string) bool {
+	return stage == StageAuth || !slices.Contains(c.DisabledStages, stage)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import "testing"
+
+func TestSiteConfig_StageEnabled(t *testing.T) {
+	cfg := SiteConfig{DisabledStages: []string{StageAnalytics, StageCompression}}
+	for _, stage := range ServeStages {
+		want := stage != StageAnalytics && stage != StageCompression
+		if got := cfg.StageEnabled(stage); got != want {
+			t.Errorf("StageEnabled(%q) = %v, want %v", stage, got, want)
+		}
+	}
+	if !(SiteConfig{DisabledStages: []string{StageAuth}}).StageEnabled(StageAuth) {
+		t.Error("auth must always be enabled")
+	}
+}
+
+func TestValidateSiteConfig_DisabledStages(t *testing.T) {
+	if err := (SiteConfig{DisabledStages: []string{StageAnalytics, StageCache}}).Validate(); err != nil {
+		t.Errorf("valid stages: %v", err)
+	}
+	for _, stage := range []string{StageAuth, "gzip", ""} {
+		if err := (SiteConfig{DisabledStages: []string{stage}}).Validate(); err == nil {
+			t.Errorf("%q should be rejected", stage)
+		}
+	}
+}
+
+func TestSiteConfig_Merge_DisabledStages(t *testing.T) {
+	defaults := SiteConfig{DisabledStages: []string{StageAnalytics}}
+	if got := (SiteConfig{}).Merge(defaults); got.StageEnabled(StageAnalytics) {
+		t.Error("inherited analytics stage is enabled")
+	}
+	if got := (SiteConfig{DisabledStages: []string{}}).Merge(defaults); !got.StageEnabled(StageAnalytics) {
+		t.Error("an empty list should enable all stages again")
+	}
+}
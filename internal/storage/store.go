@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,7 +25,13 @@ var (
 )
 
 type Store struct {
-	dataDir string
+	dataDir   string
+	sharesMu  sync.Mutex // serializes updates to shares files
+	prefsMu   sync.Mutex // serializes updates to the preferences file
+	filtersMu sync.Mutex // serializes updates to the saved filters file
+
+	activityMu sync.Mutex // serializes updates to activity logs
+	chainMu    sync.Mutex // serializes updates to deployment chains
 }
 
 type SiteInfo struct {
@@ -109,6 +116,9 @@ func (s *Store) CreateDeployment(site, id string) (string, error) {
 	if !ValidSiteName(site) {
 		return "", fmt.Errorf("invalid site name: %q", site)
 	}
+	if s.SiteArchived(site) {
+		return "", ErrSiteArchived
+	}
 	parent := filepath.Join(s.dataDir, "sites", site, "deployments")
 	if err := os.MkdirAll(parent, 0755); err != nil {
 		return "", fmt.Errorf("create deployments dir: %w", err)
@@ -123,9 +133,28 @@ func (s *Store) CreateDeployment(site, id string) (string, error) {
 	return dir, nil
 }
 
+// MarkComplete flushes a deployment's files to disk, then marks it complete,
+// so a crash cannot leave a complete deployment with missing content.
 func (s *Store) MarkComplete(site, id string) error {
+	depDir := filepath.Join(s.dataDir, "sites", site, "deployments", id)
+	if err := syncTree(depDir); err != nil {
+		return fmt.Errorf("sync deployment: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(depDir, ".complete"), nil, 0644); err != nil {
+		return err
+	}
+	return syncDir(depDir)
+}
+
+// DeploymentComplete reports whether a deployment finished uploading
+// successfully and can be served.
+func (s *Store) DeploymentComplete(site, id string) bool {
+	if !ValidSiteName(site) || !ValidDeploymentID(id) {
+		return false
+	}
 	marker := filepath.Join(s.dataDir, "sites", site, "deployments", id, ".complete")
-	return os.WriteFile(marker, nil, 0644)
+	_, err := os.Stat(marker)
+	return err == nil
 }
 
 func (s *Store) MarkFailed(site, id, reason string) error {
@@ -137,11 +166,29 @@ func (s *Store) ActivateDeployment(site, id string) error {
 	if !ValidDeploymentID(id) {
 		return ErrDeploymentNotFound
 	}
+	if s.SiteArchived(site) {
+		return ErrSiteArchived
+	}
+	if err := s.checkPins(site, id); err != nil {
+		return err
+	}
 	depDir := filepath.Join(s.dataDir, "sites", site, "deployments", id)
 	if _, err := os.Stat(depDir); err != nil {
 		return fmt.Errorf("deployment not found: %w", err)
 	}
 
+	if err := s.setCurrent(site, id); err != nil {
+		return err
+	}
+	// The canary compared its candidate to the deployment just replaced.
+	return s.StopCanary(site)
+}
+
+// setCurrent points the site's current symlink at deployment id. The swap
+// is atomic, and durable once it returns. The link is relative, and is
+// documented for tools reading sites from the data directory, so its
+// location and target must stay as they are.
+func (s *Store) setCurrent(site, id string) error {
 	link := filepath.Join(s.dataDir, "sites", site, "current")
 	target := filepath.Join("deployments", id)
 
@@ -155,6 +202,9 @@ func (s *Store) ActivateDeployment(site, id string) error {
 		os.Remove(tmp)
 		return fmt.Errorf("swap symlink: %w", err)
 	}
+	if err := syncDir(filepath.Dir(link)); err != nil {
+		return fmt.Errorf("sync site dir: %w", err)
+	}
 	return nil
 }
 
@@ -166,6 +216,20 @@ type Manifest struct {
 	CreatedBy       string    `json:"created_by"`
 	CreatedByAvatar string    `json:"created_by_avatar,omitempty"`
 	SizeBytes       int64     `json:"size_bytes"`
+	// RequestID is the ID of the upload request, for finding its log lines.
+	RequestID string `json:"request_id,omitempty"`
+	// SourceURL is the URL the artifact was fetched from, for deployments
+	// made with POST /deploy/{site}/fetch.
+	SourceURL string `json:"source_url,omitempty"`
+	// Build is the CI build the deployment came from, if the deploy
+	// request named one.
+	Build *BuildInfo `json:"build,omitempty"`
+	// FailedStage is the step a failed deployment failed in, such as
+	// "extract" or "config".
+	FailedStage string `json:"failed_stage,omitempty"`
+	// PrevHash is the hash of the site's deployment chain before this
+	// deployment was added to it; see ChainDeployment.
+	PrevHash string `json:"prev_hash,omitempty"`
 }
 
 func (s *Store) WriteManifest(site, id string, m Manifest) error {
@@ -199,6 +263,16 @@ func (s *Store) CurrentDeployment(site string) (string, error) {
 	return filepath.Base(target), nil
 }
 
+// ActivatedAt returns when the site's current deployment was activated,
+// taken from the modification time of the current symlink.
+func (s *Store) ActivatedAt(site string) (time.Time, error) {
+	info, err := os.Lstat(filepath.Join(s.dataDir, "sites", site, "current"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no active deployment for site %q: %w", site, err)
+	}
+	return info.ModTime(), nil
+}
+
 func (s *Store) SiteRoot(site string) string {
 	return filepath.Join(s.dataDir, "sites", site, "current", "content")
 }
@@ -247,14 +321,22 @@ func (s *Store) ListSites() ([]SiteInfo, error) {
 }
 
 type DeploymentInfo struct {
-	ID              string    `json:"id"`
-	Active          bool      `json:"active"`
-	Failed          bool      `json:"failed,omitempty"`
-	FailedReason    string    `json:"failed_reason,omitempty"`
-	CreatedAt       time.Time `json:"created_at,omitempty"`
-	CreatedBy       string    `json:"created_by,omitempty"`
-	CreatedByAvatar string    `json:"created_by_avatar,omitempty"`
-	SizeBytes       int64     `json:"size_bytes,omitempty"`
+	ID              string     `json:"id"`
+	Active          bool       `json:"active"`
+	Failed          bool       `json:"failed,omitempty"`
+	FailedReason    string     `json:"failed_reason,omitempty"`
+	FailedStage     string     `json:"failed_stage,omitempty"`
+	CreatedAt       time.Time  `json:"created_at,omitempty"`
+	CreatedBy       string     `json:"created_by,omitempty"`
+	CreatedByAvatar string     `json:"created_by_avatar,omitempty"`
+	SizeBytes       int64      `json:"size_bytes,omitempty"`
+	Pinned          *PinState  `json:"pinned,omitempty"`
+	Build           *BuildInfo `json:"build,omitempty"`
+	// Tampered is why the deployment's files were found changed outside
+	// tspages, if they were.
+	Tampered string `json:"tampered,omitempty"`
+	// CommitRange is set by SetCommitRanges, not stored.
+	CommitRange *CommitRange `json:"commit_range,omitempty"`
 }
 
 // deploymentInfoFromManifest populates a DeploymentInfo from a Manifest.
@@ -263,6 +345,10 @@ func deploymentInfoFromManifest(d *DeploymentInfo, m Manifest) {
 	d.CreatedBy = m.CreatedBy
 	d.CreatedByAvatar = m.CreatedByAvatar
 	d.SizeBytes = m.SizeBytes
+	d.Build = m.Build
+	if d.Failed {
+		d.FailedStage = m.FailedStage
+	}
 }
 
 // FileInfo describes a single file within a deployment's content directory.
@@ -270,6 +356,48 @@ type FileInfo struct {
 	Path string `json:"path"`
 	Size int64  `json:"size"`
 	Hash string `json:"hash"`
+	// OriginalSize is the uploaded size of a file minified at deploy time,
+	// and zero for files stored as uploaded.
+	OriginalSize int64 `json:"original_size,omitempty"`
+	// CompressedSize is the size of the smallest variant of a file
+	// precompressed at deploy time, and zero for files without one.
+	CompressedSize int64 `json:"compressed_size,omitempty"`
+	// Variants are the precompressed variants written at deploy time,
+	// keyed by extension (".br", ".gz"), so they can be verified like the
+	// file itself.
+	Variants map[string]FileVariant `json:"variants,omitempty"`
+}
+
+// FileVariant is a precompressed variant of an indexed file.
+type FileVariant struct {
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// DiffFiles compares two file lists and returns added, removed, and changed paths.
+// A file is considered "changed" if its content hash differs.
+func DiffFiles(current, previous []FileInfo) (added, removed, changed []string) {
+	prevMap := make(map[string]string, len(previous))
+	for _, f := range previous {
+		prevMap[f.Path] = f.Hash
+	}
+	currMap := make(map[string]struct{}, len(current))
+	for _, f := range current {
+		currMap[f.Path] = struct{}{}
+		if prevHash, ok := prevMap[f.Path]; ok {
+			if f.Hash != prevHash {
+				changed = append(changed, f.Path)
+			}
+		} else {
+			added = append(added, f.Path)
+		}
+	}
+	for _, f := range previous {
+		if _, ok := currMap[f.Path]; !ok {
+			removed = append(removed, f.Path)
+		}
+	}
+	return
 }
 
 // ContentDir returns the path to the content directory for a deployment.
@@ -277,6 +405,19 @@ func (s *Store) ContentDir(site, id string) string {
 	return filepath.Join(s.dataDir, "sites", site, "deployments", id, "content")
 }
 
+// OpenDeploymentFile opens the file at the slash-separated path name in a
+// deployment's content directory. Paths that leave the content directory,
+// also through symlinks, are rejected.
+func (s *Store) OpenDeploymentFile(site, id, name string) (*os.File, error) {
+	if !ValidSiteName(site) {
+		return nil, fmt.Errorf("invalid site name: %q", site)
+	}
+	if !ValidDeploymentID(id) {
+		return nil, ErrDeploymentNotFound
+	}
+	return os.OpenInRoot(s.ContentDir(site, id), filepath.FromSlash(name))
+}
+
 // WriteFileIndex persists a pre-computed file listing as files.json
 // alongside the deployment's manifest.
 func (s *Store) WriteFileIndex(site, id string, files []FileInfo) error {
@@ -316,33 +457,30 @@ func (s *Store) ListDeploymentFiles(site, id string) ([]FileInfo, error) {
 	if cached, err := s.ReadFileIndex(site, id); err == nil {
 		return cached, nil
 	}
-	contentDir := s.ContentDir(site, id)
+	return IndexDir(s.ContentDir(site, id))
+}
+
+// IndexDir walks dir and returns its regular files with their sizes and
+// hashes, sorted by path. A missing dir has no files.
+func IndexDir(dir string) ([]FileInfo, error) {
 	var files []FileInfo
-	err := filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if d.IsDir() {
+		if !d.Type().IsRegular() {
+			// Directories, and symlinks, which alias files listed anyway.
 			return nil
 		}
-		rel, err := filepath.Rel(contentDir, path)
+		rel, err := filepath.Rel(dir, path)
 		if err != nil {
 			return err
 		}
-		info, err := d.Info()
+		size, hash, err := HashFile(path)
 		if err != nil {
 			return err
 		}
-		f, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		h := sha256.New()
-		if _, err := io.Copy(h, f); err != nil {
-			return err
-		}
-		files = append(files, FileInfo{Path: rel, Size: info.Size(), Hash: hex.EncodeToString(h.Sum(nil))})
+		files = append(files, FileInfo{Path: rel, Size: size, Hash: hash})
 		return nil
 	})
 	if err != nil && !os.IsNotExist(err) {
@@ -354,6 +492,22 @@ func (s *Store) ListDeploymentFiles(site, id string) ([]FileInfo, error) {
 	return files, nil
 }
 
+// HashFile returns the size of the file at path and its hex-encoded
+// SHA-256 hash, as recorded in file indexes.
+func HashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func (s *Store) DeleteDeployment(site, id string) error {
 	if !ValidSiteName(site) {
 		return fmt.Errorf("invalid site name: %q", site)
@@ -372,22 +526,33 @@ func (s *Store) DeleteDeployment(site, id string) error {
 		}
 		return fmt.Errorf("checking deployment: %w", err)
 	}
+	if _, pinned := s.ReadPin(site, id); pinned {
+		return ErrDeploymentPinned
+	}
+	if err := s.stopCanaryOf(site, id); err != nil {
+		return err
+	}
 	return os.RemoveAll(dir)
 }
 
-// DeleteInactiveDeployments removes all non-active deployments for a site.
-// Returns the number of deployments deleted.
+// DeleteInactiveDeployments moves all deployments for a site except the
+// active one, pinned ones, and the canary candidate to the trash. Returns the number of
+// deployments deleted.
 func (s *Store) DeleteInactiveDeployments(site string) (int, error) {
+	if s.SiteArchived(site) {
+		return 0, ErrSiteArchived
+	}
 	deployments, err := s.ListDeployments(site)
 	if err != nil {
 		return 0, err
 	}
+	canary := s.canaryDeployment(site)
 	deleted := 0
 	for _, d := range deployments {
-		if d.Active {
+		if d.Active || d.Pinned != nil || d.ID == canary {
 			continue
 		}
-		if err := s.DeleteDeployment(site, d.ID); err != nil {
+		if err := s.TrashDeployment(site, d.ID); err != nil {
 			return deleted, fmt.Errorf("deleting %s: %w", d.ID, err)
 		}
 		deleted++
@@ -396,7 +561,8 @@ func (s *Store) DeleteInactiveDeployments(site string) (int, error) {
 }
 
 // CleanupOldDeployments removes the oldest deployments for a site,
-// keeping at most `keep` deployments. The active deployment is never removed.
+// keeping at most `keep` deployments. The active deployment, pinned
+// deployments, and the canary candidate are never removed.
 // Returns the number of deployments deleted.
 func (s *Store) CleanupOldDeployments(site string, keep int) (int, error) {
 	deployments, err := s.ListDeployments(site)
@@ -412,9 +578,10 @@ func (s *Store) CleanupOldDeployments(site string, keep int) (int, error) {
 		return deployments[i].CreatedAt.After(deployments[j].CreatedAt)
 	})
 
+	canary := s.canaryDeployment(site)
 	deleted := 0
 	for i, d := range deployments {
-		if i < keep || d.Active {
+		if i < keep || d.Active || d.Pinned != nil || d.ID == canary {
 			continue
 		}
 		if err := s.DeleteDeployment(site, d.ID); err != nil {
@@ -474,38 +641,11 @@ func (s *Store) ListDeployments(site string) ([]DeploymentInfo, error) {
 		if m, err := s.ReadManifest(site, e.Name()); err == nil {
 			deploymentInfoFromManifest(&info, m)
 		}
+		if pin, ok := s.ReadPin(site, e.Name()); ok {
+			info.Pinned = &pin
+		}
+		info.Tampered, _ = s.Tampered(site, e.Name())
 		deployments = append(deployments, info)
 	}
 	return deployments, nil
 }
-
-func (s *Store) CleanupOrphans() {
-	sitesDir := filepath.Join(s.dataDir, "sites")
-	siteEntries, err := os.ReadDir(sitesDir)
-	if err != nil {
-		return
-	}
-	for _, site := range siteEntries {
-		if !site.IsDir() {
-			continue
-		}
-		deploymentsDir := filepath.Join(sitesDir, site.Name(), "deployments")
-		depEntries, err := os.ReadDir(deploymentsDir)
-		if err != nil {
-			continue
-		}
-		for _, dep := range depEntries {
-			if !dep.IsDir() {
-				continue
-			}
-			depDir := filepath.Join(deploymentsDir, dep.Name())
-			completeMarker := filepath.Join(depDir, ".complete")
-			failedMarker := filepath.Join(depDir, ".failed")
-			_, completeErr := os.Stat(completeMarker)
-			_, failedErr := os.Stat(failedMarker)
-			if os.IsNotExist(completeErr) && os.IsNotExist(failedErr) {
-				os.RemoveAll(depDir)
-			}
-		}
-	}
-}
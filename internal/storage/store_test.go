@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -56,6 +57,32 @@ func TestCreateDeployment(t *testing.T) {
 	}
 }
 
+func TestDeploymentComplete(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.CreateDeployment("docs", "bbb22222")
+	s.CreateDeployment("docs", "ccc33333")
+	s.MarkComplete("docs", "aaa11111")
+	s.MarkFailed("docs", "bbb22222", "boom")
+
+	tests := []struct {
+		site, id string
+		want     bool
+	}{
+		{"docs", "aaa11111", true},
+		{"docs", "bbb22222", false},
+		{"docs", "ccc33333", false},
+		{"docs", "zzz00000", false},
+		{"docs", "..", false},
+		{"..", "aaa11111", false},
+	}
+	for _, tt := range tests {
+		if got := s.DeploymentComplete(tt.site, tt.id); got != tt.want {
+			t.Errorf("DeploymentComplete(%q, %q) = %v, want %v", tt.site, tt.id, got, tt.want)
+		}
+	}
+}
+
 func TestActivateAndCurrent(t *testing.T) {
 	s := New(t.TempDir())
 	path, _ := s.CreateDeployment("docs", "abc12345")
@@ -90,6 +117,33 @@ func TestActivateSwitchesSymlink(t *testing.T) {
 	}
 }
 
+func TestActivate_CurrentLinkLayout(t *testing.T) {
+	// The current link is documented for tools reading the data directory,
+	// so its layout must not change.
+	dir := t.TempDir()
+	s := New(dir)
+	for _, id := range []string{"aaa11111", "bbb22222"} {
+		s.CreateDeployment("docs", id)
+		os.MkdirAll(s.ContentDir("docs", id), 0755)
+		os.WriteFile(filepath.Join(s.ContentDir("docs", id), "index.html"), []byte(id), 0644)
+		s.MarkComplete("docs", id)
+		if err := s.ActivateDeployment("docs", id); err != nil {
+			t.Fatalf("activate %s: %v", id, err)
+		}
+	}
+
+	link := filepath.Join(dir, "sites", "docs", "current")
+	if target, err := os.Readlink(link); err != nil || target != filepath.Join("deployments", "bbb22222") {
+		t.Errorf("current -> %q, %v; want a relative link to deployments/bbb22222", target, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(link, "content", "index.html")); err != nil || string(data) != "bbb22222" {
+		t.Errorf("current/content/index.html = %q, %v", data, err)
+	}
+	if _, err := os.Lstat(link + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary link left behind: %v", err)
+	}
+}
+
 func TestSiteRoot(t *testing.T) {
 	s := New(t.TempDir())
 	root := s.SiteRoot("docs")
@@ -405,6 +459,7 @@ func TestListDeployments_WithManifest(t *testing.T) {
 	s.WriteManifest("docs", "aaa11111", Manifest{
 		CreatedBy: "alice@example.com",
 		SizeBytes: 1024,
+		Build:     &BuildInfo{Commit: "0123456789abcdef", Branch: "main"},
 	})
 	s.MarkComplete("docs", "aaa11111")
 	s.ActivateDeployment("docs", "aaa11111")
@@ -429,6 +484,9 @@ func TestListDeployments_WithManifest(t *testing.T) {
 			if d.SizeBytes != 1024 {
 				t.Errorf("aaa11111 size_bytes = %d", d.SizeBytes)
 			}
+			if d.Build == nil || d.Build.Commit != "0123456789abcdef" || d.Build.Branch != "main" {
+				t.Errorf("aaa11111 build = %+v", d.Build)
+			}
 		}
 		if d.ID == "bbb22222" {
 			// No manifest — should have zero values
@@ -474,6 +532,33 @@ func TestDeleteInactiveDeployments(t *testing.T) {
 	}
 }
 
+func TestDiffFiles(t *testing.T) {
+	current := []FileInfo{
+		{Path: "index.html", Size: 200, Hash: "aaa"},
+		{Path: "new.js", Size: 50, Hash: "bbb"},
+		{Path: "same.css", Size: 100, Hash: "ccc"},
+		{Path: "same-size-diff-content.txt", Size: 100, Hash: "ddd"},
+	}
+	previous := []FileInfo{
+		{Path: "index.html", Size: 100, Hash: "xxx"},
+		{Path: "old.txt", Size: 30, Hash: "yyy"},
+		{Path: "same.css", Size: 100, Hash: "ccc"},
+		{Path: "same-size-diff-content.txt", Size: 100, Hash: "zzz"},
+	}
+
+	added, removed, changed := DiffFiles(current, previous)
+
+	if len(added) != 1 || added[0] != "new.js" {
+		t.Errorf("added = %v, want [new.js]", added)
+	}
+	if len(removed) != 1 || removed[0] != "old.txt" {
+		t.Errorf("removed = %v, want [old.txt]", removed)
+	}
+	if len(changed) != 2 {
+		t.Errorf("changed = %v, want [index.html same-size-diff-content.txt]", changed)
+	}
+}
+
 func TestListDeploymentFiles(t *testing.T) {
 	s := New(t.TempDir())
 	dir, _ := s.CreateDeployment("docs", "aaa11111")
@@ -516,6 +601,33 @@ func TestListDeploymentFiles_NoContentDir(t *testing.T) {
 	}
 }
 
+func TestOpenDeploymentFile(t *testing.T) {
+	s := New(t.TempDir())
+	dir, _ := s.CreateDeployment("docs", "aaa11111")
+	contentDir := filepath.Join(dir, "content")
+	os.MkdirAll(filepath.Join(contentDir, "assets"), 0755)
+	os.WriteFile(filepath.Join(contentDir, "assets", "style.css"), []byte("body{}"), 0644)
+	os.Symlink("../../manifest.json", filepath.Join(contentDir, "escape.json"))
+	s.MarkComplete("docs", "aaa11111")
+
+	f, err := s.OpenDeploymentFile("docs", "aaa11111", "assets/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "body{}" {
+		t.Errorf("content = %q", data)
+	}
+
+	for _, name := range []string{"../manifest.json", "/etc/passwd", "escape.json", "missing.txt"} {
+		if f, err := s.OpenDeploymentFile("docs", "aaa11111", name); err == nil {
+			f.Close()
+			t.Errorf("opened %q", name)
+		}
+	}
+}
+
 func TestCleanupOldDeployments(t *testing.T) {
 	s := New(t.TempDir())
 
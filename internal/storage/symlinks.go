@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Symlink policies for deployment content.
+const (
+	// SymlinksDeny rejects uploads containing symlinks.
+	SymlinksDeny = "deny"
+	// SymlinksIntra allows symlinks whose target stays inside the
+	// deployment's content directory.
+	SymlinksIntra = "intra"
+)
+
+// Symlink is a symbolic link to create in a deployment's content. Name is
+// relative to the content directory; Target is relative to Name's directory.
+type Symlink struct {
+	Name   string
+	Target string
+}
+
+// CreateSymlinks creates links inside root, then checks that every symlink
+// in root resolves to a path inside it. Links are only created in real
+// directories, never through another symlink, so a link that turns out to
+// escape cannot be used to write outside root. Callers create links after
+// all regular files for the same reason.
+func CreateSymlinks(root string, links []Symlink) error {
+	for _, l := range links {
+		name := filepath.Clean(filepath.FromSlash(l.Name))
+		if !isLocalPath(name) || name == "." {
+			return fmt.Errorf("symlink %q: path traversal detected", l.Name)
+		}
+		target := filepath.FromSlash(l.Target)
+		if filepath.IsAbs(target) || !isLocalPath(filepath.Join(filepath.Dir(name), target)) {
+			return fmt.Errorf("symlink %q points outside the deployment: %q", l.Name, l.Target)
+		}
+		if err := mkdirReal(root, filepath.Dir(name)); err != nil {
+			return fmt.Errorf("symlink %q: %w", l.Name, err)
+		}
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			return fmt.Errorf("symlink %q: %w", l.Name, err)
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return ValidateSymlinks(root)
+}
+
+// ValidateSymlinks reports the first symlink in root that is dangling or
+// resolves to a path outside root.
+func ValidateSymlinks(root string) error {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return fmt.Errorf("symlink %q does not resolve", filepath.ToSlash(rel))
+		}
+		if resolved != resolvedRoot && !strings.HasPrefix(resolved, resolvedRoot+string(os.PathSeparator)) {
+			return fmt.Errorf("symlink %q points outside the deployment", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+}
+
+// mkdirReal creates the directory dir, relative to root, refusing to
+// traverse symlinks on the way.
+func mkdirReal(root, dir string) error {
+	path := root
+	for _, part := range strings.Split(dir, string(os.PathSeparator)) {
+		if part == "." || part == "" {
+			continue
+		}
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%q is not a directory", filepath.ToSlash(dir))
+		}
+	}
+	return nil
+}
+
+// isLocalPath reports whether the cleaned relative path p stays inside its
+// base directory.
+func isLocalPath(p string) bool {
+	return !filepath.IsAbs(p) && p != ".." && !strings.HasPrefix(p, ".."+string(os.PathSeparator))
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateSymlinks(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "assets"), 0755)
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("hi"), 0644)
+
+	err := CreateSymlinks(root, []Symlink{
+		{Name: "static", Target: "assets"},
+		{Name: "docs/v1/index.html", Target: "../../index.html"},
+		{Name: "current", Target: "docs/v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "current", "index.html"))
+	if err != nil || string(data) != "hi" {
+		t.Errorf("current/index.html = %q, %v", data, err)
+	}
+}
+
+func TestCreateSymlinks_RejectsEscapes(t *testing.T) {
+	tests := map[string][]Symlink{
+		"absolute":     {{Name: "evil", Target: "/etc/passwd"}},
+		"parent":       {{Name: "evil", Target: ".."}},
+		"name":         {{Name: "../evil", Target: "index.html"}},
+		"dangling":     {{Name: "evil", Target: "missing"}},
+		"through link": {{Name: "root", Target: "."}, {Name: "evil", Target: "root/../outside"}},
+		"inside link":  {{Name: "up", Target: "."}, {Name: "up/evil", Target: "index.html"}},
+	}
+	for name, links := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			root := filepath.Join(parent, "content")
+			os.Mkdir(root, 0755)
+			os.WriteFile(filepath.Join(root, "index.html"), []byte("hi"), 0644)
+			os.WriteFile(filepath.Join(parent, "outside"), []byte("secret"), 0644)
+
+			if err := CreateSymlinks(root, links); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// tamperedMarker records why a deployment's files no longer match its
+// file index.
+const tamperedMarker = ".tampered"
+
+// CheckContent compares the content directory of a deployment with its
+// file index, and returns a description of each difference: files that are
+// missing, were added, or changed size. Up to sample files that look
+// unchanged are also checked against their hashes, which catches edits
+// that keep a file's size. The .br and .gz variants written at deploy time
+// are checked like files against the variants recorded in the index; any
+// other variant counts as added.
+func (s *Store) CheckContent(site, id string, sample int) ([]string, error) {
+	files, err := s.ReadFileIndex(site, id)
+	if err != nil {
+		return nil, fmt.Errorf("file index: %w", err)
+	}
+	indexed := make(map[string]FileInfo, len(files))
+	for _, f := range files {
+		indexed[f.Path] = f
+	}
+
+	contentDir := s.ContentDir(site, id)
+	var problems []string
+	var unchanged []FileInfo
+	seen := make(map[string]bool, len(files))
+	err = filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(contentDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, ok := indexed[rel]
+		if !ok {
+			v, ok := recordedVariant(rel, indexed)
+			if !ok {
+				problems = append(problems, rel+": not part of the deployment")
+				return nil
+			}
+			f = FileInfo{Path: rel, Size: v.Size, Hash: v.Hash}
+		}
+		seen[rel] = true
+		if info.Size() != f.Size {
+			problems = append(problems, fmt.Sprintf("%s: size is %d bytes, want %d", rel, info.Size(), f.Size))
+			return nil
+		}
+		unchanged = append(unchanged, f)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, f := range files {
+		if !seen[f.Path] {
+			problems = append(problems, f.Path+": missing")
+		}
+		for _, ext := range slices.Sorted(maps.Keys(f.Variants)) {
+			if !seen[f.Path+ext] {
+				problems = append(problems, f.Path+ext+": missing")
+			}
+		}
+	}
+
+	if sample < len(unchanged) {
+		rand.Shuffle(len(unchanged), func(i, j int) { unchanged[i], unchanged[j] = unchanged[j], unchanged[i] })
+		unchanged = unchanged[:sample]
+	}
+	for _, f := range unchanged {
+		if err := verifyFile(filepath.Join(contentDir, f.Path), f); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Path, err))
+		}
+	}
+	return problems, nil
+}
+
+// recordedVariant returns the variant of an indexed file that path is, as
+// recorded in the index, and whether it is one.
+func recordedVariant(path string, indexed map[string]FileInfo) (FileVariant, bool) {
+	ext := filepath.Ext(path)
+	if ext != ".br" && ext != ".gz" {
+		return FileVariant{}, false
+	}
+	v, ok := indexed[strings.TrimSuffix(path, ext)].Variants[ext]
+	return v, ok
+}
+
+// MarkTampered records that the files of a deployment were changed outside
+// tspages, and why.
+func (s *Store) MarkTampered(site, id, reason string) error {
+	marker := filepath.Join(s.dataDir, "sites", site, "deployments", id, tamperedMarker)
+	return os.WriteFile(marker, []byte(reason), 0644)
+}
+
+// ClearTampered removes the record of MarkTampered, once a deployment's
+// files match its index again.
+func (s *Store) ClearTampered(site, id string) error {
+	err := os.Remove(filepath.Join(s.dataDir, "sites", site, "deployments", id, tamperedMarker))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Tampered returns why the files of a deployment were found changed
+// outside tspages, and whether they were.
+func (s *Store) Tampered(site, id string) (string, bool) {
+	reason, err := os.ReadFile(filepath.Join(s.dataDir, "sites", site, "deployments", id, tamperedMarker))
+	if err != nil {
+		return "", false
+	}
+	return string(reason), true
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckContent(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	dir := s.ContentDir("docs", "aaa11111")
+	os.MkdirAll(filepath.Join(dir, "css"), 0755)
+	for name, content := range map[string]string{
+		"index.html": "<h1>Docs</h1>", "guide.html": "<h1>Guide</h1>", "css/site.css": "body{}",
+	} {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	files, err := IndexDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "index.html.br"), []byte("compressed"), 0644)
+	for i, f := range files {
+		if f.Path == "index.html" {
+			size, hash, _ := HashFile(filepath.Join(dir, "index.html.br"))
+			files[i].Variants = map[string]FileVariant{".br": {Size: size, Hash: hash}}
+			files[i].CompressedSize = size
+		}
+	}
+	if err := s.WriteFileIndex("docs", "aaa11111", files); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := s.CheckContent("docs", "aaa11111", 10)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("untouched deployment: %q, %v", problems, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Hacked</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, "guide.html"), []byte("<h1>Owned</h1>"), 0644)
+	os.Remove(filepath.Join(dir, "css", "site.css"))
+	os.WriteFile(filepath.Join(dir, "extra.js"), []byte("alert(1)"), 0644)
+	os.WriteFile(filepath.Join(dir, "guide.html.gz"), []byte("compressed"), 0644)
+	os.Remove(filepath.Join(dir, "index.html.br"))
+	problems, err = s.CheckContent("docs", "aaa11111", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(problems)
+	want := []string{
+		"css/site.css: missing",
+		"extra.js: not part of the deployment",
+		"guide.html.gz: not part of the deployment",
+		"guide.html: content does not match its hash",
+		"index.html.br: missing",
+		"index.html: size is 15 bytes, want 13",
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("problems = %q, want %q", problems, want)
+	}
+}
+
+func TestCheckContent_UnrecordedVariants(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	dir := s.ContentDir("docs", "aaa11111")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Docs</h1>"), 0644)
+	os.WriteFile(filepath.Join(dir, "index.html.br"), []byte("small"), 0644)
+	os.WriteFile(filepath.Join(dir, "index.html.gz"), []byte("larger"), 0644)
+
+	// A compressed size alone does not vouch for a variant.
+	for name, f := range map[string]FileInfo{
+		"not precompressed":    {Path: "index.html", Size: 13},
+		"compressed size only": {Path: "index.html", Size: 13, CompressedSize: 5},
+	} {
+		s.WriteFileIndex("docs", "aaa11111", []FileInfo{f})
+		problems, err := s.CheckContent("docs", "aaa11111", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(problems)
+		want := []string{
+			"index.html.br: not part of the deployment",
+			"index.html.gz: not part of the deployment",
+		}
+		if !slices.Equal(problems, want) {
+			t.Errorf("%s: problems = %q, want %q", name, problems, want)
+		}
+	}
+}
+
+func TestMarkTampered(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.MarkComplete("docs", "aaa11111")
+
+	if _, ok := s.Tampered("docs", "aaa11111"); ok {
+		t.Fatal("new deployment is tampered")
+	}
+	if err := s.MarkTampered("docs", "aaa11111", "index.html: missing"); err != nil {
+		t.Fatal(err)
+	}
+	if reason, ok := s.Tampered("docs", "aaa11111"); !ok || reason != "index.html: missing" {
+		t.Errorf("Tampered = %q, %v", reason, ok)
+	}
+	if deployments, _ := s.ListDeployments("docs"); len(deployments) != 1 || deployments[0].Tampered != "index.html: missing" {
+		t.Errorf("deployments = %+v", deployments)
+	}
+
+	if err := s.ClearTampered("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Tampered("docs", "aaa11111"); ok {
+		t.Error("still tampered after ClearTampered")
+	}
+	if err := s.ClearTampered("docs", "aaa11111"); err != nil {
+		t.Errorf("clearing twice: %v", err)
+	}
+}
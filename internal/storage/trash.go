@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotInTrash is returned when restoring a site or deployment that is not
+// in the trash (never deleted, already restored, or already purged).
+var ErrNotInTrash = errors.New("not in trash")
+
+// trashedMarker records when a site or deployment was moved to the trash.
+const trashedMarker = ".trashed"
+
+// TrashEntry describes a trashed site or deployment. DeploymentID is empty
+// for a trashed site.
+type TrashEntry struct {
+	Site         string    `json:"site"`
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	TrashedAt    time.Time `json:"trashed_at"`
+}
+
+// trashedSiteDir returns the trash location of a deleted site. Sites live
+// outside data/sites while trashed so they are never listed or served.
+func (s *Store) trashedSiteDir(site string) string {
+	return filepath.Join(s.dataDir, "trash", "sites", site)
+}
+
+// trashedDeploymentDir returns the trash location of a deleted deployment.
+// The per-site trash moves with its site if the whole site is trashed.
+func (s *Store) trashedDeploymentDir(site, id string) string {
+	return filepath.Join(s.dataDir, "sites", site, "trash", id)
+}
+
+// TrashSite moves a site and all its deployments to the trash. The site
+// stops being listed immediately; RestoreSite brings it back until the
+// trash is purged. An older trashed site of the same name is replaced.
+// Archived sites return ErrSiteArchived.
+func (s *Store) TrashSite(site string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if s.SiteArchived(site) {
+		return ErrSiteArchived
+	}
+	src := filepath.Join(s.dataDir, "sites", site)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("checking site: %w", err)
+	}
+	return moveToTrash(src, s.trashedSiteDir(site))
+}
+
+// RestoreSite moves a trashed site back into place. Returns ErrSiteExists if
+// a site with the same name has been created since, and ErrNotInTrash if
+// there is nothing to restore.
+func (s *Store) RestoreSite(site string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	dst := filepath.Join(s.dataDir, "sites", site)
+	if _, err := os.Stat(dst); err == nil {
+		return ErrSiteExists
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("create sites dir: %w", err)
+	}
+	return restoreFromTrash(s.trashedSiteDir(site), dst)
+}
+
+// TrashDeployment moves an inactive deployment to the site's trash. Returns
+// ErrSiteArchived if the site is archived.
+func (s *Store) TrashDeployment(site, id string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if !ValidDeploymentID(id) {
+		return ErrDeploymentNotFound
+	}
+	if s.SiteArchived(site) {
+		return ErrSiteArchived
+	}
+	current, _ := s.CurrentDeployment(site)
+	if id == current {
+		return ErrActiveDeployment
+	}
+	if _, pinned := s.ReadPin(site, id); pinned {
+		return ErrDeploymentPinned
+	}
+	src := filepath.Join(s.dataDir, "sites", site, "deployments", id)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return ErrDeploymentNotFound
+		}
+		return fmt.Errorf("checking deployment: %w", err)
+	}
+	if err := s.stopCanaryOf(site, id); err != nil {
+		return err
+	}
+	return moveToTrash(src, s.trashedDeploymentDir(site, id))
+}
+
+// RestoreDeployment moves a trashed deployment back into the site's
+// deployments. It is restored inactive.
+func (s *Store) RestoreDeployment(site, id string) error {
+	if !ValidSiteName(site) {
+		return fmt.Errorf("invalid site name: %q", site)
+	}
+	if !ValidDeploymentID(id) {
+		return ErrNotInTrash
+	}
+	dst := filepath.Join(s.dataDir, "sites", site, "deployments", id)
+	if _, err := os.Stat(dst); err == nil {
+		return ErrDeploymentExists
+	}
+	return restoreFromTrash(s.trashedDeploymentDir(site, id), dst)
+}
+
+// ListTrash returns all trashed sites and deployments, most recently
+// trashed first. Deployments inside a trashed site are not listed
+// separately; restoring the site restores them as well.
+func (s *Store) ListTrash() ([]TrashEntry, error) {
+	var entries []TrashEntry
+
+	siteDirs, err := os.ReadDir(filepath.Join(s.dataDir, "trash", "sites"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range siteDirs {
+		if !e.IsDir() {
+			continue
+		}
+		if at, ok := trashedAt(s.trashedSiteDir(e.Name())); ok {
+			entries = append(entries, TrashEntry{Site: e.Name(), TrashedAt: at})
+		}
+	}
+
+	sites, err := s.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	for _, site := range sites {
+		depDirs, err := os.ReadDir(filepath.Join(s.dataDir, "sites", site.Name, "trash"))
+		if err != nil {
+			continue
+		}
+		for _, e := range depDirs {
+			if !e.IsDir() {
+				continue
+			}
+			if at, ok := trashedAt(s.trashedDeploymentDir(site.Name, e.Name())); ok {
+				entries = append(entries, TrashEntry{Site: site.Name, DeploymentID: e.Name(), TrashedAt: at})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].TrashedAt.After(entries[j].TrashedAt)
+	})
+	return entries, nil
+}
+
+// PurgeTrash permanently removes everything trashed before cutoff.
+// Returns the number of entries removed.
+func (s *Store) PurgeTrash(cutoff time.Time) (int, error) {
+	entries, err := s.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, e := range entries {
+		if !e.TrashedAt.Before(cutoff) {
+			continue
+		}
+		dir := s.trashedSiteDir(e.Site)
+		if e.DeploymentID != "" {
+			dir = s.trashedDeploymentDir(e.Site, e.DeploymentID)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return purged, fmt.Errorf("purging %s: %w", strings.TrimPrefix(dir, s.dataDir), err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// moveToTrash renames src to dst and stamps it with the current time.
+// Any existing entry at dst is replaced.
+func moveToTrash(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("create trash dir: %w", err)
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("replacing trashed copy: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("move to trash: %w", err)
+	}
+	stamp := []byte(time.Now().UTC().Format(time.RFC3339))
+	return os.WriteFile(filepath.Join(dst, trashedMarker), stamp, 0644)
+}
+
+// restoreFromTrash moves a trashed directory back to dst and drops its
+// trash marker.
+func restoreFromTrash(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotInTrash
+		}
+		return fmt.Errorf("checking trash: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("restore from trash: %w", err)
+	}
+	if err := os.Remove(filepath.Join(dst, trashedMarker)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// trashedAt reads the trash timestamp of dir. A missing or unreadable
+// marker falls back to the directory's modification time so stray entries
+// still age out.
+func trashedAt(dir string) (time.Time, bool) {
+	if data, err := os.ReadFile(filepath.Join(dir, trashedMarker)); err == nil {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil {
+			return t, true
+		}
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
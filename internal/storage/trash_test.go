@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashSite_AndRestore(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.MarkComplete("docs", "aaa11111")
+	s.ActivateDeployment("docs", "aaa11111")
+
+	if err := s.TrashSite("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSite("docs"); err == nil {
+		t.Error("trashed site should not be found")
+	}
+	entries, err := s.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Site != "docs" || entries[0].DeploymentID != "" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if time.Since(entries[0].TrashedAt) > time.Minute {
+		t.Errorf("TrashedAt = %v, want recent", entries[0].TrashedAt)
+	}
+
+	if err := s.RestoreSite("docs"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.CurrentDeployment("docs")
+	if err != nil || id != "aaa11111" {
+		t.Errorf("CurrentDeployment = %q, %v; want aaa11111", id, err)
+	}
+	if _, err := os.Stat(filepath.Join(s.dataDir, "sites", "docs", trashedMarker)); !os.IsNotExist(err) {
+		t.Error("trash marker should be removed on restore")
+	}
+	if entries, _ := s.ListTrash(); len(entries) != 0 {
+		t.Errorf("trash should be empty after restore, got %+v", entries)
+	}
+}
+
+func TestRestoreSite_NotInTrash(t *testing.T) {
+	s := New(t.TempDir())
+	if err := s.RestoreSite("docs"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("got %v, want ErrNotInTrash", err)
+	}
+}
+
+func TestRestoreSite_NameTaken(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateSite("docs")
+	s.TrashSite("docs")
+	s.CreateSite("docs")
+
+	if err := s.RestoreSite("docs"); !errors.Is(err, ErrSiteExists) {
+		t.Errorf("got %v, want ErrSiteExists", err)
+	}
+}
+
+func TestTrashDeployment_AndRestore(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateDeployment("docs", "aaa11111")
+	s.MarkComplete("docs", "aaa11111")
+	s.CreateDeployment("docs", "bbb22222")
+	s.MarkComplete("docs", "bbb22222")
+	s.ActivateDeployment("docs", "bbb22222")
+
+	if err := s.TrashDeployment("docs", "bbb22222"); !errors.Is(err, ErrActiveDeployment) {
+		t.Errorf("trashing active: got %v, want ErrActiveDeployment", err)
+	}
+	if err := s.TrashDeployment("docs", "zzz00000"); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("trashing missing: got %v, want ErrDeploymentNotFound", err)
+	}
+	if err := s.TrashDeployment("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, _ := s.ListDeployments("docs")
+	if len(deps) != 1 {
+		t.Errorf("got %d deployments, want 1", len(deps))
+	}
+	entries, _ := s.ListTrash()
+	if len(entries) != 1 || entries[0].DeploymentID != "aaa11111" {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	if err := s.RestoreDeployment("docs", "aaa11111"); err != nil {
+		t.Fatal(err)
+	}
+	deps, _ = s.ListDeployments("docs")
+	if len(deps) != 2 {
+		t.Errorf("got %d deployments after restore, want 2", len(deps))
+	}
+	if err := s.RestoreDeployment("docs", "aaa11111"); !errors.Is(err, ErrDeploymentExists) {
+		t.Errorf("second restore: got %v, want ErrDeploymentExists", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := New(t.TempDir())
+	s.CreateSite("old")
+	s.CreateSite("new")
+	s.CreateDeployment("docs", "aaa11111")
+	s.MarkComplete("docs", "aaa11111")
+	s.TrashSite("old")
+	s.TrashSite("new")
+	s.TrashDeployment("docs", "aaa11111")
+
+	// Backdate "old" and the deployment past the retention window.
+	past := []byte(time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339))
+	os.WriteFile(filepath.Join(s.trashedSiteDir("old"), trashedMarker), past, 0644)
+	os.WriteFile(filepath.Join(s.trashedDeploymentDir("docs", "aaa11111"), trashedMarker), past, 0644)
+
+	n, err := s.PurgeTrash(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("purged %d, want 2", n)
+	}
+	entries, _ := s.ListTrash()
+	if len(entries) != 1 || entries[0].Site != "new" {
+		t.Errorf("remaining = %+v, want only new", entries)
+	}
+	if err := s.RestoreSite("old"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("restoring purged site: got %v, want ErrNotInTrash", err)
+	}
+}
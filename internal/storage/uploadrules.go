@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxReportedViolations bounds the violations CheckUploadRules reports;
+// the total is still counted.
+const maxReportedViolations = 50
+
+// UploadRules restrict what a deployment may contain. The zero value
+// allows everything.
+type UploadRules struct {
+	// MaxFiles caps the number of files in a deployment.
+	MaxFiles int `toml:"max_files"`
+	// MaxFileSizeMB caps the size of a single file.
+	MaxFileSizeMB int64 `toml:"max_file_size_mb"`
+	// BlockDotfiles rejects files and directories whose name starts with
+	// a dot, except .well-known.
+	BlockDotfiles bool `toml:"block_dotfiles"`
+	// BlockExecutables rejects native executables and libraries, detected
+	// by extension and magic bytes.
+	BlockExecutables bool `toml:"block_executables"`
+	// BlockedPaths are glob patterns, matched against each file's path and
+	// every segment of it: "node_modules" or "*.map".
+	BlockedPaths []string `toml:"blocked_paths"`
+	// AllowedExtensions, if set, are the only file extensions allowed,
+	// including the dot: ".html". "" allows files without an extension.
+	AllowedExtensions []string `toml:"allowed_extensions"`
+}
+
+// IsZero reports whether r allows everything.
+func (r UploadRules) IsZero() bool {
+	return r.MaxFiles == 0 && r.MaxFileSizeMB == 0 && !r.BlockDotfiles && !r.BlockExecutables &&
+		len(r.BlockedPaths) == 0 && len(r.AllowedExtensions) == 0
+}
+
+// Validate reports the first invalid rule.
+func (r UploadRules) Validate() error {
+	if r.MaxFiles < 0 {
+		return fmt.Errorf("validation.max_files: must not be negative, got %d", r.MaxFiles)
+	}
+	if r.MaxFileSizeMB < 0 {
+		return fmt.Errorf("validation.max_file_size_mb: must not be negative, got %d", r.MaxFileSizeMB)
+	}
+	for _, p := range r.BlockedPaths {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return fmt.Errorf("validation.blocked_paths: invalid pattern %q", p)
+		}
+	}
+	for _, ext := range r.AllowedExtensions {
+		if ext != "" && !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+			return fmt.Errorf("validation.allowed_extensions: %q must start with a dot", ext)
+		}
+	}
+	return nil
+}
+
+// Tighten combines r with the rules in other so that both apply: the lower
+// of each cap, either block, all blocked paths, and only extensions both
+// allow.
+func (r UploadRules) Tighten(other UploadRules) UploadRules {
+	out := UploadRules{
+		MaxFiles:         minPositive(r.MaxFiles, other.MaxFiles),
+		MaxFileSizeMB:    minPositive(r.MaxFileSizeMB, other.MaxFileSizeMB),
+		BlockDotfiles:    r.BlockDotfiles || other.BlockDotfiles,
+		BlockExecutables: r.BlockExecutables || other.BlockExecutables,
+	}
+	if len(r.BlockedPaths) > 0 || len(other.BlockedPaths) > 0 {
+		out.BlockedPaths = append(append([]string(nil), other.BlockedPaths...), r.BlockedPaths...)
+	}
+	switch {
+	case len(r.AllowedExtensions) == 0:
+		out.AllowedExtensions = other.AllowedExtensions
+	case len(other.AllowedExtensions) == 0:
+		out.AllowedExtensions = r.AllowedExtensions
+	default:
+		for _, ext := range r.AllowedExtensions {
+			if containsFold(other.AllowedExtensions, ext) {
+				out.AllowedExtensions = append(out.AllowedExtensions, ext)
+			}
+		}
+		if len(out.AllowedExtensions) == 0 {
+			// Nothing is allowed by both; keep a list no file can match.
+			out.AllowedExtensions = []string{"."}
+		}
+	}
+	return out
+}
+
+func minPositive[T int | int64](a, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
+
+// Violation is a file breaking an upload rule. Path is empty for rules
+// about the deployment as a whole.
+type Violation struct {
+	Path   string `json:"path,omitempty"`
+	Rule   string `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+// UploadRulesError lists the violations that rejected a deployment.
+// Violations holds at most the first 50; Total counts all of them.
+type UploadRulesError struct {
+	Violations []Violation
+	Total      int
+}
+
+func (e *UploadRulesError) Error() string {
+	first := e.Violations[0]
+	msg := first.Detail
+	if first.Path != "" {
+		msg = first.Path + ": " + msg
+	}
+	if e.Total > 1 {
+		return fmt.Sprintf("upload violates %d rules, first %s", e.Total, msg)
+	}
+	return "upload violates a rule: " + msg
+}
+
+// executableExts are file extensions of native executables, libraries, and
+// installers.
+var executableExts = []string{
+	".exe", ".dll", ".msi", ".scr", ".bat", ".cmd", ".ps1",
+	".so", ".dylib", ".bin", ".elf", ".deb", ".rpm", ".apk", ".jar",
+}
+
+// executableMagic are the leading bytes of ELF, PE, and Mach-O binaries.
+var executableMagic = [][]byte{
+	{0x7f, 'E', 'L', 'F'},
+	{'M', 'Z'},
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+// CheckUploadRules checks every regular file under root against rules. It
+// returns an *UploadRulesError if any rule is broken.
+func CheckUploadRules(root string, rules UploadRules) error {
+	if rules.IsZero() {
+		return nil
+	}
+	report := &UploadRulesError{}
+	add := func(v Violation) {
+		report.Total++
+		if len(report.Violations) < maxReportedViolations {
+			report.Violations = append(report.Violations, v)
+		}
+	}
+	maxSize := rules.MaxFileSizeMB << 20
+	var files int
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rules.BlockDotfiles && strings.HasPrefix(d.Name(), ".") && d.Name() != ".well-known" {
+			add(Violation{Path: rel, Rule: "block_dotfiles", Detail: "dotfiles are not allowed"})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if pattern, ok := blockedPath(rules.BlockedPaths, rel); ok {
+			add(Violation{Path: rel, Rule: "blocked_paths", Detail: fmt.Sprintf("matches blocked pattern %q", pattern)})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		files++
+
+		ext := strings.ToLower(path.Ext(rel))
+		if len(rules.AllowedExtensions) > 0 && !containsFold(rules.AllowedExtensions, ext) {
+			add(Violation{Path: rel, Rule: "allowed_extensions", Detail: fmt.Sprintf("extension %q is not allowed", ext)})
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if maxSize > 0 && info.Size() > maxSize {
+			add(Violation{Path: rel, Rule: "max_file_size_mb", Detail: fmt.Sprintf("%d bytes exceeds the limit of %d MB", info.Size(), rules.MaxFileSizeMB)})
+		}
+		if rules.BlockExecutables {
+			exe, err := isExecutable(p, ext)
+			if err != nil {
+				return err
+			}
+			if exe {
+				add(Violation{Path: rel, Rule: "block_executables", Detail: "executables are not allowed"})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if rules.MaxFiles > 0 && files > rules.MaxFiles {
+		add(Violation{Rule: "max_files", Detail: fmt.Sprintf("%d files exceed the limit of %d", files, rules.MaxFiles)})
+	}
+	if report.Total > 0 {
+		return report
+	}
+	return nil
+}
+
+// blockedPath returns the first pattern matching rel or its last segment.
+// Directories are checked before their contents, so a pattern matching any
+// segment blocks the file.
+func blockedPath(patterns []string, rel string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return pattern, true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// isExecutable reports whether the file at p is a native executable, by its
+// extension ext or its leading bytes.
+func isExecutable(p, ext string) (bool, error) {
+	if slices.Contains(executableExts, ext) {
+		return true, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	head = head[:n]
+	for _, magic := range executableMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
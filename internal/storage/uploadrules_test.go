@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func violatedRules(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var rulesErr *UploadRulesError
+	if !errors.As(err, &rulesErr) {
+		t.Fatalf("got %v, want *UploadRulesError", err)
+	}
+	rules := map[string]string{}
+	for _, v := range rulesErr.Violations {
+		rules[v.Path] = v.Rule
+	}
+	return rules
+}
+
+func TestCheckUploadRules(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"index.html":                     "<h1>Hi</h1>",
+		".env":                           "SECRET=1",
+		".well-known/security.txt":       "Contact: sec@example.com",
+		"node_modules/left-pad/index.js": "module.exports = 1",
+		"app.js.map":                     "{}",
+		"bin/server":                     "\x7fELF\x02\x01\x01",
+		"tools/setup.exe":                "whatever",
+		"big.bin.txt":                    string(make([]byte, 2<<20)),
+		"docs/readme.md":                 "# Docs",
+	})
+	err := CheckUploadRules(root, UploadRules{
+		MaxFileSizeMB:     1,
+		BlockDotfiles:     true,
+		BlockExecutables:  true,
+		BlockedPaths:      []string{"node_modules", "*.map"},
+		AllowedExtensions: []string{".html", ".js", ".txt", ".exe", ""},
+	})
+	got := violatedRules(t, err)
+	want := map[string]string{
+		".env":            "block_dotfiles",
+		"node_modules":    "blocked_paths",
+		"app.js.map":      "blocked_paths",
+		"bin/server":      "block_executables",
+		"tools/setup.exe": "block_executables",
+		"big.bin.txt":     "max_file_size_mb",
+		"docs/readme.md":  "allowed_extensions",
+	}
+	for path, rule := range want {
+		if got[path] != rule {
+			t.Errorf("%s: rule = %q, want %q", path, got[path], rule)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("violations = %v, want %v", got, want)
+	}
+}
+
+func TestCheckUploadRules_MaxFiles(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.html": "a", "b.html": "b", "c/d.html": "d"})
+	if err := CheckUploadRules(root, UploadRules{MaxFiles: 3}); err != nil {
+		t.Errorf("3 files within a limit of 3: %v", err)
+	}
+	err := CheckUploadRules(root, UploadRules{MaxFiles: 2})
+	if got := violatedRules(t, err); got[""] != "max_files" {
+		t.Errorf("violations = %v, want max_files", got)
+	}
+}
+
+func TestCheckUploadRules_ZeroAllowsEverything(t *testing.T) {
+	root := writeTree(t, map[string]string{".env": "x", "a.exe": "MZ"})
+	if err := CheckUploadRules(root, UploadRules{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckUploadRules_CapsReport(t *testing.T) {
+	files := map[string]string{}
+	for i := range 60 {
+		files[filepath.Join("dots", "."+string(rune('a'+i%26))+string(rune('a'+i/26)))] = "x"
+	}
+	var rulesErr *UploadRulesError
+	err := CheckUploadRules(writeTree(t, files), UploadRules{BlockDotfiles: true})
+	if !errors.As(err, &rulesErr) {
+		t.Fatalf("got %v", err)
+	}
+	if rulesErr.Total != 60 || len(rulesErr.Violations) != maxReportedViolations {
+		t.Errorf("total = %d, reported = %d", rulesErr.Total, len(rulesErr.Violations))
+	}
+}
+
+func TestUploadRules_Tighten(t *testing.T) {
+	server := UploadRules{MaxFiles: 1000, MaxFileSizeMB: 0, BlockExecutables: true, BlockedPaths: []string{"node_modules"}, AllowedExtensions: []string{".html", ".css", ".js"}}
+	site := UploadRules{MaxFiles: 5000, MaxFileSizeMB: 10, BlockDotfiles: true, BlockedPaths: []string{"*.map"}, AllowedExtensions: []string{".html", ".png"}}
+
+	got := site.Tighten(server)
+	if got.MaxFiles != 1000 || got.MaxFileSizeMB != 10 {
+		t.Errorf("caps = %d files, %d MB; want 1000, 10", got.MaxFiles, got.MaxFileSizeMB)
+	}
+	if !got.BlockDotfiles || !got.BlockExecutables {
+		t.Error("blocks from either side should apply")
+	}
+	if !slices.Equal(got.BlockedPaths, []string{"node_modules", "*.map"}) {
+		t.Errorf("blocked_paths = %v", got.BlockedPaths)
+	}
+	if !slices.Equal(got.AllowedExtensions, []string{".html"}) {
+		t.Errorf("allowed_extensions = %v, want only those both allow", got.AllowedExtensions)
+	}
+}
+
+func TestUploadRules_Validate(t *testing.T) {
+	for _, r := range []UploadRules{
+		{MaxFiles: -1},
+		{MaxFileSizeMB: -1},
+		{BlockedPaths: []string{"[oops"}},
+		{AllowedExtensions: []string{"html"}},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", r)
+		}
+	}
+}
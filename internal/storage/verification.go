@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const verificationFile = "verification.json"
+
+// VerificationCheck is the result of one check of a site in a verification
+// run.
+type VerificationCheck struct {
+	// Name is "deployment", "config", "serve", "files", or "webhook".
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Detail explains a failed check.
+	Detail string `json:"detail,omitempty"`
+}
+
+// SiteVerification is the result of verifying one site.
+type SiteVerification struct {
+	Site         string              `json:"site"`
+	DeploymentID string              `json:"deployment_id,omitempty"`
+	Checks       []VerificationCheck `json:"checks"`
+}
+
+// OK reports whether every check of the site passed.
+func (v SiteVerification) OK() bool {
+	for _, c := range v.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// VerificationReport is the result of a scheduled verification of every
+// site.
+type VerificationReport struct {
+	CheckedAt time.Time          `json:"checked_at"`
+	Sites     []SiteVerification `json:"sites"`
+}
+
+// Failed returns the sites that failed a check.
+func (r VerificationReport) Failed() []SiteVerification {
+	var failed []SiteVerification
+	for _, s := range r.Sites {
+		if !s.OK() {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// SpotCheckFiles checks that up to n randomly chosen files of a deployment
+// still match the size and hash in its file index, and returns a
+// description of each one that does not.
+func (s *Store) SpotCheckFiles(site, id string, n int) ([]string, error) {
+	files, err := s.ReadFileIndex(site, id)
+	if err != nil {
+		return nil, fmt.Errorf("file index: %w", err)
+	}
+	if n < len(files) {
+		rand.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+		files = files[:n]
+	}
+	contentDir := s.ContentDir(site, id)
+	var mismatched []string
+	for _, f := range files {
+		if err := verifyFile(filepath.Join(contentDir, f.Path), f); err != nil {
+			mismatched = append(mismatched, fmt.Sprintf("%s: %v", f.Path, err))
+		}
+	}
+	return mismatched, nil
+}
+
+// WriteVerificationReport saves report as the last verification report.
+func (s *Store) WriteVerificationReport(report VerificationReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(s.dataDir, verificationFile)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// LastVerificationReport returns the last saved verification report.
+// Returns os.ErrNotExist if verification never ran.
+func (s *Store) LastVerificationReport() (VerificationReport, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, verificationFile))
+	if err != nil {
+		return VerificationReport{}, err
+	}
+	var report VerificationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return VerificationReport{}, fmt.Errorf("parse verification report: %w", err)
+	}
+	return report, nil
+}
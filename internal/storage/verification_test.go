@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpotCheckFiles(t *testing.T) {
+	s := New(t.TempDir())
+	content := uploadDeployment(t, s, "docs", "aaa11111", time.Now())
+
+	mismatched, err := s.SpotCheckFiles("docs", "aaa11111", 10)
+	if err != nil || len(mismatched) != 0 {
+		t.Fatalf("intact deployment: mismatched = %v, err = %v", mismatched, err)
+	}
+
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("<h1>changed</h1>"), 0644)
+	mismatched, err = s.SpotCheckFiles("docs", "aaa11111", 10)
+	if err != nil || len(mismatched) != 1 || !strings.HasPrefix(mismatched[0], "index.html: ") {
+		t.Errorf("changed file: mismatched = %v, err = %v", mismatched, err)
+	}
+
+	if _, err := s.SpotCheckFiles("docs", "bbb22222", 10); err == nil {
+		t.Error("expected error for a deployment without a file index")
+	}
+}
+
+func TestVerificationReport(t *testing.T) {
+	s := New(t.TempDir())
+	if _, err := s.LastVerificationReport(); !os.IsNotExist(err) {
+		t.Fatalf("before any run: err = %v, want not exist", err)
+	}
+
+	report := VerificationReport{
+		CheckedAt: time.Now().UTC().Truncate(time.Second),
+		Sites: []SiteVerification{
+			{Site: "docs", DeploymentID: "aaa11111", Checks: []VerificationCheck{{Name: "serve", OK: true}}},
+			{Site: "blog", Checks: []VerificationCheck{{Name: "deployment", Detail: "no active deployment"}}},
+		},
+	}
+	if err := s.WriteVerificationReport(report); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.LastVerificationReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CheckedAt.Equal(report.CheckedAt) || len(got.Sites) != 2 {
+		t.Errorf("report = %+v", got)
+	}
+	if failed := got.Failed(); len(failed) != 1 || failed[0].Site != "blog" {
+		t.Errorf("failed = %+v", failed)
+	}
+}
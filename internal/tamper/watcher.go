@@ -0,0 +1,119 @@
+// Package tamper watches the active deployment of each site for files
+// changed in the data directory outside tspages, which make the served
+// content diverge from what was deployed.
+package tamper
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// AlertTampered is the alert of the events.OperatorAlert published when a
+// deployment is found tampered with.
+const AlertTampered = "content_tampered"
+
+// maxReported caps the differences an alert and a deployment's record list.
+const maxReported = 10
+
+// Watcher compares the files of each site's active deployment with its
+// file index. A deployment found changed is marked tampered, which the
+// admin panel shows and keeps the site from scoring as healthy, and an
+// operator alert is published once. The mark is removed when the files
+// match again.
+type Watcher struct {
+	store       *storage.Store
+	bus         *events.Bus
+	defaults    storage.SiteConfig
+	sampleFiles int
+}
+
+// NewWatcher returns a Watcher that checks the hashes of up to sampleFiles
+// files of each deployment per check, besides which files exist and their
+// sizes.
+func NewWatcher(store *storage.Store, bus *events.Bus, defaults storage.SiteConfig, sampleFiles int) *Watcher {
+	return &Watcher{store: store, bus: bus, defaults: defaults, sampleFiles: sampleFiles}
+}
+
+// Run checks the sites every interval until ctx ends.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.Check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the active deployment of every site. Deployments without a
+// file index cannot be checked, and are skipped.
+func (w *Watcher) Check() {
+	sites, err := w.store.ListSites()
+	if err != nil {
+		slog.Error("tamper: listing sites", "err", err)
+		return
+	}
+	for _, site := range sites {
+		if site.ActiveDeploymentID == "" {
+			continue
+		}
+		w.checkDeployment(site.Name, site.ActiveDeploymentID)
+	}
+}
+
+func (w *Watcher) checkDeployment(site, id string) {
+	problems, err := w.store.CheckContent(site, id, w.sampleFiles)
+	if err != nil {
+		slog.Debug("tamper: checking deployment", "site", site, "deployment", id, "err", err)
+		return
+	}
+	_, marked := w.store.Tampered(site, id)
+	if len(problems) == 0 {
+		if marked {
+			slog.Info("tampered deployment matches its files again", "site", site, "deployment", id)
+			if err := w.store.ClearTampered(site, id); err != nil {
+				slog.Error("tamper: clearing mark", "site", site, "deployment", id, "err", err)
+			}
+		}
+		return
+	}
+	if marked {
+		return
+	}
+
+	reported := problems[:min(len(problems), maxReported)]
+	reason := strings.Join(reported, "; ")
+	if len(problems) > len(reported) {
+		reason += "; ..."
+	}
+	slog.Warn("deployment files changed outside tspages", "site", site, "deployment", id,
+		"files", len(problems), "reason", reason)
+	if err := w.store.MarkTampered(site, id, reason); err != nil {
+		slog.Error("tamper: marking deployment", "site", site, "deployment", id, "err", err)
+		return
+	}
+	if w.bus == nil {
+		return
+	}
+	raw, _ := w.store.ReadSiteConfig(site, id)
+	w.bus.Publish(events.Event{
+		Type:   events.OperatorAlert,
+		Site:   site,
+		Config: raw.Merge(w.defaults),
+		Data: map[string]any{
+			"site":          site,
+			"alert":         AlertTampered,
+			"deployment_id": id,
+			"files":         len(problems),
+			"error":         reason,
+		},
+	})
+}
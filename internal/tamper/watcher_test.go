@@ -0,0 +1,67 @@
+package tamper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// setupSite activates a deployment of site with an index.html and a file
+// index of it, and returns the deployment's ID.
+func setupSite(t *testing.T, store *storage.Store, site string) string {
+	t.Helper()
+	id := storage.NewDeploymentID()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	dir := store.ContentDir(site, id)
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>"+site+"</h1>"), 0644)
+	files, err := storage.IndexDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.WriteFileIndex(site, id, files)
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestWatcher_Check(t *testing.T) {
+	store := storage.New(t.TempDir())
+	id := setupSite(t, store, "docs")
+	setupSite(t, store, "demo")
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.OperatorAlert, func(e events.Event) { got = append(got, e) })
+	w := NewWatcher(store, bus, storage.SiteConfig{}, 20)
+
+	w.Check()
+	if len(got) != 0 {
+		t.Fatalf("alerts for untouched sites: %+v", got)
+	}
+
+	index := filepath.Join(store.ContentDir("docs", id), "index.html")
+	os.WriteFile(index, []byte("<h1>hacked</h1>"), 0644)
+	w.Check()
+	w.Check()
+	if len(got) != 1 || got[0].Site != "docs" || got[0].Data["alert"] != AlertTampered || got[0].Data["deployment_id"] != id {
+		t.Fatalf("alerts = %+v, want one for docs", got)
+	}
+	if reason, ok := store.Tampered("docs", id); !ok || reason == "" {
+		t.Errorf("docs not marked tampered: %q", reason)
+	}
+
+	// Restoring the file clears the mark.
+	os.WriteFile(index, []byte("<h1>docs</h1>"), 0644)
+	w.Check()
+	if _, ok := store.Tampered("docs", id); ok {
+		t.Error("docs still marked tampered after its files were restored")
+	}
+}
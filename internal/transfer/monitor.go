@@ -0,0 +1,111 @@
+// Package transfer compares each site's monthly bandwidth with its soft
+// transfer cap and announces when a site goes over.
+package transfer
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// Interval is how often Run checks the caps.
+const Interval = 15 * time.Minute
+
+// Monitor checks sites with a transfer_cap_mb against the bytes they served
+// in the current UTC month. The cap is soft: going over publishes a
+// events.SiteTransferCapExceeded event once per site and month, and serving
+// continues.
+type Monitor struct {
+	store    *storage.Store
+	recorder *analytics.Recorder
+	bus      *events.Bus
+	defaults storage.SiteConfig
+}
+
+func NewMonitor(store *storage.Store, recorder *analytics.Recorder, bus *events.Bus, defaults storage.SiteConfig) *Monitor {
+	return &Monitor{store: store, recorder: recorder, bus: bus, defaults: defaults}
+}
+
+// MonthStart returns the start of t's UTC month, where cap accounting
+// begins.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// CapBytes converts a transfer_cap_mb value to bytes.
+func CapBytes(capMB int64) int64 { return capMB << 20 }
+
+// Run checks the caps every Interval until ctx ends.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		m.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check compares every capped site's transfer this month with its cap.
+func (m *Monitor) Check(now time.Time) {
+	sites, err := m.store.ListSites()
+	if err != nil {
+		slog.Error("transfer: listing sites", "err", err)
+		return
+	}
+	month := now.UTC().Format("2006-01")
+	for _, site := range sites {
+		if site.ActiveDeploymentID == "" {
+			continue
+		}
+		raw, err := m.store.ReadSiteConfig(site.Name, site.ActiveDeploymentID)
+		if err != nil {
+			slog.Error("transfer: reading site config", "site", site.Name, "err", err)
+			continue
+		}
+		cfg := raw.Merge(m.defaults)
+		if cfg.TransferCapMB <= 0 {
+			continue
+		}
+		used, err := m.recorder.TotalTransfer(site.Name, MonthStart(now), now)
+		if err != nil {
+			slog.Error("transfer: querying transfer", "site", site.Name, "err", err)
+			continue
+		}
+		capBytes := CapBytes(cfg.TransferCapMB)
+		if used < capBytes {
+			continue
+		}
+		first, err := m.recorder.MarkTransferAlert(site.Name, month)
+		if err != nil {
+			slog.Error("transfer: recording alert", "site", site.Name, "err", err)
+			continue
+		}
+		if !first {
+			continue
+		}
+		slog.Warn("site exceeded its transfer cap", "site", site.Name, "month", month,
+			"bytes", used, "cap_bytes", capBytes)
+		if m.bus != nil {
+			m.bus.Publish(events.Event{
+				Type:   events.SiteTransferCapExceeded,
+				Site:   site.Name,
+				Config: cfg,
+				Data: map[string]any{
+					"site":      site.Name,
+					"month":     month,
+					"bytes":     used,
+					"cap_bytes": capBytes,
+				},
+			})
+		}
+	}
+}
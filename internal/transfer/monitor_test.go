@@ -0,0 +1,96 @@
+package transfer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tspages/internal/analytics"
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+func setupSite(t *testing.T, store *storage.Store, site string, cfg storage.SiteConfig) {
+	t.Helper()
+	id := storage.NewDeploymentID()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteSiteConfig(site, id, cfg); err != nil {
+		t.Fatal(err)
+	}
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", storage.SiteConfig{TransferCapMB: 1})
+	setupSite(t, store, "demo", storage.SiteConfig{})
+	setupSite(t, store, "blog", storage.SiteConfig{TransferCapMB: 10})
+
+	// Transfer is written when the recorder closes.
+	dbPath := filepath.Join(t.TempDir(), "analytics.db")
+	recorder, err := analytics.NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	// Last month's transfer does not count toward this month's cap.
+	recorder.RecordTransfer("docs", time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC), 5<<20)
+	recorder.RecordTransfer("docs", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 1<<19)
+	recorder.RecordTransfer("docs", now, 1<<19)
+	recorder.RecordTransfer("demo", now, 50<<20)
+	recorder.RecordTransfer("blog", now, 1<<20)
+	recorder.Close()
+	recorder, err = analytics.NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe(events.SiteTransferCapExceeded, func(e events.Event) { got = append(got, e) })
+
+	m := NewMonitor(store, recorder, bus, storage.SiteConfig{})
+	m.Check(now)
+	if len(got) != 1 || got[0].Site != "docs" {
+		t.Fatalf("events = %+v, want one for docs", got)
+	}
+	if got[0].Data["bytes"] != int64(1<<20) || got[0].Data["cap_bytes"] != int64(1<<20) || got[0].Data["month"] != "2026-03" {
+		t.Errorf("data = %v", got[0].Data)
+	}
+
+	// Each site is announced once per month.
+	m.Check(now.Add(time.Hour))
+	if len(got) != 1 {
+		t.Errorf("events after second check = %d, want 1", len(got))
+	}
+}
+
+func TestMonitor_DefaultCap(t *testing.T) {
+	store := storage.New(t.TempDir())
+	setupSite(t, store, "docs", storage.SiteConfig{})
+
+	dbPath := filepath.Join(t.TempDir(), "analytics.db")
+	recorder, err := analytics.NewRecorder(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	recorder.RecordTransfer("docs", now, 3<<20)
+	recorder.Close()
+	recorder, _ = analytics.NewRecorder(dbPath)
+	defer recorder.Close()
+
+	bus := events.New()
+	var got []events.Event
+	bus.Subscribe("site.*", func(e events.Event) { got = append(got, e) })
+	NewMonitor(store, recorder, bus, storage.SiteConfig{TransferCapMB: 2}).Check(now)
+	if len(got) != 1 || got[0].Config.TransferCapMB != 2 {
+		t.Errorf("events = %+v", got)
+	}
+}
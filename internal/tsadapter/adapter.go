@@ -3,11 +3,14 @@ package tsadapter
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"tspages/internal/auth"
 
 	"tailscale.com/client/local"
 	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn/ipnstate"
 )
 
 // Adapter wraps a real tailscale local.Client to implement auth.WhoIsClient.
@@ -27,6 +30,48 @@ func (a *Adapter) WhoIs(ctx context.Context, remoteAddr string) (*auth.WhoIsResu
 	return convertResponse(who), nil
 }
 
+// WhoIsLogin resolves a login name to the WhoIs result of one of that user's
+// devices, so capabilities can be evaluated as if the user made the request.
+// Online devices are preferred; tagged devices are ignored because they are
+// not owned by the user in the policy's sense.
+func (a *Adapter) WhoIsLogin(ctx context.Context, login string) (*auth.WhoIsResult, error) {
+	st, err := a.client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := peerAddrForLogin(st, login)
+	if !ok {
+		return nil, fmt.Errorf("no device found for user %q", login)
+	}
+	return a.WhoIs(ctx, addr)
+}
+
+// peerAddrForLogin returns the Tailscale IP of a device owned by login,
+// preferring devices that are currently online.
+func peerAddrForLogin(st *ipnstate.Status, login string) (string, bool) {
+	var fallback string
+	for _, peer := range st.Peer {
+		if peer.Tags != nil && peer.Tags.Len() > 0 {
+			continue
+		}
+		if len(peer.TailscaleIPs) == 0 {
+			continue
+		}
+		profile, ok := st.User[peer.UserID]
+		if !ok || !strings.EqualFold(profile.LoginName, login) {
+			continue
+		}
+		addr := peer.TailscaleIPs[0].String()
+		if peer.Online {
+			return addr, true
+		}
+		if fallback == "" {
+			fallback = addr
+		}
+	}
+	return fallback, fallback != ""
+}
+
 func convertResponse(who *apitype.WhoIsResponse) *auth.WhoIsResult {
 	result := &auth.WhoIsResult{
 		CapMap: make(map[string][]json.RawMessage),
@@ -6,7 +6,10 @@ import (
 	"testing"
 
 	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/views"
 )
 
 func TestConvertResponse_FullProfile(t *testing.T) {
@@ -157,3 +160,28 @@ func TestConvertResponse_MultipleCaps(t *testing.T) {
 		t.Fatalf("got %d caps, want 2", len(raw))
 	}
 }
+
+func TestPeerAddrForLogin(t *testing.T) {
+	tags := views.SliceOf([]string{"tag:ci"})
+	st := &ipnstate.Status{
+		User: map[tailcfg.UserID]tailcfg.UserProfile{
+			1: {LoginName: "alice@example.com"},
+			2: {LoginName: "bob@example.com"},
+		},
+		Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+			key.NewNode().Public(): {UserID: 1, TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.1")}},
+			key.NewNode().Public(): {UserID: 1, TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.2")}, Online: true},
+			key.NewNode().Public(): {UserID: 2, TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.3")}, Tags: &tags},
+		},
+	}
+
+	if addr, ok := peerAddrForLogin(st, "Alice@example.com"); !ok || addr != "100.64.0.2" {
+		t.Errorf("alice = %q, %v; want online device 100.64.0.2", addr, ok)
+	}
+	if addr, ok := peerAddrForLogin(st, "bob@example.com"); ok {
+		t.Errorf("bob = %q, want no match for tagged device", addr)
+	}
+	if _, ok := peerAddrForLogin(st, "carol@example.com"); ok {
+		t.Error("carol: want no match")
+	}
+}
@@ -0,0 +1,223 @@
+// Package verify checks every site on a schedule: that its active
+// deployment exists and serves its index page, its config parses, a sample
+// of its files still match their hashes, and its webhook endpoint answers a
+// ping. Each report is saved for the admin panel and sent to the digest's
+// destinations.
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"tspages/internal/digest"
+	"tspages/internal/storage"
+)
+
+// Checks run for each site, in order.
+const (
+	CheckDeployment = "deployment"
+	CheckConfig     = "config"
+	CheckServe      = "serve"
+	CheckFiles      = "files"
+	CheckWebhook    = "webhook"
+)
+
+// Prober requests a path from a site's running server.
+type Prober interface {
+	Probe(site, path string) (int, error)
+}
+
+// Pinger sends a ping event to a site's webhook endpoint.
+type Pinger interface {
+	Ping(site string, cfg storage.SiteConfig) (int, error)
+}
+
+// Verifier checks the sites and reports the results.
+type Verifier struct {
+	store    *storage.Store
+	prober   Prober
+	pinger   Pinger
+	defaults storage.SiteConfig
+	// sampleFiles is how many files of each active deployment are checked
+	// against their hashes.
+	sampleFiles int
+	senders     []digest.Sender
+}
+
+// NewVerifier returns a Verifier that checks sampleFiles files of each
+// site and sends its reports to every sender.
+func NewVerifier(store *storage.Store, prober Prober, pinger Pinger, defaults storage.SiteConfig, sampleFiles int, senders ...digest.Sender) *Verifier {
+	return &Verifier{store: store, prober: prober, pinger: pinger, defaults: defaults,
+		sampleFiles: sampleFiles, senders: senders}
+}
+
+// Run verifies the sites at every scheduled time until ctx ends.
+func (v *Verifier) Run(ctx context.Context, schedule digest.Schedule) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("verification schedule never fires")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		v.Send(v.Verify(next))
+	}
+}
+
+// Send saves report as the last one and delivers it to every sender. A
+// failing sender does not keep the others from receiving it.
+func (v *Verifier) Send(report storage.VerificationReport) {
+	if err := v.store.WriteVerificationReport(report); err != nil {
+		slog.Error("saving verification report", "err", err)
+	}
+	sent := 0
+	for _, sender := range v.senders {
+		if err := sender.Send(message{report}); err != nil {
+			slog.Error("sending verification report", "err", err)
+			continue
+		}
+		sent++
+	}
+	slog.Info("sent verification report", "sites", len(report.Sites), "failed", len(report.Failed()), "destinations", sent)
+}
+
+// Verify checks every site that is not archived and has been deployed to.
+func (v *Verifier) Verify(now time.Time) storage.VerificationReport {
+	report := storage.VerificationReport{CheckedAt: now.UTC(), Sites: []storage.SiteVerification{}}
+	sites, err := v.store.ListSites()
+	if err != nil {
+		slog.Error("verify: listing sites", "err", err)
+		return report
+	}
+	for _, site := range sites {
+		if v.store.SiteArchived(site.Name) {
+			continue
+		}
+		if deployments, _ := v.store.ListDeployments(site.Name); len(deployments) == 0 {
+			continue
+		}
+		report.Sites = append(report.Sites, v.verifySite(site.Name))
+	}
+	return report
+}
+
+func (v *Verifier) verifySite(site string) storage.SiteVerification {
+	result := storage.SiteVerification{Site: site}
+	check := func(name string, err error) bool {
+		c := storage.VerificationCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		result.Checks = append(result.Checks, c)
+		return err == nil
+	}
+
+	id, err := v.store.CurrentDeployment(site)
+	if err != nil {
+		check(CheckDeployment, errors.New("no active deployment"))
+		return result
+	}
+	result.DeploymentID = id
+	if _, err := v.store.ReadManifest(site, id); err != nil {
+		check(CheckDeployment, fmt.Errorf("manifest: %w", err))
+		return result
+	}
+	check(CheckDeployment, nil)
+
+	raw, err := v.store.ReadSiteConfig(site, id)
+	if err == nil {
+		err = raw.Validate()
+	}
+	configOK := check(CheckConfig, err)
+
+	check(CheckServe, v.probe(site))
+
+	mismatched, err := v.store.SpotCheckFiles(site, id, v.sampleFiles)
+	if err == nil && len(mismatched) > 0 {
+		err = fmt.Errorf("%d sampled files do not match their hashes: %s", len(mismatched), strings.Join(mismatched, "; "))
+	}
+	check(CheckFiles, err)
+
+	if cfg := raw.Merge(v.defaults); configOK && cfg.WebhookURL != "" {
+		check(CheckWebhook, v.ping(site, cfg))
+	}
+	return result
+}
+
+// probe checks that the site's index page is served with 200.
+func (v *Verifier) probe(site string) error {
+	status, err := v.prober.Probe(site, "/")
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return fmt.Errorf("GET / returned %d", status)
+	}
+	return nil
+}
+
+// ping checks that the site's webhook endpoint accepts a ping event.
+func (v *Verifier) ping(site string, cfg storage.SiteConfig) error {
+	status, err := v.pinger.Ping(site, cfg)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("ping returned %d", status)
+	}
+	return nil
+}
+
+// message renders a report for the digest's senders.
+type message struct{ storage.VerificationReport }
+
+func (m message) Subject() string {
+	failed := len(m.Failed())
+	if failed == 0 {
+		return fmt.Sprintf("tspages verification: all %d sites passed", len(m.Sites))
+	}
+	return fmt.Sprintf("tspages verification: %d of %d sites failed", failed, len(m.Sites))
+}
+
+// Text lists the failed checks of each failed site, followed by a line
+// naming the sites that passed.
+func (m message) Text() string {
+	var b strings.Builder
+	b.WriteString(m.Subject())
+	b.WriteString("\n")
+
+	var passed []string
+	for _, s := range m.Sites {
+		if s.OK() {
+			passed = append(passed, s.Site)
+			continue
+		}
+		if s.DeploymentID != "" {
+			fmt.Fprintf(&b, "\n%s (%s)\n", s.Site, s.DeploymentID)
+		} else {
+			fmt.Fprintf(&b, "\n%s\n", s.Site)
+		}
+		for _, c := range s.Checks {
+			if !c.OK {
+				fmt.Fprintf(&b, "  %s: %s\n", c.Name, c.Detail)
+			}
+		}
+	}
+	switch {
+	case len(m.Sites) == 0:
+		b.WriteString("\nNo sites.\n")
+	case len(passed) > 0:
+		fmt.Fprintf(&b, "\nPassed: %s\n", strings.Join(passed, ", "))
+	}
+	return b.String()
+}
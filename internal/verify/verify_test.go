@@ -0,0 +1,117 @@
+package verify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tspages/internal/digest"
+	"tspages/internal/storage"
+)
+
+type fakeProber map[string]int
+
+func (p fakeProber) Probe(site, path string) (int, error) {
+	status, ok := p[site]
+	if !ok {
+		return 0, errors.New("server is not running")
+	}
+	return status, nil
+}
+
+type fakePinger map[string]int
+
+func (p fakePinger) Ping(site string, cfg storage.SiteConfig) (int, error) {
+	return p[cfg.WebhookURL], nil
+}
+
+type recordingSender struct{ messages []digest.Message }
+
+func (s *recordingSender) Send(m digest.Message) error {
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+// deploy creates and activates a complete deployment of site with an
+// index.html and the given config.
+func deploy(t *testing.T, store *storage.Store, site, id string, cfg storage.SiteConfig) string {
+	t.Helper()
+	if _, err := store.CreateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	content := store.ContentDir(site, id)
+	os.MkdirAll(content, 0755)
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("<h1>"+site+"</h1>"), 0644)
+	store.WriteManifest(site, id, storage.Manifest{Site: site, ID: id, CreatedAt: time.Now()})
+	files, _ := store.ListDeploymentFiles(site, id)
+	store.WriteFileIndex(site, id, files)
+	store.WriteSiteConfig(site, id, cfg)
+	store.MarkComplete(site, id)
+	if err := store.ActivateDeployment(site, id); err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestVerifier(t *testing.T) {
+	dataDir := t.TempDir()
+	store := storage.New(dataDir)
+	deploy(t, store, "docs", "aaa11111", storage.SiteConfig{WebhookURL: "https://hooks.example.com/ok"})
+	content := deploy(t, store, "blog", "bbb22222", storage.SiteConfig{WebhookURL: "https://hooks.example.com/gone"})
+	os.WriteFile(filepath.Join(content, "index.html"), []byte("tampered"), 0644)
+	deploy(t, store, "wiki", "ccc33333", storage.SiteConfig{})
+	os.Remove(filepath.Join(dataDir, "sites", "wiki", "current"))
+	deploy(t, store, "old", "ddd44444", storage.SiteConfig{})
+	store.ArchiveSite("old", storage.ArchiveState{})
+	store.CreateSite("empty")
+
+	sender := &recordingSender{}
+	v := NewVerifier(store, fakeProber{"docs": 200, "blog": 404}, fakePinger{"https://hooks.example.com/ok": 204, "https://hooks.example.com/gone": 410},
+		storage.SiteConfig{}, 10, sender)
+	report := v.Verify(time.Now())
+
+	got := map[string]map[string]bool{}
+	for _, s := range report.Sites {
+		got[s.Site] = map[string]bool{}
+		for _, c := range s.Checks {
+			got[s.Site][c.Name] = c.OK
+		}
+	}
+	want := map[string]map[string]bool{
+		"docs": {CheckDeployment: true, CheckConfig: true, CheckServe: true, CheckFiles: true, CheckWebhook: true},
+		"blog": {CheckDeployment: true, CheckConfig: true, CheckServe: false, CheckFiles: false, CheckWebhook: false},
+		"wiki": {CheckDeployment: false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("verified sites = %v, want docs, blog, wiki", got)
+	}
+	for site, checks := range want {
+		for name, ok := range checks {
+			if got[site][name] != ok || len(got[site]) != len(checks) {
+				t.Errorf("%s: checks = %v, want %v", site, got[site], checks)
+				break
+			}
+		}
+	}
+
+	v.Send(report)
+	saved, err := store.LastVerificationReport()
+	if err != nil || len(saved.Failed()) != 2 {
+		t.Errorf("saved report = %+v, err = %v", saved, err)
+	}
+	if len(sender.messages) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sender.messages))
+	}
+	m := sender.messages[0]
+	if m.Subject() != "tspages verification: 2 of 3 sites failed" {
+		t.Errorf("subject = %q", m.Subject())
+	}
+	for _, want := range []string{"blog (bbb22222)\n", "  serve: GET / returned 404\n", "  webhook: ping returned 410\n", "wiki\n  deployment: no active deployment\n", "Passed: docs\n"} {
+		if !strings.Contains(m.Text(), want) {
+			t.Errorf("text missing %q:\n%s", want, m.Text())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// PurgeOnActivation sends the purge webhooks of a site's config, merged
+// over defaults, whenever one of its deployments is activated, so external
+// caches in front of the site drop what the activation changed. It returns
+// a function that stops purging.
+func (n *Notifier) PurgeOnActivation(bus *events.Bus, store *storage.Store, defaults storage.SiteConfig) (unsubscribe func()) {
+	return bus.Subscribe(events.DeploymentActivated, func(e events.Event) {
+		id, _ := e.Data["deployment_id"].(string)
+		previous, _ := e.Data["previous_deployment_id"].(string)
+		go n.purgeActivation(store, defaults, e.Site, id, previous, e.RequestID)
+	})
+}
+
+// purgeActivation sends the purge webhooks of site for the activation of
+// deployment id, which replaced previous.
+func (n *Notifier) purgeActivation(store *storage.Store, defaults storage.SiteConfig, site, id, previous, requestID string) {
+	cfg, err := store.ReadSiteConfig(site, id)
+	if err != nil {
+		slog.Warn("purge webhook: reading site config failed", "site", site, "deployment", id, "err", err)
+		return
+	}
+	hooks := cfg.Merge(defaults).PurgeWebhooks
+	if len(hooks) == 0 {
+		return
+	}
+	var paths []string
+	if slices.ContainsFunc(hooks, func(h storage.PurgeWebhook) bool { return strings.Contains(h.URL, "{path}") }) {
+		if paths, err = changedPaths(store, site, id, previous); err != nil {
+			slog.Warn("purge webhook: diffing deployments failed", "site", site, "deployment", id, "err", err)
+			return
+		}
+	}
+	for _, h := range hooks {
+		n.purge(site, requestID, h, paths)
+	}
+}
+
+// changedPaths returns the URL paths of the files deployment id added,
+// changed, or removed compared to previous, or all of its files if there is
+// no previous deployment. A directory index also stands for its directory.
+func changedPaths(store *storage.Store, site, id, previous string) ([]string, error) {
+	current, err := store.ListDeploymentFiles(site, id)
+	if err != nil {
+		return nil, err
+	}
+	var before []storage.FileInfo
+	if previous != "" {
+		// A deleted previous deployment leaves nothing to compare with, so
+		// every file counts as added.
+		if before, err = store.ListDeploymentFiles(site, previous); err != nil {
+			slog.Warn("purge webhook: listing previous deployment failed", "site", site, "deployment", previous, "err", err)
+		}
+	}
+	added, removed, changed := storage.DiffFiles(current, before)
+
+	var paths []string
+	for _, file := range slices.Concat(added, removed, changed) {
+		paths = append(paths, "/"+file)
+		if dir, ok := strings.CutSuffix(file, "index.html"); ok && (dir == "" || strings.HasSuffix(dir, "/")) {
+			paths = append(paths, "/"+dir)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// purge sends the requests of purge webhook h: one for each of paths if its
+// URL has a {path} placeholder, or a single one otherwise. Requests that
+// fail with a network error or a server error are retried after the
+// notifier's retry delays.
+func (n *Notifier) purge(site, requestID string, h storage.PurgeWebhook, paths []string) {
+	var targets []string
+	if strings.Contains(h.URL, "{path}") {
+		for _, p := range paths {
+			targets = append(targets, purgeURL(h.URL, site, p))
+		}
+	} else {
+		targets = []string{purgeURL(h.URL, site, "")}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	sent := len(targets)
+	for attempt := 0; ; attempt++ {
+		var retry []string
+		for _, target := range targets {
+			status, err := n.sendPurge(h, target)
+			switch {
+			case err != nil || status >= 500:
+				retry = append(retry, target)
+			case status >= 400 && status != http.StatusNotFound:
+				// Nothing cached under the URL is not a failure, but
+				// other client errors will not go away by retrying.
+				slog.Warn("purge webhook: request rejected", "site", site, "request_id", requestID, "url", target, "status", status)
+			}
+		}
+		if len(retry) == 0 {
+			slog.Info("purge webhook sent", "site", site, "request_id", requestID, "requests", sent)
+			return
+		}
+		if attempt == len(n.retryDelays) {
+			slog.Warn("purge webhook: requests failed", "site", site, "request_id", requestID, "requests", sent, "failed", len(retry), "url", retry[0])
+			return
+		}
+		targets = retry
+		time.Sleep(n.retryDelays[attempt])
+	}
+}
+
+// sendPurge sends a purge request of h to target, and returns the response
+// status.
+func (n *Notifier) sendPurge(h storage.PurgeWebhook, target string) (int, error) {
+	method := h.Method
+	if method == "" {
+		method = "PURGE"
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	if name, value, ok := strings.Cut(h.AuthHeader, ":"); ok {
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	// Wait for a slot rather than dropping the request, since a purge that
+	// is not sent leaves stale content in the cache.
+	n.sem <- struct{}{}
+	resp, err := n.client.Do(req)
+	<-n.sem
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// purgeURL fills the {site} and {path} placeholders of tmpl, escaping path.
+func purgeURL(tmpl, site, path string) string {
+	return strings.NewReplacer("{site}", site, "{path}", (&url.URL{Path: path}).EscapedPath()).Replace(tmpl)
+}
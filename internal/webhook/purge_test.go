@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// writeDeployment writes a deployment of site with files and cfg.
+func writeDeployment(t *testing.T, store *storage.Store, site, id string, cfg storage.SiteConfig, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(store.ContentDir(site, id), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.WriteSiteConfig(site, id, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifier_PurgeOnActivation(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	done := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		done <- struct{}{}
+	}))
+	defer srv.Close()
+
+	n, _ := testNotifier(t)
+	store := storage.New(t.TempDir())
+	cfg := storage.SiteConfig{PurgeWebhooks: []storage.PurgeWebhook{
+		{Type: storage.PurgeWebhookHTTP, URL: srv.URL + "/{site}{path}", AuthHeader: "Authorization: Bearer token"},
+		{Type: storage.PurgeWebhookHTTP, Method: "POST", URL: srv.URL + "/ban/{site}"},
+	}}
+	writeDeployment(t, store, "docs", "old", cfg, map[string]string{
+		"index.html": "old", "guide/index.html": "same", "gone.css": "x",
+	})
+	writeDeployment(t, store, "docs", "new", cfg, map[string]string{
+		"index.html": "new", "guide/index.html": "same", "a b.js": "x",
+	})
+
+	bus := events.New()
+	n.PurgeOnActivation(bus, store, storage.SiteConfig{})
+	bus.Publish(events.Event{Type: events.DeploymentActivated, Site: "docs", Data: map[string]any{
+		"deployment_id": "new", "previous_deployment_id": "old",
+	}})
+
+	want := []string{
+		"PURGE /docs/ Bearer token",
+		"PURGE /docs/a b.js Bearer token",
+		"PURGE /docs/gone.css Bearer token",
+		"PURGE /docs/index.html Bearer token",
+		"POST /ban/docs ",
+	}
+	for range want {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out; got %q", got)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestNotifier_PurgeRetries(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	n, _ := testNotifier(t)
+	n.retryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	n.purge("docs", "", storage.PurgeWebhook{Type: storage.PurgeWebhookHTTP, URL: srv.URL + "{path}"}, []string{"/index.html"})
+
+	// The 502 is retried; the 404 means nothing was cached and is not.
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestPurgeURL(t *testing.T) {
+	tests := []struct{ tmpl, path, want string }{
+		{"https://cache.example.com/{site}{path}", "/a b.html", "https://cache.example.com/docs/a%20b.html"},
+		{"https://cache.example.com/purge?site={site}", "", "https://cache.example.com/purge?site=docs"},
+	}
+	for _, tt := range tests {
+		if got := purgeURL(tt.tmpl, "docs", tt.path); got != tt.want {
+			t.Errorf("purgeURL(%q, %q) = %q, want %q", tt.tmpl, tt.path, got, tt.want)
+		}
+	}
+}
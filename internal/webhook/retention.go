@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"fmt"
+	"time"
+)
+
+// Prune deletes deliveries whose last attempt was before cutoff, with all
+// their attempts, and returns the number of attempt rows removed.
+// Deliveries with a recent retry are kept whole.
+func (n *Notifier) Prune(cutoff time.Time) (int64, error) {
+	res, err := n.db.Exec(
+		`DELETE FROM webhook_deliveries WHERE webhook_id IN (
+			SELECT webhook_id FROM webhook_deliveries GROUP BY webhook_id HAVING MAX(created_at) < ?
+		)`,
+		cutoff.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune deliveries: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// TableStats describes the size of the delivery log.
+type TableStats struct {
+	Attempts   int64  `json:"attempts"`
+	Deliveries int64  `json:"deliveries"`
+	Oldest     string `json:"oldest,omitempty"`
+	// SizeBytes is the space the table and its indexes take on disk, or
+	// zero if SQLite cannot report it.
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// TableStats returns row counts and the on-disk size of the delivery log.
+func (n *Notifier) TableStats() (TableStats, error) {
+	var s TableStats
+	err := n.db.QueryRow(
+		`SELECT COUNT(*), COUNT(DISTINCT webhook_id), COALESCE(MIN(created_at), '') FROM webhook_deliveries`,
+	).Scan(&s.Attempts, &s.Deliveries, &s.Oldest)
+	if err != nil {
+		return s, fmt.Errorf("table stats: %w", err)
+	}
+	// dbstat is compiled into the SQLite driver; a failure only leaves the
+	// size unknown.
+	_ = n.db.QueryRow(
+		`SELECT COALESCE(SUM(pgsize), 0) FROM dbstat
+		 WHERE name IN (SELECT name FROM sqlite_schema WHERE tbl_name = 'webhook_deliveries')`,
+	).Scan(&s.SizeBytes)
+	return s, nil
+}
+
+// DeliveryRecord is one delivery attempt as written by Export.
+type DeliveryRecord struct {
+	WebhookID  string `json:"webhook_id"`
+	Event      string `json:"event"`
+	Site       string `json:"site"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	Signed     bool   `json:"signed"`
+	DurationMs int64  `json:"duration_ms"`
+	Payload    string `json:"payload"`
+}
+
+// Export calls fn for every delivery attempt made at or after since, oldest
+// first, reading rows as fn consumes them. A zero since exports everything.
+// Export stops at the first error fn returns.
+func (n *Notifier) Export(since time.Time, fn func(DeliveryRecord) error) error {
+	var from string
+	if !since.IsZero() {
+		from = since.UTC().Format(time.RFC3339)
+	}
+	rows, err := n.db.Query(
+		`SELECT webhook_id, event, site, url, attempt, COALESCE(status, 0), error, created_at, signed, duration_ms, payload
+		 FROM webhook_deliveries WHERE created_at >= ? ORDER BY created_at, id`,
+		from,
+	)
+	if err != nil {
+		return fmt.Errorf("export deliveries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DeliveryRecord
+		if err := rows.Scan(&d.WebhookID, &d.Event, &d.Site, &d.URL, &d.Attempt, &d.Status, &d.Error,
+			&d.CreatedAt, &d.Signed, &d.DurationMs, &d.Payload); err != nil {
+			return fmt.Errorf("scan delivery: %w", err)
+		}
+		payload, err := n.cipher.Decrypt(d.Payload)
+		if err != nil {
+			return fmt.Errorf("export delivery %s: %w", d.WebhookID, err)
+		}
+		d.Payload = payload
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
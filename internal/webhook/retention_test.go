@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func insertAttempts(t *testing.T, db *sql.DB) {
+	t.Helper()
+	rows := []struct {
+		id      string
+		site    string
+		attempt int
+		status  int
+		ts      string
+	}{
+		{"msg_old", "docs", 1, 200, "2025-01-01T10:00:00Z"},
+		{"msg_retried", "blog", 1, 500, "2025-01-01T11:00:00Z"},
+		{"msg_retried", "blog", 2, 200, "2025-03-01T11:00:00Z"},
+		{"msg_new", "docs", 1, 200, "2025-03-02T12:00:00Z"},
+	}
+	for _, r := range rows {
+		_, err := db.Exec(
+			`INSERT INTO webhook_deliveries (webhook_id, event, site, url, payload, attempt, status, error, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.id, "deploy.success", r.site, "http://example.com", `{"type":"deploy.success"}`, r.attempt, r.status, "", r.ts,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNotifier_Prune(t *testing.T) {
+	n, db := testNotifier(t)
+	insertAttempts(t, db)
+
+	cutoff, _ := time.Parse(time.RFC3339, "2025-02-01T00:00:00Z")
+	removed, err := n.Prune(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+
+	// The retried delivery is kept whole, since its last attempt is recent.
+	attempts, err := n.GetDeliveryAttempts("msg_retried")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Errorf("msg_retried attempts = %d, want 2", len(attempts))
+	}
+	if _, err := n.GetDelivery("msg_old"); err == nil {
+		t.Error("msg_old should be pruned")
+	}
+}
+
+func TestNotifier_TableStats(t *testing.T) {
+	n, db := testNotifier(t)
+
+	stats, err := n.TableStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Attempts != 0 || stats.Oldest != "" {
+		t.Errorf("empty stats = %+v", stats)
+	}
+
+	insertAttempts(t, db)
+	stats, err = n.TableStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Attempts != 4 || stats.Deliveries != 3 {
+		t.Errorf("attempts/deliveries = %d/%d, want 4/3", stats.Attempts, stats.Deliveries)
+	}
+	if stats.Oldest != "2025-01-01T10:00:00Z" {
+		t.Errorf("oldest = %q", stats.Oldest)
+	}
+	if stats.SizeBytes <= 0 {
+		t.Errorf("size_bytes = %d, want > 0", stats.SizeBytes)
+	}
+}
+
+func TestNotifier_Export(t *testing.T) {
+	n, db := testNotifier(t)
+	insertAttempts(t, db)
+
+	var got []DeliveryRecord
+	collect := func(d DeliveryRecord) error {
+		got = append(got, d)
+		return nil
+	}
+	if err := n.Export(time.Time{}, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("exported %d attempts, want 4", len(got))
+	}
+	if got[0].WebhookID != "msg_old" || got[3].WebhookID != "msg_new" {
+		t.Errorf("order = %s..%s, want oldest first", got[0].WebhookID, got[3].WebhookID)
+	}
+	if got[0].Payload != `{"type":"deploy.success"}` || got[0].Status != 200 {
+		t.Errorf("record = %+v", got[0])
+	}
+
+	got = nil
+	since, _ := time.Parse(time.RFC3339, "2025-02-01T00:00:00Z")
+	if err := n.Export(since, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("exported %d attempts since %v, want 2", len(got), since)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := n.Export(time.Time{}, func(DeliveryRecord) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want stop after 1", err, calls)
+	}
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"slices"
+	"time"
+
+	"tspages/internal/events"
+	"tspages/internal/storage"
+)
+
+// SummaryEvent is the type of a webhook that carries several events held
+// back by quiet hours or a rate limit, sent together once they are over.
+const SummaryEvent = "webhook.summary"
+
+// rateWindow is the period webhook_rate_limit counts webhooks in.
+const rateWindow = time.Minute
+
+// criticalEvents are sent during quiet hours.
+var criticalEvents = []string{events.DeployFailed, events.OperatorAlert, events.SiteTransferCapExceeded}
+
+// heldEvent is an event held back from a destination, as it appears in the
+// data of a summary.
+type heldEvent struct {
+	Type      string         `json:"type"`
+	Timestamp string         `json:"timestamp"`
+	RequestID string         `json:"request_id,omitempty"`
+	Data      map[string]any `json:"data"`
+	critical  bool
+}
+
+// destination is the webhook URL of a site, with the webhooks recently sent
+// to it and those held back.
+type destination struct {
+	key, site string
+	cfg       storage.SiteConfig
+	sent      []time.Time
+	held      []heldEvent
+	timer     *time.Timer
+	flushAt   time.Time
+}
+
+// throttled reports whether cfg may hold webhooks back.
+func throttled(cfg storage.SiteConfig) bool {
+	return cfg.WebhookQuietHours != "" || cfg.WebhookRateLimit > 0
+}
+
+// throttle delivers an event now, or holds it back until cfg's quiet hours
+// end or its rate limit allows another webhook.
+func (n *Notifier) throttle(event, site, requestID string, cfg storage.SiteConfig, data map[string]any) {
+	now := n.now()
+	critical := slices.Contains(criticalEvents, event)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d := n.destination(site, cfg)
+	hold := func(until time.Time) {
+		d.held = append(d.held, heldEvent{
+			Type: event, Timestamp: now.UTC().Format(time.RFC3339), RequestID: requestID, Data: data, critical: critical,
+		})
+		n.schedule(d, until)
+	}
+	if until, quiet := cfg.WebhookQuietUntil(now); quiet && !critical {
+		hold(until)
+		return
+	}
+	if next, ok := d.slot(now); !ok {
+		hold(next)
+		return
+	}
+	d.sent = append(d.sent, now)
+	go n.deliver(event, site, requestID, cfg, data)
+}
+
+// destination returns the state of the webhook URL of site, creating it if
+// needed. It must be called with n.mu held.
+func (n *Notifier) destination(site string, cfg storage.SiteConfig) *destination {
+	key := site + "\x00" + cfg.WebhookURL
+	d, ok := n.destinations[key]
+	if !ok {
+		if n.destinations == nil {
+			n.destinations = make(map[string]*destination)
+		}
+		d = &destination{key: key, site: site}
+		n.destinations[key] = d
+	}
+	d.cfg = cfg
+	return d
+}
+
+// slot reports whether the rate limit of d allows a webhook at now and, if
+// not, when it next does.
+func (d *destination) slot(now time.Time) (time.Time, bool) {
+	d.sent = slices.DeleteFunc(d.sent, func(t time.Time) bool { return !t.After(now.Add(-rateWindow)) })
+	if limit := d.cfg.WebhookRateLimit; limit > 0 && len(d.sent) >= limit {
+		return d.sent[0].Add(rateWindow), false
+	}
+	return time.Time{}, true
+}
+
+// schedule makes n flush the held events of d at the latest at at. It must
+// be called with n.mu held.
+func (n *Notifier) schedule(d *destination, at time.Time) {
+	if d.timer != nil {
+		if !at.Before(d.flushAt) {
+			return
+		}
+		d.timer.Stop()
+	}
+	d.flushAt = at
+	d.timer = time.AfterFunc(at.Sub(n.now()), func() { n.flush(d.key) })
+}
+
+// flush sends the events held back from a destination that its quiet hours
+// no longer hold back, as one summary if there are several.
+func (n *Notifier) flush(key string) {
+	now := n.now()
+	n.mu.Lock()
+	d, ok := n.destinations[key]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	d.timer = nil
+
+	until, quiet := d.cfg.WebhookQuietUntil(now)
+	var send, keep []heldEvent
+	for _, e := range d.held {
+		if quiet && !e.critical {
+			keep = append(keep, e)
+		} else {
+			send = append(send, e)
+		}
+	}
+	if len(send) > 0 {
+		if next, ok := d.slot(now); !ok {
+			n.schedule(d, next)
+			n.mu.Unlock()
+			return
+		}
+		d.sent = append(d.sent, now)
+	}
+	d.held = keep
+	if len(keep) > 0 {
+		n.schedule(d, until)
+	}
+	site, cfg := d.site, d.cfg
+	n.mu.Unlock()
+
+	switch len(send) {
+	case 0:
+	case 1:
+		go n.deliver(send[0].Type, site, send[0].RequestID, cfg, send[0].Data)
+	default:
+		go n.deliver(SummaryEvent, site, "", cfg, map[string]any{
+			"site":   site,
+			"count":  len(send),
+			"events": send,
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tspages/internal/storage"
+)
+
+// recordingServer returns the URL of a server that records the webhook
+// types it receives, and a function that waits for n of them.
+func recordingServer(t *testing.T) (string, func(n int) []map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		got = append(got, payload)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, func(n int) []map[string]any {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			out := append([]map[string]any(nil), got...)
+			mu.Unlock()
+			if len(out) >= n || time.Now().After(deadline) {
+				// Let any unexpected extra deliveries arrive.
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				return append([]map[string]any(nil), got...)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestNotifier_RateLimit(t *testing.T) {
+	url, wait := recordingServer(t)
+	n, _ := testNotifier(t)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	cfg := storage.SiteConfig{WebhookURL: url, WebhookRateLimit: 2}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		n.Fire("deploy.success", "docs", cfg, map[string]any{"deployment_id": id})
+	}
+	if got := wait(2); len(got) != 2 {
+		t.Fatalf("got %d webhooks within the limit, want 2", len(got))
+	}
+
+	now = now.Add(rateWindow)
+	n.flush("docs\x00" + url)
+	got := wait(3)
+	if len(got) != 3 {
+		t.Fatalf("got %d webhooks, want 3", len(got))
+	}
+	summary := got[2]
+	if summary["type"] != SummaryEvent {
+		t.Fatalf("type = %v, want %s", summary["type"], SummaryEvent)
+	}
+	data := summary["data"].(map[string]any)
+	held := data["events"].([]any)
+	if data["count"] != float64(2) || len(held) != 2 {
+		t.Fatalf("summary data = %v", data)
+	}
+	if e := held[0].(map[string]any); e["type"] != "deploy.success" || e["data"].(map[string]any)["deployment_id"] != "c" {
+		t.Errorf("first held event = %v", e)
+	}
+}
+
+func TestNotifier_QuietHours(t *testing.T) {
+	url, wait := recordingServer(t)
+	n, _ := testNotifier(t)
+	now := time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	cfg := storage.SiteConfig{WebhookURL: url, WebhookQuietHours: "22:00-07:00"}
+	n.Fire("deploy.success", "docs", cfg, map[string]any{"deployment_id": "a"})
+	n.Fire("deploy.failed", "docs", cfg, map[string]any{"error": "bad archive"})
+	got := wait(1)
+	if len(got) != 1 || got[0]["type"] != "deploy.failed" {
+		t.Fatalf("webhooks during quiet hours = %v, want only deploy.failed", got)
+	}
+
+	// Flushing before the quiet hours end keeps the event held.
+	n.flush("docs\x00" + url)
+	if got := wait(1); len(got) != 1 {
+		t.Fatalf("got %d webhooks before quiet hours ended, want 1", len(got))
+	}
+
+	now = time.Date(2025, 3, 2, 7, 0, 0, 0, time.UTC)
+	n.flush("docs\x00" + url)
+	got = wait(2)
+	if len(got) != 2 || got[1]["type"] != "deploy.success" {
+		t.Fatalf("webhooks after quiet hours = %v, want the held deploy.success", got)
+	}
+}
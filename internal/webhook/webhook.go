@@ -12,11 +12,14 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	standardwebhooks "github.com/standard-webhooks/standard-webhooks/libraries/go"
 
+	"tspages/internal/events"
+	"tspages/internal/fieldcrypt"
 	"tspages/internal/sqlmigrate"
 	"tspages/internal/storage"
 )
@@ -27,11 +30,17 @@ type Notifier struct {
 	client      *http.Client
 	retryDelays []time.Duration
 	sem         chan struct{}
+	now         func() time.Time
+	cipher      *fieldcrypt.Cipher
+
+	mu           sync.Mutex
+	destinations map[string]*destination
 }
 
-// NewNotifier creates a Notifier and runs the delivery log migration.
+// NewNotifier creates a Notifier and runs the delivery log migration. db may
+// be shared with analytics, so the migration version is tracked separately.
 func NewNotifier(db *sql.DB) (*Notifier, error) {
-	if err := sqlmigrate.Apply(db, migrations); err != nil {
+	if err := sqlmigrate.ApplyScoped(db, "webhook", migrations); err != nil {
 		return nil, fmt.Errorf("webhook migration: %w", err)
 	}
 	return &Notifier{
@@ -39,6 +48,7 @@ func NewNotifier(db *sql.DB) (*Notifier, error) {
 		client:      newSafeClient(),
 		retryDelays: []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute},
 		sem:         make(chan struct{}, 20),
+		now:         time.Now,
 	}, nil
 }
 
@@ -74,9 +84,30 @@ var migrations = []func(*sql.Tx) error{
 // SetClient overrides the HTTP client used for webhook delivery.
 func (n *Notifier) SetClient(c *http.Client) { n.client = c }
 
+// SetCipher encrypts the payloads of deliveries logged from now on with c,
+// since they name the users who deployed. Must be called before the first
+// delivery.
+func (n *Notifier) SetCipher(c *fieldcrypt.Cipher) { n.cipher = c }
+
+// Subscribe delivers deploy, site, analytics, and operator events published
+// on bus as webhooks.
+func (n *Notifier) Subscribe(bus *events.Bus) {
+	for _, pattern := range []string{"deploy.*", "site.*", "analytics.*", "operator.*"} {
+		bus.Subscribe(pattern, func(e events.Event) {
+			n.fire(e.Type, e.Site, e.RequestID, e.Config, e.Data)
+		})
+	}
+}
+
 // Fire sends a webhook notification asynchronously. It is a no-op if the
 // config has no WebhookURL or the event is not in the configured event filter.
 func (n *Notifier) Fire(event string, site string, cfg storage.SiteConfig, data map[string]any) {
+	n.fire(event, site, "", cfg, data)
+}
+
+// fire is Fire for an event caused by the request with ID requestID, which
+// the payload carries so receivers can correlate it with tspages' logs.
+func (n *Notifier) fire(event, site, requestID string, cfg storage.SiteConfig, data map[string]any) {
 	if cfg.WebhookURL == "" {
 		return
 	}
@@ -92,18 +123,26 @@ func (n *Notifier) Fire(event string, site string, cfg storage.SiteConfig, data
 			return
 		}
 	}
-	go n.deliver(event, site, cfg, data)
+	if throttled(cfg) {
+		n.throttle(event, site, requestID, cfg, data)
+		return
+	}
+	go n.deliver(event, site, requestID, cfg, data)
 }
 
-func (n *Notifier) deliver(event, site string, cfg storage.SiteConfig, data map[string]any) {
+func (n *Notifier) deliver(event, site, requestID string, cfg storage.SiteConfig, data map[string]any) {
 	msgID := "msg_" + randomHex(16)
 	ts := time.Now().UTC()
 
-	payload, err := json.Marshal(map[string]any{
+	body := map[string]any{
 		"type":      event,
 		"timestamp": ts.Format(time.RFC3339),
 		"data":      data,
-	})
+	}
+	if requestID != "" {
+		body["request_id"] = requestID
+	}
+	payload, err := json.Marshal(body)
 	if err != nil {
 		slog.Error("webhook: marshal payload", "err", err)
 		return
@@ -116,7 +155,7 @@ func (n *Notifier) deliver(event, site string, cfg storage.SiteConfig, data map[
 		select {
 		case n.sem <- struct{}{}:
 		default:
-			slog.Warn("webhook: dropping delivery", "event", event, "attempt", attempt, "site", site, "reason", "too many pending deliveries")
+			slog.Warn("webhook: dropping delivery", "event", event, "attempt", attempt, "site", site, "request_id", requestID, "reason", "too many pending deliveries")
 			return
 		}
 		status, dur, sendErr := n.send(cfg.WebhookURL, cfg.WebhookSecret, msgID, ts, payload)
@@ -179,7 +218,7 @@ func (n *Notifier) logDelivery(webhookID, event, site, url, payload string, atte
 	_, err := n.db.Exec(
 		`INSERT INTO webhook_deliveries (webhook_id, event, site, url, payload, attempt, status, error, created_at, signed, duration_ms)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		webhookID, event, site, url, payload, attempt, status, errStr, time.Now().UTC().Format(time.RFC3339), signed, durationMs,
+		webhookID, event, site, url, n.cipher.Encrypt(payload), attempt, status, errStr, time.Now().UTC().Format(time.RFC3339), signed, durationMs,
 	)
 	if err != nil {
 		slog.Error("webhook: log delivery", "err", err)
@@ -560,6 +599,39 @@ func (n *Notifier) GetDelivery(webhookID string) (DeliverySummary, error) {
 	return d, nil
 }
 
+// FindDeliveries returns up to limit deliveries whose webhook ID contains
+// fragment, newest first.
+func (n *Notifier) FindDeliveries(fragment string, limit int) ([]DeliverySummary, error) {
+	rows, err := n.db.Query(
+		`SELECT webhook_id, event, site, url,
+			MAX(attempt) as attempts,
+			MAX(CASE WHEN status BETWEEN 200 AND 299 THEN 1 ELSE 0 END) as succeeded,
+			MAX(signed) as signed,
+			MIN(created_at) as first_attempt,
+			MAX(created_at) as last_attempt
+		 FROM webhook_deliveries WHERE instr(webhook_id, ?) > 0
+		 GROUP BY webhook_id ORDER BY first_attempt DESC LIMIT ?`,
+		fragment, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("find deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []DeliverySummary
+	for rows.Next() {
+		var d DeliverySummary
+		if err := rows.Scan(&d.WebhookID, &d.Event, &d.Site, &d.URL, &d.Attempts, &d.Succeeded, &d.Signed, &d.FirstAttempt, &d.LastAttempt); err != nil {
+			return nil, fmt.Errorf("scan delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
 // GetDeliveryAttempts returns all attempts for a given webhook ID, ordered by attempt number.
 func (n *Notifier) GetDeliveryAttempts(webhookID string) ([]DeliveryAttempt, error) {
 	rows, err := n.db.Query(
@@ -578,6 +650,7 @@ func (n *Notifier) GetDeliveryAttempts(webhookID string) ([]DeliveryAttempt, err
 		if err := rows.Scan(&a.Attempt, &a.Status, &a.Error, &a.CreatedAt, &a.Payload, &a.DurationMs); err != nil {
 			return nil, fmt.Errorf("scan attempt: %w", err)
 		}
+		a.Payload = n.cipher.Reveal(a.Payload)
 		attempts = append(attempts, a)
 	}
 	if err := rows.Err(); err != nil {
@@ -598,6 +671,9 @@ func (n *Notifier) Resend(webhookID, secret string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("resend: lookup original delivery: %w", err)
 	}
+	if payload, err = n.cipher.Decrypt(payload); err != nil {
+		return 0, fmt.Errorf("resend: %w", err)
+	}
 
 	var maxAttempt int
 	err = n.db.QueryRow(
@@ -625,6 +701,37 @@ func (n *Notifier) Resend(webhookID, secret string) (int, error) {
 	return status, nil
 }
 
+// Ping sends a "ping" event to the site's webhook endpoint once, whatever
+// its event filter, and records the delivery. It returns the HTTP status
+// code or an error.
+func (n *Notifier) Ping(site string, cfg storage.SiteConfig) (int, error) {
+	if cfg.WebhookURL == "" {
+		return 0, fmt.Errorf("ping: site has no webhook URL")
+	}
+	msgID := "msg_" + randomHex(16)
+	ts := time.Now().UTC()
+	payload, err := json.Marshal(map[string]any{
+		"type":      "ping",
+		"timestamp": ts.Format(time.RFC3339),
+		"data":      map[string]any{"site": site},
+	})
+	if err != nil {
+		return 0, err
+	}
+	status, dur, sendErr := n.send(cfg.WebhookURL, cfg.WebhookSecret, msgID, ts, payload)
+
+	errStr := ""
+	if sendErr != nil {
+		errStr = sendErr.Error()
+	}
+	n.logDelivery(msgID, "ping", site, cfg.WebhookURL, string(payload), 1, status, errStr, cfg.WebhookSecret != "", dur.Milliseconds())
+
+	if sendErr != nil {
+		return 0, sendErr
+	}
+	return status, nil
+}
+
 func randomHex(n int) string {
 	b := make([]byte, n)
 	if _, err := rand.Read(b); err != nil {
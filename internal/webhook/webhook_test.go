@@ -2,7 +2,9 @@ package webhook
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -13,6 +15,8 @@ import (
 	"testing"
 	"time"
 
+	"tspages/internal/events"
+	"tspages/internal/fieldcrypt"
 	"tspages/internal/storage"
 
 	_ "modernc.org/sqlite"
@@ -94,6 +98,66 @@ func TestNotifier_FiresWebhook(t *testing.T) {
 	}
 }
 
+func TestNotifier_Subscribe(t *testing.T) {
+	ch := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		ch <- payload["type"].(string)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	n, _ := testNotifier(t)
+	bus := events.New()
+	n.Subscribe(bus)
+
+	cfg := storage.SiteConfig{WebhookURL: srv.URL}
+	bus.Publish(events.Event{Type: events.HealthDegraded, Config: cfg})
+	bus.Publish(events.Event{Type: events.SiteCreated, Site: "mysite", Config: cfg})
+
+	select {
+	case typ := <-ch:
+		if typ != events.SiteCreated {
+			t.Errorf("type = %q, want %q", typ, events.SiteCreated)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+	select {
+	case typ := <-ch:
+		t.Errorf("unexpected webhook %q", typ)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotifier_Subscribe_RequestID(t *testing.T) {
+	ch := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		ch <- payload
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	n, _ := testNotifier(t)
+	bus := events.New()
+	n.Subscribe(bus)
+
+	cfg := storage.SiteConfig{WebhookURL: srv.URL}
+	bus.Publish(events.Event{Type: events.DeploySuccess, Site: "mysite", Config: cfg, RequestID: "3f9a1c2b4d5e6f70"})
+
+	select {
+	case payload := <-ch:
+		if payload["request_id"] != "3f9a1c2b4d5e6f70" {
+			t.Errorf("request_id = %v, want the publishing request's ID", payload["request_id"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+}
+
 func TestNotifier_RespectsEventFilter(t *testing.T) {
 	var called atomic.Int32
 
@@ -746,6 +810,32 @@ func TestNotifier_GetDelivery_NotFound(t *testing.T) {
 	}
 }
 
+func TestNotifier_FindDeliveries(t *testing.T) {
+	n, db := testNotifier(t)
+
+	for i, id := range []string{"msg_abc123", "msg_abc123", "msg_abd456", "msg_fff789"} {
+		_, err := db.Exec(
+			`INSERT INTO webhook_deliveries (webhook_id, event, site, url, payload, attempt, status, error, created_at, signed, duration_ms)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, "deploy.success", "docs", "http://example.com", `{}`, i+1, 200, "", fmt.Sprintf("2025-06-01T10:00:0%dZ", i), 0, 10,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := n.FindDeliveries("ab", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].WebhookID != "msg_abd456" || found[1].WebhookID != "msg_abc123" {
+		t.Fatalf("found = %+v, want msg_abd456 and msg_abc123", found)
+	}
+	if found, _ := n.FindDeliveries("ab", 1); len(found) != 1 {
+		t.Errorf("limit 1 returned %d deliveries", len(found))
+	}
+}
+
 func TestNotifier_Resend(t *testing.T) {
 	var calls atomic.Int32
 
@@ -789,6 +879,43 @@ func TestNotifier_Resend(t *testing.T) {
 	}
 }
 
+func TestNotifier_EncryptsPayloads(t *testing.T) {
+	var received atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	n, db := testNotifier(t)
+	c, err := fieldcrypt.New(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.SetCipher(c)
+	payload := `{"deployed_by":"alice@example.com"}`
+	n.logDelivery("msg_enc", "deploy.success", "docs", srv.URL, payload, 1, 500, "server error", false, 0)
+
+	var stored string
+	if err := db.QueryRow(`SELECT payload FROM webhook_deliveries WHERE webhook_id = ?`, "msg_enc").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "alice") {
+		t.Errorf("payload stored in plain text: %s", stored)
+	}
+	attempts, err := n.GetDeliveryAttempts("msg_enc")
+	if err != nil || len(attempts) != 1 || attempts[0].Payload != payload {
+		t.Fatalf("attempts = %+v, %v", attempts, err)
+	}
+	if _, err := n.Resend("msg_enc", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := received.Load().(string); got != payload {
+		t.Errorf("resent %q, want the plain payload", got)
+	}
+}
+
 func TestNotifier_Resend_NotFound(t *testing.T) {
 	n, _ := testNotifier(t)
 
@@ -798,6 +925,33 @@ func TestNotifier_Resend_NotFound(t *testing.T) {
 	}
 }
 
+func TestNotifier_Ping(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(204)
+	}))
+	defer srv.Close()
+
+	n, db := testNotifier(t)
+	// Pings go out whatever the event filter.
+	status, err := n.Ping("docs", storage.SiteConfig{WebhookURL: srv.URL, WebhookEvents: []string{"deploy.success"}})
+	if err != nil || status != 204 {
+		t.Fatalf("status = %d, err = %v", status, err)
+	}
+	if got["type"] != "ping" || got["data"].(map[string]any)["site"] != "docs" {
+		t.Errorf("payload = %v", got)
+	}
+	var event string
+	if err := db.QueryRow(`SELECT event FROM webhook_deliveries WHERE site = 'docs'`).Scan(&event); err != nil || event != "ping" {
+		t.Errorf("logged event = %q, err = %v", event, err)
+	}
+
+	if _, err := n.Ping("docs", storage.SiteConfig{}); err == nil {
+		t.Error("expected error without a webhook URL")
+	}
+}
+
 func TestNotifier_SemaphoreDrop(t *testing.T) {
 	// Create a server that blocks until we release it.
 	block := make(chan struct{})
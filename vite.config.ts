@@ -15,12 +15,14 @@ export default defineConfig({
     rollupOptions: {
       input: {
         main: resolve(import.meta.dirname, "web/admin/src/main.css"),
+        layout: resolve(import.meta.dirname, "web/admin/src/layout.ts"),
         sites: resolve(import.meta.dirname, "web/admin/src/pages/sites.ts"),
         site: resolve(import.meta.dirname, "web/admin/src/pages/site.ts"),
         deployment: resolve(import.meta.dirname, "web/admin/src/pages/deployment.ts"),
         deployments: resolve(import.meta.dirname, "web/admin/src/pages/deployments.ts"),
         analytics: resolve(import.meta.dirname, "web/admin/src/pages/analytics.ts"),
         webhooks: resolve(import.meta.dirname, "web/admin/src/pages/webhooks.ts"),
+        live: resolve(import.meta.dirname, "web/admin/src/pages/live.ts"),
       },
     },
   },
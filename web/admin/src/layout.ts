@@ -0,0 +1,20 @@
+import { initPalette } from "./lib/palette";
+import { currentTheme, nextTheme, setTheme } from "./lib/theme";
+
+for (const button of document.querySelectorAll<HTMLButtonElement>('[data-action="toggle-theme"]')) {
+  button.addEventListener("click", async () => {
+    const theme = nextTheme(currentTheme());
+
+    try {
+      await setTheme(theme);
+    } catch (error) {
+      alert(`Failed: ${error instanceof Error ? error.message : String(error)}`);
+      return;
+    }
+
+    button.title = `Theme: ${theme}`;
+    button.setAttribute("aria-label", `Switch theme (currently ${theme})`);
+  });
+}
+
+initPalette();
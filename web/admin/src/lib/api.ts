@@ -22,9 +22,23 @@ export async function confirmAction({
       location.reload();
     }
   } else {
-    const body = await response.text();
+    alert(`Failed: ${await errorMessage(response)}`);
+  }
+}
+
+/**
+ * Extracts the message from a failed API response: the `detail` of problem
+ * details, or the raw body for plain-text errors.
+ */
+export async function errorMessage(response: Response): Promise<string> {
+  const body = await response.text();
+
+  try {
+    const problem = JSON.parse(body) as { detail?: string; error?: string };
 
-    alert(`Failed: ${body.trim()}`);
+    return problem.detail ?? problem.error ?? body.trim();
+  } catch {
+    return body.trim();
   }
 }
 
@@ -16,6 +16,7 @@ import {
   type TooltipModel,
 } from "chart.js";
 import { TreemapController, TreemapElement } from "chartjs-chart-treemap";
+import { isDark, onThemeChange } from "./theme";
 
 // region Theme
 
@@ -47,7 +48,7 @@ export function initCharts(): Theme {
     Tooltip,
   );
 
-  const dark = window.matchMedia("(prefers-color-scheme: dark)").matches;
+  const dark = isDark();
   const style = getComputedStyle(document.documentElement);
   const cv = (name: string) => style.getPropertyValue(name).trim();
 
@@ -590,6 +591,14 @@ export function formatNumber(number: number): string {
   return String(number);
 }
 
+/**
+ * Returns the timezone chart data is bucketed in, as chosen in the user's
+ * preferences or the server's default, so labels match the buckets.
+ */
+export function timeZone(): string | undefined {
+  return document.documentElement.dataset.timezone || undefined;
+}
+
 export function formatLabel(iso: string, range: string): string {
   const date = new Date(iso);
 
@@ -598,12 +607,14 @@ export function formatLabel(iso: string, range: string): string {
       hour: "2-digit",
       minute: "2-digit",
       hour12: false,
+      timeZone: timeZone(),
     });
   }
 
   return date.toLocaleDateString(undefined, {
     month: "short",
     day: "numeric",
+    timeZone: timeZone(),
   });
 }
 
@@ -630,7 +641,7 @@ export function pluck<T, K extends keyof T>(items: T[], key: K): T[K][] {
 }
 
 export function reloadOnThemeChange(): void {
-  window.matchMedia("(prefers-color-scheme: dark)").addEventListener("change", () => {
+  onThemeChange(() => {
     location.reload();
   });
 }
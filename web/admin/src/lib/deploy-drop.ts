@@ -1,5 +1,7 @@
 import { zipSync } from "fflate";
 
+import { errorMessage } from "./api";
+
 type State = "idle" | "dragging" | "uploading" | "success" | "error";
 
 const OVERLAY_BASE =
@@ -248,7 +250,7 @@ export function initDeployDrop(siteName: string): void {
   async function upload(body: Blob, filename?: string): Promise<void> {
     setState("uploading", `Deploying to ${siteName}\u2026`);
 
-    let url = `/deploy/${encodeURIComponent(siteName)}`;
+    let url = `/api/v1/deploy/${encodeURIComponent(siteName)}`;
 
     if (filename) {
       url += `/${encodeURIComponent(filename)}`;
@@ -264,7 +266,7 @@ export function initDeployDrop(siteName: string): void {
         setState("success", "Deployed!");
         setTimeout(() => location.reload(), 800);
       } else {
-        setState("error", `Deploy failed: ${(await resp.text()).trim()}`);
+        setState("error", `Deploy failed: ${await errorMessage(resp)}`);
       }
     } catch {
       setState("error", "Network error");
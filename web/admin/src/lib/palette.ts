@@ -0,0 +1,240 @@
+import { errorMessage } from "./api";
+import { closeModal, initModal, openModal } from "./modal";
+
+interface SearchResult {
+  kind: "site" | "deployment" | "webhook" | "help";
+  title: string;
+  detail?: string;
+  url: string;
+  site?: string;
+}
+
+interface PaletteItem {
+  group: string;
+  label: string;
+  detail?: string;
+  run: () => void;
+}
+
+const groupLabels: Record<SearchResult["kind"], string> = {
+  site: "Sites",
+  deployment: "Deployments",
+  webhook: "Webhook deliveries",
+  help: "Help",
+};
+
+const id = "command-palette";
+
+/**
+ * Returns the commands available on every page: one for each link in the
+ * main navigation, plus the actions in the header.
+ */
+function commands(): PaletteItem[] {
+  const items: PaletteItem[] = [];
+
+  for (const link of document.querySelectorAll<HTMLAnchorElement>('nav[aria-label="Main"] a')) {
+    const label = link.textContent?.trim() ?? "";
+
+    items.push({ group: "Go to", label, run: () => (location.href = link.href) });
+  }
+
+  items.push({ group: "Go to", label: "Your permissions", run: () => (location.href = "/whoami") });
+
+  const themeButton = document.querySelector<HTMLButtonElement>('[data-action="toggle-theme"]');
+
+  if (themeButton) {
+    items.push({ group: "Commands", label: "Switch theme", run: () => themeButton.click() });
+  }
+
+  return items;
+}
+
+/**
+ * Set up the command palette: open it with Cmd+K or Ctrl+K, or any
+ * `[data-action="open-palette"]` button, filter commands as the user types,
+ * and search sites, deployments, webhooks, and help pages on the server.
+ */
+export function initPalette(): void {
+  const node = initModal(id);
+  const input = document.getElementById(`${id}-input`) as HTMLInputElement | null;
+  const list = document.getElementById(`${id}-results`);
+
+  if (!node || !input || !list) {
+    return;
+  }
+
+  const available = commands();
+  let items: PaletteItem[] = [];
+  let active = 0;
+  let controller: AbortController | undefined;
+  let timer: number | undefined;
+
+  const open = () => {
+    input.value = "";
+    render(available, "");
+    openModal(id);
+    input.focus();
+  };
+
+  const select = (index: number) => {
+    const options = list.querySelectorAll<HTMLElement>('[role="option"]');
+
+    if (options.length === 0) {
+      input.removeAttribute("aria-activedescendant");
+      return;
+    }
+
+    active = (index + options.length) % options.length;
+
+    for (const [i, option] of options.entries()) {
+      option.setAttribute("aria-selected", String(i === active));
+    }
+
+    input.setAttribute("aria-activedescendant", options[active].id);
+    options[active].scrollIntoView({ block: "nearest" });
+  };
+
+  const run = (index: number) => {
+    const item = items[index];
+
+    if (item) {
+      closeModal(id);
+      item.run();
+    }
+  };
+
+  function render(next: PaletteItem[], message: string): void {
+    items = next;
+    list!.replaceChildren();
+
+    let group = "";
+
+    for (const [index, item] of items.entries()) {
+      if (item.group !== group) {
+        group = item.group;
+
+        const heading = document.createElement("li");
+        heading.setAttribute("role", "presentation");
+        heading.className = "px-4 pt-3 pb-1 text-xs uppercase tracking-wide text-muted";
+        heading.textContent = group;
+        list!.append(heading);
+      }
+
+      const option = document.createElement("li");
+      option.id = `${id}-option-${index}`;
+      option.setAttribute("role", "option");
+      option.className =
+        "flex items-baseline gap-3 mx-2 px-2 py-1.5 rounded-md cursor-pointer " +
+        "aria-selected:bg-blue-500/10 aria-selected:text-blue-600 dark:aria-selected:text-blue-400";
+
+      const label = document.createElement("span");
+      label.className = "truncate";
+      label.textContent = item.label;
+      option.append(label);
+
+      if (item.detail) {
+        const detail = document.createElement("span");
+        detail.className = "ml-auto shrink-0 text-xs text-muted";
+        detail.textContent = item.detail;
+        option.append(detail);
+      }
+
+      option.addEventListener("mousemove", () => select(index));
+      option.addEventListener("click", () => run(index));
+      list!.append(option);
+    }
+
+    if (message) {
+      const status = document.createElement("li");
+      status.setAttribute("role", "presentation");
+      status.className = "px-4 py-3 text-muted";
+      status.textContent = message;
+      list!.append(status);
+    }
+
+    select(0);
+  }
+
+  async function search(query: string): Promise<void> {
+    const matching = available.filter((item) => item.label.toLowerCase().includes(query.toLowerCase()));
+
+    if (!query) {
+      render(matching, "");
+      return;
+    }
+
+    controller?.abort();
+    controller = new AbortController();
+
+    let results: SearchResult[];
+
+    try {
+      const response = await fetch(`/api/v1/search?q=${encodeURIComponent(query)}`, {
+        headers: { Accept: "application/json" },
+        signal: controller.signal,
+      });
+
+      if (!response.ok) {
+        render(matching, `Search failed: ${await errorMessage(response)}`);
+        return;
+      }
+
+      results = ((await response.json()) as { results: SearchResult[] }).results;
+    } catch (error) {
+      if (error instanceof DOMException && error.name === "AbortError") {
+        return;
+      }
+
+      render(matching, "Search failed");
+      return;
+    }
+
+    const found = results.map<PaletteItem>((result) => ({
+      group: groupLabels[result.kind],
+      label: result.title,
+      detail: result.detail,
+      run: () => (location.href = result.url),
+    }));
+    const next = [...matching, ...found];
+
+    render(next, next.length === 0 ? "No results" : "");
+  }
+
+  input.addEventListener("input", () => {
+    window.clearTimeout(timer);
+    timer = window.setTimeout(() => void search(input.value.trim()), 150);
+  });
+
+  input.addEventListener("keydown", (event) => {
+    switch (event.key) {
+      case "ArrowDown":
+        event.preventDefault();
+        select(active + 1);
+        break;
+      case "ArrowUp":
+        event.preventDefault();
+        select(active - 1);
+        break;
+      case "Enter":
+        event.preventDefault();
+        run(active);
+        break;
+    }
+  });
+
+  document.addEventListener("keydown", (event) => {
+    if (event.key.toLowerCase() === "k" && (event.metaKey || event.ctrlKey)) {
+      event.preventDefault();
+
+      if (node.classList.contains("hidden")) {
+        open();
+      } else {
+        closeModal(id);
+      }
+    }
+  });
+
+  for (const button of document.querySelectorAll<HTMLButtonElement>('[data-action="open-palette"]')) {
+    button.addEventListener("click", open);
+  }
+}
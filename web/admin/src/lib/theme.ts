@@ -0,0 +1,68 @@
+import { errorMessage } from "./api";
+
+export type Theme = "system" | "light" | "dark";
+
+const themes: Theme[] = ["system", "light", "dark"];
+const darkQuery = window.matchMedia("(prefers-color-scheme: dark)");
+
+/**
+ * Returns the theme selected in the user's preferences, as rendered into
+ * the `data-theme` attribute of the root element.
+ */
+export function currentTheme(): Theme {
+  const theme = document.documentElement.dataset.theme as Theme | undefined;
+
+  return theme && themes.includes(theme) ? theme : "system";
+}
+
+/**
+ * Reports whether the page is shown in dark mode, either by choice or by
+ * following the system color scheme.
+ */
+export function isDark(): boolean {
+  const theme = currentTheme();
+
+  return theme === "dark" || (theme === "system" && darkQuery.matches);
+}
+
+/**
+ * Calls `listener` whenever the effective color scheme changes, whether the
+ * user switched themes or the system scheme changed.
+ */
+export function onThemeChange(listener: () => void): void {
+  darkQuery.addEventListener("change", () => {
+    if (currentTheme() === "system") {
+      listener();
+    }
+  });
+  document.addEventListener("themechange", listener);
+}
+
+/**
+ * Applies `theme` to the page and stores it in the user's preferences,
+ * keeping their other preferences.
+ */
+export async function setTheme(theme: Theme): Promise<void> {
+  const response = await fetch("/api/v1/preferences", { headers: { Accept: "application/json" } });
+  const preferences = response.ok ? ((await response.json()) as Record<string, string>) : {};
+
+  const saved = await fetch("/api/v1/preferences", {
+    method: "PUT",
+    headers: { "Content-Type": "application/json", Accept: "application/json" },
+    body: JSON.stringify({ ...preferences, theme }),
+  });
+
+  if (!saved.ok) {
+    throw new Error(await errorMessage(saved));
+  }
+
+  document.documentElement.dataset.theme = theme;
+  document.dispatchEvent(new Event("themechange"));
+}
+
+/**
+ * Returns the theme after `theme` in the toggle's cycle.
+ */
+export function nextTheme(theme: Theme): Theme {
+  return themes[(themes.indexOf(theme) + 1) % themes.length];
+}
@@ -21,8 +21,14 @@ interface StatusBucket {
   server_err: number;
 }
 
+interface TransferBucket {
+  time: string;
+  bytes: number;
+}
+
 interface AnalyticsData {
   range: string;
+  transfer_time_series?: TransferBucket[];
   time_series?: TimeBucket[];
   status_time_series?: StatusBucket[];
   sites?: { site: string; count: number }[];
@@ -37,8 +43,15 @@ async function main(): Promise<void> {
     headers: { Accept: "application/json" },
   });
   if (!response.ok) return;
-  const { nodes, os, range, sites, status_time_series, time_series }: AnalyticsData =
-    await response.json();
+  const {
+    nodes,
+    os,
+    range,
+    sites,
+    status_time_series,
+    time_series,
+    transfer_time_series,
+  }: AnalyticsData = await response.json();
 
   if (time_series?.length) {
     const counts = time_series.map(({ count }) => count);
@@ -77,6 +90,23 @@ async function main(): Promise<void> {
     );
   }
 
+  if (transfer_time_series?.length) {
+    lineChart(
+      document.getElementById("transfer-chart") as HTMLCanvasElement | null,
+      // Transfer is counted per day, so label days whatever the range.
+      transfer_time_series.map(({ time }) => formatLabel(time, "P1D")),
+      [
+        {
+          label: "Transfer",
+          data: transfer_time_series.map(({ bytes }) => bytes),
+          color: theme.cv("--color-purple-400"),
+          fill: "start",
+        },
+      ],
+      { formatValue: formatBytes },
+    );
+  }
+
   if (sites?.length) {
     doughnut(
       document.getElementById("sites-chart") as HTMLCanvasElement | null,
@@ -108,5 +138,18 @@ async function main(): Promise<void> {
   }
 }
 
+function formatBytes(bytes: number): string {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let value = bytes;
+  let unit = 0;
+
+  while (value >= 1024 && unit < units.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+
+  return `${unit === 0 ? value : value.toFixed(1)} ${units[unit]}`;
+}
+
 document.addEventListener("DOMContentLoaded", main);
 reloadOnThemeChange();
@@ -1,4 +1,4 @@
-import { confirmAction } from "../lib/api";
+import { confirmAction, errorMessage } from "../lib/api";
 
 function main(): void {
   const mainNode = document.querySelector<HTMLElement>("main")!;
@@ -13,13 +13,57 @@ function main(): void {
 
       return confirmAction({
         message: `Activate deployment "${id}"?`,
-        url: `/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/activate`,
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/activate`,
         method: "POST",
       });
     });
 
   // endregion
 
+  // region Pin deployment
+
+  document
+    .querySelector<HTMLButtonElement>("[data-action='pin']")
+    ?.addEventListener("click", async () => {
+      const id = mainNode.dataset.deploymentId!;
+      const reason = prompt(
+        `Pin deployment "${id}"? No other deployment can be activated until it is unpinned.\n\nReason (optional):`,
+      );
+
+      if (reason === null) {
+        return;
+      }
+
+      const response = await fetch(
+        `/api/v1/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/pin`,
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ reason }),
+        },
+      );
+
+      if (response.ok) {
+        location.reload();
+      } else {
+        alert(`Failed: ${await errorMessage(response)}`);
+      }
+    });
+
+  document
+    .querySelector<HTMLButtonElement>("[data-action='unpin']")
+    ?.addEventListener("click", () => {
+      const id = mainNode.dataset.deploymentId!;
+
+      return confirmAction({
+        message: `Unpin deployment "${id}"?`,
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/pin`,
+        method: "DELETE",
+      });
+    });
+
+  // endregion
+
   // region Delete deployment
 
   document
@@ -29,7 +73,7 @@ function main(): void {
 
       return confirmAction({
         message: `Delete deployment "${id}"? This cannot be undone.`,
-        url: `/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}`,
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}`,
         method: "DELETE",
         onSuccess: `/sites/${encodeURIComponent(siteName)}`,
       });
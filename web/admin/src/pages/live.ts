@@ -0,0 +1,105 @@
+interface LiveRequest {
+  timestamp: string;
+  path: string;
+  status: number;
+  user_login?: string;
+  user_name?: string;
+  node_name?: string;
+  deployment_id?: string;
+}
+
+// Rows kept in the table; older requests are dropped.
+const maxRows = 500;
+
+const rows = document.querySelector<HTMLTableSectionElement>("[data-live-requests]")!;
+const empty = rows.querySelector<HTMLTableRowElement>("[data-live-empty]")!;
+const status = document.querySelector<HTMLElement>("[data-live-status]")!;
+const pathFilter = document.querySelector<HTMLInputElement>("input[name='path']")!;
+const userFilter = document.querySelector<HTMLInputElement>("input[name='user']")!;
+const statusFilter = document.querySelector<HTMLSelectElement>("select[name='status']")!;
+const pauseButton = document.querySelector<HTMLButtonElement>("[data-action='pause']")!;
+
+let paused = false;
+
+function cell(text: string, className = ""): HTMLTableCellElement {
+  const td = document.createElement("td");
+  td.className = `px-4 py-3 text-sm border-b border-paper dark:border-base-950 ${className}`;
+  td.textContent = text;
+
+  return td;
+}
+
+function matches(row: HTMLTableRowElement): boolean {
+  const path = pathFilter.value.trim().toLowerCase();
+  const user = userFilter.value.trim().toLowerCase();
+  const statusClass = statusFilter.value;
+
+  return (
+    (path === "" || row.dataset.path!.includes(path)) &&
+    (user === "" || row.dataset.user!.includes(user)) &&
+    (statusClass === "" || row.dataset.status!.startsWith(statusClass))
+  );
+}
+
+function applyFilters(): void {
+  for (const row of rows.querySelectorAll<HTMLTableRowElement>("tr[data-path]")) {
+    row.hidden = !matches(row);
+  }
+}
+
+function addRow(request: LiveRequest): void {
+  const row = document.createElement("tr");
+  const user = request.user_name || request.user_login || "";
+  row.dataset.path = request.path.toLowerCase();
+  row.dataset.user = `${user} ${request.user_login ?? ""} ${request.node_name ?? ""}`.toLowerCase();
+  row.dataset.status = String(request.status);
+
+  const time = new Date(request.timestamp);
+  const statusColor = request.status >= 400 ? "text-red-600 dark:text-red-400" : "";
+  row.append(
+    cell(time.toLocaleTimeString(), "text-muted whitespace-nowrap tabular-nums"),
+    cell(String(request.status), `font-mono tabular-nums ${statusColor}`),
+    cell(request.path, "font-mono break-all"),
+    cell(user || "—"),
+    cell(request.node_name || "—", "text-muted"),
+    cell(request.deployment_id || "—", "font-mono text-muted"),
+  );
+  row.hidden = !matches(row);
+
+  empty.hidden = true;
+  rows.prepend(row);
+  const requests = rows.querySelectorAll("tr[data-path]");
+  for (let i = maxRows; i < requests.length; i++) {
+    requests[i].remove();
+  }
+}
+
+const source = new EventSource(window.location.pathname);
+source.addEventListener("open", () => {
+  status.textContent = "Live";
+});
+source.addEventListener("error", () => {
+  status.textContent = "Reconnecting…";
+});
+source.addEventListener("request", (event) => {
+  if (!paused) {
+    addRow(JSON.parse((event as MessageEvent<string>).data) as LiveRequest);
+  }
+});
+
+pauseButton.addEventListener("click", () => {
+  paused = !paused;
+  pauseButton.textContent = paused ? "Resume" : "Pause";
+  status.textContent = paused ? "Paused" : "Live";
+});
+
+document.querySelector<HTMLButtonElement>("[data-action='clear']")!.addEventListener("click", () => {
+  for (const row of rows.querySelectorAll("tr[data-path]")) {
+    row.remove();
+  }
+  empty.hidden = false;
+});
+
+for (const input of [pathFilter, userFilter, statusFilter]) {
+  input.addEventListener("input", applyFilters);
+}
@@ -1,4 +1,4 @@
-import { confirmAction, copyToClipboard } from "../lib/api";
+import { confirmAction, copyToClipboard, errorMessage } from "../lib/api";
 import { initDeployDrop } from "../lib/deploy-drop";
 import { closeModal, initModal, openModal } from "../lib/modal";
 import {
@@ -109,7 +109,7 @@ function main(): void {
 
       return confirmAction({
         message: `Activate deployment "${id}"?`,
-        url: `/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/activate`,
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}/${encodeURIComponent(id)}/activate`,
         method: "POST",
       });
     });
@@ -117,6 +117,20 @@ function main(): void {
 
   // endregion
 
+  // region Stop canary
+
+  document
+    .querySelector<HTMLButtonElement>("[data-action='stop-canary']")
+    ?.addEventListener("click", () =>
+      confirmAction({
+        message: "Stop the canary and serve the active deployment to all visitors?",
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}/canary`,
+        method: "DELETE",
+      }),
+    );
+
+  // endregion
+
   // region Delete site
 
   document
@@ -124,7 +138,7 @@ function main(): void {
     ?.addEventListener("click", () =>
       confirmAction({
         message: `Delete site "${siteName}" and all its deployments?`,
-        url: `/deploy/${encodeURIComponent(siteName)}`,
+        url: `/api/v1/deploy/${encodeURIComponent(siteName)}`,
         method: "DELETE",
         onSuccess: "/sites",
       }),
@@ -137,11 +151,11 @@ function main(): void {
   document
     .querySelector<HTMLButtonElement>("[data-action='cleanup']")
     ?.addEventListener("click", async () => {
-      if (!confirm("Delete all inactive deployments? This cannot be undone.")) {
+      if (!confirm("Move all inactive deployments to the trash?")) {
         return;
       }
 
-      const response = await fetch(`/deploy/${encodeURIComponent(siteName)}/deployments`, {
+      const response = await fetch(`/api/v1/deploy/${encodeURIComponent(siteName)}/deployments`, {
         method: "DELETE",
       });
 
@@ -151,9 +165,7 @@ function main(): void {
         alert(`Deleted ${data.deleted} deployment(s).`);
         location.reload();
       } else {
-        const text = await response.text();
-
-        alert(`Cleanup failed: ${text.trim()}`);
+        alert(`Cleanup failed: ${await errorMessage(response)}`);
       }
     });
 